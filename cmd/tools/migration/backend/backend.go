@@ -16,7 +16,7 @@ type Backend interface {
 	Save(meta *meta.Meta) error
 	Clean() error
 	Backup(meta *meta.Meta, backupFile string) error
-	BackupV2(file string) error
+	BackupV2(file string, backupOpts ...BackupOption) error
 	Restore(backupFile string) error
 }
 
@@ -40,12 +40,36 @@ func (v *BackupHeader) String() string {
 
 func (v *BackupHeader) ProtoMessage() {}
 
+// BackupCompressionZstd compresses the entries of backup with zstd.
+const BackupCompressionZstd = "zstd"
+
 type BackupHeaderExtra struct {
 	EntryIncludeRootPath bool `json:"entry_include_root_path"`
+	// Compression of the entries following the header, empty if not compressed
+	Compression string `json:"compression,omitempty"`
+	// Checksum is whether the backup ends with the crc32 checksum of all the bytes before it
+	Checksum bool `json:"checksum,omitempty"`
 }
 
 type extraOption func(extra *BackupHeaderExtra)
 
+// BackupOption sets the format of a backup file.
+type BackupOption = extraOption
+
+// WithCompression compresses the entries of backup with zstd.
+func WithCompression() BackupOption {
+	return func(extra *BackupHeaderExtra) {
+		extra.Compression = BackupCompressionZstd
+	}
+}
+
+// WithChecksum appends a checksum to backup, which is verified by restore.
+func WithChecksum() BackupOption {
+	return func(extra *BackupHeaderExtra) {
+		extra.Checksum = true
+	}
+}
+
 func setEntryIncludeRootPath(include bool) extraOption {
 	return func(extra *BackupHeaderExtra) {
 		extra.EntryIncludeRootPath = include
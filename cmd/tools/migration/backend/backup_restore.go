@@ -3,11 +3,13 @@ package backend
 import (
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 
 	"github.com/golang/protobuf/proto"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus/pkg/util/compressor"
 )
 
 type BackupFile []byte
@@ -98,16 +100,53 @@ func (f *BackupFile) ReadEntryFromPos(pos uint64) (entryLength uint64, entry *co
 	return entryLength, entry, nil
 }
 
+// CorruptedBackupError is returned when the backup file fails the checksum or decompression,
+// e.g. it's truncated.
+type CorruptedBackupError struct {
+	Reason string
+}
+
+func (e *CorruptedBackupError) Error() string {
+	return fmt.Sprintf("corrupted backup file: %s", e.Reason)
+}
+
 func (f *BackupFile) DeSerialize() (header *BackupHeader, kvs map[string]string, err error) {
-	pos := uint64(0)
 	header, headerLength, err := f.ReadHeader()
 	if err != nil {
 		return nil, nil, err
 	}
-	pos += 8 + headerLength
+	extra := newDefaultBackupHeaderExtra()
+	if len(header.Extra) > 0 {
+		extra = GetExtra(header.Extra)
+	}
+
+	content := (*f)[8+headerLength:]
+	if extra.Checksum {
+		if len(content) < crc32.Size {
+			return nil, nil, &CorruptedBackupError{Reason: "cannot read checksum"}
+		}
+		content = content[:len(content)-crc32.Size]
+		expected := binary.LittleEndian.Uint32((*f)[len(*f)-crc32.Size:])
+		if actual := crc32.Checksum((*f)[:len(*f)-crc32.Size], backupChecksumTable); actual != expected {
+			return nil, nil, &CorruptedBackupError{Reason: fmt.Sprintf("checksum mismatch, expected: %d, actual: %d", expected, actual)}
+		}
+	}
+	switch extra.Compression {
+	case "":
+	case BackupCompressionZstd:
+		content, err = compressor.ZstdDecompressBytes(content, nil)
+		if err != nil {
+			return nil, nil, &CorruptedBackupError{Reason: fmt.Sprintf("cannot decompress entries: %s", err.Error())}
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid backup file, unknown compression: %s", extra.Compression)
+	}
+
+	entries := BackupFile(content)
+	pos := uint64(0)
 	kvs = make(map[string]string)
 	for {
-		entryLength, entry, err := f.ReadEntryFromPos(pos)
+		entryLength, entry, err := entries.ReadEntryFromPos(pos)
 		if err == io.EOF {
 			return header, kvs, nil
 		}
@@ -119,19 +158,43 @@ func (f *BackupFile) DeSerialize() (header *BackupHeader, kvs map[string]string,
 	}
 }
 
+var backupChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
 type BackupCodec struct{}
 
+// Serialize writes header and kvs into a backup file, the entries are compressed and the checksum
+// is appended as the Extra of header tells.
 func (c *BackupCodec) Serialize(header *BackupHeader, kvs map[string]string) (BackupFile, error) {
 	file := make(BackupFile, 0)
 	header.Entries = int64(len(kvs))
 	if err := file.WriteHeader(header); err != nil {
 		return nil, err
 	}
+	extra := newDefaultBackupHeaderExtra()
+	if len(header.Extra) > 0 {
+		extra = GetExtra(header.Extra)
+	}
+
+	entries := make(BackupFile, 0)
 	for k, v := range kvs {
-		if err := file.WriteEntry(k, v); err != nil {
+		if err := entries.WriteEntry(k, v); err != nil {
 			return nil, err
 		}
 	}
+	switch extra.Compression {
+	case "":
+		file.writeBytes(entries)
+	case BackupCompressionZstd:
+		file = compressor.ZstdCompressBytes(entries, file)
+	default:
+		return nil, fmt.Errorf("unknown backup compression: %s", extra.Compression)
+	}
+
+	if extra.Checksum {
+		checksum := make([]byte, crc32.Size)
+		binary.LittleEndian.PutUint32(checksum, crc32.Checksum(file, backupChecksumTable))
+		file.writeBytes(checksum)
+	}
 	return file, nil
 }
 
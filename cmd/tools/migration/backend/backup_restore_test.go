@@ -1,10 +1,13 @@
 package backend
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
+	"github.com/cockroachdb/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBackupCodec_Serialize(t *testing.T) {
@@ -29,3 +32,62 @@ func TestBackupCodec_Serialize(t *testing.T) {
 	assert.True(t, reflect.DeepEqual(header, gotHeader))
 	assert.True(t, reflect.DeepEqual(kvs, gotEntries))
 }
+
+func TestBackupCodec_CompressionAndChecksum(t *testing.T) {
+	kvs := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		kvs[fmt.Sprintf("by-dev/meta/root-coord/collection/%d", i)] = fmt.Sprintf("collection-info-%d", i)
+	}
+	newHeader := func(opts ...BackupOption) *BackupHeader {
+		return &BackupHeader{
+			Version:  BackupHeaderVersionV1,
+			Instance: "by-dev",
+			MetaPath: "meta",
+			Extra:    newBackupHeaderExtra(append([]extraOption{setEntryIncludeRootPath(true)}, opts...)...).ToJSONBytes(),
+		}
+	}
+	codec := NewBackupCodec()
+
+	raw, err := codec.Serialize(newHeader(), kvs)
+	require.NoError(t, err)
+
+	header := newHeader(WithCompression(), WithChecksum())
+	file, err := codec.Serialize(header, kvs)
+	require.NoError(t, err)
+	assert.Less(t, len(file), len(raw))
+
+	gotHeader, gotEntries, err := codec.DeSerialize(file)
+	assert.NoError(t, err)
+	assert.True(t, reflect.DeepEqual(header, gotHeader))
+	assert.Equal(t, kvs, gotEntries)
+	extra := GetExtra(gotHeader.Extra)
+	assert.True(t, extra.EntryIncludeRootPath)
+	assert.Equal(t, BackupCompressionZstd, extra.Compression)
+	assert.True(t, extra.Checksum)
+
+	t.Run("truncated", func(t *testing.T) {
+		_, _, err := codec.DeSerialize(file[:len(file)-1])
+		var corrupted *CorruptedBackupError
+		assert.True(t, errors.As(err, &corrupted))
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		corruptedFile := append(BackupFile(nil), file...)
+		corruptedFile[len(corruptedFile)-10] ^= 0xff
+		_, _, err := codec.DeSerialize(corruptedFile)
+		var corrupted *CorruptedBackupError
+		assert.True(t, errors.As(err, &corrupted))
+	})
+
+	t.Run("checksum only", func(t *testing.T) {
+		file, err := codec.Serialize(newHeader(WithChecksum()), kvs)
+		require.NoError(t, err)
+		_, gotEntries, err := codec.DeSerialize(file)
+		assert.NoError(t, err)
+		assert.Equal(t, kvs, gotEntries)
+
+		_, _, err = codec.DeSerialize(file[:len(file)-1])
+		var corrupted *CorruptedBackupError
+		assert.True(t, errors.As(err, &corrupted))
+	})
+}
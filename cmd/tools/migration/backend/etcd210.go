@@ -435,7 +435,7 @@ func (b etcd210) Backup(meta *meta.Meta, backupFile string) error {
 	return ioutil.WriteFile(backupFile, backup, 0o600)
 }
 
-func (b etcd210) BackupV2(file string) error {
+func (b etcd210) BackupV2(file string, backupOpts ...BackupOption) error {
 	var instance, metaPath string
 	metaRootPath := b.cfg.EtcdCfg.MetaRootPath.GetValue()
 	parts := strings.Split(metaRootPath, "/")
@@ -477,7 +477,7 @@ func (b etcd210) BackupV2(file string) error {
 		MetaPath:  metaPath,
 		Entries:   int64(len(saves)),
 		Component: "",
-		Extra:     newBackupHeaderExtra(setEntryIncludeRootPath(true)).ToJSONBytes(),
+		Extra:     newBackupHeaderExtra(append([]extraOption{setEntryIncludeRootPath(true)}, backupOpts...)...).ToJSONBytes(),
 	}
 
 	codec := NewBackupCodec()
@@ -22,6 +22,10 @@ type RunConfig struct {
 	SourceVersion  string
 	TargetVersion  string
 	BackupFilePath string
+	// BackupCompress compresses the backup with zstd
+	BackupCompress bool
+	// BackupChecksum appends a checksum to the backup, verified before rollback
+	BackupChecksum bool
 }
 
 func newRunConfig(base *paramtable.BaseTable) *RunConfig {
@@ -36,11 +40,11 @@ func (c *RunConfig) String() string {
 	}
 	switch c.Cmd {
 	case RunCmd:
-		return fmt.Sprintf("Cmd: %s, SourceVersion: %s, TargetVersion: %s, BackupFilePath: %s, RunWithBackup: %v",
-			c.Cmd, c.SourceVersion, c.TargetVersion, c.BackupFilePath, c.RunWithBackup)
+		return fmt.Sprintf("Cmd: %s, SourceVersion: %s, TargetVersion: %s, BackupFilePath: %s, RunWithBackup: %v, BackupCompress: %v, BackupChecksum: %v",
+			c.Cmd, c.SourceVersion, c.TargetVersion, c.BackupFilePath, c.RunWithBackup, c.BackupCompress, c.BackupChecksum)
 	case BackupCmd:
-		return fmt.Sprintf("Cmd: %s, SourceVersion: %s, BackupFilePath: %s",
-			c.Cmd, c.SourceVersion, c.BackupFilePath)
+		return fmt.Sprintf("Cmd: %s, SourceVersion: %s, BackupFilePath: %s, BackupCompress: %v, BackupChecksum: %v",
+			c.Cmd, c.SourceVersion, c.BackupFilePath, c.BackupCompress, c.BackupChecksum)
 	case RollbackCmd:
 		return fmt.Sprintf("Cmd: %s, SourceVersion: %s, TargetVersion: %s, BackupFilePath: %s",
 			c.Cmd, c.SourceVersion, c.TargetVersion, c.BackupFilePath)
@@ -61,6 +65,8 @@ func (c *RunConfig) init(base *paramtable.BaseTable) {
 	c.SourceVersion = c.base.GetWithDefault("config.sourceVersion", "")
 	c.TargetVersion = c.base.GetWithDefault("config.targetVersion", "")
 	c.BackupFilePath = c.base.GetWithDefault("config.backupFilePath", "")
+	c.BackupCompress, _ = strconv.ParseBool(c.base.GetWithDefault("config.backupCompress", "false"))
+	c.BackupChecksum, _ = strconv.ParseBool(c.base.GetWithDefault("config.backupChecksum", "false"))
 }
 
 type MilvusConfig struct {
@@ -170,7 +170,14 @@ func (r *Runner) Backup() error {
 	if err != nil {
 		return err
 	}
-	if err := source.BackupV2(r.cfg.BackupFilePath); err != nil {
+	var opts []backend.BackupOption
+	if r.cfg.BackupCompress {
+		opts = append(opts, backend.WithCompression())
+	}
+	if r.cfg.BackupChecksum {
+		opts = append(opts, backend.WithChecksum())
+	}
+	if err := source.BackupV2(r.cfg.BackupFilePath, opts...); err != nil {
 		return err
 	}
 	r.backupFinished.Store(true)
@@ -0,0 +1,192 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/log"
+)
+
+// DeletionJournalPrefix is the prefix, relative to the kv root path, of the journal keys
+// recording unfinished background prefix deletions. Journal keys are never deleted by the
+// deletion jobs themselves, so a job removing the whole root can still be recovered.
+const DeletionJournalPrefix = "__deletion_journal__"
+
+var (
+	// DeletionChunkSize is the max number of keys removed by one chunk of a deletion job.
+	DeletionChunkSize = 1000
+	// DeletionChunkInterval is the pause between two chunks, to leave room for foreground requests.
+	DeletionChunkInterval = 10 * time.Millisecond
+)
+
+// DeletionExecutor performs the deletion of one prefix for a DeletionJob.
+type DeletionExecutor interface {
+	// Count returns the estimated number of keys to delete.
+	Count(ctx context.Context) (int64, error)
+	// DeleteChunk deletes up to DeletionChunkSize keys from cursor, an empty cursor means the beginning
+	// of the prefix. It returns the number of deleted keys, the cursor of the next chunk, and whether
+	// all keys are deleted.
+	DeleteChunk(ctx context.Context, cursor string) (deleted int, next string, finished bool, err error)
+	// Finish is called once the job is completed or canceled, it removes the journal of the job.
+	Finish(completed bool) error
+}
+
+// DeletionJob is the handle of a prefix deletion running in background.
+type DeletionJob struct {
+	prefix string
+
+	deleted        atomic.Int64
+	estimatedTotal atomic.Int64
+
+	mu  sync.Mutex
+	err error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newDeletionJob(prefix string) *DeletionJob {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DeletionJob{
+		prefix: prefix,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Prefix returns the prefix being deleted.
+func (j *DeletionJob) Prefix() string {
+	return j.prefix
+}
+
+// Progress returns the number of deleted keys and the estimated total,
+// the total is 0 until the keys are counted.
+func (j *DeletionJob) Progress() (int64, int64) {
+	return j.deleted.Load(), j.estimatedTotal.Load()
+}
+
+// Err returns the error the job failed with, context.Canceled if it's canceled.
+// It's nil while the job is running or after it completes successfully.
+func (j *DeletionJob) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// Done returns a channel closed once the job stops.
+func (j *DeletionJob) Done() <-chan struct{} {
+	return j.done
+}
+
+// Cancel stops the job. Keys already deleted are not restored.
+func (j *DeletionJob) Cancel() {
+	j.cancel()
+}
+
+func (j *DeletionJob) run(executor DeletionExecutor) {
+	var err error
+	defer func() {
+		j.mu.Lock()
+		j.err = err
+		j.mu.Unlock()
+		j.cancel()
+		close(j.done)
+	}()
+
+	total, err := executor.Count(j.ctx)
+	if err != nil {
+		log.Warn("failed to count keys for deletion job", zap.String("prefix", j.prefix), zap.Error(err))
+		err = nil
+	}
+	j.estimatedTotal.Store(total)
+
+	cursor := ""
+	for {
+		if err = j.ctx.Err(); err != nil {
+			break
+		}
+		var (
+			deleted  int
+			finished bool
+		)
+		deleted, cursor, finished, err = executor.DeleteChunk(j.ctx, cursor)
+		if err != nil {
+			if j.ctx.Err() != nil {
+				err = j.ctx.Err()
+				break
+			}
+			// journal is kept, so the job could be resumed
+			log.Warn("deletion job failed", zap.String("prefix", j.prefix), zap.Error(err))
+			return
+		}
+		j.deleted.Add(int64(deleted))
+		if finished {
+			break
+		}
+
+		select {
+		case <-j.ctx.Done():
+		case <-time.After(DeletionChunkInterval):
+		}
+	}
+
+	if finishErr := executor.Finish(err == nil); finishErr != nil {
+		log.Warn("failed to finish deletion job", zap.String("prefix", j.prefix), zap.Error(finishErr))
+		if err == nil {
+			err = finishErr
+		}
+		return
+	}
+	log.Info("deletion job stopped", zap.String("prefix", j.prefix), zap.Int64("deleted", j.deleted.Load()), zap.Error(err))
+}
+
+// DeletionJobs tracks the deletion jobs started through one kv instance.
+// The zero value is ready to use.
+type DeletionJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*DeletionJob
+}
+
+// Start runs a deletion job of prefix in background with executor,
+// the running job is returned if there is already one for prefix.
+func (d *DeletionJobs) Start(prefix string, executor DeletionExecutor) *DeletionJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.jobs == nil {
+		d.jobs = make(map[string]*DeletionJob)
+	}
+	if job, ok := d.jobs[prefix]; ok {
+		select {
+		case <-job.Done():
+		default:
+			return job
+		}
+	}
+
+	job := newDeletionJob(prefix)
+	d.jobs[prefix] = job
+	go job.run(executor)
+	return job
+}
@@ -0,0 +1,120 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+)
+
+type fakeDeletionExecutor struct {
+	total    int
+	deleted  int
+	failAt   int
+	block    chan struct{}
+	finished atomic.Int32
+	complete atomic.Bool
+}
+
+func (e *fakeDeletionExecutor) Count(ctx context.Context) (int64, error) {
+	return int64(e.total), nil
+}
+
+func (e *fakeDeletionExecutor) DeleteChunk(ctx context.Context, cursor string) (int, string, bool, error) {
+	if e.block != nil {
+		select {
+		case <-ctx.Done():
+			return 0, cursor, false, ctx.Err()
+		case <-e.block:
+		}
+	}
+	if e.failAt > 0 && e.deleted >= e.failAt {
+		return 0, cursor, false, errors.New("mock failure")
+	}
+	n := DeletionChunkSize
+	if e.total-e.deleted < n {
+		n = e.total - e.deleted
+	}
+	e.deleted += n
+	return n, fmt.Sprint(e.deleted), e.deleted == e.total, nil
+}
+
+func (e *fakeDeletionExecutor) Finish(completed bool) error {
+	e.finished.Inc()
+	e.complete.Store(completed)
+	return nil
+}
+
+func TestDeletionJob(t *testing.T) {
+	chunkSize, interval := DeletionChunkSize, DeletionChunkInterval
+	DeletionChunkSize, DeletionChunkInterval = 3, time.Millisecond
+	defer func() {
+		DeletionChunkSize, DeletionChunkInterval = chunkSize, interval
+	}()
+
+	t.Run("complete", func(t *testing.T) {
+		jobs := &DeletionJobs{}
+		executor := &fakeDeletionExecutor{total: 10}
+		job := jobs.Start("prefix", executor)
+		<-job.Done()
+		assert.NoError(t, job.Err())
+		deleted, total := job.Progress()
+		assert.EqualValues(t, 10, deleted)
+		assert.EqualValues(t, 10, total)
+		assert.EqualValues(t, 1, executor.finished.Load())
+		assert.True(t, executor.complete.Load())
+		assert.Equal(t, "prefix", job.Prefix())
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		jobs := &DeletionJobs{}
+		executor := &fakeDeletionExecutor{total: 10, block: make(chan struct{})}
+		job := jobs.Start("prefix", executor)
+		// running job is reused
+		assert.Same(t, job, jobs.Start("prefix", executor))
+
+		job.Cancel()
+		<-job.Done()
+		assert.ErrorIs(t, job.Err(), context.Canceled)
+		assert.EqualValues(t, 1, executor.finished.Load())
+		assert.False(t, executor.complete.Load())
+
+		// stopped job is replaced
+		executor = &fakeDeletionExecutor{total: 1}
+		another := jobs.Start("prefix", executor)
+		assert.NotSame(t, job, another)
+		<-another.Done()
+		assert.NoError(t, another.Err())
+	})
+
+	t.Run("failure keeps journal", func(t *testing.T) {
+		jobs := &DeletionJobs{}
+		executor := &fakeDeletionExecutor{total: 10, failAt: 6}
+		job := jobs.Start("prefix", executor)
+		<-job.Done()
+		assert.Error(t, job.Err())
+		deleted, _ := job.Progress()
+		assert.EqualValues(t, 6, deleted)
+		assert.EqualValues(t, 0, executor.finished.Load())
+	})
+}
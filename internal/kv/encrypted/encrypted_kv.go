@@ -0,0 +1,272 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryptedkv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/milvus-io/milvus/internal/kv"
+	"github.com/milvus-io/milvus/internal/kv/predicates"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+)
+
+// encryptedMagic starts each encrypted value, followed by the length of the key id (1 byte),
+// the key id, the nonce and the AES-GCM sealed value. The header and the full key are the
+// additional data of the seal, so a value copied to another key fails to decrypt.
+const encryptedMagic = "\x00mvenc1"
+
+// ErrUnknownKeyID is returned when reading a value encrypted with a key not supplied.
+type ErrUnknownKeyID struct {
+	KeyID string
+}
+
+func (e *ErrUnknownKeyID) Error() string {
+	return fmt.Sprintf("value is encrypted with unknown key id %q", e.KeyID)
+}
+
+// EncryptedKV encrypts the values under the configured prefixes with AES-GCM transparently,
+// the values of other keys are passed through untouched.
+//
+// Values are encrypted with the current key, and decrypted with the key whose id is in the
+// header of the value, so keys could be rotated by adding a new current key and keeping the
+// old ones until all values are rewritten. Values without the header, e.g. written before the
+// prefix is encrypted, are read as is.
+//
+// As encrypted values differ for each write, value predicates on the encrypted keys are rejected.
+type EncryptedKV struct {
+	kv.MetaKv
+	// prefixes are the full paths of the encrypted prefixes
+	prefixes     []string
+	currentKeyID string
+	ciphers      map[string]cipher.AEAD
+}
+
+// implementation assertion
+var _ kv.MetaKv = (*EncryptedKV)(nil)
+
+// NewEncryptedKV wraps metaKv to encrypt the values under prefixes. keys are the AES keys by id,
+// of 16, 24 or 32 bytes, the one of currentKeyID is used to encrypt.
+func NewEncryptedKV(metaKv kv.MetaKv, prefixes []string, currentKeyID string, keys map[string][]byte) (*EncryptedKV, error) {
+	if _, ok := keys[currentKeyID]; !ok {
+		return nil, merr.WrapErrParameterInvalidMsg("current key id %s not in keys", currentKeyID)
+	}
+	ciphers := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		if len(id) == 0 || len(id) > 255 {
+			return nil, merr.WrapErrParameterInvalidMsg("invalid key id %q, length must be in [1, 255]", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %s", id)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %s", id)
+		}
+		ciphers[id] = aead
+	}
+	fullPrefixes := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		fullPrefixes = append(fullPrefixes, metaKv.GetPath(prefix))
+	}
+	return &EncryptedKV{
+		MetaKv:       metaKv,
+		prefixes:     fullPrefixes,
+		currentKeyID: currentKeyID,
+		ciphers:      ciphers,
+	}, nil
+}
+
+// encrypted returns whether the value of the full key is encrypted, i.e. the key is a prefix
+// or under it, "credential" covers "credential/root" but not "credentials/root".
+func (kv *EncryptedKV) encrypted(fullKey string) bool {
+	for _, prefix := range kv.prefixes {
+		if fullKey == prefix || strings.HasPrefix(fullKey, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// additionalData returns the additional data sealing the value of the full key with header.
+func additionalData(header, fullKey string) []byte {
+	return []byte(header + fullKey)
+}
+
+func (kv *EncryptedKV) encrypt(fullKey, value string) (string, error) {
+	aead := kv.ciphers[kv.currentKeyID]
+	header := encryptedMagic + string([]byte{byte(len(kv.currentKeyID))}) + kv.currentKeyID
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "failed to generate nonce")
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), additionalData(header, fullKey))
+	return header + string(sealed), nil
+}
+
+func (kv *EncryptedKV) decrypt(fullKey, value string) (string, error) {
+	if !kv.encrypted(fullKey) || !strings.HasPrefix(value, encryptedMagic) {
+		return value, nil
+	}
+	rest := value[len(encryptedMagic):]
+	if len(rest) == 0 || len(rest) < 1+int(rest[0]) {
+		return "", errors.Newf("corrupted encrypted value of key %s", fullKey)
+	}
+	keyID := rest[1 : 1+int(rest[0])]
+	aead, ok := kv.ciphers[keyID]
+	if !ok {
+		return "", &ErrUnknownKeyID{KeyID: keyID}
+	}
+	header := value[:len(encryptedMagic)+1+len(keyID)]
+	sealed := rest[1+len(keyID):]
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.Newf("corrupted encrypted value of key %s", fullKey)
+	}
+	plain, err := aead.Open(nil, []byte(sealed[:aead.NonceSize()]), []byte(sealed[aead.NonceSize():]), additionalData(header, fullKey))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to decrypt value of key %s", fullKey)
+	}
+	return string(plain), nil
+}
+
+func (kv *EncryptedKV) encryptSaves(saves map[string]string) (map[string]string, error) {
+	result := make(map[string]string, len(saves))
+	for key, value := range saves {
+		fullKey := kv.GetPath(key)
+		if !kv.encrypted(fullKey) {
+			result[key] = value
+			continue
+		}
+		encrypted, err := kv.encrypt(fullKey, value)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = encrypted
+	}
+	return result, nil
+}
+
+func (kv *EncryptedKV) checkPredicates(preds []predicates.Predicate) error {
+	for _, pred := range preds {
+		if pred.Target() == predicates.PredTargetValue && kv.encrypted(kv.GetPath(pred.Key())) {
+			return merr.WrapErrParameterInvalidMsg("value predicate on encrypted key %s is not supported", pred.Key())
+		}
+	}
+	return nil
+}
+
+func (kv *EncryptedKV) Load(key string) (string, error) {
+	value, err := kv.MetaKv.Load(key)
+	if err != nil {
+		return "", err
+	}
+	return kv.decrypt(kv.GetPath(key), value)
+}
+
+func (kv *EncryptedKV) MultiLoad(keys []string) ([]string, error) {
+	fullKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fullKeys = append(fullKeys, kv.GetPath(key))
+	}
+	values, err := kv.MetaKv.MultiLoad(keys)
+	if err != nil {
+		return values, err
+	}
+	for i, fullKey := range fullKeys {
+		if values[i], err = kv.decrypt(fullKey, values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// LoadWithPrefix decrypts the values of the encrypted keys with the prefix,
+// the prefix could cover both encrypted and plain keys.
+func (kv *EncryptedKV) LoadWithPrefix(prefix string) ([]string, []string, error) {
+	keys, values, err := kv.MetaKv.LoadWithPrefix(prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, key := range keys {
+		if values[i], err = kv.decrypt(key, values[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return keys, values, nil
+}
+
+func (kv *EncryptedKV) WalkWithPrefix(prefix string, paginationSize int, fn func([]byte, []byte) error) error {
+	return kv.MetaKv.WalkWithPrefix(prefix, paginationSize, func(key []byte, value []byte) error {
+		plain, err := kv.decrypt(string(key), string(value))
+		if err != nil {
+			return err
+		}
+		return fn(key, []byte(plain))
+	})
+}
+
+func (kv *EncryptedKV) Save(key, value string) error {
+	saves, err := kv.encryptSaves(map[string]string{key: value})
+	if err != nil {
+		return err
+	}
+	return kv.MetaKv.Save(key, saves[key])
+}
+
+func (kv *EncryptedKV) MultiSave(kvs map[string]string) error {
+	saves, err := kv.encryptSaves(kvs)
+	if err != nil {
+		return err
+	}
+	return kv.MetaKv.MultiSave(saves)
+}
+
+func (kv *EncryptedKV) MultiSaveAndRemove(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
+	if err := kv.checkPredicates(preds); err != nil {
+		return err
+	}
+	encrypted, err := kv.encryptSaves(saves)
+	if err != nil {
+		return err
+	}
+	return kv.MetaKv.MultiSaveAndRemove(encrypted, removals, preds...)
+}
+
+func (kv *EncryptedKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
+	if err := kv.checkPredicates(preds); err != nil {
+		return err
+	}
+	encrypted, err := kv.encryptSaves(saves)
+	if err != nil {
+		return err
+	}
+	return kv.MetaKv.MultiSaveAndRemoveWithPrefix(encrypted, removals, preds...)
+}
+
+func (kv *EncryptedKV) CompareVersionAndSwap(key string, version int64, target string) (bool, error) {
+	saves, err := kv.encryptSaves(map[string]string{key: target})
+	if err != nil {
+		return false, err
+	}
+	return kv.MetaKv.CompareVersionAndSwap(key, version, saves[key])
+}
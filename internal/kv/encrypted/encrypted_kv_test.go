@@ -0,0 +1,201 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryptedkv
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/internal/kv"
+	"github.com/milvus-io/milvus/internal/kv/predicates"
+	tikvkv "github.com/milvus-io/milvus/internal/kv/tikv"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+	"github.com/milvus-io/milvus/pkg/util/paramtable"
+	"github.com/milvus-io/milvus/pkg/util/tikv"
+)
+
+func TestMain(m *testing.M) {
+	paramtable.Init()
+	os.Exit(m.Run())
+}
+
+var (
+	key1 = bytes.Repeat([]byte{1}, 32)
+	key2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func newTestKV(t *testing.T, rootPath string) kv.MetaKv {
+	metaKv := tikvkv.NewTiKV(tikv.SetupLocalTxn(), rootPath)
+	t.Cleanup(metaKv.Close)
+	return metaKv
+}
+
+func TestEncryptedKV(t *testing.T) {
+	metaKv := newTestKV(t, "/encrypted/test")
+	encryptedKv, err := NewEncryptedKV(metaKv, []string{"credential", "tls"}, "k1", map[string][]byte{"k1": key1})
+	require.NoError(t, err)
+
+	t.Run("round trip", func(t *testing.T) {
+		err := encryptedKv.Save("credential/user/root", "hash")
+		assert.NoError(t, err)
+		err = encryptedKv.MultiSave(map[string]string{"tls/cert": "pem", "collection/1": "meta"})
+		assert.NoError(t, err)
+		err = encryptedKv.MultiSaveAndRemove(map[string]string{"credential/user/alice": "hash2"}, nil)
+		assert.NoError(t, err)
+
+		value, err := encryptedKv.Load("credential/user/root")
+		assert.NoError(t, err)
+		assert.Equal(t, "hash", value)
+		values, err := encryptedKv.MultiLoad([]string{"tls/cert", "collection/1", "credential/user/alice"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"pem", "meta", "hash2"}, values)
+
+		// stored encrypted
+		raw, err := metaKv.Load("credential/user/root")
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(raw, encryptedMagic))
+		assert.NotContains(t, raw, "hash")
+		raw, err = metaKv.Load("collection/1")
+		assert.NoError(t, err)
+		assert.Equal(t, "meta", raw)
+
+		// the same value is encrypted differently each time
+		err = encryptedKv.Save("credential/user/bob", "hash")
+		assert.NoError(t, err)
+		raw2, err := metaKv.Load("credential/user/bob")
+		assert.NoError(t, err)
+		raw, _ = metaKv.Load("credential/user/root")
+		assert.NotEqual(t, raw, raw2)
+	})
+
+	t.Run("mixed prefixes", func(t *testing.T) {
+		keys, values, err := encryptedKv.LoadWithPrefix("")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			metaKv.GetPath("collection/1"),
+			metaKv.GetPath("credential/user/alice"),
+			metaKv.GetPath("credential/user/bob"),
+			metaKv.GetPath("credential/user/root"),
+			metaKv.GetPath("tls/cert"),
+		}, keys)
+		assert.Equal(t, []string{"meta", "hash2", "hash", "hash", "pem"}, values)
+
+		walked := make(map[string]string)
+		err = encryptedKv.WalkWithPrefix("credential", 1, func(key []byte, value []byte) error {
+			walked[string(key)] = string(value)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			metaKv.GetPath("credential/user/alice"): "hash2",
+			metaKv.GetPath("credential/user/bob"):   "hash",
+			metaKv.GetPath("credential/user/root"):  "hash",
+		}, walked)
+
+		// plain values written before the prefix is encrypted are still readable
+		err = metaKv.Save("tls/key", "plain")
+		assert.NoError(t, err)
+		value, err := encryptedKv.Load("tls/key")
+		assert.NoError(t, err)
+		assert.Equal(t, "plain", value)
+	})
+
+	t.Run("predicates", func(t *testing.T) {
+		err := encryptedKv.MultiSaveAndRemove(map[string]string{"credential/user/root": "new"}, nil,
+			predicates.ValueEqual("credential/user/root", "hash"))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		err = encryptedKv.MultiSaveAndRemoveWithPrefix(map[string]string{"collection/1": "new"}, nil,
+			predicates.ValueEqual("collection/1", "meta"))
+		assert.NoError(t, err)
+	})
+}
+
+func TestEncryptedKVRotation(t *testing.T) {
+	metaKv := newTestKV(t, "/encrypted/rotation")
+	oldKv, err := NewEncryptedKV(metaKv, []string{"credential"}, "k1", map[string][]byte{"k1": key1})
+	require.NoError(t, err)
+	err = oldKv.Save("credential/old", "old value")
+	require.NoError(t, err)
+
+	newKv, err := NewEncryptedKV(metaKv, []string{"credential"}, "k2", map[string][]byte{"k1": key1, "k2": key2})
+	require.NoError(t, err)
+	value, err := newKv.Load("credential/old")
+	assert.NoError(t, err)
+	assert.Equal(t, "old value", value)
+
+	err = newKv.Save("credential/new", "new value")
+	assert.NoError(t, err)
+	raw, err := metaKv.Load("credential/new")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, encryptedMagic+"\x02k2"))
+
+	// the old key is dropped after all values are rewritten
+	_, err = oldKv.Load("credential/new")
+	unknown := &ErrUnknownKeyID{}
+	assert.ErrorAs(t, err, &unknown)
+	assert.Equal(t, "k2", unknown.KeyID)
+	_, _, err = oldKv.LoadWithPrefix("credential")
+	assert.ErrorAs(t, err, &unknown)
+
+	// tampered values are rejected
+	err = metaKv.Save("credential/new", raw[:len(raw)-1]+"x")
+	assert.NoError(t, err)
+	_, err = newKv.Load("credential/new")
+	assert.Error(t, err)
+
+	// a value copied to another key is rejected
+	err = newKv.Save("credential/a", "value a")
+	require.NoError(t, err)
+	raw, err = metaKv.Load("credential/a")
+	require.NoError(t, err)
+	err = metaKv.Save("credential/b", raw)
+	require.NoError(t, err)
+	_, err = newKv.Load("credential/b")
+	assert.Error(t, err)
+}
+
+func TestEncryptedKVPrefixBoundary(t *testing.T) {
+	metaKv := newTestKV(t, "/encrypted/boundary")
+	encryptedKv, err := NewEncryptedKV(metaKv, []string{"secret"}, "k1", map[string][]byte{"k1": key1})
+	require.NoError(t, err)
+
+	err = encryptedKv.MultiSave(map[string]string{"secret": "v0", "secret/1": "v1", "secrets2/1": "v2"})
+	require.NoError(t, err)
+	for key, encrypted := range map[string]bool{"secret": true, "secret/1": true, "secrets2/1": false} {
+		raw, err := metaKv.Load(key)
+		assert.NoError(t, err)
+		assert.Equal(t, encrypted, strings.HasPrefix(raw, encryptedMagic), key)
+	}
+	values, err := encryptedKv.MultiLoad([]string{"secret", "secret/1", "secrets2/1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v0", "v1", "v2"}, values)
+}
+
+func TestNewEncryptedKV(t *testing.T) {
+	metaKv := newTestKV(t, "/encrypted/new")
+	_, err := NewEncryptedKV(metaKv, nil, "k1", map[string][]byte{"k2": key2})
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	_, err = NewEncryptedKV(metaKv, nil, "k1", map[string][]byte{"k1": []byte("short")})
+	assert.Error(t, err)
+	_, err = NewEncryptedKV(metaKv, nil, "", map[string][]byte{"": key1})
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
@@ -0,0 +1,119 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/milvus-io/milvus/pkg/common"
+)
+
+// ErrKeyNotFound is matched by errors.Is for the reads of missing keys of all the backends: by the
+// common.KeyNotExistError of Load, it's common.ErrKeyNotExist, and by the MissingKeysError of
+// MultiLoad, so the callers tell a missing key from a failure of the backend without matching the
+// messages.
+var ErrKeyNotFound = common.ErrKeyNotExist
+
+// MissingKeysError is the error of MultiLoad when it fails only for missing keys, it matches
+// ErrKeyNotFound. The other errors of MultiLoad, e.g. of the connection, don't.
+type MissingKeysError struct {
+	// Keys are the missing keys, as they're named by the backend
+	Keys []string
+}
+
+func (e *MissingKeysError) Error() string {
+	return fmt.Sprintf("there are invalid keys: %s", e.Keys)
+}
+
+// Is makes errors.Is match ErrKeyNotFound.
+func (e *MissingKeysError) Is(target error) bool {
+	return target == ErrKeyNotFound
+}
+
+// NewMissingKeysError returns the MissingKeysError of keys.
+func NewMissingKeysError(keys []string) error {
+	return &MissingKeysError{Keys: keys}
+}
+
+// OpError is the error returned by the operations of the kv backends,
+// it attaches the context of the failed operation to the cause.
+// The cause stays in the chain, so errors.Is and errors.As see the client errors
+// and the typed errors of the backends.
+type OpError struct {
+	// Op is the name of the operation, e.g. "Load"
+	Op string
+	// Key is the key or the prefix of the operation relative to RootPath, empty for multi-key operations.
+	// The last element of a sensitive key is redacted.
+	Key string
+	// KeyCount is the number of keys or prefixes of the operation
+	KeyCount int
+	RootPath string
+	Elapsed  time.Duration
+	Err      error
+}
+
+func (e *OpError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "kv %s failed", e.Op)
+	if e.Key != "" {
+		fmt.Fprintf(&sb, ", key: %s", e.Key)
+	}
+	fmt.Fprintf(&sb, ", key count: %d, root path: %s, elapsed: %s: %s", e.KeyCount, e.RootPath, e.Elapsed, e.Err.Error())
+	return sb.String()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// redactKey returns key, with its last element redacted if the values of key are sensitive.
+func redactKey(rootPath string, key string) string {
+	if key == "" || !redactionRules.Sensitive(path.Join(rootPath, key)) {
+		return key
+	}
+	return path.Join(path.Dir(key), "<redacted>")
+}
+
+// WrapError wraps the error of a kv operation into an OpError, it's deferred by the operations
+// with the named error result:
+//
+//	defer kv.WrapError(&err, "Load", rootPath, key, 1, time.Now())
+//
+// A nil error is kept nil, and an error already carrying an OpError, e.g. returned by
+// a nested operation, is not wrapped again.
+func WrapError(err *error, op string, rootPath string, key string, keyCount int, start time.Time) {
+	if *err == nil {
+		return
+	}
+	var opErr *OpError
+	if errors.As(*err, &opErr) {
+		return
+	}
+	*err = &OpError{
+		Op:       op,
+		Key:      redactKey(rootPath, key),
+		KeyCount: keyCount,
+		RootPath: rootPath,
+		Elapsed:  time.Since(start),
+		Err:      *err,
+	}
+}
@@ -0,0 +1,95 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/milvus-io/milvus/pkg/common"
+)
+
+func TestWrapError(t *testing.T) {
+	var err error
+	WrapError(&err, "Load", "by-dev/meta", "a", 1, time.Now())
+	assert.NoError(t, err)
+
+	err = common.NewKeyNotExistError("by-dev/meta/a")
+	WrapError(&err, "Load", "by-dev/meta", "a", 1, time.Now().Add(-time.Second))
+	var opErr *OpError
+	assert.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "Load", opErr.Op)
+	assert.Equal(t, "a", opErr.Key)
+	assert.Equal(t, 1, opErr.KeyCount)
+	assert.Equal(t, "by-dev/meta", opErr.RootPath)
+	assert.GreaterOrEqual(t, opErr.Elapsed, time.Second)
+	assert.True(t, common.IsKeyNotExistError(err))
+	assert.ErrorContains(t, err, "kv Load failed, key: a, key count: 1, root path: by-dev/meta")
+	assert.ErrorContains(t, err, "there is no value on key = by-dev/meta/a")
+
+	// the outermost operation does not wrap the error of a nested one again
+	WrapError(&err, "MultiLoad", "by-dev/meta", "", 2, time.Now())
+	assert.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "Load", opErr.Op)
+
+	err = errors.Wrap(context.DeadlineExceeded, "Failed to commit for MultiSave")
+	WrapError(&err, "MultiSave", "by-dev/meta", "", 3, time.Now())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotContains(t, err.Error(), "key:")
+}
+
+func TestWrapErrorRedactKey(t *testing.T) {
+	defer ResetRedactionRules()
+	err := SetRedactionRules([]string{"root-coord/credential/"}, nil)
+	assert.NoError(t, err)
+
+	err = errors.New("mock error")
+	WrapError(&err, "Save", "by-dev/meta", "root-coord/credential/users/root", 1, time.Now())
+	var opErr *OpError
+	assert.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "root-coord/credential/users/<redacted>", opErr.Key)
+	assert.NotContains(t, err.Error(), "users/root")
+
+	err = errors.New("mock error")
+	WrapError(&err, "Save", "by-dev/meta", "root-coord/collection/1", 1, time.Now())
+	assert.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "root-coord/collection/1", opErr.Key)
+}
+
+func TestErrKeyNotFound(t *testing.T) {
+	err := common.NewKeyNotExistError("by-dev/meta/a")
+	WrapError(&err, "Load", "by-dev/meta", "a", 1, time.Now())
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.ErrorContains(t, err, "by-dev/meta/a")
+
+	err = NewMissingKeysError([]string{"by-dev/meta/a", "by-dev/meta/b"})
+	WrapError(&err, "MultiLoad", "by-dev/meta", "", 3, time.Now())
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	var missing *MissingKeysError
+	assert.True(t, errors.As(err, &missing))
+	assert.Equal(t, []string{"by-dev/meta/a", "by-dev/meta/b"}, missing.Keys)
+	assert.ErrorContains(t, err, "there are invalid keys: [by-dev/meta/a by-dev/meta/b]")
+
+	// a failure of the backend is not a missing key
+	err = errors.Wrap(context.DeadlineExceeded, "Failed to get value for key by-dev/meta/a")
+	WrapError(&err, "Load", "by-dev/meta", "a", 1, time.Now())
+	assert.NotErrorIs(t, err, ErrKeyNotFound)
+}
@@ -18,7 +18,6 @@ package etcdkv
 
 import (
 	"context"
-	"fmt"
 	"path"
 	"sync"
 	"time"
@@ -86,7 +85,8 @@ func (kv *EmbedEtcdKV) GetPath(key string) string {
 	return path.Join(kv.rootPath, key)
 }
 
-func (kv *EmbedEtcdKV) WalkWithPrefix(prefix string, paginationSize int, fn func([]byte, []byte) error) error {
+func (kv *EmbedEtcdKV) WalkWithPrefix(prefix string, paginationSize int, fn func([]byte, []byte) error) (err error) {
+	defer wrapError(&err, "WalkWithPrefix", kv.rootPath, prefix, 1, time.Now())
 	prefix = path.Join(kv.rootPath, prefix)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
@@ -121,7 +121,8 @@ func (kv *EmbedEtcdKV) WalkWithPrefix(prefix string, paginationSize int, fn func
 }
 
 // LoadWithPrefix returns all the keys and values with the given key prefix
-func (kv *EmbedEtcdKV) LoadWithPrefix(key string) ([]string, []string, error) {
+func (kv *EmbedEtcdKV) LoadWithPrefix(key string) (_ []string, _ []string, err error) {
+	defer wrapError(&err, "LoadWithPrefix", kv.rootPath, key, 1, time.Now())
 	key = path.Join(kv.rootPath, key)
 	log.Debug("LoadWithPrefix ", zap.String("prefix", key))
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
@@ -140,7 +141,8 @@ func (kv *EmbedEtcdKV) LoadWithPrefix(key string) ([]string, []string, error) {
 	return keys, values, nil
 }
 
-func (kv *EmbedEtcdKV) Has(key string) (bool, error) {
+func (kv *EmbedEtcdKV) Has(key string) (_ bool, err error) {
+	defer wrapError(&err, "Has", kv.rootPath, key, 1, time.Now())
 	key = path.Join(kv.rootPath, key)
 	log.Debug("Has", zap.String("key", key))
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
@@ -152,7 +154,8 @@ func (kv *EmbedEtcdKV) Has(key string) (bool, error) {
 	return resp.Count != 0, nil
 }
 
-func (kv *EmbedEtcdKV) HasPrefix(prefix string) (bool, error) {
+func (kv *EmbedEtcdKV) HasPrefix(prefix string) (_ bool, err error) {
+	defer wrapError(&err, "HasPrefix", kv.rootPath, prefix, 1, time.Now())
 	prefix = path.Join(kv.rootPath, prefix)
 	log.Debug("HasPrefix", zap.String("prefix", prefix))
 
@@ -168,7 +171,8 @@ func (kv *EmbedEtcdKV) HasPrefix(prefix string) (bool, error) {
 }
 
 // LoadBytesWithPrefix returns all the keys and values with the given key prefix
-func (kv *EmbedEtcdKV) LoadBytesWithPrefix(key string) ([]string, [][]byte, error) {
+func (kv *EmbedEtcdKV) LoadBytesWithPrefix(key string) (_ []string, _ [][]byte, err error) {
+	defer wrapError(&err, "LoadBytesWithPrefix", kv.rootPath, key, 1, time.Now())
 	key = path.Join(kv.rootPath, key)
 	log.Debug("LoadBytesWithPrefix ", zap.String("prefix", key))
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
@@ -188,7 +192,8 @@ func (kv *EmbedEtcdKV) LoadBytesWithPrefix(key string) ([]string, [][]byte, erro
 }
 
 // LoadBytesWithPrefix2 returns all the keys and values with versions by the given key prefix
-func (kv *EmbedEtcdKV) LoadBytesWithPrefix2(key string) ([]string, [][]byte, []int64, error) {
+func (kv *EmbedEtcdKV) LoadBytesWithPrefix2(key string) (_ []string, _ [][]byte, _ []int64, err error) {
+	defer wrapError(&err, "LoadBytesWithPrefix2", kv.rootPath, key, 1, time.Now())
 	key = path.Join(kv.rootPath, key)
 	log.Debug("LoadBytesWithPrefix2 ", zap.String("prefix", key))
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
@@ -210,7 +215,8 @@ func (kv *EmbedEtcdKV) LoadBytesWithPrefix2(key string) ([]string, [][]byte, []i
 }
 
 // Load returns value of the given key
-func (kv *EmbedEtcdKV) Load(key string) (string, error) {
+func (kv *EmbedEtcdKV) Load(key string) (_ string, err error) {
+	defer wrapError(&err, "Load", kv.rootPath, key, 1, time.Now())
 	key = path.Join(kv.rootPath, key)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
@@ -226,7 +232,8 @@ func (kv *EmbedEtcdKV) Load(key string) (string, error) {
 }
 
 // LoadBytes returns value of the given key
-func (kv *EmbedEtcdKV) LoadBytes(key string) ([]byte, error) {
+func (kv *EmbedEtcdKV) LoadBytes(key string) (_ []byte, err error) {
+	defer wrapError(&err, "LoadBytes", kv.rootPath, key, 1, time.Now())
 	key = path.Join(kv.rootPath, key)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
@@ -242,7 +249,8 @@ func (kv *EmbedEtcdKV) LoadBytes(key string) ([]byte, error) {
 }
 
 // MultiLoad returns values of a set of keys
-func (kv *EmbedEtcdKV) MultiLoad(keys []string) ([]string, error) {
+func (kv *EmbedEtcdKV) MultiLoad(keys []string) (_ []string, err error) {
+	defer wrapError(&err, "MultiLoad", kv.rootPath, "", len(keys), time.Now())
 	ops := make([]clientv3.Op, 0, len(keys))
 	for _, keyLoad := range keys {
 		ops = append(ops, clientv3.OpGet(path.Join(kv.rootPath, keyLoad)))
@@ -256,29 +264,26 @@ func (kv *EmbedEtcdKV) MultiLoad(keys []string) ([]string, error) {
 	}
 
 	result := make([]string, 0, len(keys))
-	invalid := make([]string, 0, len(keys))
-	for index, rp := range resp.Responses {
-		if rp.GetResponseRange().Kvs == nil || len(rp.GetResponseRange().Kvs) == 0 {
-			invalid = append(invalid, keys[index])
+	for _, rp := range resp.Responses {
+		if len(rp.GetResponseRange().Kvs) == 0 {
 			result = append(result, "")
 		}
 		for _, ev := range rp.GetResponseRange().Kvs {
 			log.Debug("MultiLoad", zap.ByteString("key", ev.Key),
-				zap.ByteString("value", ev.Value))
+				valueField(string(ev.Key), string(ev.Value)))
 			result = append(result, string(ev.Value))
 		}
 	}
-	if len(invalid) != 0 {
-		log.Debug("MultiLoad: there are invalid keys",
-			zap.Strings("keys", invalid))
-		err = fmt.Errorf("there are invalid keys: %s", invalid)
+	if err = missingKeysErrorOf(keys, resp.Responses); err != nil {
+		log.Debug("MultiLoad: there are invalid keys", zap.Error(err))
 		return result, err
 	}
 	return result, nil
 }
 
 // MultiLoadBytes returns values of a set of keys
-func (kv *EmbedEtcdKV) MultiLoadBytes(keys []string) ([][]byte, error) {
+func (kv *EmbedEtcdKV) MultiLoadBytes(keys []string) (_ [][]byte, err error) {
+	defer wrapError(&err, "MultiLoadBytes", kv.rootPath, "", len(keys), time.Now())
 	ops := make([]clientv3.Op, 0, len(keys))
 	for _, keyLoad := range keys {
 		ops = append(ops, clientv3.OpGet(path.Join(kv.rootPath, keyLoad)))
@@ -292,29 +297,26 @@ func (kv *EmbedEtcdKV) MultiLoadBytes(keys []string) ([][]byte, error) {
 	}
 
 	result := make([][]byte, 0, len(keys))
-	invalid := make([]string, 0, len(keys))
-	for index, rp := range resp.Responses {
-		if rp.GetResponseRange().Kvs == nil || len(rp.GetResponseRange().Kvs) == 0 {
-			invalid = append(invalid, keys[index])
+	for _, rp := range resp.Responses {
+		if len(rp.GetResponseRange().Kvs) == 0 {
 			result = append(result, []byte{})
 		}
 		for _, ev := range rp.GetResponseRange().Kvs {
 			log.Debug("MultiLoadBytes", zap.ByteString("key", ev.Key),
-				zap.ByteString("value", ev.Value))
+				valueField(string(ev.Key), string(ev.Value)))
 			result = append(result, ev.Value)
 		}
 	}
-	if len(invalid) != 0 {
-		log.Debug("MultiLoadBytes: there are invalid keys",
-			zap.Strings("keys", invalid))
-		err = fmt.Errorf("there are invalid keys: %s", invalid)
+	if err = missingKeysErrorOf(keys, resp.Responses); err != nil {
+		log.Debug("MultiLoadBytes: there are invalid keys", zap.Error(err))
 		return result, err
 	}
 	return result, nil
 }
 
 // LoadBytesWithRevision returns keys, values and revision with given key prefix.
-func (kv *EmbedEtcdKV) LoadBytesWithRevision(key string) ([]string, [][]byte, int64, error) {
+func (kv *EmbedEtcdKV) LoadBytesWithRevision(key string) (_ []string, _ [][]byte, _ int64, err error) {
+	defer wrapError(&err, "LoadBytesWithRevision", kv.rootPath, key, 1, time.Now())
 	key = path.Join(kv.rootPath, key)
 	log.Debug("LoadBytesWithRevision ", zap.String("prefix", key))
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
@@ -334,34 +336,38 @@ func (kv *EmbedEtcdKV) LoadBytesWithRevision(key string) ([]string, [][]byte, in
 }
 
 // Save saves the key-value pair.
-func (kv *EmbedEtcdKV) Save(key, value string) error {
+func (kv *EmbedEtcdKV) Save(key, value string) (err error) {
+	defer wrapError(&err, "Save", kv.rootPath, key, 1, time.Now())
 	key = path.Join(kv.rootPath, key)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	_, err := kv.client.Put(ctx, key, value)
+	_, err = kv.client.Put(ctx, key, value)
 	return err
 }
 
 // SaveBytes saves the key-value pair.
-func (kv *EmbedEtcdKV) SaveBytes(key string, value []byte) error {
+func (kv *EmbedEtcdKV) SaveBytes(key string, value []byte) (err error) {
+	defer wrapError(&err, "SaveBytes", kv.rootPath, key, 1, time.Now())
 	key = path.Join(kv.rootPath, key)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	_, err := kv.client.Put(ctx, key, string(value))
+	_, err = kv.client.Put(ctx, key, string(value))
 	return err
 }
 
 // SaveBytesWithLease is a function to put value in etcd with etcd lease options.
-func (kv *EmbedEtcdKV) SaveBytesWithLease(key string, value []byte, id clientv3.LeaseID) error {
+func (kv *EmbedEtcdKV) SaveBytesWithLease(key string, value []byte, id clientv3.LeaseID) (err error) {
+	defer wrapError(&err, "SaveBytesWithLease", kv.rootPath, key, 1, time.Now())
 	key = path.Join(kv.rootPath, key)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	_, err := kv.client.Put(ctx, key, string(value), clientv3.WithLease(id))
+	_, err = kv.client.Put(ctx, key, string(value), clientv3.WithLease(id))
 	return err
 }
 
 // MultiSave saves the key-value pairs in a transaction.
-func (kv *EmbedEtcdKV) MultiSave(kvs map[string]string) error {
+func (kv *EmbedEtcdKV) MultiSave(kvs map[string]string) (err error) {
+	defer wrapError(&err, "MultiSave", kv.rootPath, "", len(kvs), time.Now())
 	ops := make([]clientv3.Op, 0, len(kvs))
 	for key, value := range kvs {
 		ops = append(ops, clientv3.OpPut(path.Join(kv.rootPath, key), value))
@@ -370,12 +376,13 @@ func (kv *EmbedEtcdKV) MultiSave(kvs map[string]string) error {
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.client.Txn(ctx).If().Then(ops...).Commit()
+	_, err = kv.client.Txn(ctx).If().Then(ops...).Commit()
 	return err
 }
 
 // MultiSaveBytes saves the key-value pairs in a transaction.
-func (kv *EmbedEtcdKV) MultiSaveBytes(kvs map[string][]byte) error {
+func (kv *EmbedEtcdKV) MultiSaveBytes(kvs map[string][]byte) (err error) {
+	defer wrapError(&err, "MultiSaveBytes", kv.rootPath, "", len(kvs), time.Now())
 	ops := make([]clientv3.Op, 0, len(kvs))
 	for key, value := range kvs {
 		ops = append(ops, clientv3.OpPut(path.Join(kv.rootPath, key), string(value)))
@@ -384,32 +391,35 @@ func (kv *EmbedEtcdKV) MultiSaveBytes(kvs map[string][]byte) error {
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.client.Txn(ctx).If().Then(ops...).Commit()
+	_, err = kv.client.Txn(ctx).If().Then(ops...).Commit()
 	return err
 }
 
 // RemoveWithPrefix removes the keys with given prefix.
-func (kv *EmbedEtcdKV) RemoveWithPrefix(prefix string) error {
+func (kv *EmbedEtcdKV) RemoveWithPrefix(prefix string) (err error) {
+	defer wrapError(&err, "RemoveWithPrefix", kv.rootPath, prefix, 1, time.Now())
 	key := path.Join(kv.rootPath, prefix)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.client.Delete(ctx, key, clientv3.WithPrefix())
+	_, err = kv.client.Delete(ctx, key, clientv3.WithPrefix())
 	return err
 }
 
 // Remove removes the key.
-func (kv *EmbedEtcdKV) Remove(key string) error {
+func (kv *EmbedEtcdKV) Remove(key string) (err error) {
+	defer wrapError(&err, "Remove", kv.rootPath, key, 1, time.Now())
 	key = path.Join(kv.rootPath, key)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.client.Delete(ctx, key)
+	_, err = kv.client.Delete(ctx, key)
 	return err
 }
 
 // MultiRemove removes the keys in a transaction.
-func (kv *EmbedEtcdKV) MultiRemove(keys []string) error {
+func (kv *EmbedEtcdKV) MultiRemove(keys []string) (err error) {
+	defer wrapError(&err, "MultiRemove", kv.rootPath, "", len(keys), time.Now())
 	ops := make([]clientv3.Op, 0, len(keys))
 	for _, key := range keys {
 		ops = append(ops, clientv3.OpDelete(path.Join(kv.rootPath, key)))
@@ -418,13 +428,14 @@ func (kv *EmbedEtcdKV) MultiRemove(keys []string) error {
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.client.Txn(ctx).If().Then(ops...).Commit()
+	_, err = kv.client.Txn(ctx).If().Then(ops...).Commit()
 	return err
 }
 
 // MultiSaveAndRemove saves the key-value pairs and removes the keys in a transaction.
-func (kv *EmbedEtcdKV) MultiSaveAndRemove(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
-	cmps, err := parsePredicates(kv.rootPath, preds...)
+func (kv *EmbedEtcdKV) MultiSaveAndRemove(saves map[string]string, removals []string, preds ...predicates.Predicate) (err error) {
+	defer wrapError(&err, "MultiSaveAndRemove", kv.rootPath, "", len(saves)+len(removals), time.Now())
+	cmps, err := parsePredicates(kv.client, kv.GetPath, preds...)
 	if err != nil {
 		return err
 	}
@@ -453,7 +464,8 @@ func (kv *EmbedEtcdKV) MultiSaveAndRemove(saves map[string]string, removals []st
 }
 
 // MultiSaveBytesAndRemove saves the key-value pairs and removes the keys in a transaction.
-func (kv *EmbedEtcdKV) MultiSaveBytesAndRemove(saves map[string][]byte, removals []string) error {
+func (kv *EmbedEtcdKV) MultiSaveBytesAndRemove(saves map[string][]byte, removals []string) (err error) {
+	defer wrapError(&err, "MultiSaveBytesAndRemove", kv.rootPath, "", len(saves)+len(removals), time.Now())
 	ops := make([]clientv3.Op, 0, len(saves)+len(removals))
 	for key, value := range saves {
 		ops = append(ops, clientv3.OpPut(path.Join(kv.rootPath, key), string(value)))
@@ -466,7 +478,7 @@ func (kv *EmbedEtcdKV) MultiSaveBytesAndRemove(saves map[string][]byte, removals
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.client.Txn(ctx).If().Then(ops...).Commit()
+	_, err = kv.client.Txn(ctx).If().Then(ops...).Commit()
 	return err
 }
 
@@ -489,8 +501,9 @@ func (kv *EmbedEtcdKV) WatchWithRevision(key string, revision int64) clientv3.Wa
 }
 
 // MultiSaveAndRemoveWithPrefix saves kv in @saves and removes the keys with given prefix in @removals.
-func (kv *EmbedEtcdKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
-	cmps, err := parsePredicates(kv.rootPath, preds...)
+func (kv *EmbedEtcdKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals []string, preds ...predicates.Predicate) (err error) {
+	defer wrapError(&err, "MultiSaveAndRemoveWithPrefix", kv.rootPath, "", len(saves)+len(removals), time.Now())
+	cmps, err := parsePredicates(kv.client, kv.GetPath, preds...)
 	if err != nil {
 		return err
 	}
@@ -519,7 +532,8 @@ func (kv *EmbedEtcdKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, rem
 }
 
 // MultiSaveBytesAndRemoveWithPrefix saves kv in @saves and removes the keys with given prefix in @removals.
-func (kv *EmbedEtcdKV) MultiSaveBytesAndRemoveWithPrefix(saves map[string][]byte, removals []string) error {
+func (kv *EmbedEtcdKV) MultiSaveBytesAndRemoveWithPrefix(saves map[string][]byte, removals []string) (err error) {
+	defer wrapError(&err, "MultiSaveBytesAndRemoveWithPrefix", kv.rootPath, "", len(saves)+len(removals), time.Now())
 	ops := make([]clientv3.Op, 0, len(saves)+len(removals))
 	for key, value := range saves {
 		ops = append(ops, clientv3.OpPut(path.Join(kv.rootPath, key), string(value)))
@@ -532,13 +546,14 @@ func (kv *EmbedEtcdKV) MultiSaveBytesAndRemoveWithPrefix(saves map[string][]byte
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.client.Txn(ctx).If().Then(ops...).Commit()
+	_, err = kv.client.Txn(ctx).If().Then(ops...).Commit()
 	return err
 }
 
 // CompareVersionAndSwap compares the existing key-value's version with version, and if
 // they are equal, the target is stored in etcd.
-func (kv *EmbedEtcdKV) CompareVersionAndSwap(key string, version int64, target string) (bool, error) {
+func (kv *EmbedEtcdKV) CompareVersionAndSwap(key string, version int64, target string) (_ bool, err error) {
+	defer wrapError(&err, "CompareVersionAndSwap", kv.rootPath, key, 1, time.Now())
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 	resp, err := kv.client.Txn(ctx).If(
@@ -555,7 +570,8 @@ func (kv *EmbedEtcdKV) CompareVersionAndSwap(key string, version int64, target s
 
 // CompareVersionAndSwapBytes compares the existing key-value's version with version, and if
 // they are equal, the target is stored in etcd.
-func (kv *EmbedEtcdKV) CompareVersionAndSwapBytes(key string, version int64, target []byte, opts ...clientv3.OpOption) (bool, error) {
+func (kv *EmbedEtcdKV) CompareVersionAndSwapBytes(key string, version int64, target []byte, opts ...clientv3.OpOption) (_ bool, err error) {
+	defer wrapError(&err, "CompareVersionAndSwapBytes", kv.rootPath, key, 1, time.Now())
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 	resp, err := kv.client.Txn(ctx).If(
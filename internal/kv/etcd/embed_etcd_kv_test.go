@@ -88,7 +88,7 @@ func TestEmbedEtcd(te *testing.T) {
 
 		for _, test := range invalidLoadTests {
 			val, err := metaKv.Load(test.invalidKey)
-			assert.Error(t, err)
+			assert.ErrorIs(t, err, kv.ErrKeyNotFound)
 			assert.Zero(t, val)
 		}
 
@@ -366,7 +366,7 @@ func TestEmbedEtcd(te *testing.T) {
 
 		for _, test := range invalidMultiLoad {
 			vs, err := metaKv.MultiLoad(test.invalidKeys)
-			assert.Error(t, err)
+			assert.ErrorIs(t, err, kv.ErrKeyNotFound)
 			assert.Equal(t, test.expectedValues, vs)
 		}
 
@@ -876,6 +876,7 @@ func (s *EmbedEtcdKVSuite) TestTxnWithPredicates() {
 	prepareKV := map[string]string{
 		"lease1": "1",
 		"lease2": "2",
+		"empty":  "",
 	}
 
 	err := etcdKV.MultiSave(prepareKV)
@@ -894,6 +895,27 @@ func (s *EmbedEtcdKVSuite) TestTxnWithPredicates() {
 		{"predicate_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueEqual("lease1", "1")}, true},
 		{"predicate_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueEqual("lease1", "2")}, false},
 		{"bad_predicate", map[string]string{"a": "b"}, []predicates.Predicate{badPredicate}, false},
+		{"value_in_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "0", "1")}, true},
+		{"value_in_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "0", "2")}, false},
+		{"value_in_missing_key", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease3", "", "1")}, false},
+		{"value_in_and_equal_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "1", "2"), predicates.ValueEqual("lease2", "2")}, true},
+		{"value_in_and_equal_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "1", "2"), predicates.ValueEqual("lease2", "1")}, false},
+		{"value_greater_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueGreater("lease1", "0")}, true},
+		{"value_greater_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueGreater("lease1", "1")}, false},
+		{"value_less_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueLess("lease1", "2")}, true},
+		{"value_less_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueLess("lease2", "10")}, false},
+		{"value_greater_missing_key", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueGreater("lease3", "")}, false},
+		{"numeric_value_greater_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.NumericValueGreater("lease2", -1)}, true},
+		{"numeric_value_greater_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.NumericValueGreater("lease2", 10)}, false},
+		{"numeric_value_less_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.NumericValueLess("lease2", 10)}, true},
+		{"numeric_value_less_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.NumericValueLess("lease1", 1)}, false},
+		{"numeric_value_missing_key", map[string]string{"a": "b"}, []predicates.Predicate{predicates.NumericValueLess("lease3", 10)}, false},
+		{"key_exists_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyExists("lease1")}, true},
+		{"key_exists_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyExists("lease3")}, false},
+		{"key_not_exists_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyNotExists("lease3")}, true},
+		{"key_not_exists_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyNotExists("lease1")}, false},
+		{"key_exists_empty_value", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyExists("empty")}, true},
+		{"key_not_exists_empty_value", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyNotExists("empty")}, false},
 	}
 
 	for _, test := range multiSaveAndRemovePredTests {
@@ -19,13 +19,14 @@ package etcdkv
 import (
 	"context"
 	"encoding/binary"
-	"fmt"
 	"path"
 	"time"
 
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/zap"
 
+	"github.com/milvus-io/milvus/internal/kv"
 	"github.com/milvus-io/milvus/internal/kv/predicates"
 	"github.com/milvus-io/milvus/pkg/common"
 	"github.com/milvus-io/milvus/pkg/log"
@@ -39,17 +40,72 @@ const (
 	RequestTimeout = 10 * time.Second
 )
 
+// large values flowing through etcdKV are sampled by the kv instrumentation
+var (
+	observeValueSize = kv.ObserveValueSize
+	largeValueOpLoad = kv.LargeValueOpLoad
+	largeValueOpSave = kv.LargeValueOpSave
+)
+
+// values logged by the etcd kvs are redacted by the rules of the kv layer
+var valueField = kv.ValueField
+
+// valuesField is valueField for the kvs of a batch.
+func valuesField[V string | []byte](name string, kvs map[string]V) zap.Field {
+	return kv.ValuesField(name, kvs)
+}
+
+// errors returned by the etcd kv carry the context of the failed operation
+var wrapError = kv.WrapError
+
+// missingKeysErrorOf returns the error of MultiLoad failing only for the keys whose gets
+// in responses found no value, it is nil if all the keys are found.
+func missingKeysErrorOf(keys []string, responses []*etcdserverpb.ResponseOp) error {
+	var missing []string
+	for index, rp := range responses {
+		if len(rp.GetResponseRange().GetKvs()) == 0 {
+			missing = append(missing, keys[index])
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return kv.NewMissingKeysError(missing)
+}
+
+// the kv metrics are labeled by the prefix rules of the kv layer
+var (
+	prefixLabel   = kv.PrefixLabel
+	prefixLabelOf = kv.PrefixLabelOf
+)
+
 // etcdKV implements TxnKV interface, it supports to process multiple kvs in a transaction.
 type etcdKV struct {
-	client   *clientv3.Client
-	rootPath string
+	client *clientv3.Client
+	// kvClient, watcher and lease are scoped to namespace, keys passed to them are mapped by nsKey
+	// and keys returned by them are mapped back to full paths by fullKey.
+	kvClient  clientv3.KV
+	watcher   clientv3.Watcher
+	lease     clientv3.Lease
+	rootPath  string
+	namespace string
+	// hooks are notified of the writes committed through this instance
+	hooks kv.WriteHooks
+	// deletions are the background prefix deletions started through this instance
+	deletions kv.DeletionJobs
 }
 
 // NewEtcdKV creates a new etcd kv.
 func NewEtcdKV(client *clientv3.Client, rootPath string) *etcdKV {
+	ns := namespaceOf(rootPath)
+	kvClient, watcher, lease := namespacedClient(client, ns)
 	kv := &etcdKV{
-		client:   client,
-		rootPath: rootPath,
+		client:    client,
+		kvClient:  kvClient,
+		watcher:   watcher,
+		lease:     lease,
+		rootPath:  rootPath,
+		namespace: ns,
 	}
 	return kv
 }
@@ -64,9 +120,15 @@ func (kv *etcdKV) GetPath(key string) string {
 	return path.Join(kv.rootPath, key)
 }
 
-func (kv *etcdKV) WalkWithPrefix(prefix string, paginationSize int, fn func([]byte, []byte) error) error {
+// RegisterWriteHook registers fn to be invoked synchronously after each successful write
+// affecting keys with prefix. Keys passed to fn are relative to the root path.
+func (kv *etcdKV) RegisterWriteHook(prefix string, fn func(op kv.WriteOp)) {
+	kv.hooks.Register(prefix, fn)
+}
+
+func (kv *etcdKV) WalkWithPrefix(prefix string, paginationSize int, fn func([]byte, []byte) error) (err error) {
 	start := time.Now()
-	prefix = path.Join(kv.rootPath, prefix)
+	defer wrapError(&err, "WalkWithPrefix", kv.rootPath, prefix, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
@@ -74,18 +136,18 @@ func (kv *etcdKV) WalkWithPrefix(prefix string, paginationSize int, fn func([]by
 	opts := []clientv3.OpOption{
 		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
 		clientv3.WithLimit(batch),
-		clientv3.WithRange(clientv3.GetPrefixRangeEnd(prefix)),
+		clientv3.WithRange(clientv3.GetPrefixRangeEnd(kv.nsKey(prefix))),
 	}
 
-	key := prefix
+	key := kv.nsPrefix(prefix)
 	for {
 		resp, err := kv.getEtcdMeta(ctx, key, opts...)
 		if err != nil {
 			return err
 		}
 
-		for _, kv := range resp.Kvs {
-			if err = fn(kv.Key, kv.Value); err != nil {
+		for _, entry := range resp.Kvs {
+			if err = fn([]byte(kv.fullKey(entry.Key)), entry.Value); err != nil {
 				return err
 			}
 		}
@@ -97,89 +159,89 @@ func (kv *etcdKV) WalkWithPrefix(prefix string, paginationSize int, fn func([]by
 		key = string(append(resp.Kvs[len(resp.Kvs)-1].Key, 0))
 	}
 
-	CheckElapseAndWarn(start, "Slow etcd operation(WalkWithPagination)", zap.String("prefix", prefix))
+	CheckElapseAndWarn(start, "Slow etcd operation(WalkWithPagination)", zap.String("prefix", kv.GetPath(prefix)))
 	return nil
 }
 
 // LoadWithPrefix returns all the keys and values with the given key prefix.
-func (kv *etcdKV) LoadWithPrefix(key string) ([]string, []string, error) {
+func (kv *etcdKV) LoadWithPrefix(key string) (_ []string, _ []string, err error) {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
+	defer wrapError(&err, "LoadWithPrefix", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	resp, err := kv.getEtcdMeta(ctx, key, clientv3.WithPrefix(),
+	resp, err := kv.getEtcdMeta(ctx, kv.nsKey(key), clientv3.WithPrefix(),
 		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
 	if err != nil {
 		return nil, nil, err
 	}
 	keys := make([]string, 0, resp.Count)
 	values := make([]string, 0, resp.Count)
-	for _, kv := range resp.Kvs {
-		keys = append(keys, string(kv.Key))
-		values = append(values, string(kv.Value))
+	for _, entry := range resp.Kvs {
+		keys = append(keys, kv.fullKey(entry.Key))
+		values = append(values, string(entry.Value))
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation load with prefix", zap.Strings("keys", keys))
 	return keys, values, nil
 }
 
-func (kv *etcdKV) Has(key string) (bool, error) {
+func (kv *etcdKV) Has(key string) (_ bool, err error) {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
+	defer wrapError(&err, "Has", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	resp, err := kv.getEtcdMeta(ctx, key, clientv3.WithCountOnly())
+	resp, err := kv.getEtcdMeta(ctx, kv.nsKey(key), clientv3.WithCountOnly())
 	if err != nil {
 		return false, err
 	}
 
-	CheckElapseAndWarn(start, "Slow etcd operation has", zap.String("key", key))
+	CheckElapseAndWarn(start, "Slow etcd operation has", zap.String("key", kv.GetPath(key)))
 	return resp.Count != 0, nil
 }
 
-func (kv *etcdKV) HasPrefix(prefix string) (bool, error) {
+func (kv *etcdKV) HasPrefix(prefix string) (_ bool, err error) {
 	start := time.Now()
-	prefix = path.Join(kv.rootPath, prefix)
+	defer wrapError(&err, "HasPrefix", kv.rootPath, prefix, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	resp, err := kv.getEtcdMeta(ctx, prefix, clientv3.WithPrefix(), clientv3.WithLimit(1), clientv3.WithCountOnly())
+	resp, err := kv.getEtcdMeta(ctx, kv.nsKey(prefix), clientv3.WithPrefix(), clientv3.WithLimit(1), clientv3.WithCountOnly())
 	if err != nil {
 		return false, err
 	}
 
-	CheckElapseAndWarn(start, "Slow etcd operation has", zap.String("prefix", prefix))
+	CheckElapseAndWarn(start, "Slow etcd operation has", zap.String("prefix", kv.GetPath(prefix)))
 	return resp.Count != 0, nil
 }
 
 // LoadBytesWithPrefix returns all the keys and values with the given key prefix.
-func (kv *etcdKV) LoadBytesWithPrefix(key string) ([]string, [][]byte, error) {
+func (kv *etcdKV) LoadBytesWithPrefix(key string) (_ []string, _ [][]byte, err error) {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
+	defer wrapError(&err, "LoadBytesWithPrefix", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	resp, err := kv.getEtcdMeta(ctx, key, clientv3.WithPrefix(),
+	resp, err := kv.getEtcdMeta(ctx, kv.nsKey(key), clientv3.WithPrefix(),
 		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
 	if err != nil {
 		return nil, nil, err
 	}
 	keys := make([]string, 0, resp.Count)
 	values := make([][]byte, 0, resp.Count)
-	for _, kv := range resp.Kvs {
-		keys = append(keys, string(kv.Key))
-		values = append(values, kv.Value)
+	for _, entry := range resp.Kvs {
+		keys = append(keys, kv.fullKey(entry.Key))
+		values = append(values, entry.Value)
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation load with prefix", zap.Strings("keys", keys))
 	return keys, values, nil
 }
 
 // LoadBytesWithPrefix2 returns all the the keys,values and key versions with the given key prefix.
-func (kv *etcdKV) LoadBytesWithPrefix2(key string) ([]string, [][]byte, []int64, error) {
+func (kv *etcdKV) LoadBytesWithPrefix2(key string) (_ []string, _ [][]byte, _ []int64, err error) {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
+	defer wrapError(&err, "LoadBytesWithPrefix2", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	resp, err := kv.getEtcdMeta(ctx, key, clientv3.WithPrefix(),
+	resp, err := kv.getEtcdMeta(ctx, kv.nsKey(key), clientv3.WithPrefix(),
 		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
 	if err != nil {
 		return nil, nil, nil, err
@@ -187,55 +249,56 @@ func (kv *etcdKV) LoadBytesWithPrefix2(key string) ([]string, [][]byte, []int64,
 	keys := make([]string, 0, resp.Count)
 	values := make([][]byte, 0, resp.Count)
 	versions := make([]int64, 0, resp.Count)
-	for _, kv := range resp.Kvs {
-		keys = append(keys, string(kv.Key))
-		values = append(values, kv.Value)
-		versions = append(versions, kv.Version)
+	for _, entry := range resp.Kvs {
+		keys = append(keys, kv.fullKey(entry.Key))
+		values = append(values, entry.Value)
+		versions = append(versions, entry.Version)
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation load with prefix2", zap.Strings("keys", keys))
 	return keys, values, versions, nil
 }
 
 // Load returns value of the key.
-func (kv *etcdKV) Load(key string) (string, error) {
+func (kv *etcdKV) Load(key string) (_ string, err error) {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
+	defer wrapError(&err, "Load", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	resp, err := kv.getEtcdMeta(ctx, key)
+	resp, err := kv.getEtcdMeta(ctx, kv.nsKey(key))
 	if err != nil {
 		return "", err
 	}
 	if resp.Count <= 0 {
-		return "", common.NewKeyNotExistError(key)
+		return "", common.NewKeyNotExistError(kv.GetPath(key))
 	}
-	CheckElapseAndWarn(start, "Slow etcd operation load", zap.String("key", key))
+	CheckElapseAndWarn(start, "Slow etcd operation load", zap.String("key", kv.GetPath(key)))
 	return string(resp.Kvs[0].Value), nil
 }
 
 // LoadBytes returns value of the key.
-func (kv *etcdKV) LoadBytes(key string) ([]byte, error) {
+func (kv *etcdKV) LoadBytes(key string) (_ []byte, err error) {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
+	defer wrapError(&err, "LoadBytes", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	resp, err := kv.getEtcdMeta(ctx, key)
+	resp, err := kv.getEtcdMeta(ctx, kv.nsKey(key))
 	if err != nil {
 		return []byte{}, err
 	}
 	if resp.Count <= 0 {
-		return []byte{}, common.NewKeyNotExistError(key)
+		return []byte{}, common.NewKeyNotExistError(kv.GetPath(key))
 	}
-	CheckElapseAndWarn(start, "Slow etcd operation load", zap.String("key", key))
+	CheckElapseAndWarn(start, "Slow etcd operation load", zap.String("key", kv.GetPath(key)))
 	return resp.Kvs[0].Value, nil
 }
 
 // MultiLoad gets the values of the keys in a transaction.
-func (kv *etcdKV) MultiLoad(keys []string) ([]string, error) {
+func (kv *etcdKV) MultiLoad(keys []string) (_ []string, err error) {
 	start := time.Now()
+	defer wrapError(&err, "MultiLoad", kv.rootPath, "", len(keys), start)
 	ops := make([]clientv3.Op, 0, len(keys))
 	for _, keyLoad := range keys {
-		ops = append(ops, clientv3.OpGet(path.Join(kv.rootPath, keyLoad)))
+		ops = append(ops, clientv3.OpGet(kv.nsKey(keyLoad)))
 	}
 
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
@@ -246,19 +309,16 @@ func (kv *etcdKV) MultiLoad(keys []string) ([]string, error) {
 	}
 
 	result := make([]string, 0, len(keys))
-	invalid := make([]string, 0, len(keys))
-	for index, rp := range resp.Responses {
-		if rp.GetResponseRange().Kvs == nil || len(rp.GetResponseRange().Kvs) == 0 {
-			invalid = append(invalid, keys[index])
+	for _, rp := range resp.Responses {
+		if len(rp.GetResponseRange().Kvs) == 0 {
 			result = append(result, "")
 		}
 		for _, ev := range rp.GetResponseRange().Kvs {
 			result = append(result, string(ev.Value))
 		}
 	}
-	if len(invalid) != 0 {
-		log.Warn("MultiLoad: there are invalid keys", zap.Strings("keys", invalid))
-		err = fmt.Errorf("there are invalid keys: %s", invalid)
+	if err = missingKeysErrorOf(keys, resp.Responses); err != nil {
+		log.Warn("MultiLoad: there are invalid keys", zap.Error(err))
 		return result, err
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation multi load", zap.Any("keys", keys))
@@ -266,11 +326,12 @@ func (kv *etcdKV) MultiLoad(keys []string) ([]string, error) {
 }
 
 // MultiLoadBytes gets the values of the keys in a transaction.
-func (kv *etcdKV) MultiLoadBytes(keys []string) ([][]byte, error) {
+func (kv *etcdKV) MultiLoadBytes(keys []string) (_ [][]byte, err error) {
 	start := time.Now()
+	defer wrapError(&err, "MultiLoadBytes", kv.rootPath, "", len(keys), start)
 	ops := make([]clientv3.Op, 0, len(keys))
 	for _, keyLoad := range keys {
-		ops = append(ops, clientv3.OpGet(path.Join(kv.rootPath, keyLoad)))
+		ops = append(ops, clientv3.OpGet(kv.nsKey(keyLoad)))
 	}
 
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
@@ -281,19 +342,16 @@ func (kv *etcdKV) MultiLoadBytes(keys []string) ([][]byte, error) {
 	}
 
 	result := make([][]byte, 0, len(keys))
-	invalid := make([]string, 0, len(keys))
-	for index, rp := range resp.Responses {
-		if rp.GetResponseRange().Kvs == nil || len(rp.GetResponseRange().Kvs) == 0 {
-			invalid = append(invalid, keys[index])
+	for _, rp := range resp.Responses {
+		if len(rp.GetResponseRange().Kvs) == 0 {
 			result = append(result, []byte{})
 		}
 		for _, ev := range rp.GetResponseRange().Kvs {
 			result = append(result, ev.Value)
 		}
 	}
-	if len(invalid) != 0 {
-		log.Warn("MultiLoad: there are invalid keys", zap.Strings("keys", invalid))
-		err = fmt.Errorf("there are invalid keys: %s", invalid)
+	if err = missingKeysErrorOf(keys, resp.Responses); err != nil {
+		log.Warn("MultiLoad: there are invalid keys", zap.Error(err))
 		return result, err
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation multi load", zap.Strings("keys", keys))
@@ -301,152 +359,212 @@ func (kv *etcdKV) MultiLoadBytes(keys []string) ([][]byte, error) {
 }
 
 // LoadBytesWithRevision returns keys, values and revision with given key prefix.
-func (kv *etcdKV) LoadBytesWithRevision(key string) ([]string, [][]byte, int64, error) {
+func (kv *etcdKV) LoadBytesWithRevision(key string) (_ []string, _ [][]byte, _ int64, err error) {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
+	defer wrapError(&err, "LoadBytesWithRevision", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	resp, err := kv.getEtcdMeta(ctx, key, clientv3.WithPrefix(),
+	resp, err := kv.getEtcdMeta(ctx, kv.nsKey(key), clientv3.WithPrefix(),
 		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
 	if err != nil {
 		return nil, nil, 0, err
 	}
 	keys := make([]string, 0, resp.Count)
 	values := make([][]byte, 0, resp.Count)
-	for _, kv := range resp.Kvs {
-		keys = append(keys, string(kv.Key))
-		values = append(values, kv.Value)
+	for _, entry := range resp.Kvs {
+		keys = append(keys, kv.fullKey(entry.Key))
+		values = append(values, entry.Value)
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation load with revision", zap.Strings("keys", keys))
 	return keys, values, resp.Header.Revision, nil
 }
 
 // Save saves the key-value pair.
-func (kv *etcdKV) Save(key, value string) error {
+func (kv *etcdKV) Save(key, value string) (err error) {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
+	defer wrapError(&err, "Save", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	CheckValueSizeAndWarn(key, value)
-	_, err := kv.putEtcdMeta(ctx, key, value)
-	CheckElapseAndWarn(start, "Slow etcd operation save", zap.String("key", key))
+	CheckValueSizeAndWarn(kv.GetPath(key), value)
+	_, err = kv.putEtcdMeta(ctx, kv.nsKey(key), value)
+	CheckElapseAndWarn(start, "Slow etcd operation save", zap.String("key", kv.GetPath(key)))
+	if err == nil {
+		kv.hooks.NotifySave(map[string]string{key: value})
+	}
 	return err
 }
 
 // SaveBytes saves the key-value pair.
-func (kv *etcdKV) SaveBytes(key string, value []byte) error {
+func (kv *etcdKV) SaveBytes(key string, value []byte) (err error) {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
+	defer wrapError(&err, "SaveBytes", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	CheckValueSizeAndWarn(key, value)
-	_, err := kv.putEtcdMeta(ctx, key, string(value))
-	CheckElapseAndWarn(start, "Slow etcd operation save", zap.String("key", key))
+	CheckValueSizeAndWarn(kv.GetPath(key), value)
+	_, err = kv.putEtcdMeta(ctx, kv.nsKey(key), string(value))
+	CheckElapseAndWarn(start, "Slow etcd operation save", zap.String("key", kv.GetPath(key)))
+	if err == nil {
+		kv.hooks.NotifySave(map[string]string{key: string(value)})
+	}
 	return err
 }
 
 // SaveBytesWithLease is a function to put value in etcd with etcd lease options.
-func (kv *etcdKV) SaveBytesWithLease(key string, value []byte, id clientv3.LeaseID) error {
+func (kv *etcdKV) SaveBytesWithLease(key string, value []byte, id clientv3.LeaseID) (err error) {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
+	defer wrapError(&err, "SaveBytesWithLease", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
-	CheckValueSizeAndWarn(key, value)
-	_, err := kv.putEtcdMeta(ctx, key, string(value), clientv3.WithLease(id))
-	CheckElapseAndWarn(start, "Slow etcd operation save with lease", zap.String("key", key))
+	CheckValueSizeAndWarn(kv.GetPath(key), value)
+	_, err = kv.putEtcdMeta(ctx, kv.nsKey(key), string(value), clientv3.WithLease(id))
+	CheckElapseAndWarn(start, "Slow etcd operation save with lease", zap.String("key", kv.GetPath(key)))
+	if err == nil {
+		kv.hooks.NotifySave(map[string]string{key: string(value)})
+	}
 	return err
 }
 
 // MultiSave saves the key-value pairs in a transaction.
-func (kv *etcdKV) MultiSave(kvs map[string]string) error {
+func (kv *etcdKV) MultiSave(kvs map[string]string) (err error) {
 	start := time.Now()
+	defer wrapError(&err, "MultiSave", kv.rootPath, "", len(kvs), start)
 	ops := make([]clientv3.Op, 0, len(kvs))
 	var keys []string
 	for key, value := range kvs {
 		keys = append(keys, key)
-		ops = append(ops, clientv3.OpPut(path.Join(kv.rootPath, key), value))
+		ops = append(ops, clientv3.OpPut(kv.nsKey(key), value))
 	}
 
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
 	CheckTnxStringValueSizeAndWarn(kvs)
-	_, err := kv.executeTxn(kv.getTxnWithCmp(ctx), ops...)
+	_, err = kv.executeTxn(kv.getTxnWithCmp(ctx), ops...)
 	if err != nil {
-		log.Warn("Etcd MultiSave error", zap.Any("kvs", kvs), zap.Int("len", len(kvs)), zap.Error(err))
+		log.Warn("Etcd MultiSave error", valuesField("kvs", kvs), zap.Int("len", len(kvs)), zap.Error(err))
+	} else {
+		kv.hooks.NotifySave(kvs)
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation multi save", zap.Strings("keys", keys))
 	return err
 }
 
 // MultiSaveBytes saves the key-value pairs in a transaction.
-func (kv *etcdKV) MultiSaveBytes(kvs map[string][]byte) error {
+func (kv *etcdKV) MultiSaveBytes(kvs map[string][]byte) (err error) {
 	start := time.Now()
+	defer wrapError(&err, "MultiSaveBytes", kv.rootPath, "", len(kvs), start)
 	ops := make([]clientv3.Op, 0, len(kvs))
 	var keys []string
 	for key, value := range kvs {
 		keys = append(keys, key)
-		ops = append(ops, clientv3.OpPut(path.Join(kv.rootPath, key), string(value)))
+		ops = append(ops, clientv3.OpPut(kv.nsKey(key), string(value)))
 	}
 
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
 	CheckTnxBytesValueSizeAndWarn(kvs)
-	_, err := kv.executeTxn(kv.getTxnWithCmp(ctx), ops...)
+	_, err = kv.executeTxn(kv.getTxnWithCmp(ctx), ops...)
 	if err != nil {
-		log.Warn("Etcd MultiSaveBytes err", zap.Any("kvs", kvs), zap.Int("len", len(kvs)), zap.Error(err))
+		log.Warn("Etcd MultiSaveBytes err", valuesField("kvs", kvs), zap.Int("len", len(kvs)), zap.Error(err))
+	} else {
+		kv.hooks.NotifySave(bytesToStrings(kvs))
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation multi save", zap.Strings("keys", keys))
 	return err
 }
 
 // RemoveWithPrefix removes the keys with given prefix.
-func (kv *etcdKV) RemoveWithPrefix(prefix string) error {
+func (kv *etcdKV) RemoveWithPrefix(prefix string) (err error) {
 	start := time.Now()
-	key := path.Join(kv.rootPath, prefix)
+	defer wrapError(&err, "RemoveWithPrefix", kv.rootPath, prefix, 1, start)
+	key := kv.nsKey(prefix)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.removeEtcdMeta(ctx, key, clientv3.WithPrefix())
+	_, err = kv.removeEtcdMeta(ctx, key, clientv3.WithPrefix())
 	CheckElapseAndWarn(start, "Slow etcd operation remove with prefix", zap.String("prefix", prefix))
+	if err == nil {
+		kv.hooks.NotifyRemoveWithPrefix(prefix)
+	}
 	return err
 }
 
+// AsyncRemoveWithPrefix removes the keys with given prefix in background, chunk by chunk.
+// The removal is eventual: keys under prefix stay visible to reads until their chunk is removed, and keys
+// saved under prefix while the job runs may be removed as well. A journal key is saved before the job
+// starts and removed once it is completed or canceled, so an interrupted job can be resumed by
+// ResumeDeletionJobs. The write hooks are notified of the keys of each chunk once it's removed, and
+// of the prefix once the job is completed.
+func (kv *etcdKV) AsyncRemoveWithPrefix(prefix string) (_ *kv.DeletionJob, err error) {
+	defer wrapError(&err, "AsyncRemoveWithPrefix", kv.rootPath, prefix, 1, time.Now())
+	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
+	defer cancel()
+
+	deleter := newPrefixDeleter(kv, prefix)
+	_, err = kv.putEtcdMeta(ctx, kv.nsKey(deleter.journalKey()), prefix)
+	if err != nil {
+		log.Warn("failed to save journal of deletion job", zap.String("prefix", prefix), zap.Error(err))
+		return nil, err
+	}
+	return kv.deletions.Start(prefix, deleter), nil
+}
+
+// ResumeDeletionJobs restarts the prefix deletions left unfinished according to the journal.
+func (kv *etcdKV) ResumeDeletionJobs() (jobs []*kv.DeletionJob, err error) {
+	defer wrapError(&err, "ResumeDeletionJobs", kv.rootPath, deletionJournalPrefix, 1, time.Now())
+	_, prefixes, err := kv.LoadWithPrefix(deletionJournalPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, prefix := range prefixes {
+		log.Info("etcd kv resume deletion job", zap.String("rootPath", kv.rootPath), zap.String("prefix", prefix))
+		jobs = append(jobs, kv.deletions.Start(prefix, newPrefixDeleter(kv, prefix)))
+	}
+	return jobs, nil
+}
+
 // Remove removes the key.
-func (kv *etcdKV) Remove(key string) error {
+func (kv *etcdKV) Remove(key string) (err error) {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
+	defer wrapError(&err, "Remove", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.removeEtcdMeta(ctx, key)
-	CheckElapseAndWarn(start, "Slow etcd operation remove", zap.String("key", key))
+	_, err = kv.removeEtcdMeta(ctx, kv.nsKey(key))
+	CheckElapseAndWarn(start, "Slow etcd operation remove", zap.String("key", kv.GetPath(key)))
+	if err == nil {
+		kv.hooks.NotifyRemove(key)
+	}
 	return err
 }
 
 // MultiRemove removes the keys in a transaction.
-func (kv *etcdKV) MultiRemove(keys []string) error {
+func (kv *etcdKV) MultiRemove(keys []string) (err error) {
 	start := time.Now()
+	defer wrapError(&err, "MultiRemove", kv.rootPath, "", len(keys), start)
 	ops := make([]clientv3.Op, 0, len(keys))
 	for _, key := range keys {
-		ops = append(ops, clientv3.OpDelete(path.Join(kv.rootPath, key)))
+		ops = append(ops, clientv3.OpDelete(kv.nsKey(key)))
 	}
 
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.executeTxn(kv.getTxnWithCmp(ctx), ops...)
+	_, err = kv.executeTxn(kv.getTxnWithCmp(ctx), ops...)
 	if err != nil {
 		log.Warn("Etcd MultiRemove error", zap.Strings("keys", keys), zap.Int("len", len(keys)), zap.Error(err))
+	} else {
+		kv.hooks.NotifyRemove(keys...)
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation multi remove", zap.Strings("keys", keys))
 	return err
 }
 
 // MultiSaveAndRemove saves the key-value pairs and removes the keys in a transaction.
-func (kv *etcdKV) MultiSaveAndRemove(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
-	cmps, err := parsePredicates(kv.rootPath, preds...)
+func (kv *etcdKV) MultiSaveAndRemove(saves map[string]string, removals []string, preds ...predicates.Predicate) (err error) {
+	defer wrapError(&err, "MultiSaveAndRemove", kv.rootPath, "", len(saves)+len(removals), time.Now())
+	cmps, err := parsePredicates(kv.kvClient, kv.nsKey, preds...)
 	if err != nil {
 		return err
 	}
@@ -456,11 +574,11 @@ func (kv *etcdKV) MultiSaveAndRemove(saves map[string]string, removals []string,
 	var keys []string
 	for key, value := range saves {
 		keys = append(keys, key)
-		ops = append(ops, clientv3.OpPut(path.Join(kv.rootPath, key), value))
+		ops = append(ops, clientv3.OpPut(kv.nsKey(key), value))
 	}
 
 	for _, keyDelete := range removals {
-		ops = append(ops, clientv3.OpDelete(path.Join(kv.rootPath, keyDelete)))
+		ops = append(ops, clientv3.OpDelete(kv.nsKey(keyDelete)))
 	}
 
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
@@ -469,7 +587,7 @@ func (kv *etcdKV) MultiSaveAndRemove(saves map[string]string, removals []string,
 	resp, err := kv.executeTxn(kv.getTxnWithCmp(ctx, cmps...), ops...)
 	if err != nil {
 		log.Warn("Etcd MultiSaveAndRemove error",
-			zap.Any("saves", saves),
+			valuesField("saves", saves),
 			zap.Strings("removes", removals),
 			zap.Int("saveLength", len(saves)),
 			zap.Int("removeLength", len(removals)),
@@ -481,34 +599,93 @@ func (kv *etcdKV) MultiSaveAndRemove(saves map[string]string, removals []string,
 		log.Warn("failed to executeTxn", zap.Any("resp", resp))
 		return merr.WrapErrIoFailedReason("failed to execute transaction")
 	}
+	kv.hooks.NotifySave(saves)
+	kv.hooks.NotifyRemove(removals...)
 	return nil
 }
 
+// MultiSaveAndRemoveWithPrevValues is MultiSaveAndRemove which also returns the values of the removed keys
+// before the transaction, the keys not existing are omitted. The values are read by the deletions of
+// the transaction, so they are exactly the values removed.
+func (kv *etcdKV) MultiSaveAndRemoveWithPrevValues(saves map[string]string, removals []string, preds ...predicates.Predicate) (_ map[string]string, err error) {
+	defer wrapError(&err, "MultiSaveAndRemoveWithPrevValues", kv.rootPath, "", len(saves)+len(removals), time.Now())
+	cmps, err := parsePredicates(kv.kvClient, kv.nsKey, preds...)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	ops := make([]clientv3.Op, 0, len(saves)+len(removals))
+	var keys []string
+	for key, value := range saves {
+		keys = append(keys, key)
+		ops = append(ops, clientv3.OpPut(kv.nsKey(key), value))
+	}
+
+	for _, keyDelete := range removals {
+		ops = append(ops, clientv3.OpDelete(kv.nsKey(keyDelete), clientv3.WithPrevKV()))
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
+	defer cancel()
+
+	resp, err := kv.executeTxn(kv.getTxnWithCmp(ctx, cmps...), ops...)
+	if err != nil {
+		log.Warn("Etcd MultiSaveAndRemoveWithPrevValues error",
+			valuesField("saves", saves),
+			zap.Strings("removes", removals),
+			zap.Int("saveLength", len(saves)),
+			zap.Int("removeLength", len(removals)),
+			zap.Error(err))
+		return nil, err
+	}
+	CheckElapseAndWarn(start, "Slow etcd operation multi save and remove with prev values", zap.Strings("keys", keys))
+	if !resp.Succeeded {
+		log.Warn("failed to executeTxn", zap.Any("resp", resp))
+		return nil, merr.WrapErrIoFailedReason("failed to execute transaction")
+	}
+
+	prevValues := make(map[string]string, len(removals))
+	// the responses of the deletions follow the ones of the puts
+	for i, rp := range resp.Responses[len(saves):] {
+		for _, prevKv := range rp.GetResponseDeleteRange().GetPrevKvs() {
+			prevValues[removals[i]] = string(prevKv.Value)
+		}
+	}
+	kv.hooks.NotifySave(saves)
+	kv.hooks.NotifyRemove(removals...)
+	return prevValues, nil
+}
+
 // MultiSaveBytesAndRemove saves the key-value pairs and removes the keys in a transaction.
-func (kv *etcdKV) MultiSaveBytesAndRemove(saves map[string][]byte, removals []string) error {
+func (kv *etcdKV) MultiSaveBytesAndRemove(saves map[string][]byte, removals []string) (err error) {
 	start := time.Now()
+	defer wrapError(&err, "MultiSaveBytesAndRemove", kv.rootPath, "", len(saves)+len(removals), start)
 	ops := make([]clientv3.Op, 0, len(saves)+len(removals))
 	var keys []string
 	for key, value := range saves {
 		keys = append(keys, key)
-		ops = append(ops, clientv3.OpPut(path.Join(kv.rootPath, key), string(value)))
+		ops = append(ops, clientv3.OpPut(kv.nsKey(key), string(value)))
 	}
 
 	for _, keyDelete := range removals {
-		ops = append(ops, clientv3.OpDelete(path.Join(kv.rootPath, keyDelete)))
+		ops = append(ops, clientv3.OpDelete(kv.nsKey(keyDelete)))
 	}
 
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.executeTxn(kv.getTxnWithCmp(ctx), ops...)
+	_, err = kv.executeTxn(kv.getTxnWithCmp(ctx), ops...)
 	if err != nil {
 		log.Warn("Etcd MultiSaveBytesAndRemove error",
-			zap.Any("saves", saves),
+			valuesField("saves", saves),
 			zap.Strings("removes", removals),
 			zap.Int("saveLength", len(saves)),
 			zap.Int("removeLength", len(removals)),
 			zap.Error(err))
+	} else {
+		kv.hooks.NotifySave(bytesToStrings(saves))
+		kv.hooks.NotifyRemove(removals...)
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation multi save and remove", zap.Strings("keys", keys))
 	return err
@@ -517,33 +694,31 @@ func (kv *etcdKV) MultiSaveBytesAndRemove(saves map[string][]byte, removals []st
 // Watch starts watching a key, returns a watch channel.
 func (kv *etcdKV) Watch(key string) clientv3.WatchChan {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
-	rch := kv.client.Watch(context.Background(), key, clientv3.WithCreatedNotify())
-	CheckElapseAndWarn(start, "Slow etcd operation watch", zap.String("key", key))
+	rch := kv.fullPathWatchChan(kv.watcher.Watch(context.Background(), kv.nsKey(key), clientv3.WithCreatedNotify()))
+	CheckElapseAndWarn(start, "Slow etcd operation watch", zap.String("key", kv.GetPath(key)))
 	return rch
 }
 
 // WatchWithPrefix starts watching a key with prefix, returns a watch channel.
 func (kv *etcdKV) WatchWithPrefix(key string) clientv3.WatchChan {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
-	rch := kv.client.Watch(context.Background(), key, clientv3.WithPrefix(), clientv3.WithCreatedNotify())
-	CheckElapseAndWarn(start, "Slow etcd operation watch with prefix", zap.String("key", key))
+	rch := kv.fullPathWatchChan(kv.watcher.Watch(context.Background(), kv.nsKey(key), clientv3.WithPrefix(), clientv3.WithCreatedNotify()))
+	CheckElapseAndWarn(start, "Slow etcd operation watch with prefix", zap.String("key", kv.GetPath(key)))
 	return rch
 }
 
 // WatchWithRevision starts watching a key with revision, returns a watch channel.
 func (kv *etcdKV) WatchWithRevision(key string, revision int64) clientv3.WatchChan {
 	start := time.Now()
-	key = path.Join(kv.rootPath, key)
-	rch := kv.client.Watch(context.Background(), key, clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithRev(revision))
-	CheckElapseAndWarn(start, "Slow etcd operation watch with revision", zap.String("key", key))
+	rch := kv.fullPathWatchChan(kv.watcher.Watch(context.Background(), kv.nsKey(key), clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithRev(revision)))
+	CheckElapseAndWarn(start, "Slow etcd operation watch with revision", zap.String("key", kv.GetPath(key)))
 	return rch
 }
 
 // MultiSaveAndRemoveWithPrefix saves kv in @saves and removes the keys with given prefix in @removals.
-func (kv *etcdKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
-	cmps, err := parsePredicates(kv.rootPath, preds...)
+func (kv *etcdKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals []string, preds ...predicates.Predicate) (err error) {
+	defer wrapError(&err, "MultiSaveAndRemoveWithPrefix", kv.rootPath, "", len(saves)+len(removals), time.Now())
+	cmps, err := parsePredicates(kv.kvClient, kv.nsKey, preds...)
 	if err != nil {
 		return err
 	}
@@ -553,11 +728,11 @@ func (kv *etcdKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals
 	var keys []string
 	for key, value := range saves {
 		keys = append(keys, key)
-		ops = append(ops, clientv3.OpPut(path.Join(kv.rootPath, key), value))
+		ops = append(ops, clientv3.OpPut(kv.nsKey(key), value))
 	}
 
 	for _, keyDelete := range removals {
-		ops = append(ops, clientv3.OpDelete(path.Join(kv.rootPath, keyDelete), clientv3.WithPrefix()))
+		ops = append(ops, clientv3.OpDelete(kv.nsKey(keyDelete), clientv3.WithPrefix()))
 	}
 
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
@@ -566,7 +741,7 @@ func (kv *etcdKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals
 	resp, err := kv.executeTxn(kv.getTxnWithCmp(ctx, cmps...), ops...)
 	if err != nil {
 		log.Warn("Etcd MultiSaveAndRemoveWithPrefix error",
-			zap.Any("saves", saves),
+			valuesField("saves", saves),
 			zap.Strings("removes", removals),
 			zap.Int("saveLength", len(saves)),
 			zap.Int("removeLength", len(removals)),
@@ -577,34 +752,44 @@ func (kv *etcdKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals
 	if !resp.Succeeded {
 		return merr.WrapErrIoFailedReason("failed to execute transaction")
 	}
+	kv.hooks.NotifySave(saves)
+	for _, prefix := range removals {
+		kv.hooks.NotifyRemoveWithPrefix(prefix)
+	}
 	return nil
 }
 
 // MultiSaveBytesAndRemoveWithPrefix saves kv in @saves and removes the keys with given prefix in @removals.
-func (kv *etcdKV) MultiSaveBytesAndRemoveWithPrefix(saves map[string][]byte, removals []string) error {
+func (kv *etcdKV) MultiSaveBytesAndRemoveWithPrefix(saves map[string][]byte, removals []string) (err error) {
 	start := time.Now()
+	defer wrapError(&err, "MultiSaveBytesAndRemoveWithPrefix", kv.rootPath, "", len(saves)+len(removals), start)
 	ops := make([]clientv3.Op, 0, len(saves))
 	var keys []string
 	for key, value := range saves {
 		keys = append(keys, key)
-		ops = append(ops, clientv3.OpPut(path.Join(kv.rootPath, key), string(value)))
+		ops = append(ops, clientv3.OpPut(kv.nsKey(key), string(value)))
 	}
 
 	for _, keyDelete := range removals {
-		ops = append(ops, clientv3.OpDelete(path.Join(kv.rootPath, keyDelete), clientv3.WithPrefix()))
+		ops = append(ops, clientv3.OpDelete(kv.nsKey(keyDelete), clientv3.WithPrefix()))
 	}
 
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 
-	_, err := kv.executeTxn(kv.getTxnWithCmp(ctx), ops...)
+	_, err = kv.executeTxn(kv.getTxnWithCmp(ctx), ops...)
 	if err != nil {
 		log.Warn("Etcd MultiSaveBytesAndRemoveWithPrefix error",
-			zap.Any("saves", saves),
+			valuesField("saves", saves),
 			zap.Strings("removes", removals),
 			zap.Int("saveLength", len(saves)),
 			zap.Int("removeLength", len(removals)),
 			zap.Error(err))
+	} else {
+		kv.hooks.NotifySave(bytesToStrings(saves))
+		for _, prefix := range removals {
+			kv.hooks.NotifyRemoveWithPrefix(prefix)
+		}
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation multi save and move with prefix", zap.Strings("keys", keys))
 	return err
@@ -612,33 +797,41 @@ func (kv *etcdKV) MultiSaveBytesAndRemoveWithPrefix(saves map[string][]byte, rem
 
 // CompareVersionAndSwap compares the existing key-value's version with version, and if
 // they are equal, the target is stored in etcd.
-func (kv *etcdKV) CompareVersionAndSwap(key string, source int64, target string) (bool, error) {
+func (kv *etcdKV) CompareVersionAndSwap(key string, source int64, target string) (_ bool, err error) {
 	start := time.Now()
+	defer wrapError(&err, "CompareVersionAndSwap", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 	resp, err := kv.executeTxn(kv.getTxnWithCmp(ctx,
-		clientv3.Compare(clientv3.Version(path.Join(kv.rootPath, key)), "=", source)),
-		clientv3.OpPut(path.Join(kv.rootPath, key), target))
+		clientv3.Compare(clientv3.Version(kv.nsKey(key)), "=", source)),
+		clientv3.OpPut(kv.nsKey(key), target))
 	if err != nil {
 		return false, err
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation compare version and swap", zap.String("key", key))
+	if resp.Succeeded {
+		kv.hooks.NotifySave(map[string]string{key: target})
+	}
 	return resp.Succeeded, nil
 }
 
 // CompareVersionAndSwapBytes compares the existing key-value's version with version, and if
 // they are equal, the target is stored in etcd.
-func (kv *etcdKV) CompareVersionAndSwapBytes(key string, source int64, target []byte, opts ...clientv3.OpOption) (bool, error) {
+func (kv *etcdKV) CompareVersionAndSwapBytes(key string, source int64, target []byte, opts ...clientv3.OpOption) (_ bool, err error) {
 	start := time.Now()
+	defer wrapError(&err, "CompareVersionAndSwapBytes", kv.rootPath, key, 1, start)
 	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
 	defer cancel()
 	resp, err := kv.executeTxn(kv.getTxnWithCmp(ctx,
-		clientv3.Compare(clientv3.Version(path.Join(kv.rootPath, key)), "=", source)),
-		clientv3.OpPut(path.Join(kv.rootPath, key), string(target), opts...))
+		clientv3.Compare(clientv3.Version(kv.nsKey(key)), "=", source)),
+		clientv3.OpPut(kv.nsKey(key), string(target), opts...))
 	if err != nil {
 		return false, err
 	}
 	CheckElapseAndWarn(start, "Slow etcd operation compare version and swap", zap.String("key", key))
+	if resp.Succeeded {
+		kv.hooks.NotifySave(map[string]string{key: string(target)})
+	}
 	return resp.Succeeded, nil
 }
 
@@ -680,12 +873,20 @@ func CheckTnxStringValueSizeAndWarn(kvs map[string]string) bool {
 	return CheckTnxBytesValueSizeAndWarn(newKvs)
 }
 
+func bytesToStrings(kvs map[string][]byte) map[string]string {
+	res := make(map[string]string, len(kvs))
+	for key, value := range kvs {
+		res[key] = string(value)
+	}
+	return res
+}
+
 func (kv *etcdKV) getEtcdMeta(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
 	ctx1, cancel := context.WithTimeout(ctx, RequestTimeout)
 	defer cancel()
 
 	start := timerecord.NewTimeRecorder("getEtcdMeta")
-	resp, err := kv.client.Get(ctx1, key, opts...)
+	resp, err := kv.kvClient.Get(ctx1, key, opts...)
 	elapsed := start.ElapseSpan()
 	metrics.MetaOpCounter.WithLabelValues(metrics.MetaGetLabel, metrics.TotalLabel).Inc()
 
@@ -694,9 +895,11 @@ func (kv *etcdKV) getEtcdMeta(ctx context.Context, key string, opts ...clientv3.
 		totalSize := 0
 		for _, v := range resp.Kvs {
 			totalSize += binary.Size(v)
+			observeValueSize(kv.fullKey(v.Key), len(v.Value), largeValueOpLoad)
 		}
-		metrics.MetaKvSize.WithLabelValues(metrics.MetaGetLabel).Observe(float64(totalSize))
-		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaGetLabel).Observe(float64(elapsed.Milliseconds()))
+		label := prefixLabel(key)
+		metrics.MetaKvSize.WithLabelValues(metrics.MetaGetLabel, label).Observe(float64(totalSize))
+		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaGetLabel, label).Observe(float64(elapsed.Milliseconds()))
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaGetLabel, metrics.SuccessLabel).Inc()
 	} else {
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaGetLabel, metrics.FailLabel).Inc()
@@ -709,12 +912,14 @@ func (kv *etcdKV) putEtcdMeta(ctx context.Context, key, val string, opts ...clie
 	defer cancel()
 
 	start := timerecord.NewTimeRecorder("putEtcdMeta")
-	resp, err := kv.client.Put(ctx1, key, val, opts...)
+	resp, err := kv.kvClient.Put(ctx1, key, val, opts...)
 	elapsed := start.ElapseSpan()
 	metrics.MetaOpCounter.WithLabelValues(metrics.MetaPutLabel, metrics.TotalLabel).Inc()
 	if err == nil {
-		metrics.MetaKvSize.WithLabelValues(metrics.MetaPutLabel).Observe(float64(len(val)))
-		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaPutLabel).Observe(float64(elapsed.Milliseconds()))
+		label := prefixLabel(key)
+		metrics.MetaKvSize.WithLabelValues(metrics.MetaPutLabel, label).Observe(float64(len(val)))
+		observeValueSize(kv.fullKey([]byte(key)), len(val), largeValueOpSave)
+		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaPutLabel, label).Observe(float64(elapsed.Milliseconds()))
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaPutLabel, metrics.SuccessLabel).Inc()
 	} else {
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaPutLabel, metrics.FailLabel).Inc()
@@ -728,12 +933,12 @@ func (kv *etcdKV) removeEtcdMeta(ctx context.Context, key string, opts ...client
 	defer cancel()
 
 	start := timerecord.NewTimeRecorder("removeEtcdMeta")
-	resp, err := kv.client.Delete(ctx1, key, opts...)
+	resp, err := kv.kvClient.Delete(ctx1, key, opts...)
 	elapsed := start.ElapseSpan()
 	metrics.MetaOpCounter.WithLabelValues(metrics.MetaRemoveLabel, metrics.TotalLabel).Inc()
 
 	if err == nil {
-		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaRemoveLabel).Observe(float64(elapsed.Milliseconds()))
+		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaRemoveLabel, prefixLabel(key)).Observe(float64(elapsed.Milliseconds()))
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaRemoveLabel, metrics.SuccessLabel).Inc()
 	} else {
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaRemoveLabel, metrics.FailLabel).Inc()
@@ -743,7 +948,7 @@ func (kv *etcdKV) removeEtcdMeta(ctx context.Context, key string, opts ...client
 }
 
 func (kv *etcdKV) getTxnWithCmp(ctx context.Context, cmp ...clientv3.Cmp) clientv3.Txn {
-	return kv.client.Txn(ctx).If(cmp...)
+	return kv.kvClient.Txn(ctx).If(cmp...)
 }
 
 func (kv *etcdKV) executeTxn(txn clientv3.Txn, ops ...clientv3.Op) (*clientv3.TxnResponse, error) {
@@ -756,12 +961,16 @@ func (kv *etcdKV) executeTxn(txn clientv3.Txn, ops ...clientv3.Op) (*clientv3.Tx
 	if err == nil && resp.Succeeded {
 		// cal put meta kv size
 		totalPutSize := 0
+		keys := make([]string, 0, len(ops))
 		for _, op := range ops {
+			keys = append(keys, string(op.KeyBytes()))
 			if op.IsPut() {
 				totalPutSize += binary.Size(op.ValueBytes())
+				observeValueSize(kv.fullKey(op.KeyBytes()), len(op.ValueBytes()), largeValueOpSave)
 			}
 		}
-		metrics.MetaKvSize.WithLabelValues(metrics.MetaPutLabel).Observe(float64(totalPutSize))
+		label := prefixLabelOf(keys...)
+		metrics.MetaKvSize.WithLabelValues(metrics.MetaPutLabel, label).Observe(float64(totalPutSize))
 
 		// cal get meta kv size
 		totalGetSize := 0
@@ -769,11 +978,12 @@ func (kv *etcdKV) executeTxn(txn clientv3.Txn, ops ...clientv3.Op) (*clientv3.Tx
 			if rp.GetResponseRange() != nil {
 				for _, v := range rp.GetResponseRange().Kvs {
 					totalGetSize += binary.Size(v)
+					observeValueSize(kv.fullKey(v.Key), len(v.Value), largeValueOpLoad)
 				}
 			}
 		}
-		metrics.MetaKvSize.WithLabelValues(metrics.MetaGetLabel).Observe(float64(totalGetSize))
-		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaTxnLabel).Observe(float64(elapsed.Milliseconds()))
+		metrics.MetaKvSize.WithLabelValues(metrics.MetaGetLabel, label).Observe(float64(totalGetSize))
+		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaTxnLabel, label).Observe(float64(elapsed.Milliseconds()))
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaTxnLabel, metrics.SuccessLabel).Inc()
 	} else {
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaTxnLabel, metrics.FailLabel).Inc()
@@ -17,23 +17,32 @@
 package etcdkv
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"golang.org/x/exp/maps"
 
+	"github.com/milvus-io/milvus/internal/kv"
 	"github.com/milvus-io/milvus/internal/kv/predicates"
+	"github.com/milvus-io/milvus/pkg/common"
+	"github.com/milvus-io/milvus/pkg/metrics"
 	"github.com/milvus-io/milvus/pkg/util/etcd"
 	"github.com/milvus-io/milvus/pkg/util/funcutil"
+	"github.com/milvus-io/milvus/pkg/util/merr"
 	"github.com/milvus-io/milvus/pkg/util/paramtable"
 )
 
@@ -583,6 +592,11 @@ func (s *EtcdKVSuite) TestTxnWithPredicates() {
 		{"predicate_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueEqual("lease1", "1")}, true},
 		{"predicate_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueEqual("lease1", "2")}, false},
 		{"bad_predicate", map[string]string{"a": "b"}, []predicates.Predicate{badPredicate}, false},
+		{"value_in_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "0", "1")}, true},
+		{"value_in_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "0", "2")}, false},
+		{"value_in_missing_key", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease3", "", "1")}, false},
+		{"value_in_and_equal_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "1", "2"), predicates.ValueEqual("lease2", "2")}, true},
+		{"value_in_and_equal_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "1", "2"), predicates.ValueEqual("lease2", "1")}, false},
 	}
 
 	for _, test := range multiSaveAndRemovePredTests {
@@ -603,6 +617,35 @@ func (s *EtcdKVSuite) TestTxnWithPredicates() {
 	}
 }
 
+func (s *EtcdKVSuite) TestValueInPredicate() {
+	etcdKV := s.etcdKV
+	s.Require().NoError(etcdKV.Save("state", "sealed"))
+
+	s.NoError(etcdKV.MultiSaveAndRemove(map[string]string{"state": "flushing"}, nil, predicates.ValueIn("state", "sealed", "flushing")))
+	value, err := etcdKV.Load("state")
+	s.NoError(err)
+	s.Equal("flushing", value)
+
+	err = etcdKV.MultiSaveAndRemove(map[string]string{"state": "dropped"}, nil, predicates.ValueIn("state", "growing", "sealed"))
+	s.ErrorIs(err, merr.ErrIoFailed)
+	s.ErrorContains(err, "key=state, candidates=[growing sealed], actual=flushing")
+
+	err = etcdKV.MultiSaveAndRemove(map[string]string{"state": "dropped"}, nil, predicates.ValueIn("missing", "growing", ""))
+	s.ErrorIs(err, merr.ErrIoFailed)
+	s.ErrorContains(err, "key=missing, candidates=[growing ], actual=<missing>")
+
+	// the value is read before the transaction, which fails if the key is changed after the read
+	cmps, err := parsePredicates(etcdKV.kvClient, etcdKV.nsKey, predicates.ValueIn("state", "flushing"))
+	s.Require().NoError(err)
+	s.Require().NoError(etcdKV.Save("state", "flushing"))
+	resp, err := etcdKV.kvClient.Txn(context.TODO()).If(cmps...).Then(clientv3.OpPut(etcdKV.nsKey("state"), "dropped")).Commit()
+	s.Require().NoError(err)
+	s.False(resp.Succeeded)
+	value, err = etcdKV.Load("state")
+	s.NoError(err)
+	s.Equal("flushing", value)
+}
+
 func (s *EtcdKVSuite) TestMultiSaveAndRemoveWithPrefix() {
 	etcdKV := s.etcdKV
 
@@ -647,6 +690,266 @@ func (s *EtcdKVSuite) TestMultiSaveAndRemoveWithPrefix() {
 	}
 }
 
+func (s *EtcdKVSuite) TestMultiSaveAndRemoveWithPrevValues() {
+	etcdKV := s.etcdKV
+
+	err := etcdKV.MultiSave(map[string]string{"a": "1", "b": "2", "c": "3"})
+	s.Require().NoError(err)
+	prevValues, err := etcdKV.MultiSaveAndRemoveWithPrevValues(map[string]string{"d": "4"}, []string{"a", "b", "not-exist"})
+	s.NoError(err)
+	s.Equal(map[string]string{"a": "1", "b": "2"}, prevValues)
+	_, values, err := etcdKV.LoadWithPrefix("")
+	s.NoError(err)
+	s.ElementsMatch([]string{"3", "4"}, values)
+
+	// predicate not met, nothing removed
+	prevValues, err = etcdKV.MultiSaveAndRemoveWithPrevValues(nil, []string{"c"}, predicates.ValueEqual("d", "5"))
+	s.Error(err)
+	s.Nil(prevValues)
+	value, err := etcdKV.Load("c")
+	s.NoError(err)
+	s.Equal("3", value)
+
+	prevValues, err = etcdKV.MultiSaveAndRemoveWithPrevValues(nil, []string{"c"}, predicates.ValueEqual("d", "4"))
+	s.NoError(err)
+	s.Equal(map[string]string{"c": "3"}, prevValues)
+
+	// the writers save the same value to both keys, the values removed together are always equal
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for j := 0; ctx.Err() == nil; j++ {
+				value := fmt.Sprintf("%d-%d", writer, j)
+				s.NoError(etcdKV.MultiSave(map[string]string{"x": value, "y": value}))
+			}
+		}(i)
+	}
+	removed := 0
+	for removed < 50 {
+		prevValues, err := etcdKV.MultiSaveAndRemoveWithPrevValues(nil, []string{"x", "y"})
+		s.Require().NoError(err)
+		if len(prevValues) == 0 {
+			continue
+		}
+		s.Require().Len(prevValues, 2)
+		s.Require().Equal(prevValues["x"], prevValues["y"])
+		removed++
+	}
+	cancel()
+	wg.Wait()
+}
+
+func (s *EtcdKVSuite) TestWriteHook() {
+	etcdKV := s.etcdKV
+
+	var ops []kv.WriteOp
+	etcdKV.RegisterWriteHook("hook/", func(op kv.WriteOp) {
+		ops = append(ops, op)
+	})
+	etcdKV.RegisterWriteHook("", func(op kv.WriteOp) {
+		panic("bad hook")
+	})
+
+	writeTests := []struct {
+		name     string
+		write    func() error
+		expected []kv.WriteOp
+	}{
+		{
+			"Save",
+			func() error { return etcdKV.Save("hook/1", "v1") },
+			[]kv.WriteOp{{Type: kv.WriteOpSave, Keys: []string{"hook/1"}, Values: []string{"v1"}}},
+		},
+		{
+			"SaveBytes",
+			func() error { return etcdKV.SaveBytes("hook/2", []byte("v2")) },
+			[]kv.WriteOp{{Type: kv.WriteOpSave, Keys: []string{"hook/2"}, Values: []string{"v2"}}},
+		},
+		{
+			"MultiSave",
+			func() error { return etcdKV.MultiSave(map[string]string{"hook/3": "v3", "other/1": "v"}) },
+			[]kv.WriteOp{{Type: kv.WriteOpSave, Keys: []string{"hook/3"}, Values: []string{"v3"}}},
+		},
+		{
+			"MultiSaveBytes",
+			func() error { return etcdKV.MultiSaveBytes(map[string][]byte{"hook/4": []byte("v4")}) },
+			[]kv.WriteOp{{Type: kv.WriteOpSave, Keys: []string{"hook/4"}, Values: []string{"v4"}}},
+		},
+		{
+			"Remove",
+			func() error { return etcdKV.Remove("hook/1") },
+			[]kv.WriteOp{{Type: kv.WriteOpRemove, Keys: []string{"hook/1"}}},
+		},
+		{
+			"MultiRemove",
+			func() error { return etcdKV.MultiRemove([]string{"hook/2", "other/1"}) },
+			[]kv.WriteOp{{Type: kv.WriteOpRemove, Keys: []string{"hook/2"}}},
+		},
+		{
+			"MultiSaveAndRemove",
+			func() error { return etcdKV.MultiSaveAndRemove(map[string]string{"hook/5": "v5"}, []string{"hook/3"}) },
+			[]kv.WriteOp{
+				{Type: kv.WriteOpSave, Keys: []string{"hook/5"}, Values: []string{"v5"}},
+				{Type: kv.WriteOpRemove, Keys: []string{"hook/3"}},
+			},
+		},
+		{
+			"MultiSaveBytesAndRemove",
+			func() error {
+				return etcdKV.MultiSaveBytesAndRemove(map[string][]byte{"hook/6": []byte("v6")}, []string{"hook/4"})
+			},
+			[]kv.WriteOp{
+				{Type: kv.WriteOpSave, Keys: []string{"hook/6"}, Values: []string{"v6"}},
+				{Type: kv.WriteOpRemove, Keys: []string{"hook/4"}},
+			},
+		},
+		{
+			"MultiSaveAndRemoveWithPrefix",
+			func() error {
+				return etcdKV.MultiSaveAndRemoveWithPrefix(map[string]string{"hook/7": "v7"}, []string{"hook/sub"})
+			},
+			[]kv.WriteOp{
+				{Type: kv.WriteOpSave, Keys: []string{"hook/7"}, Values: []string{"v7"}},
+				{Type: kv.WriteOpRemoveWithPrefix, Prefix: "hook/sub"},
+			},
+		},
+		{
+			"MultiSaveBytesAndRemoveWithPrefix",
+			func() error {
+				return etcdKV.MultiSaveBytesAndRemoveWithPrefix(map[string][]byte{"hook/8": []byte("v8")}, []string{"hook/sub"})
+			},
+			[]kv.WriteOp{
+				{Type: kv.WriteOpSave, Keys: []string{"hook/8"}, Values: []string{"v8"}},
+				{Type: kv.WriteOpRemoveWithPrefix, Prefix: "hook/sub"},
+			},
+		},
+		{
+			"CompareVersionAndSwap",
+			func() error {
+				_, err := etcdKV.CompareVersionAndSwap("hook/9", 0, "v9")
+				return err
+			},
+			[]kv.WriteOp{{Type: kv.WriteOpSave, Keys: []string{"hook/9"}, Values: []string{"v9"}}},
+		},
+		{
+			"RemoveWithPrefix",
+			func() error { return etcdKV.RemoveWithPrefix("hook") },
+			[]kv.WriteOp{{Type: kv.WriteOpRemoveWithPrefix, Prefix: "hook"}},
+		},
+	}
+	for _, test := range writeTests {
+		ops = nil
+		err := test.write()
+		s.NoError(err, test.name)
+		s.Equal(test.expected, ops, test.name)
+	}
+
+	// no notification on failed writes
+	ops = nil
+	err := etcdKV.MultiSaveAndRemove(map[string]string{"hook/1": "v1"}, []string{"hook/2"}, predicates.ValueEqual("hook/missing", "v"))
+	s.Error(err)
+	err = etcdKV.MultiSaveAndRemoveWithPrefix(map[string]string{"hook/1": "v1"}, []string{"hook/2"}, predicates.ValueEqual("hook/missing", "v"))
+	s.Error(err)
+	swapped, err := etcdKV.CompareVersionAndSwap("hook/1", 5, "v1")
+	s.NoError(err)
+	s.False(swapped)
+	s.Empty(ops)
+}
+
+func (s *EtcdKVSuite) TestAsyncRemoveWithPrefix() {
+	etcdKV := s.etcdKV
+
+	chunkSize, interval := kv.DeletionChunkSize, kv.DeletionChunkInterval
+	kv.DeletionChunkSize = 10
+	defer func() {
+		kv.DeletionChunkSize, kv.DeletionChunkInterval = chunkSize, interval
+	}()
+
+	prepare := func() {
+		kvs := make(map[string]string)
+		for i := 0; i < 35; i++ {
+			kvs[fmt.Sprintf("coll/%03d", i)] = "v"
+		}
+		kvs["other"] = "v"
+		s.Require().NoError(etcdKV.MultiSave(kvs))
+	}
+	hasJournal := func() bool {
+		has, err := etcdKV.HasPrefix(kv.DeletionJournalPrefix)
+		s.Require().NoError(err)
+		return has
+	}
+
+	// complete
+	prepare()
+	kv.DeletionChunkInterval = time.Millisecond
+	job, err := etcdKV.AsyncRemoveWithPrefix("coll")
+	s.Require().NoError(err)
+	<-job.Done()
+	s.NoError(job.Err())
+	deleted, total := job.Progress()
+	s.EqualValues(35, deleted)
+	s.EqualValues(35, total)
+	has, err := etcdKV.HasPrefix("coll")
+	s.NoError(err)
+	s.False(has)
+	has, err = etcdKV.Has("other")
+	s.NoError(err)
+	s.True(has)
+	s.False(hasJournal())
+
+	// cancel, the keys of each chunk are told to the hooks once it's removed
+	prepare()
+	hookedKV := NewEtcdKV(s.etcdCli, s.rootPath)
+	var mu sync.Mutex
+	var ops []kv.WriteOp
+	hookedKV.RegisterWriteHook("coll/", func(op kv.WriteOp) {
+		mu.Lock()
+		defer mu.Unlock()
+		ops = append(ops, op)
+	})
+	kv.DeletionChunkInterval = time.Hour
+	job, err = hookedKV.AsyncRemoveWithPrefix("coll")
+	s.Require().NoError(err)
+	s.Eventually(func() bool {
+		deleted, _ := job.Progress()
+		return deleted > 0
+	}, 10*time.Second, 10*time.Millisecond)
+	job.Cancel()
+	<-job.Done()
+	s.ErrorIs(job.Err(), context.Canceled)
+	keys, _, err := etcdKV.LoadWithPrefix("coll")
+	s.NoError(err)
+	s.Len(keys, 25)
+	s.False(hasJournal())
+	removed := make([]string, 0, 10)
+	for i := 0; i < 10; i++ {
+		removed = append(removed, fmt.Sprintf("coll/%03d", i))
+	}
+	mu.Lock()
+	s.Equal([]kv.WriteOp{{Type: kv.WriteOpRemove, Keys: removed}}, ops)
+	mu.Unlock()
+
+	// resume a job interrupted before finishing
+	kv.DeletionChunkInterval = time.Millisecond
+	err = etcdKV.Save(path.Join(kv.DeletionJournalPrefix, "coll"), "coll")
+	s.Require().NoError(err)
+	restarted := NewEtcdKV(s.etcdCli, s.rootPath)
+	jobs, err := restarted.ResumeDeletionJobs()
+	s.Require().NoError(err)
+	s.Require().Len(jobs, 1)
+	s.Equal("coll", jobs[0].Prefix())
+	<-jobs[0].Done()
+	s.NoError(jobs[0].Err())
+	has, err = etcdKV.HasPrefix("coll")
+	s.NoError(err)
+	s.False(has)
+	s.False(hasJournal())
+}
+
 func (s *EtcdKVSuite) TestWatch() {
 	etcdKV := s.etcdKV
 
@@ -659,6 +962,81 @@ func (s *EtcdKVSuite) TestWatch() {
 	s.True(resp.Created)
 }
 
+func (s *EtcdKVSuite) TestExoticRootPaths() {
+	base := path.Join("unittest/etcdkv-ns", funcutil.RandomString(8))
+	rootPaths := []string{
+		base + "/",
+		"/" + base,
+		"/" + base + "/",
+		strings.Replace(base, "/", "//", 1),
+		"./" + base,
+	}
+	for _, rootPath := range rootPaths {
+		s.Run(rootPath, func() {
+			etcdKV := NewEtcdKV(s.etcdCli, rootPath)
+			defer etcdKV.RemoveWithPrefix("")
+			s.Require().NoError(etcdKV.Save("a", "1"))
+			s.Require().NoError(etcdKV.MultiSave(map[string]string{"a/b": "2", "/c/": "3"}))
+
+			// the keys are saved at the same full paths as before
+			for key, value := range map[string]string{"a": "1", "a/b": "2", "c": "3"} {
+				resp, err := s.etcdCli.Get(context.TODO(), path.Join(rootPath, key))
+				s.Require().NoError(err)
+				s.Require().Len(resp.Kvs, 1)
+				s.Equal(value, string(resp.Kvs[0].Value))
+			}
+
+			keys, values, err := etcdKV.LoadWithPrefix("a")
+			s.NoError(err)
+			s.Equal([]string{etcdKV.GetPath("a"), etcdKV.GetPath("a/b")}, keys)
+			s.Equal([]string{"1", "2"}, values)
+
+			var walked []string
+			err = etcdKV.WalkWithPrefix("", 1, func(key []byte, value []byte) error {
+				walked = append(walked, string(key))
+				return nil
+			})
+			s.NoError(err)
+			s.Equal([]string{etcdKV.GetPath("a"), etcdKV.GetPath("a/b"), etcdKV.GetPath("c")}, walked)
+
+			value, err := etcdKV.Load("c/")
+			s.NoError(err)
+			s.Equal("3", value)
+			_, err = etcdKV.Load("a/b/c")
+			s.ErrorContains(err, etcdKV.GetPath("a/b/c"))
+
+			_, _, revision, err := etcdKV.LoadBytesWithRevision("a")
+			s.NoError(err)
+			ch := etcdKV.WatchWithRevision("a", revision+1)
+			s.NoError(etcdKV.Remove("a/b"))
+			resp := <-ch
+			s.Require().Len(resp.Events, 1)
+			s.Equal(etcdKV.GetPath("a/b"), string(resp.Events[0].Kv.Key))
+			s.Equal(etcdKV.GetPath("a/b"), string(resp.Events[0].PrevKv.Key))
+
+			s.NoError(etcdKV.RemoveWithPrefix(""))
+			has, err := etcdKV.HasPrefix("")
+			s.NoError(err)
+			s.False(has)
+		})
+	}
+}
+
+func (s *EtcdKVSuite) TestNamespacedLease() {
+	etcdKV := NewEtcdKV(s.etcdCli, s.rootPath)
+	defer etcdKV.RemoveWithPrefix("")
+
+	grant, err := s.etcdCli.Grant(context.TODO(), 60)
+	s.Require().NoError(err)
+	defer s.etcdCli.Revoke(context.TODO(), grant.ID)
+	s.Require().NoError(etcdKV.SaveBytesWithLease("leased", []byte("1"), grant.ID))
+
+	// the keys attached to the lease are returned within the namespace of the kv
+	resp, err := etcdKV.lease.TimeToLive(context.TODO(), grant.ID, clientv3.WithAttachedKeys())
+	s.Require().NoError(err)
+	s.Equal([][]byte{[]byte("/leased")}, resp.Keys)
+}
+
 func (s *EtcdKVSuite) TestRevisionBytes() {
 	etcdKV := s.etcdKV
 
@@ -701,6 +1079,114 @@ func (s *EtcdKVSuite) TestRevisionBytes() {
 	s.False(success)
 }
 
+func (s *EtcdKVSuite) TestPrefixLabel() {
+	metrics.MetaKvSize.Reset()
+	metrics.MetaRequestLatency.Reset()
+
+	s.Require().NoError(s.etcdKV.Save("meta/datacoord-meta/s/100/101/1", "segment"))
+	_, err := s.etcdKV.Load("meta/session/querynode-1")
+	s.Error(err)
+	s.Require().NoError(s.etcdKV.MultiSave(map[string]string{
+		"meta/datacoord-meta/s/100/101/2":       "segment",
+		"meta/root-coord/credential/users/root": "user",
+	}))
+
+	s.True(metrics.MetaKvSize.DeleteLabelValues(metrics.MetaPutLabel, kv.PrefixLabelSegment))
+	s.True(metrics.MetaRequestLatency.DeleteLabelValues(metrics.MetaPutLabel, kv.PrefixLabelSegment))
+	s.True(metrics.MetaRequestLatency.DeleteLabelValues(metrics.MetaGetLabel, kv.PrefixLabelSession))
+	s.True(metrics.MetaRequestLatency.DeleteLabelValues(metrics.MetaTxnLabel, kv.PrefixLabelMixed))
+}
+
+func (s *EtcdKVSuite) TestOpError() {
+	_, err := s.etcdKV.Load("missing")
+	var opErr *kv.OpError
+	s.Require().True(errors.As(err, &opErr))
+	s.Equal("Load", opErr.Op)
+	s.Equal("missing", opErr.Key)
+	s.Equal(1, opErr.KeyCount)
+	s.Equal(s.rootPath, opErr.RootPath)
+	s.True(common.IsKeyNotExistError(err))
+	s.ErrorContains(err, s.etcdKV.GetPath("missing"))
+
+	s.Require().NoError(s.etcdKV.Save("lease1", "1"))
+	err = s.etcdKV.MultiSaveAndRemove(map[string]string{"a": "b"}, []string{"c"}, predicates.ValueEqual("lease1", "2"))
+	s.Require().True(errors.As(err, &opErr))
+	s.Equal("MultiSaveAndRemove", opErr.Op)
+	s.Empty(opErr.Key)
+	s.Equal(2, opErr.KeyCount)
+	s.ErrorIs(err, merr.ErrIoFailed)
+
+	// the errors of the callback are kept in the chain
+	errStop := errors.New("stop")
+	err = s.etcdKV.WalkWithPrefix("lease", 1, func([]byte, []byte) error { return errStop })
+	s.Require().True(errors.As(err, &opErr))
+	s.Equal("WalkWithPrefix", opErr.Op)
+	s.Equal("lease", opErr.Key)
+	s.ErrorIs(err, errStop)
+}
+
+func (s *EtcdKVSuite) TestGetStorageStatus() {
+	ctx := context.Background()
+
+	status, err := s.etcdKV.GetStorageStatus(ctx)
+	s.Require().NoError(err)
+	s.Greater(status.DBSize, int64(0))
+	s.Equal(Params.EtcdCfg.QuotaBackendBytes.GetAsInt64(), status.Quota)
+
+	// stub the maintenance api of a 3 members cluster
+	endpoints := []string{"127.0.0.1:12379", "127.0.0.1:22379", "127.0.0.1:32379"}
+	cli, err := clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: time.Second})
+	s.Require().NoError(err)
+	defer cli.Close()
+	etcdKV := NewEtcdKV(cli, s.rootPath)
+
+	dbSizes := map[string]int64{endpoints[0]: 100, endpoints[1]: 850, endpoints[2]: 300}
+	var alarms []*etcdserverpb.AlarmMember
+	originGetEndpointStatus, originListAlarms := getEndpointStatus, listAlarms
+	defer func() {
+		getEndpointStatus, listAlarms = originGetEndpointStatus, originListAlarms
+	}()
+	getEndpointStatus = func(ctx context.Context, cli *clientv3.Client, endpoint string) (*clientv3.StatusResponse, error) {
+		return &clientv3.StatusResponse{DbSize: dbSizes[endpoint], DbSizeInUse: dbSizes[endpoint] / 2}, nil
+	}
+	listAlarms = func(ctx context.Context, cli *clientv3.Client) (*clientv3.AlarmResponse, error) {
+		return &clientv3.AlarmResponse{Alarms: alarms}, nil
+	}
+
+	Params.Save(Params.EtcdCfg.QuotaBackendBytes.Key, "1000")
+	defer Params.Reset(Params.EtcdCfg.QuotaBackendBytes.Key)
+
+	// the worst member is reported
+	status, err = etcdKV.GetStorageStatus(ctx)
+	s.Require().NoError(err)
+	s.Equal(StorageWarning, status.State)
+	s.Equal(endpoints[1], status.Endpoint)
+	s.EqualValues(850, status.DBSize)
+	s.EqualValues(425, status.DBSizeInUse)
+	s.InDelta(0.15, status.Headroom, 1e-9)
+	s.InDelta(0.15, testutil.ToFloat64(metrics.MetaStorageHeadroomRatio), 1e-9)
+
+	Params.Save(Params.EtcdCfg.StorageWarnHeadroomRatio.Key, "0.1")
+	defer Params.Reset(Params.EtcdCfg.StorageWarnHeadroomRatio.Key)
+	status, err = etcdKV.GetStorageStatus(ctx)
+	s.Require().NoError(err)
+	s.Equal(StorageHealthy, status.State)
+	s.Empty(status.Alarms)
+
+	// alarms win over headroom
+	alarms = []*etcdserverpb.AlarmMember{{MemberID: 0x1234, Alarm: etcdserverpb.AlarmType_NOSPACE}}
+	status, err = etcdKV.GetStorageStatus(ctx)
+	s.Require().NoError(err)
+	s.Equal(StorageAlarm, status.State)
+	s.Equal([]string{"NOSPACE on member 1234"}, status.Alarms)
+
+	getEndpointStatus = func(ctx context.Context, cli *clientv3.Client, endpoint string) (*clientv3.StatusResponse, error) {
+		return nil, errors.New("mock status error")
+	}
+	_, err = etcdKV.GetStorageStatus(ctx)
+	s.Error(err)
+}
+
 func TestEtcdKV(t *testing.T) {
 	suite.Run(t, new(EtcdKVSuite))
 }
@@ -0,0 +1,109 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdkv
+
+import (
+	"path"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/namespace"
+)
+
+// namespaceOf returns the etcd namespace scoping the keys under rootPath, it is the cleaned
+// root path so that namespace+nsKey(key) equals path.Join(rootPath, key).
+// Empty and "." root paths are not scoped at all.
+func namespaceOf(rootPath string) string {
+	ns := path.Clean(rootPath)
+	if ns == "." {
+		return ""
+	}
+	return ns
+}
+
+// namespacedClient returns the KV, Watcher and Lease interfaces of client scoped to ns.
+func namespacedClient(client *clientv3.Client, ns string) (clientv3.KV, clientv3.Watcher, clientv3.Lease) {
+	if ns == "" {
+		return client.KV, client.Watcher, client.Lease
+	}
+	return namespace.NewKV(client.KV, ns), namespace.NewWatcher(client.Watcher, ns), namespace.NewLease(client.Lease, ns)
+}
+
+// nsKey returns the key within the namespace of kv for key relative to the root path.
+// Keys are cleaned like path.Join does, except that they could not escape the root path by "..".
+// The root path itself is the empty key, which is only valid as a prefix.
+func (kv *etcdKV) nsKey(key string) string {
+	if kv.namespace == "" {
+		return path.Join(kv.rootPath, key)
+	}
+	rel := path.Join("/", key)
+	switch {
+	case rel == "/":
+		return ""
+	case kv.namespace == "/":
+		return rel[1:]
+	default:
+		return rel
+	}
+}
+
+// nsPrefix returns the start key of a range scan over the keys with prefix, relative to the root path.
+// Unlike clientv3.WithPrefix, ranges built by clientv3.WithRange do not accept an empty start key.
+func (kv *etcdKV) nsPrefix(prefix string) string {
+	key := kv.nsKey(prefix)
+	if key == "" {
+		return "\x00"
+	}
+	return key
+}
+
+// fullKey translates a key returned by the namespaced client back to the full path,
+// which is the format the etcd kv always returns.
+func (kv *etcdKV) fullKey(key []byte) string {
+	return kv.namespace + string(key)
+}
+
+// relativeKey translates a key returned by the namespaced client to the key relative to the root path.
+func (kv *etcdKV) relativeKey(key []byte) string {
+	if kv.namespace == "" {
+		return string(key)
+	}
+	return strings.TrimPrefix(string(key), "/")
+}
+
+// fullPathWatchChan translates the keys of the events watched by the namespaced watcher back to full paths.
+func (kv *etcdKV) fullPathWatchChan(rch clientv3.WatchChan) clientv3.WatchChan {
+	if kv.namespace == "" {
+		return rch
+	}
+	ch := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(ch)
+		for resp := range rch {
+			for _, ev := range resp.Events {
+				if ev.Kv != nil {
+					ev.Kv.Key = []byte(kv.fullKey(ev.Kv.Key))
+				}
+				if ev.PrevKv != nil {
+					ev.PrevKv.Key = []byte(kv.fullKey(ev.PrevKv.Key))
+				}
+			}
+			ch <- resp
+		}
+	}()
+	return ch
+}
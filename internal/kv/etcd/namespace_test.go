@@ -0,0 +1,42 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdkv
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceKey(t *testing.T) {
+	rootPaths := []string{"", ".", "/", "a", "a/b", "a/b/", "/a/b", "a//b", "./a/b", "../a"}
+	keys := []string{"", "/", ".", "c", "c/", "/c", "c//d", "./c", "c/./d", "c/../d"}
+	for _, rootPath := range rootPaths {
+		kv := &etcdKV{rootPath: rootPath, namespace: namespaceOf(rootPath)}
+		for _, key := range keys {
+			assert.Equal(t, path.Join(rootPath, key), kv.namespace+kv.nsKey(key), "rootPath %q, key %q", rootPath, key)
+			assert.Equal(t, kv.GetPath(key), kv.fullKey([]byte(kv.nsKey(key))), "rootPath %q, key %q", rootPath, key)
+		}
+	}
+
+	// keys could not escape the root path
+	kv := &etcdKV{rootPath: "a/b", namespace: namespaceOf("a/b")}
+	assert.Equal(t, "/c", kv.nsKey("../c"))
+	assert.Equal(t, "\x00", kv.nsPrefix(""))
+	assert.Equal(t, "/c", kv.nsPrefix("c"))
+}
@@ -0,0 +1,115 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdkv
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/milvus-io/milvus/internal/kv"
+)
+
+var deletionJournalPrefix = kv.DeletionJournalPrefix
+
+// prefixDeleter removes the keys with prefix in chunks for a kv.DeletionJob.
+type prefixDeleter struct {
+	store  *etcdKV
+	prefix string
+	// nsPrefix is the prefix within the namespace of store
+	nsPrefix string
+	// journalRoot is the prefix of journal keys within the namespace, which are never removed by chunks
+	journalRoot string
+}
+
+var _ kv.DeletionExecutor = (*prefixDeleter)(nil)
+
+func newPrefixDeleter(store *etcdKV, prefix string) *prefixDeleter {
+	return &prefixDeleter{
+		store:       store,
+		prefix:      prefix,
+		nsPrefix:    store.nsKey(prefix),
+		journalRoot: store.nsKey(deletionJournalPrefix),
+	}
+}
+
+// journalKey returns the journal key relative to root path.
+func (d *prefixDeleter) journalKey() string {
+	return path.Join(deletionJournalPrefix, d.prefix)
+}
+
+func (d *prefixDeleter) isJournal(key string) bool {
+	return key == d.journalRoot || strings.HasPrefix(key, d.journalRoot+"/")
+}
+
+func (d *prefixDeleter) Count(ctx context.Context) (int64, error) {
+	resp, err := d.store.getEtcdMeta(ctx, d.nsPrefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+func (d *prefixDeleter) DeleteChunk(ctx context.Context, cursor string) (int, string, bool, error) {
+	startKey := d.store.nsPrefix(d.prefix)
+	if cursor != "" {
+		startKey = cursor
+	}
+	resp, err := d.store.getEtcdMeta(ctx, startKey,
+		clientv3.WithRange(clientv3.GetPrefixRangeEnd(d.nsPrefix)),
+		clientv3.WithKeysOnly(),
+		clientv3.WithLimit(int64(kv.DeletionChunkSize)),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return 0, cursor, false, err
+	}
+
+	ops := make([]clientv3.Op, 0, len(resp.Kvs))
+	removed := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		// next chunk starts right after the last scanned key
+		cursor = string(kv.Key) + "\x00"
+		if !d.isJournal(string(kv.Key)) {
+			ops = append(ops, clientv3.OpDelete(string(kv.Key)))
+			removed = append(removed, d.store.relativeKey(kv.Key))
+		}
+	}
+	finished := !resp.More
+	if len(ops) == 0 {
+		return 0, cursor, finished, nil
+	}
+	if _, err := d.store.executeTxn(d.store.getTxnWithCmp(ctx), ops...); err != nil {
+		return 0, cursor, false, err
+	}
+	// the removed keys are told chunk by chunk, as the job may never complete
+	d.store.hooks.NotifyRemove(removed...)
+	return len(ops), cursor, finished, nil
+}
+
+func (d *prefixDeleter) Finish(completed bool) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
+	defer cancel()
+	if _, err := d.store.removeEtcdMeta(ctx, d.store.nsKey(d.journalKey())); err != nil {
+		return err
+	}
+	if completed {
+		d.store.hooks.NotifyRemoveWithPrefix(d.prefix)
+	}
+	return nil
+}
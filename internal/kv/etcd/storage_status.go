@@ -0,0 +1,122 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdkv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/log"
+	"github.com/milvus-io/milvus/pkg/metrics"
+	"github.com/milvus-io/milvus/pkg/util/paramtable"
+)
+
+// StorageState is the state of etcd backend storage.
+type StorageState string
+
+const (
+	StorageHealthy StorageState = "healthy"
+	// StorageWarning means the headroom of backend quota is lower than etcd.storageWarnHeadroomRatio.
+	StorageWarning StorageState = "warning"
+	// StorageAlarm means an alarm is active, e.g. NOSPACE, writes are likely rejected.
+	StorageAlarm StorageState = "alarm"
+)
+
+// StorageStatus is the backend storage status of the fullest etcd member.
+type StorageStatus struct {
+	State       StorageState
+	Endpoint    string
+	DBSize      int64
+	DBSizeInUse int64
+	Quota       int64
+	// Headroom is the free ratio of the quota, 1 - DBSize/Quota
+	Headroom float64
+	// Alarms are the active alarms of all members, e.g. "NOSPACE on member 8e9e05c52164694d"
+	Alarms []string
+}
+
+var (
+	getEndpointStatus = func(ctx context.Context, cli *clientv3.Client, endpoint string) (*clientv3.StatusResponse, error) {
+		return cli.Status(ctx, endpoint)
+	}
+	listAlarms = func(ctx context.Context, cli *clientv3.Client) (*clientv3.AlarmResponse, error) {
+		return cli.AlarmList(ctx)
+	}
+)
+
+// GetStorageStatus checks the db size of each endpoint against etcd.quotaBackendBytes,
+// and returns the status of the member with the least headroom, together with the active alarms.
+func (kv *etcdKV) GetStorageStatus(ctx context.Context) (*StorageStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	params := paramtable.Get()
+	quota := params.EtcdCfg.QuotaBackendBytes.GetAsInt64()
+	warnRatio := params.EtcdCfg.StorageWarnHeadroomRatio.GetAsFloat()
+	if quota <= 0 {
+		return nil, fmt.Errorf("invalid etcd backend quota %d", quota)
+	}
+
+	var worst *StorageStatus
+	for _, endpoint := range kv.client.Endpoints() {
+		resp, err := getEndpointStatus(ctx, kv.client, endpoint)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get status of etcd endpoint %s", endpoint)
+		}
+		status := &StorageStatus{
+			Endpoint:    endpoint,
+			DBSize:      resp.DbSize,
+			DBSizeInUse: resp.DbSizeInUse,
+			Quota:       quota,
+			Headroom:    1 - float64(resp.DbSize)/float64(quota),
+		}
+		if worst == nil || status.Headroom < worst.Headroom {
+			worst = status
+		}
+	}
+	if worst == nil {
+		return nil, errors.New("no etcd endpoint")
+	}
+
+	alarms, err := listAlarms(ctx, kv.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd alarms")
+	}
+	for _, alarm := range alarms.Alarms {
+		worst.Alarms = append(worst.Alarms, fmt.Sprintf("%s on member %x", alarm.GetAlarm().String(), alarm.GetMemberID()))
+	}
+
+	switch {
+	case len(worst.Alarms) > 0:
+		worst.State = StorageAlarm
+	case worst.Headroom < warnRatio:
+		worst.State = StorageWarning
+	default:
+		worst.State = StorageHealthy
+	}
+	metrics.MetaStorageHeadroomRatio.Set(worst.Headroom)
+	if worst.State != StorageHealthy {
+		log.Warn("etcd storage is not healthy", zap.String("state", string(worst.State)), zap.String("endpoint", worst.Endpoint),
+			zap.Int64("dbSize", worst.DBSize), zap.Int64("dbSizeInUse", worst.DBSizeInUse), zap.Int64("quota", quota),
+			zap.Float64("headroom", worst.Headroom), zap.Strings("alarms", worst.Alarms))
+	}
+	return worst, nil
+}
@@ -1,16 +1,22 @@
 package etcdkv
 
 import (
+	"context"
 	"fmt"
-	"path"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
 
+	"github.com/milvus-io/milvus/internal/kv"
 	"github.com/milvus-io/milvus/internal/kv/predicates"
 	"github.com/milvus-io/milvus/pkg/util/merr"
 )
 
-func parsePredicates(rootPath string, preds ...predicates.Predicate) ([]clientv3.Cmp, error) {
+// parsePredicates converts preds to etcd comparisons, keyOf maps the predicate keys to the etcd keys.
+// Comparisons of etcd can't express set membership nor compare numbers, so the keys of PredTypeIn and
+// of the numeric predicates are read through kvClient first: the predicate fails right away if it's
+// false on the value or the key doesn't exist, otherwise the comparison is on the mod revision read,
+// so the transaction fails if the key is changed after the read.
+func parsePredicates(kvClient clientv3.KV, keyOf func(key string) string, preds ...predicates.Predicate) ([]clientv3.Cmp, error) {
 	if len(preds) == 0 {
 		return []clientv3.Cmp{}, nil
 	}
@@ -18,12 +24,32 @@ func parsePredicates(rootPath string, preds ...predicates.Predicate) ([]clientv3
 	for _, pred := range preds {
 		switch pred.Target() {
 		case predicates.PredTargetValue:
+			if isReadPredicate(pred.Type()) {
+				cmp, err := parseReadPredicate(kvClient, keyOf, pred)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, cmp)
+				continue
+			}
 			pt, err := parsePredicateType(pred.Type())
 			if err != nil {
 				return nil, err
 			}
-			cmp := clientv3.Compare(clientv3.Value(path.Join(rootPath, pred.Key())), pt, pred.TargetValue())
+			cmp := clientv3.Compare(clientv3.Value(keyOf(pred.Key())), pt, pred.TargetValue())
 			result = append(result, cmp)
+		case predicates.PredTargetKey:
+			// a key exists while its create revision is positive
+			var op string
+			switch pred.Type() {
+			case predicates.PredTypeExists:
+				op = ">"
+			case predicates.PredTypeNotExists:
+				op = "="
+			default:
+				return nil, merr.WrapErrParameterInvalid("valid key predicate type", fmt.Sprintf("%d", pred.Type()))
+			}
+			result = append(result, clientv3.Compare(clientv3.CreateRevision(keyOf(pred.Key())), op, 0))
 		default:
 			return nil, merr.WrapErrParameterInvalid("valid predicate target", fmt.Sprintf("%d", pred.Target()))
 		}
@@ -31,11 +57,55 @@ func parsePredicates(rootPath string, preds ...predicates.Predicate) ([]clientv3
 	return result, nil
 }
 
+// isReadPredicate returns if the predicates of pt are checked on the value read, see parsePredicates.
+func isReadPredicate(pt predicates.PredicateType) bool {
+	switch pt {
+	case predicates.PredTypeIn, predicates.PredTypeNumericGreater, predicates.PredTypeNumericLess:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseReadPredicate reads the key of the predicate, and returns the comparison on its mod revision
+// if the predicate is true, see isReadPredicate.
+func parseReadPredicate(kvClient clientv3.KV, keyOf func(key string) string, pred predicates.Predicate) (clientv3.Cmp, error) {
+	key := keyOf(pred.Key())
+	ctx, cancel := context.WithTimeout(context.TODO(), RequestTimeout)
+	defer cancel()
+	resp, err := kvClient.Get(ctx, key)
+	if err != nil {
+		return clientv3.Cmp{}, err
+	}
+	if len(resp.Kvs) == 0 {
+		return clientv3.Cmp{}, predicateFailure(pred, nil)
+	}
+	if !pred.IsTrue(resp.Kvs[0].Value) {
+		actual := string(resp.Kvs[0].Value)
+		return clientv3.Cmp{}, predicateFailure(pred, &actual)
+	}
+	return clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision), nil
+}
+
+// predicateFailure is the error of pred failing on the actual value, nil if the key doesn't exist.
+func predicateFailure(pred predicates.Predicate, actual *string) error {
+	value := "<missing>"
+	if actual != nil {
+		value = kv.RedactValue(pred.Key(), *actual)
+	}
+	return merr.WrapErrIoFailedReason("failed to meet predicate", fmt.Sprintf("key=%s, candidates=%v, actual=%s",
+		pred.Key(), pred.TargetValue(), value))
+}
+
 // parsePredicateType parse predicates.PredicateType to clientv3.Result
 func parsePredicateType(pt predicates.PredicateType) (string, error) {
 	switch pt {
 	case predicates.PredTypeEqual:
 		return "=", nil
+	case predicates.PredTypeGreater:
+		return ">", nil
+	case predicates.PredTypeLess:
+		return "<", nil
 	default:
 		return "", merr.WrapErrParameterInvalid("valid predicate type", fmt.Sprintf("%d", pt))
 	}
@@ -22,6 +22,9 @@ func (s *EtcdKVUtilSuite) TestParsePredicateType() {
 
 	cases := []testCase{
 		{tag: "equal", pt: predicates.PredTypeEqual, expectResult: "=", expectSucceed: true},
+		{tag: "greater", pt: predicates.PredTypeGreater, expectResult: ">", expectSucceed: true},
+		{tag: "less", pt: predicates.PredTypeLess, expectResult: "<", expectSucceed: true},
+		{tag: "numeric_greater", pt: predicates.PredTypeNumericGreater, expectResult: "", expectSucceed: false},
 		{tag: "zero_value", pt: 0, expectResult: "", expectSucceed: false},
 	}
 
@@ -50,13 +53,15 @@ func (s *EtcdKVUtilSuite) TestParsePredicates() {
 
 	cases := []testCase{
 		{tag: "normal_value_equal", input: []predicates.Predicate{predicates.ValueEqual("a", "b")}, expectSucceed: true},
+		{tag: "value_greater_and_less", input: []predicates.Predicate{predicates.ValueGreater("a", "b"), predicates.ValueLess("a", "c")}, expectSucceed: true},
+		{tag: "key_exists_and_not_exists", input: []predicates.Predicate{predicates.KeyExists("a"), predicates.KeyNotExists("b")}, expectSucceed: true},
 		{tag: "empty_input", input: nil, expectSucceed: true},
 		{tag: "bad_predicates", input: []predicates.Predicate{badPredicate}, expectSucceed: false},
 	}
 
 	for _, tc := range cases {
 		s.Run(tc.tag, func() {
-			result, err := parsePredicates("", tc.input...)
+			result, err := parsePredicates(nil, func(key string) string { return key }, tc.input...)
 			if tc.expectSucceed {
 				s.NoError(err)
 				s.Equal(len(tc.input), len(result))
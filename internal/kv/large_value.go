@@ -0,0 +1,172 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/milvus-io/milvus/pkg/metrics"
+)
+
+// operations reported by LargeValue
+const (
+	LargeValueOpLoad = "load"
+	LargeValueOpSave = "save"
+	LargeValueOpScan = "scan"
+)
+
+const (
+	defaultLargeValueTopK    = 10
+	defaultLargeValueMinSize = 64 * 1024
+)
+
+// LargeValue is a large value observed by the kv instrumentation, the value itself is not kept.
+type LargeValue struct {
+	Key  string
+	Size int
+	Op   string
+	Time time.Time
+}
+
+// LargeValueSampler keeps the top K largest values observed, one entry per key.
+// Values smaller than the min size are ignored.
+type LargeValueSampler struct {
+	mu      sync.Mutex
+	k       int
+	minSize int
+	// values are sorted by size in descending order
+	values []LargeValue
+}
+
+func NewLargeValueSampler(k, minSize int) *LargeValueSampler {
+	return &LargeValueSampler{k: k, minSize: minSize}
+}
+
+// SetLimits updates K and the min size, values no longer qualified are evicted.
+func (s *LargeValueSampler) SetLimits(k, minSize int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.k = k
+	s.minSize = minSize
+	n := 0
+	for _, value := range s.values {
+		if n < k && value.Size >= minSize {
+			s.values[n] = value
+			n++
+		}
+	}
+	s.values = s.values[:n]
+}
+
+// Observe records that a value of size is loaded, saved or scanned at key,
+// the previous entry of key is replaced.
+func (s *LargeValueSampler) Observe(key string, size int, op string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, value := range s.values {
+		if value.Key == key {
+			s.values = append(s.values[:i], s.values[i+1:]...)
+			break
+		}
+	}
+	if size < s.minSize {
+		return
+	}
+	s.insert(key, size, op)
+}
+
+// ObserveBytes is Observe with the key in bytes, the key is only copied if the value is kept.
+func (s *LargeValueSampler) ObserveBytes(key []byte, size int, op string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, value := range s.values {
+		if value.Key == string(key) {
+			s.values = append(s.values[:i], s.values[i+1:]...)
+			break
+		}
+	}
+	if size < s.minSize {
+		return
+	}
+	s.insert(string(key), size, op)
+}
+
+func (s *LargeValueSampler) insert(key string, size int, op string) {
+	i := sort.Search(len(s.values), func(i int) bool { return s.values[i].Size < size })
+	if i >= s.k {
+		return
+	}
+	s.values = append(s.values, LargeValue{})
+	copy(s.values[i+1:], s.values[i:])
+	s.values[i] = LargeValue{Key: key, Size: size, Op: op, Time: time.Now()}
+	if len(s.values) > s.k {
+		s.values = s.values[:s.k]
+	}
+}
+
+// Report returns the values kept, largest first.
+func (s *LargeValueSampler) Report() []LargeValue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := make([]LargeValue, len(s.values))
+	copy(report, s.values)
+	return report
+}
+
+func (s *LargeValueSampler) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = nil
+}
+
+// MaxSize returns the size of the largest value kept, 0 if there is none.
+func (s *LargeValueSampler) MaxSize() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.values) == 0 {
+		return 0
+	}
+	return s.values[0].Size
+}
+
+var largeValues = NewLargeValueSampler(defaultLargeValueTopK, defaultLargeValueMinSize)
+
+// ObserveValueSize records the size of a value flowing through the kv,
+// the largest ones are reported by GetLargeValueReport.
+func ObserveValueSize(key string, size int, op string) {
+	largeValues.Observe(key, size, op)
+	metrics.MetaLargestValueSize.Set(float64(largeValues.MaxSize()))
+}
+
+// ObserveValueSizeBytes is ObserveValueSize with the key in bytes, which is not copied for small values.
+func ObserveValueSizeBytes(key []byte, size int, op string) {
+	largeValues.ObserveBytes(key, size, op)
+	metrics.MetaLargestValueSize.Set(float64(largeValues.MaxSize()))
+}
+
+// GetLargeValueReport returns the largest values observed, largest first.
+func GetLargeValueReport() []LargeValue {
+	return largeValues.Report()
+}
+
+// SetLargeValueSampling sets the number of largest values reported and the min size to report.
+func SetLargeValueSampling(k, minSize int) {
+	largeValues.SetLimits(k, minSize)
+	metrics.MetaLargestValueSize.Set(float64(largeValues.MaxSize()))
+}
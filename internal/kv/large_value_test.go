@@ -0,0 +1,124 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/milvus-io/milvus/pkg/metrics"
+)
+
+func TestLargeValueSampler(t *testing.T) {
+	keysOf := func(values []LargeValue) []string {
+		keys := make([]string, 0, len(values))
+		for _, value := range values {
+			keys = append(keys, value.Key)
+		}
+		return keys
+	}
+
+	t.Run("top k", func(t *testing.T) {
+		sampler := NewLargeValueSampler(3, 100)
+		sampler.Observe("small", 99, LargeValueOpSave)
+		sampler.Observe("a", 200, LargeValueOpSave)
+		sampler.Observe("b", 500, LargeValueOpLoad)
+		sampler.Observe("c", 100, LargeValueOpScan)
+		assert.Equal(t, []string{"b", "a", "c"}, keysOf(sampler.Report()))
+
+		// the smallest one is evicted
+		sampler.Observe("d", 300, LargeValueOpSave)
+		assert.Equal(t, []string{"b", "d", "a"}, keysOf(sampler.Report()))
+		// too small to enter
+		sampler.Observe("e", 150, LargeValueOpSave)
+		assert.Equal(t, []string{"b", "d", "a"}, keysOf(sampler.Report()))
+
+		report := sampler.Report()
+		assert.Equal(t, 500, report[0].Size)
+		assert.Equal(t, LargeValueOpLoad, report[0].Op)
+		assert.False(t, report[0].Time.IsZero())
+		assert.Equal(t, 500, sampler.MaxSize())
+	})
+
+	t.Run("one entry per key", func(t *testing.T) {
+		sampler := NewLargeValueSampler(3, 100)
+		sampler.Observe("a", 200, LargeValueOpSave)
+		sampler.Observe("b", 300, LargeValueOpSave)
+		sampler.Observe("a", 400, LargeValueOpLoad)
+		report := sampler.Report()
+		assert.Equal(t, []string{"a", "b"}, keysOf(report))
+		assert.Equal(t, 400, report[0].Size)
+		assert.Equal(t, LargeValueOpLoad, report[0].Op)
+
+		// shrunk below the min size
+		sampler.Observe("a", 10, LargeValueOpSave)
+		assert.Equal(t, []string{"b"}, keysOf(sampler.Report()))
+	})
+
+	t.Run("bytes key", func(t *testing.T) {
+		sampler := NewLargeValueSampler(3, 100)
+		key := []byte("a")
+		sampler.Observe("a", 300, LargeValueOpLoad)
+		sampler.ObserveBytes(key, 200, LargeValueOpScan)
+		// the kept key doesn't share the buffer of the caller
+		key[0] = 'b'
+		sampler.ObserveBytes(key, 10, LargeValueOpScan)
+		report := sampler.Report()
+		assert.Equal(t, []string{"a"}, keysOf(report))
+		assert.Equal(t, 200, report[0].Size)
+		assert.Equal(t, LargeValueOpScan, report[0].Op)
+
+		sampler.ObserveBytes([]byte("a"), 10, LargeValueOpScan)
+		assert.Empty(t, sampler.Report())
+	})
+
+	t.Run("set limits", func(t *testing.T) {
+		sampler := NewLargeValueSampler(3, 100)
+		sampler.Observe("a", 200, LargeValueOpSave)
+		sampler.Observe("b", 300, LargeValueOpSave)
+		sampler.Observe("c", 400, LargeValueOpSave)
+		sampler.SetLimits(2, 250)
+		assert.Equal(t, []string{"c", "b"}, keysOf(sampler.Report()))
+		sampler.SetLimits(1, 0)
+		assert.Equal(t, []string{"c"}, keysOf(sampler.Report()))
+
+		sampler.Reset()
+		assert.Empty(t, sampler.Report())
+		assert.Equal(t, 0, sampler.MaxSize())
+	})
+
+	t.Run("default sampler", func(t *testing.T) {
+		defer largeValues.Reset()
+		defer SetLargeValueSampling(defaultLargeValueTopK, defaultLargeValueMinSize)
+
+		SetLargeValueSampling(2, 1024)
+		ObserveValueSize("meta/a", 512, LargeValueOpSave)
+		ObserveValueSize("meta/b", 4096, LargeValueOpSave)
+		ObserveValueSize("meta/c", 2048, LargeValueOpScan)
+		ObserveValueSize("meta/d", 1024, LargeValueOpLoad)
+		assert.Equal(t, []string{"meta/b", "meta/c"}, keysOf(GetLargeValueReport()))
+		assert.Equal(t, float64(4096), testutil.ToFloat64(metrics.MetaLargestValueSize))
+
+		SetLargeValueSampling(1, 3000)
+		assert.Equal(t, []string{"meta/b"}, keysOf(GetLargeValueReport()))
+		SetLargeValueSampling(1, 5000)
+		assert.Empty(t, GetLargeValueReport())
+		assert.Equal(t, float64(0), testutil.ToFloat64(metrics.MetaLargestValueSize))
+	})
+}
@@ -1,17 +1,37 @@
 package predicates
 
+import (
+	"strconv"
+
+	"golang.org/x/exp/constraints"
+)
+
 // PredicateTarget is enum for Predicate target type.
 type PredicateTarget int32
 
 const (
 	// PredTargetValue is predicate target for key-value perid
 	PredTargetValue PredicateTarget = iota + 1
+	// PredTargetKey is predicate target for the presence of a key, IsTrue takes if the key exists
+	PredTargetKey
 )
 
 type PredicateType int32
 
 const (
 	PredTypeEqual PredicateType = iota + 1
+	// PredTypeIn is true if the value is any of a set, the target value is the []string of the set
+	PredTypeIn
+	// PredTypeGreater and PredTypeLess compare the value to the target value lexicographically, byte by byte
+	PredTypeGreater
+	PredTypeLess
+	// PredTypeNumericGreater and PredTypeNumericLess compare the value to the target value as decimal
+	// int64s, a value which is not one is neither greater nor less
+	PredTypeNumericGreater
+	PredTypeNumericLess
+	// PredTypeExists and PredTypeNotExists are true if the key exists or not, they target PredTargetKey
+	PredTypeExists
+	PredTypeNotExists
 )
 
 // Predicate provides interface for kv predicate.
@@ -37,14 +57,21 @@ func (p *valuePredicate) Type() PredicateType {
 }
 
 func (p *valuePredicate) IsTrue(target any) bool {
+	var value string
 	switch v := target.(type) {
 	case string:
-		return predicateValue(p.pt, v, p.v)
+		value = v
 	case []byte:
-		return predicateValue(p.pt, string(v), p.v)
+		value = string(v)
 	default:
 		return false
 	}
+	switch p.pt {
+	case PredTypeNumericGreater, PredTypeNumericLess:
+		return predicateNumericValue(p.pt, value, p.v)
+	default:
+		return predicateValue(p.pt, value, p.v)
+	}
 }
 
 func (p *valuePredicate) Key() string {
@@ -55,15 +82,32 @@ func (p *valuePredicate) TargetValue() any {
 	return p.v
 }
 
-func predicateValue[T comparable](pt PredicateType, v1, v2 T) bool {
+func predicateValue[T constraints.Ordered](pt PredicateType, v1, v2 T) bool {
 	switch pt {
 	case PredTypeEqual:
 		return v1 == v2
+	case PredTypeGreater, PredTypeNumericGreater:
+		return v1 > v2
+	case PredTypeLess, PredTypeNumericLess:
+		return v1 < v2
 	default:
 		return false
 	}
 }
 
+// predicateNumericValue is predicateValue on v1 and v2 parsed as decimal int64s, false if either isn't one.
+func predicateNumericValue(pt PredicateType, v1, v2 string) bool {
+	n1, err := strconv.ParseInt(v1, 10, 64)
+	if err != nil {
+		return false
+	}
+	n2, err := strconv.ParseInt(v2, 10, 64)
+	if err != nil {
+		return false
+	}
+	return predicateValue(pt, n1, n2)
+}
+
 func ValueEqual(k, v string) Predicate {
 	return &valuePredicate{
 		k:  k,
@@ -71,3 +115,137 @@ func ValueEqual(k, v string) Predicate {
 		pt: PredTypeEqual,
 	}
 }
+
+// ValueGreater is true if the value of k is greater than v, compared lexicographically, e.g. "9" is
+// greater than "10": see NumericValueGreater for the numbers.
+func ValueGreater(k, v string) Predicate {
+	return &valuePredicate{
+		k:  k,
+		v:  v,
+		pt: PredTypeGreater,
+	}
+}
+
+// ValueLess is true if the value of k is less than v, compared lexicographically, see ValueGreater.
+func ValueLess(k, v string) Predicate {
+	return &valuePredicate{
+		k:  k,
+		v:  v,
+		pt: PredTypeLess,
+	}
+}
+
+// NumericValueGreater is true if the value of k, parsed as a decimal int64, is greater than v, e.g.
+// for the monotonic counters and the lease expirations. It's false if the value isn't a decimal int64.
+func NumericValueGreater(k string, v int64) Predicate {
+	return &valuePredicate{
+		k:  k,
+		v:  strconv.FormatInt(v, 10),
+		pt: PredTypeNumericGreater,
+	}
+}
+
+// NumericValueLess is true if the value of k, parsed as a decimal int64, is less than v, see
+// NumericValueGreater.
+func NumericValueLess(k string, v int64) Predicate {
+	return &valuePredicate{
+		k:  k,
+		v:  strconv.FormatInt(v, 10),
+		pt: PredTypeNumericLess,
+	}
+}
+
+type valueInPredicate struct {
+	k      string
+	values []string
+	set    map[string]struct{}
+}
+
+func (p *valueInPredicate) Target() PredicateTarget {
+	return PredTargetValue
+}
+
+func (p *valueInPredicate) Type() PredicateType {
+	return PredTypeIn
+}
+
+func (p *valueInPredicate) IsTrue(target any) bool {
+	var value string
+	switch v := target.(type) {
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return false
+	}
+	_, ok := p.set[value]
+	return ok
+}
+
+func (p *valueInPredicate) Key() string {
+	return p.k
+}
+
+func (p *valueInPredicate) TargetValue() any {
+	return p.values
+}
+
+// ValueIn is true if the value of k is any of values, a missing key is not in the set.
+func ValueIn(k string, values ...string) Predicate {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return &valueInPredicate{
+		k:      k,
+		values: values,
+		set:    set,
+	}
+}
+
+type keyPredicate struct {
+	k  string
+	pt PredicateType
+}
+
+func (p *keyPredicate) Target() PredicateTarget {
+	return PredTargetKey
+}
+
+func (p *keyPredicate) Type() PredicateType {
+	return p.pt
+}
+
+// IsTrue takes the bool of if the key exists, a key saved with an empty value exists.
+func (p *keyPredicate) IsTrue(target any) bool {
+	exists, ok := target.(bool)
+	if !ok {
+		return false
+	}
+	return exists == (p.pt == PredTypeExists)
+}
+
+func (p *keyPredicate) Key() string {
+	return p.k
+}
+
+func (p *keyPredicate) TargetValue() any {
+	return p.pt == PredTypeExists
+}
+
+// KeyExists is true if k exists, e.g. to save keys only while a lock key is held.
+func KeyExists(k string) Predicate {
+	return &keyPredicate{
+		k:  k,
+		pt: PredTypeExists,
+	}
+}
+
+// KeyNotExists is true if k doesn't exist, e.g. to create a key only once.
+func KeyNotExists(k string) Predicate {
+	return &keyPredicate{
+		k:  k,
+		pt: PredTypeNotExists,
+	}
+}
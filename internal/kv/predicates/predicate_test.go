@@ -22,10 +22,90 @@ func (s *PredicateSuite) TestValueEqual() {
 	s.False(p.IsTrue(1))
 }
 
+func (s *PredicateSuite) TestValueIn() {
+	p := ValueIn("key", "sealed", "flushing")
+	s.Equal("key", p.Key())
+	s.Equal([]string{"sealed", "flushing"}, p.TargetValue())
+	s.Equal(PredTargetValue, p.Target())
+	s.Equal(PredTypeIn, p.Type())
+	s.True(p.IsTrue("sealed"))
+	s.True(p.IsTrue([]byte("flushing")))
+	s.False(p.IsTrue("growing"))
+	s.False(p.IsTrue(""))
+	s.False(p.IsTrue(1))
+
+	// an empty set is never true
+	s.False(ValueIn("key").IsTrue(""))
+	s.True(ValueIn("key", "").IsTrue(""))
+}
+
+func (s *PredicateSuite) TestValueGreaterLess() {
+	p := ValueGreater("key", "5")
+	s.Equal("key", p.Key())
+	s.Equal("5", p.TargetValue())
+	s.Equal(PredTargetValue, p.Target())
+	s.Equal(PredTypeGreater, p.Type())
+	s.True(p.IsTrue("6"))
+	s.True(p.IsTrue([]byte("50")))
+	s.False(p.IsTrue("5"))
+	s.False(p.IsTrue("10"))
+	s.False(p.IsTrue(6))
+
+	p = ValueLess("key", "5")
+	s.Equal(PredTypeLess, p.Type())
+	s.True(p.IsTrue("10"))
+	s.True(p.IsTrue(""))
+	s.False(p.IsTrue("5"))
+	s.False(p.IsTrue([]byte("6")))
+}
+
+func (s *PredicateSuite) TestNumericValueGreaterLess() {
+	p := NumericValueGreater("key", 5)
+	s.Equal("key", p.Key())
+	s.Equal("5", p.TargetValue())
+	s.Equal(PredTargetValue, p.Target())
+	s.Equal(PredTypeNumericGreater, p.Type())
+	s.True(p.IsTrue("10"))
+	s.True(p.IsTrue([]byte("6")))
+	s.False(p.IsTrue("5"))
+	s.False(p.IsTrue("-10"))
+	s.False(p.IsTrue("ten"))
+	s.False(p.IsTrue(""))
+
+	p = NumericValueLess("key", 5)
+	s.Equal(PredTypeNumericLess, p.Type())
+	s.True(p.IsTrue("-10"))
+	s.True(p.IsTrue([]byte("4")))
+	s.False(p.IsTrue("10"))
+	s.False(p.IsTrue("5"))
+	s.False(p.IsTrue("four"))
+}
+
+func (s *PredicateSuite) TestKeyExists() {
+	p := KeyExists("key")
+	s.Equal("key", p.Key())
+	s.Equal(true, p.TargetValue())
+	s.Equal(PredTargetKey, p.Target())
+	s.Equal(PredTypeExists, p.Type())
+	s.True(p.IsTrue(true))
+	s.False(p.IsTrue(false))
+	s.False(p.IsTrue("value"))
+
+	p = KeyNotExists("key")
+	s.Equal(false, p.TargetValue())
+	s.Equal(PredTargetKey, p.Target())
+	s.Equal(PredTypeNotExists, p.Type())
+	s.True(p.IsTrue(false))
+	s.False(p.IsTrue(true))
+	s.False(p.IsTrue(""))
+}
+
 func (s *PredicateSuite) TestPredicateValue() {
 	s.True(predicateValue(PredTypeEqual, 1, 1))
 	s.False(predicateValue(PredTypeEqual, 1, 2))
 	s.False(predicateValue(0, 1, 1))
+	s.True(predicateValue(PredTypeGreater, "b", "a"))
+	s.True(predicateValue(PredTypeLess, 1, 2))
 }
 
 func TestPredicates(t *testing.T) {
@@ -0,0 +1,185 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"go.uber.org/atomic"
+)
+
+// prefix labels of the kv metrics
+const (
+	PrefixLabelSegment           = "segment"
+	PrefixLabelBinlog            = "binlog"
+	PrefixLabelChannelCheckpoint = "channel-cp"
+	PrefixLabelSession           = "session"
+	PrefixLabelRBAC              = "rbac"
+	PrefixLabelCollection        = "collection"
+	PrefixLabelIndex             = "index"
+	PrefixLabelReplica           = "replica"
+	// PrefixLabelOther labels the keys matching no rule
+	PrefixLabelOther = "other"
+	// PrefixLabelMixed labels the transactions on keys of different labels
+	PrefixLabelMixed = "mixed"
+)
+
+// MaxPrefixLabels bounds the number of labels of the rules, so is the cardinality of the metrics.
+const MaxPrefixLabels = 32
+
+// DefaultPrefixRules are the rules labeling the known meta prefixes, relative to the meta root path.
+var DefaultPrefixRules = map[string]string{
+	"datacoord-meta/s":                    PrefixLabelSegment,
+	"datacoord-meta/binlog":               PrefixLabelBinlog,
+	"datacoord-meta/deltalog":             PrefixLabelBinlog,
+	"datacoord-meta/statslog":             PrefixLabelBinlog,
+	"datacoord-meta/channel-cp":           PrefixLabelChannelCheckpoint,
+	"session":                             PrefixLabelSession,
+	"root-coord/credential":               PrefixLabelRBAC,
+	"root-coord/collection":               PrefixLabelCollection,
+	"root-coord/database/collection-info": PrefixLabelCollection,
+	"field-index":                         PrefixLabelIndex,
+	"segment-index":                       PrefixLabelIndex,
+	"querycoord-replica":                  PrefixLabelReplica,
+}
+
+type prefixTrieNode struct {
+	children map[string]*prefixTrieNode
+	// label is set if a rule ends at the node
+	label string
+}
+
+// PrefixClassifier labels the keys by the longest rule prefix they match, PrefixLabelOther if none.
+// The rules are matched by whole path components, at the start of the key or after any '/',
+// so that the rules relative to the meta root path match the full keys of any root path.
+type PrefixClassifier struct {
+	root   *prefixTrieNode
+	labels []string
+}
+
+// NewPrefixClassifier builds a classifier of the rules mapping prefixes to labels,
+// the rules could have at most MaxPrefixLabels distinct labels.
+func NewPrefixClassifier(rules map[string]string) (*PrefixClassifier, error) {
+	c := &PrefixClassifier{root: &prefixTrieNode{}}
+	labels := map[string]struct{}{PrefixLabelOther: {}, PrefixLabelMixed: {}}
+	for prefix, label := range rules {
+		components := strings.Split(strings.Trim(prefix, "/"), "/")
+		if len(components) == 0 || components[0] == "" || label == "" {
+			return nil, errors.Newf("invalid prefix rule %q: %q", prefix, label)
+		}
+		node := c.root
+		for _, component := range components {
+			child, ok := node.children[component]
+			if !ok {
+				if node.children == nil {
+					node.children = make(map[string]*prefixTrieNode)
+				}
+				child = &prefixTrieNode{}
+				node.children[component] = child
+			}
+			node = child
+		}
+		node.label = label
+		labels[label] = struct{}{}
+	}
+	if len(labels) > MaxPrefixLabels {
+		return nil, errors.Newf("too many prefix labels, %d > %d", len(labels), MaxPrefixLabels)
+	}
+	for label := range labels {
+		c.labels = append(c.labels, label)
+	}
+	sort.Strings(c.labels)
+	return c, nil
+}
+
+// Classify returns the label of the longest rule key matches, an earlier match wins the ties.
+func (c *PrefixClassifier) Classify(key string) string {
+	label, depth := PrefixLabelOther, 0
+	for start := 0; start < len(key); {
+		node, matched := c.root, 0
+		for pos := start; pos <= len(key); {
+			end := strings.IndexByte(key[pos:], '/')
+			if end < 0 {
+				end = len(key)
+			} else {
+				end += pos
+			}
+			child, ok := node.children[key[pos:end]]
+			if !ok {
+				break
+			}
+			node, matched = child, matched+1
+			if node.label != "" && matched > depth {
+				label, depth = node.label, matched
+			}
+			pos = end + 1
+		}
+		next := strings.IndexByte(key[start:], '/')
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+	return label
+}
+
+// Labels returns all the labels the classifier could return, sorted.
+func (c *PrefixClassifier) Labels() []string {
+	return c.labels
+}
+
+var prefixClassifier = atomic.NewPointer(mustNewPrefixClassifier(DefaultPrefixRules))
+
+func mustNewPrefixClassifier(rules map[string]string) *PrefixClassifier {
+	c, err := NewPrefixClassifier(rules)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// SetPrefixRules replaces the rules labeling the kv metrics, the rules are kept if invalid.
+func SetPrefixRules(rules map[string]string) error {
+	c, err := NewPrefixClassifier(rules)
+	if err != nil {
+		return err
+	}
+	prefixClassifier.Store(c)
+	return nil
+}
+
+// PrefixLabel returns the prefix label of key for the kv metrics.
+func PrefixLabel(key string) string {
+	return prefixClassifier.Load().Classify(key)
+}
+
+// PrefixLabelOf returns the prefix label shared by the keys, PrefixLabelMixed if they differ.
+func PrefixLabelOf(keys ...string) string {
+	if len(keys) == 0 {
+		return PrefixLabelOther
+	}
+	c := prefixClassifier.Load()
+	label := c.Classify(keys[0])
+	for _, key := range keys[1:] {
+		if c.Classify(key) != label {
+			return PrefixLabelMixed
+		}
+	}
+	return label
+}
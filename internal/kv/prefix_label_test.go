@@ -0,0 +1,135 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixClassifier(t *testing.T) {
+	c, err := NewPrefixClassifier(DefaultPrefixRules)
+	require.NoError(t, err)
+
+	cases := map[string]string{
+		"by-dev/meta/datacoord-meta/s/100/101/1":                     PrefixLabelSegment,
+		"by-dev/meta/datacoord-meta/s/":                              PrefixLabelSegment,
+		"by-dev/meta/datacoord-meta/binlog/100/101/1/0":              PrefixLabelBinlog,
+		"by-dev/meta/datacoord-meta/channel-cp/by-dev-dml_0_100v0":   PrefixLabelChannelCheckpoint,
+		"by-dev/meta/session/querynode-1":                            PrefixLabelSession,
+		"by-dev/meta/root-coord/credential/users/root":               PrefixLabelRBAC,
+		"by-dev/meta/root-coord/credential/roles/public":             PrefixLabelRBAC,
+		"by-dev/meta/root-coord/database/collection-info/1/100":      PrefixLabelCollection,
+		"by-dev/meta/snapshots/root-coord/collection/100_ts43000000": PrefixLabelCollection,
+		"by-dev/meta/field-index/100/1":                              PrefixLabelIndex,
+		"by-dev/meta/querycoord-replica/100/1":                       PrefixLabelReplica,
+		"datacoord-meta/s/100/101/1":                                 PrefixLabelSegment,
+		// partial components don't match
+		"by-dev/meta/datacoord-meta/segment/1": PrefixLabelOther,
+		"by-dev/meta/sessions/1":               PrefixLabelOther,
+		"by-dev/meta/datacoord-meta":           PrefixLabelOther,
+		"by-dev/meta/root-coord/database/db/1": PrefixLabelOther,
+		"":                                     PrefixLabelOther,
+	}
+	for key, label := range cases {
+		assert.Equal(t, label, c.Classify(key), key)
+	}
+
+	t.Run("longest prefix", func(t *testing.T) {
+		c, err := NewPrefixClassifier(map[string]string{
+			"a":     "short",
+			"a/b/c": "long",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "long", c.Classify("root/a/b/c/d"))
+		assert.Equal(t, "short", c.Classify("root/a/b/d"))
+		assert.Equal(t, "long", c.Classify("root/a/x/a/b/c"))
+	})
+
+	t.Run("bounded cardinality", func(t *testing.T) {
+		// any key is labeled by one of the labels of the rules
+		labels := make(map[string]struct{})
+		for _, label := range c.Labels() {
+			labels[label] = struct{}{}
+		}
+		assert.Len(t, labels, 10)
+		components := []string{"by-dev", "meta", "datacoord-meta", "s", "session", "root-coord", "credential", "x", ""}
+		r := rand.New(rand.NewSource(0))
+		for i := 0; i < 10000; i++ {
+			parts := make([]string, r.Intn(8))
+			for j := range parts {
+				parts[j] = components[r.Intn(len(components))]
+				if r.Intn(4) == 0 {
+					parts[j] = fmt.Sprint(r.Int63())
+				}
+			}
+			key := strings.Join(parts, "/")
+			assert.Contains(t, labels, c.Classify(key), key)
+		}
+
+		rules := make(map[string]string)
+		for i := 0; i < MaxPrefixLabels; i++ {
+			rules[fmt.Sprintf("prefix-%d", i)] = fmt.Sprintf("label-%d", i)
+		}
+		_, err := NewPrefixClassifier(rules)
+		assert.Error(t, err)
+		// the same label could be shared by many rules
+		for i := 0; i < MaxPrefixLabels; i++ {
+			rules[fmt.Sprintf("prefix-%d", i)] = "label"
+		}
+		c, err := NewPrefixClassifier(rules)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"label", PrefixLabelMixed, PrefixLabelOther}, c.Labels())
+	})
+
+	t.Run("invalid rules", func(t *testing.T) {
+		_, err := NewPrefixClassifier(map[string]string{"": "label"})
+		assert.Error(t, err)
+		_, err = NewPrefixClassifier(map[string]string{"prefix": ""})
+		assert.Error(t, err)
+	})
+
+	t.Run("default classifier", func(t *testing.T) {
+		defer SetPrefixRules(DefaultPrefixRules)
+
+		assert.Equal(t, PrefixLabelSegment, PrefixLabel("by-dev/meta/datacoord-meta/s/1"))
+		assert.Equal(t, PrefixLabelSegment, PrefixLabelOf("by-dev/meta/datacoord-meta/s/1", "by-dev/meta/datacoord-meta/s/2"))
+		assert.Equal(t, PrefixLabelMixed, PrefixLabelOf("by-dev/meta/datacoord-meta/s/1", "by-dev/meta/session/1"))
+		assert.Equal(t, PrefixLabelOther, PrefixLabelOf())
+
+		require.NoError(t, SetPrefixRules(map[string]string{"custom": "custom"}))
+		assert.Equal(t, PrefixLabelOther, PrefixLabel("by-dev/meta/datacoord-meta/s/1"))
+		assert.Equal(t, "custom", PrefixLabel("by-dev/meta/custom/1"))
+		// invalid rules are not applied
+		assert.Error(t, SetPrefixRules(map[string]string{"custom": ""}))
+		assert.Equal(t, "custom", PrefixLabel("by-dev/meta/custom/1"))
+	})
+}
+
+func BenchmarkPrefixClassifier(b *testing.B) {
+	c, err := NewPrefixClassifier(DefaultPrefixRules)
+	require.NoError(b, err)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.Classify("by-dev/meta/datacoord-meta/s/447823984723/447823984724/447823984725")
+	}
+}
@@ -0,0 +1,151 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RedactionRules decides the keys whose values are sensitive, e.g. credentials.
+// A prefix matches the key itself or the part of the key after any '/', so that a prefix
+// relative to the root path matches both the relative keys and the full keys.
+// A pattern is a regular expression matching any part of the key.
+type RedactionRules struct {
+	mu       sync.RWMutex
+	prefixes []string
+	patterns []*regexp.Regexp
+}
+
+// Set replaces the rules, the rules are kept if any pattern is invalid.
+func (r *RedactionRules) Set(prefixes []string, patterns []string) error {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return errors.Wrapf(err, "invalid redaction pattern %s", pattern)
+		}
+		compiled = append(compiled, re)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prefixes = append([]string(nil), prefixes...)
+	r.patterns = compiled
+	return nil
+}
+
+// Sensitive returns whether the value of key should be redacted.
+func (r *RedactionRules) Sensitive(key string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(key, prefix) || strings.Contains(key, "/"+strings.TrimPrefix(prefix, "/")) {
+			return true
+		}
+	}
+	for _, re := range r.patterns {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns value, or a placeholder with its size if the value of key is sensitive.
+func (r *RedactionRules) Redact(key string, value string) string {
+	if r.Sensitive(key) {
+		return fmt.Sprintf("<redacted:%d bytes>", len(value))
+	}
+	return value
+}
+
+// DefaultRedactionPrefixes are the prefixes of the credentials kept by rootcoord,
+// the users with their password hashes, the roles and the grants.
+var DefaultRedactionPrefixes = []string{"root-coord/credential/"}
+
+var redactionRules = &RedactionRules{prefixes: DefaultRedactionPrefixes}
+
+// SetRedactionRules sets the rules of the values redacted by the kv layer,
+// in the log lines, the error messages and the exports.
+func SetRedactionRules(prefixes []string, patterns []string) error {
+	return redactionRules.Set(prefixes, patterns)
+}
+
+// ResetRedactionRules restores the default rules, see DefaultRedactionPrefixes.
+func ResetRedactionRules() {
+	redactionRules.mu.Lock()
+	defer redactionRules.mu.Unlock()
+	redactionRules.prefixes = DefaultRedactionPrefixes
+	redactionRules.patterns = nil
+}
+
+// RedactValue returns value to be logged or put into an error message,
+// it's redacted if key is sensitive. All values leaving the kv layer for humans go through it.
+func RedactValue(key string, value string) string {
+	return redactionRules.Redact(key, value)
+}
+
+// ValueField is the zap field of value to log, redacted if key is sensitive.
+func ValueField(key string, value string) zap.Field {
+	return NamedValueField("value", key, value)
+}
+
+// NamedValueField is ValueField with the name of the field, e.g. "expected" or "target".
+func NamedValueField(name string, key string, value string) zap.Field {
+	return zap.String(name, RedactValue(key, value))
+}
+
+// ValuesField is the zap field of the kvs to log, the values of the sensitive keys are redacted.
+func ValuesField[V string | []byte](name string, kvs map[string]V) zap.Field {
+	return zap.Object(name, redactedValues[V](kvs))
+}
+
+type redactedValues[V string | []byte] map[string]V
+
+func (kvs redactedValues[V]) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for key, value := range kvs {
+		enc.AddString(key, RedactValue(key, string(value)))
+	}
+	return nil
+}
+
+// ExportEntry is a line of the output of ExportWithPrefix.
+type ExportEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ExportWithPrefix writes the kvs with prefix to w as JSON lines of ExportEntry, for inspection.
+// The sensitive values are redacted unless includeSensitive is set.
+func ExportWithPrefix(w io.Writer, metaKv MetaKv, prefix string, paginationSize int, includeSensitive bool) error {
+	encoder := json.NewEncoder(w)
+	return metaKv.WalkWithPrefix(prefix, paginationSize, func(key []byte, value []byte) error {
+		entry := ExportEntry{Key: string(key), Value: string(value)}
+		if !includeSensitive {
+			entry.Value = RedactValue(entry.Key, entry.Value)
+		}
+		return encoder.Encode(entry)
+	})
+}
@@ -0,0 +1,91 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRedactionRules(t *testing.T) {
+	rules := &RedactionRules{}
+	assert.False(t, rules.Sensitive("root-coord/credential/users/root"))
+	assert.Equal(t, "secret", rules.Redact("root-coord/credential/users/root", "secret"))
+
+	err := rules.Set([]string{"root-coord/credential/"}, []string{`password$`})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		key       string
+		sensitive bool
+	}{
+		{"root-coord/credential/users/root", true},
+		{"by-dev/meta/root-coord/credential/users/root", true},
+		{"root-coord/collection/1", false},
+		{"config/minio/password", true},
+		{"config/minio/password/hint", false},
+		{"credential/users/root", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.sensitive, rules.Sensitive(test.key), test.key)
+	}
+	assert.Equal(t, "<redacted:6 bytes>", rules.Redact("root-coord/credential/users/root", "secret"))
+	assert.Equal(t, "value", rules.Redact("root-coord/collection/1", "value"))
+
+	// invalid rules are rejected, the previous ones are kept
+	err = rules.Set(nil, []string{"("})
+	assert.Error(t, err)
+	assert.True(t, rules.Sensitive("config/minio/password"))
+
+	err = rules.Set(nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, rules.Sensitive("config/minio/password"))
+}
+
+func TestValueField(t *testing.T) {
+	err := SetRedactionRules([]string{"secret/"}, nil)
+	assert.NoError(t, err)
+	defer ResetRedactionRules()
+
+	assert.Equal(t, "<redacted:5 bytes>", ValueField("secret/key", "value").String)
+	assert.Equal(t, "value", ValueField("plain/key", "value").String)
+	assert.Equal(t, "value", ValueField("plain/key", "value").Key)
+	assert.Equal(t, "target", NamedValueField("target", "secret/key", "value").Key)
+
+	enc := zapcore.NewMapObjectEncoder()
+	field := ValuesField("kvs", map[string][]byte{"secret/key": []byte("value"), "plain/key": []byte("value")})
+	field.AddTo(enc)
+	assert.Equal(t, map[string]interface{}{
+		"secret/key": "<redacted:5 bytes>",
+		"plain/key":  "value",
+	}, enc.Fields["kvs"])
+}
+
+func TestDefaultRedactionRules(t *testing.T) {
+	assert.True(t, redactionRules.Sensitive("root-coord/credential/users/root"))
+	assert.True(t, redactionRules.Sensitive("by-dev/meta/root-coord/credential/roles/admin"))
+	assert.False(t, redactionRules.Sensitive("root-coord/collection/1"))
+
+	err := SetRedactionRules(nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, redactionRules.Sensitive("root-coord/credential/users/root"))
+
+	ResetRedactionRules()
+	assert.True(t, redactionRules.Sensitive("root-coord/credential/users/root"))
+}
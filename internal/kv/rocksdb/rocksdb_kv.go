@@ -18,6 +18,7 @@ package rocksdbkv
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/tecbot/gorocksdb"
@@ -30,6 +31,9 @@ import (
 
 var _ kv.BaseKV = (*RocksdbKV)(nil)
 
+// errors returned by RocksdbKV carry the context of the failed operation, the root path is the db name
+var wrapError = kv.WrapError
+
 // RocksdbKV is KV implemented by rocksdb
 type RocksdbKV struct {
 	Opts         *gorocksdb.Options
@@ -97,7 +101,8 @@ func (kv *RocksdbKV) GetName() string {
 }
 
 // Load returns the value of specified key
-func (kv *RocksdbKV) Load(key string) (string, error) {
+func (kv *RocksdbKV) Load(key string) (_ string, err error) {
+	defer wrapError(&err, "Load", kv.name, key, 1, time.Now())
 	if kv.DB == nil {
 		return "", fmt.Errorf("rocksdb instance is nil when load %s", key)
 	}
@@ -114,7 +119,8 @@ func (kv *RocksdbKV) Load(key string) (string, error) {
 	return string(value.Data()), nil
 }
 
-func (kv *RocksdbKV) LoadBytes(key string) ([]byte, error) {
+func (kv *RocksdbKV) LoadBytes(key string) (_ []byte, err error) {
+	defer wrapError(&err, "LoadBytes", kv.name, key, 1, time.Now())
 	if kv.DB == nil {
 		return nil, fmt.Errorf("rocksdb instance is nil when load %s", key)
 	}
@@ -139,7 +145,8 @@ func (kv *RocksdbKV) LoadBytes(key string) ([]byte, error) {
 
 // LoadWithPrefix returns a batch values of keys with a prefix
 // if prefix is "", then load every thing from the database
-func (kv *RocksdbKV) LoadWithPrefix(prefix string) ([]string, []string, error) {
+func (kv *RocksdbKV) LoadWithPrefix(prefix string) (_ []string, _ []string, err error) {
+	defer wrapError(&err, "LoadWithPrefix", kv.name, prefix, 1, time.Now())
 	if kv.DB == nil {
 		return nil, nil, fmt.Errorf("rocksdb instance is nil when load %s", prefix)
 	}
@@ -164,7 +171,8 @@ func (kv *RocksdbKV) LoadWithPrefix(prefix string) ([]string, []string, error) {
 	return keys, values, nil
 }
 
-func (kv *RocksdbKV) Has(key string) (bool, error) {
+func (kv *RocksdbKV) Has(key string) (_ bool, err error) {
+	defer wrapError(&err, "Has", kv.name, key, 1, time.Now())
 	if kv.DB == nil {
 		return false, fmt.Errorf("rocksdb instance is nil when check if has %s", key)
 	}
@@ -180,7 +188,8 @@ func (kv *RocksdbKV) Has(key string) (bool, error) {
 	return value.Size() != 0, nil
 }
 
-func (kv *RocksdbKV) HasPrefix(prefix string) (bool, error) {
+func (kv *RocksdbKV) HasPrefix(prefix string) (_ bool, err error) {
+	defer wrapError(&err, "HasPrefix", kv.name, prefix, 1, time.Now())
 	if kv.DB == nil {
 		return false, fmt.Errorf("rocksdb instance is nil when check if has prefix %s", prefix)
 	}
@@ -194,7 +203,8 @@ func (kv *RocksdbKV) HasPrefix(prefix string) (bool, error) {
 	return iter.Valid(), nil
 }
 
-func (kv *RocksdbKV) LoadBytesWithPrefix(prefix string) ([]string, [][]byte, error) {
+func (kv *RocksdbKV) LoadBytesWithPrefix(prefix string) (_ []string, _ [][]byte, err error) {
+	defer wrapError(&err, "LoadBytesWithPrefix", kv.name, prefix, 1, time.Now())
 	if kv.DB == nil {
 		return nil, nil, fmt.Errorf("rocksdb instance is nil when load %s", prefix)
 	}
@@ -229,7 +239,8 @@ func (kv *RocksdbKV) LoadBytesWithPrefix(prefix string) ([]string, [][]byte, err
 }
 
 // MultiLoad load a batch of values by keys
-func (kv *RocksdbKV) MultiLoad(keys []string) ([]string, error) {
+func (kv *RocksdbKV) MultiLoad(keys []string) (_ []string, err error) {
+	defer wrapError(&err, "MultiLoad", kv.name, "", len(keys), time.Now())
 	if kv.DB == nil {
 		return nil, errors.New("rocksdb instance is nil when do MultiLoad")
 	}
@@ -253,7 +264,8 @@ func (kv *RocksdbKV) MultiLoad(keys []string) ([]string, error) {
 	return values, nil
 }
 
-func (kv *RocksdbKV) MultiLoadBytes(keys []string) ([][]byte, error) {
+func (kv *RocksdbKV) MultiLoadBytes(keys []string) (_ [][]byte, err error) {
+	defer wrapError(&err, "MultiLoadBytes", kv.name, "", len(keys), time.Now())
 	if kv.DB == nil {
 		return nil, errors.New("rocksdb instance is nil when do MultiLoad")
 	}
@@ -281,7 +293,8 @@ func (kv *RocksdbKV) MultiLoadBytes(keys []string) ([][]byte, error) {
 }
 
 // Save a pair of key-value
-func (kv *RocksdbKV) Save(key, value string) error {
+func (kv *RocksdbKV) Save(key, value string) (err error) {
+	defer wrapError(&err, "Save", kv.name, key, 1, time.Now())
 	if kv.DB == nil {
 		return errors.New("rocksdb instance is nil when do save")
 	}
@@ -295,7 +308,8 @@ func (kv *RocksdbKV) Save(key, value string) error {
 	return kv.DB.Put(kv.WriteOptions, []byte(key), []byte(value))
 }
 
-func (kv *RocksdbKV) SaveBytes(key string, value []byte) error {
+func (kv *RocksdbKV) SaveBytes(key string, value []byte) (err error) {
+	defer wrapError(&err, "SaveBytes", kv.name, key, 1, time.Now())
 	if kv.DB == nil {
 		return errors.New("rocksdb instance is nil when do save")
 	}
@@ -310,7 +324,8 @@ func (kv *RocksdbKV) SaveBytes(key string, value []byte) error {
 }
 
 // MultiSave a batch of key-values
-func (kv *RocksdbKV) MultiSave(kvs map[string]string) error {
+func (kv *RocksdbKV) MultiSave(kvs map[string]string) (err error) {
+	defer wrapError(&err, "MultiSave", kv.name, "", len(kvs), time.Now())
 	if kv.DB == nil {
 		return errors.New("rocksdb instance is nil when do MultiSave")
 	}
@@ -325,7 +340,8 @@ func (kv *RocksdbKV) MultiSave(kvs map[string]string) error {
 	return kv.DB.Write(kv.WriteOptions, writeBatch)
 }
 
-func (kv *RocksdbKV) MultiSaveBytes(kvs map[string][]byte) error {
+func (kv *RocksdbKV) MultiSaveBytes(kvs map[string][]byte) (err error) {
+	defer wrapError(&err, "MultiSaveBytes", kv.name, "", len(kvs), time.Now())
 	if kv.DB == nil {
 		return errors.New("rocksdb instance is nil when do MultiSave")
 	}
@@ -342,7 +358,8 @@ func (kv *RocksdbKV) MultiSaveBytes(kvs map[string][]byte) error {
 
 // RemoveWithPrefix removes a batch of key-values with specified prefix
 // If prefix is "", then all data in the rocksdb kv will be deleted
-func (kv *RocksdbKV) RemoveWithPrefix(prefix string) error {
+func (kv *RocksdbKV) RemoveWithPrefix(prefix string) (err error) {
+	defer wrapError(&err, "RemoveWithPrefix", kv.name, prefix, 1, time.Now())
 	if kv.DB == nil {
 		return errors.New("rocksdb instance is nil when do RemoveWithPrefix")
 	}
@@ -365,19 +382,21 @@ func (kv *RocksdbKV) RemoveWithPrefix(prefix string) error {
 }
 
 // Remove is used to remove a pair of key-value
-func (kv *RocksdbKV) Remove(key string) error {
+func (kv *RocksdbKV) Remove(key string) (err error) {
+	defer wrapError(&err, "Remove", kv.name, key, 1, time.Now())
 	if kv.DB == nil {
 		return errors.New("rocksdb instance is nil when do Remove")
 	}
 	if key == "" {
 		return errors.New("rocksdb kv does not support empty key")
 	}
-	err := kv.DB.Delete(kv.WriteOptions, []byte(key))
+	err = kv.DB.Delete(kv.WriteOptions, []byte(key))
 	return err
 }
 
 // MultiRemove is used to remove a batch of key-values
-func (kv *RocksdbKV) MultiRemove(keys []string) error {
+func (kv *RocksdbKV) MultiRemove(keys []string) (err error) {
+	defer wrapError(&err, "MultiRemove", kv.name, "", len(keys), time.Now())
 	if kv.DB == nil {
 		return errors.New("rocksdb instance is nil when do MultiRemove")
 	}
@@ -386,12 +405,13 @@ func (kv *RocksdbKV) MultiRemove(keys []string) error {
 	for _, key := range keys {
 		writeBatch.Delete([]byte(key))
 	}
-	err := kv.DB.Write(kv.WriteOptions, writeBatch)
+	err = kv.DB.Write(kv.WriteOptions, writeBatch)
 	return err
 }
 
 // MultiSaveAndRemove provides a transaction to execute a batch of operations
-func (kv *RocksdbKV) MultiSaveAndRemove(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
+func (kv *RocksdbKV) MultiSaveAndRemove(saves map[string]string, removals []string, preds ...predicates.Predicate) (err error) {
+	defer wrapError(&err, "MultiSaveAndRemove", kv.name, "", len(saves)+len(removals), time.Now())
 	if len(preds) > 0 {
 		return merr.WrapErrServiceUnavailable("predicates not supported")
 	}
@@ -406,12 +426,13 @@ func (kv *RocksdbKV) MultiSaveAndRemove(saves map[string]string, removals []stri
 	for _, key := range removals {
 		writeBatch.Delete([]byte(key))
 	}
-	err := kv.DB.Write(kv.WriteOptions, writeBatch)
+	err = kv.DB.Write(kv.WriteOptions, writeBatch)
 	return err
 }
 
 // DeleteRange remove a batch of key-values from startKey to endKey
-func (kv *RocksdbKV) DeleteRange(startKey, endKey string) error {
+func (kv *RocksdbKV) DeleteRange(startKey, endKey string) (err error) {
+	defer wrapError(&err, "DeleteRange", kv.name, startKey, 2, time.Now())
 	if kv.DB == nil {
 		return errors.New("Rocksdb instance is nil when do DeleteRange")
 	}
@@ -421,12 +442,13 @@ func (kv *RocksdbKV) DeleteRange(startKey, endKey string) error {
 	writeBatch := gorocksdb.NewWriteBatch()
 	defer writeBatch.Destroy()
 	writeBatch.DeleteRange([]byte(startKey), []byte(endKey))
-	err := kv.DB.Write(kv.WriteOptions, writeBatch)
+	err = kv.DB.Write(kv.WriteOptions, writeBatch)
 	return err
 }
 
 // MultiSaveAndRemoveWithPrefix is used to execute a batch operators with the same prefix
-func (kv *RocksdbKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
+func (kv *RocksdbKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals []string, preds ...predicates.Predicate) (err error) {
+	defer wrapError(&err, "MultiSaveAndRemoveWithPrefix", kv.name, "", len(saves)+len(removals), time.Now())
 	if len(preds) > 0 {
 		return merr.WrapErrServiceUnavailable("predicates not supported")
 	}
@@ -439,7 +461,7 @@ func (kv *RocksdbKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, remov
 		writeBatch.Put([]byte(k), []byte(v))
 	}
 	kv.prepareRemovePrefix(removals, writeBatch)
-	err := kv.DB.Write(kv.WriteOptions, writeBatch)
+	err = kv.DB.Write(kv.WriteOptions, writeBatch)
 	return err
 }
 
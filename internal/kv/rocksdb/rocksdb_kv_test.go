@@ -22,9 +22,11 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/cockroachdb/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/milvus-io/milvus/internal/kv"
 	"github.com/milvus-io/milvus/internal/kv/predicates"
 	rocksdbkv "github.com/milvus-io/milvus/internal/kv/rocksdb"
 	"github.com/milvus-io/milvus/pkg/util/merr"
@@ -384,3 +386,32 @@ func TestPredicates(t *testing.T) {
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, merr.ErrServiceUnavailable)
 }
+
+func TestOpError(t *testing.T) {
+	dir := t.TempDir()
+	db, err := rocksdbkv.NewRocksdbKV(dir)
+	require.NoError(t, err)
+	defer db.Close()
+	defer db.RemoveWithPrefix("")
+
+	err = db.Save("key1", "")
+	var opErr *kv.OpError
+	require.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "Save", opErr.Op)
+	assert.Equal(t, "key1", opErr.Key)
+	assert.Equal(t, 1, opErr.KeyCount)
+	assert.Equal(t, dir, opErr.RootPath)
+	assert.ErrorContains(t, err, "rocksdb kv does not support empty value")
+
+	// the nested DeleteRange reports its own range
+	err = db.DeleteRange("b", "a")
+	require.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "DeleteRange", opErr.Op)
+	assert.Equal(t, "b", opErr.Key)
+
+	err = db.MultiSaveAndRemove(map[string]string{"a": "b"}, []string{"c"}, predicates.ValueEqual("a", "b"))
+	require.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "MultiSaveAndRemove", opErr.Op)
+	assert.Equal(t, 2, opErr.KeyCount)
+	assert.ErrorIs(t, err, merr.ErrServiceUnavailable)
+}
@@ -0,0 +1,400 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saltedkv
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/milvus-io/milvus/internal/kv"
+	"github.com/milvus-io/milvus/internal/kv/predicates"
+	"github.com/milvus-io/milvus/pkg/common"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+)
+
+const (
+	// bucketSegmentPrefix starts the path segment of the salt bucket inserted after a salted prefix,
+	// e.g. "channel-cp/__salt_3/by-dev-dml_0".
+	bucketSegmentPrefix = "__salt_"
+	// bucketConfigRoot is the root of the keys recording the bucket count of each salted prefix,
+	// e.g. "__salt_buckets__/channel-cp".
+	bucketConfigRoot = "__salt_buckets__"
+)
+
+// rebucketBatchSize is the number of keys moved per transaction by Rebucket.
+var rebucketBatchSize = 64
+
+// ErrBucketCountMismatch is returned when the bucket count of a salted prefix differs from the
+// recorded one, the keys must be moved by Rebucket first.
+type ErrBucketCountMismatch struct {
+	Prefix     string
+	Recorded   int
+	Configured int
+}
+
+func (e *ErrBucketCountMismatch) Error() string {
+	return fmt.Sprintf("prefix %s is salted with %d buckets, but %d is configured, run Rebucket first", e.Prefix, e.Recorded, e.Configured)
+}
+
+// SaltedKV spreads the keys under the salted prefixes into buckets, to avoid hot regions of TiKV
+// for prefixes written at high frequency, e.g. the channel checkpoints. The key "prefix/rest" is
+// stored as "prefix/__salt_N/rest", N is the hash of rest modulo the bucket count. The keys of
+// other prefixes are passed through untouched.
+//
+// Keys passed to and returned by SaltedKV are always in the plain layout. Scans inside a salted
+// prefix fan out across all buckets, LoadWithPrefix merges them in key order, while WalkWithPrefix
+// visits the buckets one by one, so the keys are in key order within each bucket only.
+type SaltedKV struct {
+	kv.MetaKv
+	buckets int
+	// prefixes are the salted prefixes relative to the root path, without trailing slash
+	prefixes []string
+}
+
+// implementation assertion
+var _ kv.MetaKv = (*SaltedKV)(nil)
+
+// NewSaltedKV wraps metaKv to salt the keys under prefixes with buckets buckets.
+// The bucket count is recorded for each prefix under "__salt_buckets__/<prefix>" at the first time,
+// so that all readers and writers agree on it, ErrBucketCountMismatch is returned if it differs
+// from the recorded one.
+func NewSaltedKV(metaKv kv.MetaKv, buckets int, prefixes ...string) (*SaltedKV, error) {
+	if buckets <= 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("bucket count must be positive, got %d", buckets)
+	}
+	cleaned := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(prefix, "/")
+		if prefix == "" {
+			return nil, merr.WrapErrParameterInvalidMsg("salted prefix must not be empty")
+		}
+		recorded, err := loadBucketCount(metaKv, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if recorded == 0 {
+			if err := metaKv.Save(bucketConfigKey(prefix), strconv.Itoa(buckets)); err != nil {
+				return nil, err
+			}
+		} else if recorded != buckets {
+			return nil, &ErrBucketCountMismatch{Prefix: prefix, Recorded: recorded, Configured: buckets}
+		}
+		cleaned = append(cleaned, prefix)
+	}
+	return &SaltedKV{
+		MetaKv:   metaKv,
+		buckets:  buckets,
+		prefixes: cleaned,
+	}, nil
+}
+
+func bucketConfigKey(prefix string) string {
+	return path.Join(bucketConfigRoot, prefix)
+}
+
+// loadBucketCount returns the recorded bucket count of prefix, 0 if not recorded.
+func loadBucketCount(metaKv kv.MetaKv, prefix string) (int, error) {
+	value, err := metaKv.Load(bucketConfigKey(prefix))
+	if common.IsKeyNotExistError(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	buckets, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid bucket count of prefix %s", prefix)
+	}
+	return buckets, nil
+}
+
+func bucketSegment(rest string, buckets int) string {
+	h := fnv.New32a()
+	h.Write([]byte(rest))
+	return bucketSegmentPrefix + strconv.Itoa(int(h.Sum32()%uint32(buckets)))
+}
+
+// trimBucketSegment returns rest without its leading bucket segment, if any.
+func trimBucketSegment(rest string) string {
+	if !strings.HasPrefix(rest, bucketSegmentPrefix) {
+		return rest
+	}
+	if i := strings.Index(rest, "/"); i >= 0 {
+		return rest[i+1:]
+	}
+	return rest
+}
+
+// split returns the salted prefix of key and the rest after it, ok is false if key is not
+// inside a salted prefix.
+func (kv *SaltedKV) split(key string) (prefix string, rest string, ok bool) {
+	key = strings.TrimPrefix(key, "/")
+	for _, prefix := range kv.prefixes {
+		if strings.HasPrefix(key, prefix+"/") && len(key) > len(prefix)+1 {
+			return prefix, key[len(prefix)+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// salt returns the stored key of key.
+func (kv *SaltedKV) salt(key string) string {
+	prefix, rest, ok := kv.split(key)
+	if !ok {
+		return key
+	}
+	return prefix + "/" + bucketSegment(rest, kv.buckets) + "/" + rest
+}
+
+// unsalt returns the full key in the plain layout of the stored full key.
+func (kv *SaltedKV) unsalt(fullKey string) string {
+	for _, prefix := range kv.prefixes {
+		fullPrefix := kv.GetPath(prefix) + "/"
+		if strings.HasPrefix(fullKey, fullPrefix) {
+			return fullPrefix + trimBucketSegment(fullKey[len(fullPrefix):])
+		}
+	}
+	return fullKey
+}
+
+// scanPrefixes returns the stored prefixes to scan for prefix, one per bucket if prefix is inside
+// a salted prefix. Otherwise prefix itself, which covers the salted prefixes below it if any.
+func (kv *SaltedKV) scanPrefixes(prefix string) []string {
+	salted, rest, ok := kv.split(prefix)
+	if !ok {
+		return []string{prefix}
+	}
+	prefixes := make([]string, 0, kv.buckets)
+	for i := 0; i < kv.buckets; i++ {
+		prefixes = append(prefixes, salted+"/"+bucketSegmentPrefix+strconv.Itoa(i)+"/"+rest)
+	}
+	return prefixes
+}
+
+func (kv *SaltedKV) saltKeys(keys []string) []string {
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, kv.salt(key))
+	}
+	return result
+}
+
+func (kv *SaltedKV) saltSaves(saves map[string]string) map[string]string {
+	result := make(map[string]string, len(saves))
+	for key, value := range saves {
+		result[kv.salt(key)] = value
+	}
+	return result
+}
+
+// saltedPredicate is the predicate on the stored key.
+type saltedPredicate struct {
+	predicates.Predicate
+	key string
+}
+
+func (p *saltedPredicate) Key() string {
+	return p.key
+}
+
+func (kv *SaltedKV) saltPredicates(preds []predicates.Predicate) []predicates.Predicate {
+	result := make([]predicates.Predicate, 0, len(preds))
+	for _, pred := range preds {
+		if key := kv.salt(pred.Key()); key != pred.Key() {
+			pred = &saltedPredicate{Predicate: pred, key: key}
+		}
+		result = append(result, pred)
+	}
+	return result
+}
+
+func (kv *SaltedKV) Load(key string) (string, error) {
+	value, err := kv.MetaKv.Load(kv.salt(key))
+	if common.IsKeyNotExistError(err) {
+		return "", common.NewKeyNotExistError(kv.GetPath(key))
+	}
+	return value, err
+}
+
+func (kv *SaltedKV) MultiLoad(keys []string) ([]string, error) {
+	return kv.MetaKv.MultiLoad(kv.saltKeys(keys))
+}
+
+func (kv *SaltedKV) Has(key string) (bool, error) {
+	return kv.MetaKv.Has(kv.salt(key))
+}
+
+// LoadWithPrefix returns the keys in the plain layout in key order, the buckets are merged.
+func (kv *SaltedKV) LoadWithPrefix(prefix string) ([]string, []string, error) {
+	var keys, values []string
+	for _, scanPrefix := range kv.scanPrefixes(prefix) {
+		bucketKeys, bucketValues, err := kv.MetaKv.LoadWithPrefix(scanPrefix)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, key := range bucketKeys {
+			keys = append(keys, kv.unsalt(key))
+			values = append(values, bucketValues[i])
+		}
+	}
+	sort.Sort(&keyValues{keys: keys, values: values})
+	return keys, values, nil
+}
+
+type keyValues struct {
+	keys   []string
+	values []string
+}
+
+func (kvs *keyValues) Len() int           { return len(kvs.keys) }
+func (kvs *keyValues) Less(i, j int) bool { return kvs.keys[i] < kvs.keys[j] }
+func (kvs *keyValues) Swap(i, j int) {
+	kvs.keys[i], kvs.keys[j] = kvs.keys[j], kvs.keys[i]
+	kvs.values[i], kvs.values[j] = kvs.values[j], kvs.values[i]
+}
+
+func (kv *SaltedKV) HasPrefix(prefix string) (bool, error) {
+	for _, scanPrefix := range kv.scanPrefixes(prefix) {
+		has, err := kv.MetaKv.HasPrefix(scanPrefix)
+		if err != nil || has {
+			return has, err
+		}
+	}
+	return false, nil
+}
+
+// WalkWithPrefix visits the buckets one by one, so the keys are in key order within each bucket only.
+func (kv *SaltedKV) WalkWithPrefix(prefix string, paginationSize int, fn func([]byte, []byte) error) error {
+	for _, scanPrefix := range kv.scanPrefixes(prefix) {
+		err := kv.MetaKv.WalkWithPrefix(scanPrefix, paginationSize, func(key []byte, value []byte) error {
+			return fn([]byte(kv.unsalt(string(key))), value)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (kv *SaltedKV) Save(key, value string) error {
+	return kv.MetaKv.Save(kv.salt(key), value)
+}
+
+func (kv *SaltedKV) MultiSave(kvs map[string]string) error {
+	return kv.MetaKv.MultiSave(kv.saltSaves(kvs))
+}
+
+func (kv *SaltedKV) Remove(key string) error {
+	return kv.MetaKv.Remove(kv.salt(key))
+}
+
+func (kv *SaltedKV) MultiRemove(keys []string) error {
+	return kv.MetaKv.MultiRemove(kv.saltKeys(keys))
+}
+
+func (kv *SaltedKV) RemoveWithPrefix(prefix string) error {
+	scanPrefixes := kv.scanPrefixes(prefix)
+	if len(scanPrefixes) == 1 {
+		return kv.MetaKv.RemoveWithPrefix(scanPrefixes[0])
+	}
+	// removed in one transaction like the plain layout
+	return kv.MetaKv.MultiSaveAndRemoveWithPrefix(nil, scanPrefixes)
+}
+
+func (kv *SaltedKV) MultiSaveAndRemove(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
+	return kv.MetaKv.MultiSaveAndRemove(kv.saltSaves(saves), kv.saltKeys(removals), kv.saltPredicates(preds)...)
+}
+
+func (kv *SaltedKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
+	var scanPrefixes []string
+	for _, prefix := range removals {
+		scanPrefixes = append(scanPrefixes, kv.scanPrefixes(prefix)...)
+	}
+	return kv.MetaKv.MultiSaveAndRemoveWithPrefix(kv.saltSaves(saves), scanPrefixes, kv.saltPredicates(preds)...)
+}
+
+func (kv *SaltedKV) CompareVersionAndSwap(key string, version int64, target string) (bool, error) {
+	return kv.MetaKv.CompareVersionAndSwap(kv.salt(key), version, target)
+}
+
+// Rebucket moves the keys under prefix of metaKv to the layout of buckets buckets and records
+// the bucket count, 0 buckets moves them back to the plain layout. The keys could be in the plain
+// layout or salted with any bucket count before. It must run while no SaltedKV is writing under
+// prefix, the keys are moved in batches, so rerun it if it fails halfway.
+func Rebucket(metaKv kv.MetaKv, prefix string, buckets int) error {
+	if buckets < 0 {
+		return merr.WrapErrParameterInvalidMsg("bucket count must not be negative, got %d", buckets)
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return merr.WrapErrParameterInvalidMsg("salted prefix must not be empty")
+	}
+
+	fullPrefix := metaKv.GetPath(prefix) + "/"
+	keys, values, err := metaKv.LoadWithPrefix(prefix)
+	if err != nil {
+		return err
+	}
+	saves := make(map[string]string)
+	var removals []string
+	flush := func() error {
+		if len(saves) == 0 {
+			return nil
+		}
+		if err := metaKv.MultiSaveAndRemove(saves, removals); err != nil {
+			return errors.Wrapf(err, "failed to rebucket keys of prefix %s", prefix)
+		}
+		saves = make(map[string]string)
+		removals = nil
+		return nil
+	}
+	for i, fullKey := range keys {
+		if !strings.HasPrefix(fullKey, fullPrefix) {
+			continue
+		}
+		stored := fullKey[len(fullPrefix):]
+		rest := trimBucketSegment(stored)
+		target := rest
+		if buckets > 0 {
+			target = bucketSegment(rest, buckets) + "/" + rest
+		}
+		if target == stored {
+			continue
+		}
+		saves[prefix+"/"+target] = values[i]
+		removals = append(removals, prefix+"/"+stored)
+		if len(saves) >= rebucketBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if buckets == 0 {
+		return metaKv.Remove(bucketConfigKey(prefix))
+	}
+	return metaKv.Save(bucketConfigKey(prefix), strconv.Itoa(buckets))
+}
@@ -0,0 +1,248 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saltedkv
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/internal/kv"
+	"github.com/milvus-io/milvus/internal/kv/predicates"
+	tikvkv "github.com/milvus-io/milvus/internal/kv/tikv"
+	"github.com/milvus-io/milvus/pkg/common"
+	"github.com/milvus-io/milvus/pkg/util/paramtable"
+	"github.com/milvus-io/milvus/pkg/util/tikv"
+)
+
+func TestMain(m *testing.M) {
+	paramtable.Init()
+	os.Exit(m.Run())
+}
+
+func newTestKV(t *testing.T, rootPath string) kv.MetaKv {
+	metaKv := tikvkv.NewTiKV(tikv.SetupLocalTxn(), rootPath)
+	require.NoError(t, metaKv.RemoveWithPrefix(""))
+	t.Cleanup(func() {
+		metaKv.RemoveWithPrefix("")
+		metaKv.Close()
+	})
+	return metaKv
+}
+
+func TestSaltedKV(t *testing.T) {
+	metaKv := newTestKV(t, "/salted/test")
+	saltedKv, err := NewSaltedKV(metaKv, 4, "channel-cp")
+	require.NoError(t, err)
+
+	expected := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		expected[fmt.Sprintf("channel-cp/ch%02d", i)] = fmt.Sprintf("cp%d", i)
+	}
+	require.NoError(t, saltedKv.MultiSave(expected))
+	require.NoError(t, saltedKv.Save("other/key", "plain"))
+
+	t.Run("layout", func(t *testing.T) {
+		rawKeys, _, err := metaKv.LoadWithPrefix("channel-cp/")
+		require.NoError(t, err)
+		buckets := make(map[string]struct{})
+		for _, key := range rawKeys {
+			rest := strings.TrimPrefix(key, metaKv.GetPath("channel-cp")+"/")
+			if rest == key {
+				continue
+			}
+			assert.True(t, strings.HasPrefix(rest, bucketSegmentPrefix), key)
+			buckets[strings.SplitN(rest, "/", 2)[0]] = struct{}{}
+		}
+		assert.Len(t, buckets, 4)
+
+		// keys of other prefixes are untouched
+		value, err := metaKv.Load("other/key")
+		assert.NoError(t, err)
+		assert.Equal(t, "plain", value)
+	})
+
+	t.Run("point reads", func(t *testing.T) {
+		value, err := saltedKv.Load("channel-cp/ch07")
+		assert.NoError(t, err)
+		assert.Equal(t, "cp7", value)
+		values, err := saltedKv.MultiLoad([]string{"channel-cp/ch01", "other/key"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"cp1", "plain"}, values)
+		has, err := saltedKv.Has("channel-cp/ch49")
+		assert.NoError(t, err)
+		assert.True(t, has)
+
+		_, err = saltedKv.Load("channel-cp/missing")
+		assert.True(t, common.IsKeyNotExistError(err))
+		assert.Contains(t, err.Error(), saltedKv.GetPath("channel-cp/missing"))
+	})
+
+	t.Run("scan and merge", func(t *testing.T) {
+		expectedKeys := make([]string, 0, len(expected))
+		for key := range expected {
+			expectedKeys = append(expectedKeys, key)
+		}
+		sort.Strings(expectedKeys)
+		fullKeys := func(keys ...string) []string {
+			result := make([]string, 0, len(keys))
+			for _, key := range keys {
+				result = append(result, saltedKv.GetPath(key))
+			}
+			return result
+		}
+
+		keys, values, err := saltedKv.LoadWithPrefix("channel-cp/")
+		assert.NoError(t, err)
+		assert.Equal(t, fullKeys(expectedKeys...), keys)
+		for i, key := range expectedKeys {
+			assert.Equal(t, expected[key], values[i])
+		}
+
+		// inside the salted prefix, all buckets are scanned
+		keys, values, err = saltedKv.LoadWithPrefix("channel-cp/ch1")
+		assert.NoError(t, err)
+		assert.Equal(t, fullKeys(expectedKeys[10:20]...), keys)
+		assert.Equal(t, "cp10", values[0])
+
+		// covering the salted prefix, the recorded bucket count is visible
+		keys, _, err = saltedKv.LoadWithPrefix("")
+		assert.NoError(t, err)
+		all := append(append([]string{}, expectedKeys...), bucketConfigKey("channel-cp"), "other/key")
+		sort.Strings(all)
+		assert.Equal(t, fullKeys(all...), keys)
+
+		var walked []string
+		err = saltedKv.WalkWithPrefix("channel-cp/ch1", 3, func(key []byte, value []byte) error {
+			walked = append(walked, string(key))
+			assert.Equal(t, expected[strings.TrimPrefix(string(key), saltedKv.GetPath("")+"/")], string(value))
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, fullKeys(expectedKeys[10:20]...), walked)
+
+		has, err := saltedKv.HasPrefix("channel-cp/ch4")
+		assert.NoError(t, err)
+		assert.True(t, has)
+		has, err = saltedKv.HasPrefix("channel-cp/ch9")
+		assert.NoError(t, err)
+		assert.False(t, has)
+	})
+
+	t.Run("writes", func(t *testing.T) {
+		err := saltedKv.MultiSaveAndRemove(map[string]string{"channel-cp/ch00": "cp0-new"}, []string{"channel-cp/ch01"},
+			predicates.ValueEqual("channel-cp/ch02", "cp2"))
+		assert.NoError(t, err)
+		err = saltedKv.MultiSaveAndRemove(map[string]string{"channel-cp/ch00": "cp0-newer"}, nil,
+			predicates.ValueEqual("channel-cp/ch02", "wrong"))
+		assert.Error(t, err)
+		value, err := saltedKv.Load("channel-cp/ch00")
+		assert.NoError(t, err)
+		assert.Equal(t, "cp0-new", value)
+		has, err := saltedKv.Has("channel-cp/ch01")
+		assert.NoError(t, err)
+		assert.False(t, has)
+
+		err = saltedKv.RemoveWithPrefix("channel-cp/ch1")
+		assert.NoError(t, err)
+		keys, _, err := saltedKv.LoadWithPrefix("channel-cp/ch1")
+		assert.NoError(t, err)
+		assert.Empty(t, keys)
+		keys, _, err = saltedKv.LoadWithPrefix("channel-cp/")
+		assert.NoError(t, err)
+		assert.Len(t, keys, 50-1-10)
+
+		err = saltedKv.MultiSaveAndRemoveWithPrefix(nil, []string{"channel-cp/ch2", "other"})
+		assert.NoError(t, err)
+		keys, _, err = saltedKv.LoadWithPrefix("channel-cp/")
+		assert.NoError(t, err)
+		assert.Len(t, keys, 50-1-20)
+		has, err = metaKv.Has("other/key")
+		assert.NoError(t, err)
+		assert.False(t, has)
+	})
+}
+
+func TestRebucket(t *testing.T) {
+	defer func(size int) { rebucketBatchSize = size }(rebucketBatchSize)
+	rebucketBatchSize = 7
+
+	metaKv := newTestKV(t, "/salted/rebucket")
+	expected := make(map[string]string)
+	for i := 0; i < 30; i++ {
+		expected[fmt.Sprintf("task/%d", i)] = fmt.Sprintf("value%d", i)
+	}
+	// written in the plain layout
+	require.NoError(t, metaKv.MultiSave(expected))
+	require.NoError(t, metaKv.Save("other/key", "plain"))
+
+	check := func(saltedKv *SaltedKV) {
+		keys, values, err := saltedKv.LoadWithPrefix("task/")
+		require.NoError(t, err)
+		actual := make(map[string]string)
+		for i, key := range keys {
+			actual[strings.TrimPrefix(key, saltedKv.GetPath("")+"/")] = values[i]
+		}
+		assert.Equal(t, expected, actual)
+		value, err := metaKv.Load("other/key")
+		assert.NoError(t, err)
+		assert.Equal(t, "plain", value)
+	}
+
+	require.NoError(t, Rebucket(metaKv, "task", 4))
+	saltedKv, err := NewSaltedKV(metaKv, 4, "task")
+	require.NoError(t, err)
+	check(saltedKv)
+
+	// readers and writers must agree on the bucket count
+	_, err = NewSaltedKV(metaKv, 8, "task")
+	mismatch := &ErrBucketCountMismatch{}
+	assert.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, &ErrBucketCountMismatch{Prefix: "task", Recorded: 4, Configured: 8}, mismatch)
+
+	require.NoError(t, Rebucket(metaKv, "task", 8))
+	// rerun is a no-op
+	require.NoError(t, Rebucket(metaKv, "task", 8))
+	saltedKv, err = NewSaltedKV(metaKv, 8, "task")
+	require.NoError(t, err)
+	check(saltedKv)
+	rawKeys, _, err := metaKv.LoadWithPrefix("task/")
+	require.NoError(t, err)
+	assert.Len(t, rawKeys, len(expected))
+
+	// back to the plain layout
+	require.NoError(t, Rebucket(metaKv, "task", 0))
+	for key, value := range expected {
+		actual, err := metaKv.Load(key)
+		assert.NoError(t, err)
+		assert.Equal(t, value, actual)
+	}
+	has, err := metaKv.Has(bucketConfigKey("task"))
+	assert.NoError(t, err)
+	assert.False(t, has)
+
+	_, err = NewSaltedKV(metaKv, 0, "task")
+	assert.Error(t, err)
+	_, err = NewSaltedKV(metaKv, 4, "/")
+	assert.Error(t, err)
+	assert.Error(t, Rebucket(metaKv, "task", -1))
+}
@@ -0,0 +1,240 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	tikv "github.com/tikv/client-go/v2/kv"
+	"github.com/tikv/client-go/v2/txnkv/txnsnapshot"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/internal/kv/predicates"
+)
+
+// The byte variants of the operations store and return the values as they are, e.g. serialized
+// protobufs, without copying them into strings. They share the stored encoding with the string
+// operations, so a value saved by SaveBytes can be loaded by Load and the other way around.
+//
+// As for the strings, a value is stored as it is after ValueHeader and plainValueTag, even if empty
+// or EmptyValueByte, or in the legacy encoding if WriteValueHeader is disabled, which stores an empty
+// value as EmptyValueByte and rejects the value EmptyValueByte: the nodes not knowing ValueHeader read
+// it as empty, so the sentinel must not be written as a real value. A nil value is saved as an empty
+// one and loaded back as an empty, non-nil slice.
+
+// encodeBytesValue is convertEmptyStringToByte of a byte value.
+func encodeBytesValue(value []byte) ([]byte, error) {
+	if !WriteValueHeader {
+		return encodeLegacyValue(value)
+	}
+	return encodeValue(value), nil
+}
+
+// encodeBytesSaves is encodeSaves of byte values.
+func (kv *txnTiKV) encodeBytesSaves(op string, saves map[string][]byte) (map[string][]byte, error) {
+	encoded := make(map[string][]byte, len(saves))
+	for key, value := range saves {
+		key = path.Join(kv.rootPath, key)
+		byteValue, err := encodeBytesValue(value)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Failed to cast to byte (%s:%s) for %s", key, redactValue(key, string(value)), op))
+		}
+		encoded[key] = kv.compressValue(byteValue)
+	}
+	return encoded, nil
+}
+
+// SaveBytes is Save of a byte value.
+func (kv *txnTiKV) SaveBytes(key string, value []byte) (err error) {
+	defer kv.finishOp(&err, "SaveBytes", key, 1, time.Now())
+	relativeKey := key
+	key = path.Join(kv.rootPath, key)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV SaveBytes() error", zap.String("key", key), zap.Int("valueSize", len(value)))
+
+	byteValue, err := encodeBytesValue(value)
+	if err != nil {
+		loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to cast to byte (%s:%s) for SaveBytes", key, redactValue(key, string(value))))
+		return loggingErr
+	}
+	loggingErr = kv.putStoredValue(ctx, key, kv.compressValue(byteValue))
+	if loggingErr != nil {
+		return loggingErr
+	}
+	kv.hooks.NotifySaveBytes(map[string][]byte{relativeKey: value})
+	return nil
+}
+
+// LoadBytes is Load returning the value as bytes. It doesn't share reads with the Loads of
+// WithSingleFlightLoad.
+func (kv *txnTiKV) LoadBytes(key string) (_ []byte, err error) {
+	defer kv.finishOp(&err, "LoadBytes", key, 1, time.Now())
+	return kv.loadBytes("LoadBytes", key, kv.replicaRead)
+}
+
+// MultiSaveBytes is MultiSave of byte values.
+func (kv *txnTiKV) MultiSaveBytes(kvs map[string][]byte) (err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "MultiSaveBytes", "", len(kvs), start)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV MultiSaveBytes() error", zap.Int("len", len(kvs)))
+
+	if loggingErr = checkTxnOps(len(kvs)); loggingErr != nil {
+		return loggingErr
+	}
+	saves, err := kv.encodeBytesSaves("MultiSaveBytes", kvs)
+	if err != nil {
+		loggingErr = err
+		return loggingErr
+	}
+	if loggingErr = kv.saveAndRemove(ctx, client, "MultiSaveBytes", saves, nil); loggingErr != nil {
+		return loggingErr
+	}
+	kv.checkSlowOp(start, "MultiSaveBytes", len(kvs), mapValuesSize(kvs), zap.Int("len", len(kvs)))
+	kv.hooks.NotifySaveBytes(kvs)
+	return nil
+}
+
+// MultiLoadBytes is MultiLoad returning the values as bytes. The value of a missing key is nil.
+func (kv *txnTiKV) MultiLoadBytes(keys []string) (_ [][]byte, err error) {
+	defer kv.finishOp(&err, "MultiLoadBytes", "", len(keys), time.Now())
+	return kv.multiLoad("MultiLoadBytes", keys)
+}
+
+// MultiSaveBytesAndRemove is MultiSaveAndRemove of byte values.
+func (kv *txnTiKV) MultiSaveBytesAndRemove(saves map[string][]byte, removals []string, preds ...predicates.Predicate) (err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "MultiSaveBytesAndRemove", "", len(saves)+len(removals), start)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV MultiSaveBytesAndRemove error", zap.Strings("removes", removals), zap.Int("saveLength", len(saves)), zap.Int("removeLength", len(removals)))
+
+	if loggingErr = checkTxnOps(len(saves) + len(removals)); loggingErr != nil {
+		return loggingErr
+	}
+	encoded, err := kv.encodeBytesSaves("MultiSaveBytesAndRemove", saves)
+	if err != nil {
+		loggingErr = err
+		return loggingErr
+	}
+	if loggingErr = kv.saveAndRemove(ctx, client, "MultiSaveBytesAndRemove", encoded, removals, preds...); loggingErr != nil {
+		return loggingErr
+	}
+	kv.checkSlowOp(start, "MultiSaveBytesAndRemove", len(saves)+len(removals), mapValuesSize(saves), zap.Int("saveLength", len(saves)), zap.Strings("removals", removals))
+	kv.hooks.NotifySaveBytes(saves)
+	kv.hooks.NotifyRemove(removals...)
+	return nil
+}
+
+// LoadBytesWithPrefix is LoadWithPrefix returning the values as bytes.
+func (kv *txnTiKV) LoadBytesWithPrefix(prefix string) (_ []string, _ [][]byte, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "LoadBytesWithPrefix", prefix, 1, start)
+	prefix = path.Join(kv.rootPath, prefix)
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV LoadBytesWithPrefix() error", zap.String("prefix", prefix))
+
+	ctx, cancel := withTimeout(kv.baseContext(), ScanTimeout)
+	defer cancel()
+	ss := getSnapshot(client, kv.snapshotScanSize(), kv.replicaRead)
+	keys, values, err := scanRangeBytes(ctx, ss, keyRange{start: []byte(prefix), end: tikv.PrefixNextKey([]byte(prefix))})
+	if err != nil {
+		loggingErr = err
+		return nil, nil, loggingErr
+	}
+	kv.checkSlowOp(start, "LoadBytesWithPrefix", len(keys), valuesSize(values), zap.String("prefix", prefix))
+	return keys, values, nil
+}
+
+// scanRangeBytes is scanRange returning the values as bytes. The keys of a page are sliced from a
+// single string and its values from a single buffer, capped so that appending to a value copies it.
+func scanRangeBytes(ctx context.Context, ss *txnsnapshot.KVSnapshot, r keyRange) ([]string, [][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, fmt.Sprintf("LoadBytesWithPrefix() stopped for range [%s, %s)", r.start, r.end))
+	}
+	iter, err := ss.Iter(r.start, r.end)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, fmt.Sprintf("Failed to create iterater for LoadBytesWithPrefix() for range [%s, %s)", r.start, r.end))
+	}
+	defer iter.Close()
+
+	var keys []string
+	var values [][]byte
+	// the key buffer is reused by the pages as the keys are copied into strings, the value buffer is not
+	var keyBuf, valueBuf []byte
+	keyEnds := make([]int, 0, scanPageSize)
+	valueEnds := make([]int, 0, scanPageSize)
+	flush := func() {
+		if len(keyEnds) == 0 {
+			return
+		}
+		str := string(keyBuf)
+		keyBegin, valueBegin := 0, 0
+		for i := range keyEnds {
+			keys = append(keys, str[keyBegin:keyEnds[i]])
+			values = append(values, valueBuf[valueBegin:valueEnds[i]:valueEnds[i]])
+			keyBegin, valueBegin = keyEnds[i], valueEnds[i]
+		}
+		keyBuf, keyEnds, valueEnds = keyBuf[:0], keyEnds[:0], valueEnds[:0]
+		valueBuf = nil
+	}
+
+	for iter.Valid() {
+		val := iter.Value()
+		observeValueSizeBytes(iter.Key(), len(val), largeValueOpScan)
+		if !isExpired(val) {
+			value, err := decodeValue(val)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, fmt.Sprintf("Failed to decode key %s for LoadBytesWithPrefix()", string(iter.Key())))
+			}
+			keyBuf = append(keyBuf, iter.Key()...)
+			keyEnds = append(keyEnds, len(keyBuf))
+			valueBuf = append(valueBuf, value...)
+			valueEnds = append(valueEnds, len(valueBuf))
+		}
+		if len(keyEnds) >= scanPageSize {
+			flush()
+			if err = ctx.Err(); err != nil {
+				return nil, nil, errors.Wrap(err, fmt.Sprintf("LoadBytesWithPrefix() stopped after key %s for range [%s, %s)", string(iter.Key()), r.start, r.end))
+			}
+		}
+		if err = iter.Next(); err != nil {
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("Failed to iterate for LoadBytesWithPrefix() for range [%s, %s)", r.start, r.end))
+		}
+	}
+	flush()
+	return keys, values, nil
+}
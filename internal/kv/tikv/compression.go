@@ -0,0 +1,78 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"github.com/cockroachdb/errors"
+
+	"github.com/milvus-io/milvus/pkg/util/compressor"
+)
+
+// compressedValueHeader prefixes the values compressed by WithValueCompression, followed by the
+// value compressed by zstd. It starts with ValueHeader, so the compressed values are not legacy
+// values.
+const compressedValueHeader = ValueHeader + string(compressedValueTag)
+
+var compressedValueHeaderByte = []byte(compressedValueHeader)
+
+// WithValueCompression makes Save, MultiSave, MultiSaveAndRemove, MultiSaveAndRemoveWithPrevValues,
+// MultiSaveAndRemoveWithPrefix, MultiSaveChunked, MultiSaveStream, SaveWithVersionBump,
+// CompareVersionAndSwap and the byte variants of the saves compress the values of at least minSize
+// bytes by zstd, e.g. for the index metas of megabytes, if it makes them smaller. The values are decompressed by all the
+// reads whether the option is set or not, so the compressed and uncompressed values coexist: the
+// nodes can enable it one by one, and the values saved before stay uncompressed until saved again.
+// The other writes and SaveWithTTL don't compress the values. The nodes of the versions before the
+// compression read the compressed values as they are stored, so all the nodes sharing the root path
+// must be upgraded before any enables it.
+func WithValueCompression(minSize int) Option {
+	return func(kv *txnTiKV) {
+		kv.compressMinSize = minSize
+	}
+}
+
+// ErrCorruptedValue is returned by the reads of a stored value failing to decode, e.g. a compressed
+// value failing to decompress, which means it's corrupted as the values are checksummed.
+var ErrCorruptedValue = errors.New("txnTiKV value is corrupted")
+
+// compressValue returns the compressed stored value of the stored value, with ValueHeader or in the
+// legacy encoding, if the compression is enabled and it makes the value smaller, or the stored value.
+func (kv *txnTiKV) compressValue(stored []byte) []byte {
+	value, err := decodeValue(stored)
+	if err != nil || kv.compressMinSize <= 0 || len(value) < kv.compressMinSize {
+		return stored
+	}
+	res := make([]byte, len(compressedValueHeaderByte), len(stored))
+	copy(res, compressedValueHeaderByte)
+	res = compressor.ZstdCompressBytes(value, res)
+	if len(res) >= len(stored) {
+		return stored
+	}
+	return res
+}
+
+// decompressValue returns the value of the compressed stored value, or ErrCorruptedValue if it fails
+// to decompress.
+func decompressValue(stored []byte) ([]byte, error) {
+	value, err := compressor.ZstdDecompressBytes(stored[len(compressedValueHeaderByte):], nil)
+	if err != nil {
+		return nil, errors.Wrapf(ErrCorruptedValue, "failed to decompress value of %d bytes: %s", len(stored), err.Error())
+	}
+	if value == nil {
+		return []byte{}, nil
+	}
+	return value, nil
+}
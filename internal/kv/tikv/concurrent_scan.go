@@ -0,0 +1,123 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"path"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	tikv "github.com/tikv/client-go/v2/kv"
+	tilib "github.com/tikv/client-go/v2/tikv"
+	"github.com/tikv/client-go/v2/txnkv"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/milvus-io/milvus/pkg/util/merr"
+)
+
+// keyRange is the key range [start, end), an empty end means no upper bound.
+type keyRange struct {
+	start []byte
+	end   []byte
+}
+
+// splitByRegion splits [start, end) by the region boundaries, in key order, within the timeout
+// and the context of the instance.
+func (kv *txnTiKV) splitByRegion(txn *txnkv.Client, start, end []byte) ([]keyRange, error) {
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+	bo := tilib.NewBackoffer(ctx, int(kv.timeout().Milliseconds()))
+	regions, err := txn.GetRegionCache().LoadRegionsInKeyRange(bo, start, end)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]keyRange, 0, len(regions))
+	for _, region := range regions {
+		r := keyRange{start: start, end: end}
+		if bytes.Compare(region.StartKey(), r.start) > 0 {
+			r.start = region.StartKey()
+		}
+		if regionEnd := region.EndKey(); len(regionEnd) > 0 && (len(r.end) == 0 || bytes.Compare(regionEnd, r.end) < 0) {
+			r.end = regionEnd
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		ranges = append(ranges, keyRange{start: start, end: end})
+	}
+	return ranges, nil
+}
+
+// LoadWithPrefixConcurrent is LoadWithPrefix scanning the regions covered by prefix with up to
+// workers goroutines, which is much faster for a prefix spanning many regions. The result is in
+// key order like LoadWithPrefix, as the regions are disjoint and merged in order. Like
+// LoadWithPrefix, the regions are not read at the same TS. Each worker buffers the result of its
+// regions until all are done, so the memory grows with the concurrency besides the result.
+func (kv *txnTiKV) LoadWithPrefixConcurrent(prefix string, workers int) (_ []string, _ []string, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "LoadWithPrefixConcurrent", prefix, 1, start)
+	prefix = path.Join(kv.rootPath, prefix)
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV LoadWithPrefixConcurrent() error", zap.String("prefix", prefix), zap.Int("workers", workers))
+
+	if workers <= 0 {
+		loggingErr = merr.WrapErrParameterInvalidMsg("workers must be positive, got %d", workers)
+		return nil, nil, loggingErr
+	}
+
+	ranges, err := kv.splitByRegion(client, []byte(prefix), tikv.PrefixNextKey([]byte(prefix)))
+	if err != nil {
+		loggingErr = errors.Wrap(err, "Failed to split LoadWithPrefixConcurrent() by regions")
+		return nil, nil, loggingErr
+	}
+
+	type shard struct {
+		keys   []string
+		values []string
+	}
+	scanCtx, cancelScan := withTimeout(kv.baseContext(), ScanTimeout)
+	defer cancelScan()
+	shards := make([]shard, len(ranges))
+	// the group context stops the other workers once one fails
+	group, groupCtx := errgroup.WithContext(scanCtx)
+	group.SetLimit(workers)
+	for i, r := range ranges {
+		i, r := i, r
+		group.Go(func() error {
+			keys, values, err := scanRange(groupCtx, getSnapshot(client, kv.snapshotScanSize(), kv.replicaRead), r)
+			shards[i] = shard{keys: keys, values: values}
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		loggingErr = errors.Wrap(err, "Failed to scan for LoadWithPrefixConcurrent()")
+		return nil, nil, loggingErr
+	}
+
+	var keys, values []string
+	for _, shard := range shards {
+		keys = append(keys, shard.keys...)
+		values = append(values, shard.values...)
+	}
+	kv.checkSlowOp(start, "LoadWithPrefixConcurrent", len(keys), valuesSize(values), zap.String("prefix", prefix), zap.Int("regions", len(ranges)))
+	return keys, values, nil
+}
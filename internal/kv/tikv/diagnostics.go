@@ -0,0 +1,277 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/internal/kv/predicates"
+	"github.com/milvus-io/milvus/pkg/log"
+)
+
+// SelfTestPrefix is the prefix, relative to the kv root path, of the scratch keys written by SelfTest.
+const SelfTestPrefix = "__self_test__"
+
+// OperationResult is the result of one operation of SelfTest.
+type OperationResult struct {
+	Name    string
+	Latency time.Duration
+	Err     error
+}
+
+// DiagnosticsReport is the report of SelfTest.
+type DiagnosticsReport struct {
+	// ScratchPrefix is the prefix the operations run against, relative to the root path
+	ScratchPrefix string
+	Results       []OperationResult
+}
+
+// Passed returns whether all operations succeeded.
+func (r DiagnosticsReport) Passed() bool {
+	for _, result := range r.Results {
+		if result.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (r DiagnosticsReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "self test on %s:\n", r.ScratchPrefix)
+	for _, result := range r.Results {
+		state := "ok"
+		if result.Err != nil {
+			state = "failed, " + result.Err.Error()
+		}
+		fmt.Fprintf(&sb, "  %-16s %-12s %s\n", result.Name, result.Latency.String(), state)
+	}
+	return sb.String()
+}
+
+// SelfTest runs Save, Load, LoadWithPrefix, CompareAndSwap and Remove round-trips against a scratch
+// prefix under SelfTestPrefix, and reports the latency and the result of each operation. It stops at
+// the first failure, which is also returned as the error. The scratch keys are removed at last,
+// other keys are never touched.
+func (kv *txnTiKV) SelfTest(ctx context.Context) (DiagnosticsReport, error) {
+	scratch := path.Join(SelfTestPrefix, fmt.Sprint(time.Now().UnixNano()))
+	report := DiagnosticsReport{ScratchPrefix: scratch}
+	defer func() {
+		if err := kv.RemoveWithPrefix(scratch); err != nil {
+			log.Warn("failed to clean up self test keys", zap.String("prefix", scratch), zap.Error(err))
+		}
+	}()
+
+	key := path.Join(scratch, "key")
+	steps := []struct {
+		name string
+		fn   func() error
+	}{
+		{"Save", func() error {
+			return kv.Save(key, "value")
+		}},
+		{"Load", func() error {
+			return expectValue(kv.Load(key))("value")
+		}},
+		{"LoadWithPrefix", func() error {
+			if err := kv.MultiSave(map[string]string{path.Join(scratch, "key2"): "value2"}); err != nil {
+				return err
+			}
+			keys, values, err := kv.LoadWithPrefix(scratch)
+			if err != nil {
+				return err
+			}
+			if len(keys) != 2 || values[0] != "value" || values[1] != "value2" {
+				return errors.Newf("unexpected keys %v and values %v", keys, values)
+			}
+			return nil
+		}},
+		{"CompareAndSwap", func() error {
+			err := kv.MultiSaveAndRemove(map[string]string{key: "swapped"}, nil, predicates.ValueEqual(key, "value"))
+			if err != nil {
+				return err
+			}
+			// the value is changed, so the same swap must fail
+			err = kv.MultiSaveAndRemove(map[string]string{key: "swapped again"}, nil, predicates.ValueEqual(key, "value"))
+			if err == nil {
+				return errors.New("swap with stale value succeeded")
+			}
+			return expectValue(kv.Load(key))("swapped")
+		}},
+		{"Remove", func() error {
+			if err := kv.Remove(key); err != nil {
+				return err
+			}
+			has, err := kv.Has(key)
+			if err != nil {
+				return err
+			}
+			if has {
+				return errors.New("key still exists after removed")
+			}
+			return nil
+		}},
+	}
+
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		start := time.Now()
+		err := step.fn()
+		report.Results = append(report.Results, OperationResult{Name: step.name, Latency: time.Since(start), Err: err})
+		if err != nil {
+			return report, errors.Wrapf(err, "self test %s failed", step.name)
+		}
+	}
+	return report, nil
+}
+
+func expectValue(value string, err error) func(expected string) error {
+	return func(expected string) error {
+		if err != nil {
+			return err
+		}
+		if value != expected {
+			return errors.Newf("expect value %s, got %s", expected, value)
+		}
+		return nil
+	}
+}
+
+// WaitForPrefixStateInterval is the interval WaitForPrefixState polls the prefix at.
+var WaitForPrefixStateInterval = 100 * time.Millisecond
+
+// ValueMismatch is a key whose value differs from the expected one.
+type ValueMismatch struct {
+	Key      string
+	Expected string
+	Actual   string
+}
+
+// PrefixStateDiff is the difference between the contents of a prefix and the expected ones,
+// the keys are relative to the root path and sorted.
+type PrefixStateDiff struct {
+	// Missing are the expected keys not found
+	Missing []string
+	// Unexpected are the keys found but not expected
+	Unexpected []string
+	Mismatched []ValueMismatch
+}
+
+// Empty returns whether the contents equal the expected ones.
+func (d PrefixStateDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Unexpected) == 0 && len(d.Mismatched) == 0
+}
+
+func (d PrefixStateDiff) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "missing keys: %v, unexpected keys: %v, mismatched values: [", d.Missing, d.Unexpected)
+	for i, mismatch := range d.Mismatched {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%s: expected %s, actual %s", mismatch.Key,
+			redactValue(mismatch.Key, mismatch.Expected), redactValue(mismatch.Key, mismatch.Actual))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// ErrPrefixStateNotReached is returned by WaitForPrefixState if the prefix doesn't reach the expected
+// contents before the context is done.
+type ErrPrefixStateNotReached struct {
+	Prefix string
+	// Diff is the difference observed by the last poll loading the prefix successfully
+	Diff PrefixStateDiff
+	// LoadErr is the error of the last poll failing to load the prefix, if any
+	LoadErr error
+	Err     error
+}
+
+func (e *ErrPrefixStateNotReached) Error() string {
+	msg := fmt.Sprintf("prefix %s doesn't reach the expected state: %s, %s", e.Prefix, e.Err.Error(), e.Diff.String())
+	if e.LoadErr != nil {
+		msg += ", last load error: " + e.LoadErr.Error()
+	}
+	return msg
+}
+
+func (e *ErrPrefixStateNotReached) Unwrap() error {
+	return e.Err
+}
+
+// diffPrefixState returns the difference between the keys and values loaded and the expected ones.
+func diffPrefixState(keys, values []string, expected map[string]string) PrefixStateDiff {
+	var diff PrefixStateDiff
+	found := make(map[string]struct{}, len(keys))
+	for i, key := range keys {
+		found[key] = struct{}{}
+		value, ok := expected[key]
+		if !ok {
+			diff.Unexpected = append(diff.Unexpected, key)
+		} else if value != values[i] {
+			diff.Mismatched = append(diff.Mismatched, ValueMismatch{Key: key, Expected: value, Actual: values[i]})
+		}
+	}
+	for key := range expected {
+		if _, ok := found[key]; !ok {
+			diff.Missing = append(diff.Missing, key)
+		}
+	}
+	sort.Strings(diff.Missing)
+	return diff
+}
+
+// WaitForPrefixState polls the prefix until its contents exactly equal expected, whose keys are
+// relative to the root path like the ones of Save, or until ctx is done, when an
+// ErrPrefixStateNotReached with the last observed difference is returned.
+// Failing to load the prefix is retried on the next poll. It's meant for tests waiting for the meta to converge.
+func (kv *txnTiKV) WaitForPrefixState(ctx context.Context, prefix string, expected map[string]string) (err error) {
+	defer kv.finishOp(&err, "WaitForPrefixState", prefix, 1, time.Now())
+	ticker := time.NewTicker(WaitForPrefixStateInterval)
+	defer ticker.Stop()
+
+	rootPrefix := strings.TrimSuffix(kv.rootPath, "/") + "/"
+	var diff PrefixStateDiff
+	for {
+		keys, values, err := kv.LoadWithPrefix(prefix)
+		if err == nil {
+			for i := range keys {
+				keys[i] = strings.TrimPrefix(keys[i], rootPrefix)
+			}
+			diff = diffPrefixState(keys, values, expected)
+			if diff.Empty() {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return &ErrPrefixStateNotReached{Prefix: prefix, Diff: diff, LoadErr: err, Err: ctx.Err()}
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/cockroachdb/errors"
+	tikv "github.com/tikv/client-go/v2/kv"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/log"
+)
+
+// PrefixIterator iterates over the key-value pairs with a prefix in key order, fetching them from TiKV
+// in batches as it goes, see NewPrefixIterator:
+//
+//	iter := kv.NewPrefixIterator(prefix, 0)
+//	defer iter.Close()
+//	for iter.Next() {
+//		process(iter.Key(), iter.Value())
+//	}
+//	if err := iter.Err(); err != nil {
+//		...
+//	}
+type PrefixIterator struct {
+	ctx     context.Context
+	prefix  string
+	iter    snapshotIterator
+	release func()
+	// started is true once the iterator is positioned at the first pair
+	started bool
+	key     []byte
+	value   []byte
+	err     error
+	closed  bool
+}
+
+// NewPrefixIterator returns an iterator over the key-value pairs with the input prefix, read from a
+// snapshot of the time it's created, in batches of paginationSize pairs, the scan size of the instance
+// if not positive, see WithScanSize. Unlike WalkWithPrefix, it's not bounded by ScanTimeout, as the
+// caller decides the pace, but it stops with the error of the context of the instance once it's done,
+// see WithContext. The iterator must be closed: while it's open, it keeps the client it reads from, so a client replaced
+// by Reconnect is not closed until the iterators on it are.
+func (kv *txnTiKV) NewPrefixIterator(prefix string, paginationSize int) *PrefixIterator {
+	client, release := kv.acquireClient()
+	prefix = path.Join(kv.rootPath, prefix)
+	if paginationSize <= 0 {
+		paginationSize = kv.snapshotScanSize()
+	}
+	it := &PrefixIterator{ctx: kv.baseContext(), prefix: prefix, release: release}
+
+	ss := kv.snapshot(client, paginationSize, kv.replicaRead)
+	iter, err := ss.Iter([]byte(prefix), tikv.PrefixNextKey([]byte(prefix)))
+	if err != nil {
+		it.fail(errors.Wrap(err, fmt.Sprintf("Failed to create iterater for %s during PrefixIterator", prefix)))
+		return it
+	}
+	it.iter = iter
+	return it
+}
+
+// Next moves to the next pair, returning false at the end of the pairs or on an error, see Err.
+func (it *PrefixIterator) Next() bool {
+	if it.closed || it.err != nil {
+		return false
+	}
+	it.key, it.value = nil, nil
+	if it.started {
+		if err := it.iter.Next(); err != nil {
+			it.fail(errors.Wrap(err, fmt.Sprintf("Failed to move Iterator after key %s for PrefixIterator", string(it.iter.Key()))))
+			return false
+		}
+	}
+	it.started = true
+	for it.iter.Valid() {
+		if err := it.ctx.Err(); err != nil {
+			it.fail(errors.Wrap(err, fmt.Sprintf("PrefixIterator stopped before key %s", string(it.iter.Key()))))
+			return false
+		}
+		if !isExpired(it.iter.Value()) {
+			value, err := decodeValue(it.iter.Value())
+			if err != nil {
+				it.fail(errors.Wrap(err, fmt.Sprintf("Failed to decode key %s for PrefixIterator", string(it.iter.Key()))))
+				return false
+			}
+			it.key, it.value = it.iter.Key(), value
+			observeValueSizeBytes(it.key, len(it.iter.Value()), largeValueOpScan)
+			return true
+		}
+		if err := it.iter.Next(); err != nil {
+			it.fail(errors.Wrap(err, fmt.Sprintf("Failed to move Iterator after key %s for PrefixIterator", string(it.iter.Key()))))
+			return false
+		}
+	}
+	return false
+}
+
+// Key returns the full key of the current pair, valid until the next call of Next.
+func (it *PrefixIterator) Key() []byte {
+	return it.key
+}
+
+// Value returns the value of the current pair, valid until the next call of Next.
+func (it *PrefixIterator) Value() []byte {
+	return it.value
+}
+
+// Err returns the error stopping the iterator, nil if it reached the end of the pairs or is closed.
+func (it *PrefixIterator) Err() error {
+	return it.err
+}
+
+// Close releases the iterator, it can be called more than once, and before the end of the pairs.
+func (it *PrefixIterator) Close() {
+	if it.closed {
+		return
+	}
+	it.closed = true
+	it.key, it.value = nil, nil
+	if it.iter != nil {
+		it.iter.Close()
+	}
+	it.release()
+}
+
+func (it *PrefixIterator) fail(err error) {
+	it.err = err
+	log.Warn("txnTiKV PrefixIterator error", zap.String("prefix", it.prefix), zap.Error(err))
+}
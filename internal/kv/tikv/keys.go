@@ -0,0 +1,98 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	tikv "github.com/tikv/client-go/v2/kv"
+	"go.uber.org/zap"
+)
+
+// The keys-only operations scan the keys without transferring their values from TiKV, e.g. for the
+// garbage collection of large segment metas. As the values are not read, the keys of the values saved
+// by SaveWithTTL are listed until they are purged, even after they expire.
+
+// LoadKeysWithPrefix returns the full keys with the input prefix, as LoadWithPrefix does, in key order.
+func (kv *txnTiKV) LoadKeysWithPrefix(prefix string) (_ []string, err error) {
+	start := time.Now()
+	defer kv.finishOp(&err, "LoadKeysWithPrefix", prefix, 1, start)
+
+	var keys []string
+	err = kv.walkKeys(kv.baseContext(), "LoadKeysWithPrefix", prefix, kv.snapshotScanSize(), func(key []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	kv.checkSlowOp(start, "LoadKeysWithPrefix", len(keys), 0, zap.String("prefix", prefix), zap.Int("count", len(keys)))
+	return keys, nil
+}
+
+// WalkKeysWithPrefix visits the full keys with the input prefix in key order, scanning paginationSize
+// keys per batch, and stops at the first error of fn. The key is only valid during the call of fn.
+func (kv *txnTiKV) WalkKeysWithPrefix(prefix string, paginationSize int, fn func(key []byte) error) (err error) {
+	start := time.Now()
+	defer kv.finishOp(&err, "WalkKeysWithPrefix", prefix, 1, start)
+	if err = kv.walkKeys(kv.baseContext(), "WalkKeysWithPrefix", prefix, paginationSize, fn); err != nil {
+		return err
+	}
+	kv.checkSlowOp(start, "WalkKeysWithPrefix", 0, 0, zap.String("prefix", prefix))
+	return nil
+}
+
+// walkKeys stops before the next key once ctx is done, with the error of ctx.
+func (kv *txnTiKV) walkKeys(ctx context.Context, op string, prefix string, paginationSize int, fn func(key []byte) error) error {
+	client, release := kv.acquireClient()
+	defer release()
+	prefix = path.Join(kv.rootPath, prefix)
+	ctx, cancel := withTimeout(ctx, ScanTimeout)
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, fmt.Sprintf("txnTiKV %s() error", op), zap.String("prefix", prefix))
+
+	ss := getSnapshot(client, paginationSize, kv.replicaRead)
+	ss.SetKeyOnly(true)
+	iter, err := ss.Iter([]byte(prefix), tikv.PrefixNextKey([]byte(prefix)))
+	if err != nil {
+		loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to create iterater for %s during %s", prefix, op))
+		return loggingErr
+	}
+	defer iter.Close()
+
+	for iter.Valid() {
+		if err = ctx.Err(); err != nil {
+			loggingErr = errors.Wrap(err, fmt.Sprintf("%s stopped before key %s", op, string(iter.Key())))
+			return loggingErr
+		}
+		if err = fn(iter.Key()); err != nil {
+			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to apply fn to key %s", string(iter.Key())))
+			return loggingErr
+		}
+		if err = iter.Next(); err != nil {
+			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to move Iterator after key %s for %s", string(iter.Key()), op))
+			return loggingErr
+		}
+	}
+	return nil
+}
@@ -32,6 +32,8 @@ import (
 var (
 	txnClient *txnkv.Client
 	rawClient *rawkv.Client
+	// txnCluster is the mock cluster of txnClient, nil if connected to a remote TiKV
+	txnCluster *testutils.MockCluster
 )
 
 // creates a local TiKV Store for testing purpose.
@@ -51,6 +53,7 @@ func setupLocalTxn() {
 		panic(err)
 	}
 	txnClient = &txnkv.Client{KVStore: store}
+	txnCluster = cluster
 }
 
 func setupLocalRaw() {
@@ -0,0 +1,160 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	tikv "github.com/tikv/client-go/v2/kv"
+	"github.com/tikv/client-go/v2/txnkv/txnutil"
+
+	"github.com/milvus-io/milvus/internal/kv"
+)
+
+var deletionJournalPrefix = kv.DeletionJournalPrefix
+
+// prefixDeleter removes the keys with prefix in chunks for a kv.DeletionJob.
+type prefixDeleter struct {
+	store  *txnTiKV
+	prefix string
+	// fullPrefix is the prefix joined with root path
+	fullPrefix string
+	// journalRoot is the full prefix of journal keys, which are never removed by chunks
+	journalRoot string
+}
+
+var _ kv.DeletionExecutor = (*prefixDeleter)(nil)
+
+func newPrefixDeleter(store *txnTiKV, prefix string) *prefixDeleter {
+	return &prefixDeleter{
+		store:       store,
+		prefix:      prefix,
+		fullPrefix:  path.Join(store.rootPath, prefix),
+		journalRoot: path.Join(store.rootPath, deletionJournalPrefix),
+	}
+}
+
+// journalKey returns the journal key relative to root path.
+func (d *prefixDeleter) journalKey() string {
+	return path.Join(deletionJournalPrefix, d.prefix)
+}
+
+func (d *prefixDeleter) isJournal(key string) bool {
+	return key == d.journalRoot || strings.HasPrefix(key, d.journalRoot+"/")
+}
+
+func (d *prefixDeleter) Count(ctx context.Context) (int64, error) {
+	client, release := d.store.acquireClient()
+	defer release()
+	ss := getSnapshot(client, d.store.snapshotScanSize(), tikv.ReplicaReadLeader)
+	ss.SetKeyOnly(true)
+	ss.SetPriority(txnutil.PriorityLow)
+	iter, err := ss.Iter([]byte(d.fullPrefix), tikv.PrefixNextKey([]byte(d.fullPrefix)))
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("Failed to create iterator for %s during counting", d.fullPrefix))
+	}
+	defer iter.Close()
+
+	count := int64(0)
+	for iter.Valid() {
+		if ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+		if !d.isJournal(string(iter.Key())) {
+			count++
+		}
+		if err = iter.Next(); err != nil {
+			return count, errors.Wrap(err, fmt.Sprintf("Failed to move iterator after key %s during counting", string(iter.Key())))
+		}
+	}
+	return count, nil
+}
+
+func (d *prefixDeleter) DeleteChunk(ctx context.Context, cursor string) (int, string, bool, error) {
+	client, release := d.store.acquireClient()
+	defer release()
+	startKey := []byte(d.fullPrefix)
+	if cursor != "" {
+		startKey = []byte(cursor)
+	}
+
+	ss := getSnapshot(client, kv.DeletionChunkSize, tikv.ReplicaReadLeader)
+	ss.SetKeyOnly(true)
+	ss.SetPriority(txnutil.PriorityLow)
+	iter, err := ss.Iter(startKey, tikv.PrefixNextKey([]byte(d.fullPrefix)))
+	if err != nil {
+		return 0, cursor, false, errors.Wrap(err, fmt.Sprintf("Failed to create iterator for %s during deletion", d.fullPrefix))
+	}
+	defer iter.Close()
+
+	scanned := 0
+	keys := make([][]byte, 0, kv.DeletionChunkSize)
+	for iter.Valid() && scanned < kv.DeletionChunkSize {
+		key := append([]byte{}, iter.Key()...)
+		scanned++
+		// next chunk starts right after the last scanned key
+		cursor = string(key) + "\x00"
+		if !d.isJournal(string(key)) {
+			keys = append(keys, key)
+		}
+		if err = iter.Next(); err != nil {
+			return 0, cursor, false, errors.Wrap(err, fmt.Sprintf("Failed to move iterator after key %s during deletion", string(key)))
+		}
+	}
+	finished := scanned < kv.DeletionChunkSize
+	if len(keys) == 0 {
+		return 0, cursor, finished, nil
+	}
+
+	txn, err := startTxn(client)
+	if err != nil {
+		return 0, cursor, false, errors.Wrap(err, "Failed to create txn for deletion chunk")
+	}
+	defer rollbackOnFailure(&err, txn)
+	txn.SetPriority(txnutil.PriorityLow)
+	for _, key := range keys {
+		if err = txn.Delete(key); err != nil {
+			return 0, cursor, false, errors.Wrap(err, fmt.Sprintf("Failed to delete %s for deletion chunk", string(key)))
+		}
+	}
+	if err = d.store.executeTxn(txn, ctx); err != nil {
+		return 0, cursor, false, errors.Wrap(err, "Failed to commit deletion chunk")
+	}
+	// the removed keys are told chunk by chunk, as the job may never complete
+	removed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		removed = append(removed, d.store.relativeKey(string(key)))
+	}
+	d.store.hooks.NotifyRemove(removed...)
+	return len(keys), cursor, finished, nil
+}
+
+func (d *prefixDeleter) Finish(completed bool) error {
+	ctx, cancel := withTimeout(d.store.baseContext(), d.store.timeout())
+	defer cancel()
+	if err := d.store.removeTiKVMeta(ctx, path.Join(d.store.rootPath, d.journalKey())); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Failed to remove journal of deletion job %s", d.prefix))
+	}
+	if completed {
+		d.store.hooks.NotifyRemoveWithPrefix(d.prefix)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+	tikv "github.com/tikv/client-go/v2/kv"
+	"github.com/tikv/client-go/v2/txnkv"
+	"github.com/tikv/client-go/v2/txnkv/txnsnapshot"
+	"go.uber.org/atomic"
+
+	"github.com/milvus-io/milvus/pkg/util/merr"
+)
+
+// ErrReadViewClosed is returned by the reads of a ReadView after it's closed.
+var ErrReadViewClosed = errors.New("txnTiKV read view is closed")
+
+// snapshot returns the snapshot of the reads, at the TS pinned by ReadView if any.
+func (kv *txnTiKV) snapshot(client *txnkv.Client, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+	if kv.snapshotTS == 0 {
+		return getSnapshot(client, paginationSize, replicaRead)
+	}
+	return getSnapshotAt(client, kv.snapshotTS, paginationSize, replicaRead)
+}
+
+// ReadView is a consistent view of the keys at a TS: its reads see the writes committed before the TS
+// and never the ones after, e.g. to read the segments and then their replicas without a write torn
+// between them. The TS is kept by the reads only, TiKV doesn't know of the view, so once the GC safe
+// point passes the TS, which is tikv_gc_life_time, 10 minutes by default, after it, the reads fail: a
+// view is for the reads of an operation, not to be kept around. RemoveWithPrefix drops the old
+// versions of the keys, so the view doesn't see the keys removed by it after the TS.
+type ReadView struct {
+	// kv is the view of the instance reading at the TS
+	kv     *txnTiKV
+	closed *atomic.Bool
+}
+
+// ReadView returns a view of the keys at the current TS, see ReadView. The view shares the client,
+// the context and the replica read mode with the instance, it must be closed once done.
+func (kv *txnTiKV) ReadView() (*ReadView, error) {
+	ts, err := kv.CurrentTS()
+	if err != nil {
+		return nil, err
+	}
+	return kv.NewSnapshotReader(ts)
+}
+
+// CurrentTS returns the current TS of the cluster, which is after the commit TS of the writes committed
+// before it's called, e.g. for a backup to record the TS it reads at by NewSnapshotReader.
+func (kv *txnTiKV) CurrentTS() (_ uint64, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	defer kv.finishOp(&err, "CurrentTS", "", 1, time.Now())
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	ts, err := getTimestamp(ctx, client)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get timestamp for CurrentTS")
+	}
+	return ts, nil
+}
+
+// NewSnapshotReader returns a view of the keys at ts, a TS of CurrentTS, see ReadView: the reads of the
+// view see the writes committed before ts however long they take, e.g. for a consistent backup of the
+// metas. ts must be after the GC safe point, or the reads fail.
+func (kv *txnTiKV) NewSnapshotReader(ts uint64) (*ReadView, error) {
+	if ts == 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("snapshot TS must be positive")
+	}
+	view := *kv
+	view.isView = true
+	view.snapshotTS = ts
+	// a Load of the view must not join a Load of the latest data
+	view.loadFlights = nil
+	return &ReadView{kv: &view, closed: atomic.NewBool(false)}, nil
+}
+
+// TS returns the TS the view reads at.
+func (v *ReadView) TS() uint64 {
+	return v.kv.snapshotTS
+}
+
+// Load is Load of txnTiKV at the TS of the view.
+func (v *ReadView) Load(key string) (string, error) {
+	if v.closed.Load() {
+		return "", ErrReadViewClosed
+	}
+	return v.kv.Load(key)
+}
+
+// MultiLoad is MultiLoad of txnTiKV at the TS of the view.
+func (v *ReadView) MultiLoad(keys []string) ([]string, error) {
+	if v.closed.Load() {
+		return nil, ErrReadViewClosed
+	}
+	return v.kv.MultiLoad(keys)
+}
+
+// LoadWithPrefix is LoadWithPrefix of txnTiKV at the TS of the view.
+func (v *ReadView) LoadWithPrefix(prefix string) ([]string, []string, error) {
+	if v.closed.Load() {
+		return nil, nil, ErrReadViewClosed
+	}
+	return v.kv.LoadWithPrefix(prefix)
+}
+
+// WalkWithPrefix is WalkWithPrefix of txnTiKV at the TS of the view.
+func (v *ReadView) WalkWithPrefix(prefix string, paginationSize int, fn func([]byte, []byte) error) error {
+	if v.closed.Load() {
+		return ErrReadViewClosed
+	}
+	return v.kv.WalkWithPrefix(prefix, paginationSize, fn)
+}
+
+// Close closes the view, the reads after it fail with ErrReadViewClosed. It doesn't close the client.
+func (v *ReadView) Close() {
+	v.closed.Store(true)
+}
@@ -0,0 +1,165 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	tikverr "github.com/tikv/client-go/v2/error"
+	"github.com/tikv/client-go/v2/txnkv"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/log"
+	"github.com/milvus-io/milvus/pkg/metrics"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+)
+
+// Used for testing
+var (
+	newTxnClient   = txnkv.NewClient
+	closeTxnClient = func(client *txnkv.Client) error { return client.Close() }
+)
+
+// clientRef is a client to TiKV and the operations in flight on it.
+type clientRef struct {
+	client   *txnkv.Client
+	inflight sync.WaitGroup
+	// owned is true if the client is connected by Reconnect, so it's closed once replaced
+	owned bool
+}
+
+// clientHolder holds the client used by new operations, it's shared by the views of a txnTiKV.
+type clientHolder struct {
+	mu      sync.RWMutex
+	current *clientRef
+	// reconnectMu serializes Reconnects and close
+	reconnectMu sync.Mutex
+	// closed rejects the Reconnects after close
+	closed bool
+}
+
+func newClientHolder(client *txnkv.Client) *clientHolder {
+	return &clientHolder{current: &clientRef{client: client}}
+}
+
+// acquire returns the current client, which is not closed until release is called.
+func (h *clientHolder) acquire() (*txnkv.Client, func()) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ref := h.current
+	ref.inflight.Add(1)
+	return ref.client, ref.inflight.Done
+}
+
+// swap replaces the current client, and returns the replaced one.
+func (h *clientHolder) swap(ref *clientRef) *clientRef {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old := h.current
+	h.current = ref
+	return old
+}
+
+// close returns the current client to be closed if owned, nil if it's closed already.
+func (h *clientHolder) close() *clientRef {
+	h.reconnectMu.Lock()
+	defer h.reconnectMu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.current
+}
+
+// acquireClient returns the client of a new operation, release must be called once the
+// operation is done with the client, including its transactions and snapshots.
+func (kv *txnTiKV) acquireClient() (*txnkv.Client, func()) {
+	return kv.clients.acquire()
+}
+
+// probeClient checks client is usable by reading the root path in a transaction.
+func (kv *txnTiKV) probeClient(ctx context.Context, client *txnkv.Client) error {
+	txn, err := startTxn(client)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create txn for probe")
+	}
+	defer txn.Rollback()
+	_, err = txn.Get(ctx, []byte(kv.rootPath))
+	if err != nil && !tikverr.IsErrNotFound(err) {
+		return errors.Wrap(err, "Failed to read root path for probe")
+	}
+	return nil
+}
+
+// Reconnect connects to TiKV through the PD endpoints, e.g. after the PD cluster is migrated,
+// without restarting the component. The new client is verified by a probe read before the
+// operations started afterwards switch to it, the operations in flight keep using the replaced
+// client, which is closed once they are done. Nothing is changed if the new client fails the probe.
+// The client passed to NewTiKV is not closed since it's owned by the caller, the clients
+// connected by Reconnect are closed once replaced, or by Close.
+func (kv *txnTiKV) Reconnect(ctx context.Context, newPDEndpoints []string) (err error) {
+	start := time.Now()
+	defer kv.finishOp(&err, "Reconnect", "", len(newPDEndpoints), start)
+	defer func() {
+		if err != nil {
+			metrics.MetaClientSwapCounter.WithLabelValues(metrics.FailLabel).Inc()
+		} else {
+			metrics.MetaClientSwapCounter.WithLabelValues(metrics.SuccessLabel).Inc()
+		}
+	}()
+	if len(newPDEndpoints) == 0 {
+		return merr.WrapErrParameterInvalidMsg("no PD endpoint to reconnect to")
+	}
+
+	kv.clients.reconnectMu.Lock()
+	defer kv.clients.reconnectMu.Unlock()
+	if kv.clients.closed {
+		return errors.New("txnTiKV is closed")
+	}
+
+	client, err := newTxnClient(newPDEndpoints)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create client for Reconnect")
+	}
+	if err = kv.probeClient(ctx, client); err != nil {
+		if closeErr := closeTxnClient(client); closeErr != nil {
+			log.Warn("failed to close the client failing the probe", zap.Strings("endpoints", newPDEndpoints), zap.Error(closeErr))
+		}
+		return err
+	}
+
+	old := kv.clients.swap(&clientRef{client: client, owned: true})
+	log.Info("txnTiKV reconnected", zap.String("rootPath", kv.rootPath), zap.Strings("endpoints", newPDEndpoints), zap.Duration("elapsed", time.Since(start)))
+	go kv.drainClient(old)
+	return nil
+}
+
+// drainClient waits for the operations in flight on the replaced client, and closes it if owned.
+func (kv *txnTiKV) drainClient(ref *clientRef) {
+	ref.inflight.Wait()
+	if !ref.owned {
+		return
+	}
+	if err := closeTxnClient(ref.client); err != nil {
+		log.Warn("failed to close the replaced client", zap.String("rootPath", kv.rootPath), zap.Error(err))
+	}
+}
@@ -0,0 +1,120 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"path"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	tikverr "github.com/tikv/client-go/v2/error"
+	"github.com/tikv/client-go/v2/oracle"
+	"github.com/tikv/client-go/v2/txnkv"
+	"github.com/tikv/client-go/v2/txnkv/txnsnapshot"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/common"
+	"github.com/milvus-io/milvus/pkg/log"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+)
+
+// StaleValue is a value read with bounded staleness. It is a distinct type, so that it could not
+// be passed to predicates or compare-and-swap without an explicit conversion: the values
+// compared by writes must be read from the leaders.
+type StaleValue string
+
+func tiTxnStaleSnapshot(txn *txnkv.Client, ts uint64, paginationSize int) *txnsnapshot.KVSnapshot {
+	ss := txn.GetSnapshot(ts)
+	ss.SetScanBatchSize(paginationSize)
+	ss.SetIsStalenessReadOnly(true)
+	return ss
+}
+
+var getStaleSnapshot = tiTxnStaleSnapshot
+
+// staleReadTS returns the TS of reading the data as of staleness ago.
+func staleReadTS(now time.Time, staleness time.Duration) uint64 {
+	return oracle.GoTimeToTS(now.Add(-staleness))
+}
+
+// LoadWithMaxStaleness reads key as of staleness ago from the nearest replica, to save the leader
+// read latency and keep off the writes, e.g. for reporting tools. The TS is computed from the local
+// clock, so the value could be a little staler or fresher than asked, it is not for reads deciding
+// writes. If the cluster rejects the stale read, the key is read from the leader instead.
+func (kv *txnTiKV) LoadWithMaxStaleness(key string, staleness time.Duration) (_ StaleValue, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	defer kv.finishOp(&err, "LoadWithMaxStaleness", key, 1, time.Now())
+	if staleness <= 0 {
+		return "", merr.WrapErrParameterInvalidMsg("staleness must be positive, got %s", staleness)
+	}
+	fullKey := path.Join(kv.rootPath, key)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	ss := getStaleSnapshot(client, staleReadTS(time.Now(), staleness), kv.snapshotScanSize())
+	val, err := ss.Get(ctx, []byte(fullKey))
+	if err == nil && isExpired(val) {
+		return "", common.NewKeyNotExistError(fullKey)
+	}
+	if err == nil {
+		value, err := convertEmptyByteToString(val)
+		return StaleValue(value), err
+	}
+	if errors.Is(err, tikverr.ErrNotExist) {
+		return "", common.NewKeyNotExistError(fullKey)
+	}
+
+	log.Warn("txnTiKV stale read rejected, read from leader", zap.String("key", fullKey), zap.Duration("staleness", staleness), zap.Error(err))
+	value, err := kv.load(key, kv.replicaRead)
+	return StaleValue(value), err
+}
+
+// LoadWithPrefixAndMaxStaleness is the prefix variant of LoadWithMaxStaleness.
+func (kv *txnTiKV) LoadWithPrefixAndMaxStaleness(prefix string, staleness time.Duration) (_ []string, _ []StaleValue, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	defer kv.finishOp(&err, "LoadWithPrefixAndMaxStaleness", prefix, 1, time.Now())
+	if staleness <= 0 {
+		return nil, nil, merr.WrapErrParameterInvalidMsg("staleness must be positive, got %s", staleness)
+	}
+	fullPrefix := path.Join(kv.rootPath, prefix)
+
+	ss := getStaleSnapshot(client, staleReadTS(time.Now(), staleness), kv.snapshotScanSize())
+	ctx, cancel := withTimeout(kv.baseContext(), ScanTimeout)
+	defer cancel()
+	keys, values, err := scanPrefix(ctx, ss, fullPrefix)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, err
+		}
+		log.Warn("txnTiKV stale read rejected, read from leader", zap.String("prefix", fullPrefix), zap.Duration("staleness", staleness), zap.Error(err))
+		keys, values, err = kv.loadWithPrefix(prefix, kv.replicaRead)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return keys, toStaleValues(values), nil
+}
+
+func toStaleValues(values []string) []StaleValue {
+	result := make([]StaleValue, 0, len(values))
+	for _, value := range values {
+		result = append(result, StaleValue(value))
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"time"
+
+	"github.com/tikv/client-go/v2/txnkv/transaction"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The operations are traced by a span each, named tikv.<operation>, e.g. tikv.MultiSaveAndRemove,
+// under the span of the context of WithContext, so a slow meta operation shows up in the trace of the
+// request waiting for it. The commits are traced by a tikv.Commit span each, with the keys and the
+// bytes written, the version sidecars included, see WithVersionedPrefixes. A tikv.Commit span is a sibling of
+// the span of its operation rather than a child, as the span of the operation is only recorded once
+// the operation returns.
+
+// tracerName is the name of the tracer of the spans of txnTiKV.
+const tracerName = "tikv"
+
+// finishOp is deferred by the operations with the named error result, like kv.WrapError:
+//
+//	defer kv.finishOp(&err, "Load", key, 1, time.Now())
+//
+// It wraps the error of the operation into a kv.OpError, and records the span of the operation from
+// start, with the number of keys and the outcome.
+func (kv *txnTiKV) finishOp(err *error, op string, key string, keyCount int, start time.Time) {
+	wrapError(err, op, kv.rootPath, key, keyCount, start)
+	if pdClock.judged.Load() {
+		kv.syncExpirationClock()
+	}
+	_, span := otel.Tracer(tracerName).Start(kv.baseContext(), "tikv."+op, trace.WithTimestamp(start))
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("tikv.root_path", kv.rootPath),
+			attribute.Int("tikv.key_count", keyCount),
+		)
+		setSpanStatus(span, *err)
+	}
+	span.End()
+}
+
+// startCommitSpan starts the span of the commit of txn under ctx, see finishOp.
+func startCommitSpan(ctx context.Context, txn *transaction.KVTxn) trace.Span {
+	_, span := otel.Tracer(tracerName).Start(ctx, "tikv.Commit")
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.Int("tikv.key_count", txn.Len()),
+			attribute.Int("tikv.bytes_written", txn.Size()),
+		)
+	}
+	return span
+}
+
+// setSpanStatus sets the status of span by the error of its operation, nil for a success.
+func setSpanStatus(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetStatus(codes.Ok, "")
+}
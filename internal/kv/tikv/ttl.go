@@ -0,0 +1,351 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	tikverr "github.com/tikv/client-go/v2/error"
+	tikv "github.com/tikv/client-go/v2/kv"
+	"github.com/tikv/client-go/v2/oracle"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/log"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+)
+
+// ttlValueHeader prefixes the values saved by SaveWithTTL. It's followed by the expiration time, in
+// unix nanoseconds as 8 big-endian bytes, and then the value as it is. It starts with ValueHeader, so
+// the values with a TTL are not legacy values.
+const ttlValueHeader = ValueHeader + string(ttlValueTag)
+
+var ttlValueHeaderByte = []byte(ttlValueHeader)
+
+// ttlValuePrefixLen is the length of the header and the expiration time of a value with a TTL.
+const ttlValuePrefixLen = len(ttlValueHeader) + 8
+
+// expirationClock is the local clock the expirations are set and judged by, shifted to the clock of
+// PD by pdClock, replaced in tests.
+var expirationClock = time.Now
+
+// expirationClockSyncInterval is the least interval between the syncs of pdClock, see syncExpirationClock.
+const expirationClockSyncInterval = time.Minute
+
+// clockOffset is the offset of the clock of PD from the local clock.
+type clockOffset struct {
+	offset *atomic.Duration
+	// syncedAt is the local time of the last sync in unix nanoseconds, successful or not, 0 if never
+	syncedAt *atomic.Int64
+	// judged is set once a value with a TTL is judged, so the operations after it sync the offset
+	judged *atomic.Bool
+}
+
+// pdClock is the offset of the clock of PD, shared by the instances as they share PD.
+var pdClock = &clockOffset{offset: atomic.NewDuration(0), syncedAt: atomic.NewInt64(0), judged: atomic.NewBool(false)}
+
+// syncDue returns if the offset is due for a sync at now, and marks it synced if so, so the
+// concurrent callers don't sync it again.
+func (c *clockOffset) syncDue(now time.Time) bool {
+	last := c.syncedAt.Load()
+	if last != 0 && now.Sub(time.Unix(0, last)) < expirationClockSyncInterval {
+		return false
+	}
+	return c.syncedAt.CompareAndSwap(last, now.UnixNano())
+}
+
+// expirationNow returns the current time of the clock of PD as last synced, the local clock if it
+// never was, see syncExpirationClock.
+func expirationNow() time.Time {
+	return expirationClock().Add(pdClock.offset.Load())
+}
+
+// syncExpirationClock syncs the offset of the clock of PD by the physical time of a PD TSO, at most
+// once per expirationClockSyncInterval, so the expirations are set and judged by the clock of PD, and
+// the skew of the local clocks doesn't shift them. If PD is not available, the last offset is kept.
+// It's synced lazily, by SaveWithTTL, by the reaper of WithExpiredKeyReaper, and by the operations
+// finishing after a value with a TTL is judged, see finishOp, so NewTiKV doesn't wait for PD and the
+// instances never using a TTL never ask PD for it. The first values with a TTL judged before the sync
+// are judged by the local clock.
+func (kv *txnTiKV) syncExpirationClock() {
+	if !pdClock.syncDue(time.Now()) {
+		return
+	}
+	client, release := kv.acquireClient()
+	defer release()
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	before := time.Now()
+	ts, err := getTimestamp(ctx, client)
+	if err != nil {
+		log.Warn("txnTiKV failed to sync the expiration clock with PD, keep the last offset",
+			zap.Duration("offset", pdClock.offset.Load()), zap.Error(err))
+		return
+	}
+	// the TSO is taken halfway through the round trip, more or less
+	local := before.Add(time.Since(before) / 2)
+	pdClock.offset.Store(oracle.GetTimeFromTS(ts).Sub(local))
+}
+
+// encodeValueWithTTL returns the stored value of value expiring at expireAt, whatever the value is.
+func encodeValueWithTTL(value string, expireAt time.Time) []byte {
+	res := make([]byte, ttlValuePrefixLen, ttlValuePrefixLen+len(value))
+	copy(res, ttlValueHeaderByte)
+	binary.BigEndian.PutUint64(res[len(ttlValueHeaderByte):], uint64(expireAt.UnixNano()))
+	return append(res, value...)
+}
+
+// isExpired returns if the stored value has a TTL which has passed.
+func isExpired(value []byte) bool {
+	if len(value) < ttlValuePrefixLen || !bytes.HasPrefix(value, ttlValueHeaderByte) {
+		return false
+	}
+	expireAt := int64(binary.BigEndian.Uint64(value[len(ttlValueHeaderByte):ttlValuePrefixLen]))
+	if !pdClock.judged.Load() {
+		pdClock.judged.Store(true)
+	}
+	return expirationNow().UnixNano() >= expireAt
+}
+
+// SaveWithTTL saves value at key like Save, and the key expires after ttl. An expired key is absent
+// for Has, HasPrefix, Load, MultiLoad, the prefix scans and walks, and CompareValueAndSwap, though it
+// stays stored until it's removed by RemoveExpired, see WithExpiredKeyReaper, or overwritten. Saving
+// the key again by Save drops the TTL. Expiration is best-effort: the time it expires is computed
+// from the clock of the node saving it, and judged by the clock of the node reading it, TiKV itself
+// is not aware of the TTL. The clocks are the local clocks shifted to the clock of PD, see
+// syncExpirationClock, so the skew between the nodes is bounded by the drift of the local clocks
+// between the syncs, or by the skew of the local clocks while PD is not available: ttl should be
+// much longer than that.
+// The writes of the kv other than CompareValueAndSwap see an expired value as present.
+// The values with a TTL start with ValueHeader even if WriteValueHeader is disabled, and the nodes of
+// the versions before ValueHeader read them as they are stored, so all the nodes sharing TiKV must be
+// upgraded before any saves with a TTL.
+func (kv *txnTiKV) SaveWithTTL(key, value string, ttl time.Duration) (err error) {
+	defer kv.finishOp(&err, "SaveWithTTL", key, 1, time.Now())
+	relativeKey := key
+	key = path.Join(kv.rootPath, key)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV SaveWithTTL() error", zap.String("key", key),
+		valueField(key, value), zap.Duration("ttl", ttl))
+
+	if ttl <= 0 {
+		loggingErr = merr.WrapErrParameterInvalidMsg("ttl must be positive, got %s", ttl)
+		return loggingErr
+	}
+	kv.syncExpirationClock()
+	byteValue := encodeValueWithTTL(value, expirationNow().Add(ttl))
+	loggingErr = kv.putStoredValue(ctx, key, byteValue)
+	if loggingErr != nil {
+		return loggingErr
+	}
+	kv.hooks.NotifySave(map[string]string{relativeKey: value})
+	return nil
+}
+
+// RemoveExpired removes the expired keys with the given prefix, returning the removed keys relative to
+// the root path. A key saved again since it's scanned is left untouched, so it's safe to run against a
+// live cluster. The removals are notified to the write hooks.
+func (kv *txnTiKV) RemoveExpired(prefix string) (_ []string, err error) {
+	start := time.Now()
+	defer kv.finishOp(&err, "RemoveExpired", prefix, 1, start)
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV RemoveExpired() error", zap.String("prefix", prefix))
+
+	if err := kv.checkWritable(); err != nil {
+		loggingErr = err
+		return nil, loggingErr
+	}
+
+	fullPrefix := []byte(path.Join(kv.rootPath, prefix))
+	expired, err := kv.scanExpired(fullPrefix, tikv.PrefixNextKey(fullPrefix))
+	if err != nil {
+		loggingErr = errors.Wrap(err, "Failed to scan for RemoveExpired")
+		return nil, loggingErr
+	}
+	removed := make([]string, 0, len(expired))
+	scanSize := kv.snapshotScanSize()
+	for begin := 0; begin < len(expired); begin += scanSize {
+		end := begin + scanSize
+		if end > len(expired) {
+			end = len(expired)
+		}
+		batchRemoved, err := kv.removeExpired(expired[begin:end])
+		if err != nil {
+			loggingErr = err
+			kv.hooks.NotifyRemove(removed...)
+			return nil, loggingErr
+		}
+		removed = append(removed, batchRemoved...)
+	}
+	kv.hooks.NotifyRemove(removed...)
+	kv.checkSlowOp(start, "RemoveExpired", len(removed), 0, zap.String("prefix", prefix), zap.Int("removed", len(removed)))
+	return removed, nil
+}
+
+// expiredValue is an expired key and its stored value.
+type expiredValue struct {
+	key   []byte
+	value []byte
+}
+
+// scanExpired returns the expired key-value pairs in [startKey, endKey).
+func (kv *txnTiKV) scanExpired(startKey, endKey []byte) ([]expiredValue, error) {
+	client, release := kv.acquireClient()
+	defer release()
+	// Since only reading, use Snapshot for less overhead
+	ss := getSnapshot(client, kv.snapshotScanSize(), tikv.ReplicaReadLeader)
+	iter, err := ss.Iter(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	expired := make([]expiredValue, 0)
+	for iter.Valid() {
+		if isExpired(iter.Value()) {
+			expired = append(expired, expiredValue{key: append([]byte{}, iter.Key()...), value: append([]byte{}, iter.Value()...)})
+		}
+		if err = iter.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return expired, nil
+}
+
+// removeExpired removes the keys of batch still having the scanned values in one transaction, which
+// is retried on conflicts, see WithConflictRetry.
+func (kv *txnTiKV) removeExpired(batch []expiredValue) ([]string, error) {
+	client, release := kv.acquireClient()
+	defer release()
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var removed []string
+	remove := func() error {
+		removed = make([]string, 0, len(batch))
+		txn, err := startTxn(client)
+		if err != nil {
+			return errors.Wrap(err, "Failed to create txn for RemoveExpired")
+		}
+
+		// Rollback whenever this attempt is not committed
+		var attemptErr error
+		defer rollbackOnFailure(&attemptErr, txn)
+
+		for _, expired := range batch {
+			val, err := txn.Get(ctx, expired.key)
+			if err != nil && !tikverr.IsErrNotFound(err) {
+				attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to read %s for RemoveExpired", string(expired.key)))
+				return attemptErr
+			}
+			// the key is skipped if it's saved again or removed since scanned
+			if err != nil || !bytes.Equal(val, expired.value) {
+				continue
+			}
+			if err = txn.Delete(expired.key); err != nil {
+				attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to delete %s for RemoveExpired", string(expired.key)))
+				return attemptErr
+			}
+			removed = append(removed, kv.relativeKey(string(expired.key)))
+		}
+		if len(removed) == 0 {
+			return txn.Rollback()
+		}
+		if err = kv.executeTxn(txn, ctx); err != nil {
+			attemptErr = errors.Wrap(err, "Failed to commit for RemoveExpired")
+			return attemptErr
+		}
+		return nil
+	}
+
+	err := kv.retryOnConflict(ctx, remove)
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// expiredKeyReaper runs RemoveExpired periodically until it's stopped.
+type expiredKeyReaper struct {
+	interval time.Duration
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// WithExpiredKeyReaper makes the instance remove the expired keys under the root path every
+// interval in the background, see RemoveExpired, until it's closed. The expired keys are absent to
+// the reads anyway, the reaper only frees their space. Only one node of the cluster needs a reaper.
+// A non-positive interval is ignored, no reaper runs.
+func WithExpiredKeyReaper(interval time.Duration) Option {
+	return func(kv *txnTiKV) {
+		if interval <= 0 {
+			log.Warn("txnTiKV ignores the non-positive interval of the expired key reaper", zap.Duration("interval", interval))
+			return
+		}
+		kv.reaper = &expiredKeyReaper{
+			interval: interval,
+			stop:     make(chan struct{}),
+			done:     make(chan struct{}),
+		}
+	}
+}
+
+func (r *expiredKeyReaper) run(kv *txnTiKV) {
+	defer close(r.done)
+	kv.syncExpirationClock()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			if kv.readOnly.Load() {
+				continue
+			}
+			kv.syncExpirationClock()
+			removed, err := kv.RemoveExpired("")
+			if err != nil {
+				log.Warn("txnTiKV failed to remove expired keys", zap.String("path", kv.rootPath), zap.Error(err))
+				continue
+			}
+			if len(removed) > 0 {
+				log.Info("txnTiKV removed expired keys", zap.String("path", kv.rootPath), zap.Int("count", len(removed)))
+			}
+		}
+	}
+}
+
+// close stops the reaper and waits for a running removal.
+func (r *expiredKeyReaper) close() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	<-r.done
+}
@@ -0,0 +1,184 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	tikverr "github.com/tikv/client-go/v2/error"
+	"github.com/tikv/client-go/v2/txnkv/transaction"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/common"
+)
+
+// ErrTxnFinished is returned by the methods of a Txn after it's committed or rolled back.
+var ErrTxnFinished = errors.New("txnTiKV transaction is already committed or rolled back")
+
+// Txn is a transaction of txnTiKV, for the atomic units the Multi* writes can't express, e.g. reading
+// some keys and then writing others depending on their values:
+//
+//	txn, err := kv.BeginTxn()
+//	if err != nil {
+//		...
+//	}
+//	defer txn.Rollback()
+//	value, err := txn.Get("a")
+//	...
+//	txn.Put("b", value)
+//	err = txn.Commit()
+//
+// The keys are relative to the root path, as the ones of Save. The reads see the writes committed
+// before BeginTxn and the writes of the transaction, and the writes are buffered until Commit. Like
+// the transactions of TiKV, the isolation is snapshot isolation: Commit fails with ErrCommitConflict
+// if a key written by the transaction is written by another one after BeginTxn, but not if a key
+// only read is, so a key the writes depend on must be Put back to make the commit conflict on it.
+// Unlike the Multi* writes, a conflicted commit is not retried, as the reads before it are stale: the
+// caller starts over with a new transaction. A Txn is not safe for concurrent use.
+type Txn struct {
+	kv  *txnTiKV
+	txn *transaction.KVTxn
+	// release releases the client of the transaction once it's finished
+	release func()
+	// saves and removals are the writes of the transaction, relative to the root path, notified to
+	// the write hooks once committed
+	saves    map[string]string
+	removals map[string]struct{}
+	finished bool
+}
+
+// BeginTxn starts a transaction, see Txn. The transaction must be committed or rolled back, it keeps
+// the client it's started on until then, like the iterators of NewPrefixIterator.
+func (kv *txnTiKV) BeginTxn() (_ *Txn, err error) {
+	defer kv.finishOp(&err, "BeginTxn", "", 0, time.Now())
+	client, release := kv.acquireClient()
+	txn, err := startTxn(client)
+	if err != nil {
+		release()
+		return nil, errors.Wrap(err, "Failed to create txn for BeginTxn")
+	}
+	return &Txn{
+		kv:       kv,
+		txn:      txn,
+		release:  release,
+		saves:    make(map[string]string),
+		removals: make(map[string]struct{}),
+	}, nil
+}
+
+// Get returns the value of key, or the KeyNotExistError if it doesn't exist, see common.IsKeyNotExistError.
+func (t *Txn) Get(key string) (_ string, err error) {
+	defer t.kv.finishOp(&err, "Txn.Get", key, 1, time.Now())
+	if t.finished {
+		return "", ErrTxnFinished
+	}
+	fullKey := path.Join(t.kv.rootPath, key)
+	ctx, cancel := withTimeout(t.kv.baseContext(), t.kv.timeout())
+	defer cancel()
+
+	val, err := t.txn.Get(ctx, []byte(fullKey))
+	if tikverr.IsErrNotFound(err) || (err == nil && isExpired(val)) {
+		return "", common.NewKeyNotExistError(fullKey)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Failed to read key %s for Txn", fullKey))
+	}
+	return convertEmptyByteToString(val)
+}
+
+// Put saves value at key when the transaction is committed.
+func (t *Txn) Put(key, value string) (err error) {
+	defer t.kv.finishOp(&err, "Txn.Put", key, 1, time.Now())
+	if t.finished {
+		return ErrTxnFinished
+	}
+	fullKey := path.Join(t.kv.rootPath, key)
+	byteValue, err := convertEmptyStringToByte(value)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Failed to cast to byte (%s:%s) for Txn", fullKey, redactValue(fullKey, value)))
+	}
+	if err = t.txn.Set([]byte(fullKey), t.kv.compressValue(byteValue)); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Failed to set %s for Txn", fullKey))
+	}
+	delete(t.removals, key)
+	t.saves[key] = value
+	return nil
+}
+
+// Delete removes key when the transaction is committed, a missing key is not an error.
+func (t *Txn) Delete(key string) (err error) {
+	defer t.kv.finishOp(&err, "Txn.Delete", key, 1, time.Now())
+	if t.finished {
+		return ErrTxnFinished
+	}
+	fullKey := path.Join(t.kv.rootPath, key)
+	if err = t.txn.Delete([]byte(fullKey)); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Failed to delete %s for Txn", fullKey))
+	}
+	delete(t.saves, key)
+	t.removals[key] = struct{}{}
+	return nil
+}
+
+// Commit commits the writes of the transaction, within RequestTimeout or the commit timeout of
+// WithCommitTimeout, and finishes it whether it succeeds or not.
+func (t *Txn) Commit() (err error) {
+	start := time.Now()
+	defer t.kv.finishOp(&err, "Txn.Commit", "", len(t.saves)+len(t.removals), start)
+	if t.finished {
+		return ErrTxnFinished
+	}
+	t.finished = true
+	defer t.release()
+	ctx, cancel := withTimeout(t.kv.baseContext(), t.kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV Txn.Commit() error", zap.Int("saveLength", len(t.saves)), zap.Int("removeLength", len(t.removals)))
+
+	if err = t.kv.executeTxn(t.txn, ctx); err != nil {
+		t.txn.Rollback()
+		loggingErr = errors.Wrap(err, "Failed to commit for Txn")
+		return loggingErr
+	}
+	t.kv.checkSlowOp(start, "Txn.Commit", len(t.saves)+len(t.removals), mapValuesSize(t.saves), zap.Int("saveLength", len(t.saves)), zap.Int("removeLength", len(t.removals)))
+	if len(t.saves) > 0 {
+		t.kv.hooks.NotifySave(t.saves)
+	}
+	if len(t.removals) > 0 {
+		removals := make([]string, 0, len(t.removals))
+		for key := range t.removals {
+			removals = append(removals, key)
+		}
+		t.kv.hooks.NotifyRemove(removals...)
+	}
+	return nil
+}
+
+// Rollback discards the writes of the transaction. It's a no-op once the transaction is finished, so
+// it can be deferred right after BeginTxn.
+func (t *Txn) Rollback() {
+	if t.finished {
+		return
+	}
+	t.finished = true
+	t.txn.Rollback()
+	t.release()
+}
@@ -19,9 +19,14 @@ package tikv
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
 	"math"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cockroachdb/errors"
@@ -30,6 +35,7 @@ import (
 	"github.com/tikv/client-go/v2/txnkv"
 	"github.com/tikv/client-go/v2/txnkv/transaction"
 	"github.com/tikv/client-go/v2/txnkv/txnsnapshot"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 
 	"github.com/milvus-io/milvus/internal/kv"
@@ -37,8 +43,10 @@ import (
 	"github.com/milvus-io/milvus/pkg/common"
 	"github.com/milvus-io/milvus/pkg/log"
 	"github.com/milvus-io/milvus/pkg/metrics"
+	"github.com/milvus-io/milvus/pkg/util/conc"
 	"github.com/milvus-io/milvus/pkg/util/merr"
 	"github.com/milvus-io/milvus/pkg/util/paramtable"
+	"github.com/milvus-io/milvus/pkg/util/retry"
 	"github.com/milvus-io/milvus/pkg/util/timerecord"
 )
 
@@ -57,18 +65,248 @@ const (
 	// TiKV does not allow storing empty values for keys which is something we do in Milvus, so
 	// to get over this we are using the reserved keyword as placeholder.
 	EmptyValueString = "__milvus_reserved_empty_tikv_value_DO_NOT_USE"
+	// ValueHeader prefixes the values written by txnTiKV if WriteValueHeader is enabled, followed by a
+	// tag telling how the rest is encoded, see plainValueTag, so that any value, EmptyValueString or
+	// empty, is stored as it is after them. Values written without the header are legacy values, they
+	// are read as is except EmptyValueString which is read as an empty value, see ScanLegacyValues.
+	// A legacy value never starts with the header, as it's neither valid protobuf nor text, and the
+	// legacy writes reject the values starting with it.
+	ValueHeader = "\x00mv1"
+)
+
+// The tags following ValueHeader in the stored values.
+const (
+	// plainValueTag is followed by the value as it is.
+	plainValueTag byte = 0x01
+	// ttlValueTag is followed by the expiration time and the value, see SaveWithTTL.
+	ttlValueTag byte = 0x02
+	// compressedValueTag is followed by the value compressed by zstd, see WithValueCompression.
+	compressedValueTag byte = 0x03
 )
 
 var Params *paramtable.ComponentParam = paramtable.Get()
 
 // For reads by prefix we can customize the scan size to increase/decrease rpc calls.
+// It's the default of the instances, see WithScanSize.
 var SnapshotScanSize int
 
-// RequestTimeout is the default timeout for tikv request.
+// RequestTimeout is the default timeout for tikv request, 0 means no timeout.
 var RequestTimeout time.Duration
 
+// ScanTimeout is the timeout of a prefix scan, e.g. LoadWithPrefix or WalkWithPrefix, 0 means no
+// timeout. Scans of many keys legitimately take much longer than point requests, so they are not
+// bounded by RequestTimeout. The deadline is checked between pages, and before each key of a walk.
+var ScanTimeout time.Duration
+
+// WriteValueHeader is whether the values are written with ValueHeader, see tikv.writeValueHeader.
+// The values are read whatever their encoding is, but the nodes of the versions before ValueHeader read
+// the values with it as corrupted values, so it stays disabled until all the nodes sharing TiKV are
+// upgraded, and the values are written in the legacy encoding meanwhile.
+var WriteValueHeader bool
+
 var EmptyValueByte = []byte(EmptyValueString)
 
+var valueHeaderByte = []byte(ValueHeader)
+
+// plainValueHeaderByte prefixes the values stored as they are with ValueHeader.
+var plainValueHeaderByte = []byte(ValueHeader + string(plainValueTag))
+
+// large values flowing through txnTiKV are sampled by the kv instrumentation
+var (
+	observeValueSize      = kv.ObserveValueSize
+	observeValueSizeBytes = kv.ObserveValueSizeBytes
+	redactValue           = kv.RedactValue
+	valueField            = kv.ValueField
+	namedValueField       = kv.NamedValueField
+	largeValueOpLoad      = kv.LargeValueOpLoad
+	largeValueOpSave      = kv.LargeValueOpSave
+	largeValueOpScan      = kv.LargeValueOpScan
+)
+
+// valuesField is valueField for the kvs of a batch.
+func valuesField[V string | []byte](name string, kvs map[string]V) zap.Field {
+	return kv.ValuesField(name, kvs)
+}
+
+// the kv metrics are labeled by the prefix rules of the kv layer
+var (
+	prefixLabel   = kv.PrefixLabel
+	prefixLabelOf = kv.PrefixLabelOf
+)
+
+// errors returned by txnTiKV carry the context of the failed operation
+var wrapError = kv.WrapError
+
+// missingKeysErrorOf returns the error of MultiLoad failing only for the keys at the indexes
+// missing of keys, which are reported as full paths under rootPath.
+func missingKeysErrorOf(rootPath string, keys []string, missing []int) error {
+	missingKeys := make([]string, len(missing))
+	for i, index := range missing {
+		missingKeys[i] = path.Join(rootPath, keys[index])
+	}
+	return kv.NewMissingKeysError(missingKeys)
+}
+
+// ErrReadOnly is returned by mutating operations while the kv is in read-only mode.
+var ErrReadOnly = errors.New("txnTiKV is read-only")
+
+// ErrListFull is returned by AppendToList when the list already has maxLen elements.
+var ErrListFull = errors.New("list reaches max length")
+
+// ErrPartialRemove is returned by MultiRemove in split mode when a batch fails,
+// the batches before it are committed, the ones after it are not tried.
+type ErrPartialRemove struct {
+	CommittedBatches int
+	TotalBatches     int
+	// Removed are the keys of the committed batches
+	Removed []string
+	Err     error
+}
+
+func (e *ErrPartialRemove) Error() string {
+	return fmt.Sprintf("txnTiKV MultiRemove partially failed, %d of %d batches committed, %d keys removed: %s",
+		e.CommittedBatches, e.TotalBatches, len(e.Removed), e.Err.Error())
+}
+
+func (e *ErrPartialRemove) Unwrap() error {
+	return e.Err
+}
+
+// ErrPartialSave is returned by MultiSaveChunked when a chunk fails, the chunks before it are
+// committed, the ones after it are not tried.
+type ErrPartialSave struct {
+	CommittedChunks int
+	TotalChunks     int
+	// Saved are the keys of the committed chunks
+	Saved []string
+	// FirstKey and LastKey bound the keys of the failed chunk
+	FirstKey string
+	LastKey  string
+	Err      error
+}
+
+func (e *ErrPartialSave) Error() string {
+	return fmt.Sprintf("txnTiKV MultiSaveChunked partially failed at chunk %d of %d, keys [%s, %s], %d keys saved: %s",
+		e.CommittedChunks+1, e.TotalChunks, e.FirstKey, e.LastKey, len(e.Saved), e.Err.Error())
+}
+
+func (e *ErrPartialSave) Unwrap() error {
+	return e.Err
+}
+
+// ErrTooManyOps is returned when a transaction has more operations than tikv.maxTxnOps allows.
+type ErrTooManyOps struct {
+	Count int
+	Limit int
+}
+
+func (e *ErrTooManyOps) Error() string {
+	return fmt.Sprintf("txnTiKV transaction has too many operations, count: %d, limit: %d", e.Count, e.Limit)
+}
+
+// ErrValueTooLarge is returned by the writes of a value larger than TiKV accepts for its key, see
+// tikv.txnEntrySizeLimit. Nothing is written then.
+type ErrValueTooLarge struct {
+	Key string
+	// Size is the size of the value as stored, and Limit the largest one the key allows
+	Size  int
+	Limit int
+}
+
+func (e *ErrValueTooLarge) Error() string {
+	return fmt.Sprintf("txnTiKV value of key %s is too large, size: %d, limit: %d", e.Key, e.Size, e.Limit)
+}
+
+// ErrCommitTimeout marks the errors of the commits which didn't finish in time, see WithCommitTimeout.
+// The transaction may be committed or not then, so a retry should check the result first.
+var ErrCommitTimeout = errors.New("txnTiKV commit timed out")
+
+// ErrCommitConflict marks the errors of the commits which conflicted with a concurrent write. The
+// transaction is not committed then, and it's safe to retry.
+var ErrCommitConflict = errors.New("txnTiKV commit conflicted")
+
+// ErrTxnConflict is ErrCommitConflict, for the callers matching it along with ErrTxnBegin and ErrTxnCommit.
+var ErrTxnConflict = ErrCommitConflict
+
+// ErrTxnBegin marks the errors of the transactions which failed to begin, e.g. as PD is unavailable.
+// Nothing is written then.
+var ErrTxnBegin = errors.New("txnTiKV txn begin failed")
+
+// ErrTxnCommit marks the errors of all the failed commits, the ones of a timeout, of a conflict and of
+// a lost lock are also marked by ErrCommitTimeout, ErrCommitConflict and ErrTxnLockNotFound.
+var ErrTxnCommit = errors.New("txnTiKV txn commit failed")
+
+// ErrKeyNotFound is matched by errors.Is for the errors of the reads of missing keys, see kv.ErrKeyNotFound.
+var ErrKeyNotFound = kv.ErrKeyNotFound
+
+// ErrTxnLockNotFound marks the errors of the commits whose locks were already resolved by other
+// transactions, e.g. after the transaction is paused for longer than its lock TTL. The transaction
+// is not committed then, and it's safe to retry.
+var ErrTxnLockNotFound = errors.New("txnTiKV txn lock not found")
+
+// beginError marks the error of a begin by ErrTxnBegin.
+type beginError struct {
+	err error
+}
+
+func (e *beginError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrTxnBegin.Error(), e.err.Error())
+}
+
+func (e *beginError) Unwrap() error {
+	return e.err
+}
+
+func (e *beginError) Is(target error) bool {
+	return target == ErrTxnBegin
+}
+
+// commitError marks the error of a commit by ErrTxnCommit, and by mark, one of ErrCommitTimeout,
+// ErrCommitConflict, ErrTxnLockNotFound or ErrTxnCommit itself.
+type commitError struct {
+	mark error
+	err  error
+}
+
+func (e *commitError) Error() string {
+	return fmt.Sprintf("%s: %s", e.mark.Error(), e.err.Error())
+}
+
+func (e *commitError) Unwrap() error {
+	return e.err
+}
+
+func (e *commitError) Is(target error) bool {
+	return target == e.mark || target == ErrTxnCommit
+}
+
+// ErrConflictRetriesExhausted is returned by the writes which still conflicted with concurrent writes,
+// or lost their locks, after all the retries of WithConflictRetry. errors.Is matches ErrCommitConflict
+// or ErrTxnLockNotFound through Err.
+type ErrConflictRetriesExhausted struct {
+	// Attempts is the number of the transactions tried, i.e. the retries plus one
+	Attempts int
+	// Err is the error of the last attempt
+	Err error
+}
+
+func (e *ErrConflictRetriesExhausted) Error() string {
+	return fmt.Sprintf("txnTiKV write still conflicted after %d attempts: %s", e.Attempts, e.Err.Error())
+}
+
+func (e *ErrConflictRetriesExhausted) Unwrap() error {
+	return e.Err
+}
+
+// startTxn begins a transaction on client, its error is marked by ErrTxnBegin.
+func startTxn(client *txnkv.Client) (*transaction.KVTxn, error) {
+	txn, err := beginTxn(client)
+	if err != nil {
+		return nil, &beginError{err: err}
+	}
+	return txn, nil
+}
+
 func tiTxnBegin(txn *txnkv.Client) (*transaction.KVTxn, error) {
 	return txn.Begin()
 }
@@ -77,16 +315,29 @@ func tiTxnCommit(txn *transaction.KVTxn, ctx context.Context) error {
 	return txn.Commit(ctx)
 }
 
-func tiTxnSnapshot(txn *txnkv.Client, paginationSize int) *txnsnapshot.KVSnapshot {
-	ss := txn.GetSnapshot(MaxSnapshotTS)
+func tiTxnSnapshot(txn *txnkv.Client, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+	return tiTxnSnapshotAt(txn, MaxSnapshotTS, paginationSize, replicaRead)
+}
+
+func tiTxnSnapshotAt(txn *txnkv.Client, ts uint64, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+	ss := txn.GetSnapshot(ts)
 	ss.SetScanBatchSize(paginationSize)
+	if replicaRead.IsFollowerRead() {
+		ss.SetReplicaRead(replicaRead)
+	}
 	return ss
 }
 
+func tiGetTimestamp(ctx context.Context, txn *txnkv.Client) (uint64, error) {
+	return txn.GetTimestamp(ctx)
+}
+
 var (
-	beginTxn    = tiTxnBegin
-	commitTxn   = tiTxnCommit
-	getSnapshot = tiTxnSnapshot
+	beginTxn      = tiTxnBegin
+	commitTxn     = tiTxnCommit
+	getSnapshot   = tiTxnSnapshot
+	getSnapshotAt = tiTxnSnapshotAt
+	getTimestamp  = tiGetTimestamp
 )
 
 // implementation assertion
@@ -94,26 +345,200 @@ var _ kv.MetaKv = (*txnTiKV)(nil)
 
 // txnTiKV implements MetaKv and TxnKV interface. It supports processing multiple kvs within one transaction.
 type txnTiKV struct {
-	txn      *txnkv.Client
+	// clients holds the client to TiKV, which is replaced by Reconnect
+	clients *clientHolder
+	// isView is true for the views of WithTimeout, WithContext and NewSnapshotReader, see Close
+	isView   bool
 	rootPath string
+	// readOnly rejects all writes, see SetReadOnly
+	readOnly *atomic.Bool
+	// hooks are notified of the writes committed through this instance
+	hooks *kv.WriteHooks
+	// deletions are the background prefix deletions started through this instance
+	deletions *kv.DeletionJobs
+	// replicaRead is the replica read mode of Has, Load, LoadWithPrefix and WalkWithPrefix
+	replicaRead tikv.ReplicaReadType
+	// removeBatchKeys and removeBatchBytes bound the transactions of MultiRemove, 0 means no limit
+	removeBatchKeys  int
+	removeBatchBytes int
+	// rangeDeleteThreshold is the number of keys RemoveWithPrefix removes by DeleteRange, see WithRangeDeleteThreshold
+	rangeDeleteThreshold int
+	// loadFlights coalesces concurrent Loads of the same key, nil if disabled, see WithSingleFlightLoad
+	loadFlights *conc.Singleflight[string]
+	// loadGeneration is bumped by each write, so Loads after a write never join a read started before it
+	loadGeneration *atomic.Int64
+	// requestTimeout overrides RequestTimeout if positive, see WithTimeout
+	requestTimeout time.Duration
+	// scanSize overrides SnapshotScanSize if positive, see WithScanSize
+	scanSize int
+	// ctx is the parent context of the operations, nil for context.Background, see WithContext
+	ctx context.Context
+	// reaper removes the expired keys in the background, nil if disabled, see WithExpiredKeyReaper
+	reaper *expiredKeyReaper
+	// commitTimeout bounds the commits instead of the deadline of the operation if positive, see WithCommitTimeout
+	commitTimeout time.Duration
+	// conflictRetries and conflictBackoff control the retries of the conflicted writes, see WithConflictRetry
+	conflictRetries int
+	conflictBackoff time.Duration
+	// watchInterval is the interval the watchers poll at, DefaultWatchInterval if not positive, see WithWatchInterval
+	watchInterval time.Duration
+	// watchers are the open watchers of the instance, closed by Close
+	watchers *watcherSet
+	// compressMinSize is the size of the smallest value saves compress, 0 disables it, see WithValueCompression
+	compressMinSize int
+	// versionedPrefixes are the prefixes of the keys whose versions are kept, see WithVersionedPrefixes
+	versionedPrefixes []string
+	// snapshotTS pins the TS Load, MultiLoad, LoadWithPrefix and WalkWithPrefix read at, 0 reads the
+	// latest data, see ReadView
+	snapshotTS uint64
+}
+
+// Option is the option of txnTiKV.
+type Option func(*txnTiKV)
+
+// WithRangeDeleteThreshold makes RemoveWithPrefix remove a prefix of at least threshold keys by a
+// DeleteRange instead of a transaction, e.g. to drop the metas of a collection with hundreds of
+// thousands of keys in about the same time as a few, 0 means never. The keys are counted by a scan
+// stopping at threshold. DeleteRange is neither atomic nor isolated, see removeRange.
+func WithRangeDeleteThreshold(threshold int) Option {
+	return func(kv *txnTiKV) {
+		kv.rangeDeleteThreshold = threshold
+	}
+}
+
+// WithMultiRemoveSplit makes MultiRemove split a key list with more than maxKeys keys or
+// maxBytes bytes of keys into several transactions, 0 means no limit. MultiRemove is no longer
+// atomic then: if a batch fails, the batches before it stay removed, see ErrPartialRemove.
+func WithMultiRemoveSplit(maxKeys, maxBytes int) Option {
+	return func(kv *txnTiKV) {
+		kv.removeBatchKeys = maxKeys
+		kv.removeBatchBytes = maxBytes
+	}
+}
+
+// WithReplicaRead makes Has, Load, LoadWithPrefix and WalkWithPrefix read from followers
+// (tikv.ReplicaReadFollower) or from any replica (tikv.ReplicaReadMixed), to take load off the
+// leaders for background scans. TiKV replica reads go through ReadIndex, so they are not stale:
+// they see everything committed before the read like leader reads do, at the cost of an extra
+// round trip to the leader and waiting for the replica to catch up. Reads inside write
+// transactions always go to the leaders.
+func WithReplicaRead(replicaRead tikv.ReplicaReadType) Option {
+	return func(kv *txnTiKV) {
+		kv.replicaRead = replicaRead
+	}
+}
+
+// WithScanSize makes the scans of the instance, e.g. LoadWithPrefix, WalkWithPrefix with a non-positive
+// pagination size and CountWithPrefix, read batches of size keys instead of SnapshotScanSize, e.g. to
+// read bigger batches from a large cluster. A non-positive size is ignored, the default is kept.
+func WithScanSize(size int) Option {
+	return func(kv *txnTiKV) {
+		if size <= 0 {
+			log.Warn("txnTiKV ignores the non-positive scan size", zap.Int("scanSize", size))
+			return
+		}
+		kv.scanSize = size
+	}
+}
+
+// WithSingleFlightLoad makes concurrent Loads of the same key share one TiKV read and its result,
+// to take load off the cluster when many goroutines read a hot key. A Load never joins a read
+// started before a write committed through this instance, so the Load still sees the writes
+// returned before it; writes of other instances may be missed as long as the shared read lasts.
+// The views of the instance share the reads, a Load joining a read canceled or timed out by the
+// context or the timeout of another view reads again under its own.
+func WithSingleFlightLoad() Option {
+	return func(kv *txnTiKV) {
+		kv.loadFlights = &conc.Singleflight[string]{}
+	}
+}
+
+// WithCommitTimeout makes the commits time out after d instead of at the deadline of the operation,
+// i.e. RequestTimeout or the one of WithTimeout, e.g. to give the commits of a MultiSave of thousands
+// of keys enough time without loosening the deadlines of the reads. A commit still stops once the
+// context of WithContext is done. The errors of timed out commits are marked by ErrCommitTimeout.
+func WithCommitTimeout(d time.Duration) Option {
+	return func(kv *txnTiKV) {
+		kv.commitTimeout = d
+	}
+}
+
+const (
+	// DefaultConflictRetries is the number of retries of a conflicted write, see WithConflictRetry.
+	DefaultConflictRetries = 3
+	// DefaultConflictBackoff is the backoff before the first retry of a conflicted write, see WithConflictRetry.
+	DefaultConflictBackoff = 10 * time.Millisecond
+	// maxConflictBackoff caps the exponential backoff between the retries of a conflicted write.
+	maxConflictBackoff = time.Second
+)
+
+// WithConflictRetry makes Save, SaveWithTTL, MultiSave, MultiRemove, MultiSaveAndRemove,
+// MultiSaveAndRemoveWithPrefix, SaveWithVersionBump and their byte and chunked variants retry the transaction up to
+// maxRetries times when its commit conflicts with a concurrent write or finds its locks resolved,
+// see ErrTxnLockNotFound, instead of DefaultConflictRetries, 0 disables the retries. The backoff
+// before the first retry is baseBackoff, doubled by each retry up to a second. Each retry runs the
+// whole transaction again, including the predicates, so a retry never commits over a predicate
+// which no longer holds. The other errors, including the failed predicates, are returned at once.
+// See ErrConflictRetriesExhausted.
+func WithConflictRetry(maxRetries int, baseBackoff time.Duration) Option {
+	return func(kv *txnTiKV) {
+		kv.conflictRetries = maxRetries
+		kv.conflictBackoff = baseBackoff
+	}
 }
 
 // NewTiKV creates a new txnTiKV client.
-func NewTiKV(txn *txnkv.Client, rootPath string) *txnTiKV {
+func NewTiKV(txn *txnkv.Client, rootPath string, opts ...Option) *txnTiKV {
 	SnapshotScanSize = Params.TiKVCfg.SnapshotScanSize.GetAsInt()
 	RequestTimeout = Params.TiKVCfg.RequestTimeout.GetAsDuration(time.Millisecond)
+	ScanTimeout = Params.TiKVCfg.ScanTimeout.GetAsDuration(time.Millisecond)
+	WriteValueHeader = Params.TiKVCfg.WriteValueHeader.GetAsBool()
 	kv := &txnTiKV{
-		txn:      txn,
-		rootPath: rootPath,
+		clients:         newClientHolder(txn),
+		rootPath:        rootPath,
+		readOnly:        atomic.NewBool(false),
+		hooks:           &kv.WriteHooks{},
+		deletions:       &kv.DeletionJobs{},
+		watchers:        &watcherSet{},
+		loadGeneration:  atomic.NewInt64(0),
+		conflictRetries: DefaultConflictRetries,
+		conflictBackoff: DefaultConflictBackoff,
+	}
+	for _, opt := range opts {
+		opt(kv)
+	}
+	if kv.loadFlights != nil {
+		kv.RegisterWriteHook("", kv.invalidateLoadFlights)
+	}
+	if kv.reaper != nil {
+		go kv.reaper.run(kv)
 	}
 	return kv
 }
 
-// Close closes the connection to TiKV.
+// Close stops the reaper of the expired keys if any, closes the watchers, see Watch, and closes the
+// client connected by Reconnect if any once the operations in flight on it are done. The client passed
+// to NewTiKV is owned by the caller and not closed. Close of a view, see WithTimeout and WithContext,
+// does nothing, as the view shares all of them with the instance.
 func (kv *txnTiKV) Close() {
+	if kv.isView {
+		return
+	}
+	if kv.reaper != nil {
+		kv.reaper.close()
+	}
+	kv.watchers.close()
+	if ref := kv.clients.close(); ref != nil {
+		kv.drainClient(ref)
+	}
 	log.Info("txnTiKV closed", zap.String("path", kv.rootPath))
 }
 
+// relativeKey returns the key relative to the root path.
+func (kv *txnTiKV) relativeKey(key string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(key, kv.rootPath), "/")
+}
+
 // GetPath returns the path of the key/prefix.
 func (kv *txnTiKV) GetPath(key string) string {
 	return path.Join(kv.rootPath, key)
@@ -128,17 +553,223 @@ func logWarnOnFailure(err *error, msg string, fields ...zap.Field) {
 	}
 }
 
+// SetReadOnly switches the read-only mode. While enabled, every write fails with ErrReadOnly
+// before being committed, reads are not affected.
+func (kv *txnTiKV) SetReadOnly(readOnly bool) {
+	kv.readOnly.Store(readOnly)
+	log.Info("txnTiKV set read-only", zap.String("rootPath", kv.rootPath), zap.Bool("readOnly", readOnly))
+}
+
+// WithTimeout returns a view of the instance whose operations use the deadline d instead of
+// RequestTimeout, e.g. to give one slow operation a generous deadline without changing the shared
+// instance. The view shares the client, which is replaced by Reconnect of either, the read-only
+// mode, the write hooks, the deletion jobs, the reaper and the watchers with the instance, closing it
+// does nothing. Scans, e.g. LoadWithPrefix, are not bounded by RequestTimeout but by ScanTimeout, so
+// neither by d.
+func (kv *txnTiKV) WithTimeout(d time.Duration) *txnTiKV {
+	view := *kv
+	view.isView = true
+	view.requestTimeout = d
+	return &view
+}
+
+// WithContext returns a view of the instance whose operations run under ctx, e.g. the context of
+// the RPC they serve, so they stop with its error once the caller cancels or its deadline passes.
+// Requests are still bounded by RequestTimeout, or the deadline of WithTimeout, if it's earlier.
+// Scans check ctx between pages, WalkWithPrefix before each key. Like WithTimeout, the view shares
+// the client and the states of the instance, and the operations keep the kv.MetaKv signatures.
+func (kv *txnTiKV) WithContext(ctx context.Context) *txnTiKV {
+	view := *kv
+	view.isView = true
+	view.ctx = ctx
+	return &view
+}
+
+// baseContext returns the parent context of an operation.
+func (kv *txnTiKV) baseContext() context.Context {
+	if kv.ctx != nil {
+		return kv.ctx
+	}
+	return context.Background()
+}
+
+// The Ctx variants run the operations of the same name under ctx, see WithContext, for callers
+// passing along the context of a request rather than keeping a view of the instance.
+
+// LoadCtx is Load under ctx.
+func (kv *txnTiKV) LoadCtx(ctx context.Context, key string) (string, error) {
+	return kv.WithContext(ctx).Load(key)
+}
+
+// MultiLoadCtx is MultiLoad under ctx.
+func (kv *txnTiKV) MultiLoadCtx(ctx context.Context, keys []string) ([]string, error) {
+	return kv.WithContext(ctx).MultiLoad(keys)
+}
+
+// LoadWithPrefixCtx is LoadWithPrefix under ctx, the scan stops with ctx.Err() between pages.
+func (kv *txnTiKV) LoadWithPrefixCtx(ctx context.Context, prefix string) ([]string, []string, error) {
+	return kv.WithContext(ctx).LoadWithPrefix(prefix)
+}
+
+// WalkWithPrefixCtx is WalkWithPrefix under ctx, the walk stops with ctx.Err() before the next key.
+func (kv *txnTiKV) WalkWithPrefixCtx(ctx context.Context, prefix string, paginationSize int, fn func([]byte, []byte) error) error {
+	return kv.WithContext(ctx).WalkWithPrefix(prefix, paginationSize, fn)
+}
+
+// SaveCtx is Save under ctx.
+func (kv *txnTiKV) SaveCtx(ctx context.Context, key, value string) error {
+	return kv.WithContext(ctx).Save(key, value)
+}
+
+// MultiSaveCtx is MultiSave under ctx.
+func (kv *txnTiKV) MultiSaveCtx(ctx context.Context, kvs map[string]string) error {
+	return kv.WithContext(ctx).MultiSave(kvs)
+}
+
+// RemoveCtx is Remove under ctx.
+func (kv *txnTiKV) RemoveCtx(ctx context.Context, key string) error {
+	return kv.WithContext(ctx).Remove(key)
+}
+
+// MultiRemoveCtx is MultiRemove under ctx.
+func (kv *txnTiKV) MultiRemoveCtx(ctx context.Context, keys []string) error {
+	return kv.WithContext(ctx).MultiRemove(keys)
+}
+
+// RemoveWithPrefixCtx is RemoveWithPrefix under ctx.
+func (kv *txnTiKV) RemoveWithPrefixCtx(ctx context.Context, prefix string) error {
+	return kv.WithContext(ctx).RemoveWithPrefix(prefix)
+}
+
+// MultiSaveAndRemoveCtx is MultiSaveAndRemove under ctx.
+func (kv *txnTiKV) MultiSaveAndRemoveCtx(ctx context.Context, saves map[string]string, removals []string, preds ...predicates.Predicate) error {
+	return kv.WithContext(ctx).MultiSaveAndRemove(saves, removals, preds...)
+}
+
+// MultiSaveAndRemoveWithPrefixCtx is MultiSaveAndRemoveWithPrefix under ctx.
+func (kv *txnTiKV) MultiSaveAndRemoveWithPrefixCtx(ctx context.Context, saves map[string]string, removals []string, preds ...predicates.Predicate) error {
+	return kv.WithContext(ctx).MultiSaveAndRemoveWithPrefix(saves, removals, preds...)
+}
+
+// timeout returns the deadline of a request to TiKV.
+func (kv *txnTiKV) timeout() time.Duration {
+	if kv.requestTimeout > 0 {
+		return kv.requestTimeout
+	}
+	return RequestTimeout
+}
+
+// snapshotScanSize returns the scan size of the instance, see WithScanSize.
+func (kv *txnTiKV) snapshotScanSize() int {
+	if kv.scanSize > 0 {
+		return kv.scanSize
+	}
+	return SnapshotScanSize
+}
+
+// withTimeout is context.WithTimeout, except that a non-positive d means no timeout.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// WithReplicaRead returns a reader whose Has, Load, LoadWithPrefix and WalkWithPrefix use
+// replicaRead for this call only, overriding the mode of the instance, see WithReplicaRead option.
+func (kv *txnTiKV) WithReplicaRead(replicaRead tikv.ReplicaReadType) *replicaReader {
+	return &replicaReader{kv: kv, replicaRead: replicaRead}
+}
+
+// replicaReader is the read-only view of txnTiKV with a given replica read mode.
+type replicaReader struct {
+	kv          *txnTiKV
+	replicaRead tikv.ReplicaReadType
+}
+
+func (r *replicaReader) Has(key string) (_ bool, err error) {
+	defer r.kv.finishOp(&err, "Has", key, 1, time.Now())
+	return r.kv.has(key, r.replicaRead)
+}
+
+func (r *replicaReader) Load(key string) (_ string, err error) {
+	defer r.kv.finishOp(&err, "Load", key, 1, time.Now())
+	return r.kv.load(key, r.replicaRead)
+}
+
+func (r *replicaReader) LoadWithPrefix(prefix string) (_ []string, _ []string, err error) {
+	defer r.kv.finishOp(&err, "LoadWithPrefix", prefix, 1, time.Now())
+	return r.kv.loadWithPrefix(prefix, r.replicaRead)
+}
+
+func (r *replicaReader) WalkWithPrefix(prefix string, paginationSize int, fn func([]byte, []byte) error) (err error) {
+	defer r.kv.finishOp(&err, "WalkWithPrefix", prefix, 1, time.Now())
+	return r.kv.walkWithPrefix(r.kv.baseContext(), prefix, paginationSize, fn, r.replicaRead)
+}
+
+// RegisterWriteHook registers fn to be invoked synchronously after each successful write
+// affecting keys with prefix. Keys passed to fn are relative to the root path.
+func (kv *txnTiKV) RegisterWriteHook(prefix string, fn func(op kv.WriteOp)) {
+	kv.hooks.Register(prefix, fn)
+}
+
+// checkTxnOps checks the number of operations of a transaction against tikv.maxTxnOps. The writes of
+// the version sidecars are checked again with the others by bumpVersions.
+func checkTxnOps(count int) error {
+	limit := Params.TiKVCfg.MaxTxnOps.GetAsInt()
+	if limit > 0 && count > limit {
+		return &ErrTooManyOps{Count: count, Limit: limit}
+	}
+	return nil
+}
+
+// checkValueSize checks the size of the stored value of key, a full key, against tikv.txnEntrySizeLimit,
+// which bounds the key and the value together: the longer the root path, the smaller the values allowed.
+func checkValueSize(key string, size int) error {
+	limit := Params.TiKVCfg.TxnEntrySizeLimit.GetAsInt()
+	if limit <= 0 {
+		return nil
+	}
+	if valueLimit := limit - len(key); size > valueLimit {
+		return &ErrValueTooLarge{Key: key, Size: size, Limit: valueLimit}
+	}
+	return nil
+}
+
+// storedValueSize returns the size of the stored value of value, see convertEmptyStringToByte.
+func storedValueSize(value string) int {
+	if !WriteValueHeader {
+		if len(value) == 0 {
+			return len(EmptyValueByte)
+		}
+		return len(value)
+	}
+	return len(plainValueHeaderByte) + len(value)
+}
+
+func (kv *txnTiKV) checkWritable() error {
+	if kv.readOnly.Load() {
+		return ErrReadOnly
+	}
+	return nil
+}
+
 // Has returns if a key exists.
-func (kv *txnTiKV) Has(key string) (bool, error) {
+func (kv *txnTiKV) Has(key string) (_ bool, err error) {
+	defer kv.finishOp(&err, "Has", key, 1, time.Now())
+	return kv.has(key, kv.replicaRead)
+}
+
+func (kv *txnTiKV) has(key string, replicaRead tikv.ReplicaReadType) (bool, error) {
 	start := time.Now()
 	key = path.Join(kv.rootPath, key)
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
 	defer cancel()
 
 	var logging_error error
 	defer logWarnOnFailure(&logging_error, "txnTiKV Has() error", zap.String("key", key))
 
-	_, err := kv.getTiKVMeta(ctx, key)
+	_, err := kv.getTiKVMeta(ctx, key, replicaRead)
 	if err != nil {
 		// Dont error out if not present unless failed call to tikv
 		if common.IsKeyNotExistError(err) {
@@ -148,7 +779,7 @@ func (kv *txnTiKV) Has(key string) (bool, error) {
 			return false, logging_error
 		}
 	}
-	CheckElapseAndWarn(start, "Slow txnTiKV Has() operation", zap.String("key", key))
+	kv.checkSlowOp(start, "Has", 1, 0, zap.String("key", key))
 	return true, nil
 }
 
@@ -159,14 +790,17 @@ func rollbackOnFailure(err *error, txn *transaction.KVTxn) {
 }
 
 // HasPrefix returns if a key prefix exists.
-func (kv *txnTiKV) HasPrefix(prefix string) (bool, error) {
+func (kv *txnTiKV) HasPrefix(prefix string) (_ bool, err error) {
+	client, release := kv.acquireClient()
+	defer release()
 	start := time.Now()
+	defer kv.finishOp(&err, "HasPrefix", prefix, 1, start)
 	prefix = path.Join(kv.rootPath, prefix)
 
 	var logging_error error
 	defer logWarnOnFailure(&logging_error, "txnTiKV HasPrefix() error", zap.String("prefix", prefix))
 
-	ss := getSnapshot(kv.txn, SnapshotScanSize)
+	ss := getSnapshot(client, kv.snapshotScanSize(), tikv.ReplicaReadLeader)
 
 	// Retrieve bounding keys for prefix
 	startKey := []byte(prefix)
@@ -180,454 +814,2098 @@ func (kv *txnTiKV) HasPrefix(prefix string) (bool, error) {
 	defer iter.Close()
 
 	r := false
-	// Iterater only needs to check the first key-value pair
-	if iter.Valid() {
-		r = true
+	// Iterater only needs to check the first key-value pair which is not expired
+	for iter.Valid() {
+		if !isExpired(iter.Value()) {
+			r = true
+			break
+		}
+		if err = iter.Next(); err != nil {
+			logging_error = errors.Wrap(err, fmt.Sprintf("Failed to iterate for prefix: %s", prefix))
+			return false, logging_error
+		}
 	}
-	CheckElapseAndWarn(start, "Slow txnTiKV HasPrefix() operation", zap.String("prefix", prefix))
+	kv.checkSlowOp(start, "HasPrefix", 0, 0, zap.String("prefix", prefix))
 	return r, nil
 }
 
+// CountWithPrefix returns the number of keys with the input prefix. The keys are scanned keys-only in
+// batches of the scan size of the instance, see WithScanSize, and not held, so the keys of the expired values are counted until they
+// are purged, as LoadKeysWithPrefix lists them. An empty prefix counts all the keys under the root path.
+func (kv *txnTiKV) CountWithPrefix(prefix string) (_ int64, err error) {
+	start := time.Now()
+	defer kv.finishOp(&err, "CountWithPrefix", prefix, 1, start)
+
+	var count int64
+	err = kv.walkKeys(kv.baseContext(), "CountWithPrefix", prefix, kv.snapshotScanSize(), func([]byte) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	kv.checkSlowOp(start, "CountWithPrefix", int(count), 0, zap.String("prefix", prefix), zap.Int64("count", count))
+	return count, nil
+}
+
 // Load returns value of the key.
-func (kv *txnTiKV) Load(key string) (string, error) {
+func (kv *txnTiKV) Load(key string) (_ string, err error) {
+	defer kv.finishOp(&err, "Load", key, 1, time.Now())
+	if kv.loadFlights == nil {
+		return kv.load(key, kv.replicaRead)
+	}
+	flight := fmt.Sprintf("%d/%s", kv.loadGeneration.Load(), key)
+	led := false
+	val, err, _ := kv.loadFlights.Do(flight, func() (string, error) {
+		led = true
+		return kv.load(key, kv.replicaRead)
+	})
+	// the read is run under the context and the timeout of the Load leading it, which could be of
+	// another view, see WithContext and WithTimeout, so the Loads joining it read again if it stops
+	if !led && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return kv.load(key, kv.replicaRead)
+	}
+	return val, err
+}
+
+// invalidateLoadFlights makes the Loads after a write start new reads.
+func (kv *txnTiKV) invalidateLoadFlights(kv.WriteOp) {
+	kv.loadGeneration.Inc()
+}
+
+func (kv *txnTiKV) load(key string, replicaRead tikv.ReplicaReadType) (string, error) {
+	val, err := kv.loadBytes("Load", key, replicaRead)
+	if err != nil {
+		return "", err
+	}
+	return string(val), nil
+}
+
+// loadBytes returns the value of key for op, Load or LoadBytes.
+func (kv *txnTiKV) loadBytes(op string, key string, replicaRead tikv.ReplicaReadType) ([]byte, error) {
 	start := time.Now()
 	key = path.Join(kv.rootPath, key)
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
 	defer cancel()
 
 	var logging_error error
-	defer logWarnOnFailure(&logging_error, "txnTiKV Load() error", zap.String("key", key))
+	defer logWarnOnFailure(&logging_error, fmt.Sprintf("txnTiKV %s() error", op), zap.String("key", key))
 
-	val, err := kv.getTiKVMeta(ctx, key)
+	val, err := kv.getTiKVMetaBytes(ctx, key, replicaRead)
 	if err != nil {
 		if common.IsKeyNotExistError(err) {
 			logging_error = err
 		} else {
 			logging_error = errors.Wrap(err, fmt.Sprintf("Failed to read key %s", key))
 		}
-		return "", logging_error
+		return nil, logging_error
 	}
-	CheckElapseAndWarn(start, "Slow txnTiKV Load() operation", zap.String("key", key))
+	kv.checkSlowOp(start, op, 1, len(val), zap.String("key", key))
 	return val, nil
 }
 
-func batchConvertFromString(prefix string, keys []string) [][]byte {
-	output := make([][]byte, len(keys))
-	for i := 0; i < len(keys); i++ {
-		keys[i] = path.Join(prefix, keys[i])
-		output[i] = []byte(keys[i])
+// MultiLoadBatchSize is the max number of keys read by a BatchGet request of MultiLoad,
+// larger key lists are split into batches so that the requests stay under the message size limit.
+var MultiLoadBatchSize = 1024
+
+// MultiLoad gets the values of input keys from a single snapshot, the values are in the order of keys.
+// The value of a missing key is empty, and an error listing the missing keys is returned along with the values.
+func (kv *txnTiKV) MultiLoad(keys []string) (_ []string, err error) {
+	defer kv.finishOp(&err, "MultiLoad", "", len(keys), time.Now())
+	byteValues, err := kv.multiLoad("MultiLoad", keys)
+	if byteValues == nil {
+		return nil, err
 	}
-	return output
+	values := make([]string, len(byteValues))
+	for i, value := range byteValues {
+		values[i] = string(value)
+	}
+	return values, err
+}
+
+// MultiLoadPartial gets the values of input keys from a single snapshot like MultiLoad, but a missing
+// key is not an error: it returns the values of the keys found, by key, and the keys missing, in the
+// order of keys. The error is only the one of a failed read, e.g. of the connection, with no values.
+func (kv *txnTiKV) MultiLoadPartial(keys []string) (_ map[string]string, _ []string, err error) {
+	defer kv.finishOp(&err, "MultiLoadPartial", "", len(keys), time.Now())
+	byteValues, missing, err := kv.loadKeys("MultiLoadPartial", keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make(map[string]string, len(keys)-len(missing))
+	missingKeys := make([]string, 0, len(missing))
+	for i, key := range keys {
+		if len(missing) > 0 && missing[0] == i {
+			missing = missing[1:]
+			missingKeys = append(missingKeys, key)
+			continue
+		}
+		values[key] = string(byteValues[i])
+	}
+	return values, missingKeys, nil
+}
+
+// multiLoad returns the values of keys for op, MultiLoad or MultiLoadBytes, see MultiLoad.
+func (kv *txnTiKV) multiLoad(op string, keys []string) ([][]byte, error) {
+	values, missing, err := kv.loadKeys(op, keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+	err = missingKeysErrorOf(kv.rootPath, keys, missing)
+	log.Warn(fmt.Sprintf("txnTiKV %s() error", op), zap.Error(err))
+	return values, err
 }
 
-// MultiLoad gets the values of input keys in a transaction.
-func (kv *txnTiKV) MultiLoad(keys []string) ([]string, error) {
+// loadKeys returns the values of keys for op from a single snapshot, and the indexes of the missing
+// keys in keys, in order. The value of a missing key is nil.
+func (kv *txnTiKV) loadKeys(op string, keys []string) ([][]byte, []int, error) {
+	client, release := kv.acquireClient()
+	defer release()
 	start := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
 	defer cancel()
 
+	fullKeys := make([]string, len(keys))
+	for i, key := range keys {
+		fullKeys[i] = path.Join(kv.rootPath, key)
+	}
+
 	var logging_error error
-	defer logWarnOnFailure(&logging_error, "txnTiKV MultiLoad() error", zap.Strings("keys", keys))
+	defer logWarnOnFailure(&logging_error, fmt.Sprintf("txnTiKV %s() error", op), zap.Strings("keys", fullKeys))
 
-	// Convert from []string to [][]byte
-	byte_keys := batchConvertFromString(kv.rootPath, keys)
+	values := make([][]byte, len(keys))
+	missing := []int{}
+	if len(fullKeys) == 1 {
+		// a BatchGet of a single key costs the same round trip as a Get
+		value, err := kv.getTiKVMetaBytes(ctx, fullKeys[0], tikv.ReplicaReadLeader)
+		if common.IsKeyNotExistError(err) {
+			missing = append(missing, 0)
+		} else if err != nil {
+			logging_error = errors.Wrap(err, fmt.Sprintf("Failed getTiKVMeta() for %s", op))
+			return nil, nil, logging_error
+		}
+		values[0] = value
+	} else {
+		// Since only reading, use Snapshot for less overhead, all the batches read from the same snapshot
+		ss := kv.snapshot(client, kv.snapshotScanSize(), tikv.ReplicaReadLeader)
+		for begin := 0; begin < len(fullKeys); begin += MultiLoadBatchSize {
+			end := begin + MultiLoadBatchSize
+			if end > len(fullKeys) {
+				end = len(fullKeys)
+			}
+			byte_keys := make([][]byte, 0, end-begin)
+			for _, key := range fullKeys[begin:end] {
+				byte_keys = append(byte_keys, []byte(key))
+			}
 
-	// Since only reading, use Snapshot for less overhead
-	ss := getSnapshot(kv.txn, SnapshotScanSize)
+			key_map, err := ss.BatchGet(ctx, byte_keys)
+			if err != nil {
+				logging_error = errors.Wrap(err, fmt.Sprintf("Failed ss.BatchGet() for %s", op))
+				return nil, nil, logging_error
+			}
 
-	key_map, err := ss.BatchGet(ctx, byte_keys)
-	if err != nil {
-		logging_error = errors.Wrap(err, "Failed ss.BatchGet() for MultiLoad")
-		return nil, logging_error
+			for i := begin; i < end; i++ {
+				v, ok := key_map[fullKeys[i]]
+				if !ok || isExpired(v) {
+					missing = append(missing, i)
+					continue
+				}
+				// Check if empty value placeholder
+				if values[i], err = decodeValue(v); err != nil {
+					logging_error = errors.Wrap(err, fmt.Sprintf("Failed to decode key %s for %s", fullKeys[i], op))
+					return nil, nil, logging_error
+				}
+				observeValueSize(fullKeys[i], len(v), largeValueOpLoad)
+			}
+		}
 	}
 
-	missing_values := []string{}
-	valid_values := []string{}
+	kv.checkSlowOp(start, op, len(fullKeys), valuesSize(values), zap.Any("keys", fullKeys))
+	return values, missing, nil
+}
+
+// LoadWithPrefix returns all the keys and values for the given key prefix.
+func (kv *txnTiKV) LoadWithPrefix(prefix string) (_ []string, _ []string, err error) {
+	defer kv.finishOp(&err, "LoadWithPrefix", prefix, 1, time.Now())
+	return kv.loadWithPrefix(prefix, kv.replicaRead)
+}
 
-	// Loop through keys and build valid/invalid slices
-	for _, k := range keys {
-		v, ok := key_map[k]
-		if !ok {
-			missing_values = append(missing_values, k)
-		}
-		// Check if empty value placeholder
-		str_val := convertEmptyByteToString(v)
-		valid_values = append(valid_values, str_val)
+// LoadWithPrefixAsMap is LoadWithPrefix returning the full keys mapped to their values.
+func (kv *txnTiKV) LoadWithPrefixAsMap(prefix string) (_ map[string]string, err error) {
+	defer kv.finishOp(&err, "LoadWithPrefixAsMap", prefix, 1, time.Now())
+	keys, values, err := kv.loadWithPrefix(prefix, kv.replicaRead)
+	if err != nil {
+		return nil, err
 	}
-	if len(missing_values) != 0 {
-		logging_error = fmt.Errorf("There are invalid keys: %s", missing_values)
+	kvs := make(map[string]string, len(keys))
+	for i, key := range keys {
+		kvs[key] = values[i]
 	}
-
-	CheckElapseAndWarn(start, "Slow txnTiKV MultiLoad() operation", zap.Any("keys", keys))
-	return valid_values, logging_error
+	return kvs, nil
 }
 
-// LoadWithPrefix returns all the keys and values for the given key prefix.
-func (kv *txnTiKV) LoadWithPrefix(prefix string) ([]string, []string, error) {
+func (kv *txnTiKV) loadWithPrefix(prefix string, replicaRead tikv.ReplicaReadType) ([]string, []string, error) {
+	client, release := kv.acquireClient()
+	defer release()
 	start := time.Now()
 	prefix = path.Join(kv.rootPath, prefix)
 
 	var logging_error error
 	defer logWarnOnFailure(&logging_error, "txnTiKV LoadWithPrefix() error", zap.String("prefix", prefix))
 
-	ss := getSnapshot(kv.txn, SnapshotScanSize)
-
-	// Retrieve key-value pairs with the specified prefix
-	startKey := []byte(prefix)
-	endKey := tikv.PrefixNextKey([]byte(prefix))
-	iter, err := ss.Iter(startKey, endKey)
+	ctx, cancel := withTimeout(kv.baseContext(), ScanTimeout)
+	defer cancel()
+	ss := kv.snapshot(client, kv.snapshotScanSize(), replicaRead)
+	keys, values, err := scanPrefix(ctx, ss, prefix)
 	if err != nil {
-		logging_error = errors.Wrap(err, fmt.Sprintf("Failed to create iterater for LoadWithPrefix() for prefix: %s", prefix))
+		logging_error = err
 		return nil, nil, logging_error
 	}
-	defer iter.Close()
+	kv.checkSlowOp(start, "LoadWithPrefix", len(keys), valuesSize(values), zap.String("prefix", prefix))
+	return keys, values, nil
+}
 
-	var keys []string
-	var values []string
+// LoadWithRange returns the key-value pairs in [startKey, endKey) in key order, e.g. for the bounds a
+// prefix can't express or the keys ordered by timestamps, at most limit of them if it's positive, all
+// of them if it's 0. An empty startKey starts from the first key under the root path, an empty endKey
+// scans to the last one, and the keys out of the root path are never returned. The keys are relative
+// to the root path as the ones of Load, the returned keys are full as the ones of LoadWithPrefix.
+func (kv *txnTiKV) LoadWithRange(startKey, endKey string, limit int) (_ []string, _ []string, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "LoadWithRange", startKey, 1, start)
 
-	// Iterate over the key-value pairs
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV LoadWithRange() error", zap.String("startKey", startKey), zap.String("endKey", endKey), zap.Int("limit", limit))
+
+	if limit < 0 {
+		loggingErr = merr.WrapErrParameterInvalidMsg("limit must not be negative, got %d", limit)
+		return nil, nil, loggingErr
+	}
+	// the keys under the root path, excluding the ones of the other root paths sharing its prefix
+	rootPrefix := strings.TrimSuffix(kv.rootPath, "/") + "/"
+	fullStartKey, fullEndKey := rootPrefix, string(tikv.PrefixNextKey([]byte(rootPrefix)))
+	if startKey != "" {
+		fullStartKey = kv.GetPath(startKey)
+	}
+	if endKey != "" {
+		fullEndKey = kv.GetPath(endKey)
+	}
+	if !strings.HasPrefix(fullStartKey, rootPrefix) || (endKey != "" && !strings.HasPrefix(fullEndKey, rootPrefix)) {
+		loggingErr = merr.WrapErrParameterInvalidMsg("range [%s, %s) is out of the root path %s", startKey, endKey, kv.rootPath)
+		return nil, nil, loggingErr
+	}
+	if fullStartKey > fullEndKey {
+		loggingErr = merr.WrapErrParameterInvalidMsg("start key %s is after end key %s", startKey, endKey)
+		return nil, nil, loggingErr
+	}
+
+	var keys, values []string
+	if limit > 0 {
+		keys, values, _, err = kv.loadPage(client, "LoadWithRange", []byte(fullStartKey), []byte(fullEndKey), limit)
+	} else {
+		ctx, cancel := withTimeout(kv.baseContext(), ScanTimeout)
+		defer cancel()
+		ss := getSnapshot(client, kv.snapshotScanSize(), kv.replicaRead)
+		keys, values, err = scanRange(ctx, ss, keyRange{start: []byte(fullStartKey), end: []byte(fullEndKey)})
+	}
+	if err != nil {
+		loggingErr = err
+		return nil, nil, loggingErr
+	}
+	kv.checkSlowOp(start, "LoadWithRange", len(keys), valuesSize(values), zap.String("startKey", fullStartKey), zap.String("endKey", fullEndKey), zap.Int("limit", limit))
+	return keys, values, nil
+}
+
+// scanPrefix returns the key-value pairs with the full prefix in the snapshot.
+func scanPrefix(ctx context.Context, ss *txnsnapshot.KVSnapshot, prefix string) ([]string, []string, error) {
+	// Retrieve key-value pairs with the specified prefix
+	return scanRange(ctx, ss, keyRange{start: []byte(prefix), end: tikv.PrefixNextKey([]byte(prefix))})
+}
+
+// scanPageSize is the number of key-value pairs scanRange converts into strings at once.
+const scanPageSize = 1024
+
+// maxPooledScanPageBytes bounds the buffers kept in scanPagePool, larger ones from pages of huge values are dropped.
+const maxPooledScanPageBytes = 4 << 20
+
+// scanPage buffers the key-value pairs of a page scanned by scanRange.
+type scanPage struct {
+	buf []byte
+	// ends are the end offsets of the keys and the values in buf, in turns
+	ends []int
+}
+
+var scanPagePool = sync.Pool{
+	New: func() any {
+		return &scanPage{ends: make([]int, 0, 2*scanPageSize)}
+	},
+}
+
+// scanRange returns the key-value pairs in the key range in the snapshot.
+// The bytes of a page of key-value pairs are copied into a single string which the returned keys and
+// values are sliced from, so a page stays in memory while any of its keys or values is referenced.
+// The scan stops with the error of ctx after a page once ctx is done.
+func scanRange(ctx context.Context, ss *txnsnapshot.KVSnapshot, r keyRange) ([]string, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, fmt.Sprintf("LoadWithPrefix() stopped for range [%s, %s)", r.start, r.end))
+	}
+	iter, err := ss.Iter(r.start, r.end)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, fmt.Sprintf("Failed to create iterater for LoadWithPrefix() for range [%s, %s)", r.start, r.end))
+	}
+	defer iter.Close()
+
+	page := scanPagePool.Get().(*scanPage)
+	defer func() {
+		if cap(page.buf) <= maxPooledScanPageBytes {
+			page.buf, page.ends = page.buf[:0], page.ends[:0]
+			scanPagePool.Put(page)
+		}
+	}()
+
+	var keys []string
+	var values []string
+	flush := func() {
+		if len(page.ends) == 0 {
+			return
+		}
+		if keys == nil {
+			keys = make([]string, 0, len(page.ends)/2)
+			values = make([]string, 0, len(page.ends)/2)
+		}
+		str := string(page.buf)
+		begin := 0
+		for i := 0; i < len(page.ends); i += 2 {
+			key, value := str[begin:page.ends[i]], str[page.ends[i]:page.ends[i+1]]
+			keys = append(keys, key)
+			values = append(values, value)
+			begin = page.ends[i+1]
+		}
+		page.buf, page.ends = page.buf[:0], page.ends[:0]
+	}
+
+	// Iterate over the key-value pairs
 	for iter.Valid() {
 		val := iter.Value()
-		// Check if empty value placeholder
-		str_val := convertEmptyByteToString(val)
-		keys = append(keys, string(iter.Key()))
-		values = append(values, str_val)
+		observeValueSizeBytes(iter.Key(), len(val), largeValueOpScan)
+		if isExpired(val) {
+			if err = iter.Next(); err != nil {
+				return nil, nil, errors.Wrap(err, fmt.Sprintf("Failed to iterate for LoadWithPrefix() for range [%s, %s)", r.start, r.end))
+			}
+			continue
+		}
+		// Decode value from the stored encoding
+		value, err := decodeValue(val)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("Failed to decode key %s for LoadWithPrefix()", string(iter.Key())))
+		}
+		page.buf = append(page.buf, iter.Key()...)
+		page.ends = append(page.ends, len(page.buf))
+		page.buf = append(page.buf, value...)
+		page.ends = append(page.ends, len(page.buf))
+		if len(page.ends) >= 2*scanPageSize {
+			flush()
+			if err = ctx.Err(); err != nil {
+				return nil, nil, errors.Wrap(err, fmt.Sprintf("LoadWithPrefix() stopped after key %s for range [%s, %s)", string(iter.Key()), r.start, r.end))
+			}
+		}
 		err = iter.Next()
 		if err != nil {
-			logging_error = errors.Wrap(err, fmt.Sprintf("Failed to iterate for LoadWithPrefix() for prefix: %s", prefix))
-			return nil, nil, logging_error
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("Failed to iterate for LoadWithPrefix() for range [%s, %s)", r.start, r.end))
 		}
 	}
-	CheckElapseAndWarn(start, "Slow txnTiKV LoadWithPrefix() operation", zap.String("prefix", prefix))
+	flush()
 	return keys, values, nil
 }
 
+// LoadWithPrefixPage returns at most limit key-value pairs with the given prefix, after skipping the
+// first offset keys in key order. The skipped keys still have to be scanned, so the cost is O(offset + limit);
+// prefer WalkWithPrefix or a cursor on the last returned key for deep paging.
+func (kv *txnTiKV) LoadWithPrefixPage(prefix string, offset, limit int) (_ []string, _ []string, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "LoadWithPrefixPage", prefix, 1, start)
+	prefix = path.Join(kv.rootPath, prefix)
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV LoadWithPrefixPage() error", zap.String("prefix", prefix), zap.Int("offset", offset), zap.Int("limit", limit))
+
+	if offset < 0 || limit < 0 {
+		loggingErr = merr.WrapErrParameterInvalidMsg("offset and limit must not be negative, offset: %d, limit: %d", offset, limit)
+		return nil, nil, loggingErr
+	}
+
+	keys := make([]string, 0, limit)
+	values := make([]string, 0, limit)
+	if limit == 0 {
+		return keys, values, nil
+	}
+
+	ss := getSnapshot(client, kv.snapshotScanSize(), tikv.ReplicaReadLeader)
+
+	startKey := []byte(prefix)
+	endKey := tikv.PrefixNextKey([]byte(prefix))
+	iter, err := ss.Iter(startKey, endKey)
+	if err != nil {
+		loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to create iterater for LoadWithPrefixPage() for prefix: %s", prefix))
+		return nil, nil, loggingErr
+	}
+	defer iter.Close()
+
+	for skipped := 0; iter.Valid() && len(keys) < limit; {
+		if !isExpired(iter.Value()) {
+			if skipped >= offset {
+				value, err := convertEmptyByteToString(iter.Value())
+				if err != nil {
+					loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to decode key %s for LoadWithPrefixPage()", string(iter.Key())))
+					return nil, nil, loggingErr
+				}
+				keys = append(keys, string(iter.Key()))
+				values = append(values, value)
+			}
+			skipped++
+		}
+		err = iter.Next()
+		if err != nil {
+			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to iterate for LoadWithPrefixPage() for prefix: %s", prefix))
+			return nil, nil, loggingErr
+		}
+	}
+	kv.checkSlowOp(start, "LoadWithPrefixPage", len(keys), valuesSize(values), zap.String("prefix", prefix), zap.Int("offset", offset), zap.Int("limit", limit))
+	return keys, values, nil
+}
+
+// LoadWithPrefixPaged returns at most limit key-value pairs with the given prefix in key order, starting
+// after the pair token was returned for, or from the first pair if token is empty. nextToken resumes
+// the scan after the last returned pair, it's empty once all the pairs are returned. The token is
+// opaque to the callers, e.g. to be passed around by an HTTP endpoint. Each page is read from a
+// snapshot of its own, so the pages see the writes committed between them.
+func (kv *txnTiKV) LoadWithPrefixPaged(prefix string, limit int, token string) (_ []string, _ []string, nextToken string, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "LoadWithPrefixPaged", prefix, 1, start)
+	prefix = path.Join(kv.rootPath, prefix)
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV LoadWithPrefixPaged() error", zap.String("prefix", prefix), zap.Int("limit", limit), zap.String("token", token))
+
+	if limit <= 0 {
+		loggingErr = merr.WrapErrParameterInvalidMsg("limit must be positive, got %d", limit)
+		return nil, nil, "", loggingErr
+	}
+	startKey := []byte(prefix)
+	endKey := tikv.PrefixNextKey([]byte(prefix))
+	if token != "" {
+		lastKey, err := kv.decodePageToken(token)
+		if err != nil || !strings.HasPrefix(lastKey, prefix) {
+			loggingErr = merr.WrapErrParameterInvalidMsg("invalid token %s for prefix %s", token, prefix)
+			return nil, nil, "", loggingErr
+		}
+		// the smallest key after the last returned one
+		startKey = append([]byte(lastKey), 0)
+	}
+
+	keys, values, more, err := kv.loadPage(client, "LoadWithPrefixPaged", startKey, endKey, limit)
+	if err != nil {
+		loggingErr = err
+		return nil, nil, "", loggingErr
+	}
+	if more {
+		nextToken = kv.encodePageToken(keys[len(keys)-1])
+	}
+	kv.checkSlowOp(start, "LoadWithPrefixPaged", len(keys), valuesSize(values), zap.String("prefix", prefix), zap.Int("limit", limit))
+	return keys, values, nextToken, nil
+}
+
+// LoadWithPrefixPaginated is LoadWithPrefixPaged resuming strictly after the full key startAfter
+// instead of a token, or from the first pair if startAfter is empty or before the prefix range.
+// nextKey is the last returned key to pass as startAfter for the next page, it's empty once all the
+// pairs are returned. As the pages resume after a key rather than an offset, keys inserted or removed
+// between the calls don't make the pages skip or repeat the other keys.
+func (kv *txnTiKV) LoadWithPrefixPaginated(prefix string, limit int, startAfter string) (_ []string, _ []string, nextKey string, err error) {
+	fullPrefix := path.Join(kv.rootPath, prefix)
+	token := ""
+	if startAfter != "" && startAfter >= fullPrefix {
+		if !strings.HasPrefix(startAfter, fullPrefix) && limit > 0 {
+			// after the prefix range
+			return []string{}, []string{}, "", nil
+		}
+		token = kv.encodePageToken(startAfter)
+	}
+	keys, values, nextToken, err := kv.LoadWithPrefixPaged(prefix, limit, token)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if nextToken != "" {
+		nextKey = keys[len(keys)-1]
+	}
+	return keys, values, nextKey, nil
+}
+
+// loadPage returns at most limit non-expired key-value pairs in [startKey, endKey), and if there are
+// more pairs after them.
+func (kv *txnTiKV) loadPage(client *txnkv.Client, op string, startKey, endKey []byte, limit int) ([]string, []string, bool, error) {
+	ctx, cancel := withTimeout(kv.baseContext(), ScanTimeout)
+	defer cancel()
+	// the page and the key telling if there are more, at most
+	batchSize := limit + 1
+	if scanSize := kv.snapshotScanSize(); batchSize > scanSize {
+		batchSize = scanSize
+	}
+	ss := getSnapshot(client, batchSize, tikv.ReplicaReadLeader)
+	iter, err := ss.Iter(startKey, endKey)
+	if err != nil {
+		return nil, nil, false, errors.Wrap(err, fmt.Sprintf("Failed to create iterater for %s() for range [%s, %s)", op, startKey, endKey))
+	}
+	defer iter.Close()
+
+	keys := make([]string, 0, limit)
+	values := make([]string, 0, limit)
+	for iter.Valid() {
+		if err = ctx.Err(); err != nil {
+			return nil, nil, false, errors.Wrap(err, fmt.Sprintf("%s() stopped before key %s", op, string(iter.Key())))
+		}
+		if !isExpired(iter.Value()) {
+			if len(keys) == limit {
+				return keys, values, true, nil
+			}
+			value, err := convertEmptyByteToString(iter.Value())
+			if err != nil {
+				return nil, nil, false, errors.Wrap(err, fmt.Sprintf("Failed to decode key %s for %s()", string(iter.Key()), op))
+			}
+			keys = append(keys, string(iter.Key()))
+			values = append(values, value)
+		}
+		if err = iter.Next(); err != nil {
+			return nil, nil, false, errors.Wrap(err, fmt.Sprintf("Failed to iterate for %s() for range [%s, %s)", op, startKey, endKey))
+		}
+	}
+	return keys, values, false, nil
+}
+
+// encodePageToken returns the token of LoadWithPrefixPaged resuming after the full key, which keeps
+// the root path out of the token, see LoadWithPrefixPaginated.
+func (kv *txnTiKV) encodePageToken(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.TrimPrefix(key, kv.rootPath)))
+}
+
+// decodePageToken returns the full key of the token of LoadWithPrefixPaged.
+func (kv *txnTiKV) decodePageToken(token string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", err
+	}
+	return kv.rootPath + string(key), nil
+}
+
 // Save saves the input key-value pair.
-func (kv *txnTiKV) Save(key, value string) error {
+func (kv *txnTiKV) Save(key, value string) (err error) {
+	defer kv.finishOp(&err, "Save", key, 1, time.Now())
+	relativeKey := key
 	key = path.Join(kv.rootPath, key)
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
 	defer cancel()
 
 	var logging_error error
-	defer logWarnOnFailure(&logging_error, "txnTiKV Save() error", zap.String("key", key), zap.String("value", value))
+	defer logWarnOnFailure(&logging_error, "txnTiKV Save() error", zap.String("key", key), valueField(key, value))
 
 	logging_error = kv.putTiKVMeta(ctx, key, value)
-	return logging_error
+	if logging_error != nil {
+		return logging_error
+	}
+	kv.hooks.NotifySave(map[string]string{relativeKey: value})
+	return nil
 }
 
 // MultiSave saves the input key-value pairs in transaction manner.
-func (kv *txnTiKV) MultiSave(kvs map[string]string) error {
+func (kv *txnTiKV) MultiSave(kvs map[string]string) (err error) {
+	client, release := kv.acquireClient()
+	defer release()
 	start := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer kv.finishOp(&err, "MultiSave", "", len(kvs), start)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
 	defer cancel()
 
 	var logging_error error
-	defer logWarnOnFailure(&logging_error, "txnTiKV MultiSave() error", zap.Any("kvs", kvs), zap.Int("len", len(kvs)))
+	defer logWarnOnFailure(&logging_error, "txnTiKV MultiSave() error", valuesField("kvs", kvs), zap.Int("len", len(kvs)))
+
+	if logging_error = checkTxnOps(len(kvs)); logging_error != nil {
+		return logging_error
+	}
 
-	txn, err := beginTxn(kv.txn)
+	saves, err := kv.encodeSaves("MultiSave", kvs)
 	if err != nil {
-		logging_error = errors.Wrap(err, "Failed to create txn for MultiSave")
+		logging_error = err
+		return logging_error
+	}
+	if logging_error = kv.saveAndRemove(ctx, client, "MultiSave", saves, nil); logging_error != nil {
 		return logging_error
 	}
+	kv.checkSlowOp(start, "MultiSave", len(kvs), mapValuesSize(kvs), valuesField("kvs", kvs))
+	kv.hooks.NotifySave(kvs)
+	return nil
+}
 
-	// Defer a rollback only if the transaction hasn't been committed
-	defer rollbackOnFailure(&logging_error, txn)
+// MultiSaveChunked saves kvs like MultiSave, but splits them in key order into chunks of at most
+// maxKeys pairs and maxBytes bytes of keys and values, 0 means no limit, and commits the chunks one
+// by one. A chunk never has more pairs than tikv.maxTxnOps, and a pair larger than maxBytes is
+// committed alone. Only each chunk is atomic: if a chunk fails, the chunks before it stay saved,
+// see ErrPartialSave. Callers needing atomicity should use MultiSave, which fails instead.
+func (kv *txnTiKV) MultiSaveChunked(kvs map[string]string, maxKeys, maxBytes int) (err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "MultiSaveChunked", "", len(kvs), start)
 
-	for key, value := range kvs {
-		key = path.Join(kv.rootPath, key)
-		// Check if value is empty or taking reserved EmptyValue
-		byte_value, err := convertEmptyStringToByte(value)
-		if err != nil {
-			logging_error = errors.Wrap(err, fmt.Sprintf("Failed to cast to byte (%s:%s) for MultiSave()", key, value))
-			return logging_error
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV MultiSaveChunked() error", zap.Int("len", len(kvs)), zap.Int("maxKeys", maxKeys), zap.Int("maxBytes", maxBytes))
+
+	if maxKeys < 0 || maxBytes < 0 {
+		loggingErr = merr.WrapErrParameterInvalidMsg("maxKeys and maxBytes must not be negative, maxKeys: %d, maxBytes: %d", maxKeys, maxBytes)
+		return loggingErr
+	}
+	if limit := Params.TiKVCfg.MaxTxnOps.GetAsInt(); limit > 0 && (maxKeys == 0 || maxKeys > limit) {
+		maxKeys = limit
+	}
+	encoded, err := kv.encodeSaves("MultiSaveChunked", kvs)
+	if err != nil {
+		loggingErr = err
+		return loggingErr
+	}
+
+	// the keys of the chunks are full keys
+	relativeKeys := make(map[string]string, len(kvs))
+	for key := range kvs {
+		relativeKeys[path.Join(kv.rootPath, key)] = key
+	}
+	chunks := kv.splitSaves(encoded, maxKeys, maxBytes)
+	saved := make([]string, 0, len(kvs))
+	for i, chunk := range chunks {
+		if err := kv.saveChunk(client, encoded, chunk); err != nil {
+			if len(chunks) == 1 {
+				loggingErr = err
+			} else {
+				loggingErr = &ErrPartialSave{
+					CommittedChunks: i,
+					TotalChunks:     len(chunks),
+					Saved:           saved,
+					FirstKey:        relativeKeys[chunk[0]],
+					LastKey:         relativeKeys[chunk[len(chunk)-1]],
+					Err:             err,
+				}
+			}
+			return loggingErr
 		}
-		// Save the value within a transaction
-		err = txn.Set([]byte(key), byte_value)
-		if err != nil {
-			logging_error = errors.Wrap(err, fmt.Sprintf("Failed to set (%s:%s) for MultiSave()", key, value))
-			return logging_error
+		notified := make(map[string]string, len(chunk))
+		for _, key := range chunk {
+			key = relativeKeys[key]
+			saved = append(saved, key)
+			notified[key] = kvs[key]
 		}
+		kv.hooks.NotifySave(notified)
 	}
-	err = kv.executeTxn(txn, ctx)
+	kv.checkSlowOp(start, "MultiSaveChunked", len(kvs), mapValuesSize(kvs), zap.Int("len", len(kvs)), zap.Int("chunks", len(chunks)))
+	return nil
+}
+
+// splitSaves splits the full keys of the stored values of saves in key order into chunks of at
+// most maxKeys keys and maxBytes bytes of keys and values, 0 means no limit.
+func (kv *txnTiKV) splitSaves(saves map[string][]byte, maxKeys, maxBytes int) [][]string {
+	keys := make([]string, 0, len(saves))
+	for key := range saves {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var chunks [][]string
+	begin, size := 0, 0
+	for i, key := range keys {
+		pairSize := len(key) + len(saves[key])
+		overKeys := maxKeys > 0 && i-begin >= maxKeys
+		overBytes := maxBytes > 0 && size+pairSize > maxBytes
+		if i > begin && (overKeys || overBytes) {
+			chunks = append(chunks, keys[begin:i])
+			begin, size = i, 0
+		}
+		size += pairSize
+	}
+	if begin < len(keys) {
+		chunks = append(chunks, keys[begin:])
+	}
+	return chunks
+}
+
+// saveChunk saves the stored values of saves of the full keys of chunk within one transaction.
+func (kv *txnTiKV) saveChunk(client *txnkv.Client, saves map[string][]byte, chunk []string) error {
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+	chunkSaves := make(map[string][]byte, len(chunk))
+	for _, key := range chunk {
+		chunkSaves[key] = saves[key]
+	}
+	return kv.saveAndRemove(ctx, client, "MultiSaveChunked", chunkSaves, nil)
+}
+
+// MultiSaveStream saves the key-value pairs yielded by pairs, committing them in transactions
+// of about batchBytes bytes of keys and values and at most tikv.maxTxnOps pairs, a pair larger than
+// batchBytes is committed alone. pairs has the same shape as iter.Seq2[string, string]. The
+// transactions are retried on conflicts like MultiSave, see WithConflictRetry.
+// Only each batch is atomic: if an error occurs, the batches committed before are kept,
+// and the pairs not consumed yet are not saved.
+func (kv *txnTiKV) MultiSaveStream(ctx context.Context, pairs func(yield func(string, string) bool), batchBytes int) (err error) {
+	defer kv.finishOp(&err, "MultiSaveStream", "", 0, time.Now())
+	if batchBytes <= 0 {
+		return merr.WrapErrParameterInvalidMsg("batchBytes must be positive, got %d", batchBytes)
+	}
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV MultiSaveStream() error", zap.Int("batchBytes", batchBytes))
+
+	maxPairs := Params.TiKVCfg.MaxTxnOps.GetAsInt()
+	batch := make(map[string]string)
+	size := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := kv.saveBatch(ctx, batch); err != nil {
+			return err
+		}
+		kv.hooks.NotifySave(batch)
+		batch = make(map[string]string)
+		size = 0
+		return nil
+	}
+
+	pairs(func(key, value string) bool {
+		if loggingErr = ctx.Err(); loggingErr != nil {
+			return false
+		}
+		if _, ok := batch[key]; !ok && size > 0 && (size+len(key)+len(value) > batchBytes || maxPairs > 0 && len(batch) >= maxPairs) {
+			if loggingErr = flush(); loggingErr != nil {
+				return false
+			}
+		}
+		batch[key] = value
+		size += len(key) + len(value)
+		return true
+	})
+	if loggingErr != nil {
+		return loggingErr
+	}
+	loggingErr = flush()
+	return loggingErr
+}
+
+// saveBatch saves kvs within one transaction, retried on conflicts like MultiSave.
+func (kv *txnTiKV) saveBatch(ctx context.Context, kvs map[string]string) (err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	ctx, cancel := withTimeout(ctx, kv.timeout())
+	defer cancel()
+
+	if err := checkTxnOps(len(kvs)); err != nil {
+		return err
+	}
+	saves, err := kv.encodeSaves("saveBatch", kvs)
 	if err != nil {
-		logging_error = errors.Wrap(err, "Failed to commit for MultiSave()")
-		return logging_error
+		return err
 	}
-	CheckElapseAndWarn(start, "Slow txnTiKV MultiSave() operation", zap.Any("kvs", kvs))
+	if err := kv.saveAndRemove(ctx, client, "saveBatch", saves, nil); err != nil {
+		return err
+	}
+	kv.checkSlowOp(start, "saveBatch", len(kvs), mapValuesSize(kvs), zap.Int("len", len(kvs)))
 	return nil
 }
 
 // Remove removes the input key.
-func (kv *txnTiKV) Remove(key string) error {
+func (kv *txnTiKV) Remove(key string) (err error) {
+	defer kv.finishOp(&err, "Remove", key, 1, time.Now())
+	relativeKey := key
 	key = path.Join(kv.rootPath, key)
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
 	defer cancel()
 
 	var logging_error error
 	defer logWarnOnFailure(&logging_error, "txnTiKV Remove() error", zap.String("key", key))
 
 	logging_error = kv.removeTiKVMeta(ctx, key)
-	return logging_error
+	if logging_error != nil {
+		return logging_error
+	}
+	kv.hooks.NotifyRemove(relativeKey)
+	return nil
+}
+
+// MultiRemove removes the input keys in transaction manner.
+// If the kv is created WithMultiRemoveSplit, a list over the limits is removed in several
+// transactions instead, see WithMultiRemoveSplit.
+func (kv *txnTiKV) MultiRemove(keys []string) (err error) {
+	start := time.Now()
+	defer kv.finishOp(&err, "MultiRemove", "", len(keys), start)
+
+	var logging_error error
+	defer logWarnOnFailure(&logging_error, "txnTiKV MultiRemove() error", zap.Strings("keys", keys), zap.Int("len", len(keys)))
+
+	batches := kv.splitRemoval(keys)
+	removed := 0
+	for i, batch := range batches {
+		if err := kv.removeBatch(batch); err != nil {
+			if len(batches) == 1 {
+				logging_error = err
+			} else {
+				logging_error = &ErrPartialRemove{
+					CommittedBatches: i,
+					TotalBatches:     len(batches),
+					Removed:          keys[:removed],
+					Err:              err,
+				}
+			}
+			return logging_error
+		}
+		removed += len(batch)
+		kv.hooks.NotifyRemove(batch...)
+	}
+	kv.checkSlowOp(start, "MultiRemove", len(keys), 0, zap.Strings("keys", keys))
+	return nil
+}
+
+// splitRemoval splits keys into batches within the limits of WithMultiRemoveSplit.
+func (kv *txnTiKV) splitRemoval(keys []string) [][]string {
+	if kv.removeBatchKeys <= 0 && kv.removeBatchBytes <= 0 {
+		return [][]string{keys}
+	}
+	var batches [][]string
+	begin, size := 0, 0
+	for i, key := range keys {
+		keySize := len(kv.rootPath) + len(key) + 1
+		overKeys := kv.removeBatchKeys > 0 && i-begin >= kv.removeBatchKeys
+		overBytes := kv.removeBatchBytes > 0 && size+keySize > kv.removeBatchBytes
+		if i > begin && (overKeys || overBytes) {
+			batches = append(batches, keys[begin:i])
+			begin, size = i, 0
+		}
+		size += keySize
+	}
+	return append(batches, keys[begin:])
+}
+
+// removeBatch removes keys within one transaction.
+func (kv *txnTiKV) removeBatch(keys []string) (err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	remove := func() (err error) {
+		txn, err := startTxn(client)
+		if err != nil {
+			return errors.Wrap(err, "Failed to create txn for MultiRemove")
+		}
+
+		// Defer a rollback only if the transaction hasn't been committed
+		defer rollbackOnFailure(&err, txn)
+
+		for _, key := range keys {
+			key = path.Join(kv.rootPath, key)
+			if err = txn.Delete([]byte(key)); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("Failed to delete %s for MultiRemove", key))
+			}
+		}
+
+		if err = kv.executeTxn(txn, ctx); err != nil {
+			return errors.Wrap(err, "Failed to commit for MultiRemove()")
+		}
+		return nil
+	}
+	return kv.retryOnConflict(ctx, remove)
+}
+
+// prefixEnd returns the first key after the keys with the prefix: the prefix without its trailing 0xff
+// bytes with the last byte incremented, or nil, the end of the keys, if the prefix is all 0xff bytes.
+// Unlike tikv.PrefixNextKey, which keeps the carried bytes as 0x00, "ab\xff" ends at "ac" rather than
+// "ac\x00", so the range doesn't cover the sibling key "ac".
+func prefixEnd(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			end := make([]byte, i+1)
+			copy(end, prefix)
+			end[i]++
+			return end
+		}
+	}
+	return nil
+}
+
+// RemoveWithPrefix removes the keys for the given prefix in a transaction, retried on conflicts, see
+// WithConflictRetry, so it's bound by tikv.maxTxnOps. The keys removed are the ones in
+// [prefix, prefixEnd(prefix)), which ends before the first key not starting with the prefix, so removing
+// "x/abc" leaves "x/abd" alone, though it removes "x/abcd" as LoadWithPrefix("x/abc") loads it. A prefix
+// of at least the threshold of WithRangeDeleteThreshold keys is removed by the DeleteRange of the range
+// instead, see removeRange.
+func (kv *txnTiKV) RemoveWithPrefix(prefix string) (err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "RemoveWithPrefix", prefix, 1, start)
+	relativePrefix := prefix
+	prefix = path.Join(kv.rootPath, prefix)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var logging_error error
+	defer logWarnOnFailure(&logging_error, "txnTiKV RemoveWithPrefix() error", zap.String("prefix", prefix))
+
+	if err := kv.checkWritable(); err != nil {
+		logging_error = err
+		return logging_error
+	}
+
+	startKey := []byte(prefix)
+	endKey := prefixEnd(startKey)
+	removed, byRange := 0, false
+	remove := func() (err error) {
+		txn, err := startTxn(client)
+		if err != nil {
+			return errors.Wrap(err, "Failed to create txn for RemoveWithPrefix")
+		}
+
+		// Defer a rollback only if the transaction hasn't been committed
+		defer rollbackOnFailure(&err, txn)
+
+		iter, err := txn.Iter(startKey, endKey)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Failed to create iterater for RemoveWithPrefix() for prefix: %s", prefix))
+		}
+		var keys [][]byte
+		for iter.Valid() {
+			keys = append(keys, append([]byte{}, iter.Key()...))
+			if kv.rangeDeleteThreshold > 0 && len(keys) >= kv.rangeDeleteThreshold {
+				iter.Close()
+				byRange = true
+				return txn.Rollback()
+			}
+			if err = iter.Next(); err != nil {
+				iter.Close()
+				return errors.Wrap(err, fmt.Sprintf("Failed to iterate for RemoveWithPrefix() for prefix: %s", prefix))
+			}
+		}
+		iter.Close()
+		if len(keys) == 0 {
+			return txn.Rollback()
+		}
+		if err = checkTxnOps(len(keys)); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = txn.Delete(key); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("Failed to delete %s for RemoveWithPrefix", string(key)))
+			}
+		}
+		if err = kv.executeTxn(txn, ctx); err != nil {
+			return errors.Wrap(err, "Failed to commit for RemoveWithPrefix")
+		}
+		removed = len(keys)
+		return nil
+	}
+	if logging_error = kv.retryOnConflict(ctx, remove); logging_error != nil {
+		return logging_error
+	}
+	if byRange {
+		if logging_error = kv.removeRange(ctx, client, prefix); logging_error != nil {
+			return logging_error
+		}
+	}
+	kv.checkSlowOp(start, "RemoveWithPrefix", removed, 0, zap.String("prefix", prefix), zap.Bool("byRange", byRange))
+	kv.hooks.NotifyRemoveWithPrefix(relativePrefix)
+	return nil
+}
+
+// removeRange removes the keys with prefix, a full key, and their versions by the DeleteRange of
+// [prefix, prefixEnd(prefix)), so it takes about the same time however many keys there are, and it's
+// not bound by the transaction limits. DeleteRange is not a transaction: it's not isolated from the
+// concurrent writes of the prefix, a failure may leave the prefix partly removed, and it drops the
+// old versions of the keys as well, so even the snapshots taken before it, e.g. of a ReadView, no
+// longer see the keys.
+func (kv *txnTiKV) removeRange(ctx context.Context, client *txnkv.Client, prefix string) error {
+	startKey := []byte(prefix)
+	if _, err := client.DeleteRange(ctx, startKey, prefixEnd(startKey), 1); err != nil {
+		return errors.Wrap(err, "Failed to DeleteRange for RemoveWithPrefix")
+	}
+	// the removed keys are back to version 0
+	if len(kv.versionedPrefixes) > 0 {
+		startKey = versionKey(prefix)
+		if _, err := client.DeleteRange(ctx, startKey, prefixEnd(startKey), 1); err != nil {
+			return errors.Wrap(err, "Failed to DeleteRange versions for RemoveWithPrefix")
+		}
+	}
+	return nil
+}
+
+// checkTxnPredicates reads the keys of preds in txn and checks preds on their values. A missing key
+// fails PredTypeIn predicates like a value out of the set, the error reports the actual value. The
+// PredTargetKey predicates are checked on the presence of the keys: a key saved with an empty value
+// exists, an expired one doesn't.
+func (kv *txnTiKV) checkTxnPredicates(ctx context.Context, txn *transaction.KVTxn, op string, preds ...predicates.Predicate) error {
+	for _, pred := range preds {
+		key := path.Join(kv.rootPath, pred.Key())
+		val, err := txn.Get(ctx, []byte(key))
+		if pred.Target() == predicates.PredTargetKey {
+			if err != nil && !tikverr.IsErrNotFound(err) {
+				return errors.Wrap(err, fmt.Sprintf("failed to read predicate target %s for %s", pred.Key(), op))
+			}
+			exists := err == nil && !isExpired(val)
+			if !pred.IsTrue(exists) {
+				return merr.WrapErrIoFailedReason("failed to meet predicate", fmt.Sprintf("key=%s, expected exists=%v, actual exists=%t", pred.Key(), pred.TargetValue(), exists))
+			}
+			continue
+		}
+		if pred.Type() == predicates.PredTypeIn {
+			if err != nil && !tikverr.IsErrNotFound(err) {
+				return errors.Wrap(err, fmt.Sprintf("failed to read predicate target (%s:%v) for %s", pred.Key(), pred.TargetValue(), op))
+			}
+			actual := "<missing>"
+			var value []byte
+			if err == nil {
+				if value, err = decodeValue(val); err != nil {
+					return errors.Wrap(err, fmt.Sprintf("failed to decode predicate target %s for %s", pred.Key(), op))
+				}
+				actual = redactValue(pred.Key(), string(value))
+			}
+			if err != nil || !pred.IsTrue(value) {
+				return merr.WrapErrIoFailedReason("failed to meet predicate", fmt.Sprintf("key=%s, candidates=%v, actual=%s", pred.Key(), pred.TargetValue(), actual))
+			}
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to read predicate target (%s:%s) for %s", pred.Key(), redactValue(pred.Key(), fmt.Sprint(pred.TargetValue())), op))
+		}
+		value, err := decodeValue(val)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to decode predicate target %s for %s", pred.Key(), op))
+		}
+		if !pred.IsTrue(value) {
+			return merr.WrapErrIoFailedReason("failed to meet predicate", fmt.Sprintf("key=%s, value=%s", pred.Key(), redactValue(pred.Key(), fmt.Sprint(pred.TargetValue()))))
+		}
+	}
+	return nil
+}
+
+// MultiSaveAndRemove saves the key-value pairs and removes the keys in a transaction.
+func (kv *txnTiKV) MultiSaveAndRemove(saves map[string]string, removals []string, preds ...predicates.Predicate) (err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "MultiSaveAndRemove", "", len(saves)+len(removals), start)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV MultiSaveAndRemove error", valuesField("saves", saves), zap.Strings("removes", removals), zap.Int("saveLength", len(saves)), zap.Int("removeLength", len(removals)))
+
+	if loggingErr = checkTxnOps(len(saves) + len(removals)); loggingErr != nil {
+		return loggingErr
+	}
+
+	encoded, err := kv.encodeSaves("MultiSaveAndRemove", saves)
+	if err != nil {
+		loggingErr = err
+		return loggingErr
+	}
+	if loggingErr = kv.saveAndRemove(ctx, client, "MultiSaveAndRemove", encoded, removals, preds...); loggingErr != nil {
+		return loggingErr
+	}
+	kv.checkSlowOp(start, "MultiSaveAndRemove", len(saves)+len(removals), mapValuesSize(saves), valuesField("saves", saves), zap.Strings("removals", removals))
+	kv.hooks.NotifySave(saves)
+	kv.hooks.NotifyRemove(removals...)
+	return nil
+}
+
+// encodeSaves returns the stored values of saves for op, keyed by the full keys.
+func (kv *txnTiKV) encodeSaves(op string, saves map[string]string) (map[string][]byte, error) {
+	encoded := make(map[string][]byte, len(saves))
+	for key, value := range saves {
+		key = path.Join(kv.rootPath, key)
+		// Check if value is empty or taking reserved EmptyValue
+		byte_value, err := convertEmptyStringToByte(value)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Failed to cast to byte (%s:%s) for %s", key, redactValue(key, value), op))
+		}
+		encoded[key] = kv.compressValue(byte_value)
+	}
+	return encoded, nil
+}
+
+// saveAndRemove sets the stored values of saves, keyed by the full keys, and removes the keys of
+// removals, relative to the root path, in a transaction for op if preds hold. The transaction is
+// retried on conflicts, and the predicates are checked again by each retry.
+func (kv *txnTiKV) saveAndRemove(ctx context.Context, client *txnkv.Client, op string, saves map[string][]byte, removals []string, preds ...predicates.Predicate) error {
+	return kv.readSaveAndRemove(ctx, client, op, nil, saves, removals, preds...)
+}
+
+// readSaveAndRemove is saveAndRemove calling read with the transaction before the writes, if not nil,
+// by each retry. The keys read are checked for conflicts by the commit.
+func (kv *txnTiKV) readSaveAndRemove(ctx context.Context, client *txnkv.Client, op string, read func(txn *transaction.KVTxn) error, saves map[string][]byte, removals []string, preds ...predicates.Predicate) error {
+	for key, value := range saves {
+		if err := checkValueSize(key, len(value)); err != nil {
+			return err
+		}
+	}
+	attempt := func() (err error) {
+		txn, err := startTxn(client)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Failed to create txn for %s", op))
+		}
+
+		// Defer a rollback only if the transaction hasn't been committed
+		defer rollbackOnFailure(&err, txn)
+
+		if err := kv.checkTxnPredicates(ctx, txn, op, preds...); err != nil {
+			return err
+		}
+		if read != nil {
+			if err := read(txn); err != nil {
+				return err
+			}
+		}
+
+		for key, byte_value := range saves {
+			observeValueSize(key, len(byte_value), largeValueOpSave)
+			if err = txn.Set([]byte(key), byte_value); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("Failed to set %s for %s", key, op))
+			}
+		}
+
+		for _, key := range removals {
+			key = path.Join(kv.rootPath, key)
+			if err = txn.Delete([]byte(key)); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("Failed to delete %s for %s", key, op))
+			}
+		}
+
+		if err = kv.executeTxn(txn, ctx); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Failed to commit for %s", op))
+		}
+		return nil
+	}
+	return kv.retryOnConflict(ctx, attempt)
+}
+
+// MultiSaveAndRemoveWithPrevValues is MultiSaveAndRemove which also returns the values of the removed keys
+// before the transaction, the keys not existing or expired are omitted. The values are read from the snapshot of the
+// transaction in batches of MultiLoadBatchSize, and read again if the commit conflicts with a change of any.
+func (kv *txnTiKV) MultiSaveAndRemoveWithPrevValues(saves map[string]string, removals []string, preds ...predicates.Predicate) (_ map[string]string, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "MultiSaveAndRemoveWithPrevValues", "", len(saves)+len(removals), start)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV MultiSaveAndRemoveWithPrevValues error", valuesField("saves", saves), zap.Strings("removes", removals), zap.Int("saveLength", len(saves)), zap.Int("removeLength", len(removals)))
+
+	if loggingErr = checkTxnOps(len(saves) + len(removals)); loggingErr != nil {
+		return nil, loggingErr
+	}
+
+	encoded, err := kv.encodeSaves("MultiSaveAndRemoveWithPrevValues", saves)
+	if err != nil {
+		loggingErr = err
+		return nil, loggingErr
+	}
+	var prevValues map[string]string
+	readPrevValues := func(txn *transaction.KVTxn) error {
+		prevValues = make(map[string]string, len(removals))
+		for begin := 0; begin < len(removals); begin += MultiLoadBatchSize {
+			end := begin + MultiLoadBatchSize
+			if end > len(removals) {
+				end = len(removals)
+			}
+			byteKeys := make([][]byte, 0, end-begin)
+			for _, key := range removals[begin:end] {
+				byteKeys = append(byteKeys, []byte(path.Join(kv.rootPath, key)))
+			}
+			keyMap, err := txn.BatchGet(ctx, byteKeys)
+			if err != nil {
+				return errors.Wrap(err, "Failed to read removals for MultiSaveAndRemoveWithPrevValues")
+			}
+			for i, key := range removals[begin:end] {
+				if value, ok := keyMap[string(byteKeys[i])]; ok && !isExpired(value) {
+					if prevValues[key], err = convertEmptyByteToString(value); err != nil {
+						return errors.Wrap(err, fmt.Sprintf("Failed to decode removal %s for MultiSaveAndRemoveWithPrevValues", key))
+					}
+				}
+			}
+		}
+		return nil
+	}
+	if loggingErr = kv.readSaveAndRemove(ctx, client, "MultiSaveAndRemoveWithPrevValues", readPrevValues, encoded, removals, preds...); loggingErr != nil {
+		return nil, loggingErr
+	}
+	kv.checkSlowOp(start, "MultiSaveAndRemoveWithPrevValues", len(saves)+len(removals), mapValuesSize(saves), valuesField("saves", saves), zap.Strings("removals", removals))
+	kv.hooks.NotifySave(saves)
+	kv.hooks.NotifyRemove(removals...)
+	return prevValues, nil
+}
+
+// MultiSaveAndRemoveWithPrefix saves kv in @saves and removes the keys with given prefix in @removals.
+func (kv *txnTiKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals []string, preds ...predicates.Predicate) (err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "MultiSaveAndRemoveWithPrefix", "", len(saves)+len(removals), start)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV MultiSaveAndRemoveWithPrefix() error", valuesField("saves", saves), zap.Strings("removes", removals), zap.Int("saveLength", len(saves)), zap.Int("removeLength", len(removals)))
+
+	encoded, err := kv.encodeSaves("MultiSaveAndRemoveWithPrefix", saves)
+	if err != nil {
+		loggingErr = err
+		return loggingErr
+	}
+	for key, value := range encoded {
+		if loggingErr = checkValueSize(key, len(value)); loggingErr != nil {
+			return loggingErr
+		}
+	}
+
+	// the predicates are checked and the prefixes are scanned again by each retry
+	saveAndRemove := func() (err error) {
+		txn, err := startTxn(client)
+		if err != nil {
+			return errors.Wrap(err, "Failed to create txn for MultiSaveAndRemoveWithPrefix")
+		}
+
+		// Defer a rollback only if the transaction hasn't been committed
+		defer rollbackOnFailure(&err, txn)
+
+		if err := kv.checkTxnPredicates(ctx, txn, "MultiSaveAndRemove", preds...); err != nil {
+			return err
+		}
+
+		// Save key-value pairs
+		for key, byte_value := range encoded {
+			observeValueSize(key, len(byte_value), largeValueOpSave)
+			if err = txn.Set([]byte(key), byte_value); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("Failed to set %s for MultiSaveAndRemoveWithPrefix()", key))
+			}
+		}
+		// Remove keys with prefix
+		for _, prefix := range removals {
+			prefix = path.Join(kv.rootPath, prefix)
+			// Get the start and end keys for the prefix range
+			startKey := []byte(prefix)
+			endKey := tikv.PrefixNextKey([]byte(prefix))
+
+			// Use Scan to iterate over keys in the prefix range
+			iter, err := txn.Iter(startKey, endKey)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("Failed to create iterater for %s during MultiSaveAndRemoveWithPrefix()", prefix))
+			}
+
+			// Iterate over keys and delete them
+			for iter.Valid() {
+				key := iter.Key()
+				err = txn.Delete(key)
+				if err != nil {
+					iter.Close()
+					return errors.Wrap(err, fmt.Sprintf("Failed to delete %s for MultiSaveAndRemoveWithPrefix", string(key)))
+				}
+
+				// Move the iterator to the next key
+				err = iter.Next()
+				if err != nil {
+					iter.Close()
+					return errors.Wrap(err, fmt.Sprintf("Failed to move Iterator after key %s for MultiSaveAndRemoveWithPrefix", string(key)))
+				}
+			}
+			iter.Close()
+		}
+		if err = kv.executeTxn(txn, ctx); err != nil {
+			return errors.Wrap(err, "Failed to commit for MultiSaveAndRemoveWithPrefix")
+		}
+		return nil
+	}
+	if loggingErr = kv.retryOnConflict(ctx, saveAndRemove); loggingErr != nil {
+		return loggingErr
+	}
+	kv.checkSlowOp(start, "MultiSaveAndRemoveWithPrefix", len(saves)+len(removals), mapValuesSize(saves), valuesField("saves", saves), zap.Strings("removals", removals))
+	kv.hooks.NotifySave(saves)
+	for _, prefix := range removals {
+		kv.hooks.NotifyRemoveWithPrefix(prefix)
+	}
+	return nil
+}
+
+// MultiRemoveIfValue removes, in one transaction, each key whose current value equals the expected one.
+// Keys that are missing or hold a different value are left untouched and reported as skipped.
+func (kv *txnTiKV) MultiRemoveIfValue(expected map[string]string) (_ []string, _ []string, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "MultiRemoveIfValue", "", len(expected), start)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV MultiRemoveIfValue() error", zap.Strings("keys", keys), zap.Int("len", len(expected)))
+
+	txn, err := startTxn(client)
+	if err != nil {
+		loggingErr = errors.Wrap(err, "Failed to create txn for MultiRemoveIfValue")
+		return nil, nil, loggingErr
+	}
+
+	// Defer a rollback only if the transaction hasn't been committed
+	defer rollbackOnFailure(&loggingErr, txn)
+
+	removed := make([]string, 0, len(keys))
+	skipped := make([]string, 0)
+	for _, key := range keys {
+		fullKey := path.Join(kv.rootPath, key)
+		val, err := txn.Get(ctx, []byte(fullKey))
+		if err != nil {
+			if tikverr.IsErrNotFound(err) {
+				skipped = append(skipped, key)
+				continue
+			}
+			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to read %s for MultiRemoveIfValue", fullKey))
+			return nil, nil, loggingErr
+		}
+		value, err := convertEmptyByteToString(val)
+		if err != nil {
+			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to decode %s for MultiRemoveIfValue", fullKey))
+			return nil, nil, loggingErr
+		}
+		if value != expected[key] {
+			skipped = append(skipped, key)
+			continue
+		}
+		if err = txn.Delete([]byte(fullKey)); err != nil {
+			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to delete %s for MultiRemoveIfValue", fullKey))
+			return nil, nil, loggingErr
+		}
+		removed = append(removed, key)
+	}
+
+	err = kv.executeTxn(txn, ctx)
+	if err != nil {
+		loggingErr = errors.Wrap(err, "Failed to commit for MultiRemoveIfValue()")
+		return nil, nil, loggingErr
+	}
+	kv.checkSlowOp(start, "MultiRemoveIfValue", len(removed), 0, zap.Strings("removed", removed), zap.Strings("skipped", skipped))
+	kv.hooks.NotifyRemove(removed...)
+	return removed, skipped, nil
+}
+
+// CompareValueAndSwap saves target at key if the current value of key is expected, returning false
+// without error if it's not. A missing key matches expected "", so callers could create key if absent,
+// e.g. to take a lock, so does an expired one, see SaveWithTTL. The empty values, including the legacy
+// ones stored as EmptyValueString, equal "" too. Concurrent swaps conflict on key, the losers are
+// retried, see WithConflictRetry, and fail the comparison then, so only one of the swaps of a value
+// wins, the others fail with ErrConflictRetriesExhausted if they run out of the retries.
+func (kv *txnTiKV) CompareValueAndSwap(key, expected, target string) (_ bool, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "CompareValueAndSwap", key, 1, start)
+	fullKey := path.Join(kv.rootPath, key)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV CompareValueAndSwap() error", zap.String("key", fullKey),
+		namedValueField("expected", fullKey, expected), namedValueField("target", fullKey, target))
+
+	byteValue, err := convertEmptyStringToByte(target)
+	if err != nil {
+		loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to cast to byte (%s:%s) for CompareValueAndSwap", fullKey, redactValue(fullKey, target)))
+		return false, loggingErr
+	}
+
+	swapped := false
+	swap := func() error {
+		txn, err := startTxn(client)
+		if err != nil {
+			return errors.Wrap(err, "Failed to create txn for CompareValueAndSwap")
+		}
+
+		// Rollback whenever this attempt is not committed
+		var attemptErr error
+		defer rollbackOnFailure(&attemptErr, txn)
+
+		val, err := txn.Get(ctx, []byte(fullKey))
+		if err != nil && !tikverr.IsErrNotFound(err) {
+			attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to read %s for CompareValueAndSwap", fullKey))
+			return attemptErr
+		}
+		// a missing or expired key reads as ""
+		if isExpired(val) {
+			val = nil
+		}
+		current, err := convertEmptyByteToString(val)
+		if err != nil {
+			attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to decode %s for CompareValueAndSwap", fullKey))
+			return attemptErr
+		}
+		if current != expected {
+			swapped = false
+			return txn.Rollback()
+		}
+		if err = txn.Set([]byte(fullKey), byteValue); err != nil {
+			attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to set (%s:%s) for CompareValueAndSwap", fullKey, redactValue(fullKey, target)))
+			return attemptErr
+		}
+		if err = kv.executeTxn(txn, ctx); err != nil {
+			attemptErr = errors.Wrap(err, "Failed to commit for CompareValueAndSwap")
+			return attemptErr
+		}
+		swapped = true
+		return nil
+	}
+
+	err = kv.retryOnConflict(ctx, swap)
+	if err != nil {
+		loggingErr = err
+		return false, loggingErr
+	}
+	kv.checkSlowOp(start, "CompareValueAndSwap", 1, len(target), zap.String("key", fullKey), zap.Bool("swapped", swapped))
+	if swapped {
+		kv.hooks.NotifySave(map[string]string{key: target})
+	}
+	return swapped, nil
+}
+
+// SaveWithVersionBump increments the integer stored at versionKey and writes saves in one transaction,
+// returning the new version. A missing versionKey counts as version 0. Concurrent bumps conflict on
+// versionKey, the losers are retried like the other conflicted writes, see WithConflictRetry.
+func (kv *txnTiKV) SaveWithVersionBump(versionKey string, saves map[string]string) (_ int64, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "SaveWithVersionBump", "", len(saves)+1, start)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV SaveWithVersionBump() error", zap.String("versionKey", versionKey), zap.Int("len", len(saves)))
+
+	if _, ok := saves[versionKey]; ok {
+		loggingErr = merr.WrapErrParameterInvalidMsg("version key %s should not be saved explicitly", versionKey)
+		return 0, loggingErr
+	}
+
+	encoded, err := kv.encodeSaves("SaveWithVersionBump", saves)
+	if err != nil {
+		loggingErr = err
+		return 0, loggingErr
+	}
+	for key, value := range encoded {
+		if loggingErr = checkValueSize(key, len(value)); loggingErr != nil {
+			return 0, loggingErr
+		}
+	}
+
+	fullVersionKey := path.Join(kv.rootPath, versionKey)
+	var version int64
+	bump := func() error {
+		txn, err := startTxn(client)
+		if err != nil {
+			return errors.Wrap(err, "Failed to create txn for SaveWithVersionBump")
+		}
+
+		// Rollback whenever this attempt is not committed
+		var attemptErr error
+		defer rollbackOnFailure(&attemptErr, txn)
+
+		val, err := txn.Get(ctx, []byte(fullVersionKey))
+		current := int64(0)
+		if err == nil {
+			var value string
+			if value, err = convertEmptyByteToString(val); err == nil {
+				current, err = strconv.ParseInt(value, 10, 64)
+			}
+			if err != nil {
+				attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to parse version %s for SaveWithVersionBump", fullVersionKey))
+				return attemptErr
+			}
+		} else if !tikverr.IsErrNotFound(err) {
+			attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to read version %s for SaveWithVersionBump", fullVersionKey))
+			return attemptErr
+		}
+
+		versionValue, _ := convertEmptyStringToByte(strconv.FormatInt(current+1, 10))
+		if err = txn.Set([]byte(fullVersionKey), versionValue); err != nil {
+			attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to set version %s for SaveWithVersionBump", fullVersionKey))
+			return attemptErr
+		}
+		for key, byteValue := range encoded {
+			observeValueSize(key, len(byteValue), largeValueOpSave)
+			if err = txn.Set([]byte(key), byteValue); err != nil {
+				attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to set %s for SaveWithVersionBump", key))
+				return attemptErr
+			}
+		}
+
+		if err = kv.executeTxn(txn, ctx); err != nil {
+			attemptErr = errors.Wrap(err, "Failed to commit for SaveWithVersionBump")
+			return attemptErr
+		}
+		version = current + 1
+		return nil
+	}
+
+	if loggingErr = kv.retryOnConflict(ctx, bump); loggingErr != nil {
+		return 0, loggingErr
+	}
+	kv.checkSlowOp(start, "SaveWithVersionBump", 2, 0, zap.String("versionKey", versionKey), zap.Int64("version", version))
+	writes := make(map[string]string, len(saves)+1)
+	for key, value := range saves {
+		writes[key] = value
+	}
+	writes[versionKey] = strconv.FormatInt(version, 10)
+	kv.hooks.NotifySave(writes)
+	return version, nil
 }
 
-// MultiRemove removes the input keys in transaction manner.
-func (kv *txnTiKV) MultiRemove(keys []string) error {
+// AppendToList appends element to the newline-separated list stored at key, unless it's already
+// in the list. A missing key is an empty list. If maxLen is positive and the list already has maxLen
+// elements, ErrListFull is returned. The read and the write happen in one transaction, retried on
+// conflict, see WithConflictRetry, so concurrent appends are neither lost nor duplicated. Use DecodeList to read the list.
+func (kv *txnTiKV) AppendToList(key, element string, maxLen int) (err error) {
+	client, release := kv.acquireClient()
+	defer release()
 	start := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer kv.finishOp(&err, "AppendToList", key, 1, start)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
 	defer cancel()
 
-	var logging_error error
-	defer logWarnOnFailure(&logging_error, "txnTiKV MultiRemove() error", zap.Strings("keys", keys), zap.Int("len", len(keys)))
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV AppendToList() error", zap.String("key", key), zap.String("element", element), zap.Int("maxLen", maxLen))
 
-	txn, err := beginTxn(kv.txn)
-	if err != nil {
-		logging_error = errors.Wrap(err, "Failed to create txn for MultiRemove")
-		return logging_error
+	if element == "" || strings.Contains(element, "\n") {
+		loggingErr = merr.WrapErrParameterInvalidMsg("list element should be non-empty and contain no newline, got %q", element)
+		return loggingErr
 	}
 
-	// Defer a rollback only if the transaction hasn't been committed
-	defer rollbackOnFailure(&logging_error, txn)
-
-	for _, key := range keys {
-		key = path.Join(kv.rootPath, key)
-		logging_error = txn.Delete([]byte(key))
+	fullKey := path.Join(kv.rootPath, key)
+	var (
+		value   string
+		written bool
+	)
+	appendElement := func() error {
+		txn, err := startTxn(client)
 		if err != nil {
-			logging_error = errors.Wrap(err, fmt.Sprintf("Failed to delete %s for MultiRemove", key))
-			return logging_error
+			return errors.Wrap(err, "Failed to create txn for AppendToList")
+		}
+
+		// Rollback whenever this attempt is not committed
+		var attemptErr error
+		defer rollbackOnFailure(&attemptErr, txn)
+
+		val, err := txn.Get(ctx, []byte(fullKey))
+		var elements []string
+		if err == nil {
+			var value string
+			if value, err = convertEmptyByteToString(val); err != nil {
+				attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to decode list %s for AppendToList", fullKey))
+				return attemptErr
+			}
+			elements = DecodeList(value)
+		} else if !tikverr.IsErrNotFound(err) {
+			attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to read list %s for AppendToList", fullKey))
+			return attemptErr
+		}
+		for _, e := range elements {
+			if e == element {
+				written = false
+				return nil
+			}
+		}
+		if maxLen > 0 && len(elements) >= maxLen {
+			attemptErr = errors.Wrapf(ErrListFull, "list %s has %d elements", key, len(elements))
+			return attemptErr
+		}
+
+		value = strings.Join(append(elements, element), "\n")
+		byteValue, _ := convertEmptyStringToByte(value)
+		if err = txn.Set([]byte(fullKey), byteValue); err != nil {
+			attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to set list %s for AppendToList", fullKey))
+			return attemptErr
+		}
+		if err = kv.executeTxn(txn, ctx); err != nil {
+			attemptErr = errors.Wrap(err, "Failed to commit for AppendToList")
+			return attemptErr
 		}
+		written = true
+		return nil
 	}
 
-	err = kv.executeTxn(txn, ctx)
+	err = kv.retryOnConflict(ctx, appendElement)
 	if err != nil {
-		logging_error = errors.Wrap(err, "Failed to commit for MultiRemove()")
-		return logging_error
+		loggingErr = err
+		return loggingErr
+	}
+	kv.checkSlowOp(start, "AppendToList", 1, len(element), zap.String("key", key), zap.String("element", element))
+	if written {
+		kv.hooks.NotifySave(map[string]string{key: value})
 	}
-	CheckElapseAndWarn(start, "Slow txnTiKV MultiRemove() operation", zap.Strings("keys", keys))
 	return nil
 }
 
-// RemoveWithPrefix removes the keys for the given prefix.
-func (kv *txnTiKV) RemoveWithPrefix(prefix string) error {
-	start := time.Now()
-	prefix = path.Join(kv.rootPath, prefix)
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
-	defer cancel()
-
-	var logging_error error
-	defer logWarnOnFailure(&logging_error, "txnTiKV RemoveWithPrefix() error", zap.String("prefix", prefix))
-
-	startKey := []byte(prefix)
-	endKey := tikv.PrefixNextKey(startKey)
-	_, err := kv.txn.DeleteRange(ctx, startKey, endKey, 1)
-	if err != nil {
-		logging_error = errors.Wrap(err, "Failed to DeleteRange for RemoveWithPrefix")
-		return logging_error
+// DecodeList returns the elements of a list value written by AppendToList.
+func DecodeList(value string) []string {
+	if value == "" {
+		return nil
 	}
-	CheckElapseAndWarn(start, "Slow txnTiKV RemoveWithPrefix() operation", zap.String("prefix", prefix))
-	return nil
+	return strings.Split(value, "\n")
 }
 
-// MultiSaveAndRemove saves the key-value pairs and removes the keys in a transaction.
-func (kv *txnTiKV) MultiSaveAndRemove(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
+// FindOrphans lists the reference keys under refPrefix and returns those whose target is absent.
+// extractTargetID maps a reference key to the id of its target, which is stored at targetPrefix/id;
+// keys mapped to an empty id are not references and are ignored. Keys passed to extractTargetID and
+// returned are relative to the root path. Targets are checked in batches of the scan size of the instance, see WithScanSize.
+func (kv *txnTiKV) FindOrphans(refPrefix, targetPrefix string, extractTargetID func(key string) string) (_ []string, err error) {
+	client, release := kv.acquireClient()
+	defer release()
 	start := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer kv.finishOp(&err, "FindOrphans", refPrefix, 2, start)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
 	defer cancel()
 
 	var loggingErr error
-	defer logWarnOnFailure(&loggingErr, "txnTiKV MultiSaveAndRemove error", zap.Any("saves", saves), zap.Strings("removes", removals), zap.Int("saveLength", len(saves)), zap.Int("removeLength", len(removals)))
+	defer logWarnOnFailure(&loggingErr, "txnTiKV FindOrphans() error", zap.String("refPrefix", refPrefix), zap.String("targetPrefix", targetPrefix))
 
-	txn, err := beginTxn(kv.txn)
+	// Since only reading, use Snapshot for less overhead
+	ss := getSnapshot(client, kv.snapshotScanSize(), tikv.ReplicaReadLeader)
+	ss.SetKeyOnly(true)
+
+	fullRefPrefix := path.Join(kv.rootPath, refPrefix)
+	iter, err := ss.Iter([]byte(fullRefPrefix), tikv.PrefixNextKey([]byte(fullRefPrefix)))
 	if err != nil {
-		loggingErr = errors.Wrap(err, "Failed to create txn for MultiSaveAndRemove")
-		return loggingErr
+		loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to create iterator for %s during FindOrphans", fullRefPrefix))
+		return nil, loggingErr
 	}
+	defer iter.Close()
 
-	// Defer a rollback only if the transaction hasn't been committed
-	defer rollbackOnFailure(&loggingErr, txn)
-
-	for _, pred := range preds {
-		key := path.Join(kv.rootPath, pred.Key())
-		val, err := txn.Get(ctx, []byte(key))
+	orphans := make([]string, 0)
+	scanSize := kv.snapshotScanSize()
+	refs := make([]string, 0, scanSize)
+	targets := make([][]byte, 0, scanSize)
+	checkTargets := func() error {
+		if len(targets) == 0 {
+			return nil
+		}
+		existing, err := ss.BatchGet(ctx, targets)
 		if err != nil {
-			loggingErr = errors.Wrap(err, fmt.Sprintf("failed to read predicate target (%s:%v) for MultiSaveAndRemove", pred.Key(), pred.TargetValue()))
-			return loggingErr
+			return errors.Wrap(err, "Failed to check targets for FindOrphans")
 		}
-		if !pred.IsTrue(val) {
-			loggingErr = merr.WrapErrIoFailedReason("failed to meet predicate", fmt.Sprintf("key=%s, value=%v", pred.Key(), pred.TargetValue()))
-			return loggingErr
+		for i, target := range targets {
+			if _, ok := existing[string(target)]; !ok {
+				orphans = append(orphans, refs[i])
+			}
 		}
+		refs = refs[:0]
+		targets = targets[:0]
+		return nil
 	}
 
-	for key, value := range saves {
-		key = path.Join(kv.rootPath, key)
-		// Check if value is empty or taking reserved EmptyValue
-		byte_value, err := convertEmptyStringToByte(value)
-		if err != nil {
-			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to cast to byte (%s:%s) for MultiSaveAndRemove", key, value))
-			return loggingErr
+	for iter.Valid() {
+		ref := kv.relativeKey(string(iter.Key()))
+		if id := extractTargetID(ref); id != "" {
+			refs = append(refs, ref)
+			targets = append(targets, []byte(path.Join(kv.rootPath, targetPrefix, id)))
 		}
-		err = txn.Set([]byte(key), byte_value)
-		if err != nil {
-			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to set (%s:%s) for MultiSaveAndRemove", key, value))
-			return loggingErr
+		if len(targets) >= scanSize {
+			if loggingErr = checkTargets(); loggingErr != nil {
+				return nil, loggingErr
+			}
 		}
-	}
-
-	for _, key := range removals {
-		key = path.Join(kv.rootPath, key)
-		if err = txn.Delete([]byte(key)); err != nil {
-			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to delete %s for MultiSaveAndRemove", key))
-			return loggingErr
+		if err = iter.Next(); err != nil {
+			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to move Iterator after key %s for FindOrphans", string(iter.Key())))
+			return nil, loggingErr
 		}
 	}
-
-	err = kv.executeTxn(txn, ctx)
-	if err != nil {
-		loggingErr = errors.Wrap(err, "Failed to commit for MultiSaveAndRemove")
-		return loggingErr
+	if loggingErr = checkTargets(); loggingErr != nil {
+		return nil, loggingErr
 	}
-	CheckElapseAndWarn(start, "Slow txnTiKV MultiSaveAndRemove() operation", zap.Any("saves", saves), zap.Strings("removals", removals))
-	return nil
+	kv.checkSlowOp(start, "FindOrphans", len(orphans), 0, zap.String("refPrefix", refPrefix), zap.Int("orphans", len(orphans)))
+	return orphans, nil
 }
 
-// MultiSaveAndRemoveWithPrefix saves kv in @saves and removes the keys with given prefix in @removals.
-func (kv *txnTiKV) MultiSaveAndRemoveWithPrefix(saves map[string]string, removals []string, preds ...predicates.Predicate) error {
+// ScanLegacyValues returns the keys with given prefix whose values are stored in the legacy encoding,
+// i.e. without ValueHeader, including the empty values stored as EmptyValueString.
+// Returned keys are relative to the root path.
+func (kv *txnTiKV) ScanLegacyValues(prefix string) (_ []string, err error) {
 	start := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
-	defer cancel()
+	defer kv.finishOp(&err, "ScanLegacyValues", prefix, 1, start)
 
 	var loggingErr error
-	defer logWarnOnFailure(&loggingErr, "txnTiKV MultiSaveAndRemoveWithPrefix() error", zap.Any("saves", saves), zap.Strings("removes", removals), zap.Int("saveLength", len(saves)), zap.Int("removeLength", len(removals)))
+	defer logWarnOnFailure(&loggingErr, "txnTiKV ScanLegacyValues() error", zap.String("prefix", prefix))
 
-	txn, err := beginTxn(kv.txn)
+	fullPrefix := []byte(path.Join(kv.rootPath, prefix))
+	keys := make([]string, 0)
+	err = kv.scanLegacyValues(fullPrefix, tikv.PrefixNextKey(fullPrefix), -1, func(key, value []byte) {
+		keys = append(keys, kv.relativeKey(string(key)))
+	})
 	if err != nil {
-		loggingErr = errors.Wrap(err, "Failed to create txn for MultiSaveAndRemoveWithPrefix")
-		return loggingErr
+		loggingErr = errors.Wrap(err, "Failed to scan for ScanLegacyValues")
+		return nil, loggingErr
 	}
+	kv.checkSlowOp(start, "ScanLegacyValues", len(keys), 0, zap.String("prefix", prefix), zap.Int("legacy", len(keys)))
+	return keys, nil
+}
 
-	// Defer a rollback only if the transaction hasn't been committed
-	defer rollbackOnFailure(&loggingErr, txn)
+type legacyValue struct {
+	key   []byte
+	value []byte
+}
 
-	for _, pred := range preds {
-		key := path.Join(kv.rootPath, pred.Key())
-		val, err := txn.Get(ctx, []byte(key))
+// MigrateLegacyValues rewrites the legacy values with given prefix into the current encoding, batchSize
+// values per transaction. Each rewrite is guarded by a predicate on the scanned legacy value, keys updated
+// or removed concurrently are left untouched and returned as skipped, so it's safe to run against a live
+// cluster. Values are not changed logically, so write hooks are not notified. It fails unless
+// WriteValueHeader is enabled, as the nodes of the versions before ValueHeader may still read the values.
+// Returned keys are relative to the root path.
+func (kv *txnTiKV) MigrateLegacyValues(prefix string, batchSize int) (_ []string, _ []string, err error) {
+	start := time.Now()
+	defer kv.finishOp(&err, "MigrateLegacyValues", prefix, 1, start)
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV MigrateLegacyValues() error", zap.String("prefix", prefix), zap.Int("batchSize", batchSize))
+
+	if batchSize <= 0 {
+		loggingErr = merr.WrapErrParameterInvalidMsg("batchSize %d should be positive", batchSize)
+		return nil, nil, loggingErr
+	}
+	if !WriteValueHeader {
+		loggingErr = errors.Newf("MigrateLegacyValues needs %s enabled, the values are written in the legacy encoding", Params.TiKVCfg.WriteValueHeader.Key)
+		return nil, nil, loggingErr
+	}
+
+	fullPrefix := []byte(path.Join(kv.rootPath, prefix))
+	endKey := tikv.PrefixNextKey(fullPrefix)
+	cursor := fullPrefix
+	migrated := make([]string, 0)
+	skipped := make([]string, 0)
+	for {
+		batch := make([]legacyValue, 0, batchSize)
+		err := kv.scanLegacyValues(cursor, endKey, batchSize, func(key, value []byte) {
+			batch = append(batch, legacyValue{key: append([]byte{}, key...), value: append([]byte{}, value...)})
+		})
 		if err != nil {
-			loggingErr = errors.Wrap(err, fmt.Sprintf("failed to read predicate target (%s:%v) for MultiSaveAndRemove", pred.Key(), pred.TargetValue()))
-			return loggingErr
+			loggingErr = errors.Wrap(err, "Failed to scan for MigrateLegacyValues")
+			return nil, nil, loggingErr
 		}
-		if !pred.IsTrue(val) {
-			loggingErr = merr.WrapErrIoFailedReason("failed to meet predicate", fmt.Sprintf("key=%s, value=%v", pred.Key(), pred.TargetValue()))
-			return loggingErr
+		if len(batch) == 0 {
+			break
+		}
+		batchMigrated, batchSkipped, err := kv.migrateLegacyValues(batch)
+		if err != nil {
+			loggingErr = err
+			return nil, nil, loggingErr
+		}
+		migrated = append(migrated, batchMigrated...)
+		skipped = append(skipped, batchSkipped...)
+		if len(batch) < batchSize {
+			break
 		}
+		// next batch starts right after the last scanned key
+		cursor = append(batch[len(batch)-1].key, 0)
 	}
+	kv.checkSlowOp(start, "MigrateLegacyValues", len(migrated), 0, zap.String("prefix", prefix), zap.Int("migrated", len(migrated)), zap.Int("skipped", len(skipped)))
+	return migrated, skipped, nil
+}
 
-	// Save key-value pairs
-	for key, value := range saves {
-		key = path.Join(kv.rootPath, key)
-		// Check if value is empty or taking reserved EmptyValue
-		byte_value, err := convertEmptyStringToByte(value)
-		if err != nil {
-			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to cast to byte (%s:%s) for MultiSaveAndRemoveWithPrefix()", key, value))
-			return loggingErr
+// scanLegacyValues applies fn to at most limit legacy values in [startKey, endKey), a negative limit means no limit.
+func (kv *txnTiKV) scanLegacyValues(startKey, endKey []byte, limit int, fn func(key, value []byte)) error {
+	client, release := kv.acquireClient()
+	defer release()
+	// Since only reading, use Snapshot for less overhead
+	ss := getSnapshot(client, kv.snapshotScanSize(), tikv.ReplicaReadLeader)
+	iter, err := ss.Iter(startKey, endKey)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	count := 0
+	for iter.Valid() && (limit < 0 || count < limit) {
+		if isLegacyValue(iter.Value()) {
+			fn(iter.Key(), iter.Value())
+			count++
 		}
-		err = txn.Set([]byte(key), byte_value)
-		if err != nil {
-			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to set (%s:%s) for MultiSaveAndRemoveWithPrefix()", key, value))
-			return loggingErr
+		if err = iter.Next(); err != nil {
+			return err
 		}
 	}
-	// Remove keys with prefix
-	for _, prefix := range removals {
-		prefix = path.Join(kv.rootPath, prefix)
-		// Get the start and end keys for the prefix range
-		startKey := []byte(prefix)
-		endKey := tikv.PrefixNextKey([]byte(prefix))
+	return nil
+}
 
-		// Use Scan to iterate over keys in the prefix range
-		iter, err := txn.Iter(startKey, endKey)
+// migrateLegacyValues rewrites batch in one transaction, which is retried on write conflicts.
+func (kv *txnTiKV) migrateLegacyValues(batch []legacyValue) ([]string, []string, error) {
+	client, release := kv.acquireClient()
+	defer release()
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var migrated, skipped []string
+	migrate := func() error {
+		migrated, skipped = make([]string, 0, len(batch)), make([]string, 0)
+		txn, err := startTxn(client)
 		if err != nil {
-			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to create iterater for %s during MultiSaveAndRemoveWithPrefix()", prefix))
-			return loggingErr
+			return retry.Unrecoverable(errors.Wrap(err, "Failed to create txn for MigrateLegacyValues"))
 		}
 
-		// Iterate over keys and delete them
-		for iter.Valid() {
-			key := iter.Key()
-			err = txn.Delete(key)
-			if loggingErr != nil {
-				loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to delete %s for MultiSaveAndRemoveWithPrefix", string(key)))
-				return loggingErr
-			}
+		// Rollback whenever this attempt is not committed
+		var attemptErr error
+		defer rollbackOnFailure(&attemptErr, txn)
 
-			// Move the iterator to the next key
-			err = iter.Next()
+		for _, legacy := range batch {
+			key := kv.relativeKey(string(legacy.key))
+			val, err := txn.Get(ctx, legacy.key)
+			if err != nil && !tikverr.IsErrNotFound(err) {
+				attemptErr = retry.Unrecoverable(errors.Wrap(err, fmt.Sprintf("Failed to read %s for MigrateLegacyValues", string(legacy.key))))
+				return attemptErr
+			}
+			// the key is skipped if it's updated or removed since scanned
+			if err != nil || !predicates.ValueEqual(key, string(legacy.value)).IsTrue(val) {
+				skipped = append(skipped, key)
+				continue
+			}
+			decoded, err := decodeValue(val)
+			if err != nil {
+				attemptErr = retry.Unrecoverable(errors.Wrap(err, fmt.Sprintf("Failed to decode %s for MigrateLegacyValues", string(legacy.key))))
+				return attemptErr
+			}
+			value, err := convertEmptyStringToByte(string(decoded))
 			if err != nil {
-				loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to move Iterator after key %s for MultiSaveAndRemoveWithPrefix", string(key)))
-				return loggingErr
+				attemptErr = retry.Unrecoverable(errors.Wrap(err, fmt.Sprintf("Failed to encode %s for MigrateLegacyValues", string(legacy.key))))
+				return attemptErr
+			}
+			if err = txn.Set(legacy.key, value); err != nil {
+				attemptErr = retry.Unrecoverable(errors.Wrap(err, fmt.Sprintf("Failed to set %s for MigrateLegacyValues", string(legacy.key))))
+				return attemptErr
+			}
+			migrated = append(migrated, key)
+		}
+
+		if err = kv.executeTxn(txn, ctx); err != nil {
+			attemptErr = errors.Wrap(err, "Failed to commit for MigrateLegacyValues")
+			if !tikverr.IsErrWriteConflict(err) {
+				attemptErr = retry.Unrecoverable(attemptErr)
 			}
+			return attemptErr
 		}
+		return nil
 	}
-	err = kv.executeTxn(txn, ctx)
+
+	err := retry.Do(ctx, migrate, retry.Attempts(10), retry.Sleep(10*time.Millisecond), retry.MaxSleepTime(200*time.Millisecond))
 	if err != nil {
-		loggingErr = errors.Wrap(err, "Failed to commit for MultiSaveAndRemoveWithPrefix")
-		return loggingErr
+		return nil, nil, err
 	}
-	CheckElapseAndWarn(start, "Slow txnTiKV MultiSaveAndRemoveWithPrefix() operation", zap.Any("saves", saves), zap.Strings("removals", removals))
-	return nil
+	return migrated, skipped, nil
+}
+
+// AsyncRemoveWithPrefix removes the keys with given prefix in background, chunk by chunk with low priority.
+// The removal is eventual: keys under prefix stay visible to reads until their chunk is removed, and keys
+// saved under prefix while the job runs may be removed as well. A journal key is saved before the job
+// starts and removed once it is completed or canceled, so an interrupted job can be resumed by
+// ResumeDeletionJobs. The write hooks are notified of the keys of each chunk once it's removed, and
+// of the prefix once the job is completed.
+func (kv *txnTiKV) AsyncRemoveWithPrefix(prefix string) (_ *kv.DeletionJob, err error) {
+	defer kv.finishOp(&err, "AsyncRemoveWithPrefix", prefix, 1, time.Now())
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV AsyncRemoveWithPrefix() error", zap.String("prefix", prefix))
+
+	deleter := newPrefixDeleter(kv, prefix)
+	loggingErr = kv.putTiKVMeta(ctx, path.Join(kv.rootPath, deleter.journalKey()), prefix)
+	if loggingErr != nil {
+		loggingErr = errors.Wrap(loggingErr, "Failed to save journal for AsyncRemoveWithPrefix")
+		return nil, loggingErr
+	}
+	return kv.deletions.Start(prefix, deleter), nil
+}
+
+// ResumeDeletionJobs restarts the prefix deletions left unfinished according to the journal.
+func (kv *txnTiKV) ResumeDeletionJobs() (jobs []*kv.DeletionJob, err error) {
+	defer kv.finishOp(&err, "ResumeDeletionJobs", deletionJournalPrefix, 1, time.Now())
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV ResumeDeletionJobs() error")
+
+	_, prefixes, err := kv.LoadWithPrefix(deletionJournalPrefix)
+	if err != nil {
+		loggingErr = errors.Wrap(err, "Failed to load journal for ResumeDeletionJobs")
+		return nil, loggingErr
+	}
+	for _, prefix := range prefixes {
+		log.Info("txnTiKV resume deletion job", zap.String("rootPath", kv.rootPath), zap.String("prefix", prefix))
+		jobs = append(jobs, kv.deletions.Start(prefix, newPrefixDeleter(kv, prefix)))
+	}
+	return jobs, nil
+}
+
+// WalkWithPrefix visits each kv with input prefix and apply given fn to it, reading batches of
+// paginationSize pairs, the scan size of the instance if not positive, see WithScanSize.
+func (kv *txnTiKV) WalkWithPrefix(prefix string, paginationSize int, fn func([]byte, []byte) error) (err error) {
+	defer kv.finishOp(&err, "WalkWithPrefix", prefix, 1, time.Now())
+	return kv.walkWithPrefix(kv.baseContext(), prefix, paginationSize, fn, kv.replicaRead)
+}
+
+// WalkWithPrefixReverse is WalkWithPrefix visiting the keys in descending order, e.g. to visit the
+// newest of the keys ordered by time first. An empty prefix walks all the keys under the root path.
+func (kv *txnTiKV) WalkWithPrefixReverse(prefix string, paginationSize int, fn func([]byte, []byte) error) (err error) {
+	defer kv.finishOp(&err, "WalkWithPrefixReverse", prefix, 1, time.Now())
+	return kv.walk(kv.baseContext(), prefix, paginationSize, fn, kv.replicaRead, true)
+}
+
+// walkWithPrefix stops before the next key once ctx is done, with the error of ctx.
+func (kv *txnTiKV) walkWithPrefix(ctx context.Context, prefix string, paginationSize int, fn func([]byte, []byte) error, replicaRead tikv.ReplicaReadType) error {
+	return kv.walk(ctx, prefix, paginationSize, fn, replicaRead, false)
+}
+
+// snapshotIterator is the iterator of the snapshot scans, whose type is internal to the client.
+type snapshotIterator interface {
+	Valid() bool
+	Key() []byte
+	Value() []byte
+	Next() error
+	Close()
 }
 
-// WalkWithPrefix visits each kv with input prefix and apply given fn to it.
-func (kv *txnTiKV) WalkWithPrefix(prefix string, paginationSize int, fn func([]byte, []byte) error) error {
+// walk is walkWithPrefix in descending key order if reverse.
+func (kv *txnTiKV) walk(ctx context.Context, prefix string, paginationSize int, fn func([]byte, []byte) error, replicaRead tikv.ReplicaReadType, reverse bool) error {
+	client, release := kv.acquireClient()
+	defer release()
 	start := time.Now()
 	prefix = path.Join(kv.rootPath, prefix)
+	ctx, cancel := withTimeout(ctx, ScanTimeout)
+	defer cancel()
+
+	op := "WalkWithPrefix"
+	if reverse {
+		op = "WalkWithPrefixReverse"
+	}
 
 	var logging_error error
-	defer logWarnOnFailure(&logging_error, "txnTiKV WalkWithPagination error", zap.String("prefix", prefix))
+	defer logWarnOnFailure(&logging_error, "txnTiKV WalkWithPagination error", zap.String("prefix", prefix), zap.Bool("reverse", reverse))
 
+	if paginationSize <= 0 {
+		paginationSize = kv.snapshotScanSize()
+	}
 	// Since only reading, use Snapshot for less overhead
-	ss := getSnapshot(kv.txn, paginationSize)
+	ss := kv.snapshot(client, paginationSize, replicaRead)
 
 	// Retrieve key-value pairs with the specified prefix
 	startKey := []byte(prefix)
 	endKey := tikv.PrefixNextKey([]byte(prefix))
-	iter, err := ss.Iter(startKey, endKey)
+	var iter snapshotIterator
+	var err error
+	if reverse {
+		// the reverse iterator has no lower bound, the walk stops at the first key before startKey
+		iter, err = ss.IterReverse(endKey)
+	} else {
+		iter, err = ss.Iter(startKey, endKey)
+	}
 	if err != nil {
-		logging_error = errors.Wrap(err, fmt.Sprintf("Failed to create iterater for %s during WalkWithPrefix", prefix))
+		logging_error = errors.Wrap(err, fmt.Sprintf("Failed to create iterater for %s during %s", prefix, op))
 		return logging_error
 	}
 	defer iter.Close()
 
 	// Iterate over the key-value pairs
-	for iter.Valid() {
-		// Grab value for empty check
-		byte_val := iter.Value()
-		// Check if empty val and replace with placeholder
-		if isEmptyByte(byte_val) {
-			byte_val = []byte{}
+	for iter.Valid() && (!reverse || bytes.Compare(iter.Key(), startKey) >= 0) {
+		if err = ctx.Err(); err != nil {
+			logging_error = errors.Wrap(err, fmt.Sprintf("%s stopped before key %s", op, string(iter.Key())))
+			return logging_error
+		}
+		if isExpired(iter.Value()) {
+			if err = iter.Next(); err != nil {
+				logging_error = errors.Wrap(err, fmt.Sprintf("Failed to move Iterator after key %s for %s", string(iter.Key()), op))
+				return logging_error
+			}
+			continue
+		}
+		// Decode value from the stored encoding
+		byte_val, err := decodeValue(iter.Value())
+		if err != nil {
+			logging_error = errors.Wrap(err, fmt.Sprintf("Failed to decode key %s for %s", string(iter.Key()), op))
+			return logging_error
 		}
+		observeValueSizeBytes(iter.Key(), len(iter.Value()), largeValueOpScan)
 		err = fn(iter.Key(), byte_val)
 		if err != nil {
-			logging_error = errors.Wrap(err, fmt.Sprintf("Failed to apply fn to (%s;%s)", string(iter.Key()), string(byte_val)))
+			logging_error = errors.Wrap(err, fmt.Sprintf("Failed to apply fn to (%s;%s)", string(iter.Key()), redactValue(string(iter.Key()), string(byte_val))))
 			return logging_error
 		}
 		err = iter.Next()
 		if err != nil {
-			logging_error = errors.Wrap(err, fmt.Sprintf("Failed to move Iterator after key %s for WalkWithPrefix", string(iter.Key())))
+			logging_error = errors.Wrap(err, fmt.Sprintf("Failed to move Iterator after key %s for %s", string(iter.Key()), op))
 			return logging_error
 		}
 	}
-	CheckElapseAndWarn(start, "Slow txnTiKV WalkWithPagination() operation", zap.String("prefix", prefix))
+	kv.checkSlowOp(start, op, 0, 0, zap.String("prefix", prefix))
 	return nil
 }
 
+// WalkWithPrefixCancelable is WalkWithPrefix running in the background, which could be stopped
+// from another goroutine by cancel, without fn returning an error. The walk stops before the next
+// key once canceled, a running fn is not interrupted. wait blocks until the walk stops and returns
+// its error, context.Canceled if it's canceled before visiting all keys. wait is returned besides
+// cancel as the walk has to run in the background for cancel to be returned before it ends: without
+// wait, the caller could neither know when fn is no longer called nor get the error of the walk.
+func (kv *txnTiKV) WalkWithPrefixCancelable(prefix string, paginationSize int, fn func([]byte, []byte) error) (cancel func(), wait func() error) {
+	ctx, cancel := context.WithCancel(kv.baseContext())
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		err = kv.walkWithPrefix(ctx, prefix, paginationSize, fn, kv.replicaRead)
+		if err != nil && ctx.Err() != nil && errors.Is(err, context.Canceled) {
+			err = context.Canceled
+		}
+	}()
+	return cancel, func() error {
+		<-done
+		cancel()
+		return err
+	}
+}
+
 func (kv *txnTiKV) executeTxn(txn *transaction.KVTxn, ctx context.Context) error {
+	if err := kv.checkWritable(); err != nil {
+		return err
+	}
 	start := timerecord.NewTimeRecorder("executeTxn")
 
+	label, err := kv.bumpVersionsLabeled(txn)
+	if err == nil {
+		err = kv.commit(txn, ctx)
+	}
+
 	elapsed := start.ElapseSpan()
 	metrics.MetaOpCounter.WithLabelValues(metrics.MetaTxnLabel, metrics.TotalLabel).Inc()
-	err := commitTxn(txn, ctx)
 	if err == nil {
-		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaTxnLabel).Observe(float64(elapsed.Milliseconds()))
+		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaTxnLabel, label).Observe(float64(elapsed.Milliseconds()))
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaTxnLabel, metrics.SuccessLabel).Inc()
 	} else {
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaTxnLabel, metrics.FailLabel).Inc()
@@ -636,13 +2914,86 @@ func (kv *txnTiKV) executeTxn(txn *transaction.KVTxn, ctx context.Context) error
 	return err
 }
 
-func (kv *txnTiKV) getTiKVMeta(ctx context.Context, key string) (string, error) {
-	ctx1, cancel := context.WithTimeout(ctx, RequestTimeout)
+// commit commits txn under ctx, or within commitTimeout if set. Its errors are marked by ErrTxnCommit,
+// and the ones of a timeout, of a write conflict and of a lost lock by ErrCommitTimeout,
+// ErrCommitConflict and ErrTxnLockNotFound, errors.Is still matches the causes, e.g. context.DeadlineExceeded.
+func (kv *txnTiKV) commit(txn *transaction.KVTxn, ctx context.Context) error {
+	if kv.commitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(kv.baseContext(), kv.commitTimeout)
+		defer cancel()
+	}
+	span := startCommitSpan(ctx, txn)
+	defer span.End()
+	err := commitTxn(txn, ctx)
+	setSpanStatus(span, err)
+	switch {
+	case err == nil:
+		return nil
+	case tikverr.IsErrWriteConflict(err):
+		return &commitError{mark: ErrCommitConflict, err: err}
+	case isTxnLockNotFound(err):
+		return &commitError{mark: ErrTxnLockNotFound, err: err}
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return &commitError{mark: ErrCommitTimeout, err: err}
+	}
+	return &commitError{mark: ErrTxnCommit, err: err}
+}
+
+// isTxnLockNotFound returns if err is the TxnLockNotFound error of TiKV, which is returned as a
+// retryable key error.
+func isTxnLockNotFound(err error) bool {
+	var retryable *tikverr.ErrRetryable
+	return errors.As(err, &retryable) && strings.Contains(retryable.Retryable, "TxnLockNotFound")
+}
+
+// retryOnConflict runs the transaction of attempt, and runs it again while its commit conflicts or
+// loses its locks, up to conflictRetries times with an exponential backoff. The other errors, e.g. of
+// the predicates checked by attempt, are returned at once. It gives up once ctx is done.
+func (kv *txnTiKV) retryOnConflict(ctx context.Context, attempt func() error) error {
+	backoff := kv.conflictBackoff
+	for retries := 0; ; retries++ {
+		err := attempt()
+		if err == nil || !(errors.Is(err, ErrCommitConflict) || errors.Is(err, ErrTxnLockNotFound)) {
+			return err
+		}
+		if retries >= kv.conflictRetries {
+			if kv.conflictRetries == 0 {
+				return err
+			}
+			return &ErrConflictRetriesExhausted{Attempts: retries + 1, Err: err}
+		}
+		log.Debug("txnTiKV write conflicted, retry", zap.Int("retries", retries), zap.Duration("backoff", backoff), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxConflictBackoff {
+			backoff = maxConflictBackoff
+		}
+	}
+}
+
+func (kv *txnTiKV) getTiKVMeta(ctx context.Context, key string, replicaRead tikv.ReplicaReadType) (string, error) {
+	val, err := kv.getTiKVMetaBytes(ctx, key, replicaRead)
+	if err != nil {
+		return "", err
+	}
+	return string(val), nil
+}
+
+// getTiKVMetaBytes is getTiKVMeta returning the value as read, without copying it into a string.
+func (kv *txnTiKV) getTiKVMetaBytes(ctx context.Context, key string, replicaRead tikv.ReplicaReadType) ([]byte, error) {
+	client, release := kv.acquireClient()
+	defer release()
+	ctx1, cancel := withTimeout(ctx, kv.timeout())
 	defer cancel()
 
 	start := timerecord.NewTimeRecorder("getTiKVMeta")
 
-	ss := getSnapshot(kv.txn, SnapshotScanSize)
+	ss := kv.snapshot(client, kv.snapshotScanSize(), replicaRead)
 
 	val, err := ss.Get(ctx1, []byte(key))
 	if err != nil {
@@ -650,55 +3001,82 @@ func (kv *txnTiKV) getTiKVMeta(ctx context.Context, key string) (string, error)
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaGetLabel, metrics.FailLabel).Inc()
 		if err == tikverr.ErrNotExist {
 			// If key is missing
-			return "", common.NewKeyNotExistError(key)
+			return nil, common.NewKeyNotExistError(key)
 		} else {
 			// If call to tikv fails
-			return "", errors.Wrap(err, fmt.Sprintf("Failed to get value for key %s in getTiKVMeta", key))
+			return nil, errors.Wrap(err, fmt.Sprintf("Failed to get value for key %s in getTiKVMeta", key))
 		}
 	}
-
-	// Check if value is the empty placeholder
-	str_val := convertEmptyByteToString(val)
+	if isExpired(val) {
+		return nil, common.NewKeyNotExistError(key)
+	}
 
 	elapsed := start.ElapseSpan()
 
 	metrics.MetaOpCounter.WithLabelValues(metrics.MetaGetLabel, metrics.TotalLabel).Inc()
-	metrics.MetaKvSize.WithLabelValues(metrics.MetaGetLabel).Observe(float64(len(val)))
-	metrics.MetaRequestLatency.WithLabelValues(metrics.MetaGetLabel).Observe(float64(elapsed.Milliseconds()))
+	label := prefixLabel(key)
+	metrics.MetaKvSize.WithLabelValues(metrics.MetaGetLabel, label).Observe(float64(len(val)))
+	observeValueSize(key, len(val), largeValueOpLoad)
+	metrics.MetaRequestLatency.WithLabelValues(metrics.MetaGetLabel, label).Observe(float64(elapsed.Milliseconds()))
 	metrics.MetaOpCounter.WithLabelValues(metrics.MetaGetLabel, metrics.SuccessLabel).Inc()
 
-	return str_val, nil
+	value, err := decodeValue(val)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Failed to decode key %s", key))
+	}
+	return value, nil
 }
 
 func (kv *txnTiKV) putTiKVMeta(ctx context.Context, key, val string) error {
-	ctx1, cancel := context.WithTimeout(ctx, RequestTimeout)
+	// Check if the value being written needs to be empty plaeholder
+	byte_value, err := convertEmptyStringToByte(val)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Failed to cast to byte (%s:%s) for putTiKVMeta", key, redactValue(key, val)))
+	}
+	return kv.putStoredValue(ctx, key, kv.compressValue(byte_value))
+}
+
+// putStoredValue sets the stored value, already in the stored encoding, of the full key.
+func (kv *txnTiKV) putStoredValue(ctx context.Context, key string, byte_value []byte) error {
+	client, release := kv.acquireClient()
+	defer release()
+	ctx1, cancel := withTimeout(ctx, kv.timeout())
 	defer cancel()
 
+	if err := kv.checkWritable(); err != nil {
+		return err
+	}
+	if err := checkValueSize(key, len(byte_value)); err != nil {
+		return err
+	}
 	start := timerecord.NewTimeRecorder("putTiKVMeta")
 
-	txn, err := beginTxn(kv.txn)
-	if err != nil {
-		return errors.Wrap(err, "Failed to build transaction for putTiKVMeta")
-	}
-	// Defer a rollback only if the transaction hasn't been committed
-	defer rollbackOnFailure(&err, txn)
+	put := func() (err error) {
+		txn, err := startTxn(client)
+		if err != nil {
+			return errors.Wrap(err, "Failed to build transaction for putTiKVMeta")
+		}
+		// Defer a rollback only if the transaction hasn't been committed
+		defer rollbackOnFailure(&err, txn)
 
-	// Check if the value being written needs to be empty plaeholder
-	byte_value, err := convertEmptyStringToByte(val)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Failed to cast to byte (%s:%s) for putTiKVMeta", key, val))
-	}
-	err = txn.Set([]byte(key), byte_value)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Failed to set value for key %s in putTiKVMeta", key))
+		err = txn.Set([]byte(key), byte_value)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Failed to set value for key %s in putTiKVMeta", key))
+		}
+		if err = kv.bumpVersions(txn); err != nil {
+			return err
+		}
+		return kv.commit(txn, ctx1)
 	}
-	err = commitTxn(txn, ctx1)
+	err := kv.retryOnConflict(ctx1, put)
 
 	elapsed := start.ElapseSpan()
 	metrics.MetaOpCounter.WithLabelValues(metrics.MetaPutLabel, metrics.TotalLabel).Inc()
 	if err == nil {
-		metrics.MetaKvSize.WithLabelValues(metrics.MetaPutLabel).Observe(float64(len(byte_value)))
-		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaPutLabel).Observe(float64(elapsed.Milliseconds()))
+		label := prefixLabel(key)
+		metrics.MetaKvSize.WithLabelValues(metrics.MetaPutLabel, label).Observe(float64(len(byte_value)))
+		observeValueSize(key, len(byte_value), largeValueOpSave)
+		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaPutLabel, label).Observe(float64(elapsed.Milliseconds()))
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaPutLabel, metrics.SuccessLabel).Inc()
 	} else {
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaPutLabel, metrics.FailLabel).Inc()
@@ -708,12 +3086,17 @@ func (kv *txnTiKV) putTiKVMeta(ctx context.Context, key, val string) error {
 }
 
 func (kv *txnTiKV) removeTiKVMeta(ctx context.Context, key string) error {
-	ctx1, cancel := context.WithTimeout(ctx, RequestTimeout)
+	client, release := kv.acquireClient()
+	defer release()
+	ctx1, cancel := withTimeout(ctx, kv.timeout())
 	defer cancel()
 
+	if err := kv.checkWritable(); err != nil {
+		return err
+	}
 	start := timerecord.NewTimeRecorder("removeTiKVMeta")
 
-	txn, err := beginTxn(kv.txn)
+	txn, err := startTxn(client)
 	if err != nil {
 		return errors.Wrap(err, "Failed to build transaction for removeTiKVMeta")
 	}
@@ -724,13 +3107,16 @@ func (kv *txnTiKV) removeTiKVMeta(ctx context.Context, key string) error {
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Failed to remove key %s in removeTiKVMeta", key))
 	}
-	err = commitTxn(txn, ctx1)
+	if err = kv.bumpVersions(txn); err != nil {
+		return err
+	}
+	err = kv.commit(txn, ctx1)
 
 	elapsed := start.ElapseSpan()
 	metrics.MetaOpCounter.WithLabelValues(metrics.MetaRemoveLabel, metrics.TotalLabel).Inc()
 
 	if err == nil {
-		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaRemoveLabel).Observe(float64(elapsed.Milliseconds()))
+		metrics.MetaRequestLatency.WithLabelValues(metrics.MetaRemoveLabel, prefixLabel(key)).Observe(float64(elapsed.Milliseconds()))
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaRemoveLabel, metrics.SuccessLabel).Inc()
 	} else {
 		metrics.MetaOpCounter.WithLabelValues(metrics.MetaRemoveLabel, metrics.FailLabel).Inc()
@@ -739,45 +3125,145 @@ func (kv *txnTiKV) removeTiKVMeta(ctx context.Context, key string) error {
 	return err
 }
 
-func (kv *txnTiKV) CompareVersionAndSwap(key string, version int64, target string) (bool, error) {
-	err := fmt.Errorf("Unimplemented! CompareVersionAndSwap is under deprecation")
-	logWarnOnFailure(&err, "Unimplemented")
-	return false, err
+// slowOpThreshold returns the elapsed time of the slow operations, see CheckElapseAndWarn.
+func slowOpThreshold() time.Duration {
+	return Params.TiKVCfg.SlowOpThreshold.GetAsDuration(time.Millisecond)
 }
 
-// CheckElapseAndWarn checks the elapsed time and warns if it is too long.
+// CheckElapseAndWarn checks the elapsed time and warns if it exceeds tikv.slowOpThreshold, 0 disables
+// the check. The slow operations are counted by MetaSlowOpCounter under the unknown operation, see
+// CheckSlowOp for the operations of txnTiKV.
 func CheckElapseAndWarn(start time.Time, message string, fields ...zap.Field) bool {
 	elapsed := time.Since(start)
-	if elapsed.Milliseconds() > 2000 {
-		log.Warn(message, append([]zap.Field{zap.String("time spent", elapsed.String())}, fields...)...)
-		return true
+	threshold := slowOpThreshold()
+	if threshold <= 0 || elapsed <= threshold {
+		return false
 	}
-	return false
+	metrics.MetaSlowOpCounter.WithLabelValues("unknown").Inc()
+	log.Warn(message, append([]zap.Field{zap.String("time spent", elapsed.String())}, fields...)...)
+	return true
 }
 
-// Since TiKV cannot store empty key values, we assign them a placeholder held by EmptyValue.
-// Upon loading, we need to check if the returned value is the placeholder.
-func isEmptyByte(value []byte) bool {
-	return bytes.Equal(value, EmptyValueByte) || len(value) == 0
+// SlowOp describes an operation checked by CheckSlowOp.
+type SlowOp struct {
+	// Op is the name of the operation, e.g. "MultiSaveAndRemove"
+	Op       string
+	RootPath string
+	// KeyCount is the number of keys read or written, 0 if not known, e.g. for the prefix removals
+	KeyCount int
+	// ValueBytes is the total size of the values read or written, 0 if not known
+	ValueBytes int
 }
 
-// Return an empty string if the value is the Empty placeholder, else return actual string value.
-func convertEmptyByteToString(value []byte) string {
-	if isEmptyByte(value) {
-		return ""
-	} else {
-		return string(value)
+// CheckSlowOp is CheckElapseAndWarn with the fields of op, which are logged along with fields, and
+// the slow operations are counted by MetaSlowOpCounter under op.Op, so they can be alerted on.
+func CheckSlowOp(start time.Time, op SlowOp, fields ...zap.Field) bool {
+	elapsed := time.Since(start)
+	threshold := slowOpThreshold()
+	if threshold <= 0 || elapsed <= threshold {
+		return false
+	}
+	metrics.MetaSlowOpCounter.WithLabelValues(op.Op).Inc()
+	log.Warn("Slow txnTiKV operation", append([]zap.Field{
+		zap.String("op", op.Op),
+		zap.String("rootPath", op.RootPath),
+		zap.Int("keyCount", op.KeyCount),
+		zap.Int("valueBytes", op.ValueBytes),
+		zap.String("time spent", elapsed.String()),
+	}, fields...)...)
+	return true
+}
+
+// checkSlowOp is CheckSlowOp of the operation op of kv.
+func (kv *txnTiKV) checkSlowOp(start time.Time, op string, keyCount int, valueBytes int, fields ...zap.Field) bool {
+	return CheckSlowOp(start, SlowOp{Op: op, RootPath: kv.rootPath, KeyCount: keyCount, ValueBytes: valueBytes}, fields...)
+}
+
+// valuesSize returns the total size of values.
+func valuesSize[V string | []byte](values []V) int {
+	size := 0
+	for _, value := range values {
+		size += len(value)
+	}
+	return size
+}
+
+// mapValuesSize returns the total size of the values of kvs.
+func mapValuesSize[V string | []byte](kvs map[string]V) int {
+	size := 0
+	for _, value := range kvs {
+		size += len(value)
+	}
+	return size
+}
+
+// Since TiKV cannot store empty key values, every value is stored with ValueHeader and a tag prepended,
+// or as EmptyValueString if empty in the legacy encoding, see WriteValueHeader. Upon loading, we need to
+// decode the value by its tag, or the legacy encoding if there is no header. A value with the header
+// and no known tag is returned as stored, a compressed value failing to decompress is ErrCorruptedValue.
+func decodeValue(value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, valueHeaderByte) {
+		if bytes.Equal(value, EmptyValueByte) {
+			return []byte{}, nil
+		}
+		return value, nil
+	}
+	if len(value) == len(valueHeaderByte) {
+		return value, nil
+	}
+	switch value[len(valueHeaderByte)] {
+	case plainValueTag:
+		return value[len(plainValueHeaderByte):], nil
+	case ttlValueTag:
+		if len(value) >= ttlValuePrefixLen {
+			return value[ttlValuePrefixLen:], nil
+		}
+	case compressedValueTag:
+		return decompressValue(value)
 	}
+	return value, nil
+}
+
+// isLegacyValue returns if value is stored without ValueHeader.
+func isLegacyValue(value []byte) bool {
+	return !bytes.HasPrefix(value, valueHeaderByte)
+}
+
+// Return the actual string value of the stored value.
+func convertEmptyByteToString(value []byte) (string, error) {
+	decoded, err := decodeValue(value)
+	return string(decoded), err
 }
 
-// Convert string into EmptyValue if empty else cast to []byte. Will throw error if value is equal
-// to the EmptyValueString.
+// Convert string into the stored value, with ValueHeader if WriteValueHeader is enabled, see
+// encodeValue, or in the legacy encoding, see encodeLegacyValue.
 func convertEmptyStringToByte(value string) ([]byte, error) {
+	if !WriteValueHeader {
+		return encodeLegacyValue([]byte(value))
+	}
+	return encodeValue(value), nil
+}
+
+// encodeValue returns the stored value of value with ValueHeader and plainValueTag, whatever the
+// value is.
+func encodeValue[V string | []byte](value V) []byte {
+	res := make([]byte, 0, len(plainValueHeaderByte)+len(value))
+	res = append(res, plainValueHeaderByte...)
+	return append(res, value...)
+}
+
+// encodeLegacyValue returns the stored value of value without ValueHeader, EmptyValueByte if empty.
+// Will throw error if value is equal to the EmptyValueString, which is read as empty value, or if it
+// starts with ValueHeader, as it would be read as a value with the header.
+func encodeLegacyValue(value []byte) ([]byte, error) {
 	if len(value) == 0 {
 		return EmptyValueByte, nil
-	} else if value == EmptyValueString {
+	}
+	if bytes.Equal(value, EmptyValueByte) {
 		return nil, fmt.Errorf("Value for key is reserved by EmptyValue: %s", EmptyValueString)
-	} else {
-		return []byte(value), nil
 	}
+	if bytes.HasPrefix(value, valueHeaderByte) {
+		return nil, fmt.Errorf("Value for key starts with %q, which is reserved for the values with the header", ValueHeader)
+	}
+	return value, nil
 }
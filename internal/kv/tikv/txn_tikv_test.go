@@ -17,22 +17,56 @@
 package tikv
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/cockroachdb/errors"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	tikverr "github.com/tikv/client-go/v2/error"
+	tikv "github.com/tikv/client-go/v2/kv"
+	"github.com/tikv/client-go/v2/oracle"
+	"github.com/tikv/client-go/v2/tikvrpc"
+	"github.com/tikv/client-go/v2/tikvrpc/interceptor"
 	"github.com/tikv/client-go/v2/txnkv"
 	"github.com/tikv/client-go/v2/txnkv/transaction"
+	"github.com/tikv/client-go/v2/txnkv/txnsnapshot"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"golang.org/x/exp/maps"
 
+	"github.com/milvus-io/milvus/internal/kv"
 	"github.com/milvus-io/milvus/internal/kv/predicates"
+	"github.com/milvus-io/milvus/pkg/common"
+	"github.com/milvus-io/milvus/pkg/log"
+	"github.com/milvus-io/milvus/pkg/metrics"
+	"github.com/milvus-io/milvus/pkg/util/merr"
 )
 
+// the tests name the kv instances kv, which shadows the package
+type missingKeysError = kv.MissingKeysError
+
 func TestTiKVLoad(te *testing.T) {
 	te.Run("kv SaveAndLoad", func(t *testing.T) {
 		rootPath := "/tikv/test/root/saveandload"
@@ -74,7 +108,9 @@ func TestTiKVLoad(te *testing.T) {
 
 		for _, test := range invalidLoadTests {
 			val, err := kv.Load(test.invalidKey)
-			assert.Error(t, err)
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+			assert.True(t, common.IsKeyNotExistError(err))
+			assert.Contains(t, err.Error(), test.invalidKey)
 			assert.Zero(t, val)
 		}
 
@@ -116,6 +152,16 @@ func TestTiKVLoad(te *testing.T) {
 			assert.Equal(t, test.expectedError, err)
 		}
 
+		for _, test := range loadPrefixTests {
+			expected := make(map[string]string, len(test.expectedKeys))
+			for i, key := range test.expectedKeys {
+				expected[key] = test.expectedValues[i]
+			}
+			actual, err := kv.LoadWithPrefixAsMap(test.prefix)
+			assert.Equal(t, expected, actual, "prefix: %s", test.prefix)
+			assert.Equal(t, test.expectedError, err)
+		}
+
 		removeTests := []struct {
 			validKey   string
 			invalidKey string
@@ -183,16 +229,24 @@ func TestTiKVLoad(te *testing.T) {
 		invalidMultiLoad := []struct {
 			invalidKeys    []string
 			expectedValues []string
+			missingKeys    []string
 		}{
-			{[]string{"a", "key_1"}, []string{"", "value_1"}},
-			{[]string{".....", "key_1"}, []string{"", "value_1"}},
-			{[]string{"*********"}, []string{""}},
-			{[]string{"key_1", "1"}, []string{"value_1", ""}},
+			{[]string{"a", "key_1"}, []string{"", "value_1"}, []string{"a"}},
+			{[]string{".....", "key_1"}, []string{"", "value_1"}, []string{"....."}},
+			{[]string{"*********"}, []string{""}, []string{"*********"}},
+			{[]string{"key_1", "1"}, []string{"value_1", ""}, []string{"1"}},
 		}
 
 		for _, test := range invalidMultiLoad {
 			vs, err := kv.MultiLoad(test.invalidKeys)
-			assert.Error(t, err)
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+			var missing *missingKeysError
+			if assert.ErrorAs(t, err, &missing) {
+				assert.Len(t, missing.Keys, len(test.missingKeys))
+				for i, key := range test.missingKeys {
+					assert.True(t, strings.HasSuffix(missing.Keys[i], key))
+				}
+			}
 			assert.Equal(t, test.expectedValues, vs)
 		}
 
@@ -307,17 +361,19 @@ func TestTiKVLoad(te *testing.T) {
 			beginTxn = tiTxnBegin
 		}()
 		err := kv.Save("key1", "v1")
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnBegin)
+		assert.ErrorContains(t, err, "bad txn!")
+		assert.NotErrorIs(t, err, ErrTxnCommit)
 		err = kv.MultiSave(map[string]string{"A/100": "v1"})
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnBegin)
 		err = kv.Remove("key1")
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnBegin)
 		err = kv.MultiRemove([]string{"key_1", "key_2"})
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnBegin)
 		err = kv.MultiSaveAndRemove(map[string]string{"key_1": "value_1"}, []string{})
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnBegin)
 		err = kv.MultiSaveAndRemoveWithPrefix(map[string]string{"y/c": "vvv"}, []string{"/"})
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnBegin)
 	})
 
 	te.Run("kv failed to commit txn", func(t *testing.T) {
@@ -333,17 +389,20 @@ func TestTiKVLoad(te *testing.T) {
 		}()
 		var err error
 		err = kv.Save("key1", "v1")
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnCommit)
+		assert.ErrorContains(t, err, "bad txn commit!")
+		assert.NotErrorIs(t, err, ErrTxnBegin)
+		assert.NotErrorIs(t, err, ErrTxnConflict)
 		err = kv.MultiSave(map[string]string{"A/100": "v1"})
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnCommit)
 		err = kv.Remove("key1")
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnCommit)
 		err = kv.MultiRemove([]string{"key_1", "key_2"})
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnCommit)
 		err = kv.MultiSaveAndRemove(map[string]string{"key_1": "value_1"}, []string{})
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnCommit)
 		err = kv.MultiSaveAndRemoveWithPrefix(map[string]string{"y/c": "vvv"}, []string{"/"})
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrTxnCommit)
 	})
 }
 
@@ -419,16 +478,287 @@ func TestWalkWithPagination(t *testing.T) {
 		testFn(-100)
 		testFn(100)
 	})
+
+	t.Run("reverse", func(t *testing.T) {
+		walkReverse := func(prefix string, pagination int) []string {
+			keys := make([]string, 0)
+			err := kv.WalkWithPrefixReverse(prefix, pagination, func(key []byte, value []byte) error {
+				k := string(key)[len(rootPath)+1:]
+				assert.Equal(t, kvs[k], string(value))
+				keys = append(keys, k)
+				return nil
+			})
+			assert.NoError(t, err)
+			return keys
+		}
+
+		for _, p := range []int{-1, 0, 1, 2, 3, 5, 100} {
+			assert.Equal(t, []string{"AB/2/100", "AB/100", "AA/100", "A/100"}, walkReverse("A", p), "pagination: %d", p)
+			assert.Equal(t, []string{"B/100", "AB/2/100", "AB/100", "AA/100", "A/100"}, walkReverse("", p), "pagination: %d", p)
+		}
+		assert.Equal(t, []string{"AB/2/100", "AB/100"}, walkReverse("AB", 1))
+		assert.Empty(t, walkReverse("non-exist-prefix", 5))
+
+		// the walk stops at the first error
+		visited := 0
+		err := kv.WalkWithPrefixReverse("A", 1, func(key []byte, value []byte) error {
+			visited++
+			if visited == 2 {
+				return errors.New("error")
+			}
+			return nil
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 2, visited)
+	})
+}
+
+func TestWalkWithPrefixReverse(t *testing.T) {
+	rootPath := "/tikv/test/root/walk_reverse"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	// the checkpoints of the channels, keyed by their timestamps
+	const n = 50
+	ts := uint64(449000000000000000)
+	kvs := make(map[string]string)
+	for i := 0; i < n; i++ {
+		kvs[fmt.Sprintf("checkpoint/ch1/%d", ts+uint64(i)*1000)] = fmt.Sprintf("%d", i)
+		kvs[fmt.Sprintf("checkpoint/ch2/%d", ts+uint64(i)*1000)] = fmt.Sprintf("%d", i)
+	}
+	err = metaKV.MultiSave(kvs)
+	require.NoError(t, err)
+
+	for _, paginationSize := range []int{1, 7, n, 2 * n} {
+		var keys []string
+		err = metaKV.WalkWithPrefixReverse("checkpoint/ch1", paginationSize, func(key []byte, value []byte) error {
+			keys = append(keys, string(key))
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, keys, n, "pagination: %d", paginationSize)
+		for i := 1; i < len(keys); i++ {
+			assert.Greater(t, keys[i-1], keys[i], "pagination: %d", paginationSize)
+		}
+	}
+
+	// the latest checkpoint is the first key visited
+	errStop := errors.New("stop")
+	var latest string
+	err = metaKV.WalkWithPrefixReverse("checkpoint/ch1", 7, func(key []byte, value []byte) error {
+		latest = string(value)
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, fmt.Sprintf("%d", n-1), latest)
+
+	err = metaKV.WalkWithPrefixReverse("checkpoint/ch3", 7, func(key []byte, value []byte) error {
+		return errors.New("unexpected key")
+	})
+	assert.NoError(t, err)
+}
+
+func TestPrefixIterator(t *testing.T) {
+	rootPath := "/tikv/test/root/prefix_iterator"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	clock := time.Now()
+	expirationClock = func() time.Time { return clock }
+	defer func() {
+		expirationClock = time.Now
+	}()
+
+	kvs := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		kvs[fmt.Sprintf("segment/%d", i)] = fmt.Sprintf("value%d", i)
+	}
+	kvs["segment/empty"] = ""
+	kvs["other"] = "other"
+	err = metaKV.MultiSave(kvs)
+	require.NoError(t, err)
+	err = metaKV.SaveWithTTL("segment/expired", "value", time.Minute)
+	require.NoError(t, err)
+	clock = clock.Add(time.Hour)
+
+	expectedKeys, expectedValues, err := metaKV.LoadWithPrefix("segment")
+	require.NoError(t, err)
+	require.Len(t, expectedKeys, 11)
+
+	for _, paginationSize := range []int{-1, 0, 1, 3, 100} {
+		iter := metaKV.NewPrefixIterator("segment", paginationSize)
+		var keys, values []string
+		for iter.Next() {
+			keys = append(keys, string(iter.Key()))
+			values = append(values, string(iter.Value()))
+		}
+		assert.NoError(t, iter.Err())
+		assert.False(t, iter.Next())
+		iter.Close()
+		assert.Equal(t, expectedKeys, keys, "pagination: %d", paginationSize)
+		assert.Equal(t, expectedValues, values, "pagination: %d", paginationSize)
+	}
+
+	iter := metaKV.NewPrefixIterator("non-exist", 1)
+	assert.False(t, iter.Next())
+	assert.NoError(t, iter.Err())
+	iter.Close()
+
+	t.Run("break early", func(t *testing.T) {
+		iter := metaKV.NewPrefixIterator("segment", 2)
+		defer iter.Close()
+		for i := 0; i < 3; i++ {
+			require.True(t, iter.Next())
+			assert.Equal(t, expectedKeys[i], string(iter.Key()))
+		}
+		iter.Close()
+		assert.False(t, iter.Next())
+		assert.Nil(t, iter.Key())
+		assert.NoError(t, iter.Err())
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		iter := metaKV.WithContext(ctx).NewPrefixIterator("segment", 2)
+		defer iter.Close()
+		require.True(t, iter.Next())
+		cancel()
+		assert.False(t, iter.Next())
+		assert.ErrorIs(t, iter.Err(), context.Canceled)
+	})
+}
+
+func TestWalkWithPrefixCancelable(t *testing.T) {
+	rootPath := "/tikv/test/root/walk_cancelable"
+	kv := NewTiKV(txnClient, rootPath)
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	const n = 1000
+	for i := 0; i < n; i += 200 {
+		kvs := make(map[string]string)
+		for j := i; j < i+200; j++ {
+			kvs[fmt.Sprintf("key%04d", j)] = fmt.Sprintf("value%d", j)
+		}
+		require.NoError(t, kv.MultiSave(kvs))
+	}
+
+	t.Run("cancel mid scan", func(t *testing.T) {
+		var visited atomic.Int64
+		halfway := make(chan struct{})
+		cancel, wait := kv.WalkWithPrefixCancelable("key", 10, func(key []byte, value []byte) error {
+			if visited.Add(1) == 100 {
+				close(halfway)
+			}
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+
+		<-halfway
+		go cancel()
+		err := wait()
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.GreaterOrEqual(t, visited.Load(), int64(100))
+		assert.Less(t, visited.Load(), int64(n))
+
+		// no key is visited after the walk stops
+		stopped := visited.Load()
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, stopped, visited.Load())
+	})
+
+	t.Run("walk to the end", func(t *testing.T) {
+		var visited atomic.Int64
+		cancel, wait := kv.WalkWithPrefixCancelable("key", 10, func(key []byte, value []byte) error {
+			visited.Add(1)
+			return nil
+		})
+		assert.NoError(t, wait())
+		assert.EqualValues(t, n, visited.Load())
+		// cancel after done is a no-op
+		cancel()
+		assert.NoError(t, wait())
+	})
+
+	t.Run("fn error", func(t *testing.T) {
+		cancel, wait := kv.WalkWithPrefixCancelable("key", 10, func(key []byte, value []byte) error {
+			return errors.New("mock error")
+		})
+		defer cancel()
+		err := wait()
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, context.Canceled)
+	})
 }
 
 func TestElapse(t *testing.T) {
 	start := time.Now()
 	isElapse := CheckElapseAndWarn(start, "err message")
 	assert.Equal(t, isElapse, false)
+	assert.Equal(t, 2*time.Second, slowOpThreshold())
 
-	time.Sleep(2001 * time.Millisecond)
+	Params.Save(Params.TiKVCfg.SlowOpThreshold.Key, "10")
+	defer Params.Reset(Params.TiKVCfg.SlowOpThreshold.Key)
+	time.Sleep(20 * time.Millisecond)
 	isElapse = CheckElapseAndWarn(start, "err message")
 	assert.Equal(t, isElapse, true)
+
+	buf := &bytes.Buffer{}
+	logger, props, err := log.InitLoggerWithWriteSyncer(&log.Config{Level: "info"}, zapcore.AddSync(buf))
+	require.NoError(t, err)
+	log.ReplaceGlobals(logger, props)
+	defer func() {
+		logger, props, _ := log.InitLogger(&log.Config{Level: "info"})
+		log.ReplaceGlobals(logger, props)
+	}()
+
+	// the fields of the operation are logged, and the slow operation is counted
+	counter := metrics.MetaSlowOpCounter.WithLabelValues("SlowOpForTest")
+	before := testutil.ToFloat64(counter)
+	isElapse = CheckSlowOp(start, SlowOp{Op: "SlowOpForTest", RootPath: "/slow/root", KeyCount: 3, ValueBytes: 42}, zap.String("extra", "field"))
+	assert.True(t, isElapse)
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+	output := buf.String()
+	for _, field := range []string{"op=SlowOpForTest", "rootPath=/slow/root", "keyCount=3", "valueBytes=42", "extra=field"} {
+		assert.Contains(t, output, field)
+	}
+
+	// the operations of txnTiKV pass their fields
+	rootPath := "/tikv/test/root/elapse"
+	metaKV := NewTiKV(txnClient, rootPath)
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return tiTxnCommit(txn, ctx)
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+	counter = metrics.MetaSlowOpCounter.WithLabelValues("MultiSave")
+	before = testutil.ToFloat64(counter)
+	buf.Reset()
+	err = metaKV.MultiSave(map[string]string{"a": "12345", "b": "678"})
+	assert.NoError(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+	output = buf.String()
+	for _, field := range []string{"op=MultiSave", "rootPath=" + rootPath, "keyCount=2", "valueBytes=8"} {
+		assert.Contains(t, output, field)
+	}
+
+	// 0 disables the check
+	Params.Save(Params.TiKVCfg.SlowOpThreshold.Key, "0")
+	assert.False(t, CheckElapseAndWarn(start, "err message"))
+	assert.False(t, CheckSlowOp(start, SlowOp{Op: "SlowOpForTest"}))
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
 }
 
 func TestHas(t *testing.T) {
@@ -462,6 +792,108 @@ func TestHas(t *testing.T) {
 	assert.False(t, has)
 }
 
+func TestValueRoundTrip(t *testing.T) {
+	rootPath := "/tikv/test/root/round_trip"
+	defer func() {
+		WriteValueHeader = Params.TiKVCfg.WriteValueHeader.GetAsBool()
+	}()
+	// the values starting with each tag are stored as plain values
+	tagged := map[string]string{
+		"plain":      string(plainValueTag) + "v",
+		"ttl":        string(ttlValueTag) + strings.Repeat("v", 8),
+		"compressed": string(compressedValueTag) + "v",
+		"tag":        string(compressedValueTag),
+	}
+	values := map[string]string{
+		"sentinel": EmptyValueString,
+		"empty":    "",
+		"binary":   string([]byte{0, 1, 2, 0xff, 0xfe}),
+		"header":   ValueHeader + "v",
+		"large":    string(compressedValueTag) + strings.Repeat("v", 2048),
+	}
+	for key, value := range tagged {
+		values[key] = value
+	}
+	stored := func(key string) []byte {
+		value, err := txnClient.GetSnapshot(MaxSnapshotTS).Get(context.Background(), []byte(path.Join(rootPath, key)))
+		require.NoError(t, err)
+		return value
+	}
+	for _, opts := range [][]Option{nil, {WithValueCompression(1024)}} {
+		metaKV := NewTiKV(txnClient, rootPath, opts...)
+		WriteValueHeader = true
+		err := metaKV.RemoveWithPrefix("")
+		require.NoError(t, err)
+
+		err = metaKV.MultiSave(values)
+		require.NoError(t, err)
+		for key, value := range tagged {
+			assert.Equal(t, append([]byte{0, 'm', 'v', '1', plainValueTag}, value...), stored(key), "key: %s", key)
+		}
+		for key, value := range values {
+			loaded, err := metaKV.Load(key)
+			assert.NoError(t, err)
+			assert.Equal(t, value, loaded)
+			bytesValue, err := metaKV.LoadBytes(key)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(value), bytesValue)
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		loaded, err := metaKV.MultiLoad(keys)
+		assert.NoError(t, err)
+		for i, key := range keys {
+			assert.Equal(t, values[key], loaded[i])
+		}
+
+		prefixKeys, prefixValues, err := metaKV.LoadWithPrefix("")
+		assert.NoError(t, err)
+		prefixed := make(map[string]string)
+		for i, key := range prefixKeys {
+			prefixed[strings.TrimPrefix(key, rootPath+"/")] = prefixValues[i]
+		}
+		assert.Equal(t, values, prefixed)
+		walked := make(map[string]string)
+		err = metaKV.WalkWithPrefix("", 2, func(key []byte, value []byte) error {
+			walked[strings.TrimPrefix(string(key), rootPath+"/")] = string(value)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, values, walked)
+
+		// the byte saves encode the same
+		err = metaKV.SaveBytes("sentinel", EmptyValueByte)
+		assert.NoError(t, err)
+		assert.Equal(t, encodeValue(EmptyValueString), stored("sentinel"))
+		loadedValue, err := metaKV.Load("sentinel")
+		assert.NoError(t, err)
+		assert.Equal(t, EmptyValueString, loadedValue)
+
+		// the value starting with the tag of the values with a TTL never expires
+		removed, err := metaKV.RemoveExpired("")
+		assert.NoError(t, err)
+		assert.Empty(t, removed)
+		metaKV.Close()
+	}
+
+	// the legacy sentinel is still read as an empty value
+	metaKV := NewTiKV(txnClient, rootPath)
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+	txn, err := txnClient.Begin()
+	require.NoError(t, err)
+	require.NoError(t, txn.Set([]byte(rootPath+"/legacy"), EmptyValueByte))
+	require.NoError(t, txn.Commit(context.Background()))
+	value, err := metaKV.Load("legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, "", value)
+	_, prefixValues, err := metaKV.LoadWithPrefix("legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, prefixValues)
+}
+
 func TestHasPrefix(t *testing.T) {
 	rootPath := "/etcd/test/root/hasprefix"
 	kv := NewTiKV(txnClient, rootPath)
@@ -490,6 +922,265 @@ func TestHasPrefix(t *testing.T) {
 	assert.False(t, has)
 }
 
+func TestCountWithPrefix(t *testing.T) {
+	rootPath := "/tikv/test/root/countprefix"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	scanSize := SnapshotScanSize
+	SnapshotScanSize = 3
+	defer func() {
+		SnapshotScanSize = scanSize
+	}()
+
+	clock := time.Now()
+	expirationClock = func() time.Time { return clock }
+	defer func() {
+		expirationClock = time.Now
+	}()
+
+	count, err := metaKV.CountWithPrefix("segment")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	kvs := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		kvs[fmt.Sprintf("segment/%d", i)] = fmt.Sprintf("value%d", i)
+	}
+	kvs["segment/empty"] = ""
+	kvs["index/1"] = "value"
+	err = metaKV.MultiSave(kvs)
+	require.NoError(t, err)
+	err = metaKV.SaveWithTTL("segment/lease", "value", time.Minute)
+	require.NoError(t, err)
+
+	count, err = metaKV.CountWithPrefix("segment")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), count)
+	count, err = metaKV.CountWithPrefix("")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(13), count)
+	count, err = metaKV.CountWithPrefix("non-exist")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	// the keys of the expired values are counted until they are removed
+	clock = clock.Add(time.Hour)
+	count, err = metaKV.CountWithPrefix("segment")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), count)
+	_, err = metaKV.RemoveExpired("segment")
+	assert.NoError(t, err)
+	count, err = metaKV.CountWithPrefix("segment")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), count)
+
+	err = metaKV.MultiRemove([]string{"segment/0", "segment/1"})
+	assert.NoError(t, err)
+	count, err = metaKV.CountWithPrefix("segment")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), count)
+}
+
+func TestLoadKeysWithPrefix(t *testing.T) {
+	rootPath := "/tikv/test/root/load_keys"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	keyOnlyScans, scans := atomic.NewInt64(0), atomic.NewInt64(0)
+	getSnapshot = func(txn *txnkv.Client, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+		ss := tiTxnSnapshot(txn, paginationSize, replicaRead)
+		ss.SetRPCInterceptor(func(next interceptor.RPCInterceptorFunc) interceptor.RPCInterceptorFunc {
+			return func(target string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+				if req.Type == tikvrpc.CmdScan {
+					scans.Inc()
+					if req.Scan().GetKeyOnly() {
+						keyOnlyScans.Inc()
+					}
+				}
+				return next(target, req)
+			}
+		})
+		return ss
+	}
+	defer func() {
+		getSnapshot = tiTxnSnapshot
+	}()
+
+	keys, err := metaKV.LoadKeysWithPrefix("segment")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	kvs := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		kvs[fmt.Sprintf("segment/%d", i)] = fmt.Sprintf("value%d", i)
+	}
+	kvs["segment/empty"] = ""
+	kvs["index/1"] = "value"
+	err = metaKV.MultiSave(kvs)
+	require.NoError(t, err)
+
+	// the same keys as LoadWithPrefix
+	for _, prefix := range []string{"segment", "", "index", "non-exist"} {
+		expected, _, err := metaKV.LoadWithPrefix(prefix)
+		require.NoError(t, err)
+		scans.Store(0)
+		keyOnlyScans.Store(0)
+		keys, err = metaKV.LoadKeysWithPrefix(prefix)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, keys, "prefix: %s", prefix)
+		assert.Positive(t, scans.Load())
+		assert.Equal(t, scans.Load(), keyOnlyScans.Load())
+	}
+
+	t.Run("walk", func(t *testing.T) {
+		expected, _, err := metaKV.LoadWithPrefix("segment")
+		require.NoError(t, err)
+		for _, paginationSize := range []int{1, 3, 100} {
+			var walked []string
+			err = metaKV.WalkKeysWithPrefix("segment", paginationSize, func(key []byte) error {
+				walked = append(walked, string(key))
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, expected, walked, "pagination: %d", paginationSize)
+		}
+
+		count := 0
+		err = metaKV.WalkKeysWithPrefix("segment", 3, func(key []byte) error {
+			count++
+			if count == 2 {
+				return errors.New("mock error")
+			}
+			return nil
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 2, count)
+	})
+}
+
+func TestLoadWithRange(t *testing.T) {
+	rootPath := "/tikv/test/root/load_range"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	kvs := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		kvs[fmt.Sprintf("segment/%d", i)] = fmt.Sprintf("value%d", i)
+	}
+	kvs["segment/3/log"] = "log"
+	kvs["segment/empty"] = ""
+	err = metaKV.MultiSave(kvs)
+	require.NoError(t, err)
+
+	paths := func(keys ...string) []string {
+		fullKeys := make([]string, 0, len(keys))
+		for _, key := range keys {
+			fullKeys = append(fullKeys, metaKV.GetPath(key))
+		}
+		return fullKeys
+	}
+	for _, test := range []struct {
+		startKey, endKey string
+		expectedKeys     []string
+		expectedValues   []string
+	}{
+		{"segment/2", "segment/5", paths("segment/2", "segment/3", "segment/3/log", "segment/4"), []string{"value2", "value3", "log", "value4"}},
+		{"segment/8", "segment/z", paths("segment/8", "segment/9", "segment/empty"), []string{"value8", "value9", ""}},
+		{"segment/4", "segment/4", nil, nil},
+		{"a", "b", nil, nil},
+		{"", "segment/1", paths("segment/0"), []string{"value0"}},
+	} {
+		keys, values, err := metaKV.LoadWithRange(test.startKey, test.endKey, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedKeys, keys, "range: [%s, %s)", test.startKey, test.endKey)
+		assert.Equal(t, test.expectedValues, values, "range: [%s, %s)", test.startKey, test.endKey)
+	}
+
+	_, _, err = metaKV.LoadWithRange("segment/5", "segment/2", 0)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestLoadWithRangeLimit(t *testing.T) {
+	rootPath := "/tikv/test/root/range"
+	metaKV := NewTiKV(txnClient, rootPath)
+	// the root paths sharing the prefix of rootPath, before and after its keys
+	siblings := []*txnTiKV{NewTiKV(txnClient, rootPath+"-a"), NewTiKV(txnClient, rootPath+"0")}
+	for _, kv := range append(siblings, metaKV) {
+		err := kv.RemoveWithPrefix("")
+		require.NoError(t, err)
+		defer kv.Close()
+		defer kv.RemoveWithPrefix("")
+	}
+
+	for _, ts := range []int{100, 150, 200, 250} {
+		key := fmt.Sprintf("checkpoint/%010d", ts)
+		err := metaKV.Save(key, fmt.Sprintf("%d", ts))
+		require.NoError(t, err)
+		for _, sibling := range siblings {
+			err = sibling.Save(key, "sibling")
+			require.NoError(t, err)
+		}
+	}
+
+	checkpoints := func(tss ...int) []string {
+		keys := make([]string, 0, len(tss))
+		for _, ts := range tss {
+			keys = append(keys, metaKV.GetPath(fmt.Sprintf("checkpoint/%010d", ts)))
+		}
+		return keys
+	}
+	for _, test := range []struct {
+		startKey, endKey string
+		limit            int
+		expectedKeys     []string
+	}{
+		// the start key is included, the end key is not
+		{"checkpoint/0000000100", "checkpoint/0000000200", 10, checkpoints(100, 150)},
+		{"checkpoint/0000000101", "checkpoint/0000000201", 10, checkpoints(150, 200)},
+		{"checkpoint/0000000100", "checkpoint/0000000200", 1, checkpoints(100)},
+		{"checkpoint/0000000150", "checkpoint/0000000150", 10, checkpoints()},
+		{"checkpoint/0000000150", "", 10, checkpoints(150, 200, 250)},
+		{"", "checkpoint/0000000150", 10, checkpoints(100)},
+		{"", "", 10, checkpoints(100, 150, 200, 250)},
+		{"", "", 3, checkpoints(100, 150, 200)},
+		{"", "", 0, checkpoints(100, 150, 200, 250)},
+		{"checkpoint/0000000300", "", 10, checkpoints()},
+	} {
+		keys, values, err := metaKV.LoadWithRange(test.startKey, test.endKey, test.limit)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedKeys, keys, "range: [%s, %s), limit: %d", test.startKey, test.endKey, test.limit)
+		for i, key := range keys {
+			assert.Equal(t, strings.TrimLeft(path.Base(key), "0"), values[i])
+		}
+	}
+
+	for _, test := range []struct {
+		startKey, endKey string
+		limit            int
+	}{
+		{"checkpoint/0000000200", "checkpoint/0000000100", 10},
+		{"", "", -1},
+		{"../range-a/checkpoint", "", 10},
+		{"", "../range0", 10},
+	} {
+		_, _, err := metaKV.LoadWithRange(test.startKey, test.endKey, test.limit)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid, "range: [%s, %s), limit: %d", test.startKey, test.endKey, test.limit)
+	}
+}
+
 func TestEmptyKey(t *testing.T) {
 	rootPath := "/etcd/test/root/loadempty"
 	kv := NewTiKV(txnClient, rootPath)
@@ -583,43 +1274,512 @@ func TestScanSize(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, len(keys), scan_size+100)
 
+	count, err := kv.CountWithPrefix("")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(scan_size+100), count)
+	withLeadingOne := 0
+	for key := range key_map {
+		if strings.HasPrefix(key, "1") {
+			withLeadingOne++
+		}
+	}
+	count, err = kv.CountWithPrefix("1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(withLeadingOne), count)
+
 	err = kv.RemoveWithPrefix("")
 	require.NoError(t, err)
+
+	count, err = kv.CountWithPrefix("")
+	assert.NoError(t, err)
+	assert.Zero(t, count)
 }
 
-func TestTiKVUnimplemented(t *testing.T) {
-	kv := NewTiKV(txnClient, "/")
-	err := kv.RemoveWithPrefix("")
+func TestScanSizeOption(t *testing.T) {
+	rootPath := "/tikv/test/root/scan_size_option"
+	metaKV := NewTiKV(txnClient, rootPath, WithScanSize(3))
+	err := metaKV.RemoveWithPrefix("")
 	require.NoError(t, err)
 
-	defer kv.Close()
-	defer kv.RemoveWithPrefix("")
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
 
-	_, err = kv.CompareVersionAndSwap("k", 1, "target")
-	assert.Error(t, err)
-}
+	assert.Equal(t, 3, metaKV.snapshotScanSize())
+	// the other instances keep the default
+	assert.Equal(t, SnapshotScanSize, NewTiKV(txnClient, rootPath).snapshotScanSize())
+	for _, size := range []int{0, -1} {
+		assert.Equal(t, SnapshotScanSize, NewTiKV(txnClient, rootPath, WithScanSize(size)).snapshotScanSize())
+	}
 
-func TestTxnWithPredicates(t *testing.T) {
-	kv := NewTiKV(txnClient, "/")
-	err := kv.RemoveWithPrefix("")
-	require.NoError(t, err)
+	kvs := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		kvs[fmt.Sprintf("key%d", i)] = fmt.Sprintf("value%d", i)
+	}
+	require.NoError(t, metaKV.MultiSave(kvs))
 
-	prepareKV := map[string]string{
-		"lease1": "1",
-		"lease2": "2",
+	scans := atomic.NewInt64(0)
+	getSnapshot = func(txn *txnkv.Client, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+		ss := tiTxnSnapshot(txn, paginationSize, replicaRead)
+		ss.SetRPCInterceptor(func(next interceptor.RPCInterceptorFunc) interceptor.RPCInterceptorFunc {
+			return func(target string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+				if req.Type == tikvrpc.CmdScan {
+					scans.Inc()
+				}
+				return next(target, req)
+			}
+		})
+		return ss
 	}
+	defer func() {
+		getSnapshot = tiTxnSnapshot
+	}()
 
-	err = kv.MultiSave(prepareKV)
-	require.NoError(t, err)
+	// 10 keys in batches of 3 take 4 scans
+	keys, values, err := metaKV.LoadWithPrefix("key")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 10)
+	assert.Len(t, values, 10)
+	assert.EqualValues(t, 4, scans.Load())
 
-	multiSaveAndRemovePredTests := []struct {
-		tag           string
-		multiSave     map[string]string
-		preds         []predicates.Predicate
-		expectSuccess bool
+	scans.Store(0)
+	visited := 0
+	err = metaKV.WalkWithPrefix("key", 0, func([]byte, []byte) error {
+		visited++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, visited)
+	assert.EqualValues(t, 4, scans.Load())
+
+	scans.Store(0)
+	count, err := metaKV.CountWithPrefix("key")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 10, count)
+	assert.EqualValues(t, 4, scans.Load())
+
+	// an explicit pagination size still wins, 2 full batches and the one finding the end of the range
+	scans.Store(0)
+	err = metaKV.WalkWithPrefix("key", 5, func([]byte, []byte) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, scans.Load())
+}
+
+func TestRemoveWithPrefixRange(t *testing.T) {
+	// removed by a transaction, or by DeleteRange
+	for _, threshold := range []int{0, 1} {
+		t.Run(fmt.Sprintf("threshold %d", threshold), func(t *testing.T) {
+			testRemoveWithPrefixRange(t, NewTiKV(txnClient, "/tikv/test/root/remove_range", WithRangeDeleteThreshold(threshold)))
+		})
+	}
+
+	t.Run("threshold", func(t *testing.T) {
+		rootPath := "/tikv/test/root/remove_range_threshold"
+		metaKV := NewTiKV(txnClient, rootPath, WithRangeDeleteThreshold(3))
+		defer metaKV.Close()
+		defer metaKV.RemoveWithPrefix("")
+
+		Params.Save(Params.TiKVCfg.MaxTxnOps.Key, "2")
+		defer Params.Reset(Params.TiKVCfg.MaxTxnOps.Key)
+		require.NoError(t, metaKV.MultiSave(map[string]string{"small/1": "1", "small/2": "2"}))
+		require.NoError(t, metaKV.MultiSave(map[string]string{"large/1": "1", "large/2": "2"}))
+		require.NoError(t, metaKV.Save("large/3", "3"))
+
+		// the prefix under the threshold is removed by a transaction, isolated from the snapshots before it
+		ts, err := metaKV.CurrentTS()
+		require.NoError(t, err)
+		view, err := metaKV.NewSnapshotReader(ts)
+		require.NoError(t, err)
+		defer view.Close()
+		require.NoError(t, metaKV.RemoveWithPrefix("small"))
+		keys, _, err := view.LoadWithPrefix("small")
+		assert.NoError(t, err)
+		assert.Len(t, keys, 2)
+
+		// the prefix reaching the threshold is removed by DeleteRange, beyond tikv.maxTxnOps
+		require.NoError(t, metaKV.RemoveWithPrefix("large"))
+		keys, err = metaKV.LoadKeysWithPrefix("")
+		assert.NoError(t, err)
+		assert.Empty(t, keys)
+
+		// a transaction can't remove more keys than tikv.maxTxnOps
+		transactionalKV := NewTiKV(txnClient, rootPath)
+		defer transactionalKV.Close()
+		require.NoError(t, metaKV.MultiSave(map[string]string{"large/1": "1", "large/2": "2"}))
+		require.NoError(t, metaKV.Save("large/3", "3"))
+		var tooManyOps *ErrTooManyOps
+		assert.ErrorAs(t, transactionalKV.RemoveWithPrefix("large"), &tooManyOps)
+	})
+}
+
+func testRemoveWithPrefixRange(t *testing.T, metaKV *txnTiKV) {
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	keys := []string{
+		"x/ab", "x/abb", "x/abc", "x/abc/1", "x/abc/2", "x/abcd", "x/abd", "x/abd/1", "x/ac",
+		"x/ab\xff", "x/ab\xff/1", "x/ab\xff\xff",
+	}
+	for _, test := range []struct {
+		prefix  string
+		removed []string
+	}{
+		{"x/abc", []string{"x/abc", "x/abc/1", "x/abc/2", "x/abcd"}},
+		// path.Join drops the trailing slash, as for LoadWithPrefix
+		{"x/abc/", []string{"x/abc", "x/abc/1", "x/abc/2", "x/abcd"}},
+		{"x/abd", []string{"x/abd", "x/abd/1"}},
+		// the range ends at "x/ac", which is not removed
+		{"x/ab\xff", []string{"x/ab\xff", "x/ab\xff/1", "x/ab\xff\xff"}},
+	} {
+		kvs := make(map[string]string)
+		for _, key := range keys {
+			kvs[key] = "value"
+		}
+		err = metaKV.MultiSave(kvs)
+		require.NoError(t, err)
+
+		err = metaKV.RemoveWithPrefix(test.prefix)
+		assert.NoError(t, err)
+
+		removed := make(map[string]bool)
+		for _, key := range test.removed {
+			removed[key] = true
+		}
+		var expected []string
+		for _, key := range keys {
+			if !removed[key] {
+				expected = append(expected, metaKV.GetPath(key))
+			}
+		}
+		sort.Strings(expected)
+		remaining, err := metaKV.LoadKeysWithPrefix("")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, remaining, "prefix: %q", test.prefix)
+	}
+}
+
+func TestCompareVersionAndSwap(t *testing.T) {
+	rootPath := "/tikv/test/root/cas"
+	metaKV := NewTiKV(txnClient, rootPath, WithVersionedPrefixes(""))
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	loadVersion := func(key string) int64 {
+		t.Helper()
+		_, version, err := metaKV.LoadWithVersion(key)
+		if common.IsKeyNotExistError(err) {
+			return 0
+		}
+		require.NoError(t, err)
+		return version
+	}
+
+	// version 0 creates the key if absent
+	swapped, err := metaKV.CompareVersionAndSwap("k", 0, "v1")
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	swapped, err = metaKV.CompareVersionAndSwap("k", 0, "v2")
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+	version := loadVersion("k")
+	assert.Positive(t, version)
+	swapped, err = metaKV.CompareVersionAndSwap("k", version, "v2")
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	value, newVersion, err := metaKV.LoadWithVersion("k")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", value)
+	assert.Greater(t, newVersion, version)
+	swapped, err = metaKV.CompareVersionAndSwap("k", version, "v3")
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+
+	// plain writes bump the version too
+	version = loadVersion("k")
+	err = metaKV.Save("k", "v3")
+	assert.NoError(t, err)
+	assert.Greater(t, loadVersion("k"), version)
+	swapped, err = metaKV.CompareVersionAndSwap("k", version, "v4")
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+	version = loadVersion("k")
+	err = metaKV.MultiSaveAndRemove(map[string]string{"k": "v4", "k2": "v1"}, nil)
+	assert.NoError(t, err)
+	assert.Greater(t, loadVersion("k"), version)
+	assert.Equal(t, loadVersion("k"), loadVersion("k2"))
+
+	// a removed key is back to version 0
+	version = loadVersion("k")
+	err = metaKV.Remove("k")
+	assert.NoError(t, err)
+	assert.Zero(t, loadVersion("k"))
+	swapped, err = metaKV.CompareVersionAndSwap("k", version, "v5")
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+	swapped, err = metaKV.CompareVersionAndSwap("k", 0, "v5")
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	err = metaKV.RemoveWithPrefix("k")
+	assert.NoError(t, err)
+	assert.Zero(t, loadVersion("k"))
+	assert.Zero(t, loadVersion("k2"))
+	swapped, err = metaKV.CompareVersionAndSwap("k2", 0, "v2")
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+
+	// the versions are out of the scans
+	keys, _, err := metaKV.LoadWithPrefix("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{rootPath + "/k2"}, keys)
+
+	// a key saved without a version has version 1
+	txn, err := txnClient.Begin()
+	require.NoError(t, err)
+	require.NoError(t, txn.Set([]byte(rootPath+"/legacy"), []byte("v1")))
+	require.NoError(t, txn.Commit(context.Background()))
+	assert.EqualValues(t, 1, loadVersion("legacy"))
+	swapped, err = metaKV.CompareVersionAndSwap("legacy", 1, "v2")
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	assert.Greater(t, loadVersion("legacy"), int64(1))
+
+	// only one of the concurrent swaps of a version wins
+	const writers = 10
+	var wins atomic.Int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			swapped, err := metaKV.CompareVersionAndSwap("contended", 0, fmt.Sprintf("writer-%d", i))
+			assert.NoError(t, err)
+			if swapped {
+				wins.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, wins.Load())
+	assert.Positive(t, loadVersion("contended"))
+}
+
+func TestVersionedPrefixes(t *testing.T) {
+	rootPath := "/tikv/test/root/versioned_prefixes"
+	metaKV := NewTiKV(txnClient, rootPath, WithVersionedPrefixes("versioned/"))
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	hasSidecar := func(key string) bool {
+		_, err := txnClient.GetSnapshot(MaxSnapshotTS).Get(context.Background(), versionKey(metaKV.GetPath(key)))
+		if tikverr.IsErrNotFound(err) {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+
+	// only the versioned keys have sidecars
+	err = metaKV.MultiSave(map[string]string{"versioned/a": "v", "plain/b": "v"})
+	require.NoError(t, err)
+	assert.True(t, hasSidecar("versioned/a"))
+	assert.False(t, hasSidecar("plain/b"))
+	_, version, err := metaKV.LoadWithVersion("versioned/a")
+	assert.NoError(t, err)
+	swapped, err := metaKV.CompareVersionAndSwap("versioned/a", version, "v2")
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	_, _, err = metaKV.LoadWithVersion("plain/b")
+	assert.Error(t, err)
+	_, err = metaKV.CompareVersionAndSwap("plain/b", 1, "v2")
+	assert.Error(t, err)
+
+	// the sidecars count against tikv.maxTxnOps
+	Params.Save(Params.TiKVCfg.MaxTxnOps.Key, "2")
+	err = metaKV.MultiSave(map[string]string{"plain/1": "v", "plain/2": "v"})
+	assert.NoError(t, err)
+	err = metaKV.MultiSave(map[string]string{"versioned/1": "v", "versioned/2": "v"})
+	var tooManyErr *ErrTooManyOps
+	assert.ErrorAs(t, err, &tooManyErr)
+	Params.Reset(Params.TiKVCfg.MaxTxnOps.Key)
+	has, err := metaKV.Has("versioned/1")
+	assert.NoError(t, err)
+	assert.False(t, has)
+
+	// and against tikv.txnEntrySizeLimit, with the longer sidecar key
+	Params.Save(Params.TiKVCfg.TxnEntrySizeLimit.Key, "1024")
+	defer Params.Reset(Params.TiKVCfg.TxnEntrySizeLimit.Key)
+	long := strings.Repeat("k", 1000-len(metaKV.GetPath("versioned/")))
+	err = metaKV.Save("plain/"+long, "v")
+	assert.NoError(t, err)
+	err = metaKV.Save("versioned/"+long, "v")
+	var tooLargeErr *ErrValueTooLarge
+	if assert.ErrorAs(t, err, &tooLargeErr) {
+		assert.Equal(t, string(versionKey(metaKV.GetPath("versioned/"+long))), tooLargeErr.Key)
+	}
+}
+
+func TestCompareValueAndSwap(t *testing.T) {
+	rootPath := "/tikv/test/root/compare_value_and_swap"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	// a missing key matches "" only
+	swapped, err := metaKV.CompareValueAndSwap("k", "v0", "v1")
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+	has, err := metaKV.Has("k")
+	assert.NoError(t, err)
+	assert.False(t, has)
+	swapped, err = metaKV.CompareValueAndSwap("k", "", "v1")
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	swapped, err = metaKV.CompareValueAndSwap("k", "", "v1")
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+
+	swapped, err = metaKV.CompareValueAndSwap("k", "v2", "v3")
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+	swapped, err = metaKV.CompareValueAndSwap("k", "v1", "")
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	value, err := metaKV.Load("k")
+	assert.NoError(t, err)
+	assert.Equal(t, "", value)
+	swapped, err = metaKV.CompareValueAndSwap("k", "", "v2")
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	value, err = metaKV.Load("k")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", value)
+
+	// the legacy empty value equals ""
+	txn, err := txnClient.Begin()
+	require.NoError(t, err)
+	require.NoError(t, txn.Set([]byte(rootPath+"/legacy"), EmptyValueByte))
+	require.NoError(t, txn.Commit(context.Background()))
+	swapped, err = metaKV.CompareValueAndSwap("legacy", "", "v1")
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+
+	_, err = metaKV.CompareValueAndSwap("k", "v2", EmptyValueString)
+	assert.Error(t, err)
+
+	// only one of two racing swaps wins
+	err = metaKV.Save("raced", "v0")
+	require.NoError(t, err)
+	var wins atomic.Int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			swapped, err := metaKV.CompareValueAndSwap("raced", "v0", fmt.Sprintf("writer-%d", i))
+			assert.NoError(t, err)
+			if swapped {
+				wins.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, wins.Load())
+	value, err = metaKV.Load("raced")
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"writer-0", "writer-1"}, value)
+
+	// a swap losing a write conflict is retried against the value written by the winner
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		commitTxn = tiTxnCommit
+		require.NoError(t, metaKV.Save("lock", "other"))
+		return tiTxnCommit(txn, ctx)
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+	swapped, err = metaKV.CompareValueAndSwap("lock", "", "owner")
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+	value, err = metaKV.Load("lock")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", value)
+
+	// failing to begin or commit is an error
+	beginTxn = func(txn *txnkv.Client) (*transaction.KVTxn, error) {
+		return nil, errors.New("mock begin error")
+	}
+	_, err = metaKV.CompareValueAndSwap("lock", "other", "owner")
+	assert.Error(t, err)
+	beginTxn = tiTxnBegin
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		return errors.New("mock commit error")
+	}
+	_, err = metaKV.CompareValueAndSwap("lock", "other", "owner")
+	assert.Error(t, err)
+	commitTxn = tiTxnCommit
+	value, err = metaKV.Load("lock")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", value)
+}
+
+func TestTxnWithPredicates(t *testing.T) {
+	kv := NewTiKV(txnClient, "/")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	prepareKV := map[string]string{
+		"lease1": "1",
+		"lease2": "2",
+		"empty":  "",
+	}
+
+	err = kv.MultiSave(prepareKV)
+	require.NoError(t, err)
+
+	multiSaveAndRemovePredTests := []struct {
+		tag           string
+		multiSave     map[string]string
+		preds         []predicates.Predicate
+		expectSuccess bool
 	}{
 		{"predicate_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueEqual("lease1", "1")}, true},
 		{"predicate_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueEqual("lease1", "2")}, false},
+		{"value_in_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "0", "1")}, true},
+		{"value_in_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "0", "2")}, false},
+		{"value_in_missing_key", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease3", "", "1")}, false},
+		{"value_in_and_equal_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "1", "2"), predicates.ValueEqual("lease2", "2")}, true},
+		{"value_in_and_equal_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueIn("lease1", "1", "2"), predicates.ValueEqual("lease2", "1")}, false},
+		{"value_greater_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueGreater("lease1", "0")}, true},
+		{"value_greater_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueGreater("lease1", "1")}, false},
+		{"value_less_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueLess("lease1", "2")}, true},
+		{"value_less_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueLess("lease2", "10")}, false},
+		{"value_greater_missing_key", map[string]string{"a": "b"}, []predicates.Predicate{predicates.ValueGreater("lease3", "")}, false},
+		{"numeric_value_greater_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.NumericValueGreater("lease2", -1)}, true},
+		{"numeric_value_greater_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.NumericValueGreater("lease2", 10)}, false},
+		{"numeric_value_less_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.NumericValueLess("lease2", 10)}, true},
+		{"numeric_value_less_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.NumericValueLess("lease1", 1)}, false},
+		{"numeric_value_missing_key", map[string]string{"a": "b"}, []predicates.Predicate{predicates.NumericValueLess("lease3", 10)}, false},
+		{"key_exists_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyExists("lease1")}, true},
+		{"key_exists_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyExists("lease3")}, false},
+		{"key_not_exists_ok", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyNotExists("lease3")}, true},
+		{"key_not_exists_fail", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyNotExists("lease1")}, false},
+		{"key_exists_empty_value", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyExists("empty")}, true},
+		{"key_not_exists_empty_value", map[string]string{"a": "b"}, []predicates.Predicate{predicates.KeyNotExists("empty")}, false},
 	}
 
 	for _, test := range multiSaveAndRemovePredTests {
@@ -640,3 +1800,4264 @@ func TestTxnWithPredicates(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyPredicates(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/key_predicates")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	clock := time.Now()
+	expirationClock = func() time.Time { return clock }
+	defer func() {
+		expirationClock = time.Now
+	}()
+
+	// create-only
+	err = kv.MultiSaveAndRemove(map[string]string{"collection/1": "c1"}, nil, predicates.KeyNotExists("collection/1"))
+	assert.NoError(t, err)
+	err = kv.MultiSaveAndRemove(map[string]string{"collection/1": "c2"}, nil, predicates.KeyNotExists("collection/1"))
+	assert.ErrorIs(t, err, merr.ErrIoFailed)
+	assert.ErrorContains(t, err, "actual exists=true")
+	value, err := kv.Load("collection/1")
+	assert.NoError(t, err)
+	assert.Equal(t, "c1", value)
+
+	// saved only while the lock is held
+	err = kv.SaveWithTTL("lock", "", time.Minute)
+	require.NoError(t, err)
+	err = kv.MultiSaveAndRemove(map[string]string{"collection/2": "c2"}, []string{"collection/1"}, predicates.KeyExists("lock"))
+	assert.NoError(t, err)
+	clock = clock.Add(time.Minute)
+	err = kv.MultiSaveAndRemoveWithPrefix(map[string]string{"collection/3": "c3"}, nil, predicates.KeyExists("lock"))
+	assert.ErrorIs(t, err, merr.ErrIoFailed)
+	assert.ErrorContains(t, err, "actual exists=false")
+	keys, _, err := kv.LoadWithPrefix("collection")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{kv.GetPath("collection/2")}, keys)
+}
+
+func TestValueInPredicate(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/value_in")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	require.NoError(t, kv.Save("state", "sealed"))
+	assert.NoError(t, kv.MultiSaveAndRemove(map[string]string{"state": "flushing"}, nil, predicates.ValueIn("state", "sealed", "flushing")))
+	value, err := kv.Load("state")
+	assert.NoError(t, err)
+	assert.Equal(t, "flushing", value)
+
+	err = kv.MultiSaveAndRemove(map[string]string{"state": "dropped"}, nil, predicates.ValueIn("state", "growing", "sealed"))
+	assert.ErrorIs(t, err, merr.ErrIoFailed)
+	assert.ErrorContains(t, err, "key=state, candidates=[growing sealed], actual=flushing")
+
+	_, err = kv.MultiSaveAndRemoveWithPrevValues(nil, []string{"state"}, predicates.ValueIn("missing", "growing", ""))
+	assert.ErrorIs(t, err, merr.ErrIoFailed)
+	assert.ErrorContains(t, err, "key=missing, candidates=[growing ], actual=<missing>")
+
+	value, err = kv.Load("state")
+	assert.NoError(t, err)
+	assert.Equal(t, "flushing", value)
+}
+
+func TestMultiRemoveIfValue(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/remove_if_value")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	err = kv.MultiSave(map[string]string{
+		"ref/1": "v1",
+		"ref/2": "v2",
+		"ref/3": "v3",
+		"ref/4": "",
+	})
+	require.NoError(t, err)
+
+	// snapshot taken by the caller before some entries are refreshed
+	expected := map[string]string{
+		"ref/1": "v1",
+		"ref/2": "v2",
+		"ref/3": "v3",
+		"ref/4": "",
+		"ref/5": "v5",
+	}
+	err = kv.Save("ref/2", "v2-refreshed")
+	require.NoError(t, err)
+
+	removed, skipped, err := kv.MultiRemoveIfValue(expected)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"ref/1", "ref/3", "ref/4"}, removed)
+	assert.ElementsMatch(t, []string{"ref/2", "ref/5"}, skipped)
+
+	keys, values, err := kv.LoadWithPrefix("ref")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{kv.GetPath("ref/2")}, keys)
+	assert.Equal(t, []string{"v2-refreshed"}, values)
+
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		return fmt.Errorf("bad txn commit!")
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+	_, _, err = kv.MultiRemoveIfValue(map[string]string{"ref/2": "v2-refreshed"})
+	assert.Error(t, err)
+}
+
+func TestLoadWithPrefixPage(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/page")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	kvs := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		kvs[fmt.Sprintf("key/%02d", i)] = fmt.Sprintf("value%d", i)
+	}
+	kvs["other"] = "other"
+	err = kv.MultiSave(kvs)
+	require.NoError(t, err)
+
+	pageTests := []struct {
+		offset, limit int
+		expected      []int
+	}{
+		{0, 3, []int{0, 1, 2}},
+		{3, 3, []int{3, 4, 5}},
+		{8, 5, []int{8, 9}},
+		{10, 5, []int{}},
+		{20, 5, []int{}},
+		{0, 0, []int{}},
+		{2, 100, []int{2, 3, 4, 5, 6, 7, 8, 9}},
+	}
+	for _, test := range pageTests {
+		keys, values, err := kv.LoadWithPrefixPage("key", test.offset, test.limit)
+		assert.NoError(t, err)
+		expectedKeys := make([]string, 0, len(test.expected))
+		expectedValues := make([]string, 0, len(test.expected))
+		for _, i := range test.expected {
+			expectedKeys = append(expectedKeys, kv.GetPath(fmt.Sprintf("key/%02d", i)))
+			expectedValues = append(expectedValues, fmt.Sprintf("value%d", i))
+		}
+		assert.Equal(t, expectedKeys, keys, "offset: %d, limit: %d", test.offset, test.limit)
+		assert.Equal(t, expectedValues, values, "offset: %d, limit: %d", test.offset, test.limit)
+	}
+
+	_, _, err = kv.LoadWithPrefixPage("key", -1, 1)
+	assert.Error(t, err)
+	_, _, err = kv.LoadWithPrefixPage("key", 0, -1)
+	assert.Error(t, err)
+}
+
+func TestLoadWithPrefixPaged(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/paged")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	kvs := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		kvs[fmt.Sprintf("key/%02d", i)] = fmt.Sprintf("value%d", i)
+	}
+	kvs["other"] = "other"
+	err = kv.MultiSave(kvs)
+	require.NoError(t, err)
+
+	loadAll := func(limit int) ([]string, []string, int) {
+		var allKeys, allValues []string
+		pages := 0
+		token := ""
+		for {
+			keys, values, nextToken, err := kv.LoadWithPrefixPaged("key", limit, token)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(keys), limit)
+			allKeys = append(allKeys, keys...)
+			allValues = append(allValues, values...)
+			pages++
+			if nextToken == "" {
+				return allKeys, allValues, pages
+			}
+			token = nextToken
+		}
+	}
+
+	expectedKeys := make([]string, 0, 10)
+	expectedValues := make([]string, 0, 10)
+	for i := 0; i < 10; i++ {
+		expectedKeys = append(expectedKeys, kv.GetPath(fmt.Sprintf("key/%02d", i)))
+		expectedValues = append(expectedValues, fmt.Sprintf("value%d", i))
+	}
+	for _, test := range []struct {
+		limit, pages int
+	}{
+		{1, 10},
+		{3, 4},
+		// no empty page after the last full one
+		{5, 2},
+		{10, 1},
+		{100, 1},
+	} {
+		keys, values, pages := loadAll(test.limit)
+		assert.Equal(t, expectedKeys, keys, "limit: %d", test.limit)
+		assert.Equal(t, expectedValues, values, "limit: %d", test.limit)
+		assert.Equal(t, test.pages, pages, "limit: %d", test.limit)
+	}
+
+	// the scan resumes after the last returned key, even if it's removed meanwhile
+	keys, _, token, err := kv.LoadWithPrefixPaged("key", 4, "")
+	assert.NoError(t, err)
+	assert.Equal(t, expectedKeys[:4], keys)
+	assert.NotContains(t, token, "/tikv/test/root/paged")
+	err = kv.Remove("key/03")
+	assert.NoError(t, err)
+	keys, values, token, err := kv.LoadWithPrefixPaged("key", 4, token)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedKeys[4:8], keys)
+	assert.Equal(t, expectedValues[4:8], values)
+	assert.NotEmpty(t, token)
+
+	// the token of another prefix or a malformed token is rejected
+	_, _, otherToken, err := kv.LoadWithPrefixPaged("", 1, "")
+	assert.NoError(t, err)
+	_, _, _, err = kv.LoadWithPrefixPaged("other", 1, otherToken)
+	assert.Error(t, err)
+	_, _, _, err = kv.LoadWithPrefixPaged("key", 1, "not base64!")
+	assert.Error(t, err)
+	_, _, _, err = kv.LoadWithPrefixPaged("key", 0, "")
+	assert.Error(t, err)
+
+	keys, values, token, err = kv.LoadWithPrefixPaged("non-exist", 5, "")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.Empty(t, values)
+	assert.Empty(t, token)
+}
+
+func TestLoadWithPrefixPaginated(t *testing.T) {
+	metaKV := NewTiKV(txnClient, "/tikv/test/root/paginated")
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	scanSize := SnapshotScanSize
+	SnapshotScanSize = 4
+	defer func() {
+		SnapshotScanSize = scanSize
+	}()
+
+	const total = 25
+	kvs := make(map[string]string)
+	expectedKeys := make([]string, 0, total)
+	for i := 0; i < total; i++ {
+		key := fmt.Sprintf("segment/%03d", i)
+		kvs[key] = fmt.Sprintf("value%d", i)
+		expectedKeys = append(expectedKeys, metaKV.GetPath(key))
+	}
+	kvs["other"] = "other"
+	err = metaKV.MultiSave(kvs)
+	require.NoError(t, err)
+
+	for _, limit := range []int{1, 3, 4, 5, 7, total, 100} {
+		var keys []string
+		startAfter := ""
+		for pages := 1; ; pages++ {
+			require.LessOrEqual(t, pages, total, "limit: %d", limit)
+			page, values, nextKey, err := metaKV.LoadWithPrefixPaginated("segment/", limit, startAfter)
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(page), limit)
+			for i := range page {
+				assert.Equal(t, kvs[metaKV.relativeKey(page[i])], values[i])
+			}
+			keys = append(keys, page...)
+			if nextKey == "" {
+				break
+			}
+			assert.Equal(t, page[len(page)-1], nextKey)
+			startAfter = nextKey
+		}
+		assert.Equal(t, expectedKeys, keys, "limit: %d", limit)
+	}
+
+	// the keys inserted before the continuation key aren't returned, the ones after it are
+	keys, _, nextKey, err := metaKV.LoadWithPrefixPaginated("segment/", 10, "")
+	require.NoError(t, err)
+	assert.Equal(t, expectedKeys[:10], keys)
+	err = metaKV.MultiSave(map[string]string{"segment/000a": "before", "segment/010a": "after"})
+	require.NoError(t, err)
+	err = metaKV.Remove("segment/009")
+	require.NoError(t, err)
+	keys, _, _, err = metaKV.LoadWithPrefixPaginated("segment/", 3, nextKey)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{expectedKeys[10], metaKV.GetPath("segment/010a"), expectedKeys[11]}, keys)
+
+	// a continuation key out of the prefix range
+	keys, _, _, err = metaKV.LoadWithPrefixPaginated("segment/", 3, metaKV.GetPath("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{expectedKeys[0], metaKV.GetPath("segment/000a"), expectedKeys[1]}, keys)
+	keys, _, nextKey, err = metaKV.LoadWithPrefixPaginated("segment/", 3, metaKV.GetPath("z"))
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.Empty(t, nextKey)
+
+	_, _, _, err = metaKV.LoadWithPrefixPaginated("segment/", 0, "")
+	assert.Error(t, err)
+}
+
+func TestSaveWithVersionBump(t *testing.T) {
+	const concurrency = 20
+	// every bump may lose to all the others
+	kv := NewTiKV(txnClient, "/tikv/test/root/version_bump", WithConflictRetry(concurrency, time.Millisecond))
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	version, err := kv.SaveWithVersionBump("version", map[string]string{"record/0": "value0"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, version)
+
+	wg := sync.WaitGroup{}
+	versions := make([]int64, concurrency)
+	errs := make([]error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			versions[i], errs[i] = kv.SaveWithVersionBump("version", map[string]string{
+				fmt.Sprintf("record/%d", i+1): fmt.Sprintf("value%d", i+1),
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[int64]struct{})
+	for i := 0; i < concurrency; i++ {
+		assert.NoError(t, errs[i])
+		seen[versions[i]] = struct{}{}
+	}
+	assert.Len(t, seen, concurrency)
+
+	val, err := kv.Load("version")
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprint(concurrency+1), val)
+
+	keys, _, err := kv.LoadWithPrefix("record")
+	assert.NoError(t, err)
+	assert.Len(t, keys, concurrency+1)
+
+	_, err = kv.SaveWithVersionBump("version", map[string]string{"version": "100"})
+	assert.Error(t, err)
+
+	err = kv.Save("version", "not-a-number")
+	require.NoError(t, err)
+	_, err = kv.SaveWithVersionBump("version", map[string]string{"record/x": "x"})
+	assert.Error(t, err)
+	has, err := kv.Has("record/x")
+	assert.NoError(t, err)
+	assert.False(t, has)
+}
+
+func TestReadOnly(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/read_only")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	err = kv.Save("key", "value")
+	require.NoError(t, err)
+
+	kv.SetReadOnly(true)
+	writes := map[string]func() error{
+		"Save":             func() error { return kv.Save("key", "new") },
+		"MultiSave":        func() error { return kv.MultiSave(map[string]string{"key": "new"}) },
+		"Remove":           func() error { return kv.Remove("key") },
+		"MultiRemove":      func() error { return kv.MultiRemove([]string{"key"}) },
+		"RemoveWithPrefix": func() error { return kv.RemoveWithPrefix("key") },
+		"MultiSaveAndRemove": func() error {
+			return kv.MultiSaveAndRemove(map[string]string{"key": "new"}, []string{"other"})
+		},
+		"MultiSaveAndRemoveWithPrefix": func() error {
+			return kv.MultiSaveAndRemoveWithPrefix(map[string]string{"key": "new"}, []string{"other"})
+		},
+		"MultiRemoveIfValue": func() error {
+			_, _, err := kv.MultiRemoveIfValue(map[string]string{"key": "value"})
+			return err
+		},
+		"SaveWithVersionBump": func() error {
+			_, err := kv.SaveWithVersionBump("version", map[string]string{"key": "new"})
+			return err
+		},
+	}
+	for name, write := range writes {
+		err = write()
+		assert.ErrorIs(t, err, ErrReadOnly, name)
+		val, err := kv.Load("key")
+		assert.NoError(t, err, name)
+		assert.Equal(t, "value", val, name)
+	}
+
+	kv.SetReadOnly(false)
+	err = kv.Save("key", "new")
+	assert.NoError(t, err)
+	val, err := kv.Load("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "new", val)
+	err = kv.Remove("key")
+	assert.NoError(t, err)
+}
+
+func TestWriteHook(t *testing.T) {
+	metaKV := NewTiKV(txnClient, "/tikv/test/root/write_hook")
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	var ops []kv.WriteOp
+	metaKV.RegisterWriteHook("hook/", func(op kv.WriteOp) {
+		ops = append(ops, op)
+	})
+	metaKV.RegisterWriteHook("", func(op kv.WriteOp) {
+		panic("bad hook")
+	})
+
+	writes := []struct {
+		name     string
+		write    func() error
+		expected []kv.WriteOp
+	}{
+		{
+			"Save",
+			func() error { return metaKV.Save("hook/1", "v1") },
+			[]kv.WriteOp{{Type: kv.WriteOpSave, Keys: []string{"hook/1"}, Values: []string{"v1"}}},
+		},
+		{
+			"MultiSave",
+			func() error { return metaKV.MultiSave(map[string]string{"hook/2": "v2", "other/1": "v"}) },
+			[]kv.WriteOp{{Type: kv.WriteOpSave, Keys: []string{"hook/2"}, Values: []string{"v2"}}},
+		},
+		{
+			"Remove",
+			func() error { return metaKV.Remove("hook/1") },
+			[]kv.WriteOp{{Type: kv.WriteOpRemove, Keys: []string{"hook/1"}}},
+		},
+		{
+			"MultiRemove",
+			func() error { return metaKV.MultiRemove([]string{"hook/2", "other/1"}) },
+			[]kv.WriteOp{{Type: kv.WriteOpRemove, Keys: []string{"hook/2"}}},
+		},
+		{
+			"MultiSaveAndRemove",
+			func() error { return metaKV.MultiSaveAndRemove(map[string]string{"hook/3": "v3"}, []string{"hook/4"}) },
+			[]kv.WriteOp{
+				{Type: kv.WriteOpSave, Keys: []string{"hook/3"}, Values: []string{"v3"}},
+				{Type: kv.WriteOpRemove, Keys: []string{"hook/4"}},
+			},
+		},
+		{
+			"MultiSaveAndRemoveWithPrefix",
+			func() error {
+				return metaKV.MultiSaveAndRemoveWithPrefix(map[string]string{"hook/5": "v5"}, []string{"hook/sub"})
+			},
+			[]kv.WriteOp{
+				{Type: kv.WriteOpSave, Keys: []string{"hook/5"}, Values: []string{"v5"}},
+				{Type: kv.WriteOpRemoveWithPrefix, Prefix: "hook/sub"},
+			},
+		},
+		{
+			"MultiRemoveIfValue",
+			func() error {
+				_, _, err := metaKV.MultiRemoveIfValue(map[string]string{"hook/3": "v3", "hook/5": "stale"})
+				return err
+			},
+			[]kv.WriteOp{{Type: kv.WriteOpRemove, Keys: []string{"hook/3"}}},
+		},
+		{
+			"SaveWithVersionBump",
+			func() error {
+				_, err := metaKV.SaveWithVersionBump("hook/version", map[string]string{"hook/6": "v6"})
+				return err
+			},
+			[]kv.WriteOp{{Type: kv.WriteOpSave, Keys: []string{"hook/6", "hook/version"}, Values: []string{"v6", "1"}}},
+		},
+		{
+			"RemoveWithPrefix",
+			func() error { return metaKV.RemoveWithPrefix("hook") },
+			[]kv.WriteOp{{Type: kv.WriteOpRemoveWithPrefix, Prefix: "hook"}},
+		},
+	}
+	for _, test := range writes {
+		ops = nil
+		err = test.write()
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expected, ops, test.name)
+	}
+
+	// no notification on failed commit
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		return fmt.Errorf("bad txn commit!")
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+	ops = nil
+	err = metaKV.Save("hook/1", "v1")
+	assert.Error(t, err)
+	err = metaKV.MultiSave(map[string]string{"hook/1": "v1"})
+	assert.Error(t, err)
+	err = metaKV.Remove("hook/1")
+	assert.Error(t, err)
+	err = metaKV.MultiSaveAndRemove(map[string]string{"hook/1": "v1"}, []string{"hook/2"})
+	assert.Error(t, err)
+	assert.Empty(t, ops)
+}
+
+func TestAsyncRemoveWithPrefix(t *testing.T) {
+	metaKV := NewTiKV(txnClient, "/tikv/test/root/async_remove")
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	chunkSize, interval := kv.DeletionChunkSize, kv.DeletionChunkInterval
+	kv.DeletionChunkSize = 10
+	defer func() {
+		kv.DeletionChunkSize, kv.DeletionChunkInterval = chunkSize, interval
+	}()
+
+	prepare := func() {
+		kvs := make(map[string]string)
+		for i := 0; i < 35; i++ {
+			kvs[fmt.Sprintf("coll/%03d", i)] = "v"
+		}
+		kvs["other"] = "v"
+		err := metaKV.MultiSave(kvs)
+		require.NoError(t, err)
+	}
+	hasJournal := func() bool {
+		has, err := metaKV.HasPrefix(kv.DeletionJournalPrefix)
+		require.NoError(t, err)
+		return has
+	}
+
+	t.Run("complete", func(t *testing.T) {
+		prepare()
+		kv.DeletionChunkInterval = time.Millisecond
+		job, err := metaKV.AsyncRemoveWithPrefix("coll")
+		require.NoError(t, err)
+		<-job.Done()
+		assert.NoError(t, job.Err())
+		deleted, total := job.Progress()
+		assert.EqualValues(t, 35, deleted)
+		assert.EqualValues(t, 35, total)
+
+		has, err := metaKV.HasPrefix("coll")
+		assert.NoError(t, err)
+		assert.False(t, has)
+		has, err = metaKV.Has("other")
+		assert.NoError(t, err)
+		assert.True(t, has)
+		assert.False(t, hasJournal())
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		prepare()
+		// the keys of each chunk are told to the hooks once it's removed
+		var mu sync.Mutex
+		var ops []kv.WriteOp
+		hooked := true
+		metaKV.RegisterWriteHook("coll/", func(op kv.WriteOp) {
+			mu.Lock()
+			defer mu.Unlock()
+			if hooked {
+				ops = append(ops, op)
+			}
+		})
+		defer func() {
+			mu.Lock()
+			defer mu.Unlock()
+			hooked = false
+		}()
+		kv.DeletionChunkInterval = time.Hour
+		job, err := metaKV.AsyncRemoveWithPrefix("coll")
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			deleted, _ := job.Progress()
+			return deleted > 0
+		}, 10*time.Second, 10*time.Millisecond)
+		job.Cancel()
+		<-job.Done()
+		assert.ErrorIs(t, job.Err(), context.Canceled)
+
+		keys, _, err := metaKV.LoadWithPrefix("coll")
+		assert.NoError(t, err)
+		assert.Len(t, keys, 25)
+		assert.False(t, hasJournal())
+
+		mu.Lock()
+		defer mu.Unlock()
+		removed := make([]string, 0, 10)
+		for i := 0; i < 10; i++ {
+			removed = append(removed, fmt.Sprintf("coll/%03d", i))
+		}
+		assert.Equal(t, []kv.WriteOp{{Type: kv.WriteOpRemove, Keys: removed}}, ops)
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		prepare()
+		kv.DeletionChunkInterval = time.Millisecond
+		// interrupt the job after the first chunk
+		commits := 0
+		commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+			commits++
+			if commits > 1 {
+				return fmt.Errorf("bad txn commit!")
+			}
+			return tiTxnCommit(txn, ctx)
+		}
+		job, err := metaKV.AsyncRemoveWithPrefix("coll")
+		require.NoError(t, err)
+		<-job.Done()
+		commitTxn = tiTxnCommit
+		assert.Error(t, job.Err())
+		assert.True(t, hasJournal())
+
+		// restarted kv picks up the job from journal
+		restarted := NewTiKV(txnClient, "/tikv/test/root/async_remove")
+		jobs, err := restarted.ResumeDeletionJobs()
+		require.NoError(t, err)
+		require.Len(t, jobs, 1)
+		assert.Equal(t, "coll", jobs[0].Prefix())
+		<-jobs[0].Done()
+		assert.NoError(t, jobs[0].Err())
+
+		has, err := metaKV.HasPrefix("coll")
+		assert.NoError(t, err)
+		assert.False(t, has)
+		assert.False(t, hasJournal())
+	})
+}
+
+func TestFindOrphans(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/orphans")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	// segment-index/<segmentID>/<buildID> references segment/<segmentID>
+	err = kv.MultiSave(map[string]string{
+		"segment/1":          "s1",
+		"segment/2":          "s2",
+		"segment/3":          "s3",
+		"segment-index/1/1":  "b1",
+		"segment-index/2/2":  "b2",
+		"segment-index/2/3":  "b3",
+		"segment-index/3/4":  "b4",
+		"segment-index/meta": "not a reference",
+	})
+	require.NoError(t, err)
+	err = kv.Remove("segment/2")
+	require.NoError(t, err)
+
+	extractSegmentID := func(key string) string {
+		parts := strings.Split(key, "/")
+		if len(parts) != 3 {
+			return ""
+		}
+		return parts[1]
+	}
+	orphans, err := kv.FindOrphans("segment-index/", "segment", extractSegmentID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"segment-index/2/2", "segment-index/2/3"}, orphans)
+
+	// check in multiple batches
+	scanSize := SnapshotScanSize
+	SnapshotScanSize = 1
+	defer func() {
+		SnapshotScanSize = scanSize
+	}()
+	orphans, err = kv.FindOrphans("segment-index/", "segment", extractSegmentID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"segment-index/2/2", "segment-index/2/3"}, orphans)
+
+	orphans, err = kv.FindOrphans("missing/", "segment", extractSegmentID)
+	assert.NoError(t, err)
+	assert.Empty(t, orphans)
+}
+
+func TestMigrateLegacyValues(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/legacy")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	// values written before ValueHeader is introduced
+	saveLegacy := func(kvs map[string][]byte) {
+		txn, err := beginTxn(txnClient)
+		require.NoError(t, err)
+		for key, value := range kvs {
+			err = txn.Set([]byte(kv.GetPath(key)), value)
+			require.NoError(t, err)
+		}
+		err = commitTxn(txn, context.Background())
+		require.NoError(t, err)
+	}
+	legacy := make(map[string][]byte)
+	for i := 0; i < 5; i++ {
+		legacy[fmt.Sprintf("meta/empty%d", i)] = EmptyValueByte
+		legacy[fmt.Sprintf("meta/value%d", i)] = []byte(fmt.Sprintf("v%d", i))
+	}
+	saveLegacy(legacy)
+	// the values are written in the legacy encoding until WriteValueHeader is enabled
+	err = kv.MultiSave(map[string]string{"meta/new0": "", "meta/new1": "n1"})
+	require.NoError(t, err)
+	legacy["meta/new0"] = EmptyValueByte
+	legacy["meta/new1"] = []byte("n1")
+
+	// legacy values are readable
+	val, err := kv.Load("meta/empty0")
+	assert.NoError(t, err)
+	assert.Equal(t, "", val)
+	val, err = kv.Load("meta/value1")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", val)
+	val, err = kv.Load("meta/new0")
+	assert.NoError(t, err)
+	assert.Equal(t, "", val)
+
+	keys, err := kv.ScanLegacyValues("meta")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, maps.Keys(legacy), keys)
+
+	// nothing is migrated while the legacy encoding is written
+	_, _, err = kv.MigrateLegacyValues("meta", 3)
+	assert.Error(t, err)
+
+	WriteValueHeader = true
+	defer func() {
+		WriteValueHeader = Params.TiKVCfg.WriteValueHeader.GetAsBool()
+	}()
+
+	// concurrent writers update and remove legacy keys before the first batch commits
+	beginTxn = func(txn *txnkv.Client) (*transaction.KVTxn, error) {
+		beginTxn = tiTxnBegin
+		require.NoError(t, kv.Save("meta/empty1", "updated"))
+		require.NoError(t, kv.Remove("meta/empty2"))
+		return tiTxnBegin(txn)
+	}
+	defer func() {
+		beginTxn = tiTxnBegin
+	}()
+	migrated, skipped, err := kv.MigrateLegacyValues("meta", 3)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"meta/empty1", "meta/empty2"}, skipped)
+	assert.Len(t, migrated, 10)
+
+	keys, err = kv.ScanLegacyValues("meta")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	// values are unchanged except for the concurrent writes
+	delete(legacy, "meta/empty2")
+	legacy["meta/empty1"] = []byte("updated")
+	for key, value := range legacy {
+		if bytes.Equal(value, EmptyValueByte) {
+			value = nil
+		}
+		val, err = kv.Load(key)
+		assert.NoError(t, err)
+		assert.Equal(t, string(value), val)
+	}
+
+	// migration converges
+	migrated, skipped, err = kv.MigrateLegacyValues("meta", 3)
+	assert.NoError(t, err)
+	assert.Empty(t, migrated)
+	assert.Empty(t, skipped)
+
+	_, _, err = kv.MigrateLegacyValues("meta", 0)
+	assert.Error(t, err)
+}
+
+func TestWriteValueHeader(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/write_value_header")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	stored := func(key string) []byte {
+		value, err := txnClient.GetSnapshot(MaxSnapshotTS).Get(context.Background(), []byte(kv.GetPath(key)))
+		require.NoError(t, err)
+		return value
+	}
+
+	// the legacy encoding by default, readable by the nodes not knowing ValueHeader
+	assert.False(t, WriteValueHeader)
+	err = kv.MultiSave(map[string]string{"value": "v", "empty": ""})
+	assert.NoError(t, err)
+	err = kv.SaveBytes("bytes", []byte{0})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v"), stored("value"))
+	assert.Equal(t, EmptyValueByte, stored("empty"))
+	assert.Equal(t, []byte{0}, stored("bytes"))
+	val, err := kv.Load("empty")
+	assert.NoError(t, err)
+	assert.Equal(t, "", val)
+	// the values read as the values with the header are rejected
+	err = kv.Save("header", ValueHeader+"v")
+	assert.Error(t, err)
+	err = kv.SaveBytes("header", []byte(ValueHeader))
+	assert.Error(t, err)
+	err = kv.Save("reserved", EmptyValueString)
+	assert.Error(t, err)
+
+	WriteValueHeader = true
+	defer func() {
+		WriteValueHeader = Params.TiKVCfg.WriteValueHeader.GetAsBool()
+	}()
+	err = kv.MultiSave(map[string]string{"value": "v", "empty": ""})
+	assert.NoError(t, err)
+	err = kv.Save("header", ValueHeader+"v")
+	assert.NoError(t, err)
+	assert.Equal(t, encodeValue("v"), stored("value"))
+	assert.Equal(t, plainValueHeaderByte, stored("empty"))
+	assert.Equal(t, encodeValue(ValueHeader+"v"), stored("header"))
+	val, err = kv.Load("header")
+	assert.NoError(t, err)
+	assert.Equal(t, ValueHeader+"v", val)
+	// the sentinel is a value like any other with the header
+	err = kv.Save("reserved", EmptyValueString)
+	assert.NoError(t, err)
+	val, err = kv.Load("reserved")
+	assert.NoError(t, err)
+	assert.Equal(t, EmptyValueString, val)
+}
+
+func TestMultiSaveStream(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/stream")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	const count = 500
+	pairs := func(yield func(string, string) bool) {
+		for i := 0; i < count; i++ {
+			if !yield(fmt.Sprintf("stream/key%03d", i), fmt.Sprintf("value%03d", i)) {
+				return
+			}
+		}
+	}
+
+	commits := 0
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		commits++
+		return tiTxnCommit(txn, ctx)
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+
+	// each pair takes 22 bytes, so 10 pairs per batch
+	err = kv.MultiSaveStream(context.Background(), pairs, 220)
+	assert.NoError(t, err)
+	assert.Equal(t, count/10, commits)
+
+	keys, values, err := kv.LoadWithPrefix("stream")
+	assert.NoError(t, err)
+	assert.Len(t, keys, count)
+	for i := range keys {
+		assert.Equal(t, fmt.Sprintf("value%03d", i), values[i])
+	}
+
+	// batches committed before a failure are kept
+	err = kv.RemoveWithPrefix("stream")
+	require.NoError(t, err)
+	commits = 0
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		commits++
+		if commits > 2 {
+			return errors.New("mock commit error")
+		}
+		return tiTxnCommit(txn, ctx)
+	}
+	err = kv.MultiSaveStream(context.Background(), pairs, 220)
+	assert.Error(t, err)
+	assert.Equal(t, 3, commits)
+	keys, _, err = kv.LoadWithPrefix("stream")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 20)
+
+	// canceled context stops consuming pairs
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = kv.MultiSaveStream(ctx, pairs, 220)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = kv.MultiSaveStream(context.Background(), pairs, 0)
+	assert.Error(t, err)
+
+	// the batches are bounded by tikv.maxTxnOps too
+	commits = 0
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		commits++
+		return tiTxnCommit(txn, ctx)
+	}
+	Params.Save(Params.TiKVCfg.MaxTxnOps.Key, "4")
+	err = kv.MultiSaveStream(context.Background(), pairs, 220)
+	Params.Reset(Params.TiKVCfg.MaxTxnOps.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, count/4, commits)
+
+	// a value too large fails its batch
+	Params.Save(Params.TiKVCfg.TxnEntrySizeLimit.Key, "1024")
+	err = kv.MultiSaveStream(context.Background(), func(yield func(string, string) bool) {
+		yield("stream/large", strings.Repeat("v", 1024))
+	}, 220)
+	Params.Reset(Params.TiKVCfg.TxnEntrySizeLimit.Key)
+	tooLarge := &ErrValueTooLarge{}
+	assert.ErrorAs(t, err, &tooLarge)
+
+	// a conflicted batch is retried
+	commits = 0
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		commits++
+		if commits == 1 {
+			return &tikverr.ErrWriteConflict{WriteConflict: &kvrpcpb.WriteConflict{Key: []byte("key")}}
+		}
+		return tiTxnCommit(txn, ctx)
+	}
+	err = kv.MultiSaveStream(context.Background(), func(yield func(string, string) bool) {
+		yield("stream/conflicted", "value")
+	}, 220)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, commits)
+	value, err := kv.Load("stream/conflicted")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+}
+
+func TestMultiSaveChunked(t *testing.T) {
+	rootPath := "/tikv/test/root/chunked"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	const count = 25
+	saves := make(map[string]string, count)
+	keys := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		saves[key] = fmt.Sprintf("value%02d", i)
+		keys = append(keys, key)
+	}
+
+	commits := 0
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		commits++
+		return tiTxnCommit(txn, ctx)
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+
+	err = metaKV.MultiSaveChunked(saves, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, commits)
+	loaded, values, err := metaKV.LoadWithPrefix("key")
+	assert.NoError(t, err)
+	assert.Len(t, loaded, count)
+	for i := range loaded {
+		assert.Equal(t, fmt.Sprintf("value%02d", i), values[i])
+	}
+
+	// chunks are bounded by tikv.maxTxnOps too
+	Params.Save(Params.TiKVCfg.MaxTxnOps.Key, "5")
+	commits = 0
+	err = metaKV.MultiSaveChunked(saves, 10, 0)
+	Params.Reset(Params.TiKVCfg.MaxTxnOps.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, commits)
+
+	// bounded by bytes, each pair takes len("/tikv/test/root/chunked/key00") plus the stored "value00"
+	pairSize := len(path.Join(rootPath, "key00")) + storedValueSize("value00")
+	storedValue := func(value string) []byte {
+		stored, err := convertEmptyStringToByte(value)
+		require.NoError(t, err)
+		return stored
+	}
+	chunks := metaKV.splitSaves(map[string][]byte{
+		path.Join(rootPath, "key00"): storedValue("value00"),
+		path.Join(rootPath, "key01"): storedValue("value01"),
+		path.Join(rootPath, "key02"): storedValue("value02"),
+	}, 0, 2*pairSize)
+	assert.Equal(t, [][]string{
+		{path.Join(rootPath, "key00"), path.Join(rootPath, "key01")},
+		{path.Join(rootPath, "key02")},
+	}, chunks)
+	// a pair larger than maxBytes is committed alone
+	assert.Len(t, metaKV.splitSaves(map[string][]byte{"a": []byte("value"), "b": []byte("value")}, 0, 1), 2)
+	// not split without limits
+	assert.Len(t, metaKV.splitSaves(map[string][]byte{"a": []byte("value"), "b": []byte("value")}, 0, 0), 1)
+
+	// the third chunk fails, the chunks before it are kept
+	err = metaKV.RemoveWithPrefix("key")
+	require.NoError(t, err)
+	commits = 0
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		commits++
+		if commits == 3 {
+			return errors.New("mock commit error")
+		}
+		return tiTxnCommit(txn, ctx)
+	}
+	var ops []kv.WriteOp
+	metaKV.RegisterWriteHook("", func(op kv.WriteOp) {
+		ops = append(ops, op)
+	})
+	err = metaKV.MultiSaveChunked(saves, 0, 8*pairSize)
+	var partial *ErrPartialSave
+	require.ErrorAs(t, err, &partial)
+	assert.Equal(t, 2, partial.CommittedChunks)
+	assert.Equal(t, 4, partial.TotalChunks)
+	assert.Equal(t, keys[:16], partial.Saved)
+	assert.Equal(t, "key16", partial.FirstKey)
+	assert.Equal(t, "key23", partial.LastKey)
+	assert.ErrorContains(t, err, "chunk 3 of 4, keys [key16, key23]")
+	assert.ErrorContains(t, err, "mock commit error")
+	assert.Equal(t, 3, commits)
+	assert.Len(t, ops, 2)
+	loaded, _, err = metaKV.LoadWithPrefix("key")
+	assert.NoError(t, err)
+	assert.Len(t, loaded, 16)
+
+	// a single chunk fails like MultiSave
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		return errors.New("mock commit error")
+	}
+	err = metaKV.MultiSaveChunked(saves, 0, 0)
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &partial))
+
+	err = metaKV.MultiSaveChunked(saves, -1, 0)
+	assert.Error(t, err)
+}
+
+func TestMaxTxnOps(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/maxops")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	saves := map[string]string{"k1": "v1", "k2": "v2", "k3": "v3"}
+
+	// no limit by default
+	err = kv.MultiSave(saves)
+	assert.NoError(t, err)
+
+	Params.Save(Params.TiKVCfg.MaxTxnOps.Key, "3")
+	defer Params.Reset(Params.TiKVCfg.MaxTxnOps.Key)
+
+	err = kv.MultiSave(saves)
+	assert.NoError(t, err)
+
+	tooMany := map[string]string{"k4": "v4", "k5": "v5", "k6": "v6", "k7": "v7"}
+	err = kv.MultiSave(tooMany)
+	var tooManyOps *ErrTooManyOps
+	assert.ErrorAs(t, err, &tooManyOps)
+	assert.Equal(t, 4, tooManyOps.Count)
+	assert.Equal(t, 3, tooManyOps.Limit)
+
+	err = kv.MultiSaveAndRemove(map[string]string{"k4": "v4", "k5": "v5"}, []string{"k1", "k2"})
+	assert.ErrorAs(t, err, &tooManyOps)
+	assert.Equal(t, 4, tooManyOps.Count)
+
+	// nothing is written or removed
+	keys, _, err := kv.LoadWithPrefix("")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+
+	err = kv.MultiSaveAndRemove(map[string]string{"k4": "v4"}, []string{"k1", "k2"})
+	assert.NoError(t, err)
+}
+
+func TestTxnEntrySizeLimit(t *testing.T) {
+	rootPath := "/tikv/test/root/entry_size"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	Params.Save(Params.TiKVCfg.TxnEntrySizeLimit.Key, "1024")
+	defer Params.Reset(Params.TiKVCfg.TxnEntrySizeLimit.Key)
+	WriteValueHeader = true
+	defer func() {
+		WriteValueHeader = Params.TiKVCfg.WriteValueHeader.GetAsBool()
+	}()
+
+	// the stored value has the value header, and the key takes its share of the limit
+	fullKey := metaKV.GetPath("key")
+	limit := 1024 - len(fullKey)
+	largest := strings.Repeat("a", limit-len(plainValueHeaderByte))
+	tooLarge := largest + "a"
+
+	writes := []struct {
+		op    string
+		write func(value string) error
+	}{
+		{"Save", func(value string) error { return metaKV.Save("key", value) }},
+		{"MultiSave", func(value string) error { return metaKV.MultiSave(map[string]string{"key": value, "small": "v"}) }},
+		{"MultiSaveBytes", func(value string) error {
+			return metaKV.MultiSaveBytes(map[string][]byte{"key": []byte(value)})
+		}},
+		{"MultiSaveAndRemove", func(value string) error {
+			return metaKV.MultiSaveAndRemove(map[string]string{"key": value}, []string{"small"})
+		}},
+		{"MultiSaveAndRemoveWithPrefix", func(value string) error {
+			return metaKV.MultiSaveAndRemoveWithPrefix(map[string]string{"key": value}, []string{"small"})
+		}},
+		{"MultiSaveAndRemoveWithPrevValues", func(value string) error {
+			_, err := metaKV.MultiSaveAndRemoveWithPrevValues(map[string]string{"key": value}, []string{"small"})
+			return err
+		}},
+	}
+	for _, w := range writes {
+		t.Run(w.op, func(t *testing.T) {
+			require.NoError(t, metaKV.RemoveWithPrefix(""))
+			err := w.write(largest)
+			assert.NoError(t, err)
+			value, err := metaKV.Load("key")
+			assert.NoError(t, err)
+			assert.Equal(t, largest, value)
+
+			// the value is rejected before a transaction starts
+			beginTxn = func(txn *txnkv.Client) (*transaction.KVTxn, error) {
+				return nil, errors.New("mock begin")
+			}
+			defer func() {
+				beginTxn = tiTxnBegin
+			}()
+			err = w.write(tooLarge)
+			var tooLargeErr *ErrValueTooLarge
+			if assert.ErrorAs(t, err, &tooLargeErr) {
+				assert.Equal(t, fullKey, tooLargeErr.Key)
+				assert.Equal(t, limit+1, tooLargeErr.Size)
+				assert.Equal(t, limit, tooLargeErr.Limit)
+			}
+			assert.NotErrorIs(t, err, ErrTxnBegin)
+			assert.ErrorContains(t, err, fmt.Sprintf("key %s is too large, size: %d, limit: %d", fullKey, limit+1, limit))
+			beginTxn = tiTxnBegin
+
+			value, err = metaKV.Load("key")
+			assert.NoError(t, err)
+			assert.Equal(t, largest, value)
+		})
+	}
+
+	// 0 disables the check
+	Params.Save(Params.TiKVCfg.TxnEntrySizeLimit.Key, "0")
+	err = metaKV.Save("key", tooLarge)
+	assert.NoError(t, err)
+}
+
+func TestAppendToList(t *testing.T) {
+	// each of the concurrent appends could lose to all the others
+	kv := NewTiKV(txnClient, "/tikv/test/root/list", WithConflictRetry(100, time.Millisecond))
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	const count = 20
+	wg := sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			element := fmt.Sprintf("binlog%d", i)
+			// appending the same element twice keeps only one
+			assert.NoError(t, kv.AppendToList("list", element, 0))
+			assert.NoError(t, kv.AppendToList("list", element, 0))
+		}(i)
+	}
+	wg.Wait()
+
+	val, err := kv.Load("list")
+	assert.NoError(t, err)
+	elements := DecodeList(val)
+	assert.Len(t, elements, count)
+	for i := 0; i < count; i++ {
+		assert.Contains(t, elements, fmt.Sprintf("binlog%d", i))
+	}
+
+	// max length
+	err = kv.AppendToList("bounded", "a", 2)
+	assert.NoError(t, err)
+	err = kv.AppendToList("bounded", "b", 2)
+	assert.NoError(t, err)
+	err = kv.AppendToList("bounded", "a", 2)
+	assert.NoError(t, err)
+	err = kv.AppendToList("bounded", "c", 2)
+	assert.ErrorIs(t, err, ErrListFull)
+	val, err = kv.Load("bounded")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, DecodeList(val))
+
+	err = kv.AppendToList("bounded", "", 0)
+	assert.Error(t, err)
+	err = kv.AppendToList("bounded", "x\ny", 0)
+	assert.Error(t, err)
+}
+
+func TestReplicaRead(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		modes []tikv.ReplicaReadType
+	)
+	getSnapshot = func(txn *txnkv.Client, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+		mu.Lock()
+		modes = append(modes, replicaRead)
+		mu.Unlock()
+		return tiTxnSnapshot(txn, paginationSize, replicaRead)
+	}
+	defer func() {
+		getSnapshot = tiTxnSnapshot
+	}()
+	takeModes := func() []tikv.ReplicaReadType {
+		mu.Lock()
+		defer mu.Unlock()
+		result := modes
+		modes = nil
+		return result
+	}
+	allOf := func(mode tikv.ReplicaReadType, n int) []tikv.ReplicaReadType {
+		result := make([]tikv.ReplicaReadType, n)
+		for i := range result {
+			result[i] = mode
+		}
+		return result
+	}
+	walk := func(key, value []byte) error { return nil }
+
+	kv := NewTiKV(txnClient, "/tikv/test/root/replicaread", WithReplicaRead(tikv.ReplicaReadFollower))
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	err = kv.MultiSave(map[string]string{"key1": "value1", "key2": "value2"})
+	require.NoError(t, err)
+	takeModes()
+
+	// per instance
+	val, err := kv.Load("key1")
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", val)
+	has, err := kv.Has("key2")
+	assert.NoError(t, err)
+	assert.True(t, has)
+	keys, _, err := kv.LoadWithPrefix("key")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	err = kv.WalkWithPrefix("key", 1, walk)
+	assert.NoError(t, err)
+	assert.Equal(t, allOf(tikv.ReplicaReadFollower, 4), takeModes())
+
+	// write paths read from leaders
+	err = kv.MultiSaveAndRemove(map[string]string{"key3": "value3"}, nil, predicates.ValueEqual("key1", "value1"))
+	assert.NoError(t, err)
+	WriteValueHeader = true
+	_, _, err = kv.MigrateLegacyValues("", 10)
+	assert.NoError(t, err)
+	WriteValueHeader = Params.TiKVCfg.WriteValueHeader.GetAsBool()
+	_, err = kv.FindOrphans("key", "target", func(key string) string { return key })
+	assert.NoError(t, err)
+	writeModes := takeModes()
+	assert.NotEmpty(t, writeModes)
+	assert.Equal(t, allOf(tikv.ReplicaReadLeader, len(writeModes)), writeModes)
+
+	// per call
+	kv = NewTiKV(txnClient, "/tikv/test/root/replicaread")
+	reader := kv.WithReplicaRead(tikv.ReplicaReadMixed)
+	val, err = reader.Load("key1")
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", val)
+	has, err = reader.Has("key3")
+	assert.NoError(t, err)
+	assert.True(t, has)
+	keys, _, err = reader.LoadWithPrefix("key")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+	err = reader.WalkWithPrefix("key", 1, walk)
+	assert.NoError(t, err)
+	assert.Equal(t, allOf(tikv.ReplicaReadMixed, 4), takeModes())
+
+	_, err = kv.Load("key1")
+	assert.NoError(t, err)
+	assert.Equal(t, []tikv.ReplicaReadType{tikv.ReplicaReadLeader}, takeModes())
+}
+
+func TestLargeValueReport(t *testing.T) {
+	metaKV := NewTiKV(txnClient, "/tikv/test/root/largevalue")
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	kv.SetLargeValueSampling(2, 1024)
+	defer kv.SetLargeValueSampling(10, 64*1024)
+
+	findValue := func(key string) *kv.LargeValue {
+		for _, value := range kv.GetLargeValueReport() {
+			if value.Key == metaKV.GetPath(key) {
+				return &value
+			}
+		}
+		return nil
+	}
+
+	err = metaKV.Save("small", "value")
+	assert.NoError(t, err)
+	err = metaKV.Save("large", strings.Repeat("v", 2048))
+	assert.NoError(t, err)
+	assert.Nil(t, findValue("small"))
+	value := findValue("large")
+	require.NotNil(t, value)
+	assert.Equal(t, kv.LargeValueOpSave, value.Op)
+	assert.GreaterOrEqual(t, value.Size, 2048)
+
+	_, err = metaKV.Load("large")
+	assert.NoError(t, err)
+	assert.Equal(t, kv.LargeValueOpLoad, findValue("large").Op)
+
+	_, _, err = metaKV.LoadWithPrefix("")
+	assert.NoError(t, err)
+	assert.Equal(t, kv.LargeValueOpScan, findValue("large").Op)
+}
+
+func TestMultiRemoveSplit(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/removesplit", WithMultiRemoveSplit(10, 0))
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	saves := make(map[string]string)
+	keys := make([]string, 0, 35)
+	for i := 0; i < 35; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		saves[key] = "value"
+		keys = append(keys, key)
+	}
+
+	commits := 0
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		commits++
+		return tiTxnCommit(txn, ctx)
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+
+	err = kv.MultiSave(saves)
+	require.NoError(t, err)
+	commits = 0
+	err = kv.MultiRemove(keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, commits)
+	loaded, _, err := kv.LoadWithPrefix("key")
+	assert.NoError(t, err)
+	assert.Empty(t, loaded)
+
+	// the third batch fails
+	err = kv.MultiSave(saves)
+	require.NoError(t, err)
+	commits = 0
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		commits++
+		if commits == 3 {
+			return errors.New("mock commit error")
+		}
+		return tiTxnCommit(txn, ctx)
+	}
+	err = kv.MultiRemove(keys)
+	var partial *ErrPartialRemove
+	require.ErrorAs(t, err, &partial)
+	assert.Equal(t, 2, partial.CommittedBatches)
+	assert.Equal(t, 4, partial.TotalBatches)
+	assert.Equal(t, keys[:20], partial.Removed)
+	assert.Equal(t, 3, commits)
+	loaded, _, err = kv.LoadWithPrefix("key")
+	assert.NoError(t, err)
+	assert.Len(t, loaded, 15)
+
+	// bounded by bytes, each key takes len("/tikv/test/root/removesplit/key00") bytes
+	kv = NewTiKV(txnClient, "/tikv/test/root/removesplit", WithMultiRemoveSplit(0, 33*3))
+	batches := kv.splitRemoval(keys)
+	assert.Len(t, batches, 12)
+	assert.Equal(t, keys[:3], batches[0])
+	assert.Equal(t, keys[33:], batches[11])
+
+	// not split by default
+	kv = NewTiKV(txnClient, "/tikv/test/root/removesplit")
+	assert.Len(t, kv.splitRemoval(keys), 1)
+}
+
+func TestSelfTest(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/selftest")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	// real meta is not touched
+	err = kv.Save("meta", "value")
+	require.NoError(t, err)
+
+	report, err := kv.SelfTest(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, report.Passed())
+	assert.Len(t, report.Results, 5)
+	for _, result := range report.Results {
+		assert.NoError(t, result.Err)
+		assert.Greater(t, result.Latency, time.Duration(0), result.Name)
+	}
+	t.Log(report.String())
+
+	keys, values, err := kv.LoadWithPrefix("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{kv.GetPath("meta")}, keys)
+	assert.Equal(t, []string{"value"}, values)
+
+	// failures are reported
+	kv.SetReadOnly(true)
+	report, err = kv.SelfTest(context.Background())
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.False(t, report.Passed())
+	require.Len(t, report.Results, 1)
+	assert.Equal(t, "Save", report.Results[0].Name)
+	kv.SetReadOnly(false)
+}
+
+func TestSingleFlightLoad(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/singleflight", WithSingleFlightLoad())
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	err = kv.Save("hot", "value")
+	require.NoError(t, err)
+
+	gets := atomic.NewInt32(0)
+	release := make(chan struct{})
+	getSnapshot = func(txn *txnkv.Client, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+		if gets.Inc() == 1 {
+			<-release
+		}
+		return tiTxnSnapshot(txn, paginationSize, replicaRead)
+	}
+	defer func() {
+		getSnapshot = tiTxnSnapshot
+	}()
+
+	const n = 100
+	wg := sync.WaitGroup{}
+	values := make([]string, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], errs[i] = kv.Load("hot")
+		}(i)
+	}
+	assert.Eventually(t, func() bool { return gets.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	// let the other loads join the read in flight
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.EqualValues(t, 1, gets.Load())
+	for i := 0; i < n; i++ {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, "value", values[i])
+	}
+
+	// a load after a write does not join the read started before it
+	gets.Store(0)
+	release = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = kv.Load("hot")
+	}()
+	assert.Eventually(t, func() bool { return gets.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	err = kv.Save("hot", "new value")
+	assert.NoError(t, err)
+	value, err := kv.Load("hot")
+	assert.NoError(t, err)
+	assert.Equal(t, "new value", value)
+	assert.EqualValues(t, 2, gets.Load())
+	close(release)
+	<-done
+
+	// a load joining the read of a canceled view reads again under its own context
+	gets.Store(0)
+	release = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := kv.WithContext(ctx).Load("hot")
+		leaderErr <- err
+	}()
+	assert.Eventually(t, func() bool { return gets.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	followerValue := make(chan string, 1)
+	go func() {
+		value, err := kv.Load("hot")
+		assert.NoError(t, err)
+		followerValue <- value
+	}()
+	// let the live load join the read in flight
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	close(release)
+	assert.ErrorIs(t, <-leaderErr, context.Canceled)
+	assert.Equal(t, "new value", <-followerValue)
+	assert.EqualValues(t, 2, gets.Load())
+
+	_, err = kv.Load("missing")
+	assert.True(t, common.IsKeyNotExistError(err))
+}
+
+func TestLoadWithMaxStaleness(t *testing.T) {
+	kv := NewTiKV(txnClient, "/tikv/test/root/staleness")
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	var tss []uint64
+	getStaleSnapshot = func(txn *txnkv.Client, ts uint64, paginationSize int) *txnsnapshot.KVSnapshot {
+		tss = append(tss, ts)
+		return tiTxnStaleSnapshot(txn, ts, paginationSize)
+	}
+	defer func() {
+		getStaleSnapshot = tiTxnStaleSnapshot
+	}()
+
+	t.Run("ts", func(t *testing.T) {
+		now := time.Now()
+		ts := staleReadTS(now, 5*time.Second)
+		assert.Equal(t, now.Add(-5*time.Second).UnixMilli(), oracle.GetTimeFromTS(ts).UnixMilli())
+		assert.Less(t, ts, oracle.GoTimeToTS(now))
+	})
+
+	key := fmt.Sprintf("key-%d", time.Now().UnixNano())
+	err = kv.MultiSave(map[string]string{key: "value", path.Join("prefix", key): "value"})
+	require.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+
+	t.Run("stale read", func(t *testing.T) {
+		tss = nil
+		before := time.Now()
+		value, err := kv.LoadWithMaxStaleness(key, 100*time.Millisecond)
+		assert.NoError(t, err)
+		assert.Equal(t, StaleValue("value"), value)
+		require.Len(t, tss, 1)
+		readAt := oracle.GetTimeFromTS(tss[0])
+		assert.False(t, readAt.Before(before.Add(-100*time.Millisecond).Truncate(time.Millisecond)))
+		assert.True(t, readAt.Before(time.Now().Add(-100*time.Millisecond)))
+
+		// the key did not exist 10s ago
+		_, err = kv.LoadWithMaxStaleness(key, 10*time.Second)
+		assert.True(t, common.IsKeyNotExistError(err))
+
+		keys, values, err := kv.LoadWithPrefixAndMaxStaleness("prefix", 100*time.Millisecond)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{kv.GetPath(path.Join("prefix", key))}, keys)
+		assert.Equal(t, []StaleValue{"value"}, values)
+		keys, values, err = kv.LoadWithPrefixAndMaxStaleness("prefix", 10*time.Second)
+		assert.NoError(t, err)
+		assert.Empty(t, keys)
+		assert.Empty(t, values)
+
+		_, err = kv.LoadWithMaxStaleness(key, 0)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		getStaleSnapshot = func(txn *txnkv.Client, ts uint64, paginationSize int) *txnsnapshot.KVSnapshot {
+			ss := tiTxnStaleSnapshot(txn, ts, paginationSize)
+			// the stale read is rejected, e.g. the replica is not ready
+			keyErr := &kvrpcpb.KeyError{Abort: "mock stale read rejected"}
+			ss.SetRPCInterceptor(func(next interceptor.RPCInterceptorFunc) interceptor.RPCInterceptorFunc {
+				return func(target string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+					switch req.Type {
+					case tikvrpc.CmdGet:
+						return &tikvrpc.Response{Resp: &kvrpcpb.GetResponse{Error: keyErr}}, nil
+					case tikvrpc.CmdScan:
+						return &tikvrpc.Response{Resp: &kvrpcpb.ScanResponse{Error: keyErr}}, nil
+					default:
+						return next(target, req)
+					}
+				}
+			})
+			return ss
+		}
+		err = kv.Save(key, "new value")
+		require.NoError(t, err)
+		value, err := kv.LoadWithMaxStaleness(key, 10*time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, StaleValue("new value"), value)
+
+		keys, values, err := kv.LoadWithPrefixAndMaxStaleness("prefix", 10*time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{kv.GetPath(path.Join("prefix", key))}, keys)
+		assert.Equal(t, []StaleValue{"value"}, values)
+	})
+}
+
+func TestLoadWithPrefixConcurrent(t *testing.T) {
+	if txnCluster == nil {
+		t.Skip("regions could only be split on the mock cluster")
+	}
+	rootPath := "/tikv/test/root/concurrent_scan"
+	kv := NewTiKV(txnClient, rootPath)
+	err := kv.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer kv.Close()
+	defer kv.RemoveWithPrefix("")
+
+	const n = 2000
+	for i := 0; i < n; i += 500 {
+		kvs := make(map[string]string)
+		for j := i; j < i+500; j++ {
+			kvs[fmt.Sprintf("prefix/key%05d", j)] = fmt.Sprintf("value%d", j)
+		}
+		require.NoError(t, kv.MultiSave(kvs))
+	}
+	require.NoError(t, kv.Save("other/key", "value"))
+	txnCluster.SplitKeys([]byte(rootPath), tikv.PrefixNextKey([]byte(rootPath)), 8)
+
+	ranges, err := kv.splitByRegion(txnClient, []byte(kv.GetPath("prefix")), tikv.PrefixNextKey([]byte(kv.GetPath("prefix"))))
+	require.NoError(t, err)
+	assert.Greater(t, len(ranges), 4)
+
+	SnapshotScanSize = 100
+	defer func() {
+		SnapshotScanSize = Params.TiKVCfg.SnapshotScanSize.GetAsInt()
+	}()
+	// each scan request takes a while as a remote TiKV
+	getSnapshot = func(txn *txnkv.Client, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+		ss := tiTxnSnapshot(txn, paginationSize, replicaRead)
+		ss.SetRPCInterceptor(func(next interceptor.RPCInterceptorFunc) interceptor.RPCInterceptorFunc {
+			return func(target string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+				if req.Type == tikvrpc.CmdScan {
+					time.Sleep(10 * time.Millisecond)
+				}
+				return next(target, req)
+			}
+		})
+		return ss
+	}
+	defer func() {
+		getSnapshot = tiTxnSnapshot
+	}()
+
+	start := time.Now()
+	expectedKeys, expectedValues, err := kv.LoadWithPrefix("prefix")
+	require.NoError(t, err)
+	sequential := time.Since(start)
+	assert.Len(t, expectedKeys, n)
+
+	start = time.Now()
+	keys, values, err := kv.LoadWithPrefixConcurrent("prefix", 4)
+	require.NoError(t, err)
+	concurrent := time.Since(start)
+	assert.Equal(t, expectedKeys, keys)
+	assert.Equal(t, expectedValues, values)
+	assert.Less(t, concurrent, sequential)
+	t.Logf("%d regions, sequential: %s, concurrent: %s", len(ranges), sequential, concurrent)
+
+	keys, values, err = kv.LoadWithPrefixConcurrent("", 1)
+	require.NoError(t, err)
+	assert.Len(t, keys, n+1)
+	assert.Len(t, values, n+1)
+
+	keys, _, err = kv.LoadWithPrefixConcurrent("missing", 4)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	_, _, err = kv.LoadWithPrefixConcurrent("prefix", 0)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+	// the first failed scan stops the scans of the other regions
+	corrupted := append(append([]byte{}, compressedValueHeaderByte...), "corrupted"...)
+	err = kv.putStoredValue(context.Background(), kv.GetPath("prefix/key00000"), corrupted)
+	require.NoError(t, err)
+	var scans atomic.Int32
+	getSnapshot = func(txn *txnkv.Client, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+		ss := tiTxnSnapshot(txn, paginationSize, replicaRead)
+		ss.SetRPCInterceptor(func(next interceptor.RPCInterceptorFunc) interceptor.RPCInterceptorFunc {
+			return func(target string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+				if req.Type == tikvrpc.CmdScan {
+					scans.Inc()
+				}
+				return next(target, req)
+			}
+		})
+		return ss
+	}
+	_, _, err = kv.LoadWithPrefixConcurrent("prefix", 1)
+	assert.ErrorIs(t, err, ErrCorruptedValue)
+	assert.Less(t, int(scans.Load()), len(ranges))
+}
+
+func TestRedaction(t *testing.T) {
+	rootPath := "/tikv/test/root/redaction"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	require.NoError(t, kv.SetRedactionRules([]string{"credential/"}, nil))
+	defer kv.ResetRedactionRules()
+
+	const secret = "s3cr3t-password"
+	require.NoError(t, metaKV.Save("credential/root", secret))
+	require.NoError(t, metaKV.Save("collection/1", "plain-value"))
+
+	t.Run("log", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger, props, err := log.InitLoggerWithWriteSyncer(&log.Config{Level: "info"}, zapcore.AddSync(buf))
+		require.NoError(t, err)
+		log.ReplaceGlobals(logger, props)
+		defer func() {
+			logger, props, _ := log.InitLogger(&log.Config{Level: "info"})
+			log.ReplaceGlobals(logger, props)
+		}()
+
+		metaKV.SetReadOnly(true)
+		defer metaKV.SetReadOnly(false)
+		assert.Error(t, metaKV.Save("credential/root", "another-secret"))
+		assert.Error(t, metaKV.Save("collection/1", "another-plain-value"))
+
+		output := buf.String()
+		assert.NotContains(t, output, "another-secret")
+		assert.Contains(t, output, "<redacted:14 bytes>")
+		assert.Contains(t, output, "another-plain-value")
+	})
+
+	t.Run("error", func(t *testing.T) {
+		err := metaKV.MultiSaveAndRemove(map[string]string{"collection/1": "new-value"}, nil,
+			predicates.ValueEqual("credential/root", "wrong-password"))
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), "wrong-password")
+		assert.Contains(t, err.Error(), "<redacted:14 bytes>")
+	})
+
+	t.Run("export", func(t *testing.T) {
+		export := func(includeSensitive bool) []kv.ExportEntry {
+			file := filepath.Join(t.TempDir(), "export.json")
+			f, err := os.Create(file)
+			require.NoError(t, err)
+			require.NoError(t, kv.ExportWithPrefix(f, metaKV, "", 10, includeSensitive))
+			require.NoError(t, f.Close())
+
+			content, err := os.ReadFile(file)
+			require.NoError(t, err)
+			var entries []kv.ExportEntry
+			for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+				var entry kv.ExportEntry
+				require.NoError(t, json.Unmarshal([]byte(line), &entry))
+				entries = append(entries, entry)
+			}
+			return entries
+		}
+
+		assert.Equal(t, []kv.ExportEntry{
+			{Key: metaKV.GetPath("collection/1"), Value: "plain-value"},
+			{Key: metaKV.GetPath("credential/root"), Value: "<redacted:15 bytes>"},
+		}, export(false))
+		assert.Equal(t, []kv.ExportEntry{
+			{Key: metaKV.GetPath("collection/1"), Value: "plain-value"},
+			{Key: metaKV.GetPath("credential/root"), Value: secret},
+		}, export(true))
+	})
+}
+
+func TestRedactionMultiSaveLog(t *testing.T) {
+	rootPath := "/tikv/test/root/redaction_multi_save"
+	metaKV := NewTiKV(txnClient, rootPath)
+	defer metaKV.Close()
+
+	buf := &bytes.Buffer{}
+	logger, props, err := log.InitLoggerWithWriteSyncer(&log.Config{Level: "info"}, zapcore.AddSync(buf))
+	require.NoError(t, err)
+	log.ReplaceGlobals(logger, props)
+	defer func() {
+		logger, props, _ := log.InitLogger(&log.Config{Level: "info"})
+		log.ReplaceGlobals(logger, props)
+	}()
+
+	// the credentials are redacted by the default rules
+	metaKV.SetReadOnly(true)
+	defer metaKV.SetReadOnly(false)
+	err = metaKV.MultiSave(map[string]string{
+		"root-coord/credential/users/root": "password-hash",
+		"root-coord/collection/1":          "plain-value",
+	})
+	assert.Error(t, err)
+
+	output := buf.String()
+	assert.Contains(t, output, "txnTiKV MultiSave() error")
+	assert.NotContains(t, output, "password-hash")
+	assert.Contains(t, output, "<redacted:13 bytes>")
+	assert.Contains(t, output, "plain-value")
+}
+
+func TestOpError(t *testing.T) {
+	rootPath := "/tikv/test/root/op_error"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	_, err = metaKV.Load("missing")
+	var opErr *kv.OpError
+	require.ErrorAs(t, err, &opErr)
+	assert.Equal(t, "Load", opErr.Op)
+	assert.Equal(t, "missing", opErr.Key)
+	assert.Equal(t, 1, opErr.KeyCount)
+	assert.Equal(t, rootPath, opErr.RootPath)
+	assert.True(t, common.IsKeyNotExistError(err))
+
+	// the errors of the client are kept in the chain
+	errMock := errors.New("mock commit error")
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		return errMock
+	}
+	err = metaKV.MultiSave(map[string]string{"k1": "v1", "k2": "v2"})
+	commitTxn = tiTxnCommit
+	require.ErrorAs(t, err, &opErr)
+	assert.Equal(t, "MultiSave", opErr.Op)
+	assert.Empty(t, opErr.Key)
+	assert.Equal(t, 2, opErr.KeyCount)
+	assert.ErrorIs(t, err, errMock)
+
+	Params.Save(Params.TiKVCfg.MaxTxnOps.Key, "1")
+	err = metaKV.MultiSaveAndRemove(map[string]string{"k1": "v1"}, []string{"k2"})
+	Params.Reset(Params.TiKVCfg.MaxTxnOps.Key)
+	require.ErrorAs(t, err, &opErr)
+	assert.Equal(t, "MultiSaveAndRemove", opErr.Op)
+	var tooManyOps *ErrTooManyOps
+	assert.ErrorAs(t, err, &tooManyOps)
+
+	metaKV.SetReadOnly(true)
+	err = metaKV.RemoveWithPrefix("prefix")
+	metaKV.SetReadOnly(false)
+	require.ErrorAs(t, err, &opErr)
+	assert.Equal(t, "RemoveWithPrefix", opErr.Op)
+	assert.Equal(t, "prefix", opErr.Key)
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	// the replica reader wraps its errors as well
+	_, err = metaKV.WithReplicaRead(tikv.ReplicaReadFollower).Load("missing")
+	require.ErrorAs(t, err, &opErr)
+	assert.Equal(t, "Load", opErr.Op)
+	assert.True(t, common.IsKeyNotExistError(err))
+}
+
+// nextWatchEvents takes n events from w, failing the test if they don't arrive in time.
+func nextWatchEvents(t *testing.T, w *Watcher, n int) []WatchEvent {
+	events := make([]WatchEvent, 0, n)
+	for len(events) < n {
+		select {
+		case event, ok := <-w.Events():
+			require.True(t, ok)
+			events = append(events, event)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no watch event", "got %d of %d events", len(events), n)
+		}
+	}
+	return events
+}
+
+func sortedWatchEvents(events []WatchEvent) []WatchEvent {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
+
+func TestWatchWithPrefix(t *testing.T) {
+	rootPath := "/tikv/test/root/watch_with_prefix"
+	failScan := atomic.NewBool(false)
+	// the polls read at the TS of the poll
+	getSnapshotAt = func(txn *txnkv.Client, ts uint64, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+		ss := tiTxnSnapshotAt(txn, ts, paginationSize, replicaRead)
+		ss.SetRPCInterceptor(func(next interceptor.RPCInterceptorFunc) interceptor.RPCInterceptorFunc {
+			return func(target string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+				if req.Type == tikvrpc.CmdScan && failScan.Load() {
+					return &tikvrpc.Response{Resp: &kvrpcpb.ScanResponse{Error: &kvrpcpb.KeyError{Abort: "mock scan error"}}}, nil
+				}
+				return next(target, req)
+			}
+		})
+		return ss
+	}
+	defer func() {
+		getSnapshotAt = tiTxnSnapshotAt
+	}()
+
+	metaKV := NewTiKV(txnClient, rootPath, WithWatchInterval(10*time.Millisecond), WithVersionedPrefixes(""))
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	err = metaKV.Save("watch/existing", "v0")
+	require.NoError(t, err)
+	w, err := metaKV.WatchWithPrefix("watch/")
+	require.NoError(t, err)
+	defer w.Close()
+
+	err = metaKV.Save("watch/1", "v1")
+	require.NoError(t, err)
+	err = metaKV.Save("other/1", "v1")
+	require.NoError(t, err)
+	events := nextWatchEvents(t, w, 1)
+	assert.Equal(t, WatchEvent{Type: WatchEventPut, Key: "watch/1", Value: "v1"}, events[0])
+
+	err = metaKV.Save("watch/1", "v2")
+	require.NoError(t, err)
+	events = nextWatchEvents(t, w, 1)
+	assert.Equal(t, WatchEvent{Type: WatchEventPut, Key: "watch/1", Value: "v2", PrevValue: "v1"}, events[0])
+	err = metaKV.Save("watch/1", "v2")
+	require.NoError(t, err)
+	events = nextWatchEvents(t, w, 1)
+	assert.Equal(t, WatchEvent{Type: WatchEventPut, Key: "watch/1", Value: "v2", PrevValue: "v2"}, events[0])
+
+	err = metaKV.Remove("watch/existing")
+	require.NoError(t, err)
+	events = nextWatchEvents(t, w, 1)
+	assert.Equal(t, WatchEvent{Type: WatchEventDelete, Key: "watch/existing", PrevValue: "v0"}, events[0])
+
+	// many changes between two polls are all delivered, with a slow consumer too
+	saves := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		saves[fmt.Sprintf("watch/many/%03d", i)] = "v"
+	}
+	err = metaKV.MultiSave(saves)
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	events = sortedWatchEvents(nextWatchEvents(t, w, 100))
+	for i, event := range events {
+		assert.Equal(t, WatchEvent{Type: WatchEventPut, Key: fmt.Sprintf("watch/many/%03d", i), Value: "v"}, event)
+	}
+
+	err = metaKV.RemoveWithPrefix("watch/many/")
+	require.NoError(t, err)
+	events = sortedWatchEvents(nextWatchEvents(t, w, 100))
+	for i, event := range events {
+		assert.Equal(t, WatchEvent{Type: WatchEventDelete, Key: fmt.Sprintf("watch/many/%03d", i), PrevValue: "v"}, event)
+	}
+
+	// the changes during failed polls are delivered once by the next successful one
+	failScan.Store(true)
+	err = metaKV.Save("watch/2", "v2")
+	require.NoError(t, err)
+	err = metaKV.Remove("watch/1")
+	require.NoError(t, err)
+	select {
+	case event := <-w.Events():
+		assert.FailNow(t, "unexpected watch event", "%v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+	failScan.Store(false)
+	events = nextWatchEvents(t, w, 2)
+	assert.Equal(t, []WatchEvent{
+		{Type: WatchEventDelete, Key: "watch/1", PrevValue: "v2"},
+		{Type: WatchEventPut, Key: "watch/2", Value: "v2"},
+	}, events)
+	select {
+	case event := <-w.Events():
+		assert.FailNow(t, "unexpected watch event", "%v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Close stops the poller and closes the channel
+	w.Close()
+	w.Close()
+	_, ok := <-w.Events()
+	assert.False(t, ok)
+
+	// the initial scan must succeed
+	failScan.Store(true)
+	_, err = metaKV.WatchWithPrefix("watch/")
+	assert.Error(t, err)
+}
+
+func TestWatch(t *testing.T) {
+	rootPath := "/tikv/test/root/watch"
+	metaKV := NewTiKV(txnClient, rootPath, WithWatchInterval(10*time.Millisecond), WithVersionedPrefixes(""))
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	w, err := metaKV.Watch("key")
+	require.NoError(t, err)
+	defer w.Close()
+
+	err = metaKV.Save("key2", "v")
+	require.NoError(t, err)
+	err = metaKV.Save("key", "")
+	require.NoError(t, err)
+	events := nextWatchEvents(t, w, 1)
+	assert.Equal(t, WatchEvent{Type: WatchEventPut, Key: "key"}, events[0])
+
+	err = metaKV.Save("key", "v1")
+	require.NoError(t, err)
+	events = nextWatchEvents(t, w, 1)
+	assert.Equal(t, WatchEvent{Type: WatchEventPut, Key: "key", Value: "v1"}, events[0])
+
+	// saving the same value again changes the version
+	err = metaKV.Save("key", "v1")
+	require.NoError(t, err)
+	events = nextWatchEvents(t, w, 1)
+	assert.Equal(t, WatchEvent{Type: WatchEventPut, Key: "key", Value: "v1", PrevValue: "v1"}, events[0])
+
+	err = metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+	events = nextWatchEvents(t, w, 1)
+	assert.Equal(t, WatchEvent{Type: WatchEventDelete, Key: "key", PrevValue: "v1"}, events[0])
+
+	// Close of the instance closes the watchers
+	closedKV := NewTiKV(txnClient, rootPath, WithWatchInterval(10*time.Millisecond))
+	w1, err := closedKV.Watch("key")
+	require.NoError(t, err)
+	w2, err := closedKV.WatchWithPrefix("")
+	require.NoError(t, err)
+	w2.Close()
+	closedKV.Close()
+	for _, w := range []*Watcher{w1, w2} {
+		_, ok := <-w.Events()
+		assert.False(t, ok)
+		w.Close()
+	}
+	_, err = closedKV.Watch("key")
+	assert.Error(t, err)
+}
+
+func TestWithCommitTimeout(t *testing.T) {
+	rootPath := "/tikv/test/root/with_commit_timeout"
+	metaKV := NewTiKV(txnClient, rootPath, WithCommitTimeout(time.Second))
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	// each commit takes a while, unless the deadline is exceeded first
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return tiTxnCommit(txn, ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+
+	// the commit timeout replaces the deadline of the operation
+	err = metaKV.WithTimeout(10*time.Millisecond).Save("key", "value")
+	assert.NoError(t, err)
+	err = metaKV.WithTimeout(10 * time.Millisecond).MultiSave(map[string]string{"key1": "value1", "key2": "value2"})
+	assert.NoError(t, err)
+	err = metaKV.WithTimeout(10 * time.Millisecond).Remove("key")
+	assert.NoError(t, err)
+	err = NewTiKV(txnClient, rootPath).WithTimeout(10*time.Millisecond).Save("key", "value")
+	assert.ErrorIs(t, err, ErrCommitTimeout)
+
+	shortKV := NewTiKV(txnClient, rootPath, WithCommitTimeout(10*time.Millisecond))
+	err = shortKV.MultiSave(map[string]string{"key1": "value3", "key2": "value4"})
+	assert.ErrorIs(t, err, ErrCommitTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, ErrCommitConflict)
+
+	// the context of the caller still stops the commit
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = metaKV.WithContext(ctx).Save("key", "value")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrCommitTimeout)
+
+	// a conflict is told apart from a timeout
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		return &tikverr.ErrWriteConflict{WriteConflict: &kvrpcpb.WriteConflict{Key: []byte("key")}}
+	}
+	err = metaKV.Save("key", "value")
+	assert.ErrorIs(t, err, ErrCommitConflict)
+	assert.ErrorIs(t, err, ErrTxnConflict)
+	assert.ErrorIs(t, err, ErrTxnCommit)
+	assert.NotErrorIs(t, err, ErrCommitTimeout)
+	assert.True(t, tikverr.IsErrWriteConflict(err))
+
+	commitTxn = tiTxnCommit
+	values, err := metaKV.MultiLoad([]string{"key1", "key2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"value1", "value2"}, values)
+}
+
+func TestConflictRetry(t *testing.T) {
+	rootPath := "/tikv/test/root/conflict_retry"
+	metaKV := NewTiKV(txnClient, rootPath, WithConflictRetry(2, time.Millisecond))
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	// the first commits up to conflicts conflict, the others go through
+	conflicts, attempts := 0, 0
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		attempts++
+		if attempts <= conflicts {
+			return &tikverr.ErrWriteConflict{WriteConflict: &kvrpcpb.WriteConflict{Key: []byte("key")}}
+		}
+		return tiTxnCommit(txn, ctx)
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+	reset := func(n int) {
+		conflicts, attempts = n, 0
+	}
+
+	// the conflicted writes are retried
+	reset(2)
+	err = metaKV.Save("key", "value")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	reset(2)
+	err = metaKV.MultiSave(map[string]string{"key1": "value1", "key2": "value2"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	reset(1)
+	err = metaKV.MultiSaveAndRemove(map[string]string{"key3": "value3"}, []string{"key1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	reset(1)
+	err = metaKV.MultiSaveAndRemoveWithPrefix(map[string]string{"pre/key4": "value4"}, []string{"key3"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	reset(1)
+	err = metaKV.MultiRemove([]string{"key2"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	keys, values, err := metaKV.LoadWithPrefix("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{path.Join(rootPath, "key"), path.Join(rootPath, "pre/key4")}, keys)
+	assert.Equal(t, []string{"value", "value4"}, values)
+
+	// the writes still conflicted after the retries return ErrConflictRetriesExhausted
+	reset(3)
+	err = metaKV.MultiSave(map[string]string{"key1": "value5"})
+	exhausted := &ErrConflictRetriesExhausted{}
+	assert.ErrorAs(t, err, &exhausted)
+	assert.Equal(t, 3, exhausted.Attempts)
+	assert.ErrorIs(t, err, ErrCommitConflict)
+	assert.True(t, tikverr.IsErrWriteConflict(err))
+	assert.Equal(t, 3, attempts)
+
+	// the retries are disabled by 0
+	reset(1)
+	err = NewTiKV(txnClient, rootPath, WithConflictRetry(0, time.Millisecond)).Save("key", "value6")
+	assert.ErrorIs(t, err, ErrCommitConflict)
+	assert.False(t, errors.As(err, &exhausted))
+	assert.Equal(t, 1, attempts)
+
+	// the commits finding their locks resolved are retried too
+	lockNotFound := &tikverr.ErrRetryable{Retryable: "Error(Txn(Error(Mvcc(Error(TxnLockNotFound { start_ts: 1, commit_ts: 2, key: [] })))))"}
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		attempts++
+		if attempts <= conflicts {
+			return lockNotFound
+		}
+		return tiTxnCommit(txn, ctx)
+	}
+	reset(1)
+	err = metaKV.MultiSaveAndRemove(map[string]string{"key3": "value3"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	reset(3)
+	err = metaKV.Save("key3", "value8")
+	assert.ErrorAs(t, err, &exhausted)
+	assert.ErrorIs(t, err, ErrTxnLockNotFound)
+	assert.NotErrorIs(t, err, ErrCommitConflict)
+	err = metaKV.Remove("key3")
+	assert.NoError(t, err)
+
+	// the other errors are not retried
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		attempts++
+		return errors.New("mock commit error")
+	}
+	reset(0)
+	err = metaKV.Save("key", "value7")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrCommitConflict)
+	assert.Equal(t, 1, attempts)
+
+	commitTxn = tiTxnCommit
+	value, err := metaKV.Load("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+	_, err = metaKV.Load("key1")
+	assert.True(t, common.IsKeyNotExistError(err))
+}
+
+func TestConflictRetryPredicates(t *testing.T) {
+	rootPath := "/tikv/test/root/conflict_retry_predicates"
+	metaKV := NewTiKV(txnClient, rootPath, WithConflictRetry(3, time.Millisecond))
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	err = metaKV.Save("state", "initial")
+	require.NoError(t, err)
+
+	// the first commit conflicts with a concurrent write, which is committed
+	attempts := 0
+	concurrent := func() error { return nil }
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			if err := concurrent(); err != nil {
+				return err
+			}
+			return &tikverr.ErrWriteConflict{WriteConflict: &kvrpcpb.WriteConflict{Key: []byte("state")}}
+		}
+		return tiTxnCommit(txn, ctx)
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+
+	// the predicate still holds after the concurrent write, so the retry succeeds
+	concurrent = func() error {
+		return tiTxnSaveForTest(metaKV, "other", "value")
+	}
+	err = metaKV.MultiSaveAndRemove(map[string]string{"key": "value1"}, nil, predicates.ValueEqual("state", "initial"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	value, err := metaKV.Load("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", value)
+
+	// the concurrent write breaks the predicate, the retry checks it again and fails without committing
+	attempts = 0
+	concurrent = func() error {
+		return tiTxnSaveForTest(metaKV, "state", "changed")
+	}
+	err = metaKV.MultiSaveAndRemove(map[string]string{"key": "value2"}, []string{"other"}, predicates.ValueEqual("state", "initial"))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrCommitConflict)
+	assert.Equal(t, 1, attempts)
+	value, err = metaKV.Load("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", value)
+	has, err := metaKV.Has("other")
+	assert.NoError(t, err)
+	assert.True(t, has)
+
+	// a predicate which doesn't hold is never retried
+	attempts = 0
+	err = metaKV.MultiSaveAndRemoveWithPrefix(map[string]string{"key": "value3"}, nil, predicates.ValueEqual("state", "initial"))
+	assert.Error(t, err)
+	err = metaKV.MultiSaveBytesAndRemove(map[string][]byte{"key": []byte("value3")}, nil, predicates.ValueEqual("state", "initial"))
+	assert.Error(t, err)
+	assert.Equal(t, 0, attempts)
+	value, err = metaKV.Load("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", value)
+}
+
+// tiTxnSaveForTest saves key in a transaction of its own, bypassing the mocked commitTxn.
+func TestValueCompression(t *testing.T) {
+	rootPath := "/tikv/test/root/value_compression"
+	metaKV := NewTiKV(txnClient, rootPath, WithValueCompression(1024))
+	// the same root path without the compression
+	plainKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer plainKV.Close()
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	stored := func(key string) []byte {
+		value, err := txnClient.GetSnapshot(MaxSnapshotTS).Get(context.Background(), []byte(metaKV.GetPath(key)))
+		require.NoError(t, err)
+		return value
+	}
+	isCompressed := func(key string) bool {
+		return bytes.HasPrefix(stored(key), compressedValueHeaderByte)
+	}
+
+	large := strings.Repeat("segment meta ", 1<<16)
+	small := strings.Repeat("s", 100)
+	random := make([]byte, 4096)
+	_, err = rand.Read(random)
+	require.NoError(t, err)
+
+	err = metaKV.Save("large", large)
+	assert.NoError(t, err)
+	err = metaKV.MultiSave(map[string]string{"multi/large": large, "multi/small": small, "multi/empty": ""})
+	assert.NoError(t, err)
+	err = metaKV.SaveBytes("bytes/random", random)
+	assert.NoError(t, err)
+	err = metaKV.MultiSaveBytes(map[string][]byte{"bytes/large": []byte(large)})
+	assert.NoError(t, err)
+	// saved before the compression is enabled
+	err = plainKV.Save("plain", large)
+	assert.NoError(t, err)
+	// the other writes of the values go through the same compression
+	err = metaKV.MultiSaveAndRemoveWithPrefix(map[string]string{"prefix/large": large}, nil)
+	assert.NoError(t, err)
+	_, err = metaKV.SaveWithVersionBump("version", map[string]string{"bump/large": large})
+	assert.NoError(t, err)
+	versionedKV := NewTiKV(txnClient, rootPath, WithValueCompression(1024), WithVersionedPrefixes("cas"))
+	defer versionedKV.Close()
+	swapped, err := versionedKV.CompareVersionAndSwap("cas/large", 0, large)
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+
+	assert.True(t, isCompressed("prefix/large"))
+	assert.True(t, isCompressed("bump/large"))
+	assert.True(t, isCompressed("cas/large"))
+	assert.True(t, isCompressed("large"))
+	assert.Less(t, len(stored("large")), len(large)/10)
+	assert.True(t, isCompressed("multi/large"))
+	assert.True(t, isCompressed("bytes/large"))
+	// the small values and the values not getting smaller are stored as they are, in the legacy
+	// encoding as WriteValueHeader is disabled
+	assert.Equal(t, []byte(small), stored("multi/small"))
+	assert.Equal(t, EmptyValueByte, stored("multi/empty"))
+	assert.Equal(t, random, stored("bytes/random"))
+	assert.Equal(t, []byte(large), stored("plain"))
+
+	expected := map[string]string{
+		"large": large, "multi/large": large, "multi/small": small, "multi/empty": "",
+		"bytes/random": string(random), "bytes/large": large, "plain": large,
+		"prefix/large": large, "bump/large": large, "version": "1", "cas/large": large,
+	}
+	// the compressed and uncompressed values are read alike, with the compression or not
+	for _, reader := range []*txnTiKV{metaKV, plainKV} {
+		for key, value := range expected {
+			actual, err := reader.Load(key)
+			assert.NoError(t, err)
+			assert.Equal(t, value, actual, "key: %s", key)
+			actualBytes, err := reader.LoadBytes(key)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(value), actualBytes, "key: %s", key)
+		}
+
+		keys, values, err := reader.LoadWithPrefix("")
+		assert.NoError(t, err)
+		assert.Len(t, keys, len(expected))
+		for i, key := range keys {
+			assert.Equal(t, expected[reader.relativeKey(key)], values[i], "key: %s", key)
+		}
+
+		walked := 0
+		err = reader.WalkWithPrefix("", 2, func(key []byte, value []byte) error {
+			walked++
+			assert.Equal(t, expected[reader.relativeKey(string(key))], string(value), "key: %s", key)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, len(expected), walked)
+
+		values, err = reader.MultiLoad([]string{"large", "multi/small", "plain"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{large, small, large}, values)
+	}
+
+	// the predicates compare the decompressed values
+	err = metaKV.MultiSaveAndRemove(map[string]string{"multi/small": "updated"}, nil, predicates.ValueEqual("large", large))
+	assert.NoError(t, err)
+	value, err := metaKV.Load("multi/small")
+	assert.NoError(t, err)
+	assert.Equal(t, "updated", value)
+
+	// a value starting with the tag of the compressed values is stored as it is, in the legacy
+	// encoding or after plainValueTag, and not read as compressed
+	reserved := string(compressedValueTag) + "value"
+	err = metaKV.Save("reserved", reserved)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(reserved), stored("reserved"))
+	WriteValueHeader = true
+	defer func() {
+		WriteValueHeader = Params.TiKVCfg.WriteValueHeader.GetAsBool()
+	}()
+	err = plainKV.SaveBytes("reserved", []byte(reserved))
+	assert.NoError(t, err)
+	assert.Equal(t, encodeValue(reserved), stored("reserved"))
+	for _, reader := range []*txnTiKV{metaKV, plainKV} {
+		value, err = reader.Load("reserved")
+		assert.NoError(t, err)
+		assert.Equal(t, reserved, value)
+	}
+
+	// a corrupted compressed value fails the reads
+	corrupted := append(append([]byte{}, compressedValueHeaderByte...), "corrupted"...)
+	_, err = decodeValue(corrupted)
+	assert.ErrorIs(t, err, ErrCorruptedValue)
+	txn, err := txnClient.Begin()
+	require.NoError(t, err)
+	require.NoError(t, txn.Set([]byte(metaKV.GetPath("corrupted")), corrupted))
+	require.NoError(t, txn.Commit(context.Background()))
+	_, err = metaKV.Load("corrupted")
+	assert.ErrorIs(t, err, ErrCorruptedValue)
+	_, err = metaKV.MultiLoad([]string{"large", "corrupted"})
+	assert.ErrorIs(t, err, ErrCorruptedValue)
+	_, _, err = metaKV.LoadWithPrefix("corrupted")
+	assert.ErrorIs(t, err, ErrCorruptedValue)
+}
+
+func TestReadView(t *testing.T) {
+	rootPath := "/tikv/test/root/read_view"
+	metaKV := NewTiKV(txnClient, rootPath, WithSingleFlightLoad())
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	err = metaKV.MultiSave(map[string]string{
+		"segment/1": "s1", "segment/2": "s2",
+		"replica/1": "r1",
+	})
+	require.NoError(t, err)
+
+	view, err := metaKV.ReadView()
+	require.NoError(t, err)
+	assert.NotZero(t, view.TS())
+
+	// the writes after the view is created
+	err = metaKV.MultiSaveAndRemove(map[string]string{"segment/1": "s1-new", "segment/3": "s3", "replica/1": "r1-new"}, []string{"segment/2"})
+	require.NoError(t, err)
+
+	value, err := view.Load("segment/1")
+	assert.NoError(t, err)
+	assert.Equal(t, "s1", value)
+	value, err = metaKV.Load("segment/1")
+	assert.NoError(t, err)
+	assert.Equal(t, "s1-new", value)
+
+	value, err = view.Load("segment/2")
+	assert.NoError(t, err)
+	assert.Equal(t, "s2", value)
+	_, err = view.Load("segment/3")
+	assert.True(t, common.IsKeyNotExistError(err))
+
+	values, err := view.MultiLoad([]string{"segment/1", "segment/2", "replica/1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"s1", "s2", "r1"}, values)
+	values, err = view.MultiLoad([]string{"replica/1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"r1"}, values)
+	values, err = metaKV.MultiLoad([]string{"segment/1", "segment/3", "replica/1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"s1-new", "s3", "r1-new"}, values)
+
+	keys, values, err := view.LoadWithPrefix("segment")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{metaKV.GetPath("segment/1"), metaKV.GetPath("segment/2")}, keys)
+	assert.Equal(t, []string{"s1", "s2"}, values)
+	keys, values, err = metaKV.LoadWithPrefix("segment")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{metaKV.GetPath("segment/1"), metaKV.GetPath("segment/3")}, keys)
+	assert.Equal(t, []string{"s1-new", "s3"}, values)
+
+	walked := make(map[string]string)
+	err = view.WalkWithPrefix("", 1, func(key []byte, value []byte) error {
+		walked[metaKV.relativeKey(string(key))] = string(value)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"segment/1": "s1", "segment/2": "s2", "replica/1": "r1"}, walked)
+
+	// a later view sees the writes
+	laterView, err := metaKV.ReadView()
+	require.NoError(t, err)
+	defer laterView.Close()
+	assert.Greater(t, laterView.TS(), view.TS())
+	value, err = laterView.Load("segment/1")
+	assert.NoError(t, err)
+	assert.Equal(t, "s1-new", value)
+
+	view.Close()
+	_, err = view.Load("segment/1")
+	assert.ErrorIs(t, err, ErrReadViewClosed)
+	_, err = view.MultiLoad([]string{"segment/1"})
+	assert.ErrorIs(t, err, ErrReadViewClosed)
+	_, _, err = view.LoadWithPrefix("segment")
+	assert.ErrorIs(t, err, ErrReadViewClosed)
+	err = view.WalkWithPrefix("segment", 1, func(key []byte, value []byte) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrReadViewClosed)
+	// the instance is not affected
+	value, err = metaKV.Load("segment/1")
+	assert.NoError(t, err)
+	assert.Equal(t, "s1-new", value)
+}
+
+func TestNewSnapshotReader(t *testing.T) {
+	rootPath := "/tikv/test/root/snapshot_reader"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	err = metaKV.MultiSave(map[string]string{"a/1": "v1", "a/2": "v2"})
+	require.NoError(t, err)
+	ts, err := metaKV.CurrentTS()
+	require.NoError(t, err)
+	assert.NotZero(t, ts)
+
+	err = metaKV.MultiSaveAndRemove(map[string]string{"a/1": "v1-new", "a/3": "v3"}, []string{"a/2"})
+	require.NoError(t, err)
+	later, err := metaKV.CurrentTS()
+	require.NoError(t, err)
+	assert.Greater(t, later, ts)
+
+	// the readers of a recorded TS read the same state whenever they're created
+	for i := 0; i < 2; i++ {
+		reader, err := metaKV.NewSnapshotReader(ts)
+		require.NoError(t, err)
+		assert.Equal(t, ts, reader.TS())
+		keys, values, err := reader.LoadWithPrefix("a")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{metaKV.GetPath("a/1"), metaKV.GetPath("a/2")}, keys)
+		assert.Equal(t, []string{"v1", "v2"}, values)
+		_, err = reader.Load("a/3")
+		assert.True(t, common.IsKeyNotExistError(err))
+		reader.Close()
+
+		err = metaKV.Save("a/1", fmt.Sprintf("v1-%d", i))
+		require.NoError(t, err)
+	}
+
+	reader, err := metaKV.NewSnapshotReader(later)
+	require.NoError(t, err)
+	defer reader.Close()
+	values, err := reader.MultiLoad([]string{"a/1", "a/3"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1-new", "v3"}, values)
+
+	_, err = metaKV.NewSnapshotReader(0)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestBeginTxn(t *testing.T) {
+	rootPath := "/tikv/test/root/begin_txn"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	var ops []kv.WriteOp
+	metaKV.RegisterWriteHook("", func(op kv.WriteOp) {
+		ops = append(ops, op)
+	})
+
+	err = metaKV.MultiSave(map[string]string{"balance/a": "10", "balance/b": "0", "stale": "v"})
+	require.NoError(t, err)
+	ops = nil
+
+	// read and then write several keys atomically
+	txn, err := metaKV.BeginTxn()
+	require.NoError(t, err)
+	value, err := txn.Get("balance/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", value)
+	_, err = txn.Get("balance/c")
+	assert.True(t, common.IsKeyNotExistError(err))
+	assert.NoError(t, txn.Put("balance/a", "0"))
+	assert.NoError(t, txn.Put("balance/c", ""))
+	assert.NoError(t, txn.Put("stale", "v1"))
+	assert.NoError(t, txn.Delete("stale"))
+	assert.NoError(t, txn.Delete("missing"))
+	// the transaction reads its own writes, the others don't see them before the commit
+	value, err = txn.Get("balance/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "0", value)
+	_, err = txn.Get("stale")
+	assert.True(t, common.IsKeyNotExistError(err))
+	value, err = metaKV.Load("balance/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", value)
+	assert.Error(t, txn.Put("balance/d", EmptyValueString))
+
+	assert.NoError(t, txn.Commit())
+	values, err := metaKV.MultiLoad([]string{"balance/a", "balance/b", "balance/c"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0", "0", ""}, values)
+	has, err := metaKV.Has("stale")
+	assert.NoError(t, err)
+	assert.False(t, has)
+	require.Len(t, ops, 2)
+	assert.Equal(t, kv.WriteOp{Type: kv.WriteOpSave, Keys: []string{"balance/a", "balance/c"}, Values: []string{"0", ""}}, ops[0])
+	assert.Equal(t, kv.WriteOpRemove, ops[1].Type)
+	assert.ElementsMatch(t, []string{"stale", "missing"}, ops[1].Keys)
+
+	// a finished transaction can't be used
+	_, err = txn.Get("balance/a")
+	assert.ErrorIs(t, err, ErrTxnFinished)
+	assert.ErrorIs(t, txn.Put("balance/a", "1"), ErrTxnFinished)
+	assert.ErrorIs(t, txn.Delete("balance/a"), ErrTxnFinished)
+	assert.ErrorIs(t, txn.Commit(), ErrTxnFinished)
+	txn.Rollback()
+
+	// the writes of a rolled back transaction are discarded
+	ops = nil
+	txn, err = metaKV.BeginTxn()
+	require.NoError(t, err)
+	assert.NoError(t, txn.Put("balance/a", "100"))
+	txn.Rollback()
+	txn.Rollback()
+	assert.ErrorIs(t, txn.Commit(), ErrTxnFinished)
+	value, err = metaKV.Load("balance/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "0", value)
+	assert.Empty(t, ops)
+
+	// a key written after BeginTxn conflicts with the commit, a key only read doesn't
+	txn, err = metaKV.BeginTxn()
+	require.NoError(t, err)
+	_, err = txn.Get("balance/b")
+	assert.NoError(t, err)
+	assert.NoError(t, txn.Put("balance/a", "1"))
+	err = metaKV.Save("balance/b", "5")
+	require.NoError(t, err)
+	assert.NoError(t, txn.Commit())
+
+	txn, err = metaKV.BeginTxn()
+	require.NoError(t, err)
+	assert.NoError(t, txn.Put("balance/a", "2"))
+	err = metaKV.Save("balance/a", "3")
+	require.NoError(t, err)
+	err = txn.Commit()
+	assert.ErrorIs(t, err, ErrCommitConflict)
+	value, err = metaKV.Load("balance/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", value)
+
+	// the hooks of the transactions inject the failures
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		return errors.New("mock commit error")
+	}
+	txn, err = metaKV.BeginTxn()
+	require.NoError(t, err)
+	assert.NoError(t, txn.Put("balance/a", "4"))
+	assert.Error(t, txn.Commit())
+	commitTxn = tiTxnCommit
+	value, err = metaKV.Load("balance/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", value)
+
+	beginTxn = func(txn *txnkv.Client) (*transaction.KVTxn, error) {
+		return nil, errors.New("mock begin error")
+	}
+	_, err = metaKV.BeginTxn()
+	assert.Error(t, err)
+	beginTxn = tiTxnBegin
+
+	// a read-only instance rejects the commits
+	metaKV.SetReadOnly(true)
+	txn, err = metaKV.BeginTxn()
+	require.NoError(t, err)
+	assert.NoError(t, txn.Put("balance/a", "5"))
+	assert.ErrorIs(t, txn.Commit(), ErrReadOnly)
+	metaKV.SetReadOnly(false)
+}
+
+func TestTracing(t *testing.T) {
+	rootPath := "/tikv/test/root/tracing"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(provider)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "DescribeCollection")
+	tracedKV := metaKV.WithContext(ctx)
+	err = tracedKV.MultiSaveAndRemove(map[string]string{"a": "1", "b": "22"}, []string{"c"})
+	assert.NoError(t, err)
+	_, err = tracedKV.Load("missing")
+	assert.Error(t, err)
+	beginTxn = func(txn *txnkv.Client) (*transaction.KVTxn, error) {
+		return nil, errors.New("mock begin error")
+	}
+	err = tracedKV.Save("a", "2")
+	assert.Error(t, err)
+	beginTxn = tiTxnBegin
+	parent.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	attributes := func(span sdktrace.ReadOnlySpan) map[string]attribute.Value {
+		res := make(map[string]attribute.Value)
+		for _, attr := range span.Attributes() {
+			res[string(attr.Key)] = attr.Value
+		}
+		return res
+	}
+	for _, name := range []string{"tikv.MultiSaveAndRemove", "tikv.Commit", "tikv.Load", "tikv.Save"} {
+		require.Contains(t, spans, name)
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+	}
+
+	span := spans["tikv.MultiSaveAndRemove"]
+	assert.Equal(t, codes.Ok, span.Status().Code)
+	assert.Equal(t, int64(3), attributes(span)["tikv.key_count"].AsInt64())
+	assert.Equal(t, rootPath, attributes(span)["tikv.root_path"].AsString())
+	assert.False(t, span.StartTime().After(spans["tikv.Commit"].StartTime()))
+
+	// the commit writes the values, without version sidecars as no prefix is versioned
+	span = spans["tikv.Commit"]
+	assert.Equal(t, codes.Ok, span.Status().Code)
+	assert.Equal(t, int64(3), attributes(span)["tikv.key_count"].AsInt64())
+	assert.Greater(t, attributes(span)["tikv.bytes_written"].AsInt64(), int64(len("1")+len("22")))
+
+	span = spans["tikv.Load"]
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Equal(t, int64(1), attributes(span)["tikv.key_count"].AsInt64())
+
+	span = spans["tikv.Save"]
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Contains(t, span.Status().Description, "mock begin error")
+	assert.Contains(t, span.Status().Description, "kv Save failed")
+}
+
+func tiTxnSaveForTest(metaKV *txnTiKV, key, value string) error {
+	client, release := metaKV.acquireClient()
+	defer release()
+	txn, err := client.Begin()
+	if err != nil {
+		return err
+	}
+	byteValue, err := convertEmptyStringToByte(value)
+	if err != nil {
+		return err
+	}
+	if err = txn.Set([]byte(path.Join(metaKV.rootPath, key)), byteValue); err != nil {
+		return err
+	}
+	return tiTxnCommit(txn, context.Background())
+}
+
+func TestWithTimeout(t *testing.T) {
+	rootPath := "/tikv/test/root/with_timeout"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	// each commit takes a while, unless the deadline is exceeded first
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return tiTxnCommit(txn, ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+
+	view := metaKV.WithTimeout(10 * time.Millisecond)
+	err = view.Save("key", "value")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = metaKV.Load("key")
+	assert.True(t, common.IsKeyNotExistError(err))
+
+	err = metaKV.Save("key", "value")
+	assert.NoError(t, err)
+	err = metaKV.WithTimeout(time.Second).Save("key", "value2")
+	assert.NoError(t, err)
+	value, err := view.Load("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value2", value)
+
+	// the view shares the state of the instance
+	var ops []kv.WriteOp
+	metaKV.RegisterWriteHook("", func(op kv.WriteOp) {
+		ops = append(ops, op)
+	})
+	err = metaKV.WithTimeout(time.Second).Remove("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []kv.WriteOp{{Type: kv.WriteOpRemove, Keys: []string{"key"}}}, ops)
+
+	metaKV.SetReadOnly(true)
+	defer metaKV.SetReadOnly(false)
+	err = view.Save("key", "value")
+	assert.ErrorIs(t, err, ErrReadOnly)
+}
+
+func TestBytesOperations(t *testing.T) {
+	rootPath := "/tikv/test/root/bytes_operations"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+	// a value starting with ValueHeader is rejected by the legacy encoding
+	WriteValueHeader = true
+	defer func() {
+		WriteValueHeader = Params.TiKVCfg.WriteValueHeader.GetAsBool()
+	}()
+
+	var ops []kv.WriteOp
+	metaKV.RegisterWriteHook("", func(op kv.WriteOp) {
+		ops = append(ops, op)
+	})
+
+	nul := []byte{'a', 0, 'b', 0}
+	invalidUTF8 := []byte{0xff, 0xfe, 0xc3, 0x28}
+	header := []byte(ValueHeader + "v")
+	assert.False(t, utf8.Valid(invalidUTF8))
+
+	err = metaKV.SaveBytes("nul", nul)
+	assert.NoError(t, err)
+	value, err := metaKV.LoadBytes("nul")
+	assert.NoError(t, err)
+	assert.Equal(t, nul, value)
+	// the string and the byte operations share the stored encoding
+	str, err := metaKV.Load("nul")
+	assert.NoError(t, err)
+	assert.Equal(t, string(nul), str)
+
+	err = metaKV.MultiSaveBytes(map[string][]byte{"utf8": invalidUTF8, "header": header, "empty": {}})
+	assert.NoError(t, err)
+	values, err := metaKV.MultiLoadBytes([]string{"utf8", "header", "empty", "nul"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{invalidUTF8, header, {}, nul}, values)
+	values, err = metaKV.MultiLoadBytes([]string{"missing", "utf8"})
+	assert.Error(t, err)
+	assert.Equal(t, [][]byte{nil, invalidUTF8}, values)
+
+	err = metaKV.Save("text", "value")
+	assert.NoError(t, err)
+	keys, values, err := metaKV.LoadBytesWithPrefix("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		path.Join(rootPath, "empty"), path.Join(rootPath, "header"), path.Join(rootPath, "nul"),
+		path.Join(rootPath, "text"), path.Join(rootPath, "utf8"),
+	}, keys)
+	assert.Equal(t, [][]byte{{}, header, nul, []byte("value"), invalidUTF8}, values)
+	// appending to a value doesn't overwrite the next one
+	_ = append(values[0], 'x')
+	assert.Equal(t, header, values[1])
+
+	err = metaKV.MultiSaveBytesAndRemove(map[string][]byte{"nul": invalidUTF8}, []string{"utf8"})
+	assert.NoError(t, err)
+	value, err = metaKV.LoadBytes("nul")
+	assert.NoError(t, err)
+	assert.Equal(t, invalidUTF8, value)
+	_, err = metaKV.LoadBytes("utf8")
+	assert.True(t, common.IsKeyNotExistError(err))
+
+	// the predicates are checked like MultiSaveAndRemove
+	err = metaKV.MultiSaveBytesAndRemove(map[string][]byte{"nul": nul}, nil, predicates.ValueEqual("text", "other"))
+	assert.Error(t, err)
+	value, err = metaKV.LoadBytes("nul")
+	assert.NoError(t, err)
+	assert.Equal(t, invalidUTF8, value)
+
+	// a nil value is saved as an empty one
+	err = metaKV.SaveBytes("nil", nil)
+	assert.NoError(t, err)
+	value, err = metaKV.LoadBytes("nil")
+	assert.NoError(t, err)
+	assert.NotNil(t, value)
+	assert.Empty(t, value)
+	str, err = metaKV.Load("nil")
+	assert.NoError(t, err)
+	assert.Equal(t, "", str)
+
+	// the reserved values are rejected by the legacy encoding, see TestValueRoundTrip for the header
+	WriteValueHeader = false
+	err = metaKV.SaveBytes("reserved", EmptyValueByte)
+	assert.Error(t, err)
+	err = metaKV.MultiSaveBytes(map[string][]byte{"reserved": []byte(ValueHeader)})
+	assert.Error(t, err)
+	err = metaKV.Save("reserved", ValueHeader+"value")
+	assert.Error(t, err)
+	WriteValueHeader = true
+	has, err := metaKV.Has("reserved")
+	assert.NoError(t, err)
+	assert.False(t, has)
+
+	assert.Equal(t, []kv.WriteOp{
+		{Type: kv.WriteOpSave, Keys: []string{"nul"}, Values: []string{string(nul)}},
+		{Type: kv.WriteOpSave, Keys: []string{"empty", "header", "utf8"}, Values: []string{"", string(header), string(invalidUTF8)}},
+		{Type: kv.WriteOpSave, Keys: []string{"text"}, Values: []string{"value"}},
+		{Type: kv.WriteOpSave, Keys: []string{"nul"}, Values: []string{string(invalidUTF8)}},
+		{Type: kv.WriteOpRemove, Keys: []string{"utf8"}},
+		{Type: kv.WriteOpSave, Keys: []string{"nil"}, Values: []string{""}},
+	}, ops)
+}
+
+func TestSaveWithTTL(t *testing.T) {
+	rootPath := "/tikv/test/root/save_with_ttl"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	clock := time.Now()
+	expirationClock = func() time.Time { return clock }
+	defer func() {
+		expirationClock = time.Now
+	}()
+
+	err = metaKV.SaveWithTTL("lease/1", "v1", 0)
+	assert.Error(t, err)
+	// the sentinel is a value like any other with a TTL
+	err = metaKV.SaveWithTTL("lease/sentinel", EmptyValueString, time.Minute)
+	assert.NoError(t, err)
+	sentinel, err := metaKV.Load("lease/sentinel")
+	assert.NoError(t, err)
+	assert.Equal(t, EmptyValueString, sentinel)
+	require.NoError(t, metaKV.Remove("lease/sentinel"))
+
+	err = metaKV.SaveWithTTL("lease/1", "v1", time.Minute)
+	assert.NoError(t, err)
+	err = metaKV.SaveWithTTL("lease/2", "", time.Hour)
+	assert.NoError(t, err)
+	err = metaKV.Save("lease/3", "v3")
+	assert.NoError(t, err)
+
+	value, err := metaKV.Load("lease/1")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", value)
+	value, err = metaKV.Load("lease/2")
+	assert.NoError(t, err)
+	assert.Equal(t, "", value)
+	// the values with a TTL have the header whether WriteValueHeader is enabled or not
+	legacy, err := metaKV.ScanLegacyValues("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lease/3"}, legacy)
+
+	// an expired key is absent to the reads
+	clock = clock.Add(time.Minute)
+	_, err = metaKV.Load("lease/1")
+	assert.True(t, common.IsKeyNotExistError(err))
+	has, err := metaKV.Has("lease/1")
+	assert.NoError(t, err)
+	assert.False(t, has)
+	has, err = metaKV.HasPrefix("lease/1")
+	assert.NoError(t, err)
+	assert.False(t, has)
+	has, err = metaKV.HasPrefix("lease/")
+	assert.NoError(t, err)
+	assert.True(t, has)
+	_, err = metaKV.MultiLoad([]string{"lease/1", "lease/2"})
+	assert.Error(t, err)
+	keys, values, err := metaKV.LoadWithPrefix("lease/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{metaKV.GetPath("lease/2"), metaKV.GetPath("lease/3")}, keys)
+	assert.Equal(t, []string{"", "v3"}, values)
+	keys, _, err = metaKV.LoadWithPrefixPage("lease/", 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{metaKV.GetPath("lease/3")}, keys)
+	walked := make([]string, 0)
+	err = metaKV.WalkWithPrefix("lease/", 10, func(k []byte, v []byte) error {
+		walked = append(walked, string(k))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{metaKV.GetPath("lease/2"), metaKV.GetPath("lease/3")}, walked)
+
+	// an expired lock could be taken again
+	swapped, err := metaKV.CompareValueAndSwap("lease/1", "v1", "owner")
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+	err = metaKV.SaveWithTTL("lease/4", "other", time.Second)
+	assert.NoError(t, err)
+	clock = clock.Add(time.Second)
+	swapped, err = metaKV.CompareValueAndSwap("lease/4", "", "owner")
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	value, err = metaKV.Load("lease/4")
+	assert.NoError(t, err)
+	assert.Equal(t, "owner", value)
+
+	// RemoveExpired removes the expired keys only
+	var ops []kv.WriteOp
+	metaKV.RegisterWriteHook("lease/", func(op kv.WriteOp) {
+		ops = append(ops, op)
+	})
+	err = metaKV.SaveWithTTL("lease/5", "v5", time.Second)
+	assert.NoError(t, err)
+	clock = clock.Add(time.Second)
+	removed, err := metaKV.RemoveExpired("lease/")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"lease/1", "lease/5"}, removed)
+	assert.Equal(t, kv.WriteOp{Type: kv.WriteOpRemove, Keys: removed}, ops[len(ops)-1])
+	keys, _, err = metaKV.WithContext(context.Background()).LoadWithPrefix("lease/")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+	removed, err = metaKV.RemoveExpired("lease/")
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+
+	// a key saved again after it's scanned is kept
+	err = metaKV.SaveWithTTL("lease/6", "v6", time.Second)
+	assert.NoError(t, err)
+	clock = clock.Add(time.Second)
+	expired, err := metaKV.scanExpired([]byte(metaKV.GetPath("lease/")), tikv.PrefixNextKey([]byte(metaKV.GetPath("lease/"))))
+	assert.NoError(t, err)
+	assert.Len(t, expired, 1)
+	err = metaKV.SaveWithTTL("lease/6", "v6", time.Hour)
+	assert.NoError(t, err)
+	removed, err = metaKV.removeExpired(expired)
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+	value, err = metaKV.Load("lease/6")
+	assert.NoError(t, err)
+	assert.Equal(t, "v6", value)
+
+	metaKV.SetReadOnly(true)
+	_, err = metaKV.RemoveExpired("lease/")
+	assert.ErrorIs(t, err, ErrReadOnly)
+	err = metaKV.SaveWithTTL("lease/7", "v7", time.Second)
+	assert.ErrorIs(t, err, ErrReadOnly)
+	metaKV.SetReadOnly(false)
+}
+
+// resetExpirationClock makes the expiration clock never synced, from no offset.
+func resetExpirationClock() {
+	pdClock.syncedAt.Store(0)
+	pdClock.judged.Store(false)
+	pdClock.offset.Store(0)
+}
+
+func TestExpirationClockSync(t *testing.T) {
+	rootPath := "/tikv/test/root/expiration_clock"
+	defer resetExpirationClock()
+	defer func() {
+		getTimestamp = tiGetTimestamp
+	}()
+
+	// the clock of PD is an hour ahead of the local one
+	var timestamps atomic.Int32
+	getTimestamp = func(ctx context.Context, txn *txnkv.Client) (uint64, error) {
+		timestamps.Inc()
+		return oracle.GoTimeToTS(time.Now().Add(time.Hour)), nil
+	}
+	resetExpirationClock()
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+	// neither NewTiKV nor the operations without a TTL ask PD
+	err = metaKV.Save("plain", "v")
+	require.NoError(t, err)
+	_, err = metaKV.Load("plain")
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, timestamps.Load())
+	assert.Zero(t, pdClock.offset.Load())
+
+	// the first judged TTL syncs the clock once the operation finishes
+	err = metaKV.putStoredValue(context.Background(), metaKV.GetPath("lease/judged"),
+		encodeValueWithTTL("v", time.Now().Add(30*time.Minute)))
+	require.NoError(t, err)
+	value, err := metaKV.Load("lease/judged")
+	assert.NoError(t, err)
+	assert.Equal(t, "v", value)
+	assert.EqualValues(t, 1, timestamps.Load())
+	assert.InDelta(t, time.Hour, pdClock.offset.Load(), float64(time.Second))
+
+	// a TTL is set and judged by the clock of PD
+	err = metaKV.SaveWithTTL("lease/pd", "v", 30*time.Minute)
+	require.NoError(t, err)
+	value, err = metaKV.Load("lease/pd")
+	assert.NoError(t, err)
+	assert.Equal(t, "v", value)
+
+	// a value expiring in 30 minutes by the local clock has expired by the clock of PD
+	localValue := encodeValueWithTTL("v", time.Now().Add(30*time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = metaKV.putStoredValue(ctx, metaKV.GetPath("lease/local"), localValue)
+	require.NoError(t, err)
+	_, err = metaKV.Load("lease/local")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	// the offset is not synced again within the interval
+	getTimestamp = func(ctx context.Context, txn *txnkv.Client) (uint64, error) {
+		return oracle.GoTimeToTS(time.Now()), nil
+	}
+	metaKV.syncExpirationClock()
+	assert.InDelta(t, time.Hour, pdClock.offset.Load(), float64(time.Second))
+
+	// without PD, the local clock is used
+	getTimestamp = func(ctx context.Context, txn *txnkv.Client) (uint64, error) {
+		return 0, errors.New("mock PD unavailable")
+	}
+	resetExpirationClock()
+	metaKV.syncExpirationClock()
+	assert.Zero(t, pdClock.offset.Load())
+	value, err = metaKV.Load("lease/local")
+	assert.NoError(t, err)
+	assert.Equal(t, "v", value)
+}
+
+func TestExpiredKeyReaper(t *testing.T) {
+	rootPath := "/tikv/test/root/expired_key_reaper"
+	metaKV := NewTiKV(txnClient, rootPath, WithExpiredKeyReaper(10*time.Millisecond))
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+	defer metaKV.RemoveWithPrefix("")
+
+	err = metaKV.SaveWithTTL("lease", "v", time.Millisecond)
+	assert.NoError(t, err)
+	err = metaKV.SaveWithTTL("kept", "v", time.Hour)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := txnClient.GetSnapshot(MaxSnapshotTS).Get(context.Background(), []byte(metaKV.GetPath("lease")))
+		return tikverr.IsErrNotFound(err)
+	}, 5*time.Second, 10*time.Millisecond)
+	has, err := metaKV.Has("kept")
+	assert.NoError(t, err)
+	assert.True(t, has)
+
+	// Close stops the reaper, closing again is harmless
+	metaKV.Close()
+	metaKV.Close()
+	err = metaKV.SaveWithTTL("lease", "v", time.Millisecond)
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = txnClient.GetSnapshot(MaxSnapshotTS).Get(context.Background(), []byte(metaKV.GetPath("lease")))
+	assert.NoError(t, err)
+
+	// a non-positive interval runs no reaper instead of panicking in the ticker
+	for _, interval := range []time.Duration{0, -time.Second} {
+		noReaperKV := NewTiKV(txnClient, rootPath, WithExpiredKeyReaper(interval))
+		assert.Nil(t, noReaperKV.reaper)
+		noReaperKV.Close()
+	}
+}
+
+func TestConfiguredTimeouts(t *testing.T) {
+	rootPath := "/tikv/test/root/configured_timeouts"
+	defer func() {
+		Params.Reset(Params.TiKVCfg.RequestTimeout.Key)
+		Params.Reset(Params.TiKVCfg.ScanTimeout.Key)
+		RequestTimeout = Params.TiKVCfg.RequestTimeout.GetAsDuration(time.Millisecond)
+		ScanTimeout = Params.TiKVCfg.ScanTimeout.GetAsDuration(time.Millisecond)
+	}()
+
+	// each commit takes a while, unless the deadline is exceeded first
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return tiTxnCommit(txn, ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+
+	// a tiny request timeout fails point operations fast, but doesn't bound scans
+	Params.Save(Params.TiKVCfg.RequestTimeout.Key, "10")
+	metaKV := NewTiKV(txnClient, rootPath)
+	defer metaKV.Close()
+	defer metaKV.WithTimeout(time.Minute).RemoveWithPrefix("")
+	err := metaKV.Save("point_0", "value")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, _, err = metaKV.LoadWithPrefix("point")
+	assert.NoError(t, err)
+
+	// with a large one, or none, they succeed
+	Params.Save(Params.TiKVCfg.RequestTimeout.Key, "60000")
+	metaKV = NewTiKV(txnClient, rootPath)
+	err = metaKV.Save("point_0", "value")
+	assert.NoError(t, err)
+	Params.Save(Params.TiKVCfg.RequestTimeout.Key, "0")
+	metaKV = NewTiKV(txnClient, rootPath)
+	err = metaKV.Save("point_1", "value")
+	assert.NoError(t, err)
+	value, err := metaKV.Load("point_1")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+
+	// a tiny scan timeout stops a slow walk fast
+	commitTxn = tiTxnCommit
+	saves := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		saves[fmt.Sprintf("key_%03d", i)] = "value"
+	}
+	err = metaKV.MultiSave(saves)
+	require.NoError(t, err)
+	Params.Save(Params.TiKVCfg.ScanTimeout.Key, "10")
+	metaKV = NewTiKV(txnClient, rootPath)
+	visited := 0
+	err = metaKV.WalkWithPrefix("key", 10, func(k []byte, v []byte) error {
+		visited++
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, visited, 100)
+	err = metaKV.Save("point_0", "value2")
+	assert.NoError(t, err)
+
+	Params.Save(Params.TiKVCfg.ScanTimeout.Key, "60000")
+	metaKV = NewTiKV(txnClient, rootPath)
+	visited = 0
+	err = metaKV.WalkWithPrefix("key", 10, func(k []byte, v []byte) error {
+		visited++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, visited)
+	keys, _, err := metaKV.LoadWithPrefix("key")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 100)
+}
+
+func TestWithContext(t *testing.T) {
+	rootPath := "/tikv/test/root/with_context"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	saves := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		saves[fmt.Sprintf("key_%05d", i)] = "value"
+	}
+	err = metaKV.MultiSave(saves)
+	require.NoError(t, err)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	view := metaKV.WithContext(canceled)
+	_, err = view.Load("key_00000")
+	assert.ErrorIs(t, err, context.Canceled)
+	err = view.Save("key_00000", "value2")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, _, err = view.LoadWithPrefix("key")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, _, err = view.LoadWithPrefixConcurrent("key", 2)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, _, err = view.LoadWithPrefixAndMaxStaleness("key", time.Second)
+	assert.ErrorIs(t, err, context.Canceled)
+	value, err := metaKV.Load("key_00000")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+
+	// the walk stops before the next key once the caller cancels
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	visited := 0
+	err = metaKV.WithContext(ctx).WalkWithPrefix("key", 100, func(k []byte, v []byte) error {
+		visited++
+		if visited == 50 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 50, visited)
+
+	// the earlier of the deadline of ctx and the timeout bounds a request
+	commitTxn = func(txn *transaction.KVTxn, ctx context.Context) error {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return tiTxnCommit(txn, ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer func() {
+		commitTxn = tiTxnCommit
+	}()
+	deadline, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = metaKV.WithTimeout(time.Minute).WithContext(deadline).Save("key_00000", "value2")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	err = metaKV.WithContext(context.Background()).WithTimeout(10*time.Millisecond).Save("key_00000", "value2")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	err = metaKV.WithContext(context.Background()).Save("key_00000", "value2")
+	assert.NoError(t, err)
+}
+
+func TestCtxVariants(t *testing.T) {
+	rootPath := "/tikv/test/root/ctx_variants"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	ctx := context.Background()
+	err = metaKV.SaveCtx(ctx, "k0", "v0")
+	assert.NoError(t, err)
+	err = metaKV.MultiSaveCtx(ctx, map[string]string{"k1": "v1", "k2": "v2"})
+	assert.NoError(t, err)
+	value, err := metaKV.LoadCtx(ctx, "k0")
+	assert.NoError(t, err)
+	assert.Equal(t, "v0", value)
+	values, err := metaKV.MultiLoadCtx(ctx, []string{"k1", "k2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1", "v2"}, values)
+	err = metaKV.MultiSaveAndRemoveCtx(ctx, map[string]string{"k3": "v3"}, []string{"k0"})
+	assert.NoError(t, err)
+	err = metaKV.RemoveCtx(ctx, "k1")
+	assert.NoError(t, err)
+	err = metaKV.MultiRemoveCtx(ctx, []string{"k2"})
+	assert.NoError(t, err)
+	keys, _, err := metaKV.LoadWithPrefixCtx(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{metaKV.GetPath("k3")}, keys)
+	err = metaKV.MultiSaveAndRemoveWithPrefixCtx(ctx, nil, []string{"k"})
+	assert.NoError(t, err)
+	err = metaKV.SaveCtx(ctx, "k4", "v4")
+	assert.NoError(t, err)
+	err = metaKV.RemoveWithPrefixCtx(ctx, "k")
+	assert.NoError(t, err)
+	keys, _, err = metaKV.LoadWithPrefixCtx(ctx, "k")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = metaKV.LoadWithPrefixCtx(canceled, "")
+	assert.ErrorIs(t, err, context.Canceled)
+	err = metaKV.SaveCtx(canceled, "k5", "v5")
+	assert.ErrorIs(t, err, context.Canceled)
+	has, err := metaKV.Has("k5")
+	assert.NoError(t, err)
+	assert.False(t, has)
+
+	// canceling a walk of several pages stops it promptly instead of visiting the rest, the keys are
+	// few enough to be saved in one transaction well within the request timeout
+	const walkPageSize = 100
+	saves := make(map[string]string)
+	for i := 0; i < 3*walkPageSize; i++ {
+		saves[fmt.Sprintf("walk_%06d", i)] = "value"
+	}
+	err = metaKV.MultiSave(saves)
+	require.NoError(t, err)
+	walkCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	visited := 0
+	err = metaKV.WalkWithPrefixCtx(walkCtx, "walk", walkPageSize, func(k []byte, v []byte) error {
+		visited++
+		if visited == 10 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 10, visited)
+}
+
+// countRPCs counts the Get and BatchGet requests sent by the snapshots until the returned func is called.
+func countRPCs(gets *atomic.Int64, batchGets *atomic.Int64) func() {
+	getSnapshot = func(txn *txnkv.Client, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+		ss := tiTxnSnapshot(txn, paginationSize, replicaRead)
+		ss.SetRPCInterceptor(func(next interceptor.RPCInterceptorFunc) interceptor.RPCInterceptorFunc {
+			return func(target string, req *tikvrpc.Request) (*tikvrpc.Response, error) {
+				switch req.Type {
+				case tikvrpc.CmdGet:
+					gets.Inc()
+				case tikvrpc.CmdBatchGet:
+					batchGets.Inc()
+				}
+				return next(target, req)
+			}
+		})
+		return ss
+	}
+	return func() {
+		getSnapshot = tiTxnSnapshot
+	}
+}
+
+func TestMultiLoadBatchGet(t *testing.T) {
+	rootPath := "/tikv/test/root/multi_load_batch_get"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	kvs := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		kvs[fmt.Sprintf("key%d", i)] = fmt.Sprintf("value%d", i)
+	}
+	kvs["empty"] = ""
+	require.NoError(t, metaKV.MultiSave(kvs))
+
+	gets, batchGets := atomic.NewInt64(0), atomic.NewInt64(0)
+	defer countRPCs(gets, batchGets)()
+
+	t.Run("mixed keys", func(t *testing.T) {
+		batchGets.Store(0)
+		keys := []string{"key3", "missing1", "empty", "key0", "missing2", "key9"}
+		values, err := metaKV.MultiLoad(keys)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "missing1")
+		assert.Contains(t, err.Error(), "missing2")
+		assert.Equal(t, []string{"value3", "", "", "value0", "", "value9"}, values)
+		// the keys of caller are kept
+		assert.Equal(t, []string{"key3", "missing1", "empty", "key0", "missing2", "key9"}, keys)
+		assert.EqualValues(t, 1, batchGets.Load())
+
+		values, err = metaKV.MultiLoad([]string{"empty", "key1"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"", "value1"}, values)
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		MultiLoadBatchSize = 3
+		defer func() {
+			MultiLoadBatchSize = 1024
+		}()
+
+		batchGets.Store(0)
+		keys := make([]string, 0, 11)
+		expected := make([]string, 0, 11)
+		for i := 9; i >= 0; i-- {
+			keys = append(keys, fmt.Sprintf("key%d", i))
+			expected = append(expected, fmt.Sprintf("value%d", i))
+		}
+		keys = append(keys, "missing")
+		expected = append(expected, "")
+
+		values, err := metaKV.MultiLoad(keys)
+		assert.Error(t, err)
+		assert.Equal(t, expected, values)
+		assert.EqualValues(t, 4, batchGets.Load())
+	})
+
+	t.Run("single key", func(t *testing.T) {
+		gets.Store(0)
+		batchGets.Store(0)
+		values, err := metaKV.MultiLoad([]string{"key1"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"value1"}, values)
+
+		values, err = metaKV.MultiLoad([]string{"empty"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{""}, values)
+
+		values, err = metaKV.MultiLoad([]string{"missing"})
+		assert.Error(t, err)
+		assert.Equal(t, []string{""}, values)
+		assert.EqualValues(t, 3, gets.Load())
+		assert.EqualValues(t, 0, batchGets.Load())
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		values, err := metaKV.MultiLoad(nil)
+		assert.NoError(t, err)
+		assert.Empty(t, values)
+	})
+}
+
+func TestMultiLoadPartial(t *testing.T) {
+	rootPath := "/tikv/test/root/multi_load_partial"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	kvs := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		kvs[fmt.Sprintf("key%d", i)] = fmt.Sprintf("value%d", i)
+	}
+	kvs["empty"] = ""
+	require.NoError(t, metaKV.MultiSave(kvs))
+
+	gets, batchGets := atomic.NewInt64(0), atomic.NewInt64(0)
+	defer countRPCs(gets, batchGets)()
+
+	t.Run("mixed keys", func(t *testing.T) {
+		batchGets.Store(0)
+		values, missing, err := metaKV.MultiLoadPartial([]string{"key3", "missing1", "empty", "key0", "missing2", "key9"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"key3": "value3", "empty": "", "key0": "value0", "key9": "value9"}, values)
+		assert.Equal(t, []string{"missing1", "missing2"}, missing)
+		assert.EqualValues(t, 1, batchGets.Load())
+
+		// the strict MultiLoad still fails for the missing keys
+		_, err = metaKV.MultiLoad([]string{"key3", "missing1"})
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		MultiLoadBatchSize = 3
+		defer func() {
+			MultiLoadBatchSize = 1024
+		}()
+
+		batchGets.Store(0)
+		keys := []string{"missing0"}
+		for i := 9; i >= 0; i-- {
+			keys = append(keys, fmt.Sprintf("key%d", i))
+		}
+		keys = append(keys, "empty", "missing1")
+		values, missing, err := metaKV.MultiLoadPartial(keys)
+		assert.NoError(t, err)
+		assert.Equal(t, kvs, values)
+		assert.Equal(t, []string{"missing0", "missing1"}, missing)
+		assert.EqualValues(t, 5, batchGets.Load())
+	})
+
+	t.Run("single key", func(t *testing.T) {
+		values, missing, err := metaKV.MultiLoadPartial([]string{"empty"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"empty": ""}, values)
+		assert.Empty(t, missing)
+
+		values, missing, err = metaKV.MultiLoadPartial([]string{"missing"})
+		assert.NoError(t, err)
+		assert.Empty(t, values)
+		assert.Equal(t, []string{"missing"}, missing)
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		values, missing, err := metaKV.MultiLoadPartial(nil)
+		assert.NoError(t, err)
+		assert.Empty(t, values)
+		assert.Empty(t, missing)
+	})
+
+	t.Run("failed read", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		values, missing, err := metaKV.WithContext(ctx).MultiLoadPartial([]string{"key1", "missing"})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NotErrorIs(t, err, ErrKeyNotFound)
+		assert.Nil(t, values)
+		assert.Nil(t, missing)
+	})
+}
+
+func BenchmarkMultiLoad(b *testing.B) {
+	rootPath := "/tikv/test/root/benchmark_multi_load"
+	metaKV := NewTiKV(txnClient, rootPath)
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	const n = 200
+	kvs := make(map[string]string, n)
+	keys := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("segment/%d", i)
+		kvs[key] = fmt.Sprintf("value%d", i)
+		keys = append(keys, key)
+	}
+	if err := metaKV.MultiSave(kvs); err != nil {
+		b.Fatal(err)
+	}
+
+	gets, batchGets := atomic.NewInt64(0), atomic.NewInt64(0)
+	defer countRPCs(gets, batchGets)()
+
+	b.Run("per key", func(b *testing.B) {
+		gets.Store(0)
+		for i := 0; i < b.N; i++ {
+			for _, key := range keys {
+				if _, err := metaKV.Load(key); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		b.ReportMetric(float64(gets.Load())/float64(b.N), "rpcs/op")
+	})
+
+	b.Run("batch get", func(b *testing.B) {
+		batchGets.Store(0)
+		for i := 0; i < b.N; i++ {
+			if _, err := metaKV.MultiLoad(keys); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(batchGets.Load())/float64(b.N), "rpcs/op")
+	})
+}
+
+// setupScanBenchmark saves n kvs of 100 byte values under prefix "prefix".
+func setupScanBenchmark(b *testing.B, rootPath string, n int) *txnTiKV {
+	metaKV := NewTiKV(txnClient, rootPath)
+	if err := metaKV.RemoveWithPrefix(""); err != nil {
+		b.Fatal(err)
+	}
+	value := strings.Repeat("v", 100)
+	for i := 0; i < n; i += 1000 {
+		kvs := make(map[string]string, 1000)
+		for j := i; j < i+1000 && j < n; j++ {
+			kvs[fmt.Sprintf("prefix/%08d", j)] = value
+		}
+		if err := metaKV.MultiSave(kvs); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return metaKV
+}
+
+func BenchmarkLoadWithPrefix(b *testing.B) {
+	const n = 100000
+	metaKV := setupScanBenchmark(b, "/tikv/test/root/benchmark_load_with_prefix", n)
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	b.Run("LoadWithPrefix", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			keys, _, err := metaKV.LoadWithPrefix("prefix")
+			if err != nil || len(keys) != n {
+				b.Fatal(len(keys), err)
+			}
+		}
+	})
+
+	b.Run("WalkWithPrefix", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			count := 0
+			err := metaKV.WalkWithPrefix("prefix", SnapshotScanSize, func(key []byte, value []byte) error {
+				count++
+				return nil
+			})
+			if err != nil || count != n {
+				b.Fatal(count, err)
+			}
+		}
+	})
+}
+
+// BenchmarkLoadKeysWithPrefix compares the scans of 10KB values. The mock cluster returns the values
+// of the key-only scans anyway, so it only shows the saving of the client, not of the transfers.
+func BenchmarkLoadKeysWithPrefix(b *testing.B) {
+	const n = 3000
+	metaKV := NewTiKV(txnClient, "/tikv/test/root/benchmark_load_keys")
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+	if err := metaKV.RemoveWithPrefix(""); err != nil {
+		b.Fatal(err)
+	}
+	value := strings.Repeat("v", 10*1024)
+	for i := 0; i < n; i += 100 {
+		kvs := make(map[string]string, 100)
+		for j := i; j < i+100 && j < n; j++ {
+			kvs[fmt.Sprintf("segment/%08d", j)] = value
+		}
+		if err := metaKV.MultiSave(kvs); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Run("LoadWithPrefix", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			keys, _, err := metaKV.LoadWithPrefix("segment")
+			if err != nil || len(keys) != n {
+				b.Fatal(len(keys), err)
+			}
+		}
+	})
+
+	b.Run("LoadKeysWithPrefix", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			keys, err := metaKV.LoadKeysWithPrefix("segment")
+			if err != nil || len(keys) != n {
+				b.Fatal(len(keys), err)
+			}
+		}
+	})
+}
+
+func BenchmarkValueCompression(b *testing.B) {
+	rootPath := "/tikv/test/root/benchmark_value_compression"
+	// pseudo-random letters of 16 kinds, which zstd compresses to about three quarters
+	value := make([]byte, 1<<20)
+	x := uint32(1)
+	for i := range value {
+		x = x*1103515245 + 12345
+		value[i] = 'a' + byte(x>>16)%16
+	}
+
+	for _, test := range []struct {
+		name string
+		opts []Option
+	}{
+		{"uncompressed", nil},
+		{"compressed", []Option{WithValueCompression(1024)}},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			metaKV := NewTiKV(txnClient, rootPath, test.opts...)
+			defer metaKV.Close()
+			defer metaKV.RemoveWithPrefix("")
+
+			b.SetBytes(int64(len(value)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := metaKV.SaveBytes("index", value); err != nil {
+					b.Fatal(err)
+				}
+				loaded, err := metaKV.LoadBytes("index")
+				if err != nil || len(loaded) != len(value) {
+					b.Fatal(len(loaded), err)
+				}
+			}
+			stored, err := txnClient.GetSnapshot(MaxSnapshotTS).Get(context.Background(), []byte(metaKV.GetPath("index")))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(len(stored)), "stored-bytes")
+		})
+	}
+}
+
+func TestLoadWithPrefixAllocs(t *testing.T) {
+	rootPath := "/tikv/test/root/load_with_prefix_allocs"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	// across several pages of scanRange
+	n := 3*scanPageSize + 10
+	kvs := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		kvs[fmt.Sprintf("prefix/%05d", i)] = fmt.Sprintf("value%d", i)
+	}
+	kvs["prefix/empty"] = ""
+	require.NoError(t, metaKV.MultiSave(kvs))
+
+	keys, values, err := metaKV.LoadWithPrefix("prefix")
+	require.NoError(t, err)
+	require.Len(t, keys, n+1)
+	for i := 0; i < n; i++ {
+		assert.Equal(t, path.Join(rootPath, fmt.Sprintf("prefix/%05d", i)), keys[i])
+		assert.Equal(t, fmt.Sprintf("value%d", i), values[i])
+	}
+	assert.Equal(t, path.Join(rootPath, "prefix/empty"), keys[n])
+	assert.Equal(t, "", values[n])
+
+	// the keys and values are not copied one by one, so LoadWithPrefix allocates about the same as
+	// WalkWithPrefix, which doesn't convert them into strings. AllocsPerRun counts the allocations of
+	// the background goroutines of the client and the mock cluster too, which only add to the counts,
+	// so the least of the measurements of several rounds are compared.
+	load := func() {
+		_, _, err := metaKV.LoadWithPrefix("prefix")
+		require.NoError(t, err)
+	}
+	walk := func() {
+		err := metaKV.WalkWithPrefix("prefix", SnapshotScanSize, func(key []byte, value []byte) error {
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	loadAllocs, walkAllocs := math.Inf(1), math.Inf(1)
+	// copying the keys and values one by one would take at least n more allocations
+	maxExtraAllocs := float64(n) / 2
+	for round := 0; round < 10 && !(loadAllocs < walkAllocs+maxExtraAllocs); round++ {
+		loadAllocs = math.Min(loadAllocs, testing.AllocsPerRun(1, load))
+		walkAllocs = math.Min(walkAllocs, testing.AllocsPerRun(1, walk))
+	}
+	t.Logf("%d keys, LoadWithPrefix allocs: %f, WalkWithPrefix allocs: %f", n+1, loadAllocs, walkAllocs)
+	assert.Less(t, loadAllocs, walkAllocs+maxExtraAllocs)
+}
+
+func TestWaitForPrefixState(t *testing.T) {
+	metaKV := NewTiKV(txnClient, "/tikv/test/root/wait_for_prefix_state")
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	WaitForPrefixStateInterval = 10 * time.Millisecond
+	defer func() {
+		WaitForPrefixStateInterval = 100 * time.Millisecond
+	}()
+
+	require.NoError(t, metaKV.Save("state/stale", "value"))
+	require.NoError(t, metaKV.Save("other", "value"))
+	expected := map[string]string{
+		"state/a": "1",
+		"state/b": "",
+	}
+
+	t.Run("converged", func(t *testing.T) {
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			metaKV.MultiSaveAndRemove(expected, []string{"state/stale"})
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		start := time.Now()
+		err := metaKV.WaitForPrefixState(ctx, "state", expected)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		require.NoError(t, metaKV.MultiSave(map[string]string{"state/a": "2", "state/c": "3"}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := metaKV.WaitForPrefixState(ctx, "state", map[string]string{
+			"state/a": "1",
+			"state/d": "4",
+			"state/e": "5",
+		})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		var notReached *ErrPrefixStateNotReached
+		require.True(t, errors.As(err, &notReached))
+		assert.Equal(t, []string{"state/d", "state/e"}, notReached.Diff.Missing)
+		assert.Equal(t, []string{"state/b", "state/c"}, notReached.Diff.Unexpected)
+		assert.Equal(t, []ValueMismatch{{Key: "state/a", Expected: "1", Actual: "2"}}, notReached.Diff.Mismatched)
+		assert.Contains(t, err.Error(), "state/d")
+	})
+}
+
+func TestPrefixLabel(t *testing.T) {
+	metaKV := NewTiKV(txnClient, "/tikv/test/root/prefix_label")
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	metrics.MetaKvSize.Reset()
+	metrics.MetaRequestLatency.Reset()
+
+	require.NoError(t, metaKV.Save("meta/datacoord-meta/s/100/101/1", "segment"))
+	require.NoError(t, metaKV.MultiSave(map[string]string{
+		"meta/datacoord-meta/channel-cp/ch1": "checkpoint",
+		"meta/datacoord-meta/channel-cp/ch2": "checkpoint",
+	}))
+	require.NoError(t, metaKV.MultiSave(map[string]string{
+		"meta/datacoord-meta/s/100/101/2": "segment",
+		"meta/session/querynode-1":        "session",
+	}))
+	_, err = metaKV.Load("meta/session/querynode-1")
+	require.NoError(t, err)
+
+	assert.True(t, metrics.MetaKvSize.DeleteLabelValues(metrics.MetaPutLabel, kv.PrefixLabelSegment))
+	assert.True(t, metrics.MetaRequestLatency.DeleteLabelValues(metrics.MetaTxnLabel, kv.PrefixLabelChannelCheckpoint))
+	assert.True(t, metrics.MetaRequestLatency.DeleteLabelValues(metrics.MetaTxnLabel, kv.PrefixLabelMixed))
+	assert.True(t, metrics.MetaKvSize.DeleteLabelValues(metrics.MetaGetLabel, kv.PrefixLabelSession))
+	assert.True(t, metrics.MetaRequestLatency.DeleteLabelValues(metrics.MetaGetLabel, kv.PrefixLabelSession))
+}
+
+func TestMultiSaveAndRemoveWithPrevValues(t *testing.T) {
+	rootPath := "/tikv/test/root/prev_values"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	require.NoError(t, metaKV.MultiSave(map[string]string{"a": "1", "b": "2", "c": "3", "empty": ""}))
+	prevValues, err := metaKV.MultiSaveAndRemoveWithPrevValues(map[string]string{"d": "4"}, []string{"a", "empty", "not-exist"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "empty": ""}, prevValues)
+	_, values, err := metaKV.LoadWithPrefix("")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"2", "3", "4"}, values)
+
+	t.Run("predicates", func(t *testing.T) {
+		prevValues, err := metaKV.MultiSaveAndRemoveWithPrevValues(nil, []string{"b"}, predicates.ValueEqual("d", "5"))
+		assert.Error(t, err)
+		assert.Nil(t, prevValues)
+		has, err := metaKV.Has("b")
+		assert.NoError(t, err)
+		assert.True(t, has)
+
+		prevValues, err = metaKV.MultiSaveAndRemoveWithPrevValues(nil, []string{"b"}, predicates.ValueEqual("d", "4"))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"b": "2"}, prevValues)
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		MultiLoadBatchSize = 3
+		defer func() {
+			MultiLoadBatchSize = 1024
+		}()
+		kvs := make(map[string]string)
+		var removals []string
+		for i := 0; i < 8; i++ {
+			kvs[fmt.Sprintf("batch%d", i)] = fmt.Sprintf("value%d", i)
+			removals = append(removals, fmt.Sprintf("batch%d", i))
+		}
+		require.NoError(t, metaKV.MultiSave(kvs))
+		prevValues, err := metaKV.MultiSaveAndRemoveWithPrevValues(nil, append(removals, "batch-missing"))
+		assert.NoError(t, err)
+		assert.Equal(t, kvs, prevValues)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		clock := time.Now()
+		expirationClock = func() time.Time { return clock }
+		defer func() {
+			expirationClock = time.Now
+		}()
+		require.NoError(t, metaKV.SaveWithTTL("lease", "value", time.Minute))
+		require.NoError(t, metaKV.SaveWithTTL("live", "value", time.Hour))
+		clock = clock.Add(10 * time.Minute)
+
+		prevValues, err := metaKV.MultiSaveAndRemoveWithPrevValues(nil, []string{"lease", "live"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"live": "value"}, prevValues)
+	})
+
+	t.Run("compression", func(t *testing.T) {
+		compressedKV := NewTiKV(txnClient, rootPath, WithValueCompression(1024))
+		defer compressedKV.Close()
+
+		large := strings.Repeat("segment meta ", 1024)
+		prevValues, err := compressedKV.MultiSaveAndRemoveWithPrevValues(map[string]string{"large": large}, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, prevValues)
+		value, err := txnClient.GetSnapshot(MaxSnapshotTS).Get(context.Background(), []byte(metaKV.GetPath("large")))
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(value, compressedValueHeaderByte))
+
+		prevValues, err = metaKV.MultiSaveAndRemoveWithPrevValues(nil, []string{"large"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"large": large}, prevValues)
+	})
+
+	t.Run("max txn ops", func(t *testing.T) {
+		Params.Save(Params.TiKVCfg.MaxTxnOps.Key, "1")
+		defer Params.Reset(Params.TiKVCfg.MaxTxnOps.Key)
+		_, err := metaKV.MultiSaveAndRemoveWithPrevValues(map[string]string{"e": "5"}, []string{"c"})
+		var tooManyOps *ErrTooManyOps
+		assert.ErrorAs(t, err, &tooManyOps)
+	})
+
+	t.Run("concurrent writers", func(t *testing.T) {
+		// the writers save the same value to both keys, the values removed together are always equal
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		wg := sync.WaitGroup{}
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(writer int) {
+				defer wg.Done()
+				for j := 0; ctx.Err() == nil; j++ {
+					value := fmt.Sprintf("%d-%d", writer, j)
+					// conflicting with the other writers or the remover is expected
+					_ = metaKV.MultiSave(map[string]string{"x": value, "y": value})
+				}
+			}(i)
+		}
+		removed := 0
+		for attempt := 0; removed < 20; attempt++ {
+			require.Less(t, attempt, 10000)
+			prevValues, err := metaKV.MultiSaveAndRemoveWithPrevValues(nil, []string{"x", "y"})
+			if err != nil || len(prevValues) == 0 {
+				continue
+			}
+			require.Len(t, prevValues, 2)
+			require.Equal(t, prevValues["x"], prevValues["y"])
+			removed++
+		}
+		cancel()
+		wg.Wait()
+	})
+}
+
+func TestReconnect(t *testing.T) {
+	rootPath := "/tikv/test/root/reconnect"
+	metaKV := NewTiKV(txnClient, rootPath)
+	err := metaKV.RemoveWithPrefix("")
+	require.NoError(t, err)
+
+	defer metaKV.Close()
+	defer metaKV.RemoveWithPrefix("")
+
+	// the clients connected to either endpoint set share the mock store, the closed ones must
+	// not be used by any operation after they are closed
+	var mu sync.Mutex
+	connected := make(map[*txnkv.Client][]string)
+	closed := make(map[*txnkv.Client]bool)
+	var usedAfterClose atomic.Int64
+	checkOpen := func(client *txnkv.Client) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed[client] {
+			usedAfterClose.Inc()
+		}
+	}
+	defer func() {
+		newTxnClient = txnkv.NewClient
+		closeTxnClient = func(client *txnkv.Client) error { return client.Close() }
+		beginTxn = tiTxnBegin
+		getSnapshot = tiTxnSnapshot
+	}()
+	newTxnClient = func(pdAddrs []string) (*txnkv.Client, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		client := &txnkv.Client{KVStore: txnClient.KVStore}
+		connected[client] = pdAddrs
+		return client, nil
+	}
+	closeTxnClient = func(client *txnkv.Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+		closed[client] = true
+		return nil
+	}
+	beginTxn = func(client *txnkv.Client) (*transaction.KVTxn, error) {
+		checkOpen(client)
+		return tiTxnBegin(client)
+	}
+	getSnapshot = func(client *txnkv.Client, paginationSize int, replicaRead tikv.ReplicaReadType) *txnsnapshot.KVSnapshot {
+		checkOpen(client)
+		return tiTxnSnapshot(client, paginationSize, replicaRead)
+	}
+
+	successes := testutil.ToFloat64(metrics.MetaClientSwapCounter.WithLabelValues(metrics.SuccessLabel))
+	failures := testutil.ToFloat64(metrics.MetaClientSwapCounter.WithLabelValues(metrics.FailLabel))
+
+	t.Run("swap under load", func(t *testing.T) {
+		endpoints := [][]string{{"pd-a:2379"}, {"pd-b-0:2379", "pd-b-1:2379"}}
+		const swaps = 20
+		stop := make(chan struct{})
+		var opErrors atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				key := fmt.Sprintf("key%d", i)
+				for j := 0; ; j++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					value := fmt.Sprintf("value%d", j)
+					if err := metaKV.Save(key, value); err != nil {
+						opErrors.Inc()
+						continue
+					}
+					if loaded, err := metaKV.Load(key); err != nil || loaded != value {
+						opErrors.Inc()
+					}
+					if _, _, err := metaKV.LoadWithPrefix(""); err != nil {
+						opErrors.Inc()
+					}
+				}
+			}(i)
+		}
+		for i := 0; i < swaps; i++ {
+			assert.NoError(t, metaKV.Reconnect(context.Background(), endpoints[i%2]))
+			time.Sleep(5 * time.Millisecond)
+		}
+		close(stop)
+		wg.Wait()
+
+		assert.Zero(t, opErrors.Load())
+		assert.Zero(t, usedAfterClose.Load())
+		assert.Equal(t, float64(swaps), testutil.ToFloat64(metrics.MetaClientSwapCounter.WithLabelValues(metrics.SuccessLabel))-successes)
+		// the client passed to NewTiKV and the current client are not closed
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(closed) == swaps-1
+		}, 5*time.Second, 10*time.Millisecond)
+		mu.Lock()
+		assert.Len(t, connected, swaps)
+		assert.False(t, closed[txnClient])
+		mu.Unlock()
+
+		current, release := metaKV.acquireClient()
+		release()
+		mu.Lock()
+		assert.Equal(t, endpoints[(swaps-1)%2], connected[current])
+		assert.False(t, closed[current])
+		mu.Unlock()
+	})
+
+	t.Run("probe failure", func(t *testing.T) {
+		current, release := metaKV.acquireClient()
+		release()
+		beginTxn = func(client *txnkv.Client) (*transaction.KVTxn, error) {
+			if client != current {
+				return nil, errors.New("mock unreachable")
+			}
+			return tiTxnBegin(client)
+		}
+		err := metaKV.Reconnect(context.Background(), []string{"pd-c:2379"})
+		assert.Error(t, err)
+		assert.Equal(t, float64(1), testutil.ToFloat64(metrics.MetaClientSwapCounter.WithLabelValues(metrics.FailLabel))-failures)
+
+		// the new client is closed, and the operations keep using the current one
+		mu.Lock()
+		for client, addrs := range connected {
+			if addrs[0] == "pd-c:2379" {
+				assert.True(t, closed[client])
+			}
+		}
+		mu.Unlock()
+		after, release := metaKV.acquireClient()
+		release()
+		assert.Same(t, current, after)
+		assert.NoError(t, metaKV.Save("key", "value"))
+	})
+
+	t.Run("no endpoint", func(t *testing.T) {
+		err := metaKV.Reconnect(context.Background(), nil)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+
+	t.Run("shared by views", func(t *testing.T) {
+		beginTxn = tiTxnBegin
+		previous, release := metaKV.acquireClient()
+		release()
+		view := metaKV.WithTimeout(time.Minute)
+		assert.NoError(t, view.Reconnect(context.Background(), []string{"pd-d:2379"}))
+		client, release := metaKV.acquireClient()
+		release()
+		mu.Lock()
+		assert.Equal(t, []string{"pd-d:2379"}, connected[client])
+		mu.Unlock()
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return closed[previous]
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		closedKV := NewTiKV(txnClient, rootPath, WithWatchInterval(10*time.Millisecond))
+		require.NoError(t, closedKV.Reconnect(context.Background(), []string{"pd-e:2379"}))
+		client, release := closedKV.acquireClient()
+		release()
+		w, err := closedKV.Watch("close")
+		require.NoError(t, err)
+
+		// Close of a view keeps the client and the watchers of the instance
+		closedKV.WithTimeout(time.Minute).Close()
+		closedKV.WithContext(context.Background()).Close()
+		mu.Lock()
+		assert.False(t, closed[client])
+		mu.Unlock()
+		require.NoError(t, closedKV.Save("close", "value"))
+		events := nextWatchEvents(t, w, 1)
+		assert.Equal(t, WatchEvent{Type: WatchEventPut, Key: "close", Value: "value"}, events[0])
+
+		// Close of the instance closes the client connected by Reconnect
+		closedKV.Close()
+		closedKV.Close()
+		mu.Lock()
+		assert.True(t, closed[client])
+		assert.False(t, closed[txnClient])
+		mu.Unlock()
+		_, ok := <-w.Events()
+		assert.False(t, ok)
+		assert.Error(t, closedKV.Reconnect(context.Background(), []string{"pd-f:2379"}))
+	})
+}
@@ -0,0 +1,296 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	tikverr "github.com/tikv/client-go/v2/error"
+	"github.com/tikv/client-go/v2/txnkv/transaction"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/common"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+)
+
+// versionKeyPrefix is the prefix of the sidecar entries keeping the versions of the keys, which
+// TiKV doesn't expose like etcd does. The sidecar of a full key is versionKeyPrefix + the full key,
+// out of the root paths so scans of the keys never see it.
+const versionKeyPrefix = "__txn_tikv_version__"
+
+// versionKey returns the sidecar key of the version of the full key.
+func versionKey(fullKey string) []byte {
+	return []byte(versionKeyPrefix + fullKey)
+}
+
+// WithVersionedPrefixes keeps the versions of the keys with the given prefixes, relative to the root
+// path, "" for all the keys, see LoadWithVersion, CompareVersionAndSwap and Watch. Keeping the version
+// of a key adds a write of its sidecar entry to each transaction writing the key, which counts
+// against tikv.maxTxnOps and tikv.txnEntrySizeLimit like the other writes, so only the keys used with
+// CompareVersionAndSwap or watched for the saves of the same value should be versioned.
+func WithVersionedPrefixes(prefixes ...string) Option {
+	return func(kv *txnTiKV) {
+		kv.versionedPrefixes = prefixes
+	}
+}
+
+// isVersioned returns if the version of the full key is kept, see WithVersionedPrefixes.
+func (kv *txnTiKV) isVersioned(fullKey string) bool {
+	for _, prefix := range kv.versionedPrefixes {
+		if strings.HasPrefix(fullKey, path.Join(kv.rootPath, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkVersioned returns an error if the version of the full key is not kept.
+func (kv *txnTiKV) checkVersioned(fullKey string) error {
+	if !kv.isVersioned(fullKey) {
+		return merr.WrapErrParameterInvalidMsg("the version of key %s is not kept, see WithVersionedPrefixes", fullKey)
+	}
+	return nil
+}
+
+// maxVersionSize is the size of the largest version, the decimal digits of a TS.
+var maxVersionSize = len(strconv.FormatUint(math.MaxUint64, 10))
+
+// bumpVersions sets the sidecar versions of the versioned keys written by txn in txn before it's
+// committed, so the versions change atomically with the values. The version of a key is the start TS
+// of the transaction which wrote it last, which needs no read and grows with each write, as TiKV fails
+// a transaction writing a key committed after its start. Like etcd, a removed key has version 0.
+// A key saved before the versions were kept, without a sidecar, has version 1.
+// The writes of the sidecars are checked against tikv.maxTxnOps and tikv.txnEntrySizeLimit together
+// with the writes of the keys, which are checked before the transaction starts.
+func (kv *txnTiKV) bumpVersions(txn *transaction.KVTxn) error {
+	if len(kv.versionedPrefixes) == 0 {
+		return nil
+	}
+	_, err := kv.bumpVersionsLabeled(txn)
+	return err
+}
+
+// bumpVersionsLabeled is bumpVersions also returning the prefix label shared by the keys written
+// by txn, which are collected by the same pass over its writes.
+func (kv *txnTiKV) bumpVersionsLabeled(txn *transaction.KVTxn) (string, error) {
+	iter, err := txn.GetMemBuffer().Iter(nil, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to iterate the writes for the versions")
+	}
+	var written []string
+	var saved, removed [][]byte
+	for iter.Valid() {
+		key := iter.Key()
+		if !strings.HasPrefix(string(key), versionKeyPrefix) {
+			written = append(written, string(key))
+			if kv.isVersioned(string(key)) {
+				// a removal is a tombstone without value in the buffer, the saved values are never empty
+				if len(iter.Value()) == 0 {
+					removed = append(removed, versionKey(string(key)))
+				} else {
+					saved = append(saved, versionKey(string(key)))
+				}
+			}
+		}
+		if err = iter.Next(); err != nil {
+			iter.Close()
+			return "", errors.Wrap(err, "Failed to iterate the writes for the versions")
+		}
+	}
+	iter.Close()
+	label := prefixLabelOf(written...)
+	if len(saved) == 0 && len(removed) == 0 {
+		return label, nil
+	}
+
+	if err := checkTxnOps(len(written) + len(saved) + len(removed)); err != nil {
+		return "", err
+	}
+	for _, key := range saved {
+		if err := checkValueSize(string(key), maxVersionSize); err != nil {
+			return "", err
+		}
+	}
+	version := []byte(strconv.FormatUint(txn.StartTS(), 10))
+	for _, key := range saved {
+		if err := txn.Set(key, version); err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("Failed to set version %s", string(key)))
+		}
+	}
+	for _, key := range removed {
+		if err := txn.Delete(key); err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("Failed to remove version %s", string(key)))
+		}
+	}
+	return label, nil
+}
+
+// readVersions returns the committed versions of the full keys as of the start of txn, ignoring
+// the writes buffered in txn.
+func readVersions(ctx context.Context, txn *transaction.KVTxn, keys [][]byte) ([]int64, error) {
+	reads := make([][]byte, 0, 2*len(keys))
+	for _, key := range keys {
+		reads = append(reads, key, versionKey(string(key)))
+	}
+	values, err := txn.GetSnapshot().BatchGet(ctx, reads)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read the versions")
+	}
+	versions := make([]int64, len(keys))
+	for i, key := range keys {
+		if value, ok := values[string(versionKey(string(key)))]; ok {
+			versions[i], err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Failed to parse the version of %s", string(key)))
+			}
+		} else if _, ok := values[string(key)]; ok {
+			versions[i] = 1
+		}
+	}
+	return versions, nil
+}
+
+// LoadWithVersion returns the value of key and its version, which CompareVersionAndSwap compares with.
+// The version of key must be kept, see WithVersionedPrefixes.
+func (kv *txnTiKV) LoadWithVersion(key string) (_ string, _ int64, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "LoadWithVersion", key, 1, start)
+	fullKey := path.Join(kv.rootPath, key)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV LoadWithVersion() error", zap.String("key", fullKey))
+
+	if loggingErr = kv.checkVersioned(fullKey); loggingErr != nil {
+		return "", 0, loggingErr
+	}
+
+	txn, err := startTxn(client)
+	if err != nil {
+		loggingErr = errors.Wrap(err, "Failed to build transaction for LoadWithVersion")
+		return "", 0, loggingErr
+	}
+	// the transaction is only read
+	defer txn.Rollback()
+
+	val, err := txn.Get(ctx, []byte(fullKey))
+	if err != nil {
+		if tikverr.IsErrNotFound(err) {
+			loggingErr = common.NewKeyNotExistError(fullKey)
+		} else {
+			loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to read key %s for LoadWithVersion", fullKey))
+		}
+		return "", 0, loggingErr
+	}
+	versions, err := readVersions(ctx, txn, [][]byte{[]byte(fullKey)})
+	if err != nil {
+		loggingErr = err
+		return "", 0, loggingErr
+	}
+	kv.checkSlowOp(start, "LoadWithVersion", 1, 0, zap.String("key", fullKey))
+	value, err := convertEmptyByteToString(val)
+	if err != nil {
+		loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to decode key %s for LoadWithVersion", fullKey))
+		return "", 0, loggingErr
+	}
+	return value, versions[0], nil
+}
+
+// CompareVersionAndSwap saves target at key if the version of key is version, returning whether it's
+// saved. Like etcd, version 0 saves target only if key doesn't exist. The version is kept in a
+// sidecar entry changed by every write of key, which must be under WithVersionedPrefixes, see
+// LoadWithVersion and bumpVersions. Unlike etcd, it's not a count of the writes. Concurrent swaps
+// conflict on key, the losers are retried, see WithConflictRetry, and fail the comparison then, so
+// only one of the swaps of a version wins.
+func (kv *txnTiKV) CompareVersionAndSwap(key string, version int64, target string) (_ bool, err error) {
+	client, release := kv.acquireClient()
+	defer release()
+	start := time.Now()
+	defer kv.finishOp(&err, "CompareVersionAndSwap", key, 1, start)
+	fullKey := path.Join(kv.rootPath, key)
+	ctx, cancel := withTimeout(kv.baseContext(), kv.timeout())
+	defer cancel()
+
+	var loggingErr error
+	defer logWarnOnFailure(&loggingErr, "txnTiKV CompareVersionAndSwap() error", zap.String("key", fullKey), zap.Int64("version", version), namedValueField("target", fullKey, target))
+
+	if loggingErr = kv.checkVersioned(fullKey); loggingErr != nil {
+		return false, loggingErr
+	}
+	byteValue, err := convertEmptyStringToByte(target)
+	if err != nil {
+		loggingErr = errors.Wrap(err, fmt.Sprintf("Failed to cast to byte (%s:%s) for CompareVersionAndSwap", fullKey, redactValue(fullKey, target)))
+		return false, loggingErr
+	}
+	byteValue = kv.compressValue(byteValue)
+	if loggingErr = checkValueSize(fullKey, len(byteValue)); loggingErr != nil {
+		return false, loggingErr
+	}
+
+	swapped := false
+	swap := func() error {
+		txn, err := startTxn(client)
+		if err != nil {
+			return errors.Wrap(err, "Failed to create txn for CompareVersionAndSwap")
+		}
+
+		// Rollback whenever this attempt is not committed
+		var attemptErr error
+		defer rollbackOnFailure(&attemptErr, txn)
+
+		versions, err := readVersions(ctx, txn, [][]byte{[]byte(fullKey)})
+		if err != nil {
+			attemptErr = err
+			return attemptErr
+		}
+		if versions[0] != version {
+			swapped = false
+			return txn.Rollback()
+		}
+		if err = txn.Set([]byte(fullKey), byteValue); err != nil {
+			attemptErr = errors.Wrap(err, fmt.Sprintf("Failed to set (%s:%s) for CompareVersionAndSwap", fullKey, redactValue(fullKey, target)))
+			return attemptErr
+		}
+		if err = kv.executeTxn(txn, ctx); err != nil {
+			attemptErr = errors.Wrap(err, "Failed to commit for CompareVersionAndSwap")
+			return attemptErr
+		}
+		swapped = true
+		return nil
+	}
+
+	err = kv.retryOnConflict(ctx, swap)
+	if err != nil {
+		loggingErr = err
+		return false, loggingErr
+	}
+	kv.checkSlowOp(start, "CompareVersionAndSwap", 1, len(target), zap.String("key", fullKey), zap.Bool("swapped", swapped))
+	if swapped {
+		kv.hooks.NotifySave(map[string]string{key: target})
+	}
+	return swapped, nil
+}
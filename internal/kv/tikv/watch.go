@@ -0,0 +1,340 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tikv
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/common"
+	"github.com/milvus-io/milvus/pkg/log"
+)
+
+// DefaultWatchInterval is the interval the watchers poll TiKV at, see WithWatchInterval.
+const DefaultWatchInterval = time.Second
+
+// WithWatchInterval makes the watchers of Watch and WatchWithPrefix poll TiKV every interval instead
+// of DefaultWatchInterval. A shorter interval reports the changes sooner at the cost of more scans.
+func WithWatchInterval(interval time.Duration) Option {
+	return func(kv *txnTiKV) {
+		kv.watchInterval = interval
+	}
+}
+
+// WatchEventType is the type of a WatchEvent.
+type WatchEventType int
+
+const (
+	WatchEventPut WatchEventType = iota + 1
+	WatchEventDelete
+)
+
+func (t WatchEventType) String() string {
+	switch t {
+	case WatchEventPut:
+		return "PUT"
+	case WatchEventDelete:
+		return "DELETE"
+	default:
+		return "Unknown"
+	}
+}
+
+// WatchEvent is a change of a key observed by a Watcher.
+type WatchEvent struct {
+	Type WatchEventType
+	// Key is relative to the root path, like the keys of Save.
+	Key string
+	// Value is the new value of a put, empty for a delete.
+	Value string
+	// PrevValue is the value before the change, empty for a put of a new key.
+	PrevValue string
+}
+
+// Watcher emulates an etcd watch on TiKV, which has no native watch, by polling a key or a prefix
+// every DefaultWatchInterval, or the interval of WithWatchInterval, and diffing each result against
+// the previous one. A poll reads the values and their versions, see LoadWithVersion, at one TS, so
+// it never sees a part of a transaction, and a key is reported as put when its value changes, or its
+// version if it's versioned, see WithVersionedPrefixes, so a versioned key saved again with the same
+// value is reported too. The changes are observed at the granularity of the polls:
+// the writes of a key between two polls are merged into one event, e.g. a key saved and removed
+// between two polls is not reported at all.
+// The delivery is at least once: each change of the keys since the previous poll is reported, but a
+// consumer may see a put of a value it already has, so the consumers must be idempotent. The events
+// of a poll are in key order rather than in commit order, so the consumers must not assume the order
+// of the writes of different keys either.
+// Events are never dropped, the poller waits for the consumer to take them, so the next poll is
+// delayed by a slow consumer. A failed poll is retried on the next tick, and its changes are
+// reported by the next successful one against the last reported state.
+type Watcher struct {
+	kv       *txnTiKV
+	key      string
+	isPrefix bool
+	interval time.Duration
+	events   chan WatchEvent
+	// state is the last reported contents of the key or the prefix, keyed by relative keys
+	state    map[string]watchedValue
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// watchedValue is the value of a watched key and its version.
+type watchedValue struct {
+	value   string
+	version int64
+}
+
+// watcherSet is the set of the open watchers of an instance, closed by the Close of the instance.
+type watcherSet struct {
+	mu       sync.Mutex
+	watchers map[*Watcher]struct{}
+	closed   bool
+}
+
+func (s *watcherSet) add(w *Watcher) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.watchers == nil {
+		s.watchers = make(map[*Watcher]struct{})
+	}
+	s.watchers[w] = struct{}{}
+	return true
+}
+
+func (s *watcherSet) remove(w *Watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.watchers, w)
+}
+
+// close closes the watchers, and the ones created after it at once.
+func (s *watcherSet) close() {
+	s.mu.Lock()
+	s.closed = true
+	watchers := s.watchers
+	s.watchers = nil
+	s.mu.Unlock()
+	for w := range watchers {
+		w.Close()
+	}
+}
+
+// Watch watches key, see Watcher. The changes after Watch returns are reported, the current value is
+// not. It returns an error if the key can't be read to start the watch. The watcher is closed by the
+// Close of the instance if it's not closed before.
+func (kv *txnTiKV) Watch(key string) (_ *Watcher, err error) {
+	defer kv.finishOp(&err, "Watch", key, 1, time.Now())
+	return kv.newWatcher(key, false)
+}
+
+// WatchWithPrefix watches the keys with prefix, see Watcher. The changes after WatchWithPrefix
+// returns are reported, the current keys are not. It returns an error if the prefix can't be
+// scanned to start the watch. The watcher is closed by the Close of the instance if it's not closed
+// before.
+func (kv *txnTiKV) WatchWithPrefix(prefix string) (_ *Watcher, err error) {
+	defer kv.finishOp(&err, "WatchWithPrefix", prefix, 1, time.Now())
+	return kv.newWatcher(prefix, true)
+}
+
+func (kv *txnTiKV) newWatcher(key string, isPrefix bool) (*Watcher, error) {
+	interval := kv.watchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	w := &Watcher{
+		kv:       kv,
+		key:      key,
+		isPrefix: isPrefix,
+		interval: interval,
+		events:   make(chan WatchEvent),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	state, err := w.poll()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read the initial state of the watch")
+	}
+	w.state = state
+	if !kv.watchers.add(w) {
+		return nil, errors.New("txnTiKV is closed")
+	}
+	go w.run()
+	return w, nil
+}
+
+// Events returns the channel of the events, which is closed once the watcher is closed.
+func (w *Watcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Close stops the poller and closes the channel of the events, an event not taken yet is dropped.
+// Closing again is harmless.
+func (w *Watcher) Close() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+	w.kv.watchers.remove(w)
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	defer close(w.events)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		state, err := w.poll()
+		if err != nil {
+			log.Warn("txnTiKV watch failed to poll, retry on next tick", zap.String("key", path.Join(w.kv.rootPath, w.key)), zap.Bool("isPrefix", w.isPrefix), zap.Error(err))
+			continue
+		}
+		for _, event := range diffWatchState(w.state, state) {
+			select {
+			case w.events <- event:
+			case <-w.stop:
+				return
+			}
+		}
+		w.state = state
+	}
+}
+
+// poll returns the current contents of the key or the prefix, read at one TS.
+func (w *Watcher) poll() (map[string]watchedValue, error) {
+	ts, err := w.kv.CurrentTS()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := w.kv.NewSnapshotReader(ts)
+	if err != nil {
+		return nil, err
+	}
+	view := reader.kv
+
+	state := make(map[string]watchedValue)
+	fullKey := path.Join(w.kv.rootPath, w.key)
+	if !w.isPrefix {
+		value, err := view.load(w.key, view.replicaRead)
+		if common.IsKeyNotExistError(err) {
+			return state, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var versions map[string]int64
+		if w.kv.isVersioned(fullKey) {
+			// the end of the range of the key alone
+			versions, err = view.loadVersions(versionKey(fullKey), append(versionKey(fullKey), 0))
+			if err != nil {
+				return nil, err
+			}
+		}
+		state[w.key] = watchedValue{value: value, version: versionOf(versions, fullKey)}
+		return state, nil
+	}
+	keys, values, err := view.loadWithPrefix(w.key, view.replicaRead)
+	if err != nil {
+		return nil, err
+	}
+	var versions map[string]int64
+	if len(w.kv.versionedPrefixes) > 0 {
+		versions, err = view.loadVersions(versionKey(fullKey), prefixEnd(versionKey(fullKey)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, key := range keys {
+		state[w.kv.relativeKey(key)] = watchedValue{value: values[i], version: versionOf(versions, key)}
+	}
+	return state, nil
+}
+
+// loadVersions returns the versions of the sidecar keys in [startKey, endKey), keyed by full keys.
+func (kv *txnTiKV) loadVersions(startKey, endKey []byte) (map[string]int64, error) {
+	client, release := kv.acquireClient()
+	defer release()
+	ctx, cancel := withTimeout(kv.baseContext(), ScanTimeout)
+	defer cancel()
+
+	ss := kv.snapshot(client, kv.snapshotScanSize(), kv.replicaRead)
+	iter, err := ss.Iter(startKey, endKey)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Failed to create iterater for versions %s", string(startKey)))
+	}
+	defer iter.Close()
+
+	versions := make(map[string]int64)
+	for iter.Valid() {
+		if err = ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Loading versions stopped before key %s", string(iter.Key())))
+		}
+		version, err := strconv.ParseInt(string(iter.Value()), 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Failed to parse the version of %s", string(iter.Key())))
+		}
+		versions[strings.TrimPrefix(string(iter.Key()), versionKeyPrefix)] = version
+		if err = iter.Next(); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Failed to move Iterator after key %s for versions", string(iter.Key())))
+		}
+	}
+	return versions, nil
+}
+
+// versionOf returns the version of the existing full key, 1 without a sidecar like readVersions.
+func versionOf(versions map[string]int64, fullKey string) int64 {
+	if version, ok := versions[fullKey]; ok {
+		return version
+	}
+	return 1
+}
+
+// diffWatchState returns the events changing prev into cur, in key order.
+func diffWatchState(prev, cur map[string]watchedValue) []WatchEvent {
+	events := make([]WatchEvent, 0)
+	for key, value := range cur {
+		prevValue, ok := prev[key]
+		if !ok || prevValue != value {
+			events = append(events, WatchEvent{Type: WatchEventPut, Key: key, Value: value.value, PrevValue: prevValue.value})
+		}
+	}
+	for key, prevValue := range prev {
+		if _, ok := cur[key]; !ok {
+			events = append(events, WatchEvent{Type: WatchEventDelete, Key: key, PrevValue: prevValue.value})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
@@ -0,0 +1,168 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/log"
+)
+
+// WriteOpType is the type of a write applied to kv.
+type WriteOpType int
+
+const (
+	WriteOpSave WriteOpType = iota + 1
+	WriteOpRemove
+	WriteOpRemoveWithPrefix
+)
+
+func (t WriteOpType) String() string {
+	switch t {
+	case WriteOpSave:
+		return "Save"
+	case WriteOpRemove:
+		return "Remove"
+	case WriteOpRemoveWithPrefix:
+		return "RemoveWithPrefix"
+	default:
+		return "Unknown"
+	}
+}
+
+// WriteOp describes a committed write. Keys are relative to the kv root path.
+type WriteOp struct {
+	Type WriteOpType
+	// Keys are the saved or removed keys, empty for WriteOpRemoveWithPrefix.
+	Keys []string
+	// Values are the saved values in the same order as Keys, only set for WriteOpSave.
+	Values []string
+	// Prefix is the removed prefix, only set for WriteOpRemoveWithPrefix.
+	Prefix string
+}
+
+// filter returns the part of op affecting keys with prefix, and whether there is any.
+func (op WriteOp) filter(prefix string) (WriteOp, bool) {
+	if op.Type == WriteOpRemoveWithPrefix {
+		// removed range overlaps with the hooked one
+		return op, strings.HasPrefix(op.Prefix, prefix) || strings.HasPrefix(prefix, op.Prefix)
+	}
+	filtered := WriteOp{Type: op.Type}
+	for i, key := range op.Keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		filtered.Keys = append(filtered.Keys, key)
+		if i < len(op.Values) {
+			filtered.Values = append(filtered.Values, op.Values[i])
+		}
+	}
+	return filtered, len(filtered.Keys) > 0
+}
+
+type writeHook struct {
+	prefix string
+	fn     func(op WriteOp)
+}
+
+// WriteHooks holds the hooks notified of writes committed through one kv instance.
+// The zero value is ready to use.
+type WriteHooks struct {
+	mu    sync.RWMutex
+	hooks []writeHook
+}
+
+// Register adds a hook invoked with the writes affecting keys with prefix.
+func (h *WriteHooks) Register(prefix string, fn func(op WriteOp)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, writeHook{prefix: prefix, fn: fn})
+}
+
+// NotifySave notifies the hooks of saving kvs, keys are sorted.
+func (h *WriteHooks) NotifySave(kvs map[string]string) {
+	if len(kvs) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(kvs))
+	for key := range kvs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, kvs[key])
+	}
+	h.Notify(WriteOp{Type: WriteOpSave, Keys: keys, Values: values})
+}
+
+// NotifySaveBytes is NotifySave of byte values, which are copied into strings only if any hook is registered.
+func (h *WriteHooks) NotifySaveBytes(kvs map[string][]byte) {
+	h.mu.RLock()
+	registered := len(h.hooks) > 0
+	h.mu.RUnlock()
+	if !registered || len(kvs) == 0 {
+		return
+	}
+	values := make(map[string]string, len(kvs))
+	for key, value := range kvs {
+		values[key] = string(value)
+	}
+	h.NotifySave(values)
+}
+
+// NotifyRemove notifies the hooks of removing keys.
+func (h *WriteHooks) NotifyRemove(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	h.Notify(WriteOp{Type: WriteOpRemove, Keys: keys})
+}
+
+// NotifyRemoveWithPrefix notifies the hooks of removing all keys with prefix.
+func (h *WriteHooks) NotifyRemoveWithPrefix(prefix string) {
+	h.Notify(WriteOp{Type: WriteOpRemoveWithPrefix, Prefix: prefix})
+}
+
+// Notify invokes the matching hooks synchronously with each op.
+// A panicking hook is logged and does not affect the others.
+func (h *WriteHooks) Notify(ops ...WriteOp) {
+	h.mu.RLock()
+	hooks := h.hooks
+	h.mu.RUnlock()
+
+	for _, hook := range hooks {
+		for _, op := range ops {
+			if filtered, ok := op.filter(hook.prefix); ok {
+				invokeWriteHook(hook, filtered)
+			}
+		}
+	}
+}
+
+func invokeWriteHook(hook writeHook, op WriteOp) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Warn("kv write hook panicked", zap.String("prefix", hook.prefix), zap.Stringer("op", op.Type), zap.Any("recover", r))
+		}
+	}()
+	hook.fn(op)
+}
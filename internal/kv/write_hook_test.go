@@ -0,0 +1,87 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteHooks(t *testing.T) {
+	t.Run("filter by prefix", func(t *testing.T) {
+		hooks := &WriteHooks{}
+		var ops []WriteOp
+		hooks.Register("a/", func(op WriteOp) {
+			ops = append(ops, op)
+		})
+
+		hooks.NotifySave(map[string]string{"a/2": "v2", "b/1": "v3", "a/1": "v1"})
+		hooks.NotifySave(map[string]string{"b/1": "v"})
+		hooks.NotifyRemove("b/1", "a/3")
+		hooks.NotifyRemoveWithPrefix("a/sub")
+		hooks.NotifyRemoveWithPrefix("")
+		hooks.NotifyRemoveWithPrefix("b")
+
+		assert.Equal(t, []WriteOp{
+			{Type: WriteOpSave, Keys: []string{"a/1", "a/2"}, Values: []string{"v1", "v2"}},
+			{Type: WriteOpRemove, Keys: []string{"a/3"}},
+			{Type: WriteOpRemoveWithPrefix, Prefix: "a/sub"},
+			{Type: WriteOpRemoveWithPrefix, Prefix: ""},
+		}, ops)
+	})
+
+	t.Run("save bytes", func(t *testing.T) {
+		hooks := &WriteHooks{}
+		// nothing is converted without hooks
+		hooks.NotifySaveBytes(map[string][]byte{"a/1": []byte("v1")})
+
+		var ops []WriteOp
+		hooks.Register("", func(op WriteOp) {
+			ops = append(ops, op)
+		})
+		hooks.NotifySaveBytes(map[string][]byte{"a/2": {0, 0xff}, "a/1": []byte("v1")})
+		hooks.NotifySaveBytes(map[string][]byte{})
+
+		assert.Equal(t, []WriteOp{
+			{Type: WriteOpSave, Keys: []string{"a/1", "a/2"}, Values: []string{"v1", "\x00\xff"}},
+		}, ops)
+	})
+
+	t.Run("panic isolation", func(t *testing.T) {
+		hooks := &WriteHooks{}
+		called := 0
+		hooks.Register("", func(op WriteOp) {
+			panic("bad hook")
+		})
+		hooks.Register("", func(op WriteOp) {
+			called++
+		})
+
+		assert.NotPanics(t, func() {
+			hooks.NotifyRemove("key")
+		})
+		assert.Equal(t, 1, called)
+	})
+
+	t.Run("op type string", func(t *testing.T) {
+		assert.Equal(t, "Save", WriteOpSave.String())
+		assert.Equal(t, "Remove", WriteOpRemove.String())
+		assert.Equal(t, "RemoveWithPrefix", WriteOpRemoveWithPrefix.String())
+		assert.Equal(t, "Unknown", WriteOpType(0).String())
+	})
+}
@@ -56,13 +56,17 @@ func IsIgnorableError(err error) bool {
 
 var _ error = &KeyNotExistError{}
 
+// ErrKeyNotExist is matched by errors.Is for every KeyNotExistError, whatever its key.
+var ErrKeyNotExist = errors.New("key not exist")
+
 func NewKeyNotExistError(key string) error {
 	return &KeyNotExistError{key: key}
 }
 
+// IsKeyNotExistError returns whether err or any error it wraps is a KeyNotExistError.
 func IsKeyNotExistError(err error) bool {
-	_, ok := err.(*KeyNotExistError)
-	return ok
+	var target *KeyNotExistError
+	return errors.As(err, &target)
 }
 
 type KeyNotExistError struct {
@@ -72,3 +76,8 @@ type KeyNotExistError struct {
 func (k *KeyNotExistError) Error() string {
 	return fmt.Sprintf("there is no value on key = %s", k.key)
 }
+
+// Is makes errors.Is match ErrKeyNotExist.
+func (k *KeyNotExistError) Is(target error) bool {
+	return target == ErrKeyNotExist
+}
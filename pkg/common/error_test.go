@@ -34,4 +34,5 @@ func TestNotExistError(t *testing.T) {
 	err := errors.New("err")
 	assert.Equal(t, false, IsKeyNotExistError(err))
 	assert.Equal(t, true, IsKeyNotExistError(NewKeyNotExistError("foo")))
+	assert.Equal(t, true, IsKeyNotExistError(errors.Wrap(NewKeyNotExistError("foo"), "wrapped")))
 }
@@ -27,6 +27,10 @@ const (
 	MetaTxnLabel    = "txn"
 
 	metaOpType = "meta_op_type"
+	// metaOpName is the name of the operation of the kv layer, e.g. MultiSaveAndRemove
+	metaOpName = "meta_op_name"
+	// metaPrefix is the subsystem of the keys, by the prefix rules of the kv layer
+	metaPrefix = "meta_prefix"
 )
 
 var (
@@ -37,7 +41,7 @@ var (
 			Name:      "kv_size",
 			Help:      "kv size stats",
 			Buckets:   buckets,
-		}, []string{metaOpType})
+		}, []string{metaOpType, metaPrefix})
 
 	MetaRequestLatency = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -46,7 +50,7 @@ var (
 			Name:      "request_latency",
 			Help:      "request latency on the client side ",
 			Buckets:   buckets,
-		}, []string{metaOpType})
+		}, []string{metaOpType, metaPrefix})
 
 	MetaOpCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -55,6 +59,38 @@ var (
 			Name:      "op_count",
 			Help:      "count of meta operation",
 		}, []string{metaOpType, statusLabelName})
+
+	MetaLargestValueSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: milvusNamespace,
+			Subsystem: "meta",
+			Name:      "largest_value_size",
+			Help:      "size of the largest meta value observed",
+		})
+
+	MetaStorageHeadroomRatio = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: milvusNamespace,
+			Subsystem: "meta",
+			Name:      "storage_headroom_ratio",
+			Help:      "free ratio of the backend quota of the fullest meta storage member",
+		})
+
+	MetaSlowOpCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: milvusNamespace,
+			Subsystem: "meta",
+			Name:      "slow_op_count",
+			Help:      "count of meta operations slower than the slow operation threshold",
+		}, []string{metaOpName})
+
+	MetaClientSwapCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: milvusNamespace,
+			Subsystem: "meta",
+			Name:      "client_swap_count",
+			Help:      "count of meta storage client swaps on reconnect",
+		}, []string{statusLabelName})
 )
 
 // RegisterMetaMetrics registers meta metrics
@@ -62,4 +98,8 @@ func RegisterMetaMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(MetaKvSize)
 	registry.MustRegister(MetaRequestLatency)
 	registry.MustRegister(MetaOpCounter)
+	registry.MustRegister(MetaLargestValueSize)
+	registry.MustRegister(MetaStorageHeadroomRatio)
+	registry.MustRegister(MetaClientSwapCounter)
+	registry.MustRegister(MetaSlowOpCounter)
 }
@@ -102,6 +102,9 @@ type EtcdConfig struct {
 	EtcdTLSCACert     ParamItem          `refreshable:"false"`
 	EtcdTLSMinVersion ParamItem          `refreshable:"false"`
 
+	QuotaBackendBytes        ParamItem `refreshable:"true"`
+	StorageWarnHeadroomRatio ParamItem `refreshable:"true"`
+
 	// --- Embed ETCD ---
 	UseEmbedEtcd ParamItem `refreshable:"false"`
 	ConfigPath   ParamItem `refreshable:"false"`
@@ -257,23 +260,46 @@ We recommend using version 1.2 and above.`,
 		Export: true,
 	}
 	p.EtcdTLSMinVersion.Init(base.mgr)
+
+	p.QuotaBackendBytes = ParamItem{
+		Key:          "etcd.quotaBackendBytes",
+		DefaultValue: "2147483648",
+		Version:      "2.3.3",
+		Doc:          "backend quota of etcd in bytes, should be the same as the quota-backend-bytes of etcd server",
+		Export:       true,
+	}
+	p.QuotaBackendBytes.Init(base.mgr)
+
+	p.StorageWarnHeadroomRatio = ParamItem{
+		Key:          "etcd.storageWarnHeadroomRatio",
+		DefaultValue: "0.2",
+		Version:      "2.3.3",
+		Doc:          "etcd storage status turns to warning if the free ratio of backend quota is lower than this",
+		Export:       true,
+	}
+	p.StorageWarnHeadroomRatio.Init(base.mgr)
 }
 
 // /////////////////////////////////////////////////////////////////////////////
 // --- tikv ---
 type TiKVConfig struct {
-	Endpoints        ParamItem          `refreshable:"false"`
-	RootPath         ParamItem          `refreshable:"false"`
-	MetaSubPath      ParamItem          `refreshable:"false"`
-	KvSubPath        ParamItem          `refreshable:"false"`
-	MetaRootPath     CompositeParamItem `refreshable:"false"`
-	KvRootPath       CompositeParamItem `refreshable:"false"`
-	RequestTimeout   ParamItem          `refreshable:"true"`
-	SnapshotScanSize ParamItem          `refreshable:"true"`
-	TiKVUseSSL       ParamItem          `refreshable:"false"`
-	TiKVTLSCert      ParamItem          `refreshable:"false"`
-	TiKVTLSKey       ParamItem          `refreshable:"false"`
-	TiKVTLSCACert    ParamItem          `refreshable:"false"`
+	Endpoints         ParamItem          `refreshable:"false"`
+	RootPath          ParamItem          `refreshable:"false"`
+	MetaSubPath       ParamItem          `refreshable:"false"`
+	KvSubPath         ParamItem          `refreshable:"false"`
+	MetaRootPath      CompositeParamItem `refreshable:"false"`
+	KvRootPath        CompositeParamItem `refreshable:"false"`
+	RequestTimeout    ParamItem          `refreshable:"true"`
+	ScanTimeout       ParamItem          `refreshable:"true"`
+	SnapshotScanSize  ParamItem          `refreshable:"true"`
+	MaxTxnOps         ParamItem          `refreshable:"true"`
+	SlowOpThreshold   ParamItem          `refreshable:"true"`
+	TxnEntrySizeLimit ParamItem          `refreshable:"true"`
+	WriteValueHeader  ParamItem          `refreshable:"false"`
+	TiKVUseSSL        ParamItem          `refreshable:"false"`
+	TiKVTLSCert       ParamItem          `refreshable:"false"`
+	TiKVTLSKey        ParamItem          `refreshable:"false"`
+	TiKVTLSCACert     ParamItem          `refreshable:"false"`
 }
 
 func (p *TiKVConfig) Init(base *BaseTable) {
@@ -334,11 +360,20 @@ func (p *TiKVConfig) Init(base *BaseTable) {
 		Key:          "tikv.requestTimeout",
 		Version:      "2.3.0",
 		DefaultValue: "10000",
-		Doc:          "ms, tikv request timeout",
+		Doc:          "ms, tikv request timeout, 0 means no timeout",
 		Export:       true,
 	}
 	p.RequestTimeout.Init(base.mgr)
 
+	p.ScanTimeout = ParamItem{
+		Key:          "tikv.scanTimeout",
+		Version:      "2.3.3",
+		DefaultValue: "0",
+		Doc:          "ms, timeout of a tikv prefix scan, which may take much longer than a request, 0 means no timeout",
+		Export:       true,
+	}
+	p.ScanTimeout.Init(base.mgr)
+
 	p.SnapshotScanSize = ParamItem{
 		Key:          "tikv.snapshotScanSize",
 		Version:      "2.3.0",
@@ -348,6 +383,43 @@ func (p *TiKVConfig) Init(base *BaseTable) {
 	}
 	p.SnapshotScanSize.Init(base.mgr)
 
+	p.MaxTxnOps = ParamItem{
+		Key:          "tikv.maxTxnOps",
+		Version:      "2.3.3",
+		DefaultValue: "0",
+		Doc:          "max number of operations in one tikv transaction of MultiSave and MultiSaveAndRemove, 0 means no limit",
+		Export:       true,
+	}
+	p.MaxTxnOps.Init(base.mgr)
+
+	p.SlowOpThreshold = ParamItem{
+		Key:          "tikv.slowOpThreshold",
+		Version:      "2.3.3",
+		DefaultValue: "2000",
+		Doc:          "ms, tikv operations taking longer are logged as slow and counted, 0 disables the check",
+		Export:       true,
+	}
+	p.SlowOpThreshold.Init(base.mgr)
+
+	p.TxnEntrySizeLimit = ParamItem{
+		Key:          "tikv.txnEntrySizeLimit",
+		Version:      "2.3.3",
+		DefaultValue: "6291456",
+		Doc:          "bytes, max size of a key and its value written to tikv, the txn-entry-size-limit of tikv, a larger value is rejected before its transaction starts, 0 disables the check",
+		Export:       true,
+	}
+	p.TxnEntrySizeLimit.Init(base.mgr)
+
+	p.WriteValueHeader = ParamItem{
+		Key:          "tikv.writeValueHeader",
+		Version:      "2.3.3",
+		DefaultValue: "false",
+		Doc: `whether to write the values to tikv with the value header, which the nodes before 2.3.3 read as corrupted values.
+The nodes since 2.3.3 read both encodings whatever the setting, enable it only once every node sharing tikv is upgraded.`,
+		Export: true,
+	}
+	p.WriteValueHeader.Init(base.mgr)
+
 	p.TiKVUseSSL = ParamItem{
 		Key:          "tikv.ssl.enabled",
 		DefaultValue: "false",
@@ -76,6 +76,12 @@ func TestServiceParam(t *testing.T) {
 		assert.NotEqual(t, Params.KvRootPath, "")
 		t.Logf("kv root path = %s", Params.KvRootPath.GetValue())
 
+		assert.Equal(t, 10*time.Second, Params.RequestTimeout.GetAsDuration(time.Millisecond))
+		assert.Equal(t, time.Duration(0), Params.ScanTimeout.GetAsDuration(time.Millisecond))
+		assert.Equal(t, 2*time.Second, Params.SlowOpThreshold.GetAsDuration(time.Millisecond))
+		assert.Equal(t, 6*1024*1024, Params.TxnEntrySizeLimit.GetAsInt())
+		assert.False(t, Params.WriteValueHeader.GetAsBool())
+
 		t.Setenv(metricsinfo.DeployModeEnvKey, metricsinfo.StandaloneDeployMode)
 		SParams.init(bt)
 	})
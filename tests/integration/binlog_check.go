@@ -0,0 +1,197 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus/internal/proto/datapb"
+	"github.com/milvus-io/milvus/internal/storage"
+	"github.com/milvus-io/milvus/pkg/common"
+	"github.com/milvus-io/milvus/pkg/util/metautil"
+)
+
+var (
+	// binlogCheckQPS bounds the rate of the storage calls of VerifyBinlogExistence.
+	binlogCheckQPS = 100
+	// orphanBinlogSampleSize is the max number of orphan objects reported by VerifyBinlogExistence.
+	orphanBinlogSampleSize = 20
+)
+
+// BinlogExistenceReport is the result of VerifyBinlogExistence.
+type BinlogExistenceReport struct {
+	CollectionID int64
+	// Checked is the number of paths checked for existence.
+	Checked int
+	// Missing are the paths referenced by the meta but not in the object storage, by segment id.
+	Missing map[int64][]string
+	// Orphans are a sample of the objects of the collection not referenced by the meta.
+	Orphans []string
+}
+
+// OK returns whether no referenced path is missing.
+func (report *BinlogExistenceReport) OK() bool {
+	return len(report.Missing) == 0
+}
+
+func (report *BinlogExistenceReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "binlogs of collection %d: %d checked, %d segments with missing objects, %d orphans sampled\n",
+		report.CollectionID, report.Checked, len(report.Missing), len(report.Orphans))
+	segmentIDs := make([]int64, 0, len(report.Missing))
+	for segmentID := range report.Missing {
+		segmentIDs = append(segmentIDs, segmentID)
+	}
+	sort.Slice(segmentIDs, func(i, j int) bool { return segmentIDs[i] < segmentIDs[j] })
+	for _, segmentID := range segmentIDs {
+		fmt.Fprintf(&sb, "  segment %d missing:\n", segmentID)
+		for _, logPath := range report.Missing[segmentID] {
+			fmt.Fprintf(&sb, "    %s\n", logPath)
+		}
+	}
+	if len(report.Orphans) > 0 {
+		sb.WriteString("  orphans:\n")
+		for _, orphan := range report.Orphans {
+			fmt.Fprintf(&sb, "    %s\n", orphan)
+		}
+	}
+	return sb.String()
+}
+
+// segmentLogPaths returns the paths of the binlogs, delta logs and stats logs of the segment,
+// the logs saved with log ids only are resolved under rootPath.
+func segmentLogPaths(rootPath string, segment *datapb.SegmentInfo, binlogs, deltalogs, statslogs []*datapb.FieldBinlog) []string {
+	collectionID, partitionID, segmentID := segment.GetCollectionID(), segment.GetPartitionID(), segment.GetID()
+	var paths []string
+	collect := func(build func(fieldID, logID int64) string, groups ...[]*datapb.FieldBinlog) {
+		for _, fieldBinlogs := range groups {
+			for _, fieldBinlog := range fieldBinlogs {
+				for _, binlog := range fieldBinlog.GetBinlogs() {
+					logPath := binlog.GetLogPath()
+					if logPath == "" {
+						logPath = build(fieldBinlog.GetFieldID(), binlog.GetLogID())
+					}
+					paths = append(paths, logPath)
+				}
+			}
+		}
+	}
+	// segments saved in legacy format keep the logs inline
+	collect(func(fieldID, logID int64) string {
+		return metautil.BuildInsertLogPath(rootPath, collectionID, partitionID, segmentID, fieldID, logID)
+	}, binlogs, segment.GetBinlogs())
+	collect(func(fieldID, logID int64) string {
+		return metautil.BuildDeltaLogPath(rootPath, collectionID, partitionID, segmentID, logID)
+	}, deltalogs, segment.GetDeltalogs())
+	collect(func(fieldID, logID int64) string {
+		return metautil.BuildStatsLogPath(rootPath, collectionID, partitionID, segmentID, fieldID, logID)
+	}, statslogs, segment.GetStatslogs())
+	return paths
+}
+
+// VerifyBinlogExistence checks the binlogs, delta logs and stats logs referenced by the segment meta
+// of the collection exist in the object storage, and samples the objects of the collection no segment
+// refers to. The logs of dropped segments are not checked since they are being garbage collected,
+// but they are still references. The storage calls are rate limited by binlogCheckQPS.
+func VerifyBinlogExistence(ctx context.Context, watcher MetaWatcher, chunkManager storage.ChunkManager, collectionID int64) (*BinlogExistenceReport, error) {
+	segments, err := watcher.ShowSegments()
+	if err != nil {
+		return nil, err
+	}
+	binlogs, err := watcher.ShowBinlogs(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	deltalogs, err := watcher.ShowDeltalogs(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	statslogs, err := watcher.ShowStatslogs(collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	throttle := time.NewTicker(time.Second / time.Duration(binlogCheckQPS))
+	defer throttle.Stop()
+	wait := func() error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-throttle.C:
+			return nil
+		}
+	}
+
+	rootPath := chunkManager.RootPath()
+	report := &BinlogExistenceReport{
+		CollectionID: collectionID,
+		Missing:      make(map[int64][]string),
+	}
+	referenced := make(map[string]struct{})
+	for _, segment := range segments {
+		if segment.GetCollectionID() != collectionID {
+			continue
+		}
+		segmentID := segment.GetID()
+		paths := segmentLogPaths(rootPath, segment, binlogs[segmentID], deltalogs[segmentID], statslogs[segmentID])
+		for _, logPath := range paths {
+			referenced[logPath] = struct{}{}
+		}
+		if segment.GetState() == commonpb.SegmentState_Dropped {
+			continue
+		}
+		for _, logPath := range paths {
+			if err := wait(); err != nil {
+				return nil, err
+			}
+			exist, err := chunkManager.Exist(ctx, logPath)
+			if err != nil {
+				return nil, err
+			}
+			report.Checked++
+			if !exist {
+				report.Missing[segmentID] = append(report.Missing[segmentID], logPath)
+			}
+		}
+	}
+
+	for _, logRoot := range []string{common.SegmentInsertLogPath, common.SegmentDeltaLogPath, common.SegmentStatslogPath} {
+		if err := wait(); err != nil {
+			return nil, err
+		}
+		objects, _, err := chunkManager.ListWithPrefix(ctx, path.Join(rootPath, logRoot, fmt.Sprint(collectionID))+"/", true)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(objects)
+		for _, object := range objects {
+			if len(report.Orphans) >= orphanBinlogSampleSize {
+				return report, nil
+			}
+			if _, ok := referenced[object]; !ok {
+				report.Orphans = append(report.Orphans, object)
+			}
+		}
+	}
+	return report, nil
+}
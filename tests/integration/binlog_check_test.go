@@ -0,0 +1,171 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus/internal/proto/datapb"
+	"github.com/milvus-io/milvus/internal/storage"
+	"github.com/milvus-io/milvus/pkg/log"
+	"github.com/milvus-io/milvus/pkg/util/funcutil"
+	"github.com/milvus-io/milvus/pkg/util/metautil"
+)
+
+type binlogsMetaWatcher struct {
+	segmentsMetaWatcher
+	binlogs   map[int64][]*datapb.FieldBinlog
+	deltalogs map[int64][]*datapb.FieldBinlog
+	statslogs map[int64][]*datapb.FieldBinlog
+}
+
+func (watcher *binlogsMetaWatcher) ShowBinlogs(collectionID int64) (map[int64][]*datapb.FieldBinlog, error) {
+	return watcher.binlogs, nil
+}
+
+func (watcher *binlogsMetaWatcher) ShowDeltalogs(collectionID int64) (map[int64][]*datapb.FieldBinlog, error) {
+	return watcher.deltalogs, nil
+}
+
+func (watcher *binlogsMetaWatcher) ShowStatslogs(collectionID int64) (map[int64][]*datapb.FieldBinlog, error) {
+	return watcher.statslogs, nil
+}
+
+func TestVerifyBinlogExistence(t *testing.T) {
+	ctx := context.Background()
+	rootPath := t.TempDir()
+	chunkManager := storage.NewLocalChunkManager(storage.RootPath(rootPath))
+
+	fieldBinlogs := func(fieldID int64, logIDs ...int64) []*datapb.FieldBinlog {
+		binlogs := make([]*datapb.Binlog, 0, len(logIDs))
+		for _, logID := range logIDs {
+			binlogs = append(binlogs, &datapb.Binlog{LogID: logID})
+		}
+		return []*datapb.FieldBinlog{{FieldID: fieldID, Binlogs: binlogs}}
+	}
+	watcher := &binlogsMetaWatcher{
+		segmentsMetaWatcher: segmentsMetaWatcher{segments: []*datapb.SegmentInfo{
+			{ID: 1, CollectionID: 100, PartitionID: 10, State: commonpb.SegmentState_Flushed},
+			{ID: 2, CollectionID: 100, PartitionID: 10, State: commonpb.SegmentState_Dropped},
+			// legacy segment keeping the logs inline, with the log path
+			{ID: 3, CollectionID: 100, PartitionID: 10, State: commonpb.SegmentState_Flushed, Binlogs: []*datapb.FieldBinlog{{
+				FieldID: 101,
+				Binlogs: []*datapb.Binlog{{LogPath: metautil.BuildInsertLogPath(rootPath, 100, 10, 3, 101, 1)}},
+			}}},
+		}},
+		binlogs: map[int64][]*datapb.FieldBinlog{
+			1: fieldBinlogs(101, 1, 2),
+			2: fieldBinlogs(101, 1),
+		},
+		deltalogs: map[int64][]*datapb.FieldBinlog{1: fieldBinlogs(0, 3)},
+		statslogs: map[int64][]*datapb.FieldBinlog{1: fieldBinlogs(100, 4)},
+	}
+	objects := []string{
+		metautil.BuildInsertLogPath(rootPath, 100, 10, 1, 101, 1),
+		metautil.BuildInsertLogPath(rootPath, 100, 10, 1, 101, 2),
+		metautil.BuildDeltaLogPath(rootPath, 100, 10, 1, 3),
+		metautil.BuildStatsLogPath(rootPath, 100, 10, 1, 100, 4),
+		metautil.BuildInsertLogPath(rootPath, 100, 10, 3, 101, 1),
+		// the log of the dropped segment is referenced though it's not checked
+		metautil.BuildInsertLogPath(rootPath, 100, 10, 2, 101, 1),
+	}
+	for _, object := range objects {
+		require.NoError(t, chunkManager.Write(ctx, object, []byte("binlog")))
+	}
+
+	report, err := VerifyBinlogExistence(ctx, watcher, chunkManager, 100)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, 5, report.Checked)
+	assert.Empty(t, report.Orphans)
+
+	require.NoError(t, chunkManager.Remove(ctx, objects[1]))
+	require.NoError(t, chunkManager.Remove(ctx, objects[2]))
+	orphan := metautil.BuildStatsLogPath(rootPath, 100, 10, 4, 100, 5)
+	require.NoError(t, chunkManager.Write(ctx, orphan, []byte("binlog")))
+
+	report, err = VerifyBinlogExistence(ctx, watcher, chunkManager, 100)
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, map[int64][]string{1: {objects[1], objects[2]}}, report.Missing)
+	assert.Equal(t, []string{orphan}, report.Orphans)
+	assert.Contains(t, report.String(), "1 segments with missing objects, 1 orphans sampled")
+
+	defer func(size int) { orphanBinlogSampleSize = size }(orphanBinlogSampleSize)
+	orphanBinlogSampleSize = 1
+	require.NoError(t, chunkManager.Write(ctx, metautil.BuildInsertLogPath(rootPath, 100, 10, 4, 101, 6), []byte("binlog")))
+	report, err = VerifyBinlogExistence(ctx, watcher, chunkManager, 100)
+	require.NoError(t, err)
+	assert.Len(t, report.Orphans, 1)
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = VerifyBinlogExistence(cancelCtx, watcher, chunkManager, 100)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func (s *MetaWatcherSuite) TestVerifyBinlogExistence() {
+	c := s.Cluster
+	ctx, cancel := context.WithTimeout(c.GetContext(), 3*time.Minute)
+	defer cancel()
+
+	collectionName := "TestVerifyBinlogExistence" + funcutil.GenRandomStr()
+	collectionID, _ := s.prepareFlushedCollection(ctx, collectionName, 3000)
+
+	report, err := VerifyBinlogExistence(ctx, c.MetaWatcher, c.ChunkManager, collectionID)
+	s.Require().NoError(err)
+	s.True(report.OK(), report.String())
+	s.NotZero(report.Checked)
+
+	binlogs, err := c.MetaWatcher.ShowBinlogs(collectionID)
+	s.Require().NoError(err)
+	var segmentID int64
+	var removed string
+	for id, fieldBinlogs := range binlogs {
+		segmentID = id
+		binlog := fieldBinlogs[0].GetBinlogs()[0]
+		removed = binlog.GetLogPath()
+		if removed == "" {
+			segments, err := c.MetaWatcher.ShowSegments()
+			s.Require().NoError(err)
+			for _, segment := range segments {
+				if segment.GetID() == id {
+					removed = metautil.BuildInsertLogPath(c.ChunkManager.RootPath(), collectionID,
+						segment.GetPartitionID(), id, fieldBinlogs[0].GetFieldID(), binlog.GetLogID())
+				}
+			}
+		}
+		break
+	}
+	s.Require().NotEmpty(removed)
+	s.Require().NoError(c.ChunkManager.Remove(ctx, removed))
+	orphan := metautil.BuildInsertLogPath(c.ChunkManager.RootPath(), collectionID, 0, 0, 0, 0)
+	s.Require().NoError(c.ChunkManager.Write(ctx, orphan, []byte("orphan")))
+
+	report, err = VerifyBinlogExistence(ctx, c.MetaWatcher, c.ChunkManager, collectionID)
+	s.Require().NoError(err)
+	log.Info(report.String())
+	s.False(report.OK())
+	s.Equal(map[int64][]string{segmentID: {removed}}, report.Missing)
+	s.Contains(report.Orphans, orphan)
+}
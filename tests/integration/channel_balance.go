@@ -0,0 +1,129 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/milvus-io/milvus/pkg/util/typeutil"
+)
+
+var channelBalancePollInterval = 500 * time.Millisecond
+
+// channelAssignment is the channels watched per live datanode, nodes without channels are included.
+type channelAssignment map[int64][]string
+
+// listChannelAssignment groups the watched channels by live datanode.
+// Channels of collections being dropped and channels watched by dead nodes are excluded.
+func listChannelAssignment(watcher MetaWatcher) (channelAssignment, error) {
+	sessions, err := watcher.ShowSessions()
+	if err != nil {
+		return nil, err
+	}
+	assignment := make(channelAssignment)
+	for _, session := range sessions {
+		if session.ServerName == typeutil.DataNodeRole {
+			assignment[session.ServerID] = []string{}
+		}
+	}
+
+	states, err := watcher.ShowChannelRemovalState()
+	if err != nil {
+		return nil, err
+	}
+	for _, state := range states {
+		if state.HasMarker || !state.CollectionExists {
+			continue
+		}
+		for _, nodeID := range state.Watchers {
+			if channels, ok := assignment[nodeID]; ok {
+				assignment[nodeID] = append(channels, state.Channel)
+			}
+		}
+	}
+	for _, channels := range assignment {
+		sort.Strings(channels)
+	}
+	return assignment, nil
+}
+
+// skew returns the difference of channel numbers between the most and the least loaded node.
+func (assignment channelAssignment) skew() int {
+	if len(assignment) == 0 {
+		return 0
+	}
+	least, most := -1, 0
+	for _, channels := range assignment {
+		if least < 0 || len(channels) < least {
+			least = len(channels)
+		}
+		if len(channels) > most {
+			most = len(channels)
+		}
+	}
+	return most - least
+}
+
+func (assignment channelAssignment) String() string {
+	nodeIDs := make([]int64, 0, len(assignment))
+	for nodeID := range assignment {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Slice(nodeIDs, func(i, j int) bool { return nodeIDs[i] < nodeIDs[j] })
+
+	var sb strings.Builder
+	for _, nodeID := range nodeIDs {
+		channels := assignment[nodeID]
+		fmt.Fprintf(&sb, "  node %d: %d channels %v\n", nodeID, len(channels), channels)
+	}
+	return sb.String()
+}
+
+// WaitForChannelsBalanced waits until the channels are balanced among the live datanodes,
+// i.e. the difference of channel numbers between the most and the least loaded node is
+// no more than maxSkew, and the assignment is the same in two consecutive polls.
+// If ctx is done first, an error with the last assignment is returned.
+func WaitForChannelsBalanced(ctx context.Context, watcher MetaWatcher, maxSkew int) error {
+	var last channelAssignment
+	var lastErr error
+	for {
+		assignment, err := listChannelAssignment(watcher)
+		if err != nil {
+			lastErr = err
+		} else {
+			lastErr = nil
+			stable := last != nil && last.String() == assignment.String()
+			if stable && len(assignment) > 0 && assignment.skew() <= maxSkew {
+				return nil
+			}
+			last = assignment
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return fmt.Errorf("channels not balanced until ctx done, last error: %w", lastErr)
+			}
+			return fmt.Errorf("channels not balanced with max skew %d until ctx done, assignment:\n%s", maxSkew, last)
+		case <-time.After(channelBalancePollInterval):
+		}
+	}
+}
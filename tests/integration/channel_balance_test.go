@@ -0,0 +1,163 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/internal/util/sessionutil"
+	"github.com/milvus-io/milvus/pkg/util/typeutil"
+)
+
+type channelMetaWatcher struct {
+	MetaWatcher
+	mu       sync.Mutex
+	sessions []*sessionutil.Session
+	states   []*ChannelRemovalState
+}
+
+func (watcher *channelMetaWatcher) ShowSessions() ([]*sessionutil.Session, error) {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+	return watcher.sessions, nil
+}
+
+func (watcher *channelMetaWatcher) ShowChannelRemovalState() ([]*ChannelRemovalState, error) {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+	return watcher.states, nil
+}
+
+func (watcher *channelMetaWatcher) set(sessions []*sessionutil.Session, states []*ChannelRemovalState) {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+	watcher.sessions = sessions
+	watcher.states = states
+}
+
+func dataNodeSession(serverID int64) *sessionutil.Session {
+	session := &sessionutil.Session{}
+	session.ServerID = serverID
+	session.ServerName = typeutil.DataNodeRole
+	return session
+}
+
+func TestWaitForChannelsBalanced(t *testing.T) {
+	defer func(interval time.Duration) { channelBalancePollInterval = interval }(channelBalancePollInterval)
+	channelBalancePollInterval = 10 * time.Millisecond
+
+	queryNode := &sessionutil.Session{}
+	queryNode.ServerID = 10
+	queryNode.ServerName = typeutil.QueryNodeRole
+	watched := func(channel string, nodeID int64) *ChannelRemovalState {
+		return &ChannelRemovalState{Channel: channel, CollectionID: 100, Watchers: []int64{nodeID}, CollectionExists: true}
+	}
+	dropping := &ChannelRemovalState{Channel: "dropped", CollectionID: 101, HasMarker: true, Watchers: []int64{2}, CollectionExists: true}
+
+	watcher := &channelMetaWatcher{}
+	watcher.set(
+		[]*sessionutil.Session{dataNodeSession(1), dataNodeSession(2), queryNode},
+		[]*ChannelRemovalState{watched("ch0", 1), watched("ch1", 1), watched("ch2", 1), watched("ch3", 3), dropping},
+	)
+
+	assignment, err := listChannelAssignment(watcher)
+	require.NoError(t, err)
+	// node 3 is dead, the channel of a dropping collection is excluded
+	assert.Equal(t, channelAssignment{1: {"ch0", "ch1", "ch2"}, 2: {}}, assignment)
+	assert.Equal(t, 3, assignment.skew())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = WaitForChannelsBalanced(ctx, watcher, 1)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "node 1: 3 channels [ch0 ch1 ch2]")
+	assert.Contains(t, err.Error(), "node 2: 0 channels []")
+
+	// rebalanced in background
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		watcher.set(
+			[]*sessionutil.Session{dataNodeSession(1), dataNodeSession(2), queryNode},
+			[]*ChannelRemovalState{watched("ch0", 1), watched("ch1", 2), watched("ch2", 1), watched("ch3", 2), dropping},
+		)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, WaitForChannelsBalanced(ctx, watcher, 0))
+}
+
+func TestChannelAssignmentSkew(t *testing.T) {
+	assert.Equal(t, 0, channelAssignment{}.skew())
+	assert.Equal(t, 0, channelAssignment{1: {"ch0", "ch1", "ch2", "ch3"}}.skew())
+	assert.Equal(t, 0, channelAssignment{1: {"ch0", "ch1"}, 2: {"ch2", "ch3"}}.skew())
+	assert.Equal(t, 2, channelAssignment{1: {"ch0", "ch1", "ch2"}, 2: {"ch3"}}.skew())
+	assert.Equal(t, "  node 1: 1 channels [ch0]\n  node 2: 0 channels []\n", channelAssignment{2: {}, 1: {"ch0"}}.String())
+}
+
+// TestWaitForChannelsBalancedAddDataNode runs the decision of TestAddDataNodeRebalance of MiniClusterNodesSuite:
+// the channels of one node are balanced once a new node takes its share of them.
+func TestWaitForChannelsBalancedAddDataNode(t *testing.T) {
+	defer func(interval time.Duration) { channelBalancePollInterval = interval }(channelBalancePollInterval)
+	channelBalancePollInterval = 10 * time.Millisecond
+
+	watched := func(channel string, nodeID int64) *ChannelRemovalState {
+		return &ChannelRemovalState{Channel: channel, CollectionID: 100, Watchers: []int64{nodeID}, CollectionExists: true}
+	}
+	watcher := &channelMetaWatcher{}
+	watcher.set(
+		[]*sessionutil.Session{dataNodeSession(1)},
+		[]*ChannelRemovalState{watched("ch0", 1), watched("ch1", 1), watched("ch2", 1), watched("ch3", 1)},
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// a single node is balanced by itself
+	assert.NoError(t, WaitForChannelsBalanced(ctx, watcher, 1))
+
+	// the new node is not balanced until it watches its share of the channels
+	watcher.set(
+		[]*sessionutil.Session{dataNodeSession(1), dataNodeSession(2)},
+		[]*ChannelRemovalState{watched("ch0", 1), watched("ch1", 1), watched("ch2", 1), watched("ch3", 1)},
+	)
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer shortCancel()
+	assert.Error(t, WaitForChannelsBalanced(shortCtx, watcher, 1))
+
+	// a channel moving to the new node is balanced with a skew of 2, not of 1
+	watcher.set(
+		[]*sessionutil.Session{dataNodeSession(1), dataNodeSession(2)},
+		[]*ChannelRemovalState{watched("ch0", 1), watched("ch1", 1), watched("ch2", 1), watched("ch3", 2)},
+	)
+	assert.NoError(t, WaitForChannelsBalanced(ctx, watcher, 2))
+	shortCtx, shortCancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer shortCancel()
+	assert.Error(t, WaitForChannelsBalanced(shortCtx, watcher, 1))
+
+	watcher.set(
+		[]*sessionutil.Session{dataNodeSession(1), dataNodeSession(2)},
+		[]*ChannelRemovalState{watched("ch0", 1), watched("ch1", 2), watched("ch2", 1), watched("ch3", 2)},
+	)
+	assert.NoError(t, WaitForChannelsBalanced(ctx, watcher, 1))
+	assignment, err := listChannelAssignment(watcher)
+	require.NoError(t, err)
+	assert.Equal(t, channelAssignment{1: {"ch0", "ch2"}, 2: {"ch1", "ch3"}}, assignment)
+}
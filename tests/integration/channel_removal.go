@@ -0,0 +1,71 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// channelRemovalGracePeriod is how long a channel may stay inconsistent before CheckChannelRemoval of
+// RegisterDefaults reports it, long enough for the datanodes to release a dropped channel.
+const channelRemovalGracePeriod = 30 * time.Second
+
+// CheckChannelRemoval returns the check of the channel removals, see ChannelRemovalState.Inconsistency.
+// The removal is not atomic: datacoord marks the channel removed before the datanode releases it, and
+// the collection is dropped before its channels are released, so a channel is inconsistent for a while
+// on each drop. A violation is reported only for a channel inconsistent in all the runs of the check
+// for longer than gracePeriod, so the returned check keeps the time each inconsistency is first seen.
+func CheckChannelRemoval(gracePeriod time.Duration) InvariantCheck {
+	var mu sync.Mutex
+	// since is the time each inconsistent channel is first seen, by channel and inconsistency
+	since := make(map[string]time.Time)
+	return func(watcher MetaWatcher) error {
+		states, err := watcher.ShowChannelRemovalState()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		now := time.Now()
+		seen := make(map[string]time.Time, len(since))
+		var violations []string
+		for _, state := range states {
+			inconsistency := state.Inconsistency()
+			if inconsistency == "" {
+				continue
+			}
+			first, ok := since[inconsistency]
+			if !ok {
+				first = now
+			}
+			seen[inconsistency] = first
+			if elapsed := now.Sub(first); elapsed >= gracePeriod {
+				violations = append(violations, fmt.Sprintf("%s for %s", inconsistency, elapsed))
+			}
+		}
+		since = seen
+		if len(violations) > 0 {
+			return errors.Newf("channel removal inconsistent: %s", strings.Join(violations, "; "))
+		}
+		return nil
+	}
+}
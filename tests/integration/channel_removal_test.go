@@ -0,0 +1,51 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckChannelRemoval(t *testing.T) {
+	watched := &ChannelRemovalState{Channel: "ch0", CollectionID: 100, Watchers: []int64{1}, CollectionExists: true}
+	releasing := &ChannelRemovalState{Channel: "ch1", CollectionID: 101, HasMarker: true, Removed: true, Watchers: []int64{2}}
+	released := &ChannelRemovalState{Channel: "ch1", CollectionID: 101, HasMarker: true, Removed: true}
+
+	watcher := &channelMetaWatcher{}
+	watcher.set(nil, []*ChannelRemovalState{watched, releasing})
+	assert.NoError(t, CheckChannelRemoval(time.Hour)(watcher))
+	err := CheckChannelRemoval(0)(watcher)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "channel ch1 is marked removed but still watched by [2]")
+	assert.NotContains(t, err.Error(), "ch0")
+
+	// a channel is reported once it's inconsistent for longer than the grace period
+	check := CheckChannelRemoval(50 * time.Millisecond)
+	assert.NoError(t, check(watcher))
+	time.Sleep(100 * time.Millisecond)
+	assert.Error(t, check(watcher))
+
+	// a channel released in between starts over
+	watcher.set(nil, []*ChannelRemovalState{watched, released})
+	assert.NoError(t, check(watcher))
+	watcher.set(nil, []*ChannelRemovalState{watched, releasing})
+	assert.NoError(t, check(watcher))
+}
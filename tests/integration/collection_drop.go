@@ -0,0 +1,99 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var collectionDropPollInterval = 500 * time.Millisecond
+
+// WithFastGC lets datacoord garbage collect the dropped segments within seconds,
+// so VerifyCollectionDropped doesn't wait for the default drop tolerance.
+func WithFastGC() Option {
+	return func(cluster *MiniCluster) {
+		cluster.params[params.DataCoordCfg.GCInterval.Key] = "1"
+		cluster.params[params.DataCoordCfg.GCDropTolerance.Key] = "1"
+	}
+}
+
+// LingeringMetaError is returned by VerifyCollectionDropped if the meta of the collection is not
+// cleaned up in time.
+type LingeringMetaError struct {
+	CollectionID int64
+	// Keys are the lingering keys relative to the meta root by category, only the non-empty categories are kept.
+	Keys map[string][]string
+}
+
+func (e *LingeringMetaError) Error() string {
+	categories := make([]string, 0, len(e.Keys))
+	for category := range e.Keys {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "meta of dropped collection %d not cleaned up, lingering:", e.CollectionID)
+	for _, category := range categories {
+		fmt.Fprintf(&sb, "\n  %s: %v", category, e.Keys[category])
+	}
+	return sb.String()
+}
+
+// VerifyCollectionDropped waits until no meta is held for the dropped collection in any category
+// of ShowCollectionMetaKeys, note that the dropped segments are kept until garbage collected.
+// If the timeout expires or ctx is done first, a *LingeringMetaError with the keys seen by the
+// last poll is returned, e.g.
+//
+//	meta of dropped collection 100 not cleaned up, lingering:
+//	  channel-checkpoints: [datacoord-meta/channel-cp/by-dev-rootcoord-dml_0_100v0]
+//	  segments: [datacoord-meta/s/100/101/1001]
+func VerifyCollectionDropped(ctx context.Context, watcher MetaWatcher, collectionID int64, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	var lingering *LingeringMetaError
+	for {
+		keys, err := watcher.ShowCollectionMetaKeys(collectionID)
+		if err == nil {
+			lingering = &LingeringMetaError{CollectionID: collectionID, Keys: make(map[string][]string)}
+			for category, categoryKeys := range keys {
+				if len(categoryKeys) > 0 {
+					lingering.Keys[category] = categoryKeys
+				}
+			}
+			if len(lingering.Keys) == 0 {
+				return nil
+			}
+		}
+		lastErr = err
+
+		select {
+		case <-ctx.Done():
+			if lingering == nil {
+				return fmt.Errorf("failed to show meta of dropped collection %d, last error: %w", collectionID, lastErr)
+			}
+			return lingering
+		case <-time.After(collectionDropPollInterval):
+		}
+	}
+}
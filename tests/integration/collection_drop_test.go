@@ -0,0 +1,203 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/milvuspb"
+	"github.com/milvus-io/milvus/internal/metastore/kv/rootcoord"
+	"github.com/milvus-io/milvus/internal/proto/etcdpb"
+	"github.com/milvus-io/milvus/pkg/util/funcutil"
+	"github.com/milvus-io/milvus/pkg/util/metric"
+)
+
+type collectionKeysMetaWatcher struct {
+	MetaWatcher
+	mu sync.Mutex
+	// polls are the results of ShowCollectionMetaKeys in order, the last one is kept
+	polls []map[string][]string
+}
+
+func (watcher *collectionKeysMetaWatcher) ShowCollectionMetaKeys(collectionID int64) (map[string][]string, error) {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+	keys := watcher.polls[0]
+	if len(watcher.polls) > 1 {
+		watcher.polls = watcher.polls[1:]
+	}
+	return keys, nil
+}
+
+func TestVerifyCollectionDropped(t *testing.T) {
+	defer func(interval time.Duration) { collectionDropPollInterval = interval }(collectionDropPollInterval)
+	collectionDropPollInterval = 10 * time.Millisecond
+	ctx := context.Background()
+
+	watcher := &collectionKeysMetaWatcher{polls: []map[string][]string{
+		{"segments": {"datacoord-meta/s/100/101/1"}, "load": {"querycoord-collection-loadinfo/100"}},
+		{"segments": {"datacoord-meta/s/100/101/1"}, "load": nil},
+		{"segments": nil, "load": nil},
+	}}
+	assert.NoError(t, VerifyCollectionDropped(ctx, watcher, 100, time.Second))
+
+	watcher = &collectionKeysMetaWatcher{polls: []map[string][]string{
+		{"segments": {"datacoord-meta/s/100/101/1"}, "load": {"querycoord-collection-loadinfo/100"}},
+		{"segments": nil, "load": {"querycoord-collection-loadinfo/100"}, "aliases": {"root-coord/aliases/a"}},
+	}}
+	err := VerifyCollectionDropped(ctx, watcher, 100, 100*time.Millisecond)
+	var lingering *LingeringMetaError
+	assert.True(t, errors.As(err, &lingering))
+	assert.EqualValues(t, 100, lingering.CollectionID)
+	assert.Equal(t, map[string][]string{
+		"load":    {"querycoord-collection-loadinfo/100"},
+		"aliases": {"root-coord/aliases/a"},
+	}, lingering.Keys)
+	assert.Equal(t, "meta of dropped collection 100 not cleaned up, lingering:\n"+
+		"  aliases: [root-coord/aliases/a]\n"+
+		"  load: [querycoord-collection-loadinfo/100]", err.Error())
+}
+
+type CollectionDropSuite struct {
+	MiniClusterSuite
+}
+
+func (s *CollectionDropSuite) SetupTest() {
+	s.ClusterOptions = []Option{WithFastGC()}
+	s.MiniClusterSuite.SetupTest()
+}
+
+func (s *CollectionDropSuite) TestCleanDrop() {
+	c := s.Cluster
+	ctx, cancel := context.WithTimeout(c.GetContext(), 3*time.Minute)
+	defer cancel()
+
+	const dim = 128
+	collectionName := "TestCleanDrop" + funcutil.GenRandomStr()
+	collectionID, _ := s.prepareFlushedCollection(ctx, collectionName, 3000)
+
+	createIndexStatus, err := c.Proxy.CreateIndex(ctx, &milvuspb.CreateIndexRequest{
+		CollectionName: collectionName,
+		FieldName:      FloatVecField,
+		IndexName:      "_default",
+		ExtraParams:    ConstructIndexParam(dim, IndexFaissIvfFlat, metric.L2),
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, createIndexStatus.GetErrorCode())
+	s.WaitForIndexBuilt(ctx, collectionName, FloatVecField)
+
+	loadStatus, err := c.Proxy.LoadCollection(ctx, &milvuspb.LoadCollectionRequest{
+		CollectionName: collectionName,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, loadStatus.GetErrorCode())
+	s.WaitForLoad(ctx, collectionName)
+
+	aliasStatus, err := c.Proxy.CreateAlias(ctx, &milvuspb.CreateAliasRequest{
+		CollectionName: collectionName,
+		Alias:          collectionName + "_alias",
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, aliasStatus.GetErrorCode())
+
+	keys, err := c.MetaWatcher.ShowCollectionMetaKeys(collectionID)
+	s.Require().NoError(err)
+	for _, category := range collectionMetaCategories {
+		s.NotEmpty(keys[category], category)
+	}
+
+	status, err := c.Proxy.DropCollection(ctx, &milvuspb.DropCollectionRequest{
+		CollectionName: collectionName,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, status.GetErrorCode())
+	s.NoError(VerifyCollectionDropped(ctx, c.MetaWatcher, collectionID, 2*time.Minute))
+}
+
+func (s *CollectionDropSuite) TestFabricatedLeaks() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	rootPath := "/collection-drop-test"
+	_, err := c.EtcdCli.Delete(ctx, rootPath+"/", clientv3.WithPrefix())
+	s.Require().NoError(err)
+	defer c.EtcdCli.Delete(context.Background(), rootPath+"/", clientv3.WithPrefix())
+	watcher := &EtcdMetaWatcher{rootPath: rootPath, etcdCli: c.EtcdCli}
+
+	put := func(key string, value string) {
+		_, err := c.EtcdCli.Put(ctx, rootPath+"/meta/"+key, value)
+		s.Require().NoError(err)
+	}
+	marshal := func(message proto.Message) string {
+		value, err := proto.Marshal(message)
+		s.Require().NoError(err)
+		return string(value)
+	}
+
+	// meta of other collections and dropped meta of rootcoord
+	put("root-coord/collection/1001", "value")
+	put("root-coord/collection/100", string(rootcoord.SuffixSnapshotTombstone))
+	put("datacoord-meta/s/1001/101/1", "value")
+	put("datacoord-meta/channel-cp/by-dev-rootcoord-dml_0_1001v0", "value")
+	put("querycoord-collection-loadinfo/1001", "value")
+	put("root-coord/aliases/other", marshal(&etcdpb.AliasInfo{AliasName: "other", CollectionId: 1001}))
+	s.NoError(VerifyCollectionDropped(ctx, watcher, 100, time.Second))
+
+	for _, leak := range []struct {
+		category string
+		key      string
+		value    string
+	}{
+		{"collection", "root-coord/database/collection-info/1/100", "value"},
+		{"collection", "root-coord/fields/100/101", "value"},
+		{"segments", "datacoord-meta/s/100/101/1", "value"},
+		{"segments", "datacoord-meta/statslog/100/101/1/100", "value"},
+		{"channel-watch", "channelwatch/1/by-dev-rootcoord-dml_0_100v0", "value"},
+		{"channel-watch", "datacoord-meta/channel-removal/by-dev-rootcoord-dml_0_100v0", "removed"},
+		{"channel-checkpoints", "datacoord-meta/channel-cp/by-dev-rootcoord-dml_0_100v0", "value"},
+		{"indexes", "field-index/100/1", "value"},
+		{"indexes", "segment-index/100/101/1/1", "value"},
+		{"load", "querycoord-collection-loadinfo/100", "value"},
+		{"load", "querycoord-replica/100/1", "value"},
+		{"aliases", "root-coord/aliases/a", marshal(&etcdpb.AliasInfo{AliasName: "a", CollectionId: 100})},
+		{"aliases", "root-coord/database/aliases/1/b", marshal(&etcdpb.AliasInfo{AliasName: "b", CollectionId: 100})},
+	} {
+		put(leak.key, leak.value)
+		err := VerifyCollectionDropped(ctx, watcher, 100, time.Second)
+		var lingering *LingeringMetaError
+		s.Require().True(errors.As(err, &lingering), leak.key)
+		s.Equal(map[string][]string{leak.category: {leak.key}}, lingering.Keys)
+
+		_, err = c.EtcdCli.Delete(ctx, rootPath+"/meta/"+leak.key)
+		s.Require().NoError(err)
+	}
+}
+
+func TestCollectionDrop(t *testing.T) {
+	suite.Run(t, new(CollectionDropSuite))
+}
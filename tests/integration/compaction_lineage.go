@@ -0,0 +1,373 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus/internal/proto/datapb"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+)
+
+// LineageAnomalyKind is the kind of a LineageAnomaly.
+type LineageAnomalyKind string
+
+const (
+	// LineageCycle is a segment compacted, directly or not, from itself.
+	LineageCycle LineageAnomalyKind = "cycle"
+	// LineageMissingAncestor is a segment compacted from a segment not in the meta.
+	// Dropped segments are removed by the garbage collection, so it's not necessarily a bug.
+	LineageMissingAncestor LineageAnomalyKind = "missing ancestor"
+	// LineageLiveAncestor is a segment not dropped, while a segment compacted from it is not dropped either,
+	// so that their rows are counted twice.
+	LineageLiveAncestor LineageAnomalyKind = "live ancestor"
+)
+
+// LineageAnomaly is an inconsistency found in the compaction lineage.
+type LineageAnomaly struct {
+	Kind      LineageAnomalyKind
+	SegmentID int64
+	// Related are the other segments involved, the cycle, the missing or the live ancestors.
+	Related []int64
+}
+
+func (anomaly LineageAnomaly) String() string {
+	return fmt.Sprintf("%s: segment %d, related %v", anomaly.Kind, anomaly.SegmentID, anomaly.Related)
+}
+
+// LineageNode is a segment in the compaction lineage.
+type LineageNode struct {
+	Segment *datapb.SegmentInfo
+	// Parents are the segments it's compacted from, Children are the segments compacted from it.
+	Parents  []int64
+	Children []int64
+}
+
+// CompactionLineage is the DAG of the segments of a collection linked by SegmentInfo.CompactionFrom,
+// including the dropped segments still in the meta.
+type CompactionLineage struct {
+	CollectionID int64
+	Nodes        map[int64]*LineageNode
+	Anomalies    []LineageAnomaly
+}
+
+// BuildCompactionLineage builds the compaction lineage of the collection from the segment meta,
+// and detects the anomalies in it.
+func BuildCompactionLineage(watcher MetaWatcher, collectionID int64) (*CompactionLineage, error) {
+	segments, err := watcher.ShowSegments()
+	if err != nil {
+		return nil, err
+	}
+	lineage := &CompactionLineage{
+		CollectionID: collectionID,
+		Nodes:        make(map[int64]*LineageNode),
+	}
+	for _, segment := range segments {
+		if segment.GetCollectionID() != collectionID {
+			continue
+		}
+		lineage.Nodes[segment.GetID()] = &LineageNode{
+			Segment: segment,
+			Parents: append([]int64(nil), segment.GetCompactionFrom()...),
+		}
+	}
+	for _, id := range lineage.sortedIDs() {
+		for _, parent := range lineage.Nodes[id].Parents {
+			if node, ok := lineage.Nodes[parent]; ok {
+				node.Children = append(node.Children, id)
+			}
+		}
+	}
+	lineage.detectAnomalies()
+	return lineage, nil
+}
+
+func (lineage *CompactionLineage) sortedIDs() []int64 {
+	ids := make([]int64, 0, len(lineage.Nodes))
+	for id := range lineage.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func isLiveSegment(segment *datapb.SegmentInfo) bool {
+	return segment.GetState() != commonpb.SegmentState_Dropped && segment.GetState() != commonpb.SegmentState_NotExist
+}
+
+func (lineage *CompactionLineage) detectAnomalies() {
+	lineage.Anomalies = nil
+	ids := lineage.sortedIDs()
+
+	// cycles, by the back edges of a depth first search along the parents
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	color := make(map[int64]int, len(ids))
+	var path []int64
+	var visit func(id int64)
+	visit = func(id int64) {
+		color[id] = visiting
+		path = append(path, id)
+		for _, parent := range lineage.Nodes[id].Parents {
+			if _, ok := lineage.Nodes[parent]; !ok {
+				continue
+			}
+			switch color[parent] {
+			case unvisited:
+				visit(parent)
+			case visiting:
+				start := len(path) - 1
+				for path[start] != parent {
+					start--
+				}
+				lineage.Anomalies = append(lineage.Anomalies, LineageAnomaly{
+					Kind:      LineageCycle,
+					SegmentID: parent,
+					Related:   append([]int64(nil), path[start:]...),
+				})
+			}
+		}
+		path = path[:len(path)-1]
+		color[id] = visited
+	}
+	for _, id := range ids {
+		if color[id] == unvisited {
+			visit(id)
+		}
+	}
+
+	for _, id := range ids {
+		node := lineage.Nodes[id]
+		var missing []int64
+		for _, parent := range node.Parents {
+			if _, ok := lineage.Nodes[parent]; !ok {
+				missing = append(missing, parent)
+			}
+		}
+		if len(missing) > 0 {
+			lineage.Anomalies = append(lineage.Anomalies, LineageAnomaly{
+				Kind:      LineageMissingAncestor,
+				SegmentID: id,
+				Related:   missing,
+			})
+		}
+
+		if !isLiveSegment(node.Segment) {
+			continue
+		}
+		var live []int64
+		for _, ancestor := range lineage.Ancestors(id) {
+			if isLiveSegment(lineage.Nodes[ancestor].Segment) {
+				live = append(live, ancestor)
+			}
+		}
+		if len(live) > 0 {
+			lineage.Anomalies = append(lineage.Anomalies, LineageAnomaly{
+				Kind:      LineageLiveAncestor,
+				SegmentID: id,
+				Related:   live,
+			})
+		}
+	}
+}
+
+// Ancestors returns the segments in the meta the segment is compacted from, directly or not, in ascending order.
+func (lineage *CompactionLineage) Ancestors(segmentID int64) []int64 {
+	seen := map[int64]struct{}{segmentID: {}}
+	var ancestors []int64
+	queue := []int64{segmentID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, parent := range lineage.Nodes[id].Parents {
+			if _, ok := seen[parent]; ok {
+				continue
+			}
+			seen[parent] = struct{}{}
+			if _, ok := lineage.Nodes[parent]; ok {
+				ancestors = append(ancestors, parent)
+				queue = append(queue, parent)
+			}
+		}
+	}
+	sort.Slice(ancestors, func(i, j int) bool { return ancestors[i] < ancestors[j] })
+	return ancestors
+}
+
+// Leaves returns the segments not compacted into any segment in the meta, in ascending order.
+func (lineage *CompactionLineage) Leaves() []int64 {
+	var leaves []int64
+	for _, id := range lineage.sortedIDs() {
+		if len(lineage.Nodes[id].Children) == 0 {
+			leaves = append(leaves, id)
+		}
+	}
+	return leaves
+}
+
+// Depth returns the number of compaction rounds of the longest path from the segment to its roots,
+// 0 for a segment not compacted from any segment in the meta. The edges closing a cycle are not followed.
+func (lineage *CompactionLineage) Depth(segmentID int64) int {
+	visiting := make(map[int64]bool)
+	var depth func(id int64) int
+	depth = func(id int64) int {
+		visiting[id] = true
+		defer delete(visiting, id)
+		longest := 0
+		for _, parent := range lineage.Nodes[id].Parents {
+			if _, ok := lineage.Nodes[parent]; !ok || visiting[parent] {
+				continue
+			}
+			if d := depth(parent) + 1; d > longest {
+				longest = d
+			}
+		}
+		return longest
+	}
+	if _, ok := lineage.Nodes[segmentID]; !ok {
+		return 0
+	}
+	return depth(segmentID)
+}
+
+func (lineage *CompactionLineage) describe(id int64) string {
+	node, ok := lineage.Nodes[id]
+	if !ok {
+		return fmt.Sprintf("segment %d (missing)", id)
+	}
+	segment := node.Segment
+	return fmt.Sprintf("segment %d (%s, rows: %d, %s)", id, segment.GetState().String(), segment.GetNumOfRows(), GetSegmentLevel(segment))
+}
+
+// Tree renders the lineage of the segment as a text tree of its ancestors, one segment per line
+// indented by the compaction rounds before it.
+func (lineage *CompactionLineage) Tree(segmentID int64) (string, error) {
+	if _, ok := lineage.Nodes[segmentID]; !ok {
+		return "", merr.WrapErrSegmentNotFound(segmentID)
+	}
+	var sb strings.Builder
+	visiting := make(map[int64]bool)
+	var printNode func(id int64, depth int)
+	printNode = func(id int64, depth int) {
+		sb.WriteString(strings.Repeat("  ", depth))
+		sb.WriteString(lineage.describe(id))
+		if visiting[id] {
+			sb.WriteString(" cycle\n")
+			return
+		}
+		sb.WriteString("\n")
+		node, ok := lineage.Nodes[id]
+		if !ok {
+			return
+		}
+		visiting[id] = true
+		defer delete(visiting, id)
+		for _, parent := range node.Parents {
+			printNode(parent, depth+1)
+		}
+	}
+	printNode(segmentID, 0)
+	return sb.String(), nil
+}
+
+// DOT renders the lineage of the segment in the DOT language of graphviz, with edges from the ancestors.
+func (lineage *CompactionLineage) DOT(segmentID int64) (string, error) {
+	if _, ok := lineage.Nodes[segmentID]; !ok {
+		return "", merr.WrapErrSegmentNotFound(segmentID)
+	}
+	ids := append(lineage.Ancestors(segmentID), segmentID)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph lineage_%d {\n", segmentID)
+	for _, id := range ids {
+		fmt.Fprintf(&sb, "  %d [label=%q];\n", id, lineage.describe(id))
+	}
+	for _, id := range ids {
+		for _, parent := range lineage.Nodes[id].Parents {
+			if _, ok := lineage.Nodes[parent]; !ok {
+				fmt.Fprintf(&sb, "  %d [label=%q, style=dashed];\n", parent, lineage.describe(parent))
+			}
+			fmt.Fprintf(&sb, "  %d -> %d;\n", parent, id)
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String(), nil
+}
+
+// Report summarizes the lineage: the anomalies, and the depth and ancestors of each leaf.
+func (lineage *CompactionLineage) Report() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "compaction lineage of collection %d, %d segments\n", lineage.CollectionID, len(lineage.Nodes))
+	if len(lineage.Anomalies) == 0 {
+		sb.WriteString("anomalies: none\n")
+	} else {
+		sb.WriteString("anomalies:\n")
+		for _, anomaly := range lineage.Anomalies {
+			fmt.Fprintf(&sb, "  %s\n", anomaly)
+		}
+	}
+	for _, leaf := range lineage.Leaves() {
+		if len(lineage.Nodes[leaf].Parents) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s: depth %d, ancestors %v\n", lineage.describe(leaf), lineage.Depth(leaf), lineage.Ancestors(leaf))
+	}
+	return sb.String()
+}
+
+// CheckCompactionLineage checks the compaction lineage of all the collections for cycles and live ancestors.
+// Missing ancestors are not violations, the dropped segments are garbage collected.
+func CheckCompactionLineage(watcher MetaWatcher) error {
+	segments, err := watcher.ShowSegments()
+	if err != nil {
+		return err
+	}
+	collections := make(map[int64]struct{})
+	for _, segment := range segments {
+		collections[segment.GetCollectionID()] = struct{}{}
+	}
+	collectionIDs := make([]int64, 0, len(collections))
+	for collectionID := range collections {
+		collectionIDs = append(collectionIDs, collectionID)
+	}
+	sort.Slice(collectionIDs, func(i, j int) bool { return collectionIDs[i] < collectionIDs[j] })
+
+	var violations []string
+	for _, collectionID := range collectionIDs {
+		lineage, err := BuildCompactionLineage(watcher, collectionID)
+		if err != nil {
+			return err
+		}
+		for _, anomaly := range lineage.Anomalies {
+			if anomaly.Kind == LineageMissingAncestor {
+				continue
+			}
+			violations = append(violations, fmt.Sprintf("collection %d %s", collectionID, anomaly))
+		}
+	}
+	if len(violations) > 0 {
+		return errors.Newf("compaction lineage inconsistent: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
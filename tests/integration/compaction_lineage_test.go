@@ -0,0 +1,248 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/milvuspb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/proto/datapb"
+	"github.com/milvus-io/milvus/pkg/log"
+	"github.com/milvus-io/milvus/pkg/util/funcutil"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+)
+
+type segmentsMetaWatcher struct {
+	MetaWatcher
+	segments []*datapb.SegmentInfo
+}
+
+func (watcher *segmentsMetaWatcher) ShowSegments() ([]*datapb.SegmentInfo, error) {
+	return watcher.segments, nil
+}
+
+func lineageSegment(id int64, state commonpb.SegmentState, from ...int64) *datapb.SegmentInfo {
+	return &datapb.SegmentInfo{
+		ID:                  id,
+		CollectionID:        100,
+		State:               state,
+		NumOfRows:           10,
+		CreatedByCompaction: len(from) > 0,
+		CompactionFrom:      from,
+	}
+}
+
+func TestCompactionLineage(t *testing.T) {
+	dropped, flushed := commonpb.SegmentState_Dropped, commonpb.SegmentState_Flushed
+	watcher := &segmentsMetaWatcher{segments: []*datapb.SegmentInfo{
+		lineageSegment(1, dropped),
+		lineageSegment(2, dropped),
+		lineageSegment(3, dropped, 1, 2),
+		lineageSegment(4, dropped),
+		lineageSegment(5, flushed, 3, 4),
+		// another collection
+		{ID: 6, CollectionID: 200, State: flushed, CompactionFrom: []int64{5}},
+	}}
+
+	lineage, err := BuildCompactionLineage(watcher, 100)
+	require.NoError(t, err)
+	assert.Empty(t, lineage.Anomalies)
+	assert.Len(t, lineage.Nodes, 5)
+	assert.Equal(t, []int64{5}, lineage.Leaves())
+	assert.Equal(t, 2, lineage.Depth(5))
+	assert.Equal(t, 0, lineage.Depth(1))
+	assert.Equal(t, []int64{1, 2, 3, 4}, lineage.Ancestors(5))
+	assert.NoError(t, CheckCompactionLineage(watcher))
+
+	tree, err := lineage.Tree(5)
+	require.NoError(t, err)
+	assert.Equal(t, "segment 5 (Flushed, rows: 10, L1)\n"+
+		"  segment 3 (Dropped, rows: 10, L1)\n"+
+		"    segment 1 (Dropped, rows: 10, L1)\n"+
+		"    segment 2 (Dropped, rows: 10, L1)\n"+
+		"  segment 4 (Dropped, rows: 10, L1)\n", tree)
+
+	dot, err := lineage.DOT(3)
+	require.NoError(t, err)
+	assert.Equal(t, "digraph lineage_3 {\n"+
+		"  1 [label=\"segment 1 (Dropped, rows: 10, L1)\"];\n"+
+		"  2 [label=\"segment 2 (Dropped, rows: 10, L1)\"];\n"+
+		"  3 [label=\"segment 3 (Dropped, rows: 10, L1)\"];\n"+
+		"  1 -> 3;\n"+
+		"  2 -> 3;\n"+
+		"}\n", dot)
+
+	_, err = lineage.Tree(6)
+	assert.ErrorIs(t, err, merr.ErrSegmentNotFound)
+	_, err = lineage.DOT(6)
+	assert.ErrorIs(t, err, merr.ErrSegmentNotFound)
+	assert.Contains(t, lineage.Report(), "anomalies: none")
+	assert.Contains(t, lineage.Report(), "segment 5 (Flushed, rows: 10, L1): depth 2, ancestors [1 2 3 4]")
+}
+
+func TestCompactionLineageAnomalies(t *testing.T) {
+	dropped, flushed := commonpb.SegmentState_Dropped, commonpb.SegmentState_Flushed
+
+	// the ancestor is garbage collected
+	watcher := &segmentsMetaWatcher{segments: []*datapb.SegmentInfo{
+		lineageSegment(1, dropped),
+		lineageSegment(3, flushed, 1, 2),
+	}}
+	lineage, err := BuildCompactionLineage(watcher, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []LineageAnomaly{{Kind: LineageMissingAncestor, SegmentID: 3, Related: []int64{2}}}, lineage.Anomalies)
+	assert.Equal(t, 1, lineage.Depth(3))
+	dot, err := lineage.DOT(3)
+	require.NoError(t, err)
+	assert.Contains(t, dot, "  2 [label=\"segment 2 (missing)\", style=dashed];\n")
+	// not a violation of the invariant
+	assert.NoError(t, CheckCompactionLineage(watcher))
+
+	// the ancestor is not dropped by the compaction
+	watcher = &segmentsMetaWatcher{segments: []*datapb.SegmentInfo{
+		lineageSegment(1, flushed),
+		lineageSegment(2, dropped, 1),
+		lineageSegment(3, flushed, 2),
+	}}
+	lineage, err = BuildCompactionLineage(watcher, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []LineageAnomaly{{Kind: LineageLiveAncestor, SegmentID: 3, Related: []int64{1}}}, lineage.Anomalies)
+	assert.Contains(t, lineage.Report(), "live ancestor: segment 3, related [1]")
+	err = CheckCompactionLineage(watcher)
+	assert.ErrorContains(t, err, "collection 100 live ancestor: segment 3, related [1]")
+
+	// a segment compacted from its descendant
+	watcher = &segmentsMetaWatcher{segments: []*datapb.SegmentInfo{
+		lineageSegment(1, dropped, 3),
+		lineageSegment(2, dropped, 1),
+		lineageSegment(3, dropped, 2),
+		lineageSegment(4, flushed, 3),
+	}}
+	lineage, err = BuildCompactionLineage(watcher, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []LineageAnomaly{{Kind: LineageCycle, SegmentID: 1, Related: []int64{1, 3, 2}}}, lineage.Anomalies)
+	assert.Equal(t, 3, lineage.Depth(4))
+	tree, err := lineage.Tree(4)
+	require.NoError(t, err)
+	assert.Equal(t, "segment 4 (Flushed, rows: 10, L1)\n"+
+		"  segment 3 (Dropped, rows: 10, L1)\n"+
+		"    segment 2 (Dropped, rows: 10, L1)\n"+
+		"      segment 1 (Dropped, rows: 10, L1)\n"+
+		"        segment 3 (Dropped, rows: 10, L1) cycle\n", tree)
+	assert.ErrorContains(t, CheckCompactionLineage(watcher), "cycle: segment 1")
+}
+
+// insertAndFlush inserts rowNum rows into the collection and waits until they are flushed.
+func (s *MetaWatcherSuite) insertAndFlush(ctx context.Context, collectionName string, rowNum int) {
+	c := s.Cluster
+	const dim = 128
+
+	insertResult, err := c.Proxy.Insert(ctx, &milvuspb.InsertRequest{
+		CollectionName: collectionName,
+		FieldsData:     []*schemapb.FieldData{NewFloatVectorFieldData(FloatVecField, rowNum, dim)},
+		HashKeys:       GenerateHashKeys(rowNum),
+		NumRows:        uint32(rowNum),
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, insertResult.GetStatus().GetErrorCode())
+
+	flushResp, err := c.Proxy.Flush(ctx, &milvuspb.FlushRequest{
+		CollectionNames: []string{collectionName},
+	})
+	s.Require().NoError(err)
+	s.WaitForFlush(ctx, flushResp.GetCollSegIDs()[collectionName].GetData(),
+		flushResp.GetCollFlushTs()[collectionName], "", collectionName)
+}
+
+// compactAndWait triggers a manual compaction of the collection and waits until it's completed.
+func (s *MetaWatcherSuite) compactAndWait(ctx context.Context, collectionID int64) {
+	c := s.Cluster
+	compactResp, err := c.Proxy.ManualCompaction(ctx, &milvuspb.ManualCompactionRequest{
+		CollectionID: collectionID,
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(merr.Error(compactResp.GetStatus()))
+	s.Require().NotZero(compactResp.GetCompactionPlanCount())
+
+	for {
+		stateResp, err := c.Proxy.GetCompactionState(ctx, &milvuspb.GetCompactionStateRequest{
+			CompactionID: compactResp.GetCompactionID(),
+		})
+		s.Require().NoError(err)
+		s.Require().NoError(merr.Error(stateResp.GetStatus()))
+		if stateResp.GetState() == commonpb.CompactionState_Completed {
+			s.Require().Zero(stateResp.GetFailedPlanNo())
+			return
+		}
+		select {
+		case <-ctx.Done():
+			s.FailNow("failed to wait for compaction completed until ctx done")
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func (s *MetaWatcherSuite) TestCompactionLineage() {
+	c := s.Cluster
+	ctx, cancel := context.WithTimeout(c.GetContext(), 5*time.Minute)
+	defer cancel()
+
+	const rowNum = 3000
+	collectionName := "TestCompactionLineage" + funcutil.GenRandomStr()
+	collectionID, _ := s.prepareFlushedCollection(ctx, collectionName, rowNum)
+	s.insertAndFlush(ctx, collectionName, rowNum)
+
+	// first round merges the two flushed segments
+	s.compactAndWait(ctx, collectionID)
+	s.insertAndFlush(ctx, collectionName, rowNum)
+	// second round merges the result of the first round with the new segment
+	s.compactAndWait(ctx, collectionID)
+
+	lineage, err := BuildCompactionLineage(c.MetaWatcher, collectionID)
+	s.Require().NoError(err)
+	log.Info("compaction lineage\n" + lineage.Report())
+	s.Empty(lineage.Anomalies)
+	s.NoError(CheckCompactionLineage(c.MetaWatcher))
+
+	var leaf int64
+	for _, id := range lineage.Leaves() {
+		if isLiveSegment(lineage.Nodes[id].Segment) {
+			s.Require().Zero(leaf, "more than one live segment after compaction")
+			leaf = id
+		}
+	}
+	s.Require().NotZero(leaf)
+	s.Equal(2, lineage.Depth(leaf))
+	s.Len(lineage.Ancestors(leaf), 4)
+	s.EqualValues(3*rowNum, lineage.Nodes[leaf].Segment.GetNumOfRows())
+
+	tree, err := lineage.Tree(leaf)
+	s.Require().NoError(err)
+	log.Info("compaction lineage tree\n" + tree)
+	s.Contains(tree, lineage.describe(leaf))
+	dot, err := lineage.DOT(leaf)
+	s.Require().NoError(err)
+	s.Contains(dot, "digraph")
+}
@@ -0,0 +1,248 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"math/rand"
+	"path"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/milvus-io/milvus/pkg/log"
+)
+
+// EtcdMethod is the etcd rpc method a fault is injected into.
+type EtcdMethod string
+
+const (
+	EtcdMethodRange          EtcdMethod = "Range"
+	EtcdMethodPut            EtcdMethod = "Put"
+	EtcdMethodTxn            EtcdMethod = "Txn"
+	EtcdMethodWatch          EtcdMethod = "Watch"
+	EtcdMethodLeaseKeepAlive EtcdMethod = "LeaseKeepAlive"
+)
+
+// EtcdFault describes how calls to one etcd method are degraded.
+type EtcdFault struct {
+	// Latency is added before each request (or stream message) is sent.
+	Latency time.Duration
+	// ErrorRate is the probability in [0, 1] that a request fails with codes.Unavailable.
+	ErrorRate float64
+	// Blackhole makes requests hang until the fault is lifted or the request context is done.
+	// For streams, sent messages are silently dropped and received messages are held back.
+	Blackhole bool
+}
+
+// EtcdFaultProxy sits between milvus components and etcd and degrades the traffic
+// according to the faults configured by the test. It is implemented with grpc client
+// interceptors, so only clients created by NewClient are affected.
+type EtcdFaultProxy struct {
+	mu     sync.RWMutex
+	faults map[EtcdMethod]EtcdFault
+	// paused blackholes all methods regardless of faults, see Pause.
+	paused bool
+	// changed is closed and replaced each time faults are updated, to wake blackholed calls.
+	changed chan struct{}
+}
+
+// NewEtcdFaultProxy creates a proxy with no fault injected.
+func NewEtcdFaultProxy() *EtcdFaultProxy {
+	return &EtcdFaultProxy{
+		faults:  make(map[EtcdMethod]EtcdFault),
+		changed: make(chan struct{}),
+	}
+}
+
+// SetFault injects fault into method, replacing the previous one.
+func (p *EtcdFaultProxy) SetFault(method EtcdMethod, fault EtcdFault) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults[method] = fault
+	p.notifyLocked()
+	log.Info("etcd fault proxy set fault", zap.String("method", string(method)), zap.Any("fault", fault))
+}
+
+// ClearFault lifts the fault injected into method.
+func (p *EtcdFaultProxy) ClearFault(method EtcdMethod) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.faults, method)
+	p.notifyLocked()
+	log.Info("etcd fault proxy clear fault", zap.String("method", string(method)))
+}
+
+// Reset lifts all injected faults.
+func (p *EtcdFaultProxy) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults = make(map[EtcdMethod]EtcdFault)
+	p.notifyLocked()
+	log.Info("etcd fault proxy reset")
+}
+
+// Pause blackholes all traffic through the proxy until Resume is called,
+// as if the network between the clients and etcd was partitioned.
+func (p *EtcdFaultProxy) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = true
+	p.notifyLocked()
+	log.Info("etcd fault proxy paused")
+}
+
+// Resume lets the traffic paused by Pause through again, faults set by SetFault still apply.
+func (p *EtcdFaultProxy) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = false
+	p.notifyLocked()
+	log.Info("etcd fault proxy resumed")
+}
+
+func (p *EtcdFaultProxy) notifyLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+func (p *EtcdFaultProxy) getFault(fullMethod string) (EtcdFault, <-chan struct{}) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.paused {
+		return EtcdFault{Blackhole: true}, p.changed
+	}
+	return p.faults[EtcdMethod(path.Base(fullMethod))], p.changed
+}
+
+// NewClient creates an etcd client whose traffic goes through the proxy.
+func (p *EtcdFaultProxy) NewClient(endpoints []string) (*clientv3.Client, error) {
+	return newProxiedEtcdClient(endpoints, p)
+}
+
+// newProxiedEtcdClient creates an etcd client whose traffic goes through all the proxies in order.
+func newProxiedEtcdClient(endpoints []string, proxies ...*EtcdFaultProxy) (*clientv3.Client, error) {
+	var dialOptions []grpc.DialOption
+	for _, p := range proxies {
+		dialOptions = append(dialOptions, p.DialOptions()...)
+	}
+	return clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+		DialOptions: dialOptions,
+	})
+}
+
+// DialOptions returns the grpc dial options installing the proxy interceptors.
+func (p *EtcdFaultProxy) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(p.unaryInterceptor),
+		grpc.WithChainStreamInterceptor(p.streamInterceptor),
+	}
+}
+
+// waitBlackhole blocks while fullMethod is blackholed, returns the fault in effect afterwards.
+func (p *EtcdFaultProxy) waitBlackhole(ctx context.Context, fullMethod string) (EtcdFault, error) {
+	for {
+		fault, changed := p.getFault(fullMethod)
+		if !fault.Blackhole {
+			return fault, nil
+		}
+		select {
+		case <-ctx.Done():
+			return fault, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// inject applies blackhole, latency and error rate of fullMethod.
+func (p *EtcdFaultProxy) inject(ctx context.Context, fullMethod string) error {
+	fault, err := p.waitBlackhole(ctx, fullMethod)
+	if err != nil {
+		return err
+	}
+	if fault.Latency > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(fault.Latency):
+		}
+	}
+	if fault.ErrorRate > 0 && rand.Float64() < fault.ErrorRate {
+		return status.Errorf(codes.Unavailable, "etcd fault proxy injected error for %s", fullMethod)
+	}
+	return nil
+}
+
+func (p *EtcdFaultProxy) unaryInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+) error {
+	if err := p.inject(ctx, method); err != nil {
+		return err
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (p *EtcdFaultProxy) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc,
+	cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	fault, _ := p.getFault(method)
+	if !fault.Blackhole {
+		if err := p.inject(ctx, method); err != nil {
+			return nil, err
+		}
+	}
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &faultClientStream{ClientStream: stream, proxy: p, method: method}, nil
+}
+
+// faultClientStream applies the faults of a streaming method per message.
+type faultClientStream struct {
+	grpc.ClientStream
+	proxy  *EtcdFaultProxy
+	method string
+}
+
+func (s *faultClientStream) SendMsg(m interface{}) error {
+	fault, _ := s.proxy.getFault(s.method)
+	if fault.Blackhole {
+		// message is lost on the way to etcd
+		return nil
+	}
+	if err := s.proxy.inject(s.Context(), s.method); err != nil {
+		return err
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *faultClientStream) RecvMsg(m interface{}) error {
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return err
+	}
+	// hold the message back until the blackhole is lifted
+	_, err := s.proxy.waitBlackhole(s.Context(), s.method)
+	return err
+}
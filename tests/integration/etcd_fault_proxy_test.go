@@ -0,0 +1,188 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/milvuspb"
+	"github.com/milvus-io/milvus/internal/datanode"
+	"github.com/milvus-io/milvus/pkg/util/funcutil"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+	"github.com/milvus-io/milvus/pkg/util/typeutil"
+)
+
+type EtcdFaultProxySuite struct {
+	MiniClusterSuite
+	proxy *EtcdFaultProxy
+}
+
+func (s *EtcdFaultProxySuite) SetupTest() {
+	s.proxy = NewEtcdFaultProxy()
+	s.ClusterOptions = []Option{
+		WithEtcdFaultProxy(s.proxy),
+		// let the sessions of paused components expire soon
+		WithParam(params.CommonCfg.SessionTTL.Key, "10"),
+	}
+	s.MiniClusterSuite.SetupTest()
+}
+
+func (s *EtcdFaultProxySuite) TestErrorAndLatency() {
+	c := s.Cluster
+
+	s.proxy.SetFault(EtcdMethodRange, EtcdFault{ErrorRate: 1})
+	ctx, cancel := context.WithTimeout(c.GetContext(), time.Second)
+	_, err := c.EtcdCli.Get(ctx, "fault-proxy-test")
+	cancel()
+	s.Error(err)
+
+	// meta watcher keeps talking to etcd directly
+	sessions, err := c.MetaWatcher.ShowSessions()
+	s.NoError(err)
+	s.NotEmpty(sessions)
+
+	s.proxy.ClearFault(EtcdMethodRange)
+	s.proxy.SetFault(EtcdMethodPut, EtcdFault{Latency: 500 * time.Millisecond})
+	start := time.Now()
+	_, err = c.EtcdCli.Put(c.GetContext(), "fault-proxy-test", "value")
+	s.NoError(err)
+	s.GreaterOrEqual(time.Since(start), 500*time.Millisecond)
+
+	s.proxy.Reset()
+	_, err = c.EtcdCli.Get(c.GetContext(), "fault-proxy-test")
+	s.NoError(err)
+}
+
+func (s *EtcdFaultProxySuite) TestKeepAliveBlackhole() {
+	c := s.Cluster
+
+	// the datanode stops itself once its session expires and signals the process, catch the signal so
+	// the test keeps running
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT)
+	defer signal.Stop(sigCh)
+
+	s.Require().NoError(c.AddDataNode(nil))
+	victim := c.DataNodes[len(c.DataNodes)-1]
+	victimID := victim.(*datanode.DataNode).GetSession().ServerID
+	s.Eventually(func() bool { return s.hasSession(typeutil.DataNodeRole, victimID) }, 10*time.Second, 100*time.Millisecond)
+	sessions, err := c.MetaWatcher.ShowSessions()
+	s.Require().NoError(err)
+	dataCoordID := int64(-1)
+	for _, session := range sessions {
+		if session.ServerName == typeutil.DataCoordRole {
+			dataCoordID = session.ServerID
+		}
+	}
+	s.Require().NotEqual(int64(-1), dataCoordID)
+
+	// the keep alive requests of the datanode never reach etcd, so its session expires, the sessions
+	// of the other components keep being kept alive
+	conn, err := c.getComponentMetaConn(victim)
+	s.Require().NoError(err)
+	conn.proxy.SetFault(EtcdMethodLeaseKeepAlive, EtcdFault{Blackhole: true})
+	s.Eventually(func() bool { return !s.hasSession(typeutil.DataNodeRole, victimID) }, 30*time.Second, 500*time.Millisecond)
+	s.True(s.hasSession(typeutil.DataCoordRole, dataCoordID))
+
+	// once the fault is lifted, the datanode restarted in place of the stopped one registers again
+	conn.proxy.ClearFault(EtcdMethodLeaseKeepAlive)
+	s.Require().NoError(c.RemoveDataNode(victim))
+	s.Require().NoError(c.AddDataNode(nil))
+	restarted := c.DataNodes[len(c.DataNodes)-1]
+	restartedID := restarted.(*datanode.DataNode).GetSession().ServerID
+	s.Eventually(func() bool { return s.hasSession(typeutil.DataNodeRole, restartedID) }, 10*time.Second, 100*time.Millisecond)
+	s.Never(func() bool { return !s.hasSession(typeutil.DataNodeRole, restartedID) }, 15*time.Second, 500*time.Millisecond)
+	s.True(s.hasSession(typeutil.DataCoordRole, dataCoordID))
+}
+
+func (s *EtcdFaultProxySuite) TestPauseMetaConnectivity() {
+	c := s.Cluster
+	ctx, cancel := context.WithTimeout(c.GetContext(), 120*time.Second)
+	defer cancel()
+
+	// the paused datanode stops itself once its session is lost and signals the process,
+	// catch the signal so the test keeps running
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT)
+	defer signal.Stop(sigCh)
+
+	s.Require().NoError(c.AddDataNode(nil))
+	collectionName := "TestPauseMetaConnectivity" + funcutil.GenRandomStr()
+	marshaledSchema, err := proto.Marshal(ConstructSchema(collectionName, 8, true))
+	s.Require().NoError(err)
+	status, err := c.Proxy.CreateCollection(ctx, &milvuspb.CreateCollectionRequest{
+		CollectionName: collectionName,
+		Schema:         marshaledSchema,
+		ShardsNum:      2,
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(merr.Error(status))
+	s.Require().NoError(WaitForChannelsBalanced(ctx, c.MetaWatcher, 0))
+
+	victim, survivor := c.DataNodes[0], c.DataNodes[1]
+	victimID := victim.(*datanode.DataNode).GetSession().ServerID
+	survivorID := survivor.(*datanode.DataNode).GetSession().ServerID
+
+	// only the victim loses its meta connection, the watcher and other components keep working
+	s.Require().NoError(c.PauseMetaConnectivity(victim))
+	s.Eventually(func() bool { return !s.hasSession(typeutil.DataNodeRole, victimID) }, 30*time.Second, 500*time.Millisecond)
+	s.Eventually(func() bool {
+		assignment, err := listChannelAssignment(c.MetaWatcher)
+		s.Require().NoError(err)
+		_, victimAlive := assignment[victimID]
+		return !victimAlive && len(assignment[survivorID]) == 2
+	}, 60*time.Second, 500*time.Millisecond)
+
+	// the victim reaches etcd again once resumed
+	s.Require().NoError(c.ResumeMetaConnectivity(victim))
+	_, err = c.ComponentEtcdClient(victim).Get(ctx, "pause-meta-connectivity-test")
+	s.NoError(err)
+
+	// the victim has stopped itself, a restarted datanode registers again and takes back its share
+	s.Require().NoError(c.RemoveDataNode(victim))
+	s.Require().NoError(c.AddDataNode(nil))
+	restarted := c.DataNodes[len(c.DataNodes)-1]
+	restartedID := restarted.(*datanode.DataNode).GetSession().ServerID
+	s.Eventually(func() bool { return s.hasSession(typeutil.DataNodeRole, restartedID) }, 10*time.Second, 100*time.Millisecond)
+	s.NoError(WaitForChannelsBalanced(ctx, c.MetaWatcher, 0))
+
+	// components not created by the cluster have no dedicated connection
+	s.Error(c.PauseMetaConnectivity(struct{}{}))
+}
+
+func (s *EtcdFaultProxySuite) hasSession(serverName string, serverID int64) bool {
+	sessions, err := s.Cluster.MetaWatcher.ShowSessions()
+	s.Require().NoError(err)
+	for _, session := range sessions {
+		if session.ServerName == serverName && session.ServerID == serverID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEtcdFaultProxy(t *testing.T) {
+	suite.Run(t, new(EtcdFaultProxySuite))
+}
@@ -0,0 +1,107 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/milvus-io/milvus/pkg/util/typeutil"
+)
+
+// exclusiveRoles are the roles registering exclusive sessions, at most one server of each could be active.
+var exclusiveRoles = []string{
+	typeutil.RootCoordRole,
+	typeutil.DataCoordRole,
+	typeutil.QueryCoordRole,
+	typeutil.IndexCoordRole,
+}
+
+// CheckExclusiveRoles checks the sessions of the exclusive roles for split-brain.
+// Following sessionutil, the session at the key of the role, e.g. "rootcoord", is the active one.
+// With active-standby enabled, each server also registers an exclusive session at "<role>-<serverID>",
+// which is standby unless the server holds the active key. A non-exclusive session of an exclusive role,
+// e.g. registered by a server of another version during an upgrade, is never standby.
+// A violation is reported if more than one server is active for a role, or if the active key is held
+// by a server not among the registered sessions of the role.
+func CheckExclusiveRoles(watcher MetaWatcher) error {
+	entries, err := watcher.ShowSessionEntries()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var violations []string
+	for _, role := range exclusiveRoles {
+		// active are the keys of the active sessions by server id
+		active := make(map[int64][]string)
+		registered := make(map[int64]struct{})
+		activeSession, hasActive := entries[role]
+		if hasActive {
+			active[activeSession.ServerID] = append(active[activeSession.ServerID], role)
+		}
+		for _, key := range keys {
+			session := entries[key]
+			if key == role || session.ServerName != role {
+				continue
+			}
+			if !session.Exclusive {
+				active[session.ServerID] = append(active[session.ServerID], key)
+				continue
+			}
+			registered[session.ServerID] = struct{}{}
+		}
+
+		if len(active) > 1 {
+			activeKeys := make([]string, 0, len(active))
+			for _, keys := range active {
+				activeKeys = append(activeKeys, keys...)
+			}
+			sort.Strings(activeKeys)
+			violations = append(violations, fmt.Sprintf("%s has %d active servers, sessions: %v", role, len(active), activeKeys))
+		}
+		if !hasActive || len(registered) == 0 {
+			continue
+		}
+		if _, ok := registered[activeSession.ServerID]; !ok {
+			registeredIDs := make([]int64, 0, len(registered))
+			for serverID := range registered {
+				registeredIDs = append(registeredIDs, serverID)
+			}
+			sort.Slice(registeredIDs, func(i, j int) bool { return registeredIDs[i] < registeredIDs[j] })
+			violations = append(violations, fmt.Sprintf("active session of %s is held by server %d, which is not among the registered servers %v",
+				role, activeSession.ServerID, registeredIDs))
+		}
+	}
+	if len(violations) > 0 {
+		return errors.New(strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// AssertExclusiveRoles checks the sessions of the exclusive roles for split-brain, see CheckExclusiveRoles.
+// It's meant to be called right after the cluster is upgraded or restarted.
+func (cluster *MiniCluster) AssertExclusiveRoles() error {
+	return CheckExclusiveRoles(cluster.MetaWatcher)
+}
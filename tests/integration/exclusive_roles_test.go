@@ -0,0 +1,101 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/internal/proto/querypb"
+	"github.com/milvus-io/milvus/internal/util/sessionutil"
+	"github.com/milvus-io/milvus/pkg/util/typeutil"
+)
+
+type sessionMetaWatcher struct {
+	MetaWatcher
+	entries map[string]*sessionutil.Session
+}
+
+func (watcher *sessionMetaWatcher) ShowSessionEntries() (map[string]*sessionutil.Session, error) {
+	return watcher.entries, nil
+}
+
+func (watcher *sessionMetaWatcher) ShowReplicas() ([]*querypb.Replica, error) {
+	return nil, nil
+}
+
+func newTestSession(role string, serverID int64, exclusive bool) *sessionutil.Session {
+	session := &sessionutil.Session{}
+	session.ServerName = role
+	session.ServerID = serverID
+	session.Exclusive = exclusive
+	return session
+}
+
+func TestCheckExclusiveRoles(t *testing.T) {
+	t.Run("active standby", func(t *testing.T) {
+		watcher := &sessionMetaWatcher{entries: map[string]*sessionutil.Session{
+			"rootcoord":    newTestSession(typeutil.RootCoordRole, 1, true),
+			"rootcoord-1":  newTestSession(typeutil.RootCoordRole, 1, true),
+			"rootcoord-2":  newTestSession(typeutil.RootCoordRole, 2, true),
+			"datacoord":    newTestSession(typeutil.DataCoordRole, 3, true),
+			"querynode-4":  newTestSession(typeutil.QueryNodeRole, 4, false),
+			"querynode-5":  newTestSession(typeutil.QueryNodeRole, 5, false),
+			"querycoord-6": newTestSession(typeutil.QueryCoordRole, 6, true),
+		}}
+		assert.NoError(t, CheckExclusiveRoles(watcher))
+	})
+
+	t.Run("split brain", func(t *testing.T) {
+		// a rootcoord of another version registered without being exclusive during an upgrade
+		watcher := &sessionMetaWatcher{entries: map[string]*sessionutil.Session{
+			"rootcoord":   newTestSession(typeutil.RootCoordRole, 1, true),
+			"rootcoord-2": newTestSession(typeutil.RootCoordRole, 2, false),
+			"datacoord":   newTestSession(typeutil.DataCoordRole, 3, true),
+		}}
+		err := CheckExclusiveRoles(watcher)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "rootcoord has 2 active servers, sessions: [rootcoord rootcoord-2]")
+		assert.NotContains(t, err.Error(), "datacoord")
+	})
+
+	t.Run("unregistered active", func(t *testing.T) {
+		watcher := &sessionMetaWatcher{entries: map[string]*sessionutil.Session{
+			"querycoord":   newTestSession(typeutil.QueryCoordRole, 9, true),
+			"querycoord-1": newTestSession(typeutil.QueryCoordRole, 1, true),
+			"querycoord-2": newTestSession(typeutil.QueryCoordRole, 2, true),
+		}}
+		err := CheckExclusiveRoles(watcher)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "active session of querycoord is held by server 9, which is not among the registered servers [1 2]")
+	})
+
+	t.Run("invariant runner", func(t *testing.T) {
+		watcher := &sessionMetaWatcher{entries: map[string]*sessionutil.Session{
+			"datacoord":   newTestSession(typeutil.DataCoordRole, 1, true),
+			"datacoord-2": newTestSession(typeutil.DataCoordRole, 2, false),
+		}}
+		runner := NewInvariantRunner(watcher, 0)
+		runner.RegisterDefaults()
+		runner.RunOnce()
+		var violation *InvariantViolation
+		require.ErrorAs(t, runner.Checkpoint(), &violation)
+		assert.Equal(t, "exclusive roles", violation.Check)
+	})
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/suite"
@@ -49,6 +50,11 @@ type TestGetVectorSuite struct {
 	vecType    schemapb.DataType
 }
 
+func (s *TestGetVectorSuite) SetupTest() {
+	s.ClusterOptions = []integration.Option{integration.WithFastGC()}
+	s.MiniClusterSuite.SetupTest()
+}
+
 func (s *TestGetVectorSuite) run() {
 	ctx, cancel := context.WithCancel(s.Cluster.GetContext())
 	defer cancel()
@@ -277,12 +283,20 @@ func (s *TestGetVectorSuite) run() {
 		}
 	}
 
+	describeResp, err := s.Cluster.Proxy.DescribeCollection(ctx, &milvuspb.DescribeCollectionRequest{
+		DbName:         s.dbName,
+		CollectionName: collection,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(describeResp.GetStatus().GetErrorCode(), commonpb.ErrorCode_Success)
+
 	status, err := s.Cluster.Proxy.DropCollection(ctx, &milvuspb.DropCollectionRequest{
 		DbName:         s.dbName,
 		CollectionName: collection,
 	})
 	s.Require().NoError(err)
 	s.Require().Equal(status.GetErrorCode(), commonpb.ErrorCode_Success)
+	s.Require().NoError(integration.VerifyCollectionDropped(ctx, s.Cluster.MetaWatcher, describeResp.GetCollectionID(), time.Minute))
 }
 
 func (s *TestGetVectorSuite) TestGetVector_FLAT() {
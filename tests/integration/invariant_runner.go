@@ -0,0 +1,220 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/log"
+)
+
+// InvariantCheck checks a meta invariant, it returns an error describing the violation if any.
+type InvariantCheck func(watcher MetaWatcher) error
+
+// InvariantViolation is the first violation found by an InvariantRunner.
+type InvariantViolation struct {
+	Check  string
+	Err    error
+	Time   time.Time
+	Report string
+}
+
+func (v *InvariantViolation) Error() string {
+	return v.Report
+}
+
+type invariant struct {
+	name    string
+	check   InvariantCheck
+	enabled bool
+}
+
+// InvariantRunner runs the registered invariant checks periodically in background.
+// The first violation is recorded and returned by Checkpoint, so the test fails
+// where it calls Checkpoint instead of at teardown:
+//
+//	runner := NewInvariantRunner(c.MetaWatcher, time.Second)
+//	runner.RegisterDefaults()
+//	runner.Register("replica disjointness", checkReplicaDisjoint)
+//	runner.Start()
+//	defer runner.Stop()
+//	...
+//	s.Require().NoError(runner.Checkpoint())
+type InvariantRunner struct {
+	watcher  MetaWatcher
+	interval time.Duration
+
+	mu         sync.Mutex
+	invariants []*invariant
+	violation  *InvariantViolation
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewInvariantRunner(watcher MetaWatcher, interval time.Duration) *InvariantRunner {
+	return &InvariantRunner{
+		watcher:  watcher,
+		interval: interval,
+		closeCh:  make(chan struct{}),
+	}
+}
+
+// Register adds an enabled check, a check registered with the same name is replaced.
+func (runner *InvariantRunner) Register(name string, check InvariantCheck) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	for _, inv := range runner.invariants {
+		if inv.name == name {
+			inv.check = check
+			inv.enabled = true
+			return
+		}
+	}
+	runner.invariants = append(runner.invariants, &invariant{name: name, check: check, enabled: true})
+}
+
+// RegisterDefaults registers the built-in checks of the cluster wide invariants.
+func (runner *InvariantRunner) RegisterDefaults() {
+	runner.Register("exclusive roles", CheckExclusiveRoles)
+	runner.Register("compaction lineage", CheckCompactionLineage)
+	runner.Register("channel removal", CheckChannelRemoval(channelRemovalGracePeriod))
+}
+
+// SetEnabled enables or disables the check with given name.
+func (runner *InvariantRunner) SetEnabled(name string, enabled bool) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	for _, inv := range runner.invariants {
+		if inv.name == name {
+			inv.enabled = enabled
+			return
+		}
+	}
+}
+
+func (runner *InvariantRunner) Start() {
+	runner.startOnce.Do(func() {
+		runner.wg.Add(1)
+		go func() {
+			defer runner.wg.Done()
+			ticker := time.NewTicker(runner.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-runner.closeCh:
+					return
+				case <-ticker.C:
+					runner.RunOnce()
+				}
+			}
+		}()
+	})
+}
+
+func (runner *InvariantRunner) Stop() {
+	runner.closeOnce.Do(func() {
+		close(runner.closeCh)
+	})
+	runner.wg.Wait()
+}
+
+// RunOnce runs all enabled checks once, it stops at the first violation.
+// Checks are not run any more once a violation is recorded.
+func (runner *InvariantRunner) RunOnce() {
+	runner.mu.Lock()
+	if runner.violation != nil {
+		runner.mu.Unlock()
+		return
+	}
+	invariants := make([]invariant, 0, len(runner.invariants))
+	for _, inv := range runner.invariants {
+		if inv.enabled {
+			invariants = append(invariants, *inv)
+		}
+	}
+	runner.mu.Unlock()
+
+	for _, inv := range invariants {
+		if err := runInvariantCheck(inv.check, runner.watcher); err != nil {
+			runner.record(inv.name, err)
+			return
+		}
+	}
+}
+
+// Checkpoint returns the first violation found so far, nil if there is none.
+func (runner *InvariantRunner) Checkpoint() error {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	if runner.violation == nil {
+		return nil
+	}
+	return runner.violation
+}
+
+func (runner *InvariantRunner) record(name string, err error) {
+	now := time.Now()
+	violation := &InvariantViolation{
+		Check:  name,
+		Err:    err,
+		Time:   now,
+		Report: runner.report(name, err, now),
+	}
+
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	if runner.violation != nil {
+		return
+	}
+	runner.violation = violation
+	log.Warn("invariant violated", zap.String("check", name), zap.Error(err))
+}
+
+func (runner *InvariantRunner) report(name string, err error, now time.Time) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "invariant %q violated at %s:\n", name, now.Format(time.RFC3339Nano))
+	fmt.Fprintf(&sb, "  %v\n", err)
+	replicas, showErr := runner.watcher.ShowReplicas()
+	if showErr != nil {
+		fmt.Fprintf(&sb, "replicas: failed to show, %v\n", showErr)
+		return sb.String()
+	}
+	sb.WriteString("replicas:\n")
+	for _, replica := range replicas {
+		sb.WriteString(PrettyReplica(replica))
+	}
+	return sb.String()
+}
+
+// runInvariantCheck runs check, a panic is recovered and returned as the violation.
+func runInvariantCheck(check InvariantCheck, watcher MetaWatcher) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("check panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return check(watcher)
+}
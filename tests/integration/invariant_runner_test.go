@@ -0,0 +1,111 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/milvus-io/milvus/internal/proto/querypb"
+)
+
+type replicaMetaWatcher struct {
+	MetaWatcher
+	replicas []*querypb.Replica
+}
+
+func (watcher *replicaMetaWatcher) ShowReplicas() ([]*querypb.Replica, error) {
+	return watcher.replicas, nil
+}
+
+func TestInvariantRunner(t *testing.T) {
+	watcher := &replicaMetaWatcher{replicas: []*querypb.Replica{
+		{ID: 1, CollectionID: 100, Nodes: []int64{1, 2}},
+		{ID: 2, CollectionID: 100, Nodes: []int64{2, 3}},
+	}}
+	replicaDisjoint := func(watcher MetaWatcher) error {
+		replicas, err := watcher.ShowReplicas()
+		if err != nil {
+			return err
+		}
+		owners := make(map[int64]int64)
+		for _, replica := range replicas {
+			for _, node := range replica.GetNodes() {
+				if owner, ok := owners[node]; ok {
+					return fmt.Errorf("node %d is shared by replica %d and %d", node, owner, replica.GetID())
+				}
+				owners[node] = replica.GetID()
+			}
+		}
+		return nil
+	}
+
+	passed := atomic.NewInt32(0)
+	runner := NewInvariantRunner(watcher, 10*time.Millisecond)
+	runner.Register("always pass", func(MetaWatcher) error {
+		passed.Inc()
+		return nil
+	})
+	runner.Register("panic", func(MetaWatcher) error {
+		panic("mock panic")
+	})
+	runner.SetEnabled("panic", false)
+	runner.Register("replica disjointness", replicaDisjoint)
+
+	runner.Start()
+	defer runner.Stop()
+	assert.Eventually(t, func() bool {
+		return runner.Checkpoint() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var violation *InvariantViolation
+	require.ErrorAs(t, runner.Checkpoint(), &violation)
+	assert.Equal(t, "replica disjointness", violation.Check)
+	assert.EqualError(t, violation.Err, "node 2 is shared by replica 1 and 2")
+	assert.Contains(t, violation.Report, `invariant "replica disjointness" violated`)
+	assert.Contains(t, violation.Report, "Nodes:[2 3]")
+	assert.Greater(t, passed.Load(), int32(0))
+
+	// only the first violation is kept
+	runner.Register("replica disjointness", func(MetaWatcher) error {
+		return errors.New("another violation")
+	})
+	runner.RunOnce()
+	assert.Same(t, violation, runner.Checkpoint())
+
+	// panics are isolated and attributed to the check
+	runner = NewInvariantRunner(watcher, time.Hour)
+	runner.Register("always pass", func(MetaWatcher) error { return nil })
+	runner.Register("panic", func(MetaWatcher) error {
+		panic("mock panic")
+	})
+	runner.SetEnabled("panic", false)
+	runner.RunOnce()
+	assert.NoError(t, runner.Checkpoint())
+
+	runner.SetEnabled("panic", true)
+	runner.RunOnce()
+	require.ErrorAs(t, runner.Checkpoint(), &violation)
+	assert.Equal(t, "panic", violation.Check)
+	assert.ErrorContains(t, violation.Err, "mock panic")
+}
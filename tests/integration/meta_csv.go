@@ -0,0 +1,278 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/milvus-io/milvus/internal/proto/datapb"
+)
+
+// csvFlushRows is the number of rows buffered by the CSV exports before they are flushed to the writer.
+var csvFlushRows = 1000
+
+// The columns of the CSV exports, new columns are only appended so the column indexes stay stable.
+var (
+	segmentCSVHeader           = []string{"id", "collection", "partition", "channel", "state", "rows", "size", "created_ts", "dropped_ts"}
+	replicaCSVHeader           = []string{"id", "collection", "resource_group", "nodes"}
+	sessionCSVHeader           = []string{"key", "server_id", "server_name", "address", "version", "exclusive", "stopping"}
+	channelCheckpointCSVHeader = []string{"channel", "collection", "timestamp", "msg_id"}
+)
+
+// csvExporter writes the rows of a listing to w as CSV, flushing every csvFlushRows rows,
+// so a large listing isn't buffered in memory.
+type csvExporter struct {
+	writer *csv.Writer
+	rows   int
+}
+
+func newCSVExporter(w io.Writer, header []string) (*csvExporter, error) {
+	exporter := &csvExporter{writer: csv.NewWriter(w)}
+	if err := exporter.writer.Write(header); err != nil {
+		return nil, err
+	}
+	return exporter, nil
+}
+
+func (exporter *csvExporter) write(record []string) error {
+	if err := exporter.writer.Write(record); err != nil {
+		return err
+	}
+	exporter.rows++
+	if exporter.rows%csvFlushRows == 0 {
+		exporter.writer.Flush()
+		return exporter.writer.Error()
+	}
+	return nil
+}
+
+func (exporter *csvExporter) close() error {
+	exporter.writer.Flush()
+	return exporter.writer.Error()
+}
+
+func formatInt(value int64) string {
+	return strconv.FormatInt(value, 10)
+}
+
+func formatUint(value uint64) string {
+	return strconv.FormatUint(value, 10)
+}
+
+// ExportSegmentsCSV writes the segments of all collections to w as CSV with segmentCSVHeader, in
+// the order of WalkSegments. The size is the sum of the insert binlog sizes, created_ts is the
+// timestamp of the start position and dropped_ts is 0 if the segment is not dropped.
+func ExportSegmentsCSV(ctx context.Context, watcher MetaWatcher, w io.Writer) error {
+	exporter, err := newCSVExporter(w, segmentCSVHeader)
+	if err != nil {
+		return err
+	}
+
+	// the binlogs are persisted apart from the segments, only the sizes of one collection are kept
+	// as WalkSegments groups the segments by collection
+	sizesCollection := int64(-1)
+	var sizes map[int64]int64
+	err = watcher.WalkSegments(ctx, func(segment *datapb.SegmentInfo) error {
+		if segment.GetCollectionID() != sizesCollection {
+			binlogs, err := watcher.ShowBinlogs(segment.GetCollectionID())
+			if err != nil {
+				return err
+			}
+			sizes = make(map[int64]int64, len(binlogs))
+			for segmentID, fieldBinlogs := range binlogs {
+				sizes[segmentID] = binlogsSize(fieldBinlogs)
+			}
+			sizesCollection = segment.GetCollectionID()
+		}
+		size, ok := sizes[segment.GetID()]
+		if !ok {
+			size = binlogsSize(segment.GetBinlogs())
+		}
+		return exporter.write([]string{
+			formatInt(segment.GetID()),
+			formatInt(segment.GetCollectionID()),
+			formatInt(segment.GetPartitionID()),
+			segment.GetInsertChannel(),
+			segment.GetState().String(),
+			formatInt(segment.GetNumOfRows()),
+			formatInt(size),
+			formatUint(segment.GetStartPosition().GetTimestamp()),
+			formatUint(segment.GetDroppedAt()),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return exporter.close()
+}
+
+func binlogsSize(fieldBinlogs []*datapb.FieldBinlog) int64 {
+	var size int64
+	for _, fieldBinlog := range fieldBinlogs {
+		for _, binlog := range fieldBinlog.GetBinlogs() {
+			size += binlog.GetLogSize()
+		}
+	}
+	return size
+}
+
+// ExportReplicasCSV writes the replicas to w as CSV with replicaCSVHeader in id order,
+// the nodes of a replica are sorted and separated by spaces.
+func ExportReplicasCSV(watcher MetaWatcher, w io.Writer) error {
+	replicas, err := watcher.ShowReplicas()
+	if err != nil {
+		return err
+	}
+	sort.Slice(replicas, func(i, j int) bool {
+		return replicas[i].GetID() < replicas[j].GetID()
+	})
+
+	exporter, err := newCSVExporter(w, replicaCSVHeader)
+	if err != nil {
+		return err
+	}
+	for _, replica := range replicas {
+		nodes := append([]int64(nil), replica.GetNodes()...)
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+		nodeIDs := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			nodeIDs = append(nodeIDs, formatInt(node))
+		}
+		err := exporter.write([]string{
+			formatInt(replica.GetID()),
+			formatInt(replica.GetCollectionID()),
+			replica.GetResourceGroup(),
+			strings.Join(nodeIDs, " "),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return exporter.close()
+}
+
+// ExportSessionsCSV writes the sessions to w as CSV with sessionCSVHeader in key order,
+// the key is relative to the session root like ShowSessionEntries.
+func ExportSessionsCSV(watcher MetaWatcher, w io.Writer) error {
+	sessions, err := watcher.ShowSessionEntries()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(sessions))
+	for key := range sessions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	exporter, err := newCSVExporter(w, sessionCSVHeader)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		session := sessions[key]
+		err := exporter.write([]string{
+			key,
+			formatInt(session.ServerID),
+			session.ServerName,
+			session.Address,
+			session.SessionRaw.Version,
+			strconv.FormatBool(session.Exclusive),
+			strconv.FormatBool(session.Stopping),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return exporter.close()
+}
+
+// ExportChannelCheckpointsCSV writes the channel checkpoints to w as CSV with
+// channelCheckpointCSVHeader in channel order, the msg id is hex encoded.
+func ExportChannelCheckpointsCSV(watcher MetaWatcher, w io.Writer) error {
+	checkpoints, err := watcher.ShowChannelCheckpoints()
+	if err != nil {
+		return err
+	}
+	channels := make([]string, 0, len(checkpoints))
+	for channel := range checkpoints {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	exporter, err := newCSVExporter(w, channelCheckpointCSVHeader)
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		position := checkpoints[channel]
+		err := exporter.write([]string{
+			channel,
+			formatInt(parseCollectionIDFromVChannel(channel)),
+			formatUint(position.GetTimestamp()),
+			hex.EncodeToString(position.GetMsgID()),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return exporter.close()
+}
+
+// ExportAllCSV writes the CSV exports to segments.csv, replicas.csv, sessions.csv and
+// channel_checkpoints.csv under dir, which is created if not exists.
+func ExportAllCSV(ctx context.Context, watcher MetaWatcher, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	exports := []struct {
+		file   string
+		export func(w io.Writer) error
+	}{
+		{"segments.csv", func(w io.Writer) error { return ExportSegmentsCSV(ctx, watcher, w) }},
+		{"replicas.csv", func(w io.Writer) error { return ExportReplicasCSV(watcher, w) }},
+		{"sessions.csv", func(w io.Writer) error { return ExportSessionsCSV(watcher, w) }},
+		{"channel_checkpoints.csv", func(w io.Writer) error { return ExportChannelCheckpointsCSV(watcher, w) }},
+	}
+	for _, export := range exports {
+		if err := exportCSVFile(filepath.Join(dir, export.file), export.export); err != nil {
+			return errors.Wrapf(err, "failed to export %s", export.file)
+		}
+	}
+	return nil
+}
+
+func exportCSVFile(file string, export func(w io.Writer) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := export(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,298 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/msgpb"
+	"github.com/milvus-io/milvus/internal/proto/datapb"
+	"github.com/milvus-io/milvus/internal/proto/querypb"
+	"github.com/milvus-io/milvus/internal/util/sessionutil"
+	"github.com/milvus-io/milvus/pkg/util/funcutil"
+)
+
+type listingsMetaWatcher struct {
+	MetaWatcher
+	segments    []*datapb.SegmentInfo
+	binlogs     map[int64]map[int64][]*datapb.FieldBinlog
+	replicas    []*querypb.Replica
+	sessions    map[string]*sessionutil.Session
+	checkpoints map[string]*msgpb.MsgPosition
+	// binlogCalls counts the calls of ShowBinlogs by collection
+	binlogCalls map[int64]int
+}
+
+func (watcher *listingsMetaWatcher) WalkSegments(ctx context.Context, fn func(*datapb.SegmentInfo) error) error {
+	for _, segment := range watcher.segments {
+		if err := fn(segment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (watcher *listingsMetaWatcher) ShowBinlogs(collectionID int64) (map[int64][]*datapb.FieldBinlog, error) {
+	if watcher.binlogCalls == nil {
+		watcher.binlogCalls = make(map[int64]int)
+	}
+	watcher.binlogCalls[collectionID]++
+	return watcher.binlogs[collectionID], nil
+}
+
+func (watcher *listingsMetaWatcher) ShowReplicas() ([]*querypb.Replica, error) {
+	return watcher.replicas, nil
+}
+
+func (watcher *listingsMetaWatcher) ShowSessionEntries() (map[string]*sessionutil.Session, error) {
+	return watcher.sessions, nil
+}
+
+func (watcher *listingsMetaWatcher) ShowChannelCheckpoints() (map[string]*msgpb.MsgPosition, error) {
+	return watcher.checkpoints, nil
+}
+
+func newListingsMetaWatcher() *listingsMetaWatcher {
+	session := func(id int64, name, address string, exclusive bool) *sessionutil.Session {
+		s := &sessionutil.Session{}
+		s.ServerID, s.ServerName, s.Address, s.Exclusive = id, name, address, exclusive
+		s.SessionRaw.Version = "2.3.0"
+		return s
+	}
+	return &listingsMetaWatcher{
+		segments: []*datapb.SegmentInfo{
+			{
+				ID: 1001, CollectionID: 100, PartitionID: 101, InsertChannel: "by-dev-rootcoord-dml_0_100v0",
+				State: commonpb.SegmentState_Flushed, NumOfRows: 3000, StartPosition: &msgpb.MsgPosition{Timestamp: 400},
+			},
+			{
+				ID: 1002, CollectionID: 100, PartitionID: 101, InsertChannel: "by-dev-rootcoord-dml_0_100v0",
+				State: commonpb.SegmentState_Dropped, NumOfRows: 10, DroppedAt: 500,
+			},
+			{
+				// binlogs kept in the segment, and a channel to escape
+				ID: 2001, CollectionID: 200, PartitionID: 201, InsertChannel: "weird,\"channel\"",
+				State:   commonpb.SegmentState_Growing,
+				Binlogs: []*datapb.FieldBinlog{{FieldID: 1, Binlogs: []*datapb.Binlog{{LogSize: 7}}}},
+			},
+		},
+		binlogs: map[int64]map[int64][]*datapb.FieldBinlog{
+			100: {
+				1001: {
+					{FieldID: 1, Binlogs: []*datapb.Binlog{{LogSize: 100}, {LogSize: 20}}},
+					{FieldID: 2, Binlogs: []*datapb.Binlog{{LogSize: 3}}},
+				},
+			},
+		},
+		replicas: []*querypb.Replica{
+			{ID: 2, CollectionID: 100, Nodes: []int64{5, 3}, ResourceGroup: "__default_resource_group"},
+			{ID: 1, CollectionID: 100, Nodes: []int64{4}, ResourceGroup: "rg\nwith newline"},
+		},
+		sessions: map[string]*sessionutil.Session{
+			"querynode-2": session(2, "querynode", "localhost:21123", false),
+			"rootcoord":   session(1, "rootcoord", "localhost:53100", true),
+		},
+		checkpoints: map[string]*msgpb.MsgPosition{
+			"by-dev-rootcoord-dml_1_100v1": {MsgID: []byte{0xab, 0x01}, Timestamp: 300},
+			"by-dev-rootcoord-dml_0_100v0": {MsgID: []byte{0x0f}, Timestamp: 200},
+		},
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	ctx := context.Background()
+	watcher := newListingsMetaWatcher()
+
+	for _, c := range []struct {
+		name     string
+		export   func(buf *bytes.Buffer) error
+		expected string
+	}{
+		{
+			"segments",
+			func(buf *bytes.Buffer) error { return ExportSegmentsCSV(ctx, watcher, buf) },
+			"id,collection,partition,channel,state,rows,size,created_ts,dropped_ts\n" +
+				"1001,100,101,by-dev-rootcoord-dml_0_100v0,Flushed,3000,123,400,0\n" +
+				"1002,100,101,by-dev-rootcoord-dml_0_100v0,Dropped,10,0,0,500\n" +
+				"2001,200,201,\"weird,\"\"channel\"\"\",Growing,0,7,0,0\n",
+		},
+		{
+			"replicas",
+			func(buf *bytes.Buffer) error { return ExportReplicasCSV(watcher, buf) },
+			"id,collection,resource_group,nodes\n" +
+				"1,100,\"rg\nwith newline\",4\n" +
+				"2,100,__default_resource_group,3 5\n",
+		},
+		{
+			"sessions",
+			func(buf *bytes.Buffer) error { return ExportSessionsCSV(watcher, buf) },
+			"key,server_id,server_name,address,version,exclusive,stopping\n" +
+				"querynode-2,2,querynode,localhost:21123,2.3.0,false,false\n" +
+				"rootcoord,1,rootcoord,localhost:53100,2.3.0,true,false\n",
+		},
+		{
+			"channel checkpoints",
+			func(buf *bytes.Buffer) error { return ExportChannelCheckpointsCSV(watcher, buf) },
+			"channel,collection,timestamp,msg_id\n" +
+				"by-dev-rootcoord-dml_0_100v0,100,200,0f\n" +
+				"by-dev-rootcoord-dml_1_100v1,100,300,ab01\n",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			require.NoError(t, c.export(buf))
+			assert.Equal(t, c.expected, buf.String())
+			// the escaped values are read back as they are
+			_, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+			assert.NoError(t, err)
+		})
+	}
+	// the binlogs are listed once per collection
+	assert.Equal(t, map[int64]int{100: 1, 200: 1}, watcher.binlogCalls)
+
+	dir := filepath.Join(t.TempDir(), "dump")
+	require.NoError(t, ExportAllCSV(ctx, watcher, dir))
+	for file, rows := range map[string]int{"segments.csv": 3, "replicas.csv": 2, "sessions.csv": 2, "channel_checkpoints.csv": 2} {
+		content, err := os.ReadFile(filepath.Join(dir, file))
+		assert.NoError(t, err)
+		records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+		assert.NoError(t, err)
+		assert.Len(t, records, rows+1, file)
+	}
+}
+
+// countingWriter counts the lines written to it without keeping them.
+type countingWriter struct {
+	lines int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.lines += bytes.Count(p, []byte("\n"))
+	return len(p), nil
+}
+
+// syntheticSegmentsMetaWatcher generates the segments while they are walked.
+type syntheticSegmentsMetaWatcher struct {
+	MetaWatcher
+	count int
+	// onSegment is called before each segment is passed to the walk
+	onSegment func(i int)
+}
+
+func (watcher *syntheticSegmentsMetaWatcher) WalkSegments(ctx context.Context, fn func(*datapb.SegmentInfo) error) error {
+	for i := 0; i < watcher.count; i++ {
+		watcher.onSegment(i)
+		err := fn(&datapb.SegmentInfo{
+			ID:            int64(i),
+			CollectionID:  int64(i / 1000),
+			InsertChannel: "by-dev-rootcoord-dml_0_" + strconv.Itoa(i/1000) + "v0",
+			State:         commonpb.SegmentState_Flushed,
+			NumOfRows:     int64(i),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (watcher *syntheticSegmentsMetaWatcher) ShowBinlogs(collectionID int64) (map[int64][]*datapb.FieldBinlog, error) {
+	return nil, nil
+}
+
+func TestExportSegmentsCSVStreaming(t *testing.T) {
+	const count = 200000
+	w := &countingWriter{}
+	// the rows are flushed while the segments are walked, at most csvFlushRows rows are buffered
+	watcher := &syntheticSegmentsMetaWatcher{count: count, onSegment: func(i int) {
+		if i > 0 && i%csvFlushRows == 0 {
+			assert.Equal(t, i+1, w.lines, "segment %d", i)
+		}
+	}}
+	require.NoError(t, ExportSegmentsCSV(context.Background(), watcher, w))
+	assert.Equal(t, count+1, w.lines)
+}
+
+func (s *MetaWatcherSuite) TestExportAllCSV() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	collectionName := "TestExportAllCSV" + funcutil.GenRandomStr()
+	collectionID, _ := s.prepareFlushedCollection(ctx, collectionName, 3000)
+
+	// WalkSegments pages through the segments listed by ShowSegments
+	defer func(pageSize int64) { metaSnapshotPageSize = pageSize }(metaSnapshotPageSize)
+	metaSnapshotPageSize = 1
+	segments, err := c.MetaWatcher.ShowSegments()
+	s.Require().NoError(err)
+	var walked []int64
+	s.Require().NoError(c.MetaWatcher.WalkSegments(ctx, func(segment *datapb.SegmentInfo) error {
+		walked = append(walked, segment.GetID())
+		return nil
+	}))
+	expected := make([]int64, 0, len(segments))
+	for _, segment := range segments {
+		expected = append(expected, segment.GetID())
+	}
+	s.ElementsMatch(expected, walked)
+
+	dir := s.T().TempDir()
+	s.Require().NoError(ExportAllCSV(ctx, c.MetaWatcher, dir))
+
+	read := func(file string) [][]string {
+		f, err := os.Open(filepath.Join(dir, file))
+		s.Require().NoError(err)
+		defer f.Close()
+		records, err := csv.NewReader(f).ReadAll()
+		s.Require().NoError(err)
+		s.Require().NotEmpty(records)
+		return records
+	}
+	records := read("segments.csv")
+	s.Equal(segmentCSVHeader, records[0])
+	var rows, flushed int64
+	for _, record := range records[1:] {
+		if record[1] != strconv.FormatInt(collectionID, 10) || record[4] != commonpb.SegmentState_Flushed.String() {
+			continue
+		}
+		flushed++
+		n, err := strconv.ParseInt(record[5], 10, 64)
+		s.Require().NoError(err)
+		rows += n
+		size, err := strconv.ParseInt(record[6], 10, 64)
+		s.Require().NoError(err)
+		s.Positive(size)
+	}
+	s.Positive(flushed)
+	s.EqualValues(3000, rows)
+
+	s.Equal(sessionCSVHeader, read("sessions.csv")[0])
+	s.Greater(len(read("sessions.csv")), 1)
+	s.Equal(replicaCSVHeader, read("replicas.csv")[0])
+	s.Equal(channelCheckpointCSVHeader, read("channel_checkpoints.csv")[0])
+}
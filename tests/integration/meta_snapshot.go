@@ -0,0 +1,240 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/common"
+	"github.com/milvus-io/milvus/pkg/log"
+)
+
+// metaSnapshotPageSize is the number of keys fetched from etcd per request by ExportMeta.
+var metaSnapshotPageSize int64 = 1000
+
+// metaLayoutMarkers are the top level prefixes under the meta root written by this version,
+// prefixes of older versions, e.g. "queryCoord-collectionMeta", are not included.
+var metaLayoutMarkers = []string{
+	"channelwatch",
+	"datacoord-meta",
+	"field-index",
+	"queryCoord-ResourceGroup",
+	"querycoord-collection-loadinfo",
+	"querycoord-partition-loadinfo",
+	"querycoord-replica",
+	"root-coord",
+	"segment-index",
+	"session",
+	"snapshots",
+}
+
+// MetaSnapshotHeader is the first line of a meta snapshot, the following lines are the
+// metaSnapshotEntry of each key under the root path in key order.
+type MetaSnapshotHeader struct {
+	RootPath string `json:"rootPath"`
+	// Version is the version of milvus exporting the snapshot.
+	Version string `json:"version"`
+	// Layout is the top level prefixes under the meta root, which tells the meta layout.
+	Layout []string `json:"layout"`
+}
+
+type metaSnapshotEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// MetaSnapshotFilter selects the keys imported from a snapshot by the prefixes relative to
+// the root path, e.g. "meta/session/". All keys are included if Include is empty, a key matching
+// both Include and Exclude is excluded.
+type MetaSnapshotFilter struct {
+	Include []string
+	Exclude []string
+}
+
+func (filter MetaSnapshotFilter) match(key string) bool {
+	for _, prefix := range filter.Exclude {
+		if strings.HasPrefix(key, prefix) {
+			return false
+		}
+	}
+	if len(filter.Include) == 0 {
+		return true
+	}
+	for _, prefix := range filter.Include {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportMeta writes all keys under rootPath to w as a meta snapshot, which could be imported by
+// ImportMeta to reproduce the meta state, e.g. of a user-reported corruption.
+// Keys are read page by page, so the snapshot is not of a single revision if the meta changes,
+// and kept in memory until all are read, as the header describes the layout of all keys.
+func ExportMeta(ctx context.Context, etcdCli *clientv3.Client, rootPath string, w io.Writer) error {
+	prefix := strings.TrimSuffix(rootPath, "/") + "/"
+	rangeEnd := clientv3.GetPrefixRangeEnd(prefix)
+
+	var entries []metaSnapshotEntry
+	layout := make(map[string]struct{})
+	startKey := prefix
+	for {
+		resp, err := etcdCli.Get(ctx, startKey, clientv3.WithRange(rangeEnd), clientv3.WithLimit(metaSnapshotPageSize))
+		if err != nil {
+			return err
+		}
+		for _, kv := range resp.Kvs {
+			entries = append(entries, metaSnapshotEntry{Key: string(kv.Key), Value: kv.Value})
+			if component, ok := metaLayoutComponent(strings.TrimPrefix(string(kv.Key), prefix)); ok {
+				layout[component] = struct{}{}
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			break
+		}
+		startKey = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+
+	header := MetaSnapshotHeader{
+		RootPath: strings.TrimSuffix(rootPath, "/"),
+		Version:  common.Version.String(),
+		Layout:   make([]string, 0, len(layout)),
+	}
+	for component := range layout {
+		header.Layout = append(header.Layout, component)
+	}
+	sort.Strings(header.Layout)
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(header); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metaLayoutComponent returns the top level prefix under the meta root of the key relative to the root path.
+func metaLayoutComponent(key string) (string, bool) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) < 3 || parts[0] != "meta" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// checkMetaSnapshotLayout returns the differences between the layout of the snapshot and this version.
+func checkMetaSnapshotLayout(header MetaSnapshotHeader) []string {
+	var mismatches []string
+	if header.Version != common.Version.String() {
+		mismatches = append(mismatches, fmt.Sprintf("snapshot is exported by version %s, current version is %s", header.Version, common.Version.String()))
+	}
+	for _, component := range header.Layout {
+		known := false
+		for _, marker := range metaLayoutMarkers {
+			if component == marker {
+				known = true
+				break
+			}
+		}
+		if !known {
+			mismatches = append(mismatches, fmt.Sprintf("meta prefix %s of snapshot is not written by current version", component))
+		}
+	}
+	return mismatches
+}
+
+// ImportMeta writes the keys of the meta snapshot from r under rootPath, the keys are translated
+// from the root path of the snapshot, only the keys selected by filter are written.
+// Differences between the layout of the snapshot and this version are logged as warnings.
+// It returns the number of keys written.
+func ImportMeta(ctx context.Context, etcdCli *clientv3.Client, rootPath string, r io.Reader, filter MetaSnapshotFilter) (int, error) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	var header MetaSnapshotHeader
+	if err := decoder.Decode(&header); err != nil {
+		return 0, errors.Wrap(err, "failed to read meta snapshot header")
+	}
+	for _, mismatch := range checkMetaSnapshotLayout(header) {
+		log.Warn("meta snapshot layout mismatch", zap.String("snapshotRootPath", header.RootPath), zap.String("mismatch", mismatch))
+	}
+
+	prefix := header.RootPath + "/"
+	rootPath = strings.TrimSuffix(rootPath, "/")
+	imported := 0
+	for {
+		var entry metaSnapshotEntry
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, errors.Wrap(err, "failed to read meta snapshot entry")
+		}
+		if !strings.HasPrefix(entry.Key, prefix) {
+			return imported, errors.Newf("key %s of meta snapshot is not under root path %s", entry.Key, header.RootPath)
+		}
+		key := strings.TrimPrefix(entry.Key, prefix)
+		if !filter.match(key) {
+			continue
+		}
+		if _, err := etcdCli.Put(ctx, rootPath+"/"+key, string(entry.Value)); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	log.Info("meta snapshot imported", zap.String("snapshotRootPath", header.RootPath), zap.String("rootPath", rootPath), zap.Int("keys", imported))
+	return imported, nil
+}
+
+// WithMetaSnapshot preloads the meta store from the meta snapshot file exported by ExportMeta
+// before the components start, e.g. excluding "meta/session/" to drop the sessions of the
+// exporting cluster.
+func WithMetaSnapshot(file string, filter MetaSnapshotFilter) Option {
+	return func(cluster *MiniCluster) {
+		cluster.metaSnapshot = &metaSnapshot{file: file, filter: filter}
+	}
+}
+
+type metaSnapshot struct {
+	file   string
+	filter MetaSnapshotFilter
+}
+
+func (snapshot *metaSnapshot) importTo(ctx context.Context, etcdCli *clientv3.Client, rootPath string) error {
+	f, err := os.Open(snapshot.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = ImportMeta(ctx, etcdCli, rootPath, f, snapshot.filter)
+	return err
+}
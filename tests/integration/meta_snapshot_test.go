@@ -0,0 +1,131 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/milvus-io/milvus/pkg/common"
+)
+
+func TestMetaSnapshotFilter(t *testing.T) {
+	filter := MetaSnapshotFilter{}
+	assert.True(t, filter.match("meta/session/datanode-1"))
+	assert.True(t, filter.match("kv/gid/timestamp"))
+
+	filter = MetaSnapshotFilter{Exclude: []string{"meta/session/"}}
+	assert.False(t, filter.match("meta/session/datanode-1"))
+	assert.True(t, filter.match("meta/root-coord/collection/100"))
+
+	filter = MetaSnapshotFilter{Include: []string{"meta/"}, Exclude: []string{"meta/session/"}}
+	assert.False(t, filter.match("meta/session/datanode-1"))
+	assert.False(t, filter.match("kv/gid/timestamp"))
+	assert.True(t, filter.match("meta/datacoord-meta/s/100/101/1"))
+}
+
+func TestCheckMetaSnapshotLayout(t *testing.T) {
+	header := MetaSnapshotHeader{
+		RootPath: "by-dev",
+		Version:  common.Version.String(),
+		Layout:   []string{"datacoord-meta", "root-coord", "session"},
+	}
+	assert.Empty(t, checkMetaSnapshotLayout(header))
+
+	header.Version = "2.1.4"
+	header.Layout = append(header.Layout, "queryCoord-collectionMeta")
+	assert.Equal(t, []string{
+		"snapshot is exported by version 2.1.4, current version is " + common.Version.String(),
+		"meta prefix queryCoord-collectionMeta of snapshot is not written by current version",
+	}, checkMetaSnapshotLayout(header))
+}
+
+func TestMetaLayoutComponent(t *testing.T) {
+	component, ok := metaLayoutComponent("meta/datacoord-meta/s/100/101/1")
+	assert.True(t, ok)
+	assert.Equal(t, "datacoord-meta", component)
+
+	_, ok = metaLayoutComponent("kv/gid/timestamp")
+	assert.False(t, ok)
+	_, ok = metaLayoutComponent("meta/session")
+	assert.False(t, ok)
+}
+
+func TestExportImportMeta(t *testing.T) {
+	ctx := context.Background()
+	etcdCli := newTestEtcdClient(t)
+
+	keys := map[string]string{
+		"meta/root-coord/collection/100":  "collection",
+		"meta/datacoord-meta/s/100/101/1": "segment",
+		"meta/session/datanode-1":         "session",
+		"kv/gid/timestamp":                "ts",
+	}
+	for key, value := range keys {
+		_, err := etcdCli.Put(ctx, "by-dev/"+key, value)
+		require.NoError(t, err)
+	}
+	// keys of other root paths are not exported
+	_, err := etcdCli.Put(ctx, "by-dev-other/meta/root-coord/collection/200", "other")
+	require.NoError(t, err)
+
+	defer func(pageSize int64) { metaSnapshotPageSize = pageSize }(metaSnapshotPageSize)
+	metaSnapshotPageSize = 2
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, ExportMeta(ctx, etcdCli, "by-dev/", buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1+len(keys))
+	var header MetaSnapshotHeader
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &header))
+	assert.Equal(t, MetaSnapshotHeader{
+		RootPath: "by-dev",
+		Version:  common.Version.String(),
+		Layout:   []string{"datacoord-meta", "root-coord", "session"},
+	}, header)
+
+	// the keys are translated to the new root path, the sessions are excluded
+	snapshotFile := filepath.Join(t.TempDir(), "meta.json")
+	require.NoError(t, os.WriteFile(snapshotFile, buf.Bytes(), 0o600))
+	snapshot := &metaSnapshot{file: snapshotFile, filter: MetaSnapshotFilter{Exclude: []string{"meta/session/"}}}
+	require.NoError(t, snapshot.importTo(ctx, etcdCli, "bootstrap-by-dev/"))
+	resp, err := etcdCli.Get(ctx, "bootstrap-by-dev/", clientv3.WithPrefix())
+	require.NoError(t, err)
+	imported := make(map[string]string)
+	for _, kv := range resp.Kvs {
+		imported[string(kv.Key)] = string(kv.Value)
+	}
+	assert.Equal(t, map[string]string{
+		"bootstrap-by-dev/meta/root-coord/collection/100":  "collection",
+		"bootstrap-by-dev/meta/datacoord-meta/s/100/101/1": "segment",
+		"bootstrap-by-dev/kv/gid/timestamp":                "ts",
+	}, imported)
+
+	// a key out of the root path of the header is rejected
+	corrupted := lines[0] + "\n" + `{"key":"other/meta/session/datanode-1","value":""}` + "\n"
+	_, err = ImportMeta(ctx, etcdCli, "corrupted", strings.NewReader(corrupted), MetaSnapshotFilter{})
+	assert.ErrorContains(t, err, "is not under root path by-dev")
+}
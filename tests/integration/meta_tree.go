@@ -0,0 +1,132 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// metaTreePageSize is the number of keys fetched from etcd per request by PrintMetaTree.
+var metaTreePageSize int64 = 1000
+
+type metaTreeNode struct {
+	name     string
+	count    int64
+	size     int64
+	children map[string]*metaTreeNode
+}
+
+func (node *metaTreeNode) child(name string) *metaTreeNode {
+	if node.children == nil {
+		node.children = make(map[string]*metaTreeNode)
+	}
+	child, ok := node.children[name]
+	if !ok {
+		child = &metaTreeNode{name: name}
+		node.children[name] = child
+	}
+	return child
+}
+
+// PrintMetaTree writes the key tree under rootPath to w, each line is a path component
+// with the number of keys and the bytes of keys and values below it.
+// Components deeper than maxDepth are aggregated into their ancestor, siblings are
+// sorted by size, largest first. Keys are read page by page, only the aggregated
+// tree is kept in memory.
+func PrintMetaTree(ctx context.Context, etcdCli *clientv3.Client, rootPath string, maxDepth int, w io.Writer) error {
+	prefix := strings.TrimSuffix(rootPath, "/") + "/"
+	rangeEnd := clientv3.GetPrefixRangeEnd(prefix)
+	root := &metaTreeNode{name: rootPath}
+
+	startKey := prefix
+	for {
+		resp, err := etcdCli.Get(ctx, startKey, clientv3.WithRange(rangeEnd), clientv3.WithLimit(metaTreePageSize))
+		if err != nil {
+			return err
+		}
+		for _, kv := range resp.Kvs {
+			size := int64(len(kv.Key) + len(kv.Value))
+			node := root
+			node.count++
+			node.size += size
+			components := strings.Split(strings.TrimPrefix(string(kv.Key), prefix), "/")
+			depth := 0
+			for _, component := range components {
+				if depth >= maxDepth {
+					break
+				}
+				if component == "" {
+					continue
+				}
+				node = node.child(component)
+				node.count++
+				node.size += size
+				depth++
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			break
+		}
+		startKey = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+
+	return printMetaTreeNode(w, root, 0)
+}
+
+func printMetaTreeNode(w io.Writer, node *metaTreeNode, depth int) error {
+	_, err := fmt.Fprintf(w, "%s%s (%d keys, %s)\n", strings.Repeat("  ", depth), node.name, node.count, formatSize(node.size))
+	if err != nil {
+		return err
+	}
+
+	children := make([]*metaTreeNode, 0, len(node.children))
+	for _, child := range node.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].size != children[j].size {
+			return children[i].size > children[j].size
+		}
+		return children[i].name < children[j].name
+	})
+	for _, child := range children {
+		if err := printMetaTreeNode(w, child, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatSize formats bytes in binary units, e.g. 1536 to "1.5 KiB".
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTP"[exp])
+}
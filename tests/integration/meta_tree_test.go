@@ -0,0 +1,98 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/milvus-io/milvus/pkg/util/etcd"
+)
+
+// newTestEtcdClient returns a client of an embed etcd server stopped at the end of the test.
+func newTestEtcdClient(t *testing.T) *clientv3.Client {
+	server, dir, err := etcd.StartTestEmbedEtcdServer()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+	etcdCli, err := clientv3.New(clientv3.Config{Endpoints: etcd.GetEmbedEtcdEndpoints(server)})
+	require.NoError(t, err)
+	t.Cleanup(func() { etcdCli.Close() })
+	return etcdCli
+}
+
+func TestPrintMetaTree(t *testing.T) {
+	ctx := context.Background()
+	etcdCli := newTestEtcdClient(t)
+
+	rootPath := "/meta-tree-test"
+	// sizes count the full key, e.g. "/meta-tree-test/a/x/k1" takes 22 bytes
+	for key, valueSize := range map[string]int{
+		"a/x/k1": 1000,
+		"a/x/k2": 1000,
+		"a/y/k1": 100,
+		"b/k1":   3000,
+		"c":      10,
+	} {
+		_, err := etcdCli.Put(ctx, rootPath+"/"+key, strings.Repeat("v", valueSize))
+		require.NoError(t, err)
+	}
+	// keys out of the root path are not counted
+	_, err := etcdCli.Put(ctx, rootPath+"-other/k1", "v")
+	require.NoError(t, err)
+
+	defer func(pageSize int64) { metaTreePageSize = pageSize }(metaTreePageSize)
+	metaTreePageSize = 2
+
+	buf := &bytes.Buffer{}
+	err = PrintMetaTree(ctx, etcdCli, rootPath, 2, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `/meta-tree-test (5 keys, 5.1 KiB)
+  b (1 keys, 2.9 KiB)
+    k1 (1 keys, 2.9 KiB)
+  a (3 keys, 2.1 KiB)
+    x (2 keys, 2.0 KiB)
+    y (1 keys, 122 B)
+  c (1 keys, 27 B)
+`, buf.String())
+
+	buf.Reset()
+	err = PrintMetaTree(ctx, etcdCli, rootPath, 1, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `/meta-tree-test (5 keys, 5.1 KiB)
+  b (1 keys, 2.9 KiB)
+  a (3 keys, 2.1 KiB)
+  c (1 keys, 27 B)
+`, buf.String())
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "0 B", formatSize(0))
+	assert.Equal(t, "1023 B", formatSize(1023))
+	assert.Equal(t, "1.5 KiB", formatSize(1536))
+	assert.Equal(t, "1.0 MiB", formatSize(1<<20))
+	assert.Equal(t, "2.0 GiB", formatSize(2<<30))
+}
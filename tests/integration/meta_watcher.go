@@ -22,29 +22,65 @@ import (
 	"fmt"
 	"path"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/samber/lo"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/zap"
 
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/msgpb"
+	"github.com/milvus-io/milvus/internal/metastore/kv/rootcoord"
 	"github.com/milvus-io/milvus/internal/proto/datapb"
+	"github.com/milvus-io/milvus/internal/proto/etcdpb"
+	"github.com/milvus-io/milvus/internal/proto/indexpb"
 	"github.com/milvus-io/milvus/internal/proto/querypb"
+	"github.com/milvus-io/milvus/internal/storage"
 	"github.com/milvus-io/milvus/internal/util/sessionutil"
 	"github.com/milvus-io/milvus/pkg/log"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+	"github.com/milvus-io/milvus/pkg/util/metautil"
+	"github.com/milvus-io/milvus/pkg/util/tsoutil"
 )
 
 // MetaWatcher to observe meta data of milvus cluster
 type MetaWatcher interface {
 	ShowSessions() ([]*sessionutil.Session, error)
+	ShowSessionEntries() (map[string]*sessionutil.Session, error)
 	ShowSegments() ([]*datapb.SegmentInfo, error)
+	WalkSegments(ctx context.Context, fn func(*datapb.SegmentInfo) error) error
 	ShowReplicas() ([]*querypb.Replica, error)
+	ShowCollectionLoadInfos() ([]*querypb.CollectionLoadInfo, error)
+	SegmentStatistics(segmentID int64) (SegmentStats, error)
+	ShowCollections() ([]*etcdpb.CollectionInfo, error)
+	ShowChannelRemovalState() ([]*ChannelRemovalState, error)
+	ShowBinlogs(collectionID int64) (map[int64][]*datapb.FieldBinlog, error)
+	ShowDeltalogs(collectionID int64) (map[int64][]*datapb.FieldBinlog, error)
+	ShowStatslogs(collectionID int64) (map[int64][]*datapb.FieldBinlog, error)
+	ShowIndexes(collectionID int64) ([]*indexpb.FieldIndex, error)
+	ShowSegmentIndexes(collectionID int64) ([]*indexpb.SegmentIndex, error)
+	ShowChannelCheckpoints() (map[string]*msgpb.MsgPosition, error)
+	ShowCollectionMetaKeys(collectionID int64) (map[string][]string, error)
+	SegmentTimeline(segmentID int64) (string, error)
+	RecordSegmentTransitions(ctx context.Context, collectionID int64) ([]SegmentTransition, error)
+	MetaKeyCounts() (map[string]int, error)
+	ShowAll() (map[string][]proto.Message, error)
 }
 
 type EtcdMetaWatcher struct {
 	MetaWatcher
 	rootPath string
 	etcdCli  *clientv3.Client
+	// chunkManager is used to read stats logs, optional
+	chunkManager storage.ChunkManager
+
+	subsystemsMu sync.Mutex
+	// subsystems are the meta subsystems decoded by ShowAll by name, defaultMetaSubsystems if nil
+	subsystems map[string]metaSubsystem
 }
 
 func (watcher *EtcdMetaWatcher) ShowSessions() ([]*sessionutil.Session, error) {
@@ -52,6 +88,29 @@ func (watcher *EtcdMetaWatcher) ShowSessions() ([]*sessionutil.Session, error) {
 	return listSessionsByPrefix(watcher.etcdCli, metaPath)
 }
 
+// ShowSessionEntries returns the sessions by their keys relative to the session root, e.g. "rootcoord"
+// for the active session of an exclusive role and "querynode-1" for the others.
+func (watcher *EtcdMetaWatcher) ShowSessionEntries() (map[string]*sessionutil.Session, error) {
+	prefix := path.Join(watcher.rootPath, "meta", sessionutil.DefaultServiceRoot) + "/"
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := watcher.etcdCli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*sessionutil.Session, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		session := &sessionutil.Session{}
+		// the id allocation key isn't a session
+		if err := json.Unmarshal(kv.Value, session); err != nil {
+			continue
+		}
+		entries[strings.TrimPrefix(string(kv.Key), prefix)] = session
+	}
+	return entries, nil
+}
+
 func (watcher *EtcdMetaWatcher) ShowSegments() ([]*datapb.SegmentInfo, error) {
 	metaBasePath := path.Join(watcher.rootPath, "/meta/datacoord-meta/s/") + "/"
 	return listSegments(watcher.etcdCli, metaBasePath, func(s *datapb.SegmentInfo) bool {
@@ -59,11 +118,657 @@ func (watcher *EtcdMetaWatcher) ShowSegments() ([]*datapb.SegmentInfo, error) {
 	})
 }
 
+// WalkSegments calls fn on each segment in key order, which groups the segments by collection,
+// and stops at the first error of fn. Segments are read page by page instead of all at once like
+// ShowSegments, so they are not of a single revision if the meta changes.
+func (watcher *EtcdMetaWatcher) WalkSegments(ctx context.Context, fn func(*datapb.SegmentInfo) error) error {
+	prefix := path.Join(watcher.rootPath, "/meta/datacoord-meta/s/") + "/"
+	rangeEnd := clientv3.GetPrefixRangeEnd(prefix)
+	startKey := prefix
+	for {
+		resp, err := watcher.etcdCli.Get(ctx, startKey, clientv3.WithRange(rangeEnd), clientv3.WithLimit(metaSnapshotPageSize))
+		if err != nil {
+			return err
+		}
+		for _, kv := range resp.Kvs {
+			info := &datapb.SegmentInfo{}
+			if err := proto.Unmarshal(kv.Value, info); err != nil {
+				continue
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return nil
+		}
+		startKey = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
 func (watcher *EtcdMetaWatcher) ShowReplicas() ([]*querypb.Replica, error) {
 	metaBasePath := path.Join(watcher.rootPath, "/meta/querycoord-replica/")
 	return listReplicas(watcher.etcdCli, metaBasePath)
 }
 
+// ShowCollectionLoadInfos returns the load infos of the collections loaded or being loaded by querycoord.
+func (watcher *EtcdMetaWatcher) ShowCollectionLoadInfos() ([]*querypb.CollectionLoadInfo, error) {
+	metaBasePath := path.Join(watcher.rootPath, "/meta/querycoord-collection-loadinfo/")
+	return listCollectionLoadInfos(watcher.etcdCli, metaBasePath)
+}
+
+// ShowBinlogs returns the insert binlogs of the collection grouped by segment id.
+func (watcher *EtcdMetaWatcher) ShowBinlogs(collectionID int64) (map[int64][]*datapb.FieldBinlog, error) {
+	return watcher.showSegmentFieldBinlogs("binlog", collectionID)
+}
+
+// ShowDeltalogs returns the delta logs of the collection grouped by segment id.
+func (watcher *EtcdMetaWatcher) ShowDeltalogs(collectionID int64) (map[int64][]*datapb.FieldBinlog, error) {
+	return watcher.showSegmentFieldBinlogs("deltalog", collectionID)
+}
+
+// ShowStatslogs returns the stats logs of the collection grouped by segment id.
+func (watcher *EtcdMetaWatcher) ShowStatslogs(collectionID int64) (map[int64][]*datapb.FieldBinlog, error) {
+	return watcher.showSegmentFieldBinlogs("statslog", collectionID)
+}
+
+// showSegmentFieldBinlogs returns the field binlogs of the kind, i.e. binlog, deltalog or statslog,
+// of the collection grouped by segment id.
+func (watcher *EtcdMetaWatcher) showSegmentFieldBinlogs(kind string, collectionID int64) (map[int64][]*datapb.FieldBinlog, error) {
+	prefix := path.Join(watcher.rootPath, "/meta/datacoord-meta", kind, fmt.Sprint(collectionID)) + "/"
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := watcher.etcdCli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	binlogs := make(map[int64][]*datapb.FieldBinlog)
+	for _, kv := range resp.Kvs {
+		// key is ${prefix}${partitionID}/${segmentID}/${fieldID}
+		parts := strings.Split(strings.TrimPrefix(string(kv.Key), prefix), "/")
+		if len(parts) != 3 {
+			continue
+		}
+		segmentID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			log.Warn("failed to parse segment id of "+kind, zap.String("key", string(kv.Key)), zap.Error(err))
+			continue
+		}
+		fieldBinlog := &datapb.FieldBinlog{}
+		if err := proto.Unmarshal(kv.Value, fieldBinlog); err != nil {
+			log.Warn("failed to unmarshal field "+kind, zap.String("key", string(kv.Key)), zap.Error(err))
+			continue
+		}
+		binlogs[segmentID] = append(binlogs[segmentID], fieldBinlog)
+	}
+	return binlogs, nil
+}
+
+// ShowIndexes returns the indexes of the collection which are not dropped.
+func (watcher *EtcdMetaWatcher) ShowIndexes(collectionID int64) ([]*indexpb.FieldIndex, error) {
+	prefix := path.Join(watcher.rootPath, "/meta/field-index", fmt.Sprint(collectionID)) + "/"
+	return listFieldIndexes(watcher.etcdCli, prefix)
+}
+
+// ShowSegmentIndexes returns the segment indexes of the collection which are not dropped.
+func (watcher *EtcdMetaWatcher) ShowSegmentIndexes(collectionID int64) ([]*indexpb.SegmentIndex, error) {
+	prefix := path.Join(watcher.rootPath, "/meta/segment-index", fmt.Sprint(collectionID)) + "/"
+	return listSegmentIndexes(watcher.etcdCli, prefix)
+}
+
+// ShowChannelCheckpoints returns the checkpoint position of each vchannel persisted by datacoord.
+func (watcher *EtcdMetaWatcher) ShowChannelCheckpoints() (map[string]*msgpb.MsgPosition, error) {
+	metaBasePath := path.Join(watcher.rootPath, "/meta/datacoord-meta/channel-cp/") + "/"
+	return listChannelCheckpoints(watcher.etcdCli, metaBasePath)
+}
+
+// ShowCollections returns the collections which are not dropped.
+func (watcher *EtcdMetaWatcher) ShowCollections() ([]*etcdpb.CollectionInfo, error) {
+	// collections of default db are kept under the legacy prefix
+	prefixes := []string{
+		path.Join(watcher.rootPath, "/meta/root-coord/collection") + "/",
+		path.Join(watcher.rootPath, "/meta/root-coord/database/collection-info") + "/",
+	}
+	var collections []*etcdpb.CollectionInfo
+	for _, prefix := range prefixes {
+		infos, err := listCollections(watcher.etcdCli, prefix)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, infos...)
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].GetID() < collections[j].GetID()
+	})
+	return collections, nil
+}
+
+// metaSubsystemPrefixes are the prefixes relative to the meta root of the keys held by each meta subsystem.
+var metaSubsystemPrefixes = map[string][]string{
+	"sessions":        {"session/"},
+	"segments":        {"datacoord-meta/s/"},
+	"replicas":        {"querycoord-replica/"},
+	"indexes":         {"field-index/"},
+	"segment-indexes": {"segment-index/"},
+	// collections of default db are kept under the legacy prefix
+	"collections": {"root-coord/collection/", "root-coord/database/collection-info/"},
+}
+
+// MetaKeyCounts returns the number of keys held by each meta subsystem, e.g. "segments",
+// every subsystem is included even if it holds no key. Only the keys are counted, the values
+// are not read.
+func (watcher *EtcdMetaWatcher) MetaKeyCounts() (map[string]int, error) {
+	counts := make(map[string]int, len(metaSubsystemPrefixes))
+	for subsystem, prefixes := range metaSubsystemPrefixes {
+		for _, prefix := range prefixes {
+			count, err := countKeys(watcher.etcdCli, path.Join(watcher.rootPath, "meta", prefix)+"/")
+			if err != nil {
+				return nil, err
+			}
+			counts[subsystem] += count
+		}
+	}
+	return counts, nil
+}
+
+// collectionMetaCategories are the categories of the meta held for a collection, see ShowCollectionMetaKeys.
+var collectionMetaCategories = []string{
+	"collection",
+	"segments",
+	"channel-watch",
+	"channel-checkpoints",
+	"indexes",
+	"load",
+	"aliases",
+}
+
+// ShowCollectionMetaKeys returns the keys relative to the meta root of the meta held for the collection
+// by category, every category in collectionMetaCategories is included even if it holds no key:
+//   - collection: collection, partition and field meta not marked dropped by rootcoord
+//   - segments: segments in any state, including the dropped ones not garbage collected yet, and their logs
+//   - channel-watch: channel watch infos and channel removal markers of the vchannels
+//   - channel-checkpoints: checkpoints of the vchannels
+//   - indexes: field indexes and segment indexes
+//   - load: collection and partition load infos and replicas
+//   - aliases: aliases of the collection not marked dropped by rootcoord
+func (watcher *EtcdMetaWatcher) ShowCollectionMetaKeys(collectionID int64) (map[string][]string, error) {
+	metaRoot := path.Join(watcher.rootPath, "meta") + "/"
+	id := fmt.Sprint(collectionID)
+	keys := make(map[string][]string, len(collectionMetaCategories))
+	for _, category := range collectionMetaCategories {
+		keys[category] = nil
+	}
+
+	// collect adds the keys under prefix relative to the meta root accepted by filter, tombstones are skipped
+	collect := func(category string, prefix string, filter func(key string, value []byte) bool) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		resp, err := watcher.etcdCli.Get(ctx, metaRoot+prefix, clientv3.WithPrefix())
+		if err != nil {
+			return err
+		}
+		for _, kv := range resp.Kvs {
+			key := strings.TrimPrefix(string(kv.Key), metaRoot)
+			if rootcoord.IsTombstone(string(kv.Value)) || (filter != nil && !filter(key, kv.Value)) {
+				continue
+			}
+			keys[category] = append(keys[category], key)
+		}
+		return nil
+	}
+	ofVChannel := func(key string, _ []byte) bool {
+		return parseCollectionIDFromVChannel(path.Base(key)) == collectionID
+	}
+	ofAlias := func(key string, value []byte) bool {
+		alias := &etcdpb.AliasInfo{}
+		if err := proto.Unmarshal(value, alias); err != nil {
+			log.Warn("failed to unmarshal alias info", zap.String("key", key), zap.Error(err))
+			return false
+		}
+		return alias.GetCollectionId() == collectionID
+	}
+	// the collection id is the last element of the collection meta and load info keys
+	isCollectionKey := func(key string, _ []byte) bool {
+		return path.Base(key) == id
+	}
+
+	for _, c := range []struct {
+		category string
+		prefix   string
+		filter   func(key string, value []byte) bool
+	}{
+		{"collection", rootcoord.CollectionMetaPrefix + "/" + id, isCollectionKey},
+		{"collection", rootcoord.CollectionInfoMetaPrefix + "/", isCollectionKey},
+		{"collection", rootcoord.PartitionMetaPrefix + "/" + id + "/", nil},
+		{"collection", rootcoord.FieldMetaPrefix + "/" + id + "/", nil},
+		{"segments", "datacoord-meta/s/" + id + "/", nil},
+		{"segments", "datacoord-meta/binlog/" + id + "/", nil},
+		{"segments", "datacoord-meta/deltalog/" + id + "/", nil},
+		{"segments", "datacoord-meta/statslog/" + id + "/", nil},
+		{"channel-watch", "channelwatch/", ofVChannel},
+		{"channel-watch", "datacoord-meta/channel-removal/", ofVChannel},
+		{"channel-checkpoints", "datacoord-meta/channel-cp/", ofVChannel},
+		{"indexes", "field-index/" + id + "/", nil},
+		{"indexes", "segment-index/" + id + "/", nil},
+		{"load", "querycoord-collection-loadinfo/" + id, isCollectionKey},
+		{"load", "querycoord-partition-loadinfo/" + id + "/", nil},
+		{"load", "querycoord-replica/" + id + "/", nil},
+		{"aliases", rootcoord.AliasMetaPrefix + "/", ofAlias},
+		{"aliases", rootcoord.DatabaseMetaPrefix + "/" + rootcoord.Aliases + "/", ofAlias},
+	} {
+		if err := collect(c.category, c.prefix, c.filter); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// metaSubsystem is the prefix relative to the meta root of a meta subsystem, and the factory of
+// the message its values are decoded into.
+type metaSubsystem struct {
+	prefix  string
+	factory func() proto.Message
+}
+
+// defaultMetaSubsystems are the meta subsystems decoded by ShowAll unless overridden.
+var defaultMetaSubsystems = map[string]metaSubsystem{
+	"segments":              {"datacoord-meta/s/", func() proto.Message { return &datapb.SegmentInfo{} }},
+	"channel-checkpoints":   {"datacoord-meta/channel-cp/", func() proto.Message { return &msgpb.MsgPosition{} }},
+	"replicas":              {"querycoord-replica/", func() proto.Message { return &querypb.Replica{} }},
+	"collection-load-infos": {"querycoord-collection-loadinfo/", func() proto.Message { return &querypb.CollectionLoadInfo{} }},
+	"indexes":               {"field-index/", func() proto.Message { return &indexpb.FieldIndex{} }},
+	"segment-indexes":       {"segment-index/", func() proto.Message { return &indexpb.SegmentIndex{} }},
+	"collections":           {"root-coord/collection/", func() proto.Message { return &etcdpb.CollectionInfo{} }},
+	"database-collections":  {"root-coord/database/collection-info/", func() proto.Message { return &etcdpb.CollectionInfo{} }},
+}
+
+// RegisterSubsystem registers the meta subsystem decoded by ShowAll, the values of the keys under
+// prefix relative to the meta root, e.g. "datacoord-meta/s/", are decoded into the messages
+// created by factory. A subsystem registered with the same name is replaced.
+func (watcher *EtcdMetaWatcher) RegisterSubsystem(name string, prefix string, factory func() proto.Message) {
+	watcher.subsystemsMu.Lock()
+	defer watcher.subsystemsMu.Unlock()
+	if watcher.subsystems == nil {
+		watcher.subsystems = make(map[string]metaSubsystem, len(defaultMetaSubsystems)+1)
+		for name, subsystem := range defaultMetaSubsystems {
+			watcher.subsystems[name] = subsystem
+		}
+	}
+	watcher.subsystems[name] = metaSubsystem{prefix: prefix, factory: factory}
+}
+
+// ShowAll decodes the values of every registered meta subsystem, keyed by the subsystem name,
+// the messages of a subsystem are in key order. Values failing to decode are skipped with a warning.
+func (watcher *EtcdMetaWatcher) ShowAll() (map[string][]proto.Message, error) {
+	watcher.subsystemsMu.Lock()
+	subsystems := watcher.subsystems
+	if subsystems == nil {
+		subsystems = defaultMetaSubsystems
+	}
+	watcher.subsystemsMu.Unlock()
+
+	result := make(map[string][]proto.Message, len(subsystems))
+	for name, subsystem := range subsystems {
+		prefix := path.Join(watcher.rootPath, "meta", subsystem.prefix) + "/"
+		messages, err := listMessages(watcher.etcdCli, prefix, subsystem.factory)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = messages
+	}
+	return result, nil
+}
+
+// ChannelRemovalState is the removal progress of a channel, as seen from datacoord meta.
+type ChannelRemovalState struct {
+	Channel      string
+	CollectionID int64
+	// HasMarker is true if a channel removal marker exists, Removed is the marker value.
+	HasMarker bool
+	Removed   bool
+	// Watchers are the nodes which still have the channel in their watch info.
+	Watchers []int64
+	// CollectionExists is false if the collection of the channel is dropped.
+	CollectionExists bool
+}
+
+// FullyRemoved returns whether the channel is marked removed and released by all nodes.
+// Note that the marker itself is cleaned up at last, after which the channel is no longer listed.
+func (state *ChannelRemovalState) FullyRemoved() bool {
+	return state.Removed && len(state.Watchers) == 0
+}
+
+// Inconsistency describes why the state is inconsistent, empty if it is not.
+func (state *ChannelRemovalState) Inconsistency() string {
+	switch {
+	case state.Removed && len(state.Watchers) > 0:
+		return fmt.Sprintf("channel %s is marked removed but still watched by %v", state.Channel, state.Watchers)
+	case !state.CollectionExists && len(state.Watchers) > 0:
+		return fmt.Sprintf("channel %s is watched by %v but collection %d does not exist", state.Channel, state.Watchers, state.CollectionID)
+	default:
+		return ""
+	}
+}
+
+// ShowChannelRemovalState lists the channel removal markers together with the channel watch infos.
+func (watcher *EtcdMetaWatcher) ShowChannelRemovalState() ([]*ChannelRemovalState, error) {
+	collections, err := watcher.ShowCollections()
+	if err != nil {
+		return nil, err
+	}
+	collectionExists := make(map[int64]bool)
+	for _, collection := range collections {
+		collectionExists[collection.GetID()] = collection.GetState() == etcdpb.CollectionState_CollectionCreated
+	}
+
+	states := make(map[string]*ChannelRemovalState)
+	getState := func(channel string) *ChannelRemovalState {
+		state, ok := states[channel]
+		if !ok {
+			state = &ChannelRemovalState{Channel: channel, CollectionID: parseCollectionIDFromVChannel(channel)}
+			states[channel] = state
+		}
+		return state
+	}
+
+	removalPrefix := path.Join(watcher.rootPath, "/meta/datacoord-meta/channel-removal") + "/"
+	markers, err := listValues(watcher.etcdCli, removalPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range markers {
+		state := getState(strings.TrimPrefix(key, removalPrefix))
+		state.HasMarker = true
+		state.Removed = value == "removed"
+	}
+
+	watchInfos, err := listChannelWatchInfos(watcher.etcdCli, path.Join(watcher.rootPath, "/meta/channelwatch")+"/")
+	if err != nil {
+		return nil, err
+	}
+	for nodeID, infos := range watchInfos {
+		for _, info := range infos {
+			state := getState(info.GetVchan().GetChannelName())
+			state.CollectionID = info.GetVchan().GetCollectionID()
+			state.Watchers = append(state.Watchers, nodeID)
+		}
+	}
+
+	result := make([]*ChannelRemovalState, 0, len(states))
+	for _, state := range states {
+		state.CollectionExists = collectionExists[state.CollectionID]
+		sort.Slice(state.Watchers, func(i, j int) bool { return state.Watchers[i] < state.Watchers[j] })
+		result = append(result, state)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Channel < result[j].Channel })
+	return result, nil
+}
+
+// SegmentStats is a flat view of the statistics persisted for a segment.
+type SegmentStats struct {
+	SegmentID    int64
+	CollectionID int64
+	PartitionID  int64
+	Channel      string
+	State        commonpb.SegmentState
+	NumOfRows    int64
+	// MinPk and MaxPk are decoded from the primary key stats logs,
+	// they are nil if the watcher has no chunk manager or the segment has no stats log.
+	MinPk storage.PrimaryKey
+	MaxPk storage.PrimaryKey
+	// StatsLogs are the paths of the stats logs in object storage.
+	StatsLogs []string
+}
+
+// SegmentStatistics returns the statistics of the segment with given id.
+func (watcher *EtcdMetaWatcher) SegmentStatistics(segmentID int64) (SegmentStats, error) {
+	segments, err := watcher.ShowSegments()
+	if err != nil {
+		return SegmentStats{}, err
+	}
+	var segment *datapb.SegmentInfo
+	for _, s := range segments {
+		if s.GetID() == segmentID {
+			segment = s
+			break
+		}
+	}
+	if segment == nil {
+		return SegmentStats{}, merr.WrapErrSegmentNotFound(segmentID)
+	}
+
+	stats := SegmentStats{
+		SegmentID:    segment.GetID(),
+		CollectionID: segment.GetCollectionID(),
+		PartitionID:  segment.GetPartitionID(),
+		Channel:      segment.GetInsertChannel(),
+		State:        segment.GetState(),
+		NumOfRows:    segment.GetNumOfRows(),
+	}
+
+	statslogPrefix := path.Join(watcher.rootPath, "/meta/datacoord-meta/statslog",
+		fmt.Sprint(segment.GetCollectionID()), fmt.Sprint(segment.GetPartitionID()), fmt.Sprint(segment.GetID())) + "/"
+	fieldBinlogs, err := listFieldBinlogs(watcher.etcdCli, statslogPrefix)
+	if err != nil {
+		return SegmentStats{}, err
+	}
+	// segments saved in legacy format keep stats logs inline
+	fieldBinlogs = append(fieldBinlogs, segment.GetStatslogs()...)
+
+	rootPath := ""
+	if watcher.chunkManager != nil {
+		rootPath = watcher.chunkManager.RootPath()
+	}
+	for _, fieldBinlog := range fieldBinlogs {
+		for _, binlog := range fieldBinlog.GetBinlogs() {
+			logPath := binlog.GetLogPath()
+			if logPath == "" {
+				logPath = metautil.BuildStatsLogPath(rootPath, segment.GetCollectionID(), segment.GetPartitionID(),
+					segment.GetID(), fieldBinlog.GetFieldID(), binlog.GetLogID())
+			}
+			stats.StatsLogs = append(stats.StatsLogs, logPath)
+		}
+	}
+
+	if watcher.chunkManager != nil && len(stats.StatsLogs) > 0 {
+		pkStats, err := readPrimaryKeyStats(watcher.chunkManager, stats.StatsLogs)
+		if err != nil {
+			return SegmentStats{}, err
+		}
+		for _, pkStat := range pkStats {
+			if pkStat.MinPk != nil && (stats.MinPk == nil || pkStat.MinPk.LT(stats.MinPk)) {
+				stats.MinPk = pkStat.MinPk
+			}
+			if pkStat.MaxPk != nil && (stats.MaxPk == nil || pkStat.MaxPk.GT(stats.MaxPk)) {
+				stats.MaxPk = pkStat.MaxPk
+			}
+		}
+	}
+	return stats, nil
+}
+
+// SegmentTimeline describes the life of a segment: its state, the compaction it was created by
+// and compacted into, its index builds and the replicas of its collection.
+func (watcher *EtcdMetaWatcher) SegmentTimeline(segmentID int64) (string, error) {
+	segments, err := watcher.ShowSegments()
+	if err != nil {
+		return "", err
+	}
+	var segment *datapb.SegmentInfo
+	var compactedTo []int64
+	for _, s := range segments {
+		if s.GetID() == segmentID {
+			segment = s
+		}
+		if lo.Contains(s.GetCompactionFrom(), segmentID) {
+			compactedTo = append(compactedTo, s.GetID())
+		}
+	}
+	if segment == nil {
+		return "", merr.WrapErrSegmentNotFound(segmentID)
+	}
+	sort.Slice(compactedTo, func(i, j int) bool { return compactedTo[i] < compactedTo[j] })
+
+	res := fmt.Sprintf("Segment %d, collection %d, partition %d, channel %s\n",
+		segment.GetID(), segment.GetCollectionID(), segment.GetPartitionID(), segment.GetInsertChannel())
+
+	// creation
+	if segment.GetCreatedByCompaction() {
+		res = res + fmt.Sprintf("Created: by compaction from segments %v\n", segment.GetCompactionFrom())
+	} else {
+		res = res + "Created: by insert\n"
+	}
+	if position := segment.GetStartPosition(); position != nil {
+		res = res + fmt.Sprintf("  start position: %s\n", prettyPosition(position))
+	}
+
+	// state
+	res = res + fmt.Sprintf("State: %s, rows: %d\n", segment.GetState().String(), segment.GetNumOfRows())
+	if position := segment.GetDmlPosition(); position != nil {
+		res = res + fmt.Sprintf("  dml position: %s\n", prettyPosition(position))
+	}
+
+	// compaction
+	if len(compactedTo) > 0 {
+		res = res + fmt.Sprintf("Compacted: into segments %v\n", compactedTo)
+	} else {
+		res = res + "Compacted: no\n"
+	}
+	if segment.GetDroppedAt() > 0 {
+		res = res + fmt.Sprintf("Dropped: at %s\n", time.Unix(0, int64(segment.GetDroppedAt())).Format(time.RFC3339))
+	}
+
+	// index
+	fieldIndexes, err := watcher.ShowIndexes(segment.GetCollectionID())
+	if err != nil {
+		return "", err
+	}
+	indexNames := make(map[int64]string)
+	for _, fieldIndex := range fieldIndexes {
+		indexNames[fieldIndex.GetIndexInfo().GetIndexID()] = fieldIndex.GetIndexInfo().GetIndexName()
+	}
+	segmentIndexes, err := watcher.ShowSegmentIndexes(segment.GetCollectionID())
+	if err != nil {
+		return "", err
+	}
+	segmentIndexes = lo.Filter(segmentIndexes, func(segmentIndex *indexpb.SegmentIndex, _ int) bool {
+		return segmentIndex.GetSegmentID() == segmentID
+	})
+	if len(segmentIndexes) == 0 {
+		res = res + "Index: not built\n"
+	} else {
+		res = res + "Index:\n"
+	}
+	for _, segmentIndex := range segmentIndexes {
+		res = res + fmt.Sprintf("  %s(%d) build %d: %s on node %d", indexNames[segmentIndex.GetIndexID()],
+			segmentIndex.GetIndexID(), segmentIndex.GetBuildID(), segmentIndex.GetState().String(), segmentIndex.GetNodeID())
+		if segmentIndex.GetFailReason() != "" {
+			res = res + ", reason: " + segmentIndex.GetFailReason()
+		}
+		res = res + "\n"
+	}
+
+	// load, the segment distribution is not persisted, so only the replicas are shown
+	replicas, err := watcher.ShowReplicas()
+	if err != nil {
+		return "", err
+	}
+	replicas = lo.Filter(replicas, func(replica *querypb.Replica, _ int) bool {
+		return replica.GetCollectionID() == segment.GetCollectionID()
+	})
+	if len(replicas) == 0 {
+		res = res + "Load: collection not loaded\n"
+	} else {
+		res = res + "Load: collection loaded by replicas\n"
+	}
+	for _, replica := range replicas {
+		res = res + fmt.Sprintf("  replica %d on nodes %v\n", replica.GetID(), replica.GetNodes())
+	}
+	return res, nil
+}
+
+// SegmentTransition is a state change of a segment observed by RecordSegmentTransitions.
+type SegmentTransition struct {
+	SegmentID int64
+	From      commonpb.SegmentState
+	To        commonpb.SegmentState
+	// Time is when the change is observed, Revision is the etcd revision of the change
+	Time     time.Time
+	Revision int64
+}
+
+func (transition SegmentTransition) String() string {
+	return fmt.Sprintf("segment %d: %s -> %s", transition.SegmentID, transition.From, transition.To)
+}
+
+// RecordSegmentTransitions watches the segment meta of the collection until ctx is done,
+// and returns the state transitions in the order they are committed. A segment created
+// during the window starts from SegmentStateNone, a segment removed ends with NotExist.
+// Updates not changing the state are ignored.
+func (watcher *EtcdMetaWatcher) RecordSegmentTransitions(ctx context.Context, collectionID int64) ([]SegmentTransition, error) {
+	prefix := path.Join(watcher.rootPath, "/meta/datacoord-meta/s", fmt.Sprint(collectionID)) + "/"
+	getCtx, cancel := context.WithTimeout(ctx, time.Second*3)
+	resp, err := watcher.etcdCli.Get(getCtx, prefix, clientv3.WithPrefix())
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]commonpb.SegmentState)
+	for _, kv := range resp.Kvs {
+		info := &datapb.SegmentInfo{}
+		if err := proto.Unmarshal(kv.Value, info); err != nil {
+			continue
+		}
+		states[string(kv.Key)] = info.GetState()
+	}
+
+	var transitions []SegmentTransition
+	watchCh := watcher.etcdCli.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.GetRevision()+1))
+	for watchResp := range watchCh {
+		if err := watchResp.Err(); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return transitions, err
+		}
+		for _, event := range watchResp.Events {
+			key := string(event.Kv.Key)
+			segmentID, err := strconv.ParseInt(path.Base(key), 10, 64)
+			if err != nil {
+				log.Warn("failed to parse segment id", zap.String("key", key), zap.Error(err))
+				continue
+			}
+			from := states[key]
+			to := commonpb.SegmentState_NotExist
+			if event.Type == clientv3.EventTypePut {
+				info := &datapb.SegmentInfo{}
+				if err := proto.Unmarshal(event.Kv.Value, info); err != nil {
+					log.Warn("failed to unmarshal segment info", zap.String("key", key), zap.Error(err))
+					continue
+				}
+				to = info.GetState()
+				states[key] = to
+			} else {
+				delete(states, key)
+			}
+			if from != to {
+				transitions = append(transitions, SegmentTransition{
+					SegmentID: segmentID,
+					From:      from,
+					To:        to,
+					Time:      time.Now(),
+					Revision:  event.Kv.ModRevision,
+				})
+			}
+		}
+	}
+	return transitions, nil
+}
+
+func prettyPosition(position *msgpb.MsgPosition) string {
+	return fmt.Sprintf("%s@%s", position.GetChannelName(), tsoutil.PhysicalTime(position.GetTimestamp()).Format(time.RFC3339))
+}
+
 //=================== Below largely copied from birdwatcher ========================
 
 // listSessions returns all session
@@ -113,6 +818,223 @@ func listSegments(cli *clientv3.Client, prefix string, filter func(*datapb.Segme
 	return segments, nil
 }
 
+// parseCollectionIDFromVChannel parses collection id from vchannel name like ${pchannel}_${collectionID}v${idx},
+// returns 0 if the name is not in the format.
+func parseCollectionIDFromVChannel(vchannel string) int64 {
+	suffix := vchannel[strings.LastIndex(vchannel, "_")+1:]
+	idx := strings.LastIndex(suffix, "v")
+	if idx < 0 {
+		return 0
+	}
+	collectionID, err := strconv.ParseInt(suffix[:idx], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return collectionID
+}
+
+func listValues(cli *clientv3.Client, prefix string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		values[string(kv.Key)] = string(kv.Value)
+	}
+	return values, nil
+}
+
+func listMessages(cli *clientv3.Client, prefix string, factory func() proto.Message) ([]proto.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]proto.Message, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		message := factory()
+		if err := proto.Unmarshal(kv.Value, message); err != nil {
+			log.Warn("failed to unmarshal meta", zap.String("key", string(kv.Key)), zap.Error(err))
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func countKeys(cli *clientv3.Client, prefix string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.Count), nil
+}
+
+func listCollections(cli *clientv3.Client, prefix string) ([]*etcdpb.CollectionInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	collections := make([]*etcdpb.CollectionInfo, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if rootcoord.IsTombstone(string(kv.Value)) {
+			continue
+		}
+		collection := &etcdpb.CollectionInfo{}
+		if err := proto.Unmarshal(kv.Value, collection); err != nil {
+			log.Warn("failed to unmarshal collection info", zap.String("key", string(kv.Key)), zap.Error(err))
+			continue
+		}
+		collections = append(collections, collection)
+	}
+	return collections, nil
+}
+
+// listChannelWatchInfos returns channel watch infos grouped by node id.
+func listChannelWatchInfos(cli *clientv3.Client, prefix string) (map[int64][]*datapb.ChannelWatchInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[int64][]*datapb.ChannelWatchInfo)
+	for _, kv := range resp.Kvs {
+		// key is ${prefix}${nodeID}/${channel}
+		nodeID, err := strconv.ParseInt(strings.SplitN(strings.TrimPrefix(string(kv.Key), prefix), "/", 2)[0], 10, 64)
+		if err != nil {
+			log.Warn("failed to parse node id of channel watch info", zap.String("key", string(kv.Key)), zap.Error(err))
+			continue
+		}
+		info := &datapb.ChannelWatchInfo{}
+		if err := proto.Unmarshal(kv.Value, info); err != nil {
+			log.Warn("failed to unmarshal channel watch info", zap.String("key", string(kv.Key)), zap.Error(err))
+			continue
+		}
+		infos[nodeID] = append(infos[nodeID], info)
+	}
+	return infos, nil
+}
+
+func listFieldBinlogs(cli *clientv3.Client, prefix string) ([]*datapb.FieldBinlog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	fieldBinlogs := make([]*datapb.FieldBinlog, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		fieldBinlog := &datapb.FieldBinlog{}
+		if err := proto.Unmarshal(kv.Value, fieldBinlog); err != nil {
+			log.Warn("failed to unmarshal field binlog", zap.String("key", string(kv.Key)), zap.Error(err))
+			continue
+		}
+		fieldBinlogs = append(fieldBinlogs, fieldBinlog)
+	}
+	return fieldBinlogs, nil
+}
+
+// readPrimaryKeyStats reads the primary key stats from stats logs,
+// the compound stats log takes precedence over the others if exists.
+func readPrimaryKeyStats(cm storage.ChunkManager, statsLogs []string) ([]*storage.PrimaryKeyStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	for _, statsLog := range statsLogs {
+		if path.Base(statsLog) == storage.CompoundStatsType.LogIdx() {
+			value, err := cm.Read(ctx, statsLog)
+			if err != nil {
+				return nil, err
+			}
+			return storage.DeserializeStatsList(&storage.Blob{Value: value})
+		}
+	}
+	values, err := cm.MultiRead(ctx, statsLogs)
+	if err != nil {
+		return nil, err
+	}
+	blobs := make([]*storage.Blob, 0, len(values))
+	for _, value := range values {
+		blobs = append(blobs, &storage.Blob{Value: value})
+	}
+	return storage.DeserializeStats(blobs)
+}
+
+func listFieldIndexes(cli *clientv3.Client, prefix string) ([]*indexpb.FieldIndex, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make([]*indexpb.FieldIndex, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		index := &indexpb.FieldIndex{}
+		if err := proto.Unmarshal(kv.Value, index); err != nil {
+			log.Warn("failed to unmarshal field index", zap.String("key", string(kv.Key)), zap.Error(err))
+			continue
+		}
+		if index.GetDeleted() {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+func listSegmentIndexes(cli *clientv3.Client, prefix string) ([]*indexpb.SegmentIndex, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	segmentIndexes := make([]*indexpb.SegmentIndex, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		segmentIndex := &indexpb.SegmentIndex{}
+		if err := proto.Unmarshal(kv.Value, segmentIndex); err != nil {
+			log.Warn("failed to unmarshal segment index", zap.String("key", string(kv.Key)), zap.Error(err))
+			continue
+		}
+		if segmentIndex.GetDeleted() {
+			continue
+		}
+		segmentIndexes = append(segmentIndexes, segmentIndex)
+	}
+	return segmentIndexes, nil
+}
+
+func listChannelCheckpoints(cli *clientv3.Client, prefix string) (map[string]*msgpb.MsgPosition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := make(map[string]*msgpb.MsgPosition, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		position := &msgpb.MsgPosition{}
+		if err := proto.Unmarshal(kv.Value, position); err != nil {
+			log.Warn("failed to unmarshal channel checkpoint", zap.String("key", string(kv.Key)), zap.Error(err))
+			continue
+		}
+		checkpoints[path.Base(string(kv.Key))] = position
+	}
+	return checkpoints, nil
+}
+
 func listReplicas(cli *clientv3.Client, prefix string) ([]*querypb.Replica, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
@@ -134,8 +1056,48 @@ func listReplicas(cli *clientv3.Client, prefix string) ([]*querypb.Replica, erro
 	return replicas, nil
 }
 
+func listCollectionLoadInfos(cli *clientv3.Client, prefix string) ([]*querypb.CollectionLoadInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*querypb.CollectionLoadInfo, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		info := &querypb.CollectionLoadInfo{}
+		if err := proto.Unmarshal(kv.Value, info); err != nil {
+			log.Warn("failed to unmarshal collection load info", zap.Error(err))
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
 func PrettyReplica(replica *querypb.Replica) string {
 	res := fmt.Sprintf("ReplicaID: %d CollectionID: %d\n", replica.ID, replica.CollectionID)
 	res = res + fmt.Sprintf("Nodes:%v\n", replica.Nodes)
 	return res
 }
+
+// PrettyCollectionMeta renders the segment level summary and index build progress of the collection.
+func PrettyCollectionMeta(watcher MetaWatcher, collectionID int64) (string, error) {
+	summary, err := GetSegmentLevelSummary(watcher, collectionID)
+	if err != nil {
+		return "", err
+	}
+	progresses, err := GetIndexBuildProgress(watcher, collectionID)
+	if err != nil {
+		return "", err
+	}
+	res := fmt.Sprintf("CollectionID: %d\n", collectionID)
+	res = res + "Segments:\n" + summary.String()
+	res = res + "Indexes:\n"
+	for _, progress := range progresses {
+		res = res + progress.String() + "\n"
+	}
+	return res, nil
+}
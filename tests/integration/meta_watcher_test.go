@@ -18,20 +18,29 @@ package integration
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/suite"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/zap"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
 	"github.com/milvus-io/milvus-proto/go-api/v2/milvuspb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/msgpb"
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/proto/datapb"
+	"github.com/milvus-io/milvus/internal/proto/indexpb"
+	"github.com/milvus-io/milvus/internal/proto/querypb"
+	"github.com/milvus-io/milvus/internal/storage"
 	"github.com/milvus-io/milvus/pkg/common"
 	"github.com/milvus-io/milvus/pkg/log"
 	"github.com/milvus-io/milvus/pkg/util/funcutil"
+	"github.com/milvus-io/milvus/pkg/util/merr"
+	"github.com/milvus-io/milvus/pkg/util/metautil"
 	"github.com/milvus-io/milvus/pkg/util/metric"
 )
 
@@ -305,7 +314,623 @@ func (s *MetaWatcherSuite) TestShowReplicas() {
 	log.Info("TestShowReplicas succeed")
 }
 
+func (s *MetaWatcherMethodsSuite) TestSegmentStatistics() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	var (
+		collectionID int64 = 1000
+		partitionID  int64 = 1001
+		segmentID    int64 = 1002
+		pkFieldID    int64 = 100
+		logID        int64 = 1003
+	)
+	metaRoot := GetMetaRootPath(c.params[EtcdRootPath])
+
+	segment := &datapb.SegmentInfo{
+		ID:            segmentID,
+		CollectionID:  collectionID,
+		PartitionID:   partitionID,
+		InsertChannel: "by-dev-rootcoord-dml_0_1000v0",
+		NumOfRows:     3,
+		State:         commonpb.SegmentState_Flushed,
+	}
+	segmentBytes, err := proto.Marshal(segment)
+	s.Require().NoError(err)
+	_, err = c.EtcdCli.Put(ctx, fmt.Sprintf("%s/datacoord-meta/s/%d/%d/%d", metaRoot, collectionID, partitionID, segmentID), string(segmentBytes))
+	s.Require().NoError(err)
+
+	statslog := &datapb.FieldBinlog{
+		FieldID: pkFieldID,
+		Binlogs: []*datapb.Binlog{{EntriesNum: 3, LogID: logID}},
+	}
+	statslogBytes, err := proto.Marshal(statslog)
+	s.Require().NoError(err)
+	_, err = c.EtcdCli.Put(ctx, fmt.Sprintf("%s/datacoord-meta/statslog/%d/%d/%d/%d", metaRoot, collectionID, partitionID, segmentID, pkFieldID), string(statslogBytes))
+	s.Require().NoError(err)
+
+	pkStats := storage.NewPrimaryKeyStats(pkFieldID, int64(schemapb.DataType_Int64), 3)
+	for _, pk := range []int64{7, 3, 11} {
+		pkStats.Update(storage.NewInt64PrimaryKey(pk))
+	}
+	sw := &storage.StatsWriter{}
+	s.Require().NoError(sw.Generate(pkStats))
+	statslogPath := metautil.BuildStatsLogPath(c.ChunkManager.RootPath(), collectionID, partitionID, segmentID, pkFieldID, logID)
+	s.Require().NoError(c.ChunkManager.Write(ctx, statslogPath, sw.GetBuffer()))
+
+	stats, err := c.MetaWatcher.SegmentStatistics(segmentID)
+	s.Require().NoError(err)
+	s.Equal(collectionID, stats.CollectionID)
+	s.Equal(partitionID, stats.PartitionID)
+	s.Equal(int64(3), stats.NumOfRows)
+	s.Equal(commonpb.SegmentState_Flushed, stats.State)
+	s.Equal([]string{statslogPath}, stats.StatsLogs)
+	s.Equal(storage.NewInt64PrimaryKey(3), stats.MinPk)
+	s.Equal(storage.NewInt64PrimaryKey(11), stats.MaxPk)
+
+	_, err = c.MetaWatcher.SegmentStatistics(segmentID + 1)
+	s.ErrorIs(err, merr.ErrSegmentNotFound)
+}
+
+// prepareFlushedCollection creates a collection with flushed data, returns the collection id and vchannels.
+func (s *MiniClusterSuite) prepareFlushedCollection(ctx context.Context, collectionName string, rowNum int) (int64, []string) {
+	c := s.Cluster
+	const dim = 128
+
+	schema := ConstructSchema(collectionName, dim, true)
+	marshaledSchema, err := proto.Marshal(schema)
+	s.Require().NoError(err)
+	createCollectionStatus, err := c.Proxy.CreateCollection(ctx, &milvuspb.CreateCollectionRequest{
+		CollectionName: collectionName,
+		Schema:         marshaledSchema,
+		ShardsNum:      common.DefaultShardsNum,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, createCollectionStatus.GetErrorCode())
+
+	insertResult, err := c.Proxy.Insert(ctx, &milvuspb.InsertRequest{
+		CollectionName: collectionName,
+		FieldsData:     []*schemapb.FieldData{NewFloatVectorFieldData(FloatVecField, rowNum, dim)},
+		HashKeys:       GenerateHashKeys(rowNum),
+		NumRows:        uint32(rowNum),
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, insertResult.GetStatus().GetErrorCode())
+
+	flushResp, err := c.Proxy.Flush(ctx, &milvuspb.FlushRequest{
+		CollectionNames: []string{collectionName},
+	})
+	s.Require().NoError(err)
+	segmentIDs, has := flushResp.GetCollSegIDs()[collectionName]
+	s.Require().True(has)
+	flushTs, has := flushResp.GetCollFlushTs()[collectionName]
+	s.Require().True(has)
+	s.WaitForFlush(ctx, segmentIDs.GetData(), flushTs, "", collectionName)
+
+	describeResp, err := c.Proxy.DescribeCollection(ctx, &milvuspb.DescribeCollectionRequest{
+		CollectionName: collectionName,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, describeResp.GetStatus().GetErrorCode())
+	return describeResp.GetCollectionID(), describeResp.GetVirtualChannelNames()
+}
+
+func (s *MetaWatcherMethodsSuite) TestShowChannelRemovalState() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	collectionName := "TestShowChannelRemovalState" + funcutil.GenRandomStr()
+	collectionID, vchannels := s.prepareFlushedCollection(ctx, collectionName, 3000)
+
+	states, err := c.MetaWatcher.ShowChannelRemovalState()
+	s.Require().NoError(err)
+	for _, state := range states {
+		s.Empty(state.Inconsistency())
+	}
+
+	status, err := c.Proxy.DropCollection(ctx, &milvuspb.DropCollectionRequest{
+		CollectionName: collectionName,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, status.GetErrorCode())
+
+	s.Eventually(func() bool {
+		states, err := c.MetaWatcher.ShowChannelRemovalState()
+		s.Require().NoError(err)
+		// channel disappears from the listing once its removal marker is cleaned up
+		for _, state := range states {
+			if state.CollectionID != collectionID {
+				continue
+			}
+			s.False(state.CollectionExists)
+			s.Contains(vchannels, state.Channel)
+			if !state.FullyRemoved() {
+				return false
+			}
+		}
+		return true
+	}, 30*time.Second, 500*time.Millisecond)
+
+	states, err = c.MetaWatcher.ShowChannelRemovalState()
+	s.Require().NoError(err)
+	for _, state := range states {
+		s.Empty(state.Inconsistency())
+	}
+	s.NoError(CheckChannelRemoval(0)(c.MetaWatcher))
+}
+
+func (s *MetaWatcherMethodsSuite) TestWaitForSegmentsReleased() {
+	c := s.Cluster
+	ctx, cancel := context.WithTimeout(c.GetContext(), 120*time.Second)
+	defer cancel()
+
+	const dim = 128
+	collectionName := "TestWaitForSegmentsReleased" + funcutil.GenRandomStr()
+	collectionID, _ := s.prepareFlushedCollection(ctx, collectionName, 3000)
+
+	createIndexStatus, err := c.Proxy.CreateIndex(ctx, &milvuspb.CreateIndexRequest{
+		CollectionName: collectionName,
+		FieldName:      FloatVecField,
+		IndexName:      "_default",
+		ExtraParams:    ConstructIndexParam(dim, IndexFaissIvfFlat, metric.L2),
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, createIndexStatus.GetErrorCode())
+	s.WaitForIndexBuilt(ctx, collectionName, FloatVecField)
+
+	loadStatus, err := c.Proxy.LoadCollection(ctx, &milvuspb.LoadCollectionRequest{
+		CollectionName: collectionName,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, loadStatus.GetErrorCode())
+	s.WaitForLoad(ctx, collectionName)
+
+	lingering, err := showLingering(ctx, c, collectionID)
+	s.Require().NoError(err)
+	s.Contains(lingering, "load info: status Loaded")
+
+	releaseStatus, err := c.Proxy.ReleaseCollection(ctx, &milvuspb.ReleaseCollectionRequest{
+		CollectionName: collectionName,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, releaseStatus.GetErrorCode())
+	s.NoError(WaitForSegmentsReleased(ctx, c, collectionID))
+
+	dists, err := c.ShowQueryCoordDist(ctx)
+	s.Require().NoError(err)
+	for _, dist := range dists {
+		for _, segment := range dist.GetSegments() {
+			s.NotEqual(collectionID, segment.GetCollection())
+		}
+	}
+}
+
+func (s *MetaWatcherMethodsSuite) TestSegmentLevelSummary() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	const rowNum = 3000
+	collectionName := "TestSegmentLevelSummary" + funcutil.GenRandomStr()
+	collectionID, vchannels := s.prepareFlushedCollection(ctx, collectionName, rowNum)
+
+	deleteResult, err := c.Proxy.Delete(ctx, &milvuspb.DeleteRequest{
+		CollectionName: collectionName,
+		Expr:           fmt.Sprintf("%s >= 0", Int64Field),
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, deleteResult.GetStatus().GetErrorCode())
+
+	flushResp, err := c.Proxy.Flush(ctx, &milvuspb.FlushRequest{
+		CollectionNames: []string{collectionName},
+	})
+	s.Require().NoError(err)
+	s.WaitForFlush(ctx, flushResp.GetCollSegIDs()[collectionName].GetData(),
+		flushResp.GetCollFlushTs()[collectionName], "", collectionName)
+
+	summary, err := GetSegmentLevelSummary(c.MetaWatcher, collectionID)
+	s.Require().NoError(err)
+	log.Info("segment level summary\n" + summary.String())
+
+	// segments carry no level in meta, so the delete data stays in L1 segments
+	s.Equal(0, summary.Count(SegmentLevelL0))
+	s.Equal(0, summary.Count(SegmentLevelL2))
+	s.NotZero(summary.Count(SegmentLevelL1))
+	var rows int64
+	for channel, levels := range summary {
+		s.Contains(vchannels, channel)
+		s.Len(levels, 1)
+		s.NotZero(levels[SegmentLevelL1].Bytes)
+		rows += levels[SegmentLevelL1].Rows
+	}
+	s.EqualValues(rowNum, rows)
+}
+
+func (s *MetaWatcherMethodsSuite) TestIndexBuildProgress() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	const dim = 128
+	collectionName := "TestIndexBuildProgress" + funcutil.GenRandomStr()
+	collectionID, _ := s.prepareFlushedCollection(ctx, collectionName, 3000)
+
+	progresses, err := GetIndexBuildProgress(c.MetaWatcher, collectionID)
+	s.Require().NoError(err)
+	s.Empty(progresses)
+
+	createIndexStatus, err := c.Proxy.CreateIndex(ctx, &milvuspb.CreateIndexRequest{
+		CollectionName: collectionName,
+		FieldName:      FloatVecField,
+		IndexName:      "_default",
+		ExtraParams:    ConstructIndexParam(dim, IndexFaissIvfFlat, metric.L2),
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, createIndexStatus.GetErrorCode())
+
+	last := float64(0)
+	s.Eventually(func() bool {
+		progresses, err := GetIndexBuildProgress(c.MetaWatcher, collectionID)
+		s.Require().NoError(err)
+		if len(progresses) == 0 {
+			return false
+		}
+		s.Len(progresses, 1)
+		progress := progresses[0]
+		s.Equal("_default", progress.IndexName)
+		s.Zero(progress.Failed)
+		s.EqualValues(3000, progress.TotalRows)
+		s.GreaterOrEqual(progress.Progress(), last)
+		last = progress.Progress()
+		return progress.Progress() == 1 && progress.InProgress == 0 && progress.Unindexed == 0
+	}, 60*time.Second, 200*time.Millisecond)
+
+	pretty, err := PrettyCollectionMeta(c.MetaWatcher, collectionID)
+	s.NoError(err)
+	log.Info("collection meta\n" + pretty)
+
+	// seed a failed build of a fake collection
+	var (
+		fakeCollectionID int64 = 2000
+		fakePartitionID  int64 = 2001
+		fakeSegmentID    int64 = 2002
+		fakeIndexID      int64 = 2003
+		fakeBuildID      int64 = 2004
+	)
+	metaRoot := GetMetaRootPath(c.params[EtcdRootPath])
+	segmentBytes, err := proto.Marshal(&datapb.SegmentInfo{
+		ID:            fakeSegmentID,
+		CollectionID:  fakeCollectionID,
+		PartitionID:   fakePartitionID,
+		InsertChannel: "by-dev-rootcoord-dml_0_2000v0",
+		NumOfRows:     10,
+		State:         commonpb.SegmentState_Flushed,
+	})
+	s.Require().NoError(err)
+	_, err = c.EtcdCli.Put(ctx, fmt.Sprintf("%s/datacoord-meta/s/%d/%d/%d", metaRoot, fakeCollectionID, fakePartitionID, fakeSegmentID), string(segmentBytes))
+	s.Require().NoError(err)
+	indexBytes, err := proto.Marshal(&indexpb.FieldIndex{
+		IndexInfo: &indexpb.IndexInfo{CollectionID: fakeCollectionID, FieldID: 101, IndexName: "failed", IndexID: fakeIndexID},
+	})
+	s.Require().NoError(err)
+	_, err = c.EtcdCli.Put(ctx, fmt.Sprintf("%s/field-index/%d/%d", metaRoot, fakeCollectionID, fakeIndexID), string(indexBytes))
+	s.Require().NoError(err)
+	segmentIndexBytes, err := proto.Marshal(&indexpb.SegmentIndex{
+		CollectionID: fakeCollectionID,
+		PartitionID:  fakePartitionID,
+		SegmentID:    fakeSegmentID,
+		NumRows:      10,
+		IndexID:      fakeIndexID,
+		BuildID:      fakeBuildID,
+		State:        commonpb.IndexState_Failed,
+		FailReason:   "mock failure",
+	})
+	s.Require().NoError(err)
+	_, err = c.EtcdCli.Put(ctx, fmt.Sprintf("%s/segment-index/%d/%d/%d/%d", metaRoot, fakeCollectionID, fakePartitionID, fakeSegmentID, fakeBuildID), string(segmentIndexBytes))
+	s.Require().NoError(err)
+
+	progresses, err = GetIndexBuildProgress(c.MetaWatcher, fakeCollectionID)
+	s.Require().NoError(err)
+	s.Require().Len(progresses, 1)
+	s.Equal(1, progresses[0].Failed)
+	s.Zero(progresses[0].Finished)
+	s.EqualValues(0, progresses[0].Progress())
+}
+
+func (s *MetaWatcherMethodsSuite) TestShowChannelCheckpoints() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	metaRoot := GetMetaRootPath(c.params[EtcdRootPath])
+	seeded := map[string]*msgpb.MsgPosition{
+		"by-dev-rootcoord-dml_0_3000v0": {ChannelName: "by-dev-rootcoord-dml_0", MsgID: []byte{1, 2, 3}, Timestamp: 100},
+		"by-dev-rootcoord-dml_1_3000v1": {ChannelName: "by-dev-rootcoord-dml_1", MsgID: []byte{4, 5, 6}, Timestamp: 200},
+	}
+	for vchannel, position := range seeded {
+		bs, err := proto.Marshal(position)
+		s.Require().NoError(err)
+		_, err = c.EtcdCli.Put(ctx, fmt.Sprintf("%s/datacoord-meta/channel-cp/%s", metaRoot, vchannel), string(bs))
+		s.Require().NoError(err)
+	}
+	// broken value is skipped
+	_, err := c.EtcdCli.Put(ctx, fmt.Sprintf("%s/datacoord-meta/channel-cp/%s", metaRoot, "by-dev-rootcoord-dml_2_3000v2"), "invalid")
+	s.Require().NoError(err)
+
+	checkpoints, err := c.MetaWatcher.ShowChannelCheckpoints()
+	s.Require().NoError(err)
+	s.NotContains(checkpoints, "by-dev-rootcoord-dml_2_3000v2")
+	for vchannel, expected := range seeded {
+		position, ok := checkpoints[vchannel]
+		s.Require().True(ok, vchannel)
+		s.Equal(expected.GetChannelName(), position.GetChannelName())
+		s.Equal(expected.GetMsgID(), position.GetMsgID())
+		s.Equal(expected.GetTimestamp(), position.GetTimestamp())
+	}
+}
+
+func (s *MetaWatcherMethodsSuite) TestSegmentTimeline() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	var (
+		collectionID int64 = 3000
+		partitionID  int64 = 3001
+		sourceID     int64 = 3002
+		resultID     int64 = 3003
+		indexID      int64 = 3004
+		buildID      int64 = 3005
+		replicaID    int64 = 3006
+	)
+	metaRoot := GetMetaRootPath(c.params[EtcdRootPath])
+	put := func(key string, msg proto.Message) {
+		bs, err := proto.Marshal(msg)
+		s.Require().NoError(err)
+		_, err = c.EtcdCli.Put(ctx, metaRoot+"/"+key, string(bs))
+		s.Require().NoError(err)
+	}
+	channel := "by-dev-rootcoord-dml_0_3000v0"
+	put(fmt.Sprintf("datacoord-meta/s/%d/%d/%d", collectionID, partitionID, sourceID), &datapb.SegmentInfo{
+		ID:            sourceID,
+		CollectionID:  collectionID,
+		PartitionID:   partitionID,
+		InsertChannel: channel,
+		NumOfRows:     10,
+		State:         commonpb.SegmentState_Dropped,
+		StartPosition: &msgpb.MsgPosition{ChannelName: channel},
+		DmlPosition:   &msgpb.MsgPosition{ChannelName: channel},
+		DroppedAt:     uint64(time.Now().UnixNano()),
+	})
+	put(fmt.Sprintf("datacoord-meta/s/%d/%d/%d", collectionID, partitionID, resultID), &datapb.SegmentInfo{
+		ID:                  resultID,
+		CollectionID:        collectionID,
+		PartitionID:         partitionID,
+		InsertChannel:       channel,
+		NumOfRows:           10,
+		State:               commonpb.SegmentState_Flushed,
+		CreatedByCompaction: true,
+		CompactionFrom:      []int64{sourceID},
+	})
+	put(fmt.Sprintf("field-index/%d/%d", collectionID, indexID), &indexpb.FieldIndex{
+		IndexInfo: &indexpb.IndexInfo{CollectionID: collectionID, FieldID: 101, IndexName: "vec_index", IndexID: indexID},
+	})
+	put(fmt.Sprintf("segment-index/%d/%d/%d/%d", collectionID, partitionID, sourceID, buildID), &indexpb.SegmentIndex{
+		CollectionID: collectionID,
+		PartitionID:  partitionID,
+		SegmentID:    sourceID,
+		NumRows:      10,
+		IndexID:      indexID,
+		BuildID:      buildID,
+		NodeID:       7,
+		State:        commonpb.IndexState_Finished,
+	})
+	put(fmt.Sprintf("querycoord-replica/%d/%d", collectionID, replicaID), &querypb.Replica{
+		ID:           replicaID,
+		CollectionID: collectionID,
+		Nodes:        []int64{8, 9},
+	})
+
+	timeline, err := c.MetaWatcher.SegmentTimeline(sourceID)
+	s.Require().NoError(err)
+	log.Info("segment timeline\n" + timeline)
+	s.Contains(timeline, fmt.Sprintf("Segment %d, collection %d, partition %d, channel %s", sourceID, collectionID, partitionID, channel))
+	s.Contains(timeline, "Created: by insert")
+	s.Contains(timeline, "start position: "+channel)
+	s.Contains(timeline, "State: Dropped, rows: 10")
+	s.Contains(timeline, fmt.Sprintf("Compacted: into segments [%d]", resultID))
+	s.Contains(timeline, "Dropped: at")
+	s.Contains(timeline, fmt.Sprintf("vec_index(%d) build %d: Finished on node 7", indexID, buildID))
+	s.Contains(timeline, fmt.Sprintf("replica %d on nodes [8 9]", replicaID))
+
+	timeline, err = c.MetaWatcher.SegmentTimeline(resultID)
+	s.Require().NoError(err)
+	s.Contains(timeline, fmt.Sprintf("Created: by compaction from segments [%d]", sourceID))
+	s.Contains(timeline, "State: Flushed")
+	s.Contains(timeline, "Compacted: no")
+	s.Contains(timeline, "Index: not built")
+
+	_, err = c.MetaWatcher.SegmentTimeline(3999)
+	s.ErrorIs(err, merr.ErrSegmentNotFound)
+}
+
+func (s *MetaWatcherMethodsSuite) TestRecordSegmentTransitions() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	var (
+		collectionID int64 = 4000
+		partitionID  int64 = 4001
+	)
+	metaRoot := GetMetaRootPath(c.params[EtcdRootPath])
+	segmentKey := func(segmentID int64) string {
+		return fmt.Sprintf("%s/datacoord-meta/s/%d/%d/%d", metaRoot, collectionID, partitionID, segmentID)
+	}
+	put := func(segmentID int64, state commonpb.SegmentState, rows int64) {
+		bs, err := proto.Marshal(&datapb.SegmentInfo{
+			ID:           segmentID,
+			CollectionID: collectionID,
+			PartitionID:  partitionID,
+			State:        state,
+			NumOfRows:    rows,
+		})
+		s.Require().NoError(err)
+		_, err = c.EtcdCli.Put(ctx, segmentKey(segmentID), string(bs))
+		s.Require().NoError(err)
+	}
+	// existing before the window
+	put(4100, commonpb.SegmentState_Flushed, 10)
+
+	windowCtx, windowCancel := context.WithTimeout(ctx, 3*time.Second)
+	defer windowCancel()
+	var transitions []SegmentTransition
+	var recordErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		transitions, recordErr = c.MetaWatcher.RecordSegmentTransitions(windowCtx, collectionID)
+	}()
+	// wait for the watch established
+	time.Sleep(500 * time.Millisecond)
+
+	put(4101, commonpb.SegmentState_Growing, 0)
+	put(4101, commonpb.SegmentState_Growing, 100)
+	put(4102, commonpb.SegmentState_Growing, 0)
+	put(4101, commonpb.SegmentState_Sealed, 100)
+	put(4101, commonpb.SegmentState_Flushing, 100)
+	put(4101, commonpb.SegmentState_Flushed, 100)
+	put(4100, commonpb.SegmentState_Dropped, 10)
+	_, err := c.EtcdCli.Delete(ctx, segmentKey(4102))
+	s.Require().NoError(err)
+	<-done
+
+	s.Require().NoError(recordErr)
+	actual := make([]string, 0, len(transitions))
+	for i, transition := range transitions {
+		actual = append(actual, transition.String())
+		if i > 0 {
+			s.Greater(transition.Revision, transitions[i-1].Revision)
+			s.False(transition.Time.Before(transitions[i-1].Time))
+		}
+	}
+	s.Equal([]string{
+		"segment 4101: SegmentStateNone -> Growing",
+		"segment 4102: SegmentStateNone -> Growing",
+		"segment 4101: Growing -> Sealed",
+		"segment 4101: Sealed -> Flushing",
+		"segment 4101: Flushing -> Flushed",
+		"segment 4100: Flushed -> Dropped",
+		"segment 4102: Growing -> NotExist",
+	}, actual)
+}
+
 func TestMetaWatcher(t *testing.T) {
 	t.Skip("Skip integration test, need to refactor integration test framework")
 	suite.Run(t, new(MetaWatcherSuite))
 }
+
+// MetaWatcherMethodsSuite runs the tests of the MetaWatcher methods on a cluster of its own,
+// they don't depend on the framework MetaWatcherSuite waits to be refactored for.
+type MetaWatcherMethodsSuite struct {
+	MiniClusterSuite
+}
+
+func TestMetaWatcherMethods(t *testing.T) {
+	suite.Run(t, new(MetaWatcherMethodsSuite))
+}
+
+func (s *MetaWatcherMethodsSuite) TestMetaKeyCounts() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	rootPath := "/meta-key-counts-test"
+	_, err := c.EtcdCli.Delete(ctx, rootPath+"/", clientv3.WithPrefix())
+	s.Require().NoError(err)
+	defer c.EtcdCli.Delete(context.Background(), rootPath+"/", clientv3.WithPrefix())
+
+	for _, key := range []string{
+		"session/datanode-1",
+		"session/querynode-2",
+		"datacoord-meta/s/100/101/1",
+		"datacoord-meta/s/100/101/2",
+		"datacoord-meta/s/100/101/3",
+		// not segments
+		"datacoord-meta/statslog/100/101/1/0",
+		"datacoord-meta/binlog/100/101/1/0",
+		"querycoord-replica/100/1",
+		"field-index/100/1",
+		"segment-index/100/101/1/1",
+		"segment-index/100/101/2/1",
+		"root-coord/collection/100",
+		"root-coord/database/collection-info/1/200",
+	} {
+		_, err := c.EtcdCli.Put(ctx, rootPath+"/meta/"+key, "value")
+		s.Require().NoError(err)
+	}
+
+	watcher := &EtcdMetaWatcher{rootPath: rootPath, etcdCli: c.EtcdCli}
+	counts, err := watcher.MetaKeyCounts()
+	s.NoError(err)
+	s.Equal(map[string]int{
+		"sessions":        2,
+		"segments":        3,
+		"replicas":        1,
+		"indexes":         1,
+		"segment-indexes": 2,
+		"collections":     2,
+	}, counts)
+}
+
+func (s *MetaWatcherMethodsSuite) TestShowAll() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	rootPath := "/show-all-test"
+	_, err := c.EtcdCli.Delete(ctx, rootPath+"/", clientv3.WithPrefix())
+	s.Require().NoError(err)
+	defer c.EtcdCli.Delete(context.Background(), rootPath+"/", clientv3.WithPrefix())
+
+	put := func(key string, message proto.Message) {
+		value, err := proto.Marshal(message)
+		s.Require().NoError(err)
+		_, err = c.EtcdCli.Put(ctx, rootPath+"/meta/"+key, string(value))
+		s.Require().NoError(err)
+	}
+	put("custom-segment/100/101/1", &datapb.SegmentInfo{ID: 1, CollectionID: 100, PartitionID: 101})
+	put("custom-segment/100/101/2", &datapb.SegmentInfo{ID: 2, CollectionID: 100, PartitionID: 101})
+	put("custom-replica/100/1", &querypb.Replica{ID: 1, CollectionID: 100, Nodes: []int64{1, 2}})
+	_, err = c.EtcdCli.Put(ctx, rootPath+"/meta/custom-replica/100/2", "not a replica")
+	s.Require().NoError(err)
+
+	watcher := &EtcdMetaWatcher{rootPath: rootPath, etcdCli: c.EtcdCli}
+	watcher.RegisterSubsystem("custom-segments", "custom-segment/", func() proto.Message { return &datapb.SegmentInfo{} })
+	watcher.RegisterSubsystem("custom-replicas", "custom-replica/", func() proto.Message { return &querypb.Replica{} })
+
+	all, err := watcher.ShowAll()
+	s.Require().NoError(err)
+
+	segments := all["custom-segments"]
+	s.Require().Len(segments, 2)
+	for i, message := range segments {
+		segment, ok := message.(*datapb.SegmentInfo)
+		s.Require().True(ok)
+		s.EqualValues(i+1, segment.GetID())
+		s.EqualValues(100, segment.GetCollectionID())
+	}
+
+	replicas := all["custom-replicas"]
+	s.Require().Len(replicas, 1)
+	replica, ok := replicas[0].(*querypb.Replica)
+	s.Require().True(ok)
+	s.EqualValues(1, replica.GetID())
+	s.Equal([]int64{1, 2}, replica.GetNodes())
+
+	// default subsystems are kept, empty under the isolated root path
+	s.Contains(all, "segments")
+	s.Empty(all["segments"])
+}
@@ -30,6 +30,7 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/zap"
 
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
 	"github.com/milvus-io/milvus/internal/datacoord"
 	"github.com/milvus-io/milvus/internal/datanode"
 	datacoordclient "github.com/milvus-io/milvus/internal/distributed/datacoord/client"
@@ -40,6 +41,7 @@ import (
 	querynodeclient "github.com/milvus-io/milvus/internal/distributed/querynode/client"
 	rootcoordclient "github.com/milvus-io/milvus/internal/distributed/rootcoord/client"
 	"github.com/milvus-io/milvus/internal/indexnode"
+	"github.com/milvus-io/milvus/internal/proto/querypb"
 	proxy2 "github.com/milvus-io/milvus/internal/proxy"
 	querycoord "github.com/milvus-io/milvus/internal/querycoordv2"
 	"github.com/milvus-io/milvus/internal/querynodev2"
@@ -49,8 +51,10 @@ import (
 	"github.com/milvus-io/milvus/internal/util/dependency"
 	"github.com/milvus-io/milvus/pkg/config"
 	"github.com/milvus-io/milvus/pkg/log"
+	"github.com/milvus-io/milvus/pkg/util/commonpbutil"
 	"github.com/milvus-io/milvus/pkg/util/etcd"
 	"github.com/milvus-io/milvus/pkg/util/funcutil"
+	"github.com/milvus-io/milvus/pkg/util/merr"
 	"github.com/milvus-io/milvus/pkg/util/paramtable"
 )
 
@@ -113,6 +117,16 @@ type MiniCluster struct {
 	ChunkManager storage.ChunkManager
 
 	EtcdCli *clientv3.Client
+	// EtcdFaultProxy degrades the etcd traffic of components if set, see WithEtcdFaultProxy.
+	EtcdFaultProxy *EtcdFaultProxy
+	// metaEtcdCli talks to etcd directly for MetaWatcher when EtcdCli goes through EtcdFaultProxy.
+	metaEtcdCli *clientv3.Client
+	// componentMetaConns are the dedicated etcd connections of components when EtcdFaultProxy is set,
+	// see PauseMetaConnectivity.
+	componentMetaConns map[interface{}]*componentMetaConn
+	metaConnMu         sync.Mutex
+	// metaSnapshot is imported before the components start if set, see WithMetaSnapshot.
+	metaSnapshot *metaSnapshot
 
 	Proxy      types.ProxyComponent
 	DataCoord  types.DataCoordComponent
@@ -180,9 +194,28 @@ func StartMiniCluster(ctx context.Context, opts ...Option) (cluster *MiniCluster
 		cluster.EtcdCli = etcdCli
 	}
 
+	// components talk to etcd through the fault proxy, MetaWatcher keeps the direct client
+	cluster.metaEtcdCli = cluster.EtcdCli
+	if cluster.EtcdFaultProxy != nil {
+		var proxiedCli *clientv3.Client
+		proxiedCli, err = cluster.EtcdFaultProxy.NewClient(params.EtcdCfg.Endpoints.GetAsStrings())
+		if err != nil {
+			return nil, err
+		}
+		cluster.EtcdCli = proxiedCli
+	}
+
+	if cluster.metaSnapshot != nil {
+		err = cluster.metaSnapshot.importTo(cluster.ctx, cluster.metaEtcdCli, cluster.params[EtcdRootPath])
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	cluster.MetaWatcher = &EtcdMetaWatcher{
-		rootPath: cluster.params[EtcdRootPath],
-		etcdCli:  cluster.EtcdCli,
+		rootPath:     cluster.params[EtcdRootPath],
+		etcdCli:      cluster.metaEtcdCli,
+		chunkManager: cluster.ChunkManager,
 	}
 
 	if cluster.RootCoord == nil {
@@ -472,6 +505,11 @@ func (cluster *MiniCluster) Stop() error {
 	}
 	log.Info("mini cluster indexnodes stopped")
 
+	if cluster.EtcdFaultProxy != nil {
+		cluster.EtcdFaultProxy.Reset()
+		cluster.closeComponentMetaConns()
+		defer cluster.metaEtcdCli.Close()
+	}
 	cluster.EtcdCli.KV.Delete(cluster.ctx, params.EtcdCfg.RootPath.GetValue(), clientv3.WithPrefix())
 	defer cluster.EtcdCli.Close()
 
@@ -531,6 +569,99 @@ func WithEtcdClient(etcdCli *clientv3.Client) Option {
 	}
 }
 
+// WithEtcdFaultProxy places proxy between the components and etcd.
+func WithEtcdFaultProxy(proxy *EtcdFaultProxy) Option {
+	return func(cluster *MiniCluster) {
+		cluster.EtcdFaultProxy = proxy
+	}
+}
+
+// componentMetaConn is the etcd connection dedicated to a single component.
+type componentMetaConn struct {
+	proxy *EtcdFaultProxy
+	cli   *clientv3.Client
+}
+
+type etcdClientSetter interface {
+	SetEtcdClient(client *clientv3.Client)
+}
+
+// setComponentEtcdClient hands the etcd client to component. When the cluster has an EtcdFaultProxy,
+// the component gets a connection of its own going through both the cluster proxy and a dedicated one,
+// so that its meta connectivity could be paused without affecting the others.
+func (cluster *MiniCluster) setComponentEtcdClient(component etcdClientSetter) error {
+	if cluster.EtcdFaultProxy == nil {
+		component.SetEtcdClient(cluster.EtcdCli)
+		return nil
+	}
+	proxy := NewEtcdFaultProxy()
+	cli, err := newProxiedEtcdClient(params.EtcdCfg.Endpoints.GetAsStrings(), cluster.EtcdFaultProxy, proxy)
+	if err != nil {
+		return err
+	}
+	component.SetEtcdClient(cli)
+
+	cluster.metaConnMu.Lock()
+	defer cluster.metaConnMu.Unlock()
+	if cluster.componentMetaConns == nil {
+		cluster.componentMetaConns = make(map[interface{}]*componentMetaConn)
+	}
+	cluster.componentMetaConns[component] = &componentMetaConn{proxy: proxy, cli: cli}
+	return nil
+}
+
+func (cluster *MiniCluster) getComponentMetaConn(component interface{}) (*componentMetaConn, error) {
+	cluster.metaConnMu.Lock()
+	defer cluster.metaConnMu.Unlock()
+	conn, ok := cluster.componentMetaConns[component]
+	if !ok {
+		return nil, errors.New("component has no dedicated meta connection, the cluster must be started WithEtcdFaultProxy")
+	}
+	return conn, nil
+}
+
+func (cluster *MiniCluster) closeComponentMetaConns() {
+	cluster.metaConnMu.Lock()
+	defer cluster.metaConnMu.Unlock()
+	for _, conn := range cluster.componentMetaConns {
+		conn.proxy.Reset()
+		conn.cli.Close()
+	}
+	cluster.componentMetaConns = nil
+}
+
+// PauseMetaConnectivity black-holes the etcd traffic of a single component created by the cluster,
+// e.g. to let its session lease expire, while other components and the MetaWatcher keep working.
+// The cluster must be started WithEtcdFaultProxy.
+func (cluster *MiniCluster) PauseMetaConnectivity(component interface{}) error {
+	conn, err := cluster.getComponentMetaConn(component)
+	if err != nil {
+		return err
+	}
+	conn.proxy.Pause()
+	return nil
+}
+
+// ResumeMetaConnectivity lets the etcd traffic of component paused by PauseMetaConnectivity through again.
+func (cluster *MiniCluster) ResumeMetaConnectivity(component interface{}) error {
+	conn, err := cluster.getComponentMetaConn(component)
+	if err != nil {
+		return err
+	}
+	conn.proxy.Resume()
+	return nil
+}
+
+// ComponentEtcdClient returns the etcd client used by component, which is EtcdCli unless
+// the cluster is started WithEtcdFaultProxy.
+func (cluster *MiniCluster) ComponentEtcdClient(component interface{}) *clientv3.Client {
+	conn, err := cluster.getComponentMetaConn(component)
+	if err != nil {
+		return cluster.EtcdCli
+	}
+	return conn.cli
+}
+
 func WithFactory(factory dependency.Factory) Option {
 	return func(cluster *MiniCluster) {
 		cluster.factory = factory
@@ -593,7 +724,9 @@ func (cluster *MiniCluster) CreateDefaultRootCoord() (types.RootCoordComponent,
 	port := funcutil.GetAvailablePort()
 	rootCoord.SetAddress(funcutil.GetLocalIP() + ":" + fmt.Sprint(port))
 	rootCoord.SetProxyCreator(cluster.GetProxy)
-	rootCoord.SetEtcdClient(cluster.EtcdCli)
+	if err := cluster.setComponentEtcdClient(rootCoord); err != nil {
+		return nil, err
+	}
 	return rootCoord, nil
 }
 
@@ -603,7 +736,9 @@ func (cluster *MiniCluster) CreateDefaultDataCoord() (types.DataCoordComponent,
 	dataCoord.SetAddress(funcutil.GetLocalIP() + ":" + fmt.Sprint(port))
 	dataCoord.SetDataNodeCreator(cluster.GetDataNode)
 	dataCoord.SetIndexNodeCreator(cluster.GetIndexNode)
-	dataCoord.SetEtcdClient(cluster.EtcdCli)
+	if err := cluster.setComponentEtcdClient(dataCoord); err != nil {
+		return nil, err
+	}
 	return dataCoord, nil
 }
 
@@ -615,7 +750,9 @@ func (cluster *MiniCluster) CreateDefaultQueryCoord() (types.QueryCoordComponent
 	port := funcutil.GetAvailablePort()
 	queryCoord.SetAddress(funcutil.GetLocalIP() + ":" + fmt.Sprint(port))
 	queryCoord.SetQueryNodeCreator(cluster.GetQueryNode)
-	queryCoord.SetEtcdClient(cluster.EtcdCli)
+	if err := cluster.setComponentEtcdClient(queryCoord); err != nil {
+		return nil, err
+	}
 	return queryCoord, nil
 }
 
@@ -634,7 +771,9 @@ func (cluster *MiniCluster) CreateDefaultQueryCoord() (types.QueryCoordComponent
 func (cluster *MiniCluster) CreateDefaultDataNode() (types.DataNodeComponent, error) {
 	log.Debug("mini cluster CreateDefaultDataNode")
 	dataNode := datanode.NewDataNode(cluster.ctx, cluster.factory)
-	dataNode.SetEtcdClient(cluster.EtcdCli)
+	if err := cluster.setComponentEtcdClient(dataNode); err != nil {
+		return nil, err
+	}
 	port := funcutil.GetAvailablePort()
 	dataNode.SetAddress(funcutil.GetLocalIP() + ":" + fmt.Sprint(port))
 	return dataNode, nil
@@ -643,7 +782,9 @@ func (cluster *MiniCluster) CreateDefaultDataNode() (types.DataNodeComponent, er
 func (cluster *MiniCluster) CreateDefaultQueryNode() (types.QueryNodeComponent, error) {
 	log.Debug("mini cluster CreateDefaultQueryNode")
 	queryNode := querynodev2.NewQueryNode(cluster.ctx, cluster.factory)
-	queryNode.SetEtcdClient(cluster.EtcdCli)
+	if err := cluster.setComponentEtcdClient(queryNode); err != nil {
+		return nil, err
+	}
 	port := funcutil.GetAvailablePort()
 	queryNode.SetAddress(funcutil.GetLocalIP() + ":" + fmt.Sprint(port))
 	return queryNode, nil
@@ -652,7 +793,9 @@ func (cluster *MiniCluster) CreateDefaultQueryNode() (types.QueryNodeComponent,
 func (cluster *MiniCluster) CreateDefaultIndexNode() (types.IndexNodeComponent, error) {
 	log.Debug("mini cluster CreateDefaultIndexNode")
 	indexNode := indexnode.NewIndexNode(cluster.ctx, cluster.factory)
-	indexNode.SetEtcdClient(cluster.EtcdCli)
+	if err := cluster.setComponentEtcdClient(indexNode); err != nil {
+		return nil, err
+	}
 	port := funcutil.GetAvailablePort()
 	indexNode.SetAddress(funcutil.GetLocalIP() + ":" + fmt.Sprint(port))
 	return indexNode, nil
@@ -661,10 +804,12 @@ func (cluster *MiniCluster) CreateDefaultIndexNode() (types.IndexNodeComponent,
 func (cluster *MiniCluster) CreateDefaultProxy() (types.ProxyComponent, error) {
 	log.Debug("mini cluster CreateDefaultProxy")
 	proxy, err := proxy2.NewProxy(cluster.ctx, cluster.factory)
-	proxy.SetEtcdClient(cluster.EtcdCli)
 	if err != nil {
 		return nil, err
 	}
+	if err := cluster.setComponentEtcdClient(proxy); err != nil {
+		return nil, err
+	}
 	port := funcutil.GetAvailablePort()
 	proxy.SetAddress(funcutil.GetLocalIP() + ":" + fmt.Sprint(port))
 	proxy.SetQueryNodeCreator(cluster.GetQueryNode)
@@ -1287,3 +1432,29 @@ func (cluster *MiniCluster) GetIndexNode(ctx context.Context, addr string, nodeI
 func (cluster *MiniCluster) GetMetaWatcher() MetaWatcher {
 	return cluster.MetaWatcher
 }
+
+// ShowQueryCoordDist pulls the data distribution of each querynode, as querycoord does.
+func (cluster *MiniCluster) ShowQueryCoordDist(ctx context.Context) ([]*querypb.GetDataDistributionResponse, error) {
+	cluster.mu.RLock()
+	queryNodes := cluster.QueryNodes
+	cluster.mu.RUnlock()
+
+	dists := make([]*querypb.GetDataDistributionResponse, 0, len(queryNodes))
+	for _, queryNode := range queryNodes {
+		resp, err := queryNode.GetDataDistribution(ctx, &querypb.GetDataDistributionRequest{
+			Base: commonpbutil.NewMsgBase(
+				commonpbutil.WithMsgType(commonpb.MsgType_GetDistribution),
+				// all nodes of the mini cluster share the node id of paramtable
+				commonpbutil.WithTargetID(paramtable.GetNodeID()),
+			),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := merr.Error(resp.GetStatus()); err != nil {
+			return nil, err
+		}
+		dists = append(dists, resp)
+	}
+	return dists, nil
+}
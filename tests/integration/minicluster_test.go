@@ -18,13 +18,25 @@ package integration
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/milvuspb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
 	"github.com/milvus-io/milvus/internal/datanode"
 	"github.com/milvus-io/milvus/internal/indexnode"
+	"github.com/milvus-io/milvus/internal/proto/datapb"
 	"github.com/milvus-io/milvus/internal/querynodev2"
+	"github.com/milvus-io/milvus/pkg/util/funcutil"
+	"github.com/milvus-io/milvus/pkg/util/typeutil"
 )
 
 type MiniClusterMethodsSuite struct {
@@ -181,7 +193,162 @@ func (s *MiniClusterMethodsSuite) TestUpdateClusterSize() {
 	s.Equal(1, len(c.IndexNodes))
 }
 
+func (s *MiniClusterNodesSuite) TestRestartQueryNode() {
+	c := s.Cluster
+	tracker := NewSessionTracker(c.MetaWatcher)
+	tracker.Start(100 * time.Millisecond)
+	defer tracker.Stop()
+
+	s.Require().NoError(tracker.Observe())
+	history := tracker.History(typeutil.QueryNodeRole)
+	s.Require().Len(history, 1)
+	oldServerID := history[0].ServerID
+
+	err := c.RemoveQueryNode(c.QueryNodes[0])
+	s.NoError(err)
+	err = c.AddQueryNode(nil)
+	s.NoError(err)
+
+	s.Eventually(func() bool {
+		return tracker.AssertRestarted(typeutil.QueryNodeRole) == nil
+	}, 30*time.Second, 500*time.Millisecond)
+	s.Eventually(func() bool {
+		return tracker.AssertNoZombie(oldServerID) == nil
+	}, 30*time.Second, 500*time.Millisecond)
+
+	history = tracker.History(typeutil.QueryNodeRole)
+	s.Len(history, 2)
+	s.NotEqual(oldServerID, history[1].ServerID)
+}
+
+func (s *MiniClusterNodesSuite) TestAddDataNodeRebalance() {
+	c := s.Cluster
+	ctx, cancel := context.WithTimeout(c.GetContext(), 120*time.Second)
+	defer cancel()
+
+	collectionName := "TestAddDataNodeRebalance" + funcutil.GenRandomStr()
+	schema := ConstructSchema(collectionName, 128, true)
+	marshaledSchema, err := proto.Marshal(schema)
+	s.Require().NoError(err)
+	status, err := c.Proxy.CreateCollection(ctx, &milvuspb.CreateCollectionRequest{
+		CollectionName: collectionName,
+		Schema:         marshaledSchema,
+		ShardsNum:      4,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, status.GetErrorCode())
+
+	assignment, err := listChannelAssignment(c.MetaWatcher)
+	s.Require().NoError(err)
+	s.Len(assignment, 1)
+
+	err = c.AddDataNode(nil)
+	s.Require().NoError(err)
+	s.NoError(WaitForChannelsBalanced(ctx, c.MetaWatcher, 1))
+
+	assignment, err = listChannelAssignment(c.MetaWatcher)
+	s.Require().NoError(err)
+	s.Len(assignment, 2)
+	for nodeID, channels := range assignment {
+		s.NotEmpty(channels, "node %d watches no channel", nodeID)
+	}
+}
+
+func (s *MiniClusterNodesSuite) TestBootstrapFromMetaSnapshot() {
+	c := s.Cluster
+	ctx, cancel := context.WithTimeout(c.GetContext(), 120*time.Second)
+	defer cancel()
+
+	const (
+		dim    = 128
+		rowNum = 3000
+	)
+	collectionName := "TestBootstrapFromMetaSnapshot" + funcutil.GenRandomStr()
+	schema := ConstructSchema(collectionName, dim, true)
+	marshaledSchema, err := proto.Marshal(schema)
+	s.Require().NoError(err)
+	status, err := c.Proxy.CreateCollection(ctx, &milvuspb.CreateCollectionRequest{
+		CollectionName: collectionName,
+		Schema:         marshaledSchema,
+		ShardsNum:      2,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, status.GetErrorCode())
+
+	insertResult, err := c.Proxy.Insert(ctx, &milvuspb.InsertRequest{
+		CollectionName: collectionName,
+		FieldsData:     []*schemapb.FieldData{NewFloatVectorFieldData(FloatVecField, rowNum, dim)},
+		HashKeys:       GenerateHashKeys(rowNum),
+		NumRows:        uint32(rowNum),
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(commonpb.ErrorCode_Success, insertResult.GetStatus().GetErrorCode())
+	flushResp, err := c.Proxy.Flush(ctx, &milvuspb.FlushRequest{
+		CollectionNames: []string{collectionName},
+	})
+	s.Require().NoError(err)
+	s.WaitForFlush(ctx, flushResp.GetCollSegIDs()[collectionName].GetData(), flushResp.GetCollFlushTs()[collectionName], "", collectionName)
+
+	snapshotFile := filepath.Join(s.T().TempDir(), "meta.json")
+	f, err := os.Create(snapshotFile)
+	s.Require().NoError(err)
+	s.Require().NoError(ExportMeta(ctx, c.EtcdCli, c.params[EtcdRootPath], f))
+	s.Require().NoError(f.Close())
+
+	expectedSegments, err := c.MetaWatcher.ShowSegments()
+	s.Require().NoError(err)
+	s.Require().NotEmpty(expectedSegments)
+	expectedCollections, err := c.MetaWatcher.ShowCollections()
+	s.Require().NoError(err)
+
+	// only one cluster could run at a time, the bootstrapped one is stopped by TearDownTest,
+	// its root path must not start with the exporting one, which is removed by prefix on stop
+	s.Require().NoError(c.Stop())
+	bootstrapped, err := StartMiniCluster(c.GetContext(),
+		WithParam(params.EtcdCfg.Endpoints.Key, c.params[params.EtcdCfg.Endpoints.Key]),
+		WithParam(EtcdRootPath, "bootstrap-"+c.params[EtcdRootPath]),
+		WithMetaSnapshot(snapshotFile, MetaSnapshotFilter{Exclude: []string{"meta/session/"}}),
+	)
+	s.Require().NoError(err)
+	s.Cluster = bootstrapped
+	s.Require().NoError(bootstrapped.Start())
+	s.NoError(bootstrapped.AssertExclusiveRoles())
+
+	segments, err := bootstrapped.MetaWatcher.ShowSegments()
+	s.Require().NoError(err)
+	s.Equal(summarizeSegments(expectedSegments), summarizeSegments(segments))
+	collections, err := bootstrapped.MetaWatcher.ShowCollections()
+	s.Require().NoError(err)
+	s.Require().Equal(len(expectedCollections), len(collections))
+	for i := range expectedCollections {
+		s.Equal(expectedCollections[i].GetID(), collections[i].GetID())
+		s.Equal(expectedCollections[i].GetSchema().GetName(), collections[i].GetSchema().GetName())
+		s.Equal(expectedCollections[i].GetVirtualChannelNames(), collections[i].GetVirtualChannelNames())
+	}
+}
+
+// summarizeSegments describes the segments by the fields kept across clusters, sorted by ID.
+func summarizeSegments(segments []*datapb.SegmentInfo) []string {
+	summary := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		summary = append(summary, fmt.Sprintf("%d: collection %d, channel %s, state %s, rows %d",
+			segment.GetID(), segment.GetCollectionID(), segment.GetInsertChannel(), segment.GetState(), segment.GetNumOfRows()))
+	}
+	sort.Strings(summary)
+	return summary
+}
+
 func TestMiniCluster(t *testing.T) {
 	t.Skip("Skip integration test, need to refactor integration test framework")
 	suite.Run(t, new(MiniClusterMethodsSuite))
 }
+
+// MiniClusterNodesSuite runs the tests restarting and adding nodes, and bootstrapping a cluster,
+// each on a cluster of its own, unlike the skipped MiniClusterMethodsSuite.
+type MiniClusterNodesSuite struct {
+	MiniClusterSuite
+}
+
+func TestMiniClusterNodes(t *testing.T) {
+	suite.Run(t, new(MiniClusterNodesSuite))
+}
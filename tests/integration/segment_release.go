@@ -0,0 +1,115 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/milvus-io/milvus/internal/proto/querypb"
+)
+
+var segmentReleasePollInterval = 500 * time.Millisecond
+
+// QueryDistViewer shows the querynode distribution and the meta, it is implemented by MiniCluster.
+type QueryDistViewer interface {
+	ShowQueryCoordDist(ctx context.Context) ([]*querypb.GetDataDistributionResponse, error)
+	GetMetaWatcher() MetaWatcher
+}
+
+// showLingering describes the segments, channels and leader views of the collection still on
+// querynodes, and the load info of the collection if it still exists, empty if there is none.
+func showLingering(ctx context.Context, cluster QueryDistViewer, collectionID int64) (string, error) {
+	dists, err := cluster.ShowQueryCoordDist(ctx)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(dists, func(i, j int) bool { return dists[i].GetNodeID() < dists[j].GetNodeID() })
+
+	var sb strings.Builder
+	for _, dist := range dists {
+		var segments []int64
+		var channels, leaders []string
+		for _, segment := range dist.GetSegments() {
+			if segment.GetCollection() == collectionID {
+				segments = append(segments, segment.GetID())
+			}
+		}
+		for _, channel := range dist.GetChannels() {
+			if channel.GetCollection() == collectionID {
+				channels = append(channels, channel.GetChannel())
+			}
+		}
+		for _, view := range dist.GetLeaderViews() {
+			if view.GetCollection() == collectionID {
+				leaders = append(leaders, view.GetChannel())
+			}
+		}
+		if len(segments)+len(channels)+len(leaders) == 0 {
+			continue
+		}
+		sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+		sort.Strings(channels)
+		sort.Strings(leaders)
+		fmt.Fprintf(&sb, "  node %d: segments %v, channels %v, leader views %v\n", dist.GetNodeID(), segments, channels, leaders)
+	}
+
+	infos, err := cluster.GetMetaWatcher().ShowCollectionLoadInfos()
+	if err != nil {
+		return "", err
+	}
+	for _, info := range infos {
+		if info.GetCollectionID() == collectionID {
+			fmt.Fprintf(&sb, "  load info: status %s, replicas %d\n", info.GetStatus(), info.GetReplicaNumber())
+		}
+	}
+	return sb.String(), nil
+}
+
+// WaitForSegmentsReleased waits until no querynode reports segments, channels or leader views
+// of the collection, and the load info of the collection is removed.
+// If ctx is done first, an error with the lingering assignments is returned, e.g.
+//
+//	segments of collection 100 not released until ctx done, lingering:
+//	  node 1: segments [1001 1002], channels [by-dev-rootcoord-dml_0_100v0], leader views []
+//	  load info: status Loaded, replicas 1
+func WaitForSegmentsReleased(ctx context.Context, cluster QueryDistViewer, collectionID int64) error {
+	var lastLingering string
+	var lastErr error
+	for {
+		lingering, err := showLingering(ctx, cluster, collectionID)
+		if err == nil && lingering == "" {
+			return nil
+		}
+		if err == nil {
+			lastLingering = lingering
+		}
+		lastErr = err
+
+		select {
+		case <-ctx.Done():
+			if lastLingering == "" {
+				return fmt.Errorf("segments of collection %d not released until ctx done, last error: %w", collectionID, lastErr)
+			}
+			return fmt.Errorf("segments of collection %d not released until ctx done, lingering:\n%s", collectionID, lastLingering)
+		case <-time.After(segmentReleasePollInterval):
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/milvus-io/milvus/internal/proto/querypb"
+)
+
+type loadInfoMetaWatcher struct {
+	MetaWatcher
+	infos []*querypb.CollectionLoadInfo
+}
+
+func (watcher *loadInfoMetaWatcher) ShowCollectionLoadInfos() ([]*querypb.CollectionLoadInfo, error) {
+	return watcher.infos, nil
+}
+
+type fakeQueryDistViewer struct {
+	dists   []*querypb.GetDataDistributionResponse
+	watcher *loadInfoMetaWatcher
+}
+
+func (viewer *fakeQueryDistViewer) ShowQueryCoordDist(ctx context.Context) ([]*querypb.GetDataDistributionResponse, error) {
+	return viewer.dists, nil
+}
+
+func (viewer *fakeQueryDistViewer) GetMetaWatcher() MetaWatcher {
+	return viewer.watcher
+}
+
+func TestWaitForSegmentsReleased(t *testing.T) {
+	defer func(interval time.Duration) { segmentReleasePollInterval = interval }(segmentReleasePollInterval)
+	segmentReleasePollInterval = 10 * time.Millisecond
+
+	const collectionID = 100
+	viewer := &fakeQueryDistViewer{
+		dists: []*querypb.GetDataDistributionResponse{
+			{NodeID: 2, Segments: []*querypb.SegmentVersionInfo{{ID: 2001, Collection: 200}}},
+			{
+				NodeID:      1,
+				Segments:    []*querypb.SegmentVersionInfo{{ID: 1002, Collection: collectionID}, {ID: 1001, Collection: collectionID}},
+				Channels:    []*querypb.ChannelVersionInfo{{Channel: "dml_0_100v0", Collection: collectionID}},
+				LeaderViews: []*querypb.LeaderView{{Collection: 200, Channel: "dml_1_200v0"}},
+			},
+		},
+		watcher: &loadInfoMetaWatcher{infos: []*querypb.CollectionLoadInfo{
+			{CollectionID: collectionID, Status: querypb.LoadStatus_Loaded, ReplicaNumber: 1},
+			{CollectionID: 200, Status: querypb.LoadStatus_Loaded, ReplicaNumber: 1},
+		}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := WaitForSegmentsReleased(ctx, viewer, collectionID)
+	assert.Error(t, err)
+	assert.Equal(t, "segments of collection 100 not released until ctx done, lingering:\n"+
+		"  node 1: segments [1001 1002], channels [dml_0_100v0], leader views []\n"+
+		"  load info: status Loaded, replicas 1\n", err.Error())
+
+	// other collections are not waited
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, WaitForSegmentsReleased(ctx, viewer, 300))
+}
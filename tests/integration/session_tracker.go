@@ -0,0 +1,209 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/log"
+)
+
+// SessionRecord is one session of a server observed by SessionTracker.
+type SessionRecord struct {
+	ServerID  int64
+	Address   string
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// SessionTracker records the history of sessions per server type,
+// so tests could assert a component restarted with a new server id.
+type SessionTracker struct {
+	watcher MetaWatcher
+
+	mu           sync.Mutex
+	history      map[string][]*SessionRecord
+	lastObserved time.Time
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewSessionTracker(watcher MetaWatcher) *SessionTracker {
+	return &SessionTracker{
+		watcher: watcher,
+		history: make(map[string][]*SessionRecord),
+		closeCh: make(chan struct{}),
+	}
+}
+
+// Observe lists the sessions once and updates the history.
+func (tracker *SessionTracker) Observe() error {
+	sessions, err := tracker.watcher.ShowSessions()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	for _, session := range sessions {
+		record := tracker.find(session.ServerName, session.ServerID)
+		if record == nil {
+			record = &SessionRecord{
+				ServerID:  session.ServerID,
+				Address:   session.Address,
+				FirstSeen: now,
+			}
+			tracker.history[session.ServerName] = append(tracker.history[session.ServerName], record)
+		}
+		record.LastSeen = now
+	}
+	tracker.lastObserved = now
+	return nil
+}
+
+// Start observes the sessions every interval in background, until Stop is called.
+func (tracker *SessionTracker) Start(interval time.Duration) {
+	tracker.wg.Add(1)
+	go func() {
+		defer tracker.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := tracker.Observe(); err != nil {
+				log.Warn("session tracker failed to observe sessions", zap.Error(err))
+			}
+			select {
+			case <-tracker.closeCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (tracker *SessionTracker) Stop() {
+	tracker.closeOnce.Do(func() {
+		close(tracker.closeCh)
+	})
+	tracker.wg.Wait()
+}
+
+// History returns the sessions observed of serverType, in the order they are first seen.
+func (tracker *SessionTracker) History(serverType string) []SessionRecord {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	records := make([]SessionRecord, 0, len(tracker.history[serverType]))
+	for _, record := range tracker.history[serverType] {
+		records = append(records, *record)
+	}
+	return records
+}
+
+// AssertRestarted checks that a session of serverType is gone, and a new session
+// with a different server id showed up after it and is still alive.
+func (tracker *SessionTracker) AssertRestarted(serverType string) error {
+	if err := tracker.Observe(); err != nil {
+		return err
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	records := tracker.history[serverType]
+	for _, old := range records {
+		if tracker.alive(old) {
+			continue
+		}
+		for _, record := range records {
+			if record.ServerID != old.ServerID && tracker.alive(record) && record.FirstSeen.After(old.FirstSeen) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s not restarted, sessions: %s", serverType, formatSessionRecords(records))
+}
+
+// AssertNoZombie checks that the old server id is no longer referenced
+// by sessions, replicas or channel watch infos.
+func (tracker *SessionTracker) AssertNoZombie(oldServerID int64) error {
+	sessions, err := tracker.watcher.ShowSessions()
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.ServerID == oldServerID {
+			return fmt.Errorf("session of %s %d still exists", session.ServerName, oldServerID)
+		}
+	}
+
+	replicas, err := tracker.watcher.ShowReplicas()
+	if err != nil {
+		return err
+	}
+	for _, replica := range replicas {
+		for _, node := range replica.GetNodes() {
+			if node == oldServerID {
+				return fmt.Errorf("node %d still in replica %s", oldServerID, PrettyReplica(replica))
+			}
+		}
+	}
+
+	states, err := tracker.watcher.ShowChannelRemovalState()
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		for _, watcher := range state.Watchers {
+			if watcher == oldServerID {
+				return fmt.Errorf("node %d still watches channel %s", oldServerID, state.Channel)
+			}
+		}
+	}
+	return nil
+}
+
+func (tracker *SessionTracker) find(serverType string, serverID int64) *SessionRecord {
+	for _, record := range tracker.history[serverType] {
+		if record.ServerID == serverID {
+			return record
+		}
+	}
+	return nil
+}
+
+// alive returns whether the record is seen by the last observation.
+func (tracker *SessionTracker) alive(record *SessionRecord) bool {
+	return !record.LastSeen.Before(tracker.lastObserved)
+}
+
+func formatSessionRecords(records []*SessionRecord) string {
+	result := "["
+	for i, record := range records {
+		if i > 0 {
+			result += ", "
+		}
+		result += fmt.Sprintf("{id: %d, address: %s, firstSeen: %s, lastSeen: %s}",
+			record.ServerID, record.Address, record.FirstSeen.Format(time.RFC3339Nano), record.LastSeen.Format(time.RFC3339Nano))
+	}
+	return result + "]"
+}
@@ -0,0 +1,71 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/internal/proto/querypb"
+	"github.com/milvus-io/milvus/internal/util/sessionutil"
+	"github.com/milvus-io/milvus/pkg/util/typeutil"
+)
+
+type trackerMetaWatcher struct {
+	channelMetaWatcher
+	replicas []*querypb.Replica
+}
+
+func (watcher *trackerMetaWatcher) ShowReplicas() ([]*querypb.Replica, error) {
+	return watcher.replicas, nil
+}
+
+func TestSessionTracker(t *testing.T) {
+	watcher := &trackerMetaWatcher{}
+	dataNode := newTestSession(typeutil.DataNodeRole, 1, false)
+	watcher.set([]*sessionutil.Session{dataNode, newTestSession(typeutil.QueryNodeRole, 2, false)}, nil)
+	tracker := NewSessionTracker(watcher)
+
+	require.NoError(t, tracker.Observe())
+	history := tracker.History(typeutil.QueryNodeRole)
+	require.Len(t, history, 1)
+	assert.EqualValues(t, 2, history[0].ServerID)
+	err := tracker.AssertRestarted(typeutil.QueryNodeRole)
+	assert.ErrorContains(t, err, "querynode not restarted, sessions: [{id: 2")
+
+	// the query node is gone, and not restarted until a new one shows up
+	watcher.set([]*sessionutil.Session{dataNode}, nil)
+	assert.Error(t, tracker.AssertRestarted(typeutil.QueryNodeRole))
+	watcher.set([]*sessionutil.Session{dataNode, newTestSession(typeutil.QueryNodeRole, 3, false)}, nil)
+	assert.NoError(t, tracker.AssertRestarted(typeutil.QueryNodeRole))
+	history = tracker.History(typeutil.QueryNodeRole)
+	require.Len(t, history, 2)
+	assert.EqualValues(t, 3, history[1].ServerID)
+	assert.Error(t, tracker.AssertRestarted(typeutil.DataNodeRole))
+
+	// the old node lingers in the replicas and the channels until they're reassigned
+	watcher.replicas = []*querypb.Replica{{ID: 1, CollectionID: 100, Nodes: []int64{2, 3}}}
+	assert.ErrorContains(t, tracker.AssertNoZombie(2), "node 2 still in replica")
+	watcher.replicas = []*querypb.Replica{{ID: 1, CollectionID: 100, Nodes: []int64{3}}}
+	watcher.set(watcher.sessions, []*ChannelRemovalState{{Channel: "ch0", CollectionID: 100, Watchers: []int64{2}}})
+	assert.EqualError(t, tracker.AssertNoZombie(2), "node 2 still watches channel ch0")
+	watcher.set(watcher.sessions, []*ChannelRemovalState{{Channel: "ch0", CollectionID: 100, Watchers: []int64{1}}})
+	assert.NoError(t, tracker.AssertNoZombie(2))
+	assert.EqualError(t, tracker.AssertNoZombie(3), "session of querynode 3 still exists")
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -57,12 +58,19 @@ func (s *EmbedEtcdSuite) TearDownEmbedEtcd() {
 	}
 }
 
+// failureDumpDirEnv is the env of the directory the meta of a failed test is exported to as CSV,
+// under the sub directory of the test name, nothing is exported if not set.
+const failureDumpDirEnv = "MILVUS_INTEGRATION_FAILURE_DUMP_DIR"
+
 type MiniClusterSuite struct {
 	suite.Suite
 	EmbedEtcdSuite
 
 	Cluster    *MiniCluster
 	cancelFunc context.CancelFunc
+
+	// ClusterOptions are extra options applied when the mini cluster is started for each test
+	ClusterOptions []Option
 }
 
 func (s *MiniClusterSuite) SetupSuite() {
@@ -86,10 +94,11 @@ func (s *MiniClusterSuite) SetupTest() {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*180)
 	s.cancelFunc = cancel
-	c, err := StartMiniCluster(ctx, func(c *MiniCluster) {
+	opts := append([]Option{func(c *MiniCluster) {
 		// change config etcd endpoints
 		c.params[params.EtcdCfg.Endpoints.Key] = val
-	})
+	}}, s.ClusterOptions...)
+	c, err := StartMiniCluster(ctx, opts...)
 	s.Require().NoError(err)
 	s.Cluster = c
 
@@ -101,6 +110,36 @@ func (s *MiniClusterSuite) TearDownTest() {
 	s.T().Log("Tear Down test...")
 	defer s.cancelFunc()
 	if s.Cluster != nil {
+		s.dumpOnFailure()
 		s.Cluster.Stop()
 	}
 }
+
+// dumpOnFailure exports the meta of the cluster by ExportAllCSV and the cluster topology to
+// topology.json if the test failed, see failureDumpDirEnv. The topology is logged as well.
+func (s *MiniClusterSuite) dumpOnFailure() {
+	root := os.Getenv(failureDumpDirEnv)
+	if root == "" || !s.T().Failed() {
+		return
+	}
+	dir := filepath.Join(root, filepath.FromSlash(s.T().Name()))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := ExportAllCSV(ctx, s.Cluster.MetaWatcher, dir); err != nil {
+		s.T().Logf("failed to dump the meta of failed test: %v", err)
+		return
+	}
+	topology, err := s.Cluster.ShowClusterTopology(ctx)
+	if err == nil {
+		var data []byte
+		if data, err = topology.JSON(); err == nil {
+			err = os.WriteFile(filepath.Join(dir, "topology.json"), data, 0o644)
+		}
+	}
+	if err != nil {
+		s.T().Logf("failed to dump the cluster topology of failed test: %v", err)
+	} else {
+		s.T().Log(topology.String())
+	}
+	s.T().Logf("meta of failed test dumped to %s", dir)
+}
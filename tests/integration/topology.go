@@ -0,0 +1,183 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/milvus-io/milvus/internal/proto/querypb"
+	"github.com/milvus-io/milvus/pkg/util/typeutil"
+)
+
+// NodeTopology is the view of one node, joined from its session and the meta referencing it.
+type NodeTopology struct {
+	NodeID int64 `json:"nodeID"`
+	// Role is the server name of the session, or the role the node is referenced as if it's a ghost.
+	Role    string `json:"role"`
+	Address string `json:"address,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Replicas are the ids of the replicas the querynode belongs to.
+	Replicas []int64 `json:"replicas,omitempty"`
+	// Channels are the channels the datanode has watch infos of.
+	Channels []string `json:"channels,omitempty"`
+	// SegmentCount is the number of segments in the querynode distribution, -1 if not known.
+	SegmentCount int `json:"segmentCount"`
+	// Ghost is true if the node is referenced by the meta or the distribution but has no session.
+	Ghost bool `json:"ghost,omitempty"`
+}
+
+// ClusterTopology is the per node view of the cluster, in node id and role order.
+type ClusterTopology struct {
+	Nodes []*NodeTopology `json:"nodes"`
+}
+
+type nodeKey struct {
+	nodeID int64
+	role   string
+}
+
+// BuildClusterTopology joins the live sessions with the replica membership, the channel watch
+// infos and, if dists is not nil, the querynode distribution, e.g. of MiniCluster.ShowQueryCoordDist.
+// Nodes referenced by any of them without a session are included as ghosts.
+func BuildClusterTopology(watcher MetaWatcher, dists []*querypb.GetDataDistributionResponse) (*ClusterTopology, error) {
+	sessions, err := watcher.ShowSessions()
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := watcher.ShowReplicas()
+	if err != nil {
+		return nil, err
+	}
+	states, err := watcher.ShowChannelRemovalState()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[nodeKey]*NodeTopology)
+	getNode := func(nodeID int64, role string) *NodeTopology {
+		key := nodeKey{nodeID: nodeID, role: role}
+		node, ok := nodes[key]
+		if !ok {
+			node = &NodeTopology{NodeID: nodeID, Role: role, SegmentCount: -1, Ghost: true}
+			nodes[key] = node
+		}
+		return node
+	}
+	for _, session := range sessions {
+		node := getNode(session.ServerID, session.ServerName)
+		node.Address = session.Address
+		node.Version = session.SessionRaw.Version
+		node.Ghost = false
+	}
+	for _, replica := range replicas {
+		for _, nodeID := range replica.GetNodes() {
+			node := getNode(nodeID, typeutil.QueryNodeRole)
+			node.Replicas = append(node.Replicas, replica.GetID())
+		}
+	}
+	for _, state := range states {
+		for _, nodeID := range state.Watchers {
+			node := getNode(nodeID, typeutil.DataNodeRole)
+			node.Channels = append(node.Channels, state.Channel)
+		}
+	}
+	if dists != nil {
+		for _, node := range nodes {
+			if node.Role == typeutil.QueryNodeRole {
+				node.SegmentCount = 0
+			}
+		}
+		for _, dist := range dists {
+			node := getNode(dist.GetNodeID(), typeutil.QueryNodeRole)
+			node.SegmentCount = len(dist.GetSegments())
+		}
+	}
+
+	topology := &ClusterTopology{Nodes: make([]*NodeTopology, 0, len(nodes))}
+	for _, node := range nodes {
+		sort.Slice(node.Replicas, func(i, j int) bool { return node.Replicas[i] < node.Replicas[j] })
+		sort.Strings(node.Channels)
+		topology.Nodes = append(topology.Nodes, node)
+	}
+	sort.Slice(topology.Nodes, func(i, j int) bool {
+		if topology.Nodes[i].NodeID != topology.Nodes[j].NodeID {
+			return topology.Nodes[i].NodeID < topology.Nodes[j].NodeID
+		}
+		return topology.Nodes[i].Role < topology.Nodes[j].Role
+	})
+	return topology, nil
+}
+
+// Ghosts returns the nodes referenced without a session.
+func (topology *ClusterTopology) Ghosts() []*NodeTopology {
+	var ghosts []*NodeTopology
+	for _, node := range topology.Nodes {
+		if node.Ghost {
+			ghosts = append(ghosts, node)
+		}
+	}
+	return ghosts
+}
+
+// String renders the topology one node per line, e.g.
+//
+//	cluster topology, 3 nodes, 1 without session:
+//	  node 1 rootcoord: address localhost:53100, version 2.3.0
+//	  node 2 querynode: address localhost:21123, version 2.3.0, replicas [1], segments 4
+//	  node 9 datanode: GHOST without session, channels [by-dev-rootcoord-dml_0_100v0]
+func (topology *ClusterTopology) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "cluster topology, %d nodes, %d without session:\n", len(topology.Nodes), len(topology.Ghosts()))
+	for _, node := range topology.Nodes {
+		fields := make([]string, 0, 5)
+		if node.Ghost {
+			fields = append(fields, "GHOST without session")
+		} else {
+			fields = append(fields, "address "+node.Address, "version "+node.Version)
+		}
+		if len(node.Replicas) > 0 {
+			fields = append(fields, fmt.Sprintf("replicas %v", node.Replicas))
+		}
+		if len(node.Channels) > 0 {
+			fields = append(fields, fmt.Sprintf("channels %v", node.Channels))
+		}
+		if node.SegmentCount >= 0 {
+			fields = append(fields, "segments "+strconv.Itoa(node.SegmentCount))
+		}
+		fmt.Fprintf(&sb, "  node %d %s: %s\n", node.NodeID, node.Role, strings.Join(fields, ", "))
+	}
+	return sb.String()
+}
+
+// JSON returns the indented json form of the topology.
+func (topology *ClusterTopology) JSON() ([]byte, error) {
+	return json.MarshalIndent(topology, "", "  ")
+}
+
+// ShowClusterTopology builds the topology of the cluster with the querynode distribution.
+func (cluster *MiniCluster) ShowClusterTopology(ctx context.Context) (*ClusterTopology, error) {
+	dists, err := cluster.ShowQueryCoordDist(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return BuildClusterTopology(cluster.MetaWatcher, dists)
+}
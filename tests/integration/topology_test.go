@@ -0,0 +1,143 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/internal/proto/querypb"
+	"github.com/milvus-io/milvus/internal/util/sessionutil"
+	"github.com/milvus-io/milvus/pkg/util/funcutil"
+	"github.com/milvus-io/milvus/pkg/util/typeutil"
+)
+
+type topologyMetaWatcher struct {
+	MetaWatcher
+	sessions []*sessionutil.Session
+	replicas []*querypb.Replica
+	states   []*ChannelRemovalState
+}
+
+func (watcher *topologyMetaWatcher) ShowSessions() ([]*sessionutil.Session, error) {
+	return watcher.sessions, nil
+}
+
+func (watcher *topologyMetaWatcher) ShowReplicas() ([]*querypb.Replica, error) {
+	return watcher.replicas, nil
+}
+
+func (watcher *topologyMetaWatcher) ShowChannelRemovalState() ([]*ChannelRemovalState, error) {
+	return watcher.states, nil
+}
+
+func TestBuildClusterTopology(t *testing.T) {
+	session := func(id int64, role, address string) *sessionutil.Session {
+		s := &sessionutil.Session{}
+		s.ServerID, s.ServerName, s.Address = id, role, address
+		s.SessionRaw.Version = "2.3.0"
+		return s
+	}
+	watcher := &topologyMetaWatcher{
+		sessions: []*sessionutil.Session{
+			session(3, typeutil.QueryNodeRole, "localhost:21124"),
+			session(1, typeutil.RootCoordRole, "localhost:53100"),
+			session(2, typeutil.QueryNodeRole, "localhost:21123"),
+			session(2, typeutil.DataNodeRole, "localhost:21124"),
+		},
+		replicas: []*querypb.Replica{
+			{ID: 11, CollectionID: 100, Nodes: []int64{2, 9}},
+			{ID: 10, CollectionID: 101, Nodes: []int64{3, 2}},
+		},
+		states: []*ChannelRemovalState{
+			{Channel: "by-dev-rootcoord-dml_1_100v1", Watchers: []int64{2}},
+			{Channel: "by-dev-rootcoord-dml_0_100v0", Watchers: []int64{2, 8}},
+			{Channel: "by-dev-rootcoord-dml_2_101v0"},
+		},
+	}
+
+	// without distribution
+	topology, err := BuildClusterTopology(watcher, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "cluster topology, 6 nodes, 2 without session:\n"+
+		"  node 1 rootcoord: address localhost:53100, version 2.3.0\n"+
+		"  node 2 datanode: address localhost:21124, version 2.3.0, channels [by-dev-rootcoord-dml_0_100v0 by-dev-rootcoord-dml_1_100v1]\n"+
+		"  node 2 querynode: address localhost:21123, version 2.3.0, replicas [10 11]\n"+
+		"  node 3 querynode: address localhost:21124, version 2.3.0, replicas [10]\n"+
+		"  node 8 datanode: GHOST without session, channels [by-dev-rootcoord-dml_0_100v0]\n"+
+		"  node 9 querynode: GHOST without session, replicas [11]\n", topology.String())
+
+	// with distribution, querynodes missing from it have no segments
+	topology, err = BuildClusterTopology(watcher, []*querypb.GetDataDistributionResponse{
+		{NodeID: 2, Segments: []*querypb.SegmentVersionInfo{{ID: 1001}, {ID: 1002}}},
+		{NodeID: 7, Segments: []*querypb.SegmentVersionInfo{{ID: 1003}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "cluster topology, 7 nodes, 3 without session:\n"+
+		"  node 1 rootcoord: address localhost:53100, version 2.3.0\n"+
+		"  node 2 datanode: address localhost:21124, version 2.3.0, channels [by-dev-rootcoord-dml_0_100v0 by-dev-rootcoord-dml_1_100v1]\n"+
+		"  node 2 querynode: address localhost:21123, version 2.3.0, replicas [10 11], segments 2\n"+
+		"  node 3 querynode: address localhost:21124, version 2.3.0, replicas [10], segments 0\n"+
+		"  node 7 querynode: GHOST without session, segments 1\n"+
+		"  node 8 datanode: GHOST without session, channels [by-dev-rootcoord-dml_0_100v0]\n"+
+		"  node 9 querynode: GHOST without session, replicas [11], segments 0\n", topology.String())
+
+	ghosts := topology.Ghosts()
+	require.Len(t, ghosts, 3)
+	assert.EqualValues(t, []int64{7, 8, 9}, []int64{ghosts[0].NodeID, ghosts[1].NodeID, ghosts[2].NodeID})
+
+	data, err := topology.JSON()
+	require.NoError(t, err)
+	decoded := &ClusterTopology{}
+	require.NoError(t, json.Unmarshal(data, decoded))
+	assert.Equal(t, topology, decoded)
+	assert.Contains(t, string(data), `"ghost": true`)
+	assert.Contains(t, string(data), `"segmentCount": -1`)
+}
+
+func (s *MetaWatcherSuite) TestClusterTopology() {
+	c := s.Cluster
+	ctx, cancel := context.WithCancel(c.GetContext())
+	defer cancel()
+
+	collectionName := "TestClusterTopology" + funcutil.GenRandomStr()
+	_, vchannels := s.prepareFlushedCollection(ctx, collectionName, 3000)
+
+	// the querynodes of the mini cluster report the node id of paramtable in the distribution,
+	// so the ghosts are checked by the meta only
+	_, err := c.ShowClusterTopology(ctx)
+	s.Require().NoError(err)
+	topology, err := BuildClusterTopology(c.MetaWatcher, nil)
+	s.Require().NoError(err)
+	s.Empty(topology.Ghosts(), topology.String())
+
+	sessions, err := c.MetaWatcher.ShowSessions()
+	s.Require().NoError(err)
+	s.Len(topology.Nodes, len(sessions), topology.String())
+
+	var watched []string
+	for _, node := range topology.Nodes {
+		if node.Role == typeutil.DataNodeRole {
+			watched = append(watched, node.Channels...)
+		}
+	}
+	s.Subset(watched, vchannels, topology.String())
+}
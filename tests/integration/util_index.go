@@ -19,12 +19,14 @@ package integration
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
 	"github.com/milvus-io/milvus-proto/go-api/v2/milvuspb"
+	"github.com/milvus-io/milvus/internal/proto/indexpb"
 	"github.com/milvus-io/milvus/pkg/common"
 	"github.com/milvus-io/milvus/pkg/util/indexparamcheck"
 )
@@ -84,6 +86,99 @@ func (s *MiniClusterSuite) waitForIndexBuiltInternal(ctx context.Context, dbName
 	}
 }
 
+// IndexProgress is the build progress of one index over the flushed segments of a collection.
+type IndexProgress struct {
+	IndexID   int64
+	IndexName string
+	FieldID   int64
+	// number of flushed segments by the state of their index build
+	Finished   int
+	InProgress int
+	Failed     int
+	Unindexed  int
+
+	IndexedRows int64
+	TotalRows   int64
+}
+
+// Progress returns the ratio of indexed rows, a collection without rows is regarded as fully indexed.
+func (p *IndexProgress) Progress() float64 {
+	if p.TotalRows == 0 {
+		return 1
+	}
+	return float64(p.IndexedRows) / float64(p.TotalRows)
+}
+
+func (p *IndexProgress) String() string {
+	return fmt.Sprintf("IndexID: %d IndexName: %s FieldID: %d Finished: %d InProgress: %d Failed: %d Unindexed: %d Rows: %d/%d (%.1f%%)",
+		p.IndexID, p.IndexName, p.FieldID, p.Finished, p.InProgress, p.Failed, p.Unindexed, p.IndexedRows, p.TotalRows, p.Progress()*100)
+}
+
+// GetIndexBuildProgress joins the flushed segments of the collection with segment index meta,
+// returns the build progress of each index.
+func GetIndexBuildProgress(watcher MetaWatcher, collectionID int64) ([]*IndexProgress, error) {
+	segments, err := watcher.ShowSegments()
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := watcher.ShowIndexes(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	segmentIndexes, err := watcher.ShowSegmentIndexes(collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// indexID -> segmentID -> latest build
+	builds := make(map[int64]map[int64]*indexpb.SegmentIndex)
+	for _, segmentIndex := range segmentIndexes {
+		segmentBuilds, ok := builds[segmentIndex.GetIndexID()]
+		if !ok {
+			segmentBuilds = make(map[int64]*indexpb.SegmentIndex)
+			builds[segmentIndex.GetIndexID()] = segmentBuilds
+		}
+		if prev, ok := segmentBuilds[segmentIndex.GetSegmentID()]; !ok || prev.GetBuildID() < segmentIndex.GetBuildID() {
+			segmentBuilds[segmentIndex.GetSegmentID()] = segmentIndex
+		}
+	}
+
+	progresses := make([]*IndexProgress, 0, len(indexes))
+	for _, index := range indexes {
+		info := index.GetIndexInfo()
+		progress := &IndexProgress{
+			IndexID:   info.GetIndexID(),
+			IndexName: info.GetIndexName(),
+			FieldID:   info.GetFieldID(),
+		}
+		for _, segment := range segments {
+			if segment.GetCollectionID() != collectionID || segment.GetState() != commonpb.SegmentState_Flushed || segment.GetCompacted() {
+				continue
+			}
+			progress.TotalRows += segment.GetNumOfRows()
+			build, ok := builds[info.GetIndexID()][segment.GetID()]
+			if !ok {
+				progress.Unindexed++
+				continue
+			}
+			switch build.GetState() {
+			case commonpb.IndexState_Finished:
+				progress.Finished++
+				progress.IndexedRows += segment.GetNumOfRows()
+			case commonpb.IndexState_Failed:
+				progress.Failed++
+			default:
+				progress.InProgress++
+			}
+		}
+		progresses = append(progresses, progress)
+	}
+	sort.Slice(progresses, func(i, j int) bool {
+		return progresses[i].IndexID < progresses[j].IndexID
+	})
+	return progresses, nil
+}
+
 func waitingForIndexBuilt(ctx context.Context, cluster *MiniCluster, t *testing.T, collection, field string) {
 	getIndexBuilt := func() bool {
 		resp, err := cluster.Proxy.DescribeIndex(ctx, &milvuspb.DescribeIndexRequest{
@@ -0,0 +1,124 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus/internal/proto/datapb"
+)
+
+// SegmentLevel is the compaction level of a segment.
+type SegmentLevel string
+
+const (
+	SegmentLevelL0 SegmentLevel = "L0"
+	SegmentLevelL1 SegmentLevel = "L1"
+	SegmentLevelL2 SegmentLevel = "L2"
+)
+
+// GetSegmentLevel returns the level of the segment. SegmentInfo does not carry a level yet,
+// so all segments are treated as legacy ones, which are L1, and no L0 segment is ever written
+// to wait for the compaction of.
+func GetSegmentLevel(segment *datapb.SegmentInfo) SegmentLevel {
+	return SegmentLevelL1
+}
+
+// SegmentLevelStat is the aggregation of segments at one level.
+type SegmentLevelStat struct {
+	Count int
+	Rows  int64
+	Bytes int64
+}
+
+// SegmentLevelSummary is the segment level stats of one collection, grouped by channel and level.
+type SegmentLevelSummary map[string]map[SegmentLevel]*SegmentLevelStat
+
+// Count returns the number of segments at the level in all channels.
+func (summary SegmentLevelSummary) Count(level SegmentLevel) int {
+	count := 0
+	for _, levels := range summary {
+		if stat, ok := levels[level]; ok {
+			count += stat.Count
+		}
+	}
+	return count
+}
+
+// String renders the summary as a table.
+func (summary SegmentLevelSummary) String() string {
+	channels := make([]string, 0, len(summary))
+	for channel := range summary {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%-48s %-5s %8s %12s %14s\n", "Channel", "Level", "Segments", "Rows", "Bytes"))
+	for _, channel := range channels {
+		for _, level := range []SegmentLevel{SegmentLevelL0, SegmentLevelL1, SegmentLevelL2} {
+			stat, ok := summary[channel][level]
+			if !ok {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("%-48s %-5s %8d %12d %14d\n", channel, level, stat.Count, stat.Rows, stat.Bytes))
+		}
+	}
+	return sb.String()
+}
+
+// GetSegmentLevelSummary summarizes the alive segments of the collection by channel and level.
+func GetSegmentLevelSummary(watcher MetaWatcher, collectionID int64) (SegmentLevelSummary, error) {
+	segments, err := watcher.ShowSegments()
+	if err != nil {
+		return nil, err
+	}
+	binlogs, err := watcher.ShowBinlogs(collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := make(SegmentLevelSummary)
+	for _, segment := range segments {
+		if segment.GetCollectionID() != collectionID || segment.GetState() == commonpb.SegmentState_Dropped || segment.GetCompacted() {
+			continue
+		}
+		levels, ok := summary[segment.GetInsertChannel()]
+		if !ok {
+			levels = make(map[SegmentLevel]*SegmentLevelStat)
+			summary[segment.GetInsertChannel()] = levels
+		}
+		level := GetSegmentLevel(segment)
+		stat, ok := levels[level]
+		if !ok {
+			stat = &SegmentLevelStat{}
+			levels[level] = stat
+		}
+		stat.Count++
+		stat.Rows += segment.GetNumOfRows()
+		// binlogs of legacy segments are kept inline
+		for _, fieldBinlog := range append(binlogs[segment.GetID()], segment.GetBinlogs()...) {
+			for _, binlog := range fieldBinlog.GetBinlogs() {
+				stat.Bytes += binlog.GetLogSize()
+			}
+		}
+	}
+	return summary, nil
+}